@@ -2,12 +2,41 @@ package main
 
 import (
 	"fmt"
+	"os"
 	bot "telegram-bot-feedback/internal/app"
 	l "telegram-bot-feedback/internal/pkg/logger"
 )
 
 // Starts the bot
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "smoketest" {
+		if err := bot.Smoketest(os.Args[2:]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "restore-vault" {
+		if err := bot.RestoreVault(os.Args[2:]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		if err := bot.ImportHistory(os.Args[2:]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "console" {
+		if err := bot.DevConsole(os.Args[2:]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
 	err := bot.Start()
 	if err != nil {
 		l.Fatal(err)
@@ -7,6 +7,7 @@ require (
 	github.com/gookit/slog v0.5.4
 	github.com/spf13/viper v1.16.0
 	golang.org/x/exp v0.0.0-20230725093048-515e97ebf090 // direct
+	golang.org/x/sys v0.10.0 // direct
 	gorm.io/gorm v1.25.2 // direct
 	github.com/dustin/go-humanize v1.0.1 // indirect
 	github.com/fsnotify/fsnotify v1.6.0 // indirect
@@ -31,7 +32,6 @@ require (
 	github.com/valyala/bytebufferpool v1.0.0 // indirect
 	github.com/xo/terminfo v0.0.0-20220910002029-abceb7e1c41e // indirect
 	golang.org/x/sync v0.3.0 // indirect
-	golang.org/x/sys v0.10.0 // indirect
 	golang.org/x/text v0.11.0 // indirect
 	gopkg.in/ini.v1 v1.67.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
@@ -0,0 +1,234 @@
+package run
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	tg "telegram-bot-feedback/internal/pkg/bot"
+	"telegram-bot-feedback/internal/pkg/config"
+	"telegram-bot-feedback/internal/pkg/database"
+	l "telegram-bot-feedback/internal/pkg/logger"
+	api "telegram-bot-feedback/pkg/telegram-bot-api"
+	"time"
+)
+
+// devBotID is the ID of the bot in the development console
+const devBotID = 1000
+
+// DevConsole runs the bot without Telegram: lines from stdin become Updates and
+// requests to the Bot API are printed to stdout
+//
+// Usage: console [-user <id>] [-admin <id>]
+// Lines: "<text>" is a user message, "!admin <text>" an admin message,
+// "!cb <data>" a callback query of the user and "!admin !cb <data>" of the admin.
+// The storage is in memory
+func DevConsole(args []string) error {
+	flags := flag.NewFlagSet("console", flag.ContinueOnError)
+	userID := flags.Int("user", 1, "chat ID of the user")
+	adminID := flags.Int("admin", 2, "chat ID of the admin")
+	if err := flags.Parse(args); err != nil {
+		return l.Err(err)
+	}
+
+	db, err := database.InitMemory()
+	if err != nil {
+		return l.Err(err)
+	}
+	if err := database.AddEmployeeByID(db, *adminID); err != nil {
+		return l.Err(err)
+	}
+	conf, err := config.GetFileConfig(filepath.Join(os.TempDir(), "telegram-bot-feedback-console.json"))
+	if err != nil {
+		return l.Err(err)
+	}
+	conf.Set("admins", []int{*adminID})
+
+	fake := &fakeAPI{out: os.Stdout, lastMessage: map[int]int{}}
+	client, err := api.NewWithClient("console", "http://console/", fake)
+	if err != nil {
+		return l.Err(err)
+	}
+	app := tg.NewApp(client, db, conf)
+
+	fmt.Printf("Console bot @%s, user %d, admin %d. Type \"<text>\", \"!admin <text>\", \"!cb <data>\" or \"!quit\"\n", client.Self.UserName, *userID, *adminID)
+	in := bufio.NewScanner(os.Stdin)
+	for updateID := 1; in.Scan(); updateID++ {
+		line := strings.TrimSpace(in.Text())
+		if line == "" {
+			continue
+		}
+		if line == "!quit" {
+			return nil
+		}
+		update := lineToUpdate(line, updateID, *userID, *adminID, fake.last)
+		if err := app.HandleUpdate(&update); err != nil {
+			fmt.Println("error:", err)
+		}
+	}
+	return l.Err(in.Err())
+}
+
+// lineToUpdate converts the console line to the Update
+//
+// last returns the ID of the last bot message in the chat, callback queries belong to it
+func lineToUpdate(line string, updateID, userID, adminID int, last func(chatID int) int) api.Update {
+	from := api.User{ID: userID, FirstName: "User", UserName: "user"}
+	if rest, ok := strings.CutPrefix(line, "!admin "); ok {
+		from = api.User{ID: adminID, FirstName: "Admin", UserName: "admin"}
+		line = strings.TrimSpace(rest)
+	}
+	chat := &api.Chat{ID: from.ID, Type: "private", FirstName: from.FirstName, Username: from.UserName}
+	if data, ok := strings.CutPrefix(line, "!cb "); ok {
+		return api.Update{
+			UpdateID: updateID,
+			CallbackQuery: &api.CallbackQuery{
+				ID:      strconv.Itoa(updateID),
+				From:    &from,
+				Message: &api.Message{MessageID: last(chat.ID), Chat: chat, From: &api.User{ID: devBotID, IsBot: true}},
+				Data:    strings.TrimSpace(data),
+			},
+		}
+	}
+	message := &api.Message{
+		MessageID: updateID,
+		From:      &from,
+		Chat:      chat,
+		Date:      int(time.Now().Unix()),
+		Text:      line,
+	}
+	if strings.HasPrefix(line, "/") {
+		command, _, _ := strings.Cut(line, " ")
+		message.Entities = []*api.MessageEntity{{Type: "bot_command", Offset: 0, Length: api.UTF16Len(command)}}
+	}
+	return api.Update{UpdateID: updateID, Message: message}
+}
+
+// fakeAPI answers Bot API requests without Telegram and prints them
+type fakeAPI struct {
+	mu          sync.Mutex
+	out         io.Writer
+	nextID      int
+	lastMessage map[int]int
+}
+
+// last returns the ID of the last message sent to the chat
+func (f *fakeAPI) last(chatID int) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.lastMessage[chatID]
+}
+
+// Do prints the request and returns a successful response
+func (f *fakeAPI) Do(req *http.Request) (*http.Response, error) {
+	method := path.Base(req.URL.Path)
+	params, err := requestParams(req)
+	if err != nil {
+		return nil, err
+	}
+	chatID, _ := strconv.Atoi(fmt.Sprint(params["chat_id"]))
+
+	f.mu.Lock()
+	var result interface{} = true
+	switch {
+	case method == "getMe":
+		result = api.User{ID: devBotID, IsBot: true, FirstName: "Feedback", UserName: "feedback_console_bot"}
+	case method == "getChat":
+		result = api.Chat{ID: chatID, Type: "private"}
+	case method == "copyMessage":
+		f.nextID++
+		f.lastMessage[chatID] = f.nextID
+		result = api.MessageId{MessageID: f.nextID}
+	case strings.HasPrefix(method, "editMessage"):
+		messageID, _ := strconv.Atoi(fmt.Sprint(params["message_id"]))
+		result = api.Message{MessageID: messageID, Chat: &api.Chat{ID: chatID, Type: "private"}, Date: int(time.Now().Unix()), Text: fmt.Sprint(params["text"])}
+	case strings.HasPrefix(method, "send") && method != "sendChatAction" || method == "forwardMessage":
+		f.nextID++
+		f.lastMessage[chatID] = f.nextID
+		result = api.Message{MessageID: f.nextID, Chat: &api.Chat{ID: chatID, Type: "private"}, Date: int(time.Now().Unix()), Text: fmt.Sprint(params["text"])}
+	}
+	if method != "getMe" && method != "sendChatAction" {
+		printRequest(f.out, method, params)
+	}
+	f.mu.Unlock()
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(api.APIResponse{Ok: true, Result: data})
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(bytes.NewReader(body)),
+		Request:    req,
+	}, nil
+}
+
+// requestParams returns the parameters of the JSON or multipart request
+func requestParams(req *http.Request) (map[string]interface{}, error) {
+	params := map[string]interface{}{}
+	if strings.HasPrefix(req.Header.Get("Content-Type"), "multipart/") {
+		if err := req.ParseMultipartForm(32 << 20); err != nil {
+			return nil, err
+		}
+		for key, values := range req.MultipartForm.Value {
+			params[key] = values[0]
+		}
+		for key := range req.MultipartForm.File {
+			params[key] = "<file>"
+		}
+		return params, nil
+	}
+	if req.Body == nil {
+		return params, nil
+	}
+	err := json.NewDecoder(req.Body).Decode(&params)
+	if err == io.EOF {
+		err = nil
+	}
+	return params, err
+}
+
+// printRequest prints the method, the chat, the text and the other parameters of the request
+func printRequest(out io.Writer, method string, params map[string]interface{}) {
+	line := "<- " + method
+	if chatID, ok := params["chat_id"]; ok {
+		line += " [" + fmt.Sprint(chatID) + "]"
+	}
+	for _, key := range []string{"text", "caption"} {
+		if value, ok := params[key]; ok {
+			line += " " + strconv.Quote(fmt.Sprint(value))
+		}
+	}
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		switch key {
+		case "chat_id", "text", "caption":
+			continue
+		}
+		data, err := json.Marshal(params[key])
+		if err != nil {
+			continue
+		}
+		line += " " + key + "=" + string(data)
+	}
+	fmt.Fprintln(out, line)
+}
@@ -0,0 +1,91 @@
+package run
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	tg "telegram-bot-feedback/internal/pkg/bot"
+	"telegram-bot-feedback/internal/pkg/config"
+	"telegram-bot-feedback/internal/pkg/database"
+	api "telegram-bot-feedback/pkg/telegram-bot-api"
+	"testing"
+)
+
+// lastMessage is the last bot message of every chat in the line tests
+func lastMessage(chatID int) int {
+	return 40 + chatID
+}
+
+func TestLineToUpdate(t *testing.T) {
+	update := lineToUpdate("hello there", 7, 1, 2, lastMessage)
+	if m := update.Message; update.UpdateID != 7 || m == nil || m.From.ID != 1 || m.Chat.ID != 1 || m.Text != "hello there" || m.MessageID != 7 || m.IsCommand() {
+		t.Fatalf("text = %+v", update.Message)
+	}
+
+	update = lineToUpdate("!admin   thanks", 8, 1, 2, lastMessage)
+	if m := update.Message; m == nil || m.From.ID != 2 || m.Chat.ID != 2 || m.Text != "thanks" {
+		t.Fatalf("admin text = %+v", update.Message)
+	}
+
+	update = lineToUpdate("/start now", 9, 1, 2, lastMessage)
+	if m := update.Message; m == nil || !m.IsCommand() || m.Command() != "start" || m.CommandArguments() != "now" {
+		t.Fatalf("command = %+v", update.Message)
+	}
+
+	update = lineToUpdate("!cb 3-1", 10, 1, 2, lastMessage)
+	if cb := update.CallbackQuery; update.Message != nil || cb == nil || cb.From.ID != 1 || cb.Data != "3-1" || cb.Message.MessageID != 41 || cb.Message.Chat.ID != 1 {
+		t.Fatalf("callback = %+v", update.CallbackQuery)
+	}
+
+	update = lineToUpdate("!admin !cb 5-2", 11, 1, 2, lastMessage)
+	if cb := update.CallbackQuery; cb == nil || cb.From.ID != 2 || cb.Data != "5-2" || cb.Message.MessageID != 42 || !cb.Message.From.IsBot {
+		t.Fatalf("admin callback = %+v", update.CallbackQuery)
+	}
+}
+
+func TestPrintRequest(t *testing.T) {
+	var out bytes.Buffer
+	printRequest(&out, "sendMessage", map[string]interface{}{"chat_id": 1, "text": "Hi\nthere", "parse_mode": "HTML", "disable_notification": true})
+	if got, want := out.String(), "<- sendMessage [1] \"Hi\\nthere\" disable_notification=true parse_mode=\"HTML\"\n"; got != want {
+		t.Fatalf("printRequest = %q, want %q", got, want)
+	}
+}
+
+func TestFakeAPIRunsThePipeline(t *testing.T) {
+	var out bytes.Buffer
+	fake := &fakeAPI{out: &out, lastMessage: map[int]int{}}
+	client, err := api.NewWithClient("console", "http://console/", fake)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.Self.UserName != "feedback_console_bot" {
+		t.Fatalf("bot = %+v", client.Self)
+	}
+	db, err := database.InitMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.AddEmployeeByID(db, 2); err != nil {
+		t.Fatal(err)
+	}
+	conf, err := config.GetFileConfig(filepath.Join(t.TempDir(), "config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf.Set("admins", []int{2})
+	app := tg.NewApp(client, db, conf)
+
+	update := lineToUpdate("/start", 1, 1, 2, fake.last)
+	if err := app.HandleUpdate(&update); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "<- sendMessage [1] ") {
+		t.Fatalf("output = %q, want the reply to the user", out.String())
+	}
+	if fake.last(1) == 0 {
+		t.Fatal("the last message of the user chat is not tracked")
+	}
+	if strings.Contains(out.String(), "getMe") {
+		t.Fatalf("getMe is printed: %q", out.String())
+	}
+}
@@ -0,0 +1,261 @@
+package run
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	tg "telegram-bot-feedback/internal/pkg/bot"
+	"telegram-bot-feedback/internal/pkg/database"
+	l "telegram-bot-feedback/internal/pkg/logger"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// exportDateLayout is the layout of "date" in Telegram Desktop exports, in the local time of the exporting computer
+const exportDateLayout = "2006-01-02T15:04:05"
+
+// deletedAccount is the sender name of messages from deleted accounts
+const deletedAccount = "Deleted Account"
+
+// ImportStats is the number of imported, skipped and failed messages
+type ImportStats struct {
+	Imported int
+	Skipped  int // service messages, empty messages and messages imported before
+	Failed   int
+}
+
+// exportMessage is a message of the Telegram Desktop export "result.json"
+type exportMessage struct {
+	ID           int        `json:"id"`
+	Type         string     `json:"type"`
+	Date         string     `json:"date"`
+	DateUnix     string     `json:"date_unixtime"`
+	From         *string    `json:"from"`
+	FromID       string     `json:"from_id"`
+	Text         exportText `json:"text"`
+	Photo        string     `json:"photo"`
+	File         string     `json:"file"`
+	FileName     string     `json:"file_name"`
+	ReplyToID    int        `json:"reply_to_message_id"`
+	MediaType    string     `json:"media_type"`
+	StickerEmoji string     `json:"sticker_emoji"`
+}
+
+// exportText is the text of an exported message: a string, or a list of strings and formatted parts
+type exportText string
+
+// UnmarshalJSON joins the parts of the text
+func (t *exportText) UnmarshalJSON(data []byte) error {
+	var plain string
+	if err := json.Unmarshal(data, &plain); err == nil {
+		*t = exportText(plain)
+		return nil
+	}
+	var parts []json.RawMessage
+	if err := json.Unmarshal(data, &parts); err != nil {
+		return err
+	}
+	var b strings.Builder
+	for _, part := range parts {
+		var text string
+		if err := json.Unmarshal(part, &text); err == nil {
+			b.WriteString(text)
+			continue
+		}
+		entity := struct {
+			Text string `json:"text"`
+		}{}
+		if err := json.Unmarshal(part, &entity); err != nil {
+			return err
+		}
+		b.WriteString(entity.Text)
+	}
+	*t = exportText(b.String())
+	return nil
+}
+
+// ImportHistory imports the history of the feedback chat from a Telegram Desktop export
+//
+// Usage: import -file result.json -chat <chat ID>
+// Messages imported before are skipped, so an import can be repeated after a failure
+func ImportHistory(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	file := flags.String("file", "", "result.json of the Telegram Desktop export (JSON format)")
+	chat := flags.Int("chat", 0, "ID of the exported chat, e.g. -100123")
+	if err := flags.Parse(args); err != nil {
+		return l.Err(err)
+	}
+	if *file == "" || *chat == 0 {
+		return l.NewError("import: -file and -chat are required")
+	}
+	f, err := os.Open(*file)
+	if err != nil {
+		return l.Err(err)
+	}
+	defer f.Close()
+	db, err := openDatabase("sqlite")
+	if err != nil {
+		return l.Err(err)
+	}
+	stats, err := importExport(f, *chat, db)
+	fmt.Printf("Imported %d messages, skipped %d, failed %d\n", stats.Imported, stats.Skipped, stats.Failed)
+	return l.Err(err)
+}
+
+// importExport reads the export message by message and saves the messages of users
+//
+// The file is never loaded whole: only the "messages" list is decoded, one message at a time
+func importExport(r io.Reader, chatId int, db *gorm.DB) (ImportStats, error) {
+	stats := ImportStats{}
+	decoder := json.NewDecoder(r)
+	if err := expectDelim(decoder, '{'); err != nil {
+		return stats, err
+	}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return stats, l.Err(err)
+		}
+		if token != "messages" {
+			var skip json.RawMessage
+			if err := decoder.Decode(&skip); err != nil {
+				return stats, l.Err(err)
+			}
+			continue
+		}
+		if err := expectDelim(decoder, '['); err != nil {
+			return stats, err
+		}
+		for decoder.More() {
+			var raw json.RawMessage
+			if err := decoder.Decode(&raw); err != nil {
+				return stats, l.Err(err)
+			}
+			importMessage(raw, chatId, &stats, db)
+		}
+		if err := expectDelim(decoder, ']'); err != nil {
+			return stats, err
+		}
+	}
+	return stats, nil
+}
+
+// importMessage saves the exported message into the Questions and counts it
+func importMessage(raw json.RawMessage, chatId int, stats *ImportStats, db *gorm.DB) {
+	exported := exportMessage{}
+	if err := json.Unmarshal(raw, &exported); err != nil {
+		l.Warn(l.WithFields(l.NewError("Malformed message in the export: "+err.Error()), "message", string(raw)))
+		stats.Failed++
+		return
+	}
+	message, err := exported.importedMessage(chatId)
+	if err != nil {
+		l.Warn(l.WithFields(l.NewError("Malformed message in the export: "+err.Error()), "id", exported.ID))
+		stats.Failed++
+		return
+	}
+	if message == nil {
+		stats.Skipped++
+		return
+	}
+	sender, err := importedSender(message, db)
+	if err != nil {
+		l.Error(err)
+		stats.Failed++
+		return
+	}
+	added, err := database.AddImportedMessage(message, sender, db)
+	switch {
+	case err != nil:
+		l.Error(err)
+		stats.Failed++
+	case added:
+		stats.Imported++
+	default:
+		stats.Skipped++
+	}
+}
+
+// importedMessage returns the stored form of the message, nil for service messages and messages without content
+func (m exportMessage) importedMessage(chatId int) (*database.ImportedMessage, error) {
+	if m.Type != "message" || m.ID == 0 {
+		return nil, nil
+	}
+	date, err := m.date()
+	if err != nil {
+		return nil, err
+	}
+	media := m.Photo
+	if media == "" {
+		media = m.File
+	}
+	if media != "" && strings.HasPrefix(media, "(") && m.FileName != "" {
+		// The file is not included in the export, the original name is kept
+		media = m.FileName
+	}
+	text := string(m.Text)
+	if text == "" && m.StickerEmoji != "" {
+		text = m.StickerEmoji
+	}
+	if text == "" && media == "" {
+		return nil, nil
+	}
+	name := deletedAccount
+	if m.From != nil && *m.From != "" {
+		name = *m.From
+	}
+	return &database.ImportedMessage{
+		ChatID:     chatId,
+		MessageID:  m.ID,
+		SenderID:   m.FromID,
+		SenderName: name,
+		Date:       date,
+		Text:       text,
+		Media:      media,
+		ReplyTo:    m.ReplyToID,
+	}, nil
+}
+
+// importedSender returns the User of the sender, nil if the export has no user ID ("user123")
+func importedSender(message *database.ImportedMessage, db *gorm.DB) (*database.User, error) {
+	chatId, err := strconv.Atoi(strings.TrimPrefix(message.SenderID, "user"))
+	if err != nil || !strings.HasPrefix(message.SenderID, "user") {
+		return nil, nil
+	}
+	name := message.SenderName
+	if name == deletedAccount {
+		name = ""
+	}
+	user, err := database.AddImportedUser(chatId, name, tg.SMain, db)
+	return user, l.Err(err)
+}
+
+// date returns the date of the message, "date_unixtime" of newer exports is preferred
+func (m exportMessage) date() (time.Time, error) {
+	if m.DateUnix != "" {
+		seconds, err := strconv.ParseInt(m.DateUnix, 10, 64)
+		if err != nil {
+			return time.Time{}, l.Err(err)
+		}
+		return time.Unix(seconds, 0), nil
+	}
+	date, err := time.ParseInLocation(exportDateLayout, m.Date, time.Local)
+	return date, l.Err(err)
+}
+
+// expectDelim reads the next token and checks it is the delimiter
+func expectDelim(decoder *json.Decoder, delim json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return l.Err(err)
+	}
+	if token != delim {
+		return l.NewError("Unexpected " + fmt.Sprint(token) + " in the export, expected " + delim.String())
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package run
+
+import (
+	"os"
+	"telegram-bot-feedback/internal/pkg/database"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// importFixture imports the trimmed export testdata/export.json
+func importFixture(t *testing.T, db *gorm.DB) ImportStats {
+	t.Helper()
+	f, err := os.Open("testdata/export.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	stats, err := importExport(f, -1001234567890, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stats
+}
+
+func TestImportExport(t *testing.T) {
+	db, err := database.InitMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The service message and the sticker without an emoji are skipped, the message with a broken date fails
+	if stats := importFixture(t, db); stats != (ImportStats{Imported: 5, Skipped: 2, Failed: 1}) {
+		t.Fatalf("stats = %+v", stats)
+	}
+	if stats := importFixture(t, db); stats != (ImportStats{Skipped: 7, Failed: 1}) {
+		t.Fatalf("stats of the second import = %+v, every message is imported before", stats)
+	}
+
+	ann := database.GetUserByChatID(11, db)
+	if ann == nil || ann.FirstName != "Ann" {
+		t.Fatalf("sender = %+v", ann)
+	}
+	dialog := database.ListDialog(int(ann.ID), database.DialogOptions{}, db)
+	want := []database.DialogMessage{
+		{Time: time.Unix(1614593100, 0), Text: "The app crashes on start"},
+		{Time: time.Unix(1614593220, 0), FromEmployee: true, Text: "Please send a screenshot"},
+		{Time: time.Unix(1614593340, 0), Text: "[photo_1@01-03-2021_10-09-00.jpg]"},
+		{Time: time.Unix(1614672060, 0), Text: "👍"},
+	}
+	if len(dialog) != len(want) {
+		t.Fatalf("history = %+v", dialog)
+	}
+	for i, m := range dialog {
+		if !m.Time.Equal(want[i].Time) || m.FromEmployee != want[i].FromEmployee || m.Text != want[i].Text {
+			t.Fatalf("history[%d] = %+v, want %+v", i, m, want[i])
+		}
+	}
+	if dialog[1].QuestionID != dialog[0].QuestionID || dialog[3].QuestionID == dialog[0].QuestionID {
+		t.Fatalf("replies are not threaded: %+v", dialog)
+	}
+	question := database.GetQuestionById(dialog[0].QuestionID, db)
+	if !question.IsClosed || !question.HaveAnswer {
+		t.Fatalf("question = %+v, want closed and answered", question)
+	}
+
+	found := database.SearchQuestions([]string{"screenshot"}, 10, db)
+	if len(found) != 1 || int(found[0].ID) != dialog[0].QuestionID {
+		t.Fatalf("found = %+v", found)
+	}
+	deleted := database.GetUserByChatID(13, db)
+	if deleted == nil || len(database.ListDialog(int(deleted.ID), database.DialogOptions{}, db)) != 1 {
+		t.Fatal("the message of the deleted account is not imported")
+	}
+	if len(database.SearchQuestions([]string{"log.txt"}, 10, db)) != 1 {
+		t.Fatal("the file which is not included is not found by its name")
+	}
+}
@@ -0,0 +1,59 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	l "telegram-bot-feedback/internal/pkg/logger"
+	"time"
+)
+
+// Email sends a plain text summary of Feedback over SMTP
+type Email struct {
+	Addr     string // "host:port"
+	Username string // PLAIN auth is used if it is set
+	Password string
+	From     string
+	To       []string
+}
+
+// Notify sends the summary, the context only limits waiting for the previous attempt
+func (e *Email) Notify(ctx context.Context, feedback Feedback) error {
+	if ctx.Err() != nil {
+		return l.Err(ctx.Err())
+	}
+	if len(e.To) == 0 {
+		return Permanent(l.NewError("notify_email_to is empty"))
+	}
+	var auth smtp.Auth
+	if e.Username != "" {
+		host, _, err := net.SplitHostPort(e.Addr)
+		if err != nil {
+			return Permanent(l.Err(err))
+		}
+		auth = smtp.PlainAuth("", e.Username, e.Password, host)
+	}
+	err := smtp.SendMail(e.Addr, auth, e.From, e.To, emailMessage(e.From, e.To, feedback))
+	return l.Err(err)
+}
+
+// emailMessage returns the message with headers and the summary of the Feedback
+func emailMessage(from string, to []string, feedback Feedback) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&b, "Subject: New %s #%d\r\n", feedback.Kind, feedback.ID)
+	fmt.Fprintf(&b, "Date: %s\r\n", feedback.Date.Format(time.RFC1123Z))
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(&b, "%s #%d from %s\r\n", strings.ToUpper(feedback.Kind[:1])+feedback.Kind[1:], feedback.ID, feedback.User)
+	if feedback.Category != "" {
+		fmt.Fprintf(&b, "Category: %s\r\n", feedback.Category)
+	}
+	if feedback.Rating != 0 {
+		fmt.Fprintf(&b, "Rating: %d/5\r\n", feedback.Rating)
+	}
+	b.WriteString("\r\n" + strings.ReplaceAll(feedback.Text, "\n", "\r\n") + "\r\n")
+	return []byte(b.String())
+}
@@ -0,0 +1,135 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	l "telegram-bot-feedback/internal/pkg/logger"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// attemptTimeout limits one delivery attempt
+const attemptTimeout = 30 * time.Second
+
+// Retry delays, tests shorten them
+var (
+	// retryBaseDelay is the delay after the first failure, it doubles with every attempt
+	retryBaseDelay = time.Second
+	// retryMaxDelay is the longest delay between attempts
+	retryMaxDelay = time.Minute
+)
+
+// Feedback is a new Review or Question sent to notifiers
+type Feedback struct {
+	Kind     string    `json:"kind"` // "review" or "question"
+	ID       uint      `json:"id"`
+	UserID   int       `json:"user_id"` // chat ID of the user
+	User     string    `json:"user"`
+	Category string    `json:"category,omitempty"`
+	Rating   int       `json:"rating,omitempty"`
+	Text     string    `json:"text"`
+	Date     time.Time `json:"date"`
+}
+
+// Notifier pushes Feedback to an external system
+type Notifier interface {
+	Notify(ctx context.Context, feedback Feedback) error
+}
+
+// permanentError is a failure which is not retried
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks the error of a Notifier as not worth retrying
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err: err}
+}
+
+// Dispatcher runs notifiers in the background
+type Dispatcher struct {
+	Notifiers []Notifier
+	Retries   int // retries after the first failed attempt
+}
+
+// New returns the Dispatcher with the notifiers configured by "notify_*" keys
+func New(conf *viper.Viper) *Dispatcher {
+	d := &Dispatcher{Retries: conf.GetInt("notify_retries")}
+	if url := conf.GetString("notify_webhook_url"); url != "" {
+		d.Notifiers = append(d.Notifiers, NewWebhook(url, conf.GetString("notify_webhook_secret")))
+	}
+	if addr := conf.GetString("notify_smtp_addr"); addr != "" {
+		d.Notifiers = append(d.Notifiers, &Email{
+			Addr:     addr,
+			Username: conf.GetString("notify_smtp_user"),
+			Password: conf.GetString("notify_smtp_password"),
+			From:     conf.GetString("notify_email_from"),
+			To:       conf.GetStringSlice("notify_email_to"),
+		})
+	}
+	return d
+}
+
+// Notify sends the Feedback to every notifier in its own goroutine and returns at once
+//
+// Failures are retried with a jittered exponential backoff and logged, they never reach the caller
+func (d *Dispatcher) Notify(feedback Feedback) {
+	if d == nil {
+		return
+	}
+	for _, notifier := range d.Notifiers {
+		go d.deliver(notifier, feedback)
+	}
+}
+
+// Deliver sends the Feedback to the notifiers one after another and returns when all are done
+//
+// Unlike Notify it keeps the order of calls, failures are retried and logged the same way
+func (d *Dispatcher) Deliver(feedback Feedback) {
+	if d == nil {
+		return
+	}
+	for _, notifier := range d.Notifiers {
+		d.deliver(notifier, feedback)
+	}
+}
+
+// deliver calls the notifier until it succeeds, fails permanently or the retries are used up
+func (d *Dispatcher) deliver(notifier Notifier, feedback Feedback) {
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), attemptTimeout)
+		err := notifier.Notify(ctx, feedback)
+		cancel()
+		if err == nil {
+			return
+		}
+		var permanent permanentError
+		if errors.As(err, &permanent) || attempt >= d.Retries {
+			l.Error(l.WithFields(l.Err(err), "kind", feedback.Kind, "id", feedback.ID, "attempts", attempt+1))
+			return
+		}
+		time.Sleep(backoff(attempt))
+	}
+}
+
+// backoff returns a random delay between half and the whole of retryBaseDelay doubled attempt times, at most retryMaxDelay
+func backoff(attempt int) time.Duration {
+	delay := retryMaxDelay
+	if attempt < 16 && retryBaseDelay<<attempt < retryMaxDelay {
+		delay = retryBaseDelay << attempt
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
@@ -0,0 +1,68 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	l "telegram-bot-feedback/internal/pkg/logger"
+)
+
+// SignatureHeader carries the HMAC-SHA256 of the body as "sha256=<hex>"
+const SignatureHeader = "X-Feedback-Signature"
+
+// Webhook POSTs Feedback as JSON to the URL
+//
+// If Secret is set the body is signed, receivers compare the SignatureHeader with Sign(secret, body)
+type Webhook struct {
+	URL    string
+	Secret string
+	Client *http.Client
+}
+
+// NewWebhook returns the Webhook with the default HTTP client
+func NewWebhook(url, secret string) *Webhook {
+	return &Webhook{URL: url, Secret: secret, Client: http.DefaultClient}
+}
+
+// Sign returns the signature of the body
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Notify sends the Feedback, 5xx and 429 responses are retried, other 4xx are not
+func (w *Webhook) Notify(ctx context.Context, feedback Feedback) error {
+	body, err := json.Marshal(feedback)
+	if err != nil {
+		return Permanent(l.Err(err))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return Permanent(l.Err(err))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(w.Secret, body))
+	}
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return l.Err(err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+	err = l.NewError("Webhook " + w.URL + " answered " + strconv.Itoa(resp.StatusCode))
+	if resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+		return Permanent(err)
+	}
+	return err
+}
@@ -0,0 +1,152 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// webhookServer answers with the statuses in order, the last one repeats, and records the requests
+type webhookServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	statuses []int
+	bodies   [][]byte
+	headers  []http.Header
+}
+
+func newWebhookServer(t *testing.T, statuses ...int) *webhookServer {
+	s := &webhookServer{statuses: statuses}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		s.mu.Lock()
+		s.bodies = append(s.bodies, body)
+		s.headers = append(s.headers, r.Header.Clone())
+		status := s.statuses[0]
+		if len(s.statuses) > 1 {
+			s.statuses = s.statuses[1:]
+		}
+		s.mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// requests returns the number of received requests
+func (s *webhookServer) requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.bodies)
+}
+
+// fastRetries shortens the retry delays for the test
+func fastRetries(t *testing.T) {
+	base, max := retryBaseDelay, retryMaxDelay
+	retryBaseDelay, retryMaxDelay = time.Millisecond, 5*time.Millisecond
+	t.Cleanup(func() { retryBaseDelay, retryMaxDelay = base, max })
+}
+
+var testFeedback = Feedback{Kind: "question", ID: 7, UserID: 1, User: "@user1", Text: "It crashes", Date: time.Unix(1700000000, 0).UTC()}
+
+func TestWebhookSignature(t *testing.T) {
+	server := newWebhookServer(t, http.StatusOK)
+	webhook := NewWebhook(server.URL, "secret")
+	if err := webhook.Notify(context.Background(), testFeedback); err != nil {
+		t.Fatal(err)
+	}
+	body, header := server.bodies[0], server.headers[0]
+	if got, want := header.Get(SignatureHeader), Sign("secret", body); got != want {
+		t.Fatalf("signature = %q, want %q", got, want)
+	}
+	if got := header.Get("Content-Type"); got != "application/json" {
+		t.Fatalf("content type = %q", got)
+	}
+	var received Feedback
+	if err := json.Unmarshal(body, &received); err != nil {
+		t.Fatal(err)
+	}
+	if received != testFeedback {
+		t.Fatalf("body = %+v, want %+v", received, testFeedback)
+	}
+	if Sign("other", body) == header.Get(SignatureHeader) {
+		t.Fatal("the signature doesn't depend on the secret")
+	}
+}
+
+func TestWebhookWithoutSecretIsNotSigned(t *testing.T) {
+	server := newWebhookServer(t, http.StatusOK)
+	if err := NewWebhook(server.URL, "").Notify(context.Background(), testFeedback); err != nil {
+		t.Fatal(err)
+	}
+	if got := server.headers[0].Get(SignatureHeader); got != "" {
+		t.Fatalf("signature = %q without a secret", got)
+	}
+}
+
+func TestDispatcherRetriesServerErrors(t *testing.T) {
+	fastRetries(t)
+	server := newWebhookServer(t, http.StatusBadGateway, http.StatusTooManyRequests, http.StatusOK)
+	d := &Dispatcher{Notifiers: []Notifier{NewWebhook(server.URL, "secret")}, Retries: 5}
+	d.Deliver(testFeedback)
+	if got := server.requests(); got != 3 {
+		t.Fatalf("requests = %d, want 3: two failures and the success", got)
+	}
+	for i, body := range server.bodies {
+		if server.headers[i].Get(SignatureHeader) != Sign("secret", body) {
+			t.Fatalf("retry %d is not signed", i)
+		}
+	}
+}
+
+func TestDispatcherStopsAfterRetries(t *testing.T) {
+	fastRetries(t)
+	server := newWebhookServer(t, http.StatusInternalServerError)
+	d := &Dispatcher{Notifiers: []Notifier{NewWebhook(server.URL, "")}, Retries: 2}
+	d.Deliver(testFeedback)
+	if got := server.requests(); got != 3 {
+		t.Fatalf("requests = %d, want the attempt and 2 retries", got)
+	}
+}
+
+func TestDispatcherDoesNotRetryClientErrors(t *testing.T) {
+	fastRetries(t)
+	server := newWebhookServer(t, http.StatusBadRequest, http.StatusOK)
+	d := &Dispatcher{Notifiers: []Notifier{NewWebhook(server.URL, "")}, Retries: 5}
+	d.Deliver(testFeedback)
+	if got := server.requests(); got != 1 {
+		t.Fatalf("requests = %d, a 400 is not retried", got)
+	}
+}
+
+func TestDispatcherNotifyDoesNotBlock(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { <-release }))
+	defer server.Close()
+	defer close(release)
+	second := newWebhookServer(t, http.StatusOK)
+	d := &Dispatcher{Notifiers: []Notifier{NewWebhook(server.URL, ""), NewWebhook(second.URL, "")}}
+	done := make(chan struct{})
+	go func() {
+		d.Notify(testFeedback)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Notify waits for a slow notifier")
+	}
+	// The other notifier is not held back by the slow one
+	deadline := time.Now().Add(time.Second)
+	for second.requests() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if second.requests() != 1 {
+		t.Fatal("the second notifier is not called")
+	}
+}
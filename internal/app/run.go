@@ -3,13 +3,23 @@ package run
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
 	"sync"
+	"syscall"
 	tg "telegram-bot-feedback/internal/pkg/bot"
 	"telegram-bot-feedback/internal/pkg/config"
 	"telegram-bot-feedback/internal/pkg/console"
 	"telegram-bot-feedback/internal/pkg/database"
 	l "telegram-bot-feedback/internal/pkg/logger"
+	"telegram-bot-feedback/internal/pkg/metrics"
+	"telegram-bot-feedback/internal/pkg/web"
+	api "telegram-bot-feedback/pkg/telegram-bot-api"
+	"time"
+
+	"gorm.io/gorm"
 )
 
 // Start starts bot
@@ -23,16 +33,39 @@ func Start() error {
 		return l.Err(err)
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
+	level, err := l.ParseLevel(conf.GetString("log_level"))
+	if err != nil {
+		return l.Err(err)
+	}
+	format, err := l.ParseFormat(conf.GetString("log_format"))
+	if err != nil {
+		return l.Err(err)
+	}
+	l.Configure(l.Config{
+		Level:        level,
+		Format:       format,
+		MaxSizeBytes: conf.GetInt64("log_max_size_mb") << 20,
+		MaxBackups:   conf.GetInt("log_max_backups"),
+	})
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
 	var wg sync.WaitGroup
 
-	os.Mkdir("database", 0755)
-	db, err := database.Init("database\\database.db")
+	db, err := openDatabase(conf.GetString("storage_driver"))
 	if err != nil {
 		return l.Err(err)
 	}
 
+	for _, id := range conf.GetIntSlice("admins") {
+		if user := database.GetUserByChatID(id, db); user != nil && user.IsEmployee {
+			continue
+		}
+		if err := database.AddEmployeeByID(db, id); err != nil {
+			return l.Err(err)
+		}
+	}
+
 	if host := conf.GetString("host"); host == "" {
 		fmt.Println("Enter the bot host in the format \"https://api.telegram.org/\" or \"-\" to use the standard:")
 		fmt.Fscan(os.Stdin, &host)
@@ -55,15 +88,51 @@ func Start() error {
 		}
 	}
 
-	client, err := tg.Init(conf.GetString("token"), conf.GetString("host"))
+	client, err := tg.Init(conf.GetString("token"), conf.GetString("host"), conf.GetBool("local_mode"), conf.GetInt("send_rate"))
 	if err != nil {
 		return l.Err(err)
 	}
 
+	client.OnResponse = func(method string, statusCode int, elapsed time.Duration) {
+		metrics.APIRequests.Inc(method, strconv.Itoa(statusCode))
+	}
+	client.OnUnavailable = func(method string, err *api.UnavailableError) {
+		metrics.APIUnavailable.Inc(method)
+		l.Warn(l.WithFields(l.NewError(err.Error()), "method", method))
+	}
+
+	if addr := conf.GetString("metrics_addr"); addr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler())
+		go web.Run(ctx, addr, mux)
+	}
+
+	if addr := conf.GetString("http_addr"); addr != "" {
+		mux := http.NewServeMux()
+		tg.RegisterHandlers(mux, db, conf)
+		go web.Run(ctx, addr, mux)
+	}
+
 	wg.Add(1)
 	go tg.RunFetcher(ctx, &wg, client, db, conf)
 	go console.Run(cancel, db)
-	fmt.Println("Bot started")
+	fmt.Println("Bot @" + client.Self.UserName + " started")
 	wg.Wait()
 	return nil
 }
+
+// openDatabase opens the database of the driver, "sqlite" or "sqlite_memory"
+//
+// "sqlite_memory" keeps the SQLite database in memory, it is not a separate storage engine
+func openDatabase(driver string) (*gorm.DB, error) {
+	switch driver {
+	case "sqlite":
+		os.Mkdir("database", 0755)
+		return database.Init("database\\database.db")
+	case "sqlite_memory":
+		fmt.Println("Warning: the SQLite database is kept in memory, all data is lost on restart")
+		l.Info(l.NewError("The SQLite database is kept in memory, all data is lost on restart"))
+		return database.InitMemory()
+	}
+	return nil, l.NewError("Unknown storage driver \"" + driver + "\", use \"sqlite\" or \"sqlite_memory\"")
+}
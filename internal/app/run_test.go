@@ -0,0 +1,62 @@
+package run
+
+import (
+	"strconv"
+	"sync"
+	"telegram-bot-feedback/internal/pkg/database"
+	"testing"
+)
+
+func TestOpenDatabaseMemoryIsLostOnRestart(t *testing.T) {
+	db, err := openDatabase("sqlite_memory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.AddUser(1, "user1", 0, db); err != nil {
+		t.Fatal(err)
+	}
+	if database.GetUserByChatID(1, db) == nil {
+		t.Fatal("the user is not stored")
+	}
+	restarted, err := openDatabase("sqlite_memory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if database.GetUserByChatID(1, restarted) != nil {
+		t.Fatal("the data of the previous database is kept")
+	}
+}
+
+func TestOpenDatabaseMemoryIsShared(t *testing.T) {
+	db, err := openDatabase("sqlite_memory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every goroutine must see the same database, not a new ":memory:" of another connection
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 1; i <= 20; i++ {
+		wg.Add(1)
+		go func(chatId int) {
+			defer wg.Done()
+			_, err := database.AddUser(chatId, "user"+strconv.Itoa(chatId), 0, db)
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := database.GetCounts(db).Users; got != 20 {
+		t.Fatalf("users = %d, want 20", got)
+	}
+}
+
+func TestOpenDatabaseUnknownDriver(t *testing.T) {
+	if _, err := openDatabase("postgres"); err == nil {
+		t.Fatal("an unknown driver is accepted")
+	}
+}
@@ -0,0 +1,167 @@
+package run
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"telegram-bot-feedback/internal/pkg/config"
+	l "telegram-bot-feedback/internal/pkg/logger"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+	"time"
+)
+
+// smokeStep is one step of the smoke test
+type smokeStep struct {
+	name string
+	run  func() error
+}
+
+// errSmokeSkipped is returned by a step which the chat or the bot doesn't support
+var errSmokeSkipped = errors.New("not supported")
+
+// isReactionUnavailable reports whether err means reactions can't be set in the chat
+func isReactionUnavailable(err error) bool {
+	apiErr, ok := tg.AsError(err)
+	if !ok {
+		return false
+	}
+	description := strings.ToLower(apiErr.Message)
+	return strings.Contains(description, "reaction_invalid") || strings.Contains(description, "reactions are disabled") ||
+		strings.Contains(description, "reactions disabled")
+}
+
+// Smoketest runs a scripted sequence of requests against the live Bot API
+//
+// Usage: smoketest -chat <id> [-token <token>] [-host <host>]
+// The token and host are taken from the configuration file if not set
+func Smoketest(args []string) error {
+	flags := flag.NewFlagSet("smoketest", flag.ContinueOnError)
+	token := flags.String("token", "", "bot token (default from config.json)")
+	host := flags.String("host", "", "Bot API host (default from config.json)")
+	chatID := flags.Int("chat", 0, "ID of the test chat")
+	if err := flags.Parse(args); err != nil {
+		return l.Err(err)
+	}
+	if *chatID == 0 {
+		return l.NewError("smoketest: -chat is required")
+	}
+	if *token == "" || *host == "" {
+		conf, err := config.GetConfig()
+		if err != nil {
+			return l.Err(err)
+		}
+		if *token == "" {
+			*token = conf.GetString("token")
+		}
+		if *host == "" {
+			*host = conf.GetString("host")
+		}
+	}
+	if *host == "" {
+		*host = tg.BaseEndpoint
+	}
+
+	client, err := tg.NewWithHost(*token, *host)
+	if err != nil {
+		return l.Err(fmt.Errorf("smoketest: getMe: %w", err))
+	}
+
+	var created []int
+	defer func() {
+		for _, id := range created {
+			if _, err := client.Request(tg.NewDeleteMessage(*chatID, id)); err != nil && !tg.IsMessageToDeleteNotFound(err) {
+				fmt.Printf("cleanup: delete message %d: %v\n", id, err)
+			}
+		}
+	}()
+
+	stamp := time.Now().Format(time.RFC3339)
+	var message *tg.Message
+	steps := []smokeStep{
+		{"getMe", func() error {
+			me, err := client.GetMe()
+			if err != nil {
+				return err
+			}
+			if me.ID != client.Self.ID || !me.IsBot {
+				return fmt.Errorf("unexpected bot %d", me.ID)
+			}
+			return nil
+		}},
+		{"sendMessage", func() error {
+			sent, err := client.Send(tg.NewMessage(*chatID, "smoketest "+stamp))
+			if err != nil {
+				return err
+			}
+			message = sent
+			created = append(created, sent.MessageID)
+			return nil
+		}},
+		{"editMessageText", func() error {
+			edited, err := client.Send(tg.NewEditMessageText(*chatID, message.MessageID, "smoketest edited "+stamp))
+			if err != nil {
+				return err
+			}
+			if edited.Text != "smoketest edited "+stamp {
+				return fmt.Errorf("unexpected text %q", edited.Text)
+			}
+			return nil
+		}},
+		{"setMessageReaction", func() error {
+			_, err := client.RequestOK(tg.NewSetMessageReaction(*chatID, message.MessageID, "👍"))
+			if isReactionUnavailable(err) {
+				return fmt.Errorf("%w: %v", errSmokeSkipped, err)
+			}
+			return err
+		}},
+		{"sendDocument", func() error {
+			document := tg.NewDocument(*chatID, tg.FileBytes{Name: "smoketest.txt", Bytes: []byte("smoketest " + stamp)})
+			sent, err := client.Send(&document)
+			if err != nil {
+				return err
+			}
+			created = append(created, sent.MessageID)
+			if sent.Document == nil || sent.Document.FileName != "smoketest.txt" {
+				return fmt.Errorf("document was not uploaded")
+			}
+			return nil
+		}},
+		{"deleteMessage", func() error {
+			for len(created) > 0 {
+				_, err := client.Request(tg.NewDeleteMessage(*chatID, created[0]))
+				if err != nil {
+					return err
+				}
+				created = created[1:]
+			}
+			return nil
+		}},
+	}
+
+	failed := 0
+	for _, step := range steps {
+		if failed > 0 {
+			fmt.Printf("%-20s skipped\n", step.name)
+			continue
+		}
+		err := step.run()
+		if errors.Is(err, errSmokeSkipped) {
+			fmt.Printf("%-20s skipped: %v\n", step.name, err)
+			continue
+		}
+		if err != nil {
+			failed++
+			fmt.Printf("%-20s FAIL: %v\n", step.name, err)
+			continue
+		}
+		fmt.Printf("%-20s ok\n", step.name)
+	}
+
+	if failed > 0 {
+		return l.NewError("smoketest failed for chat " + strconv.Itoa(*chatID))
+	}
+	fmt.Println("smoketest passed")
+	return nil
+}
@@ -0,0 +1,113 @@
+package run
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// smokeServer is a Bot API server for the smoke test, failing methods answer with 400
+type smokeServer struct {
+	*httptest.Server
+	mu      sync.Mutex
+	fail    map[string]string
+	methods []string
+	deleted []string
+}
+
+func newSmokeServer(t *testing.T, fail ...string) *smokeServer {
+	s := &smokeServer{fail: map[string]string{}}
+	for _, method := range fail {
+		s.fail[method] = "Bad Request: test failure"
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *smokeServer) serve(w http.ResponseWriter, r *http.Request) {
+	method := path.Base(r.URL.Path)
+	params := map[string]interface{}{}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		json.NewDecoder(r.Body).Decode(&params)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.methods = append(s.methods, method)
+	w.Header().Set("Content-Type", "application/json")
+	if description, ok := s.fail[method]; ok {
+		fmt.Fprintf(w, `{"ok":false,"error_code":400,"description":%q}`, description)
+		return
+	}
+	message := `{"message_id":%d,"date":0,"chat":{"id":5,"type":"private"}%s}`
+	result := "true"
+	switch method {
+	case "getMe":
+		result = `{"id":1,"is_bot":true,"first_name":"Smoke","username":"smoke_bot"}`
+	case "sendMessage":
+		result = fmt.Sprintf(message, 10, "")
+	case "editMessageText":
+		result = fmt.Sprintf(message, 10, `,"text":"`+fmt.Sprint(params["text"])+`"`)
+	case "sendDocument":
+		result = fmt.Sprintf(message, 11, `,"document":{"file_id":"f","file_unique_id":"u","file_name":"smoketest.txt"}`)
+	case "deleteMessage":
+		s.deleted = append(s.deleted, fmt.Sprint(params["message_id"]))
+	}
+	fmt.Fprintf(w, `{"ok":true,"result":%s}`, result)
+}
+
+func TestSmoketestPasses(t *testing.T) {
+	server := newSmokeServer(t)
+	if err := Smoketest([]string{"-chat", "5", "-token", "token", "-host", server.URL + "/"}); err != nil {
+		t.Fatal(err)
+	}
+	want := "getMe getMe sendMessage editMessageText setMessageReaction sendDocument deleteMessage deleteMessage"
+	if got := strings.Join(server.methods, " "); got != want {
+		t.Fatalf("methods = %s, want %s", got, want)
+	}
+	if strings.Join(server.deleted, " ") != "10 11" {
+		t.Fatalf("deleted = %v, want both messages", server.deleted)
+	}
+}
+
+func TestSmoketestStopsAtTheFirstFailure(t *testing.T) {
+	server := newSmokeServer(t, "setMessageReaction")
+	if err := Smoketest([]string{"-chat", "5", "-token", "token", "-host", server.URL + "/"}); err == nil {
+		t.Fatal("the failure is not reported")
+	}
+	for _, method := range server.methods {
+		if method == "sendDocument" {
+			t.Fatal("the steps after the failure are run")
+		}
+	}
+	// The sent message is cleaned up
+	if strings.Join(server.deleted, " ") != "10" {
+		t.Fatalf("deleted = %v", server.deleted)
+	}
+}
+
+func TestSmoketestSkipsUnsupportedReactions(t *testing.T) {
+	server := newSmokeServer(t)
+	server.fail["setMessageReaction"] = "Bad Request: REACTION_INVALID"
+	if err := Smoketest([]string{"-chat", "5", "-token", "token", "-host", server.URL + "/"}); err != nil {
+		t.Fatal(err)
+	}
+	want := "getMe getMe sendMessage editMessageText setMessageReaction sendDocument deleteMessage deleteMessage"
+	if got := strings.Join(server.methods, " "); got != want {
+		t.Fatalf("methods = %s, want %s", got, want)
+	}
+	if strings.Join(server.deleted, " ") != "10 11" {
+		t.Fatalf("deleted = %v, want both messages", server.deleted)
+	}
+}
+
+func TestSmoketestNeedsChat(t *testing.T) {
+	if err := Smoketest([]string{"-token", "token", "-host", "http://localhost/"}); err == nil || !strings.Contains(err.Error(), "-chat") {
+		t.Fatalf("err = %v", err)
+	}
+}
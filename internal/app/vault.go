@@ -0,0 +1,70 @@
+package run
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"telegram-bot-feedback/internal/pkg/config"
+	"telegram-bot-feedback/internal/pkg/database"
+	l "telegram-bot-feedback/internal/pkg/logger"
+	"telegram-bot-feedback/internal/pkg/vault"
+)
+
+// RestoreVault fills a fresh store from the snapshot the bot sent to the vault channel
+//
+// Usage: restore-vault -file <snapshot> [-key <hex key>]
+// The key is taken from the configuration file if not set
+func RestoreVault(args []string) error {
+	flags := flag.NewFlagSet("restore-vault", flag.ContinueOnError)
+	file := flags.String("file", "", "snapshot document downloaded from the vault channel")
+	key := flags.String("key", "", "vault key (default from config.json)")
+	if err := flags.Parse(args); err != nil {
+		return l.Err(err)
+	}
+	if *file == "" {
+		return l.NewError("restore-vault: -file is required")
+	}
+	if *key == "" {
+		conf, err := config.GetConfig()
+		if err != nil {
+			return l.Err(err)
+		}
+		*key = conf.GetString("vault_key")
+	}
+	snapshot, err := readVault(*file, *key)
+	if err != nil {
+		return l.Err(err)
+	}
+	db, err := openDatabase("sqlite")
+	if err != nil {
+		return l.Err(err)
+	}
+	if err := database.RestoreSnapshot(snapshot, db); err != nil {
+		return l.Err(err)
+	}
+	fmt.Printf("Restored the snapshot of %s: %d users, %d open questions, %d settings\n",
+		snapshot.CreatedAt.Format("2006-01-02 15:04"), len(snapshot.Users), len(snapshot.Questions), len(snapshot.Settings))
+	return nil
+}
+
+// readVault decrypts and decodes the snapshot file
+func readVault(file, key string) (*database.Snapshot, error) {
+	decoded, err := vault.ParseKey(key)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := os.ReadFile(file)
+	if err != nil {
+		return nil, l.Err(err)
+	}
+	data, err := vault.Open(sealed, decoded)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &database.Snapshot{}
+	if err := json.Unmarshal(data, snapshot); err != nil {
+		return nil, l.Err(err)
+	}
+	return snapshot, nil
+}
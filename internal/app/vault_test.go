@@ -0,0 +1,84 @@
+package run
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	"telegram-bot-feedback/internal/pkg/vault"
+	"testing"
+)
+
+// vaultKey is the hex vault key of the tests
+const vaultKey = "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+
+// vaultFile writes the sealed snapshot to a file
+func vaultFile(t *testing.T, snapshot *database.Snapshot) string {
+	t.Helper()
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _ := vault.ParseKey(vaultKey)
+	sealed, err := vault.Seal(data, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "vault.bin")
+	if err := os.WriteFile(file, sealed, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestReadVaultRestores(t *testing.T) {
+	file := vaultFile(t, &database.Snapshot{
+		Version:   database.SnapshotVersion,
+		Settings:  []database.SnapshotSetting{{Key: "greeting", Value: "Hi"}},
+		Users:     []database.SnapshotUser{{ChatID: 2, IsEmployee: true}, {ChatID: 5}},
+		Questions: []database.SnapshotQuestion{{ID: 41, UserChatID: 5, AnswererChatID: 2, TicketID: "T-41"}},
+	})
+	snapshot, err := readVault(file, vaultKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := database.InitMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.RestoreSnapshot(snapshot, db); err != nil {
+		t.Fatal(err)
+	}
+	question := database.GetQuestionById(41, db)
+	if question == nil || question.User.ChatID != 5 || question.Answerer.ChatID != 2 || question.TicketID != "T-41" {
+		t.Fatalf("question = %+v", question)
+	}
+	if database.GetSetting("greeting", db) != "Hi" {
+		t.Fatal("the setting is not restored")
+	}
+}
+
+func TestReadVaultRejects(t *testing.T) {
+	file := vaultFile(t, &database.Snapshot{Version: database.SnapshotVersion})
+	plain := filepath.Join(t.TempDir(), "plain.json")
+	if err := os.WriteFile(plain, []byte(`{"version":1}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name, file, key, want string
+	}{
+		{"wrong key", file, strings.Repeat("ff", 32), "Wrong vault key or damaged file"},
+		{"bad key", file, "secret", "The vault key must be 64 hex characters"},
+		{"plain file", plain, vaultKey, "Not a vault file"},
+		{"missing file", filepath.Join(t.TempDir(), "none.bin"), vaultKey, "none.bin"},
+	}
+	for _, tt := range tests {
+		if _, err := readVault(tt.file, tt.key); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+	if err := RestoreVault([]string{"-key", vaultKey}); err == nil || err.Error() != "restore-vault: -file is required" {
+		t.Fatalf("RestoreVault without a file err = %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package bot
+
+import (
+	"regexp"
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	l "telegram-bot-feedback/internal/pkg/logger"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+)
+
+// aliasDepth limits the expansion of aliases pointing to other aliases
+const aliasDepth = 5
+
+// aliasName is the format of alias names, the same as of bot commands
+var aliasName = regexp.MustCompile(`^[a-z0-9_]{1,32}$`)
+
+// expandAlias returns the message with the personal alias of the employee replaced by its command
+//
+// The expanded command is dispatched as the employee's own, so aliases can't grant other commands
+func expandAlias(message *tg.Message, user *database.User, app *App) *tg.Message {
+	if !user.IsEmployee {
+		return message
+	}
+	seen := map[string]bool{}
+	for i := 0; i < aliasDepth; i++ {
+		name := message.Command()
+		if seen[name] || isCommand(name, user, app) {
+			return message
+		}
+		seen[name] = true
+		alias := database.GetAlias(user, name, app.DB)
+		if alias == nil {
+			return message
+		}
+		message = withCommand(message, alias.Command)
+	}
+	return message
+}
+
+// withCommand returns a copy of the message with the command replaced by the text
+func withCommand(message *tg.Message, text string) *tg.Message {
+	expanded := *message
+	command, _, _ := strings.Cut(text, " ")
+	expanded.Text = "/" + text
+	if args := message.CommandArguments(); args != "" {
+		expanded.Text += " " + args
+	}
+	expanded.Entities = []*tg.MessageEntity{{Type: "bot_command", Offset: 0, Length: len(command) + 1}}
+	return &expanded
+}
+
+// isCommand reports whether the name is a built-in or plugin command, aliases can't shadow them
+func isCommand(name string, user *database.User, app *App) bool {
+	if _, ok := employeeCommands[name]; ok {
+		return true
+	}
+	return app.pluginCommand(name, user) != nil
+}
+
+// aliasCommand handles /alias set <alias> <command...>, /alias list and /alias del <alias>
+func aliasCommand(message *tg.Message, user *database.User, app *App) error {
+	args := strings.Fields(message.CommandArguments())
+	if len(args) == 0 {
+		args = []string{"list"}
+	}
+	var text string
+	switch {
+	case args[0] == "list":
+		text = aliasesText(database.GetAliases(user, app.DB))
+	case args[0] == "set" && len(args) >= 3:
+		name := strings.TrimPrefix(args[1], "/")
+		command := strings.TrimPrefix(strings.Join(args[2:], " "), "/")
+		target, _, _ := strings.Cut(command, " ")
+		switch {
+		case !aliasName.MatchString(name):
+			text = "Alias must be 1-32 characters a-z, 0-9 or _"
+		case isCommand(name, user, app):
+			text = "/" + name + " is already a command"
+		case !isCommand(target, user, app) && database.GetAlias(user, target, app.DB) == nil:
+			text = "Unknown command /" + target
+		default:
+			err := database.SetAlias(user, name, command, app.DB)
+			if err != nil {
+				return l.Err(err)
+			}
+			text = "/" + name + " → /" + command
+		}
+	case args[0] == "del" && len(args) == 2:
+		name := strings.TrimPrefix(args[1], "/")
+		if database.GetAlias(user, name, app.DB) == nil {
+			text = "Alias /" + name + " is not found"
+			break
+		}
+		err := database.RemoveAlias(user, name, app.DB)
+		if err != nil {
+			return l.Err(err)
+		}
+		text = "Alias /" + name + " deleted"
+	default:
+		text = "/alias set <alias> <command...>\n/alias list\n/alias del <alias>"
+	}
+	_, err := app.Bot.Send(tg.NewMessage(user.ChatID, text))
+	return l.Err(err)
+}
+
+// aliasesText returns the text with the list of aliases
+func aliasesText(aliases []database.Alias) string {
+	if len(aliases) == 0 {
+		return "No aliases"
+	}
+	var b strings.Builder
+	for _, alias := range aliases {
+		b.WriteString("/" + alias.Name + " → /" + alias.Command + "\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,101 @@
+package bot
+
+import (
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	"testing"
+)
+
+// setAliases stores the aliases of employee 2
+func setAliases(t *testing.T, app *App, aliases map[string]string) *database.User {
+	employee := database.GetUserByChatID(2, app.DB)
+	for name, command := range aliases {
+		if err := database.SetAlias(employee, name, command, app.DB); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return employee
+}
+
+func TestExpandAlias(t *testing.T) {
+	app, _ := newTestApp(t)
+	employee := setAliases(t, app, map[string]string{
+		"f":     "find",
+		"fx":    "find crash",
+		"ff":    "f",
+		"loop":  "loop2",
+		"loop2": "loop",
+		"find":  "export",
+	})
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"/f login", "/find login"},
+		{"/fx on start", "/find crash on start"},
+		{"/ff login", "/find login"},
+		{"/find login", "/find login"},
+		{"/loop", "/loop"},
+		{"/unknown x", "/unknown x"},
+	}
+	for _, tt := range tests {
+		expanded := expandAlias(commandMessage(2, tt.text), employee, app)
+		if expanded.Text != tt.want {
+			t.Errorf("%q expanded to %q, want %q", tt.text, expanded.Text, tt.want)
+		}
+		command, _, _ := strings.Cut(tt.want, " ")
+		if expanded.Command() != strings.TrimPrefix(command, "/") {
+			t.Errorf("%q: command = %q", tt.text, expanded.Command())
+		}
+	}
+	user, err := database.AddUser(1, "user1", SMain, app.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.SetAlias(user, "f", "find", app.DB); err != nil {
+		t.Fatal(err)
+	}
+	if expanded := expandAlias(commandMessage(1, "/f x"), user, app); expanded.Text != "/f x" {
+		t.Fatalf("the alias of a user is expanded to %q", expanded.Text)
+	}
+}
+
+func TestAliasCommand(t *testing.T) {
+	app, api := newTestApp(t)
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"/alias set f /find", "/f → /find"},
+		{"/alias set find export", "/find is already a command"},
+		{"/alias set F find", "Alias must be 1-32 characters a-z, 0-9 or _"},
+		{"/alias set x nothing", "Unknown command /nothing"},
+		{"/alias set ff f", "/ff → /f"},
+		{"/alias list", "/f → /find\n/ff → /f\n"},
+		{"/alias del f", "Alias /f deleted"},
+		{"/alias del f", "Alias /f is not found"},
+		{"/alias set", "/alias set <alias> <command...>\n/alias list\n/alias del <alias>"},
+	}
+	for _, tt := range tests {
+		parseMessage(commandMessage(2, tt.text), app)
+		if got := lastSent(api, 2); got != tt.want {
+			t.Errorf("%q = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestAliasDoesNotGrantPermissions(t *testing.T) {
+	app, api := newTestApp(t)
+	app.Conf.Set("roles.support", []string{PermReview})
+	employee := setAliases(t, app, map[string]string{"x": "export json"})
+	if err := database.ChangeUserRole("support", employee, app.DB); err != nil {
+		t.Fatal(err)
+	}
+	parseMessage(commandMessage(2, "/x"), app)
+	if got := lastSent(api, 2); got != `You need the "export" permission` {
+		t.Fatalf("/x = %q", got)
+	}
+	if len(api.requests("sendDocument")) != 0 {
+		t.Fatal("the alias ran /export")
+	}
+}
@@ -0,0 +1,235 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"telegram-bot-feedback/internal/pkg/config"
+	"telegram-bot-feedback/internal/pkg/database"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+	"testing"
+	"time"
+)
+
+// apiCall is a Bot API request the fake server received
+type apiCall struct {
+	Method string
+	Params map[string]interface{}
+}
+
+// chatID returns the "chat_id" parameter
+func (c apiCall) chatID() int {
+	if id, ok := c.Params["chat_id"].(float64); ok {
+		return int(id)
+	}
+	id := 0
+	fmt.Sscan(fmt.Sprint(c.Params["chat_id"]), &id)
+	return id
+}
+
+// text returns the "text" parameter
+func (c apiCall) text() string {
+	text, _ := c.Params["text"].(string)
+	return text
+}
+
+// testAPI is a fake Bot API server which records requests
+//
+// Send methods return a message with a new ID in the requested chat, failures answer with the error description
+type testAPI struct {
+	*httptest.Server
+	mu       sync.Mutex
+	nextID   int
+	calls    []apiCall
+	failures map[string]string   // error responses by method
+	results  map[string]string   // JSON results by method
+	queued   map[string][]string // responses by method and chat, used once before the others
+	// onRequest is called with every request before it is answered, it is set before the requests start
+	onRequest func(call apiCall)
+}
+
+// newTestApp returns the App with an in-memory store and the fake Bot API server
+//
+// Chat 2 is an admin and an employee
+func newTestApp(t *testing.T) (*App, *testAPI) {
+	api := &testAPI{nextID: 100, failures: map[string]string{}, results: map[string]string{}, queued: map[string][]string{}}
+	api.Server = httptest.NewServer(http.HandlerFunc(api.serve))
+	t.Cleanup(api.Close)
+	client, err := tg.NewWithHost("token", api.URL+"/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.MaxRetries = 0
+	db, err := database.InitMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf, err := config.GetFileConfig(filepath.Join(t.TempDir(), "config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf.Set("admins", []int{2})
+	if err := database.AddEmployeeByID(db, 2); err != nil {
+		t.Fatal(err)
+	}
+	return NewApp(client, db, conf), api
+}
+
+// setClock replaces the clock for the test
+func setClock(t *testing.T, now func() time.Time) {
+	previous := clock
+	clock = now
+	t.Cleanup(func() { clock = previous })
+}
+
+// fail makes the method answer with the error
+func (a *testAPI) fail(method string, code int, description string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.failures[method] = fmt.Sprintf(`{"ok":false,"error_code":%d,"description":%q}`, code, description)
+}
+
+// failChat makes the next requests of the method to the chat fail with the errors in order
+func (a *testAPI) failChat(method string, chatID int, errors ...string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	key := fmt.Sprint(method, chatID)
+	a.queued[key] = append(a.queued[key], errors...)
+}
+
+// apiError returns the error response, retryAfter is set for 429
+func apiError(code int, description string, retryAfter int) string {
+	if code == http.StatusTooManyRequests {
+		return fmt.Sprintf(`{"ok":false,"error_code":%d,"description":%q,"parameters":{"retry_after":%d}}`, code, description, retryAfter)
+	}
+	return fmt.Sprintf(`{"ok":false,"error_code":%d,"description":%q}`, code, description)
+}
+
+// result makes the method answer with the JSON result
+func (a *testAPI) result(method, result string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.results[method] = result
+}
+
+// reset forgets the recorded requests
+func (a *testAPI) reset() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.calls = nil
+}
+
+// requests returns the recorded requests of the methods, all requests without methods
+func (a *testAPI) requests(methods ...string) []apiCall {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var result []apiCall
+	for _, call := range a.calls {
+		if len(methods) == 0 {
+			result = append(result, call)
+			continue
+		}
+		for _, method := range methods {
+			if call.Method == method {
+				result = append(result, call)
+			}
+		}
+	}
+	return result
+}
+
+// sentTo returns the texts sent to the chat with sendMessage
+func (a *testAPI) sentTo(chatID int) []string {
+	var texts []string
+	for _, call := range a.requests("sendMessage") {
+		if call.chatID() == chatID {
+			texts = append(texts, call.text())
+		}
+	}
+	return texts
+}
+
+func (a *testAPI) serve(w http.ResponseWriter, r *http.Request) {
+	method := path.Base(r.URL.Path)
+	params := requestParams(r)
+	w.Header().Set("Content-Type", "application/json")
+	if a.onRequest != nil {
+		a.onRequest(apiCall{Method: method, Params: params})
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if method != "getMe" {
+		a.calls = append(a.calls, apiCall{Method: method, Params: params})
+	}
+	call := apiCall{Method: method, Params: params}
+	if queued := a.queued[fmt.Sprint(method, call.chatID())]; len(queued) > 0 {
+		a.queued[fmt.Sprint(method, call.chatID())] = queued[1:]
+		w.Write([]byte(queued[0]))
+		return
+	}
+	if failure, ok := a.failures[method]; ok {
+		w.Write([]byte(failure))
+		return
+	}
+	result, ok := a.results[method]
+	if !ok {
+		result = a.defaultResult(method, apiCall{Params: params}.chatID())
+	}
+	w.Write([]byte(`{"ok":true,"result":` + result + `}`))
+}
+
+// defaultResult returns the result of the method, true for methods without one
+func (a *testAPI) defaultResult(method string, chatID int) string {
+	switch {
+	case method == "getMe":
+		return `{"id":1,"is_bot":true,"first_name":"Feedback","username":"feedback_bot"}`
+	case method == "getChat":
+		return fmt.Sprintf(`{"id":%d,"type":"private"}`, chatID)
+	case method == "copyMessage":
+		a.nextID++
+		return fmt.Sprintf(`{"message_id":%d}`, a.nextID)
+	case strings.HasPrefix(method, "send") && method != "sendChatAction" || method == "forwardMessage" || strings.HasPrefix(method, "editMessage"):
+		a.nextID++
+		return fmt.Sprintf(`{"message_id":%d,"date":%d,"chat":{"id":%d,"type":"private"}}`, a.nextID, time.Now().Unix(), chatID)
+	}
+	return "true"
+}
+
+// requestParams returns the parameters of the JSON or multipart request
+func requestParams(r *http.Request) map[string]interface{} {
+	params := map[string]interface{}{}
+	mediaType, mediaParams, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		reader := multipart.NewReader(r.Body, mediaParams["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err != nil {
+				break
+			}
+			data, _ := io.ReadAll(part)
+			params[part.FormName()] = string(data)
+		}
+		return params
+	}
+	json.NewDecoder(r.Body).Decode(&params)
+	return params
+}
+
+// privateMessage returns the message of the user in the private chat
+func privateMessage(chatID, messageID int, text string) *tg.Message {
+	return &tg.Message{
+		MessageID: messageID,
+		From:      &tg.User{ID: chatID, FirstName: "User", UserName: fmt.Sprintf("user%d", chatID)},
+		Chat:      &tg.Chat{ID: chatID, Type: "private"},
+		Date:      int(time.Now().Unix()),
+		Text:      text,
+	}
+}
@@ -0,0 +1,112 @@
+package bot
+
+import (
+	"strconv"
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	l "telegram-bot-feedback/internal/pkg/logger"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+)
+
+// banUser adds the user to the blocklist (/ban) or removes it from there (/unban)
+//
+// The user is the author of the replied forwarded message or is given by Telegram ID, the rest is the reason
+func banUser(message *tg.Message, isBanned bool, user *database.User, app *App) error {
+	target, reason := bannedUser(message, app)
+	if target == nil {
+		_, err := app.Bot.Send(tg.NewMessage(user.ChatID, "Reply to a forwarded user message or enter the user ID\n/ban <user_id> [reason]\n/unban <user_id>"))
+		return l.Err(err)
+	}
+	if target.IsEmployee {
+		_, err := app.Bot.Send(tg.NewMessage(user.ChatID, "Employees can't be banned"))
+		return l.Err(err)
+	}
+	err := database.ChangeUserIsBanned(isBanned, reason, target, app.DB)
+	if err != nil {
+		return l.Err(err)
+	}
+	text := "User " + strconv.Itoa(target.ChatID) + " banned"
+	if !isBanned {
+		text = "User " + strconv.Itoa(target.ChatID) + " unbanned"
+	}
+	_, err = app.Bot.Send(tg.NewMessage(user.ChatID, text))
+	return l.Err(err)
+}
+
+// bannedUser returns the User of the /ban command and the reason
+func bannedUser(message *tg.Message, app *App) (*database.User, string) {
+	args := strings.TrimSpace(message.CommandArguments())
+	if target := linkedUser(message, app); target != nil {
+		return target, args
+	}
+	id, reason, _ := strings.Cut(args, " ")
+	chatId, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, ""
+	}
+	return database.GetUserByChatID(chatId, app.DB), strings.TrimSpace(reason)
+}
+
+// linkedUser returns the User whose question the replied message belongs to
+func linkedUser(message *tg.Message, app *App) *database.User {
+	if message.ReplyToMessage == nil {
+		return nil
+	}
+	link := database.GetMessageLink(message.Chat.ID, message.ReplyToMessage.MessageID, app.DB)
+	if link == nil {
+		return nil
+	}
+	return database.GetUserByChatID(link.UserChatID, app.DB)
+}
+
+// isBanned reports whether the update from the user must be dropped
+//
+// The banned user is told about the ban once
+func isBanned(from *tg.User, app *App) bool {
+	user := database.GetUserByChatID(from.ID, app.DB)
+	if user == nil || !user.IsBanned {
+		return false
+	}
+	if !user.BanNotified {
+		_, err := app.Bot.Send(tg.NewMessage(user.ChatID, translate(user.LanguageCode, MsgBanned)))
+		if err != nil {
+			l.Error(l.Err(err))
+		}
+		err = database.ChangeUserBanNotified(true, user, app.DB)
+		if err != nil {
+			l.Error(err)
+		}
+	}
+	return true
+}
+
+// sendBanned sends the list of banned users with reasons and dates
+func sendBanned(user *database.User, app *App) error {
+	users := database.GetBannedUsers(app.DB)
+	if len(users) == 0 {
+		_, err := app.Bot.Send(tg.NewMessage(user.ChatID, "No banned users"))
+		return l.Err(err)
+	}
+	var b strings.Builder
+	for _, banned := range users {
+		b.WriteString(strconv.Itoa(banned.ChatID))
+		refreshProfile(&banned, app)
+		if name := profileName(&banned); name != "" {
+			b.WriteString(" " + name)
+		}
+		if banned.BannedAt != nil {
+			b.WriteString(" " + banned.BannedAt.Format("2006-01-02"))
+		}
+		if banned.BanReason != "" {
+			b.WriteString(" - " + banned.BanReason)
+		}
+		b.WriteString("\n")
+	}
+	for _, chunk := range splitMessage("Banned users", b.String(), nil) {
+		_, err := app.Bot.Send(tg.NewMessage(user.ChatID, chunk.Text))
+		if err != nil {
+			return l.Err(err)
+		}
+	}
+	return nil
+}
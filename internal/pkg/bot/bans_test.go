@@ -0,0 +1,119 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+	"testing"
+	"time"
+)
+
+// relayedTo returns the number of messages copied or forwarded to the chat
+func relayedTo(api *testAPI, chatID int) int {
+	n := 0
+	for _, call := range api.requests("copyMessage", "forwardMessage") {
+		if call.chatID() == chatID {
+			n++
+		}
+	}
+	return n
+}
+
+// replyCommand returns the command of chat 2 replying to the message
+func replyCommand(text string, messageID int) *tg.Message {
+	message := commandMessage(2, text)
+	message.ReplyToMessage = &tg.Message{MessageID: messageID, Chat: message.Chat}
+	return message
+}
+
+func TestBanByReplyStopsForwarding(t *testing.T) {
+	app, api := newTestApp(t)
+	question := askQuestion(t, app, "It crashes")
+	if err := database.ChangeQuestionAnswerer(int(database.GetUserByChatID(2, app.DB).ID), question, app.DB); err != nil {
+		t.Fatal(err)
+	}
+	link := database.GetQuestionMessageLink(2, question, app.DB)
+	if link == nil {
+		t.Fatal("the question message is not linked")
+	}
+
+	parseMessage(replyCommand("/ban spam", link.MessageID), app)
+	if got := lastSent(api, 2); got != "User 1 banned" {
+		t.Fatalf("/ban = %q", got)
+	}
+	if user := database.GetUserByChatID(1, app.DB); !user.IsBanned || user.BanReason != "spam" {
+		t.Fatalf("user = %+v", user)
+	}
+	api.reset()
+	for i := 0; i < 2; i++ {
+		parseUpdate(&tg.Update{Message: privateMessage(1, 10+i, "spam")}, app)
+	}
+	if relayedTo(api, 2) != 0 || len(api.sentTo(2)) != 0 {
+		t.Fatalf("messages of the banned user reached the employee: %+v", api.requests())
+	}
+
+	parseMessage(replyCommand("/unban", link.MessageID), app)
+	if got := lastSent(api, 2); got != "User 1 unbanned" {
+		t.Fatalf("/unban = %q", got)
+	}
+	parseUpdate(&tg.Update{Message: privateMessage(1, 20, "sorry")}, app)
+	if relayedTo(api, 2) != 1 {
+		t.Fatalf("the message after /unban is not relayed: %+v", api.requests())
+	}
+}
+
+func TestBanByIDNotifiesOnce(t *testing.T) {
+	app, api := newTestApp(t)
+	if _, err := database.AddUser(1, "user1", SMain, app.DB); err != nil {
+		t.Fatal(err)
+	}
+	parseMessage(commandMessage(2, "/ban 1 insults the team"), app)
+	if got := lastSent(api, 2); got != "User 1 banned" {
+		t.Fatalf("/ban = %q", got)
+	}
+	for i := 0; i < 3; i++ {
+		parseUpdate(&tg.Update{Message: privateMessage(1, 10+i, "hello")}, app)
+	}
+	if got := api.sentTo(1); len(got) != 1 || got[0] != translate("", MsgBanned) {
+		t.Fatalf("the banned user got %q", got)
+	}
+}
+
+func TestBanRefusesEmployeesAndUnknownUsers(t *testing.T) {
+	app, api := newTestApp(t)
+	parseMessage(commandMessage(2, "/ban 2"), app)
+	if got := lastSent(api, 2); got != "Employees can't be banned" {
+		t.Fatalf("/ban of an employee = %q", got)
+	}
+	parseMessage(commandMessage(2, "/ban 42"), app)
+	if got := lastSent(api, 2); !strings.HasPrefix(got, "Reply to a forwarded user message or enter the user ID") {
+		t.Fatalf("/ban of an unknown user = %q", got)
+	}
+}
+
+func TestBannedList(t *testing.T) {
+	app, api := newTestApp(t)
+	parseMessage(commandMessage(2, "/banned"), app)
+	if got := lastSent(api, 2); got != "No banned users" {
+		t.Fatalf("/banned = %q", got)
+	}
+	for _, id := range []int{1, 3} {
+		if _, err := database.AddUser(id, fmt.Sprint("user", id), SMain, app.DB); err != nil {
+			t.Fatal(err)
+		}
+	}
+	parseMessage(commandMessage(2, "/ban 1 spam"), app)
+	parseMessage(commandMessage(2, "/ban 3"), app)
+	parseMessage(commandMessage(2, "/banned"), app)
+	got := lastSent(api, 2)
+	today := time.Now().Format("2006-01-02")
+	if !strings.Contains(got, "1 ") || !strings.Contains(got, today+" - spam\n") || !strings.Contains(got, "3 ") {
+		t.Fatalf("/banned = %q", got)
+	}
+	parseMessage(commandMessage(2, "/unban 1"), app)
+	parseMessage(commandMessage(2, "/banned"), app)
+	if got := lastSent(api, 2); strings.Contains(got, "spam") {
+		t.Fatalf("/banned after /unban = %q", got)
+	}
+}
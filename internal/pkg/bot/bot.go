@@ -3,8 +3,12 @@ package bot
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"sync"
+	"telegram-bot-feedback/internal/app/notify"
+	"telegram-bot-feedback/internal/pkg/database"
 	l "telegram-bot-feedback/internal/pkg/logger"
+	"telegram-bot-feedback/internal/pkg/metrics"
 	tg "telegram-bot-feedback/pkg/telegram-bot-api"
 	"time"
 
@@ -16,11 +20,33 @@ type App struct {
 	Bot  *tg.Client
 	DB   *gorm.DB
 	Conf *viper.Viper
+	// Transcriber converts voice messages of users to text, NoopTranscriber by default
+	Transcriber Transcriber
+
+	plugins     []Plugin
+	hooks       *Hooks
+	broadcaster broadcaster
+	autoReplies slidingWindow
+	messages    slidingWindow
+	profiles    profileCache
+	status      statusUpdater
+	notifier    *notify.Dispatcher
+	outgoing    chatLocks
+	started     time.Time
 }
 
 // Init initializes Telegram Bot
-func Init(token, host string) (*tg.Client, error) {
-	client, err := tg.NewWithHost(token, host)
+//
+// sendRate is the limit of messages per second to all chats, each chat gets one message per second, 0 disables pacing
+func Init(token, host string, localMode bool, sendRate int) (*tg.Client, error) {
+	var opts []tg.Option
+	if localMode {
+		opts = append(opts, tg.WithLocalMode())
+	}
+	if sendRate > 0 {
+		opts = append(opts, tg.WithRateLimit(sendRate, tg.DefaultChatInterval))
+	}
+	client, err := tg.NewWithHost(token, host, opts...)
 	if err != nil {
 		if err.Error() == "Not Found" {
 			err = fmt.Errorf("incorrect token")
@@ -28,39 +54,93 @@ func Init(token, host string) (*tg.Client, error) {
 		return nil, err
 	}
 
-	commandStart := tg.NewSetMyCommands(tg.BotCommand{Command: "/start", Description: "Starts chatting with the bot"})
-	client.RequestOK(commandStart)
-
 	return client, err
 }
 
+// NewApp returns the App with loaded plugins
+func NewApp(bot *tg.Client, db *gorm.DB, conf *viper.Viper) *App {
+	app := &App{Bot: bot, DB: db, Conf: conf, Transcriber: NoopTranscriber{}, started: clock()}
+	app.notifier = notify.New(conf)
+	app.initPlugins()
+	return app
+}
+
+// HandleUpdate passes the Update through the handlers
+func (app *App) HandleUpdate(update *tg.Update) error {
+	kind := updateType(update)
+	metrics.Updates.Inc(kind)
+	start := time.Now()
+	err := parseUpdate(update, app)
+	metrics.HandlerDuration.Since(start, kind)
+	return err
+}
+
 // RunFetcher handles Updates coming to the bot
 func RunFetcher(ctx context.Context, wg *sync.WaitGroup, bot *tg.Client, db *gorm.DB, conf *viper.Viper) {
 	defer wg.Done()
-	app := App{Bot: bot, DB: db, Conf: conf}
+	app := NewApp(bot, db, conf)
+	startupReport(app)
+	syncGroupAdmins(app)
+	refreshAdminChat(app)
+	registerCommands(app)
+	go runDigest(ctx, app)
+	go runMaintenance(ctx, app)
+	go runOutbox(ctx, app)
+	go runTakeover(ctx, app)
+	go runVault(ctx, app)
+	metrics.RateLimiter.Set(func() float64 { return float64(app.messages.active(time.Minute)) })
+	pool := newWorkerPool(conf.GetInt("workers"), conf.GetInt("update_queue"), app.HandleUpdate, app.saveOffset)
+	metrics.UpdateQueue.Set(func() float64 { return float64(pool.queued()) })
+	offset := app.offset()
 	for {
 		select {
 		case <-ctx.Done():
+			pool.close()
+			shutdownReport(app)
 			return
 		default:
-			updates := updates(bot, conf)
-			for _, update := range updates {
-				err := parseUpdate(&update, &app)
-				if err != nil {
-					l.Error(err)
+			bot.AllowedUpdates = app.allowedUpdates()
+			for _, update := range updates(ctx, bot, offset) {
+				if !pool.submit(ctx, update) {
 					break
 				}
+				offset = update.UpdateID + 1
 			}
 			time.Sleep(1 * time.Second)
 		}
 	}
 }
 
+// offsetSetting is the store key of the offset of the next Update
+const offsetSetting = "offset"
+
+// offset returns the offset of the next Update, "offset" of the configuration before the first save
+func (app *App) offset() int {
+	offset, err := strconv.Atoi(database.GetSetting(offsetSetting, app.DB))
+	if err != nil {
+		return app.Conf.GetInt("offset")
+	}
+	return offset
+}
+
+// saveOffset saves the offset of the next Update, Updates before it are handled
+//
+// Workers call it, so the offset is kept in the store: the configuration is not safe for concurrent writes
+func (app *App) saveOffset(offset int) {
+	err := database.SetSetting(offsetSetting, strconv.Itoa(offset), app.DB)
+	if err != nil {
+		l.Error(err)
+	}
+}
+
 // updates returns the slice of Update from the bot by offset
-func updates(bot *tg.Client, conf *viper.Viper) []tg.Update {
-	req := tg.NewUpdate(conf.GetInt("offset"))
-	updates, err := bot.GetUpdates(req)
+func updates(ctx context.Context, bot *tg.Client, offset int) []tg.Update {
+	req := tg.NewUpdate(offset)
+	updates, err := bot.GetUpdatesWithContext(ctx, req)
 	if err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
 		l.Error(err)
 		return nil
 	}
@@ -0,0 +1,225 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"telegram-bot-feedback/internal/pkg/database"
+	l "telegram-bot-feedback/internal/pkg/logger"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+	"time"
+)
+
+// Broadcast settings
+const (
+	// broadcastInterval is the pause between two copies (Telegram allows about 30 messages per second)
+	broadcastInterval = 40 * time.Millisecond
+	// broadcastProgressInterval is how often the progress message is edited
+	broadcastProgressInterval = 3 * time.Second
+)
+
+// broadcaster holds the in-flight broadcast
+type broadcaster struct {
+	mu         sync.Mutex
+	cancel     context.CancelFunc
+	permission string // needed to start the broadcast, and to cancel it
+}
+
+// broadcastStats counts broadcast results
+type broadcastStats struct {
+	Total       int
+	Sent        int
+	Failed      int
+	Blocked     int
+	Deactivated int
+}
+
+// String returns the progress text
+func (s broadcastStats) String() string {
+	return fmt.Sprintf("Sent: %d/%d\nFailed: %d\nBlocked: %d\nDeactivated: %d", s.Sent, s.Total, s.Failed, s.Blocked, s.Deactivated)
+}
+
+// start reserves the broadcaster for a broadcast which needs the permission, returns false if a broadcast is already running
+func (b *broadcaster) start(cancel context.CancelFunc, permission string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.cancel != nil {
+		return false
+	}
+	b.cancel = cancel
+	b.permission = permission
+	return true
+}
+
+// finish releases the broadcaster
+func (b *broadcaster) finish() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.cancel != nil {
+		b.cancel()
+	}
+	b.cancel = nil
+	b.permission = ""
+}
+
+// stop cancels the in-flight broadcast, returns false if there is none
+func (b *broadcaster) stop() bool {
+	return b.stopIf(func(string) bool { return true }) != ""
+}
+
+// stopIf cancels the in-flight broadcast if allowed accepts the permission it needed
+//
+// Returns the permission of the broadcast, "" if there is none
+func (b *broadcaster) stopIf(allowed func(permission string) bool) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.cancel == nil {
+		return ""
+	}
+	if allowed(b.permission) {
+		b.cancel()
+	}
+	return b.permission
+}
+
+// running reports whether a broadcast is in flight
+func (b *broadcaster) running() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.cancel != nil
+}
+
+// startBroadcast copies the replied message to all users or the segment in the background
+//
+// Format: /broadcast [segment], all users need the broadcast:all permission
+func startBroadcast(message *tg.Message, user *database.User, app *App) error {
+	if message.ReplyToMessage == nil {
+		_, err := app.Bot.Send(tg.NewMessage(user.ChatID, "Reply with /broadcast [segment] to the message you want to send"))
+		return l.Err(err)
+	}
+	segment := strings.TrimSpace(message.CommandArguments())
+	permission := PermBroadcastSegment
+	if segment == "" {
+		permission = PermBroadcastAll
+		if ok, err := authorize(permission, user, app); !ok {
+			return l.Err(err)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	if !app.broadcaster.start(cancel, permission) {
+		cancel()
+		_, err := app.Bot.Send(tg.NewMessage(user.ChatID, "A broadcast is already running, use /broadcast_cancel to stop it"))
+		return l.Err(err)
+	}
+	var recipients []database.User
+	if segment == "" {
+		recipients = database.GetBroadcastUsers(app.DB)
+	} else {
+		recipients = database.GetBroadcastUsersInSegment(segment, app.DB)
+	}
+	stats := broadcastStats{Total: len(recipients)}
+	progress, err := app.Bot.Send(tg.NewMessage(user.ChatID, "Broadcast started\n"+stats.String()))
+	if err != nil {
+		app.broadcaster.finish()
+		return l.Err(err)
+	}
+	go runBroadcast(ctx, message.ReplyToMessage, progress, recipients, stats, app)
+	return nil
+}
+
+// cancelBroadcast stops the in-flight broadcast if the user has the permission it needed
+func cancelBroadcast(user *database.User, app *App) error {
+	allowed := true
+	permission := app.broadcaster.stopIf(func(permission string) bool {
+		allowed = hasPermission(user, permission, app)
+		return allowed
+	})
+	if !allowed {
+		_, err := authorize(permission, user, app)
+		return l.Err(err)
+	}
+	text := "Broadcast is cancelling"
+	if permission == "" {
+		text = "No broadcast is running"
+	}
+	_, err := app.Bot.Send(tg.NewMessage(user.ChatID, text))
+	return l.Err(err)
+}
+
+// runBroadcast copies the source message to recipients and reports progress
+func runBroadcast(ctx context.Context, source, progress *tg.Message, recipients []database.User, stats broadcastStats, app *App) {
+	defer app.broadcaster.finish()
+	ticker := time.NewTicker(broadcastInterval)
+	defer ticker.Stop()
+	lastReport := time.Now()
+	status := "Broadcast finished"
+loop:
+	for i := range recipients {
+		select {
+		case <-ctx.Done():
+			status = "Broadcast cancelled"
+			break loop
+		case <-ticker.C:
+		}
+		// The client waits and retries when Telegram asks to slow down
+		_, err := app.Bot.SendWithContext(ctx, broadcastMessage(recipients[i].ChatID, source, app))
+		switch {
+		case err == nil:
+			stats.Sent++
+		case ctx.Err() != nil:
+			// The copy in flight was interrupted by the cancel, it is neither sent nor failed
+			status = "Broadcast cancelled"
+			break loop
+		case isDeactivatedError(err):
+			stats.Deactivated++
+			if err := database.ChangeUserIsDeactivated(&recipients[i], app.DB); err != nil {
+				l.Error(err)
+			}
+		case isBlockedError(err):
+			stats.Blocked++
+			if err := database.ChangeUserIsBlocked(true, &recipients[i], app.DB); err != nil {
+				l.Error(err)
+			}
+		default:
+			stats.Failed++
+			l.Error(l.Err(err))
+		}
+		if time.Since(lastReport) >= broadcastProgressInterval {
+			lastReport = time.Now()
+			app.Bot.Send(tg.NewEditMessageText(progress.Chat.ID, progress.MessageID, "Broadcast in progress\n"+stats.String()))
+		}
+	}
+	_, err := app.Bot.Send(tg.NewEditMessageText(progress.Chat.ID, progress.MessageID, status+"\n"+stats.String()))
+	if err != nil {
+		l.Error(l.Err(err))
+	}
+}
+
+// broadcastMessage returns the copy of the source message
+//
+// Text with tracked links is sent as a new message
+func broadcastMessage(chatID int, source *tg.Message, app *App) tg.Config {
+	if source.Text != "" {
+		if entities, ok := trackLinks(source.Entities, source.Text, 0, LinkBroadcast, app); ok {
+			message := tg.NewMessage(chatID, source.Text)
+			message.Entities = entities
+			return message
+		}
+	}
+	return tg.NewCopyMessage(chatID, source.Chat.ID, source.MessageID)
+}
+
+// isBlockedError reports whether the user has blocked the bot
+//
+// Other 403 errors, like "bot can't initiate conversation with a user", also mean the user can't be reached
+func isBlockedError(err error) bool {
+	apiErr, ok := tg.AsError(err)
+	return ok && apiErr.Code == http.StatusForbidden && !isDeactivatedError(err)
+}
+
+// isDeactivatedError reports whether the user has deleted the account
+func isDeactivatedError(err error) bool {
+	return tg.IsUserDeactivated(err)
+}
@@ -0,0 +1,198 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+	"testing"
+	"time"
+)
+
+// broadcastUsers adds the users who receive broadcasts
+func broadcastUsers(t *testing.T, app *App, chatIDs ...int) {
+	for _, chatID := range chatIDs {
+		if _, err := database.AddUser(chatID, fmt.Sprint("user", chatID), SMain, app.DB); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// runTestBroadcast starts the broadcast of a message by admin 2 and waits for it, returns the last progress text
+func runTestBroadcast(t *testing.T, app *App, api *testAPI) string {
+	t.Helper()
+	source := privateMessage(2, 40, "News")
+	command := commandMessage(2, "/broadcast")
+	command.ReplyToMessage = source
+	if err := startBroadcast(command, database.GetUserByChatID(2, app.DB), app); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for app.broadcaster.running() {
+		if time.Now().After(deadline) {
+			t.Fatal("the broadcast doesn't finish")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	edits := api.requests("editMessageText")
+	if len(edits) == 0 {
+		t.Fatal("the progress is not reported")
+	}
+	return edits[len(edits)-1].text()
+}
+
+// copiedTo returns the number of copies sent to the chat
+func copiedTo(api *testAPI, chatID int) int {
+	n := 0
+	for _, call := range api.requests("copyMessage") {
+		if call.chatID() == chatID {
+			n++
+		}
+	}
+	return n
+}
+
+func TestBroadcastCountsFailures(t *testing.T) {
+	app, api := newTestApp(t)
+	app.Bot.MaxRetries = 2
+	broadcastUsers(t, app, 10, 11, 12, 13, 14)
+	api.failChat("copyMessage", 11, apiError(http.StatusForbidden, "Forbidden: bot was blocked by the user", 0))
+	api.failChat("copyMessage", 12, apiError(http.StatusTooManyRequests, "Too Many Requests: retry after 0", 0))
+	api.failChat("copyMessage", 13, apiError(http.StatusForbidden, "Forbidden: user is deactivated", 0))
+	api.failChat("copyMessage", 14, apiError(http.StatusBadRequest, "Bad Request: chat not found", 0))
+
+	status := runTestBroadcast(t, app, api)
+	want := "Broadcast finished\n" + broadcastStats{Total: 5, Sent: 2, Failed: 1, Blocked: 1, Deactivated: 1}.String()
+	if status != want {
+		t.Fatalf("status = %q, want %q", status, want)
+	}
+	if copiedTo(api, 12) != 2 {
+		t.Fatalf("copies to 12 = %d, the copy is retried once after 429", copiedTo(api, 12))
+	}
+	if user := database.GetUserByChatID(11, app.DB); !user.IsBlocked || user.IsDeactivated {
+		t.Fatalf("user 11 = %+v, want blocked", user)
+	}
+	if user := database.GetUserByChatID(13, app.DB); !user.IsDeactivated {
+		t.Fatalf("user 13 = %+v, want deactivated", user)
+	}
+
+	// The next broadcast skips users who can't receive it
+	api.reset()
+	status = runTestBroadcast(t, app, api)
+	if copiedTo(api, 11) != 0 || copiedTo(api, 13) != 0 || !strings.Contains(status, "Sent: 3/3") {
+		t.Fatalf("status of the second broadcast = %q", status)
+	}
+}
+
+func TestBroadcastCancel(t *testing.T) {
+	app, api := newTestApp(t)
+	var users []int
+	for i := 0; i < 50; i++ {
+		users = append(users, 100+i)
+	}
+	broadcastUsers(t, app, users...)
+	source := privateMessage(2, 40, "News")
+	command := commandMessage(2, "/broadcast")
+	command.ReplyToMessage = source
+	admin := database.GetUserByChatID(2, app.DB)
+	if err := startBroadcast(command, admin, app); err != nil {
+		t.Fatal(err)
+	}
+	if err := startBroadcast(command, admin, app); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(lastSent(api, 2), "already running") {
+		t.Fatalf("second broadcast: %q", lastSent(api, 2))
+	}
+	if err := cancelBroadcast(admin, app); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for app.broadcaster.running() && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	edits := api.requests("editMessageText")
+	if len(edits) == 0 || !strings.HasPrefix(edits[len(edits)-1].text(), "Broadcast cancelled") {
+		t.Fatalf("edits = %+v", edits)
+	}
+	if n := len(api.requests("copyMessage")); n >= len(users) {
+		t.Fatalf("%d copies sent after the cancel", n)
+	}
+	if err := cancelBroadcast(admin, app); err != nil {
+		t.Fatal(err)
+	}
+	if lastSent(api, 2) != "No broadcast is running" {
+		t.Fatalf("cancel without a broadcast: %q", lastSent(api, 2))
+	}
+}
+
+func TestBroadcastCancelDuringCopy(t *testing.T) {
+	app, api := newTestApp(t)
+	broadcastUsers(t, app, 10, 11, 12)
+	api.onRequest = func(call apiCall) {
+		if call.Method == "copyMessage" && call.chatID() == 11 {
+			app.broadcaster.stop()
+			// Holds the copy until the client gives up
+			time.Sleep(200 * time.Millisecond)
+		}
+	}
+	status := runTestBroadcast(t, app, api)
+	want := "Broadcast cancelled\n" + broadcastStats{Total: 3, Sent: 1}.String()
+	if status != want {
+		t.Fatalf("status = %q, want %q", status, want)
+	}
+	if copiedTo(api, 12) != 0 {
+		t.Fatal("the broadcast goes on after the cancel")
+	}
+}
+
+func TestDeactivatedIsNotBlocked(t *testing.T) {
+	blocked := &tg.Error{Code: http.StatusForbidden, Message: "Forbidden: bot was blocked by the user"}
+	deactivated := &tg.Error{Code: http.StatusForbidden, Message: "Forbidden: user is deactivated"}
+	if !isBlockedError(blocked) || isDeactivatedError(blocked) {
+		t.Fatal("the block is not recognized")
+	}
+	if isBlockedError(deactivated) || !isDeactivatedError(deactivated) {
+		t.Fatal("the deleted account is not recognized")
+	}
+	if isBlockedError(errors.New("Forbidden: user is deactivated")) || isDeactivatedError(&tg.Error{Code: http.StatusBadRequest, Message: "user is deactivated"}) {
+		t.Fatal("other errors are recognized")
+	}
+	if !isBlockedError(fmt.Errorf("copy: %w", blocked)) || !isDeactivatedError(fmt.Errorf("copy: %w", deactivated)) {
+		t.Fatal("wrapped errors are not recognized")
+	}
+	if !isBlockedError(&tg.Error{Code: http.StatusForbidden, Message: "Forbidden: bot can't initiate conversation with a user"}) {
+		t.Fatal("a user who never started the bot is reachable")
+	}
+}
+
+func TestDeactivatedUserStaysUnreachable(t *testing.T) {
+	app, api := newTestApp(t)
+	broadcastUsers(t, app, 10, 11)
+	api.failChat("copyMessage", 10, apiError(http.StatusForbidden, "Forbidden: bot was blocked by the user", 0))
+	api.failChat("copyMessage", 11, apiError(http.StatusForbidden, "Forbidden: user is deactivated", 0))
+	runTestBroadcast(t, app, api)
+	if err := database.ChangeUserState(SMain, database.GetUserByChatID(2, app.DB), app.DB); err != nil {
+		t.Fatal(err)
+	}
+	parseMessage(commandMessage(2, "/stats"), app)
+	if got := lastSent(api, 2); !strings.Contains(got, "\nBlocked the bot: 1\nDeleted accounts: 1\n") {
+		t.Fatalf("/stats = %q", got)
+	}
+
+	// Writing again clears the block, a deleted account is never cleared
+	parseMessage(privateMessage(10, 50, "hello"), app)
+	parseMessage(privateMessage(11, 50, "hello"), app)
+	if user := database.GetUserByChatID(10, app.DB); user.IsBlocked {
+		t.Fatal("the block is kept after the user wrote")
+	}
+	if user := database.GetUserByChatID(11, app.DB); !user.IsDeactivated {
+		t.Fatal("the deleted account is cleared")
+	}
+	parseMessage(commandMessage(2, "/stats"), app)
+	if got := lastSent(api, 2); !strings.Contains(got, "\nBlocked the bot: 0\nDeleted accounts: 1\n") {
+		t.Fatalf("/stats = %q", got)
+	}
+}
@@ -0,0 +1,69 @@
+package bot
+
+import (
+	"reflect"
+	"strconv"
+	"telegram-bot-feedback/internal/pkg/database"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+	"testing"
+)
+
+// takeCallback returns the press of the Take question button by the chat
+func takeCallback(id string, chatID int, question *database.Question) *tg.CallbackQuery {
+	return &tg.CallbackQuery{
+		ID:      id,
+		From:    &tg.User{ID: chatID},
+		Message: &tg.Message{MessageID: 50, Chat: &tg.Chat{ID: chatID, Type: "private"}},
+		Data:    strconv.Itoa(CBQuestion) + "-" + strconv.Itoa(int(question.ID)),
+	}
+}
+
+func TestTakenQuestionButtonAlerts(t *testing.T) {
+	app, api := newTestApp(t)
+	app.Conf.Set("admins", []int{2, 4})
+	if err := database.AddEmployeeByID(app.DB, 4); err != nil {
+		t.Fatal(err)
+	}
+	question := askQuestion(t, app, "It crashes")
+	mainState(t, app)
+	if err := database.ChangeUserState(SMain, database.GetUserByChatID(4, app.DB), app.DB); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := parseCallback(takeCallback("first", 2, question), app); err != nil {
+		t.Fatal(err)
+	}
+	if err := parseCallback(takeCallback("second", 4, question), app); err != nil {
+		t.Fatal(err)
+	}
+	answers := callbackAnswers(api)
+	if !reflect.DeepEqual(answers["first"], []string{""}) || !reflect.DeepEqual(answers["second"], []string{"!Question already taken"}) {
+		t.Fatalf("callback answers = %q", answers)
+	}
+	if user := database.GetUserByChatID(4, app.DB); user.State != SMain {
+		t.Fatalf("state of the second employee = %d, want the main menu", user.State)
+	}
+	if answerer := database.GetQuestionById(int(question.ID), app.DB).Answerer.ChatID; answerer != 2 {
+		t.Fatalf("answerer = %d", answerer)
+	}
+}
+
+func TestUnknownButtonsAreAcknowledged(t *testing.T) {
+	app, api := newTestApp(t)
+	if _, err := database.AddUser(1, "user1", SMain, app.DB); err != nil {
+		t.Fatal(err)
+	}
+	mainState(t, app)
+	for _, callback := range []*tg.CallbackQuery{
+		{ID: "user", From: &tg.User{ID: 1}, Message: &tg.Message{MessageID: 3, Chat: &tg.Chat{ID: 1, Type: "private"}}, Data: "999-1"},
+		{ID: "employee", From: &tg.User{ID: 2}, Message: &tg.Message{MessageID: 3, Chat: &tg.Chat{ID: 2, Type: "private"}}, Data: "999-1"},
+	} {
+		if err := parseCallback(callback, app); err != nil {
+			t.Fatal(err)
+		}
+	}
+	answers := callbackAnswers(api)
+	if !reflect.DeepEqual(answers["user"], []string{""}) || !reflect.DeepEqual(answers["employee"], []string{""}) {
+		t.Fatalf("callback answers = %q, want the spinners stopped silently", answers)
+	}
+}
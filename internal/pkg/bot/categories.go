@@ -0,0 +1,243 @@
+package bot
+
+import (
+	"strconv"
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	l "telegram-bot-feedback/internal/pkg/logger"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+	"unicode/utf8"
+)
+
+// Category menu settings
+const (
+	// otherCategory receives the Questions of removed categories
+	otherCategory = "other"
+	// otherCategoryEmoji is the emoji of otherCategory when it is created on removal
+	otherCategoryEmoji = "📝"
+	// categoriesPerPage is the number of category buttons on a menu page
+	categoriesPerPage = 8
+	// categoriesPerRow is the number of category buttons in a row
+	categoriesPerRow = 2
+	// maxCategoryName is the maximum length of a category name
+	maxCategoryName = 32
+)
+
+// categoryLabel returns the emoji and the name of the Category
+func categoryLabel(category *database.Category) string {
+	return strings.TrimSpace(category.Emoji + " " + category.Name)
+}
+
+// hasCategoryMenu reports whether users choose a category, "other" alone is not a choice
+func hasCategoryMenu(categories []database.Category) bool {
+	for _, category := range categories {
+		if category.Name != otherCategory {
+			return true
+		}
+	}
+	return false
+}
+
+// categoryKeyboard returns the page of the category menu with previous and next buttons
+//
+// The callback data holds the Category ID, so buttons stay valid after a rename
+func categoryKeyboard(categories []database.Category, page int) tg.InlineKeyboardMarkup {
+	pages := (len(categories) + categoriesPerPage - 1) / categoriesPerPage
+	if page >= pages {
+		page = pages - 1
+	}
+	if page < 0 {
+		page = 0
+	}
+	var rows [][]tg.InlineKeyboardButton
+	end := (page + 1) * categoriesPerPage
+	if end > len(categories) {
+		end = len(categories)
+	}
+	for i := page * categoriesPerPage; i < end; i += categoriesPerRow {
+		var row []tg.InlineKeyboardButton
+		for j := i; j < i+categoriesPerRow && j < end; j++ {
+			data := strconv.Itoa(CBCategory) + "-" + strconv.Itoa(int(categories[j].ID))
+			row = append(row, tg.NewInlineKeyboardButtonData(categoryLabel(&categories[j]), data))
+		}
+		rows = append(rows, row)
+	}
+	var navigation []tg.InlineKeyboardButton
+	if page > 0 {
+		navigation = append(navigation, tg.NewInlineKeyboardButtonData("◀️", strconv.Itoa(CBCategoryPage)+"-"+strconv.Itoa(page-1)))
+	}
+	if page < pages-1 {
+		navigation = append(navigation, tg.NewInlineKeyboardButtonData("▶️", strconv.Itoa(CBCategoryPage)+"-"+strconv.Itoa(page+1)))
+	}
+	if len(navigation) > 0 {
+		rows = append(rows, navigation)
+	}
+	return tg.NewInlineKeyboardMarkup(rows...)
+}
+
+// sendCategoryMenu asks the user to choose the category of the next Question
+//
+// Nothing is sent if there are no categories
+func sendCategoryMenu(user *database.User, app *App) error {
+	if user.CategoryID != 0 {
+		err := database.ChangeUserCategory(0, user, app.DB)
+		if err != nil {
+			return l.Err(err)
+		}
+	}
+	categories := database.GetCategories(app.DB)
+	if !hasCategoryMenu(categories) {
+		return nil
+	}
+	message := tg.NewMessage(user.ChatID, "Choose a category")
+	message.ReplyMarkup = categoryKeyboard(categories, 0)
+	_, err := app.Bot.Send(message)
+	return l.Err(err)
+}
+
+// chooseCategory saves the category chosen in the menu for the next Question
+func chooseCategory(data string, user *database.User, callback *tg.CallbackQuery, app *App) error {
+	id, err := strconv.Atoi(data)
+	if err != nil {
+		return l.Err(l.NewError("no id"))
+	}
+	category := database.GetCategoryByID(id, app.DB)
+	if category == nil || user.State != SQuestion {
+		_, err := app.Bot.Request(tg.NewCallback(callback.ID, "The menu is out of date"))
+		return l.Err(err)
+	}
+	err = database.ChangeUserCategory(int(category.ID), user, app.DB)
+	if err != nil {
+		return l.Err(err)
+	}
+	_, err = app.Bot.Request(tg.NewCallback(callback.ID, ""))
+	if err != nil {
+		return l.Err(err)
+	}
+	_, err = app.Bot.Send(tg.NewEditMessageText(callback.Message.Chat.ID, callback.Message.MessageID, "Category: "+categoryLabel(category)))
+	return l.Err(err)
+}
+
+// turnCategoryPage shows another page of the category menu
+func turnCategoryPage(data string, callback *tg.CallbackQuery, app *App) error {
+	page, err := strconv.Atoi(data)
+	if err != nil {
+		return l.Err(l.NewError("no page"))
+	}
+	_, err = app.Bot.Request(tg.NewCallback(callback.ID, ""))
+	if err != nil {
+		return l.Err(err)
+	}
+	keyboard := categoryKeyboard(database.GetCategories(app.DB), page)
+	_, err = app.Bot.Send(tg.NewEditMessageReplyMarkup(callback.Message.Chat.ID, callback.Message.MessageID, keyboard))
+	return l.Err(err)
+}
+
+// questionCategory returns the category name of the Question, empty if it has none
+func questionCategory(question *database.Question, app *App) string {
+	if category := getQuestionCategory(question, app); category != nil {
+		return category.Name
+	}
+	return ""
+}
+
+// getQuestionCategory returns the Category of the Question or nil
+func getQuestionCategory(question *database.Question, app *App) *database.Category {
+	if question.CategoryID == 0 {
+		return nil
+	}
+	return database.GetCategoryByID(question.CategoryID, app.DB)
+}
+
+// addCategory creates a category or changes its emoji
+//
+// Format: /addcategory <emoji> <name>, without arguments lists categories
+func addCategory(message *tg.Message, user *database.User, app *App) error {
+	args := strings.Fields(message.CommandArguments())
+	if len(args) == 0 {
+		return l.Err(sendCategories(user, app))
+	}
+	if len(args) != 2 || utf8.RuneCountInString(args[1]) > maxCategoryName {
+		_, err := app.Bot.Send(tg.NewMessage(user.ChatID, "Format: /addcategory <emoji> <name>, the name is one word up to 32 characters"))
+		return l.Err(err)
+	}
+	category, err := database.SetCategory(args[0], strings.ToLower(args[1]), app.DB)
+	if err != nil {
+		return l.Err(err)
+	}
+	_, err = app.Bot.Send(tg.NewMessage(user.ChatID, "Category "+categoryLabel(category)+" saved"))
+	return l.Err(err)
+}
+
+// renameCategory renames a category, the buttons already sent keep working
+//
+// Format: /renamecategory <name> <new name>
+func renameCategory(message *tg.Message, user *database.User, app *App) error {
+	args := strings.Fields(strings.ToLower(message.CommandArguments()))
+	if len(args) != 2 || utf8.RuneCountInString(args[1]) > maxCategoryName {
+		_, err := app.Bot.Send(tg.NewMessage(user.ChatID, "Format: /renamecategory <name> <new name>"))
+		return l.Err(err)
+	}
+	category := database.GetCategoryByName(args[0], app.DB)
+	text := "Category not found"
+	switch {
+	case category == nil:
+	case args[0] == otherCategory:
+		text = "The \"" + otherCategory + "\" category can't be renamed"
+	case database.GetCategoryByName(args[1], app.DB) != nil:
+		text = "Category " + args[1] + " already exists"
+	default:
+		err := database.ChangeCategoryName(args[1], category, app.DB)
+		if err != nil {
+			return l.Err(err)
+		}
+		text = "Category renamed to " + categoryLabel(category)
+	}
+	_, err := app.Bot.Send(tg.NewMessage(user.ChatID, text))
+	return l.Err(err)
+}
+
+// removeCategory removes a category, its questions are moved to "other"
+//
+// Format: /removecategory <name>
+func removeCategory(message *tg.Message, user *database.User, app *App) error {
+	name := strings.ToLower(strings.TrimSpace(message.CommandArguments()))
+	category := database.GetCategoryByName(name, app.DB)
+	text := "Category not found"
+	switch {
+	case category == nil:
+	case name == otherCategory:
+		text = "The \"" + otherCategory + "\" category can't be removed"
+	default:
+		other := database.GetCategoryByName(otherCategory, app.DB)
+		if other == nil {
+			var err error
+			other, err = database.SetCategory(otherCategoryEmoji, otherCategory, app.DB)
+			if err != nil {
+				return l.Err(err)
+			}
+		}
+		err := database.RemoveCategory(category, other, app.DB)
+		if err != nil {
+			return l.Err(err)
+		}
+		text = "Category " + categoryLabel(category) + " removed, its questions are moved to " + categoryLabel(other)
+	}
+	_, err := app.Bot.Send(tg.NewMessage(user.ChatID, text))
+	return l.Err(err)
+}
+
+// sendCategories sends the list of categories
+func sendCategories(user *database.User, app *App) error {
+	var b strings.Builder
+	for _, category := range database.GetCategories(app.DB) {
+		category := category
+		b.WriteString(categoryLabel(&category) + "\n")
+	}
+	text := b.String()
+	if text == "" {
+		text = "No categories\n/addcategory <emoji> <name>"
+	}
+	_, err := app.Bot.Send(tg.NewMessage(user.ChatID, text))
+	return l.Err(err)
+}
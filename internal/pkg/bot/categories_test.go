@@ -0,0 +1,160 @@
+package bot
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+	"testing"
+)
+
+// addCategories adds the categories by name with the 🔹 emoji
+func addCategories(t *testing.T, app *App, names ...string) []database.Category {
+	t.Helper()
+	for _, name := range names {
+		if _, err := database.SetCategory("🔹", name, app.DB); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return database.GetCategories(app.DB)
+}
+
+// categoryCallback returns the callback of user 1 pressing the category button
+func categoryCallback(key int, data string) *tg.CallbackQuery {
+	return &tg.CallbackQuery{
+		ID:      "category",
+		From:    &tg.User{ID: 1},
+		Message: &tg.Message{MessageID: 30, Chat: &tg.Chat{ID: 1, Type: "private"}},
+		Data:    strconv.Itoa(key) + "-" + data,
+	}
+}
+
+// buttonTexts returns the texts of the keyboard rows
+func buttonTexts(keyboard tg.InlineKeyboardMarkup) [][]string {
+	var rows [][]string
+	for _, row := range keyboard.InlineKeyboard {
+		var texts []string
+		for _, button := range row {
+			texts = append(texts, button.Text)
+		}
+		rows = append(rows, texts)
+	}
+	return rows
+}
+
+func TestCategoryKeyboardPages(t *testing.T) {
+	app, _ := newTestApp(t)
+	var names []string
+	for i := 0; i < 11; i++ {
+		names = append(names, fmt.Sprintf("c%02d", i))
+	}
+	categories := addCategories(t, app, names...)
+
+	first := buttonTexts(categoryKeyboard(categories, 0))
+	if len(first) != 5 || len(first[0]) != 2 || first[0][0] != "🔹 c00" || first[3][1] != "🔹 c07" {
+		t.Fatalf("page 0 = %v, want 4 rows of 2 and the navigation", first)
+	}
+	if nav := first[4]; len(nav) != 1 || nav[0] != "▶️" {
+		t.Fatalf("page 0 navigation = %v", nav)
+	}
+	last := categoryKeyboard(categories, 1)
+	texts := buttonTexts(last)
+	if len(texts) != 3 || len(texts[1]) != 1 || texts[1][0] != "🔹 c10" {
+		t.Fatalf("page 1 = %v, want 3 categories in 2 rows and the navigation", texts)
+	}
+	if nav := last.InlineKeyboard[2]; len(nav) != 1 || nav[0].Text != "◀️" || *nav[0].CallbackData != strconv.Itoa(CBCategoryPage)+"-0" {
+		t.Fatalf("page 1 navigation = %v", texts[2])
+	}
+	if got := buttonTexts(categoryKeyboard(categories, 9)); len(got) != len(texts) || got[1][0] != texts[1][0] {
+		t.Fatalf("a page past the end = %v, want the last page", got)
+	}
+	if got := buttonTexts(categoryKeyboard(categories[:8], 0)); len(got) != 4 {
+		t.Fatalf("8 categories = %v, want one page without navigation", got)
+	}
+}
+
+func TestCategoryPageCallbackEditsMenu(t *testing.T) {
+	app, api := newTestApp(t)
+	addCategories(t, app, "a", "b", "c", "d", "e", "f", "g", "h", "i")
+	if _, err := database.AddUser(1, "user1", SQuestion, app.DB); err != nil {
+		t.Fatal(err)
+	}
+	if err := parseCallback(categoryCallback(CBCategoryPage, "1"), app); err != nil {
+		t.Fatal(err)
+	}
+	edits := api.requests("editMessageReplyMarkup")
+	if len(edits) != 1 || !strings.Contains(fmt.Sprint(edits[0].Params["reply_markup"]), "🔹 i") {
+		t.Fatalf("edits = %+v, want the second page", edits)
+	}
+}
+
+func TestCategoryButtonSurvivesRename(t *testing.T) {
+	app, api := newTestApp(t)
+	bug := addCategories(t, app, "bug", "idea")[0]
+	parseMessage(commandMessage(2, "/renamecategory bug defect"), app)
+	if got := lastSent(api, 2); got != "Category renamed to 🔹 defect" {
+		t.Fatalf("/renamecategory = %q", got)
+	}
+	parseMessage(commandMessage(2, "/renamecategory defect idea"), app)
+	if got := lastSent(api, 2); got != "Category idea already exists" {
+		t.Fatalf("rename to a taken name = %q", got)
+	}
+
+	user, err := database.AddUser(1, "user1", SQuestion, app.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := parseCallback(categoryCallback(CBCategory, strconv.Itoa(int(bug.ID))), app); err != nil {
+		t.Fatal(err)
+	}
+	if user = database.GetUserByChatID(1, app.DB); user.CategoryID != int(bug.ID) {
+		t.Fatalf("category = %d, want %d", user.CategoryID, bug.ID)
+	}
+	parseMessage(privateMessage(1, 5, "It crashes"), app)
+	question := database.GetOpenQuestionByUser(user, app.DB)
+	if question == nil || question.CategoryID != int(bug.ID) {
+		t.Fatalf("question = %+v, want the renamed category", question)
+	}
+	if got := api.sentTo(2); len(got) == 0 || !strings.HasPrefix(got[len(got)-1], fmt.Sprintf("Question #%d · 🔹 defect\n", question.ID)) {
+		t.Fatalf("admin got %q, want the category in the header", got)
+	}
+}
+
+func TestRemovedCategoryMovesQuestionsToOther(t *testing.T) {
+	app, api := newTestApp(t)
+	bug := addCategories(t, app, "bug")[0]
+	user, err := database.AddUser(1, "user1", SQuestion, app.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.ChangeUserCategory(int(bug.ID), user, app.DB); err != nil {
+		t.Fatal(err)
+	}
+	parseMessage(privateMessage(1, 5, "It crashes"), app)
+	question := database.GetOpenQuestionByUser(user, app.DB)
+
+	parseMessage(commandMessage(2, "/removecategory bug"), app)
+	if got := lastSent(api, 2); got != "Category 🔹 bug removed, its questions are moved to 📝 other" {
+		t.Fatalf("/removecategory = %q", got)
+	}
+	other := database.GetCategoryByName(otherCategory, app.DB)
+	if other == nil || database.GetQuestionById(int(question.ID), app.DB).CategoryID != int(other.ID) {
+		t.Fatalf("question category after removal, other = %+v", other)
+	}
+	parseMessage(commandMessage(2, "/removecategory other"), app)
+	if got := lastSent(api, 2); got != `The "other" category can't be removed` {
+		t.Fatalf("/removecategory other = %q", got)
+	}
+
+	if err := parseCallback(categoryCallback(CBCategory, strconv.Itoa(int(bug.ID))), app); err != nil {
+		t.Fatal(err)
+	}
+	answers := api.requests("answerCallbackQuery")
+	if len(answers) == 0 || answers[len(answers)-1].Params["text"] != "The menu is out of date" {
+		t.Fatalf("button of a removed category = %+v", answers)
+	}
+	if hasCategoryMenu(database.GetCategories(app.DB)) {
+		t.Fatal("the menu is shown with only the other category")
+	}
+}
@@ -0,0 +1,178 @@
+package bot
+
+import (
+	"strconv"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+	"unicode/utf16"
+)
+
+// chunk is a part of a long message
+type chunk struct {
+	Text     string
+	Entities []tg.MessageEntity
+}
+
+// maxTitleLength is the longest title of a chunk in UTF-16 code units, a longer title is cut to leave room for the body
+const maxTitleLength = tg.MaxMessageLength / 4
+
+// partReserve is reserved in every chunk for the " (part i/n)" suffix of the title
+const partReserve = " (part 999/999)"
+
+// splitMessage splits the title and the body into messages no longer than tg.MaxMessageLength
+//
+// The body is split at line or word boundaries, every chunk starts with the title and "part i/n".
+// Entity offsets are relative to the body, if an entity would be split all chunks are sent as plain text
+func splitMessage(title, body string, entities []*tg.MessageEntity) []chunk {
+	entities = sendableEntities(entities, tg.UTF16Len(body))
+	if tg.UTF16Len(title) > maxTitleLength {
+		title = cutUTF16(title, maxTitleLength-1) + "…"
+	}
+	if tg.UTF16Len(title)+1+tg.UTF16Len(body) <= tg.MaxMessageLength {
+		return []chunk{{Text: title + "\n" + body, Entities: shiftEntities(entities, tg.UTF16Len(title)+1)}}
+	}
+	runes := []rune(body)
+	// offsets[i] is the UTF-16 offset of runes[i]
+	offsets := make([]int, len(runes)+1)
+	for i, r := range runes {
+		offsets[i+1] = offsets[i] + len(utf16.Encode([]rune{r}))
+	}
+	budget := tg.MaxMessageLength - tg.UTF16Len(title+partReserve) - 1
+	type part struct{ start, end int }
+	parts := []part{}
+	for start := 0; start < len(runes); {
+		end := start
+		for end < len(runes) && offsets[end+1]-offsets[start] <= budget {
+			end++
+		}
+		next := end
+		if end < len(runes) {
+			if cut := lastBreak(runes[start:end]); cut > 0 {
+				end = start + cut
+				next = end + 1
+			}
+		}
+		parts = append(parts, part{start, end})
+		start = next
+	}
+	chunks := make([]chunk, len(parts))
+	plain := false
+	for i, p := range parts {
+		prefix := title + " (part " + strconv.Itoa(i+1) + "/" + strconv.Itoa(len(parts)) + ")\n"
+		chunks[i].Text = prefix + string(runes[p.start:p.end])
+		for _, entity := range entities {
+			from, to := offsets[p.start], offsets[p.end]
+			if entity.Offset >= to || entity.Offset+entity.Length <= from {
+				continue
+			}
+			if entity.Offset < from || entity.Offset+entity.Length > to {
+				plain = true
+				continue
+			}
+			shifted := *entity
+			shifted.Offset += tg.UTF16Len(prefix) - from
+			chunks[i].Entities = append(chunks[i].Entities, shifted)
+		}
+	}
+	if plain {
+		for i := range chunks {
+			chunks[i].Entities = nil
+		}
+	}
+	return chunks
+}
+
+// cutUTF16 returns the longest prefix of the text with at most n UTF-16 code units
+func cutUTF16(text string, n int) string {
+	size := 0
+	for i, r := range text {
+		size += utf16.RuneLen(r)
+		if size > n {
+			return text[:i]
+		}
+	}
+	return text
+}
+
+// splitText splits the text into messages no longer than tg.MaxMessageLength at line or word boundaries
+func splitText(text string) []string {
+	var parts []string
+	runes := []rune(text)
+	for len(runes) > 0 {
+		end, size := 0, 0
+		for end < len(runes) {
+			size += len(utf16.Encode(runes[end : end+1]))
+			if size > tg.MaxMessageLength {
+				break
+			}
+			end++
+		}
+		next := end
+		if end < len(runes) {
+			if cut := lastBreak(runes[:end]); cut > 0 {
+				end, next = cut, cut+1
+			}
+		}
+		parts = append(parts, string(runes[:end]))
+		runes = runes[next:]
+	}
+	return parts
+}
+
+// lastBreak returns the index of the last line break, or the last space if there is no line break
+func lastBreak(runes []rune) int {
+	space := -1
+	for i := len(runes) - 1; i > 0; i-- {
+		if runes[i] == '\n' {
+			return i
+		}
+		if space < 0 && (runes[i] == ' ' || runes[i] == '\t') {
+			space = i
+		}
+	}
+	return space
+}
+
+// sendableEntities returns the entities the bot can send with the text of the length
+//
+// Custom emoji need a Fragment username of the bot and are dropped, the emoji stays in the text.
+// Text mentions without the User and entities outside the text are dropped too
+func sendableEntities(entities []*tg.MessageEntity, length int) []*tg.MessageEntity {
+	var sendable []*tg.MessageEntity
+	for _, entity := range entities {
+		switch {
+		case entity.Type == "custom_emoji":
+		case entity.Type == "text_mention" && entity.User == nil:
+		case entity.Offset < 0 || entity.Length <= 0 || entity.Offset+entity.Length > length:
+		default:
+			sendable = append(sendable, entity)
+		}
+	}
+	return sendable
+}
+
+// quoteEntities returns the entities of the quoted text moved by the prefix length
+//
+// Entities are measured in UTF-16 code units, so emoji in the prefix count twice
+func quoteEntities(prefix string, entities []*tg.MessageEntity) []*tg.MessageEntity {
+	offset := tg.UTF16Len(prefix)
+	quoted := make([]*tg.MessageEntity, len(entities))
+	for i, entity := range entities {
+		shifted := *entity
+		shifted.Offset += offset
+		quoted[i] = &shifted
+	}
+	return quoted
+}
+
+// shiftEntities returns copies of the entities moved by offset
+func shiftEntities(entities []*tg.MessageEntity, offset int) []tg.MessageEntity {
+	if len(entities) == 0 {
+		return nil
+	}
+	shifted := make([]tg.MessageEntity, len(entities))
+	for i, entity := range entities {
+		shifted[i] = *entity
+		shifted[i].Offset += offset
+	}
+	return shifted
+}
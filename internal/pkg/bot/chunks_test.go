@@ -0,0 +1,243 @@
+package bot
+
+import (
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// chunkBodies returns the chunk texts without the title lines
+func chunkBodies(t *testing.T, chunks []chunk) []string {
+	var bodies []string
+	for i, c := range chunks {
+		if n := tg.UTF16Len(c.Text); n > tg.MaxMessageLength {
+			t.Fatalf("chunk %d has %d UTF-16 units", i, n)
+		}
+		if !utf8.ValidString(c.Text) {
+			t.Fatalf("chunk %d splits a character", i)
+		}
+		_, body, _ := strings.Cut(c.Text, "\n")
+		bodies = append(bodies, body)
+	}
+	return bodies
+}
+
+func TestSplitMessageBoundary(t *testing.T) {
+	body := strings.Repeat("a", tg.MaxMessageLength-2)
+	chunks := splitMessage("Q", body, nil)
+	if len(chunks) != 1 || tg.UTF16Len(chunks[0].Text) != tg.MaxMessageLength {
+		t.Fatalf("%d chunks for a message of exactly the limit", len(chunks))
+	}
+	chunks = splitMessage("Q", body+"a", nil)
+	if len(chunks) != 2 || !strings.HasPrefix(chunks[0].Text, "Q (part 1/2)\n") || !strings.HasPrefix(chunks[1].Text, "Q (part 2/2)\n") {
+		t.Fatalf("%d chunks for a message over the limit", len(chunks))
+	}
+	if got := strings.Join(chunkBodies(t, chunks), ""); got != body+"a" {
+		t.Fatal("the text is changed")
+	}
+}
+
+func TestSplitMessageAtBreaks(t *testing.T) {
+	line := strings.Repeat("word ", 199) + "word\n"
+	body := strings.Repeat(line, 5)
+	bodies := chunkBodies(t, splitMessage("Question #1", body, nil))
+	if len(bodies) != 2 {
+		t.Fatalf("%d chunks", len(bodies))
+	}
+	if bodies[0] != strings.Repeat(line, 4)[:4*len(line)-1] {
+		t.Fatal("the first chunk doesn't end at a line break")
+	}
+	words := strings.Repeat("word ", 1000)
+	for i, b := range chunkBodies(t, splitMessage("Question #1", words, nil)) {
+		if strings.HasPrefix(b, " ") || strings.HasSuffix(b, "wor") || strings.HasPrefix(b, "d") {
+			t.Fatalf("chunk %d splits a word: %q...%q", i, b[:10], b[len(b)-10:])
+		}
+	}
+}
+
+func TestSplitMessageLongTitle(t *testing.T) {
+	title := strings.Repeat("😀", tg.MaxMessageLength)
+	body := strings.Repeat("word ", 1000)
+	done := make(chan []chunk)
+	go func() { done <- splitMessage(title, body, nil) }()
+	select {
+	case chunks := <-done:
+		if len(chunks) != 2 {
+			t.Fatalf("%d chunks", len(chunks))
+		}
+		if got := strings.Join(chunkBodies(t, chunks), " "); got != body {
+			t.Fatal("the text is changed")
+		}
+		if !strings.HasPrefix(chunks[0].Text, strings.Repeat("😀", maxTitleLength/2-1)+"…") {
+			t.Fatalf("the title is not cut: %q", chunks[0].Text[:20])
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("splitMessage doesn't return")
+	}
+}
+
+func TestSplitMessageCountsUTF16(t *testing.T) {
+	// Every emoji is 2 UTF-16 units and 4 bytes
+	body := strings.Repeat("😀", 3000)
+	chunks := splitMessage("Q", body, nil)
+	bodies := chunkBodies(t, chunks)
+	if len(bodies) != 2 || strings.Join(bodies, "") != body {
+		t.Fatalf("%d chunks", len(bodies))
+	}
+	if n := tg.UTF16Len(chunks[0].Text); n < tg.MaxMessageLength-tg.UTF16Len(partReserve)-2 {
+		t.Fatalf("the first chunk has only %d UTF-16 units", n)
+	}
+}
+
+func TestSplitMessageEntities(t *testing.T) {
+	// The bold word is after the emoji, its offset is in UTF-16 units
+	body := "😀 " + strings.Repeat("x", 3000) + " bold " + strings.Repeat("y", 3000)
+	boldOffset := tg.UTF16Len("😀 " + strings.Repeat("x", 3000) + " ")
+	entities := []*tg.MessageEntity{{Type: "bold", Offset: boldOffset, Length: 4}, {Type: "italic", Offset: 0, Length: 2}}
+	chunks := splitMessage("Question #1", body, entities)
+	if len(chunks) != 2 {
+		t.Fatalf("%d chunks", len(chunks))
+	}
+	for i, c := range chunks {
+		for _, e := range c.Entities {
+			want := map[string]string{"bold": "bold", "italic": "😀"}[e.Type]
+			if got := entitySubstring(c.Text, e.Offset, e.Length); got != want {
+				t.Fatalf("chunk %d: %s entity covers %q", i, e.Type, got)
+			}
+		}
+	}
+	if len(chunks[0].Entities)+len(chunks[1].Entities) != 2 {
+		t.Fatalf("entities = %v, %v", chunks[0].Entities, chunks[1].Entities)
+	}
+
+	// An entity over the split point makes every chunk plain
+	entities = []*tg.MessageEntity{{Type: "italic", Offset: 0, Length: 2}, {Type: "code", Offset: 2, Length: tg.UTF16Len(body) - 2}}
+	for i, c := range splitMessage("Question #1", body, entities) {
+		if len(c.Entities) != 0 {
+			t.Fatalf("chunk %d has entities %v", i, c.Entities)
+		}
+	}
+}
+
+func TestSplitMessageShortKeepsEntities(t *testing.T) {
+	chunks := splitMessage("Question #1", "😀 hello", []*tg.MessageEntity{
+		{Type: "bold", Offset: 3, Length: 5},
+		{Type: "custom_emoji", Offset: 0, Length: 2},
+		{Type: "italic", Offset: 6, Length: 10},
+	})
+	if len(chunks) != 1 || chunks[0].Text != "Question #1\n😀 hello" || len(chunks[0].Entities) != 1 {
+		t.Fatalf("chunks = %+v", chunks)
+	}
+	if e := chunks[0].Entities[0]; entitySubstring(chunks[0].Text, e.Offset, e.Length) != "hello" {
+		t.Fatalf("bold entity = %+v", e)
+	}
+}
+
+func TestSplitText(t *testing.T) {
+	if parts := splitText(strings.Repeat("a", tg.MaxMessageLength)); len(parts) != 1 {
+		t.Fatalf("%d parts for the limit", len(parts))
+	}
+	text := strings.Repeat("a", tg.MaxMessageLength-1) + "\nb"
+	if parts := splitText(text); len(parts) != 2 || parts[1] != "b" || len(parts[0]) != tg.MaxMessageLength-1 {
+		t.Fatalf("parts = %d", len(parts))
+	}
+	long := strings.Repeat("я😀", tg.MaxMessageLength)
+	parts := splitText(long)
+	for i, p := range parts {
+		if tg.UTF16Len(p) > tg.MaxMessageLength || !utf8.ValidString(p) {
+			t.Fatalf("part %d is %d UTF-16 units", i, tg.UTF16Len(p))
+		}
+	}
+	if strings.Join(parts, "") != long {
+		t.Fatal("the text is changed")
+	}
+}
+
+func TestLongQuestionReachesEmployeeInParts(t *testing.T) {
+	app, api := newTestApp(t)
+	askQuestion(t, app, strings.Repeat("crash ", 1000))
+	sent := api.sentTo(2)
+	if len(sent) != 2 || !strings.Contains(sent[0], "(part 1/2)") || !strings.Contains(sent[1], "(part 2/2)") {
+		t.Fatalf("the employee got %d messages", len(sent))
+	}
+}
+
+func TestQuoteEntitiesCountsEmojiInPrefix(t *testing.T) {
+	// "🔥 [photo] " is 2 + 9 UTF-16 units
+	prefix := "🔥 [photo] "
+	text := "𝐁old text"
+	entities := []*tg.MessageEntity{{Type: "bold", Offset: 0, Length: 5}, {Type: "italic", Offset: 6, Length: 4}}
+	quoted := quoteEntities(prefix, entities)
+	if len(quoted) != 2 || quoted[0].Offset != 11 || quoted[1].Offset != 17 {
+		t.Fatalf("quoted = %+v, %+v", quoted[0], quoted[1])
+	}
+	if got := entitySubstring(prefix+text, quoted[0].Offset, quoted[0].Length); got != "𝐁old" {
+		t.Fatalf("bold covers %q", got)
+	}
+	if got := entitySubstring(prefix+text, quoted[1].Offset, quoted[1].Length); got != "text" {
+		t.Fatalf("italic covers %q", got)
+	}
+	if entities[0].Offset != 0 || entities[1].Offset != 6 {
+		t.Fatal("the original entities are changed")
+	}
+	shifted := shiftEntities(entities, tg.UTF16Len("🔥\n"))
+	if len(shifted) != 2 || shifted[0].Offset != 3 || shifted[1].Offset != 9 || entities[0].Offset != 0 {
+		t.Fatalf("shifted = %+v", shifted)
+	}
+}
+
+func TestSendableEntities(t *testing.T) {
+	user := &tg.User{ID: 5, FirstName: "Ann"}
+	entities := []*tg.MessageEntity{
+		{Type: "bold", Offset: 0, Length: 3},
+		{Type: "custom_emoji", Offset: 4, Length: 2, CustomEmojiID: "1"},
+		{Type: "text_mention", Offset: 7, Length: 3, User: user},
+		{Type: "text_mention", Offset: 7, Length: 3},
+		{Type: "italic", Offset: 8, Length: 5},
+		{Type: "code", Offset: 0, Length: 0},
+	}
+	sendable := sendableEntities(entities, 10)
+	if len(sendable) != 2 || sendable[0].Type != "bold" || sendable[1].Type != "text_mention" || sendable[1].User != user {
+		t.Fatalf("sendable = %+v", sendable)
+	}
+}
+
+func TestQuestionKeepsUserFormatting(t *testing.T) {
+	app, api := newTestApp(t)
+	if _, err := database.AddUser(1, "user1", SQuestion, app.DB); err != nil {
+		t.Fatal(err)
+	}
+	message := privateMessage(1, 5, "😀 bold link Ann")
+	message.Entities = []*tg.MessageEntity{
+		{Type: "bold", Offset: 3, Length: 4},
+		{Type: "text_link", Offset: 8, Length: 4, URL: "https://example.com"},
+		{Type: "text_mention", Offset: 13, Length: 3, User: &tg.User{ID: 7, FirstName: "Ann"}},
+		{Type: "custom_emoji", Offset: 0, Length: 2, CustomEmojiID: "1"},
+	}
+	parseMessage(message, app)
+	sent := api.requests("sendMessage")
+	if len(sent) == 0 {
+		t.Fatal("the question is not sent")
+	}
+	text := sent[0].text()
+	raw, _ := sent[0].Params["entities"].([]interface{})
+	want := map[string]string{"bold": "bold", "text_link": "link", "text_mention": "Ann"}
+	if len(raw) != len(want) {
+		t.Fatalf("entities = %v in %q", raw, text)
+	}
+	for _, r := range raw {
+		entity, _ := r.(map[string]interface{})
+		kind, _ := entity["type"].(string)
+		offset, _ := entity["offset"].(float64)
+		length, _ := entity["length"].(float64)
+		if got := entitySubstring(text, int(offset), int(length)); got != want[kind] {
+			t.Fatalf("%s covers %q in %q", kind, got, text)
+		}
+	}
+	if sent[0].Params["parse_mode"] != nil {
+		t.Fatalf("parse_mode = %v", sent[0].Params["parse_mode"])
+	}
+}
@@ -0,0 +1,151 @@
+package bot
+
+import (
+	"telegram-bot-feedback/internal/pkg/database"
+	l "telegram-bot-feedback/internal/pkg/logger"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+)
+
+// Command audiences
+const (
+	AudienceUser     = 1 << iota // users
+	AudienceEmployee             // employees
+	AudienceAll      = AudienceUser | AudienceEmployee
+)
+
+// Command groups in the order of /help
+const (
+	GroupGeneral    = "general"
+	GroupQuestions  = "questions"
+	GroupBroadcasts = "broadcasts"
+	GroupModeration = "moderation"
+	GroupReports    = "reports"
+	GroupPlugins    = "plugins"
+)
+
+// commandGroups is the order of groups in /help
+var commandGroups = []string{GroupGeneral, GroupQuestions, GroupBroadcasts, GroupModeration, GroupReports, GroupPlugins}
+
+// commandSpec describes a command for the router, /help and the command menu
+//
+// The description is the catalog key "cmd_<name>", plugin commands bring their own Description
+type commandSpec struct {
+	Name        string
+	Args        string // arguments shown in /help
+	Group       string
+	Audience    int
+	Permission  string // permission the employee needs, "" for none
+	Description string // untranslated description of plugin commands
+}
+
+// builtinCommands are the commands of the bot
+var builtinCommands = []commandSpec{
+	{Name: "start", Group: GroupGeneral, Audience: AudienceAll},
+	{Name: "help", Group: GroupGeneral, Audience: AudienceAll},
+	{Name: "settings", Args: "[receipts|quiet|timezone <value>]", Group: GroupGeneral, Audience: AudienceUser},
+	{Name: "mytickets", Group: GroupGeneral, Audience: AudienceUser},
+	{Name: "ticket", Args: "<F-1024>", Group: GroupGeneral, Audience: AudienceUser},
+	{Name: "resolve", Group: GroupQuestions, Audience: AudienceEmployee},
+	{Name: "set", Args: "<field> <value>", Group: GroupQuestions, Audience: AudienceEmployee},
+	{Name: "history", Args: "<user_id|reply> [limit] [from] [to]", Group: GroupQuestions, Audience: AudienceEmployee},
+	{Name: "alias", Args: "set|list|del", Group: GroupQuestions, Audience: AudienceEmployee},
+	{Name: "addcategory", Args: "<emoji> <name>", Group: GroupQuestions, Audience: AudienceEmployee},
+	{Name: "renamecategory", Args: "<name> <new name>", Group: GroupQuestions, Audience: AudienceEmployee},
+	{Name: "removecategory", Args: "<name>", Group: GroupQuestions, Audience: AudienceEmployee},
+	{Name: "tag", Args: "<tags...> (reply)", Group: GroupQuestions, Audience: AudienceEmployee},
+	{Name: "untag", Args: "[tags...] (reply)", Group: GroupQuestions, Audience: AudienceEmployee},
+	{Name: "find", Args: "<query>", Group: GroupQuestions, Audience: AudienceEmployee},
+	{Name: "t", Args: "<name> (reply)", Group: GroupQuestions, Audience: AudienceEmployee},
+	{Name: "templates", Group: GroupQuestions, Audience: AudienceEmployee},
+	{Name: "later", Args: "<text> (reply)", Group: GroupQuestions, Audience: AudienceEmployee},
+	{Name: "template_add", Args: "<name> <text>", Group: GroupQuestions, Audience: AudienceEmployee},
+	{Name: "template_del", Args: "<name>", Group: GroupQuestions, Audience: AudienceEmployee},
+	{Name: "broadcast", Args: "[segment]", Group: GroupBroadcasts, Audience: AudienceEmployee, Permission: PermBroadcastSegment},
+	{Name: "broadcast_cancel", Group: GroupBroadcasts, Audience: AudienceEmployee, Permission: PermBroadcastSegment},
+	{Name: "segment", Args: "add|del <segment> <user_id...>", Group: GroupBroadcasts, Audience: AudienceEmployee, Permission: PermBroadcastAll},
+	{Name: "ban", Args: "[user_id] [reason]", Group: GroupModeration, Audience: AudienceEmployee, Permission: PermBan},
+	{Name: "unban", Args: "[user_id]", Group: GroupModeration, Audience: AudienceEmployee, Permission: PermBan},
+	{Name: "banned", Group: GroupModeration, Audience: AudienceEmployee, Permission: PermBan},
+	{Name: "stats", Args: "[section]", Group: GroupReports, Audience: AudienceEmployee},
+	{Name: "status", Group: GroupReports, Audience: AudienceEmployee},
+	{Name: "satisfaction", Group: GroupReports, Audience: AudienceEmployee},
+	{Name: "export", Args: "[from] [to] [csv|json]", Group: GroupReports, Audience: AudienceEmployee, Permission: PermExport},
+	{Name: "outbox", Group: GroupReports, Audience: AudienceEmployee},
+	{Name: "admins", Group: GroupReports, Audience: AudienceEmployee},
+	{Name: "rollout", Args: "[feature <percent|off|reset>]", Group: GroupReports, Audience: AudienceEmployee, Permission: PermRollout},
+	{Name: "review", Args: "[comment <text>]", Group: GroupReports, Audience: AudienceEmployee, Permission: PermReview},
+}
+
+// description returns the description of the command in the language
+func (spec commandSpec) description(language string) string {
+	if spec.Description != "" {
+		return spec.Description
+	}
+	return translate(language, "cmd_"+spec.Name)
+}
+
+// visibleCommands returns the commands the user may run, in the order of builtinCommands and plugins
+//
+// /help and the command menu are both built from it, so they always agree
+func visibleCommands(user *database.User, app *App) []commandSpec {
+	audience := AudienceUser
+	if user.IsEmployee {
+		audience = AudienceEmployee
+	}
+	var commands []commandSpec
+	for _, spec := range builtinCommands {
+		if spec.Audience&audience != 0 && (!user.IsEmployee || hasPermission(user, spec.Permission, app)) {
+			commands = append(commands, spec)
+		}
+	}
+	for _, plugin := range app.plugins {
+		provider, ok := plugin.(CommandProvider)
+		if !ok {
+			continue
+		}
+		for _, command := range provider.Commands() {
+			if command.Employee && !user.IsEmployee || user.IsEmployee && !hasPermission(user, command.Permission, app) {
+				continue
+			}
+			description := command.Description
+			if description == "" {
+				description = "/" + command.Name
+			}
+			commands = append(commands, commandSpec{Name: command.Name, Group: GroupPlugins, Description: description})
+		}
+	}
+	return commands
+}
+
+// botCommands returns the command menu of the user
+func botCommands(user *database.User, app *App) []tg.BotCommand {
+	var commands []tg.BotCommand
+	for _, spec := range visibleCommands(user, app) {
+		commands = append(commands, tg.BotCommand{Command: spec.Name, Description: spec.description(user.LanguageCode)})
+	}
+	return commands
+}
+
+// registerCommands sets the command menu of users in every catalog language and of every employee
+//
+// Employee menus follow their permissions at the start, after a role change the bot has to be restarted
+func registerCommands(app *App) {
+	for language := range catalog {
+		user := &database.User{LanguageCode: language}
+		config := tg.NewSetMyCommandsWithScopeAndLanguage(tg.NewBotCommandScopeAllPrivateChats(), language, botCommands(user, app)...)
+		if language == defaultLanguage {
+			config.LanguageCode = ""
+		}
+		_, err := app.Bot.Request(config)
+		if err != nil {
+			l.Error(l.Err(err))
+		}
+	}
+	for _, employee := range database.GetEmployees(app.DB) {
+		config := tg.NewSetMyCommandsWithScope(tg.NewBotCommandScopeChat(employee.ChatID), botCommands(&employee, app)...)
+		_, err := app.Bot.Request(config)
+		if err != nil {
+			l.Error(l.Err(err))
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package bot
+
+import (
+	"strconv"
+	"telegram-bot-feedback/internal/pkg/database"
+)
+
+// supergroupIDOffset is subtracted from the internal ID of a supergroup or channel to get its Bot API chat ID, -100<internal ID>
+const supergroupIDOffset = 1000000000000
+
+// internalChatID returns the chat ID used in t.me/c links, false for private chats and basic groups
+//
+// Only supergroups and channels have message links
+func internalChatID(chat int) (int, bool) {
+	if chat >= -supergroupIDOffset {
+		return 0, false
+	}
+	return -chat - supergroupIDOffset, true
+}
+
+// messageURL returns the t.me link of the message, with the forum topic if threadId isn't 0
+//
+// The link opens only for members of the chat, empty for chats without message links
+func messageURL(chat, threadId, messageId int) string {
+	id, ok := internalChatID(chat)
+	if !ok || messageId == 0 {
+		return ""
+	}
+	url := "https://t.me/c/" + strconv.Itoa(id) + "/"
+	if threadId != 0 {
+		url += strconv.Itoa(threadId) + "/"
+	}
+	return url + strconv.Itoa(messageId)
+}
+
+// questionURL returns the link of the first message of the Question in the chat, empty if there is none
+func questionURL(chat int, question *database.Question, app *App) string {
+	link := database.GetQuestionMessageLink(chat, question, app.DB)
+	if link == nil {
+		return ""
+	}
+	return messageURL(chat, link.ThreadID, link.MessageID)
+}
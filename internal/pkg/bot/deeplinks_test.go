@@ -0,0 +1,56 @@
+package bot
+
+import (
+	"telegram-bot-feedback/internal/pkg/database"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+	"testing"
+)
+
+func TestMessageURL(t *testing.T) {
+	tests := []struct {
+		chat, thread, message int
+		want                  string
+	}{
+		{-1001234567890, 0, 42, "https://t.me/c/1234567890/42"},
+		{-1001234567890, 7, 42, "https://t.me/c/1234567890/7/42"},
+		{-1002058412342, 0, 1, "https://t.me/c/2058412342/1"},
+		{-1001234567890, 0, 0, ""},
+		{-1000000000000, 0, 42, ""},
+		{-123456789, 0, 42, ""},
+		{-4012345678, 0, 42, ""},
+		{123456789, 0, 42, ""},
+	}
+	for _, tt := range tests {
+		if got := messageURL(tt.chat, tt.thread, tt.message); got != tt.want {
+			t.Errorf("messageURL(%d, %d, %d) = %q, want %q", tt.chat, tt.thread, tt.message, got, tt.want)
+		}
+	}
+}
+
+func TestQuestionURLUsesTheTopicOfTheStoredMessage(t *testing.T) {
+	app, _ := newTestApp(t)
+	question := askQuestion(t, app, "crash")
+	const group = -1001234567890
+	if got := questionURL(group, question, app); got != "" {
+		t.Fatalf("questionURL without a message = %q", got)
+	}
+
+	addMessageLink(&tg.Message{MessageID: 15, MessageThreadID: 9, Chat: &tg.Chat{ID: group, Type: "supergroup"}}, question, app)
+	if got := questionURL(group, question, app); got != "https://t.me/c/1234567890/15" {
+		t.Fatalf("questionURL of a reply thread = %q, want no topic", got)
+	}
+
+	other, err := database.AddQuestion("freeze", 6, database.GetUserByChatID(1, app.DB), app.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addMessageLink(&tg.Message{MessageID: 16, MessageThreadID: 9, IsTopicMessage: true, Chat: &tg.Chat{ID: group, Type: "supergroup"}}, other, app)
+	if got := questionURL(group, other, app); got != "https://t.me/c/1234567890/9/16" {
+		t.Fatalf("questionURL of a topic message = %q", got)
+	}
+
+	addMessageLink(&tg.Message{MessageID: 17, Chat: &tg.Chat{ID: -123456789, Type: "group"}}, question, app)
+	if got := questionURL(-123456789, question, app); got != "" {
+		t.Fatalf("questionURL in a basic group = %q, want none", got)
+	}
+}
@@ -0,0 +1,72 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	l "telegram-bot-feedback/internal/pkg/logger"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+	"time"
+)
+
+// Digest settings
+const (
+	// digestSetting is the store key of the date of the last digest
+	digestSetting = "digest_last"
+	// digestTop is how many questions are listed in the digest
+	digestTop = 10
+)
+
+// runDigest posts the digest of unanswered questions every day at "digest_time"
+func runDigest(ctx context.Context, app *App) {
+	runDaily(ctx, "digest_time", digestSetting, app, func(now time.Time) bool {
+		err := sendDigest(now, app)
+		if err != nil {
+			l.Error(err)
+		}
+		return true
+	})
+}
+
+// sendDigest posts the new questions older than "digest_age" hours to "digest_chat" or the admins
+//
+// Nothing is posted when there are no such questions
+func sendDigest(now time.Time, app *App) error {
+	questions := database.GetNewQuestionsBefore(now.Add(-time.Duration(app.Conf.GetInt("digest_age"))*time.Hour), app.DB)
+	if len(questions) == 0 {
+		return nil
+	}
+	chats := app.Conf.GetIntSlice("admins")
+	if chat := app.Conf.GetInt("digest_chat"); chat != 0 {
+		chats = []int{chat}
+	}
+	for _, chat := range chats {
+		_, err := app.Bot.Send(tg.NewMessage(chat, digestText(chat, now, questions, app)))
+		if err != nil {
+			l.Error(l.Err(err))
+		}
+	}
+	return nil
+}
+
+// digestText returns the digest with the count, the oldest age and the oldest questions
+func digestText(chat int, now time.Time, questions []database.Question, app *App) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Unanswered questions: %d\nOldest: %s\n", len(questions), now.Sub(questions[0].CreatedAt).Round(time.Minute))
+	for i, question := range questions {
+		if i == digestTop {
+			break
+		}
+		header := []rune(question.Header)
+		if len(header) > 50 {
+			header = append(header[:50], '…')
+		}
+		b.WriteString("\n#" + strconv.Itoa(int(question.ID)) + " " + string(header))
+		if url := questionURL(chat, &question, app); url != "" {
+			b.WriteString("\n" + url)
+		}
+	}
+	return b.String()
+}
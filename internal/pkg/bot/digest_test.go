@@ -0,0 +1,110 @@
+package bot
+
+import (
+	"context"
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	"testing"
+	"time"
+)
+
+func TestDailyDue(t *testing.T) {
+	at := time.Date(0, 1, 1, 9, 0, 0, 0, time.UTC)
+	day := func(hour, minute int) time.Time { return time.Date(2024, 3, 5, hour, minute, 0, 0, time.UTC) }
+	tests := []struct {
+		now  time.Time
+		last string
+		want bool
+	}{
+		{day(8, 59), "", false},
+		{day(9, 0), "", true},
+		{day(23, 10), "2024-03-04", true},
+		{day(9, 30), "2024-03-05", false},
+	}
+	for _, test := range tests {
+		if got := dailyDue(test.now, at, test.last); got != test.want {
+			t.Errorf("dailyDue(%s, %q) = %t, want %t", test.now.Format("15:04"), test.last, got, test.want)
+		}
+	}
+}
+
+// runDailyOnce runs one check of the daily job at the time
+func runDailyOnce(t *testing.T, app *App, now time.Time) int {
+	setClock(t, func() time.Time { return now })
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	runs := 0
+	runDaily(ctx, "digest_time", digestSetting, app, func(time.Time) bool {
+		runs++
+		return true
+	})
+	return runs
+}
+
+func TestRunDailyOncePerDayInTimezone(t *testing.T) {
+	app, _ := newTestApp(t)
+	app.Conf.Set("digest_time", "09:00")
+	app.Conf.Set("timezone", "Europe/Moscow")
+	morning := time.Date(2024, 3, 5, 5, 30, 0, 0, time.UTC) // 08:30 in Moscow
+	if runs := runDailyOnce(t, app, morning); runs != 0 {
+		t.Fatalf("runs before the time = %d", runs)
+	}
+	if runs := runDailyOnce(t, app, morning.Add(time.Hour)); runs != 1 {
+		t.Fatalf("runs at the time = %d, want 1", runs)
+	}
+	// The date of the run is stored, a restart on the same day doesn't run the job again
+	if runs := runDailyOnce(t, app, morning.Add(5*time.Hour)); runs != 0 {
+		t.Fatalf("runs after the restart = %d, want 0", runs)
+	}
+	if runs := runDailyOnce(t, app, morning.Add(25*time.Hour)); runs != 1 {
+		t.Fatalf("runs the next day = %d, want 1", runs)
+	}
+}
+
+func TestDigestListsOldNewQuestions(t *testing.T) {
+	app, api := newTestApp(t)
+	const group = -1001234567890
+	app.Conf.Set("digest_chat", group)
+	app.Conf.Set("digest_age", 4)
+	if err := sendDigest(time.Now(), app); err != nil {
+		t.Fatal(err)
+	}
+	if len(api.requests("sendMessage")) != 0 {
+		t.Fatal("the digest is posted without pending questions")
+	}
+
+	user, err := database.AddUser(1, "user1", SQuestion, app.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := database.AddQuestion("the app crashes", 5, user, app.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.AddQuestion("no receipt", 6, user, app.DB); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.AddMessageLink(group, 0, 77, first, app.DB); err != nil {
+		t.Fatal(err)
+	}
+	if err := sendDigest(time.Now().Add(time.Hour), app); err != nil {
+		t.Fatal(err)
+	}
+	if len(api.requests("sendMessage")) != 0 {
+		t.Fatal("the digest lists questions younger than digest_age")
+	}
+
+	if err := sendDigest(time.Now().Add(5*time.Hour), app); err != nil {
+		t.Fatal(err)
+	}
+	sent := api.requests("sendMessage")
+	if len(sent) != 1 || sent[0].chatID() != group {
+		t.Fatalf("digests = %+v", sent)
+	}
+	text := sent[0].text()
+	for _, want := range []string{"Unanswered questions: 2\nOldest: 5h0m0s\n", "#1 the app crashes\nhttps://t.me/c/1234567890/77", "#2 no receipt"} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("digest = %q, want %q", text, want)
+		}
+	}
+}
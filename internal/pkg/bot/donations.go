@@ -0,0 +1,115 @@
+package bot
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	l "telegram-bot-feedback/internal/pkg/logger"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+)
+
+// Donation settings
+const (
+	// donationPayload marks invoices of the plugin
+	donationPayload = "donation"
+	// starsCurrency is the currency of Telegram Stars, it needs no payment provider
+	starsCurrency = "XTR"
+)
+
+// DonationPlugin lets users tip the team with /donate
+//
+// Invoices are in "donation_currency" (Telegram Stars by default) through "donation_provider_token".
+// Only the amount and the currency of payments are stored, they are not linked to users or questions
+type DonationPlugin struct {
+	hooks *Hooks
+}
+
+// Name returns "donations"
+func (p *DonationPlugin) Name() string {
+	return "donations"
+}
+
+// Init checks that fiat currencies have a payment provider
+func (p *DonationPlugin) Init(hooks *Hooks) error {
+	p.hooks = hooks
+	if p.currency() != starsCurrency && hooks.Conf.GetString("donation_provider_token") == "" {
+		return l.NewError("donation_provider_token is required for donations in " + p.currency())
+	}
+	return nil
+}
+
+// currency returns the invoice currency
+func (p *DonationPlugin) currency() string {
+	return strings.ToUpper(p.hooks.Conf.GetString("donation_currency"))
+}
+
+// Commands returns /donate
+func (p *DonationPlugin) Commands() []Command {
+	return []Command{{Name: "donate", Description: "Tip the support team", Handler: p.donate}}
+}
+
+// donate sends the invoice
+//
+// Format: /donate [amount], the amount is in the smallest units of the currency, "donation_amount" by default
+func (p *DonationPlugin) donate(message *tg.Message, user *database.User, hooks *Hooks) error {
+	amount := hooks.Conf.GetInt("donation_amount")
+	if arg := strings.TrimSpace(message.CommandArguments()); arg != "" {
+		parsed, err := strconv.Atoi(arg)
+		if err != nil || parsed <= 0 {
+			_, err := hooks.Bot.Send(tg.NewMessage(user.ChatID, "Format: /donate [amount]"))
+			return l.Err(err)
+		}
+		amount = parsed
+	}
+	title := hooks.Conf.GetString("donation_title")
+	invoice := tg.NewInvoice(user.ChatID, title, hooks.Conf.GetString("donation_description"), donationPayload,
+		hooks.Conf.GetString("donation_provider_token"), "", p.currency(), []tg.LabeledPrice{{Label: title, Amount: amount}})
+	_, err := hooks.Bot.Send(invoice)
+	return l.Err(err)
+}
+
+// UpdateTypes requests the pre-checkout queries, successful payments come as messages
+func (p *DonationPlugin) UpdateTypes() []string {
+	return []string{tg.UpdateTypePreCheckoutQuery}
+}
+
+// HandleUpdate confirms the checkout of donation invoices and thanks the user after the payment
+func (p *DonationPlugin) HandleUpdate(update *tg.Update) (bool, error) {
+	if query := update.PreCheckoutQuery; query != nil && query.InvoicePayload == donationPayload {
+		answer := tg.AnswerPreCheckoutQueryConf{PreCheckoutQueryID: query.ID, OK: query.Currency == p.currency()}
+		if !answer.OK {
+			answer.ErrorMessage = "Donations are accepted in " + p.currency()
+		}
+		_, err := p.hooks.Bot.Request(answer)
+		return true, l.Err(err)
+	}
+	message := update.Message
+	if message == nil || message.SuccessfulPayment == nil || message.SuccessfulPayment.InvoicePayload != donationPayload {
+		return false, nil
+	}
+	payment := message.SuccessfulPayment
+	err := database.AddDonation(payment.Currency, payment.TotalAmount, payment.TelegramPaymentChargeID, p.hooks.DB)
+	if err != nil {
+		return true, l.Err(err)
+	}
+	text := strings.NewReplacer("{amount}", strconv.Itoa(payment.TotalAmount), "{currency}", payment.Currency).
+		Replace(p.hooks.Conf.GetString("donation_thanks"))
+	_, err = p.hooks.Bot.Send(tg.NewMessage(message.Chat.ID, text))
+	return true, l.Err(err)
+}
+
+// StatsSections returns the "donations" section with totals by currency
+func (p *DonationPlugin) StatsSections() map[string]func() string {
+	return map[string]func() string{"donations": func() string {
+		totals := database.GetDonationTotals(p.hooks.DB)
+		if len(totals) == 0 {
+			return "No donations yet"
+		}
+		var b strings.Builder
+		for _, total := range totals {
+			fmt.Fprintf(&b, "%s: %d in %d donations\n", total.Currency, total.Amount, total.Count)
+		}
+		return b.String()
+	}}
+}
@@ -0,0 +1,129 @@
+package bot
+
+import (
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+	"testing"
+)
+
+// donationApp returns the App with the donations plugin and user 1
+func donationApp(t *testing.T) (*App, *testAPI) {
+	app, api := newTestApp(t)
+	if loaded := enablePlugins(app, "donations"); len(loaded) != 1 {
+		t.Fatalf("loaded = %v", loaded)
+	}
+	if _, err := database.AddUser(1, "user1", SMain, app.DB); err != nil {
+		t.Fatal(err)
+	}
+	return app, api
+}
+
+// payment returns the Update with the successful payment of user 1
+func payment(currency string, amount int, payload string) *tg.Update {
+	message := privateMessage(1, 30, "")
+	message.SuccessfulPayment = &tg.SuccessfulPayment{Currency: currency, TotalAmount: amount, InvoicePayload: payload, TelegramPaymentChargeID: "charge"}
+	return &tg.Update{UpdateID: 7, Message: message}
+}
+
+func TestDonateSendsInvoice(t *testing.T) {
+	app, api := donationApp(t)
+	parseMessage(commandMessage(1, "/donate"), app)
+	parseMessage(commandMessage(1, "/donate 250"), app)
+	invoices := api.requests("sendInvoice")
+	if len(invoices) != 2 {
+		t.Fatalf("invoices = %+v", invoices)
+	}
+	for i, amount := range []float64{100, 250} {
+		params := invoices[i].Params
+		prices, _ := params["prices"].([]interface{})
+		if invoices[i].chatID() != 1 || params["currency"] != "XTR" || params["payload"] != donationPayload || len(prices) != 1 {
+			t.Fatalf("invoice = %+v", params)
+		}
+		if price := prices[0].(map[string]interface{}); price["amount"] != amount || price["label"] != "Support the team" {
+			t.Fatalf("price = %+v, want %v", price, amount)
+		}
+	}
+
+	for _, arg := range []string{"abc", "-5", "0"} {
+		parseMessage(commandMessage(1, "/donate "+arg), app)
+		if got := lastSent(api, 1); got != "Format: /donate [amount]" {
+			t.Fatalf("/donate %s = %q", arg, got)
+		}
+	}
+	if len(api.requests("sendInvoice")) != 2 {
+		t.Fatal("an invoice is sent for an invalid amount")
+	}
+}
+
+func TestDonationCheckout(t *testing.T) {
+	app, api := donationApp(t)
+	query := func(currency, payload string) *tg.Update {
+		return &tg.Update{UpdateID: 5, PreCheckoutQuery: &tg.PreCheckoutQuery{ID: "q-" + currency, From: &tg.User{ID: 1}, Currency: currency, TotalAmount: 100, InvoicePayload: payload}}
+	}
+	if err := parseUpdate(query("XTR", donationPayload), app); err != nil {
+		t.Fatal(err)
+	}
+	if err := parseUpdate(query("EUR", donationPayload), app); err != nil {
+		t.Fatal(err)
+	}
+	answers := api.requests("answerPreCheckoutQuery")
+	if len(answers) != 2 {
+		t.Fatalf("answers = %+v", answers)
+	}
+	if answers[0].Params["pre_checkout_query_id"] != "q-XTR" || answers[0].Params["ok"] != true {
+		t.Fatalf("answer = %+v, want the Stars checkout confirmed", answers[0].Params)
+	}
+	if answers[1].Params["ok"] == true || answers[1].Params["error_message"] != "Donations are accepted in XTR" {
+		t.Fatalf("answer = %+v, want another currency rejected", answers[1].Params)
+	}
+
+	handled, err := app.handleUpdate(query("XTR", "order"))
+	if handled || err != nil {
+		t.Fatalf("foreign invoice handled = %t, %v", handled, err)
+	}
+}
+
+func TestDonationPaymentIsThankedAndCounted(t *testing.T) {
+	app, api := donationApp(t)
+	if err := parseUpdate(payment("XTR", 250, donationPayload), app); err != nil {
+		t.Fatal(err)
+	}
+	if got := lastSent(api, 1); got != "Thank you for your support! 250 XTR received" {
+		t.Fatalf("thanks = %q", got)
+	}
+	if len(api.sentTo(2)) != 0 {
+		t.Fatal("the payment is sent to the team as a question")
+	}
+	user := database.GetUserByChatID(1, app.DB)
+	if user.State != SMain || database.GetOpenQuestionByUser(user, app.DB) != nil {
+		t.Fatalf("state = %d, the payment opened a question", user.State)
+	}
+	if handled, _ := app.handleUpdate(payment("XTR", 10, "order")); handled {
+		t.Fatal("a payment of another invoice is handled")
+	}
+
+	if got := statsText(t, app, api); !strings.HasSuffix(got, ", storage, donations") {
+		t.Fatalf("/stats = %q", got)
+	}
+	parseMessage(commandMessage(2, "/stats donations"), app)
+	if got := lastSent(api, 2); got != "XTR: 250 in 1 donations\n" {
+		t.Fatalf("/stats donations = %q", got)
+	}
+}
+
+func TestDonationStatsWithoutPayments(t *testing.T) {
+	app, api := donationApp(t)
+	if err := database.ChangeUserState(SMain, database.GetUserByChatID(2, app.DB), app.DB); err != nil {
+		t.Fatal(err)
+	}
+	parseMessage(commandMessage(2, "/stats donations"), app)
+	if got := lastSent(api, 2); got != "No donations yet" {
+		t.Fatalf("/stats donations = %q", got)
+	}
+	enablePlugins(app)
+	parseMessage(commandMessage(2, "/stats donations"), app)
+	if got := lastSent(api, 2); got != "Unknown section" {
+		t.Fatalf("/stats donations without the plugin = %q", got)
+	}
+}
@@ -0,0 +1,95 @@
+package bot
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+	"time"
+	"unicode"
+)
+
+// duplicateMinTokens is the number of words below which a text is too short to compare
+const duplicateMinTokens = 3
+
+// mediaPrefix is the "[photo] " prefix of Question headers with an attachment
+var mediaPrefix = regexp.MustCompile(`^\[[a-z_]+\]\s*`)
+
+// textTokens returns the set of lowercase words of the text without punctuation
+func textTokens(text string) map[string]bool {
+	tokens := map[string]bool{}
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	for _, word := range words {
+		tokens[word] = true
+	}
+	return tokens
+}
+
+// similarity returns the Jaccard index of two token sets, from 0 for distinct to 1 for equal
+func similarity(a, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	common := 0
+	for token := range a {
+		if b[token] {
+			common++
+		}
+	}
+	return float64(common) / float64(len(a)+len(b)-common)
+}
+
+// findDuplicate returns the most similar Question of the last "duplicate_days" days if the similarity
+// reaches "duplicate_threshold", otherwise nil
+//
+// Forwarded media without a caption and short texts are not checked
+func findDuplicate(question *database.Question, message *tg.Message, app *App) *database.Question {
+	threshold := app.Conf.GetFloat64("duplicate_threshold")
+	if threshold <= 0 || message.ForwardDate != 0 && messageText(message) == "" {
+		return nil
+	}
+	tokens := textTokens(messageText(message))
+	if len(tokens) < duplicateMinTokens || !featureEnabled(FeatureDuplicates, question, app) {
+		return nil
+	}
+	since := time.Now().AddDate(0, 0, -app.Conf.GetInt("duplicate_days"))
+	var duplicate *database.Question
+	best := threshold
+	questions := database.GetQuestionsInRange(time.Now(), since, app.DB)
+	for i := range questions {
+		if questions[i].ID == question.ID {
+			continue
+		}
+		if s := similarity(tokens, textTokens(mediaPrefix.ReplaceAllString(questions[i].Header, ""))); s >= best {
+			best = s
+			duplicate = &questions[i]
+		}
+	}
+	return duplicate
+}
+
+// questionTitle returns the "Question #N" header with the category and a note if the Question is a possible duplicate
+func questionTitle(question, duplicate *database.Question, app *App) string {
+	title := "Question #" + strconv.Itoa(int(question.ID))
+	if category := getQuestionCategory(question, app); category != nil {
+		title += " · " + categoryLabel(category)
+	}
+	if duplicate != nil {
+		title += " (possible duplicate of #" + strconv.Itoa(int(duplicate.ID)) + ")"
+	}
+	return title
+}
+
+// duplicateReply returns the message of the duplicated Question in the chat to reply to, 0 if there is none
+func duplicateReply(chatId int, duplicate *database.Question, app *App) int {
+	if duplicate == nil {
+		return 0
+	}
+	if link := database.GetQuestionMessageLink(chatId, duplicate, app.DB); link != nil {
+		return link.MessageID
+	}
+	return 0
+}
@@ -0,0 +1,116 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+	"testing"
+	"time"
+)
+
+// earlierQuestion adds a Question of user 3 that admin 2 received as the message 77
+func earlierQuestion(t *testing.T, app *App, header string) *database.Question {
+	t.Helper()
+	user, err := database.AddUser(3, "user3", SMain, app.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	question, err := database.AddQuestion(header, 9, user, app.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.AddMessageLink(2, 0, 77, question, app.DB); err != nil {
+		t.Fatal(err)
+	}
+	return question
+}
+
+func TestSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		min, max float64
+	}{
+		{"The app crashes on start!", "the APP crashes, on start", 1, 1},
+		{"The app crashes on start", "app crashes on start again", 0.6, 0.7},
+		{"The app crashes on start", "How do I change my email address?", 0, 0},
+		{"", "anything", 0, 0},
+	}
+	for _, tt := range tests {
+		if s := similarity(textTokens(tt.a), textTokens(tt.b)); s < tt.min || s > tt.max {
+			t.Errorf("similarity(%q, %q) = %v, want %v..%v", tt.a, tt.b, s, tt.min, tt.max)
+		}
+	}
+}
+
+func TestNearDuplicateRepliesToEarlierQuestion(t *testing.T) {
+	app, api := newTestApp(t)
+	earlier := earlierQuestion(t, app, "The app crashes when I open settings")
+	question := askQuestion(t, app, "the app crashes when I open the settings!")
+	sent := api.requests("sendMessage")
+	var header *apiCall
+	for i := range sent {
+		if sent[i].chatID() == 2 && strings.HasPrefix(sent[i].text(), "Question #") {
+			header = &sent[i]
+		}
+	}
+	if header == nil {
+		t.Fatal("the question is not sent to the admin")
+	}
+	want := fmt.Sprintf("(possible duplicate of #%d)", earlier.ID)
+	if !strings.Contains(header.text(), want) || header.Params["reply_to_message_id"] != float64(77) || header.Params["allow_sending_without_reply"] != true {
+		t.Fatalf("question #%d sent as %v, want a reply to 77 with %q", question.ID, header.Params, want)
+	}
+}
+
+func TestDistinctQuestionIsNotDuplicate(t *testing.T) {
+	app, api := newTestApp(t)
+	earlierQuestion(t, app, "The app crashes when I open settings")
+	askQuestion(t, app, "How can I change the email of my account?")
+	for _, call := range api.requests("sendMessage") {
+		if strings.Contains(call.text(), "possible duplicate") || call.Params["reply_to_message_id"] != nil {
+			t.Fatalf("a distinct question is sent as a duplicate: %v", call.Params)
+		}
+	}
+}
+
+func TestFindDuplicateSkips(t *testing.T) {
+	app, _ := newTestApp(t)
+	earlier := earlierQuestion(t, app, "The app crashes when I open settings")
+	user, err := database.AddUser(1, "user1", SQuestion, app.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	question, err := database.AddQuestion("[photo] ", 5, user, app.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := privateMessage(1, 5, "The app crashes when I open settings")
+	if findDuplicate(question, text, app) == nil {
+		t.Fatal("an equal text is not a duplicate")
+	}
+
+	forward := privateMessage(1, 5, "")
+	forward.ForwardDate = 1
+	forward.Photo = []*tg.PhotoSize{{FileID: "photo"}}
+	if findDuplicate(question, forward, app) != nil {
+		t.Error("a forwarded photo without a caption is checked")
+	}
+	if findDuplicate(question, privateMessage(1, 5, "app crashes"), app) != nil {
+		t.Error("a short text is checked")
+	}
+
+	app.Conf.Set("duplicate_threshold", 0)
+	if findDuplicate(question, text, app) != nil {
+		t.Error("threshold 0 doesn't turn the check off")
+	}
+	app.Conf.Set("duplicate_threshold", 0.7)
+
+	app.Conf.Set("duplicate_days", 2)
+	if err := app.DB.Model(earlier).Update("created_at", time.Now().AddDate(0, 0, -3)).Error; err != nil {
+		t.Fatal(err)
+	}
+	if findDuplicate(question, text, app) != nil {
+		t.Error("a question older than duplicate_days is compared")
+	}
+}
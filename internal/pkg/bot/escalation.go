@@ -0,0 +1,303 @@
+package bot
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"telegram-bot-feedback/internal/app/notify"
+	"telegram-bot-feedback/internal/pkg/database"
+	l "telegram-bot-feedback/internal/pkg/logger"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+// Escalation settings
+const (
+	// escalationPath is the prefix of the inbound endpoint, partners POST replies to /escalation/<team>
+	escalationPath = "/escalation/"
+	// escalationMaxBody limits the inbound request body
+	escalationMaxBody = 1 << 20
+	// escalationQueue is how many events wait for delivery to a team before new ones are dropped
+	escalationQueue = 1000
+)
+
+// Kinds of escalation events, they use the notify.Feedback format and its signature
+//
+// The ID of an event is the Escalation ID, partners send it back in their replies
+const (
+	EscalationOpened  = "escalation" // the summary of the conversation
+	EscalationMessage = "message"    // a later message of the user
+	EscalationClosed  = "closed"     // the question is resolved or closed by the user
+	EscalationReply   = "reply"      // the answer of the partner, the only inbound kind
+)
+
+// escalationPartner is the feedback bot of another team from "escalation" in the configuration:
+//
+//	"escalation": {"finance": {"url": "https://...", "secret": "...", "label": "Finance team"}}
+type escalationPartner struct {
+	URL    string // endpoint of the partner receiving events
+	Secret string // signs events both ways
+	Label  string // shown to the user before the relayed replies
+}
+
+// escalationTeams returns the teams of "escalation" in alphabetical order
+func escalationTeams(conf *viper.Viper) []string {
+	var teams []string
+	for team := range conf.GetStringMap("escalation") {
+		teams = append(teams, team)
+	}
+	sort.Strings(teams)
+	return teams
+}
+
+// getEscalationPartner returns the partner of the team, false if it is missing or has no URL or secret
+func getEscalationPartner(team string, conf *viper.Viper) (escalationPartner, bool) {
+	if team == "" || strings.Contains(team, ".") {
+		return escalationPartner{}, false
+	}
+	key := "escalation." + team + "."
+	partner := escalationPartner{
+		URL:    conf.GetString(key + "url"),
+		Secret: conf.GetString(key + "secret"),
+		Label:  conf.GetString(key + "label"),
+	}
+	if partner.Label == "" {
+		partner.Label = team
+	}
+	return partner, partner.URL != "" && partner.Secret != ""
+}
+
+// EscalationPlugin hands questions to the feedback bots of other teams with /escalate <team>
+//
+// The summary and the later messages of the user are POSTed to the partner as signed events with
+// retries, the partner's replies come to escalationPath and are relayed to the user through the outbox.
+// A question is escalated to one team at a time and the relayed replies are never sent back, so
+// two bots escalating to each other can't loop
+type EscalationPlugin struct {
+	hooks  *Hooks
+	queues map[string]chan notify.Feedback
+}
+
+// Name returns "escalation"
+func (p *EscalationPlugin) Name() string {
+	return "escalation"
+}
+
+// Init starts the delivery of events to every team
+//
+// Events of a team are delivered one by one, so the partner gets the summary before the messages
+func (p *EscalationPlugin) Init(hooks *Hooks) error {
+	p.hooks = hooks
+	p.queues = map[string]chan notify.Feedback{}
+	teams := escalationTeams(hooks.Conf)
+	if len(teams) == 0 {
+		return l.NewError("escalation has no teams")
+	}
+	for _, team := range teams {
+		partner, ok := getEscalationPartner(team, hooks.Conf)
+		if !ok {
+			return l.NewError("escalation." + team + " needs url and secret")
+		}
+		dispatcher := &notify.Dispatcher{
+			Notifiers: []notify.Notifier{notify.NewWebhook(partner.URL, partner.Secret)},
+			Retries:   hooks.Conf.GetInt("notify_retries"),
+		}
+		queue := make(chan notify.Feedback, escalationQueue)
+		go func() {
+			for event := range queue {
+				dispatcher.Deliver(event)
+			}
+		}()
+		p.queues[team] = queue
+	}
+	return nil
+}
+
+// send queues the event to the team
+func (p *EscalationPlugin) send(team string, event notify.Feedback) {
+	select {
+	case p.queues[team] <- event:
+	default:
+		l.Error(l.WithFields(l.NewError("Escalation queue is full, the event is dropped"), "team", team, "kind", event.Kind, "id", event.ID))
+	}
+}
+
+// Commands returns /escalate
+func (p *EscalationPlugin) Commands() []Command {
+	return []Command{{Name: "escalate", Employee: true, Description: "Hand the question to a partner team", Handler: p.escalate}}
+}
+
+// escalate sends the summary of the Question to the team
+//
+// Format: /escalate <team>, as a reply to the question message or for the taken question
+func (p *EscalationPlugin) escalate(message *tg.Message, user *database.User, hooks *Hooks) error {
+	team := strings.ToLower(strings.TrimSpace(message.CommandArguments()))
+	if _, ok := p.queues[team]; !ok {
+		_, err := hooks.Bot.Send(tg.NewMessage(user.ChatID, "Format: /escalate <team>\nTeams: "+strings.Join(escalationTeams(hooks.Conf), ", ")))
+		return l.Err(err)
+	}
+	var question *database.Question
+	if message.ReplyToMessage != nil {
+		if link := database.GetMessageLink(message.Chat.ID, message.ReplyToMessage.MessageID, hooks.DB); link != nil {
+			question = database.GetQuestionById(link.QuestionID, hooks.DB)
+		}
+	} else {
+		question = database.GetOpenQuestionByAnswerer(user, hooks.DB)
+	}
+	if question == nil || question.IsClosed {
+		_, err := hooks.Bot.Send(tg.NewMessage(user.ChatID, "Take a question or reply to its message"))
+		return l.Err(err)
+	}
+	id := strconv.Itoa(int(question.ID))
+	if current := database.GetOpenEscalation(question, hooks.DB); current != nil {
+		_, err := hooks.Bot.Send(tg.NewMessage(user.ChatID, "Question #"+id+" is already escalated to "+current.Team))
+		return l.Err(err)
+	}
+	escalation, err := database.AddEscalation(team, question, hooks.DB)
+	if err != nil {
+		return l.Err(err)
+	}
+	p.send(team, escalationEvent(EscalationOpened, escalation, question, escalationSummary(question, hooks.DB)))
+	_, err = hooks.Bot.Send(tg.NewMessage(user.ChatID, "Question #"+id+" escalated to "+team))
+	if err != nil {
+		return l.Err(err)
+	}
+	partner, _ := getEscalationPartner(team, hooks.Conf)
+	err = sendNotice(&question.User, tg.NewMessage(question.User.ChatID, "Your ticket "+ticketNumber(question)+" has been handed to "+partner.Label), int(question.ID), hooks)
+	return l.Err(err)
+}
+
+// OnEvent passes the messages of the user to the team and closes the Escalation with the Question
+func (p *EscalationPlugin) OnEvent(event Event) {
+	if event.Type != EventQuestionMessage && event.Type != EventQuestionClosed {
+		return
+	}
+	escalation := database.GetOpenEscalation(event.Question, p.hooks.DB)
+	if escalation == nil {
+		return
+	}
+	if _, ok := p.queues[escalation.Team]; !ok {
+		return
+	}
+	question := database.GetQuestionById(escalation.QuestionID, p.hooks.DB)
+	if question == nil {
+		return
+	}
+	if event.Type == EventQuestionMessage {
+		p.send(escalation.Team, escalationEvent(EscalationMessage, escalation, question, event.Text))
+		return
+	}
+	err := database.CloseEscalation(escalation, p.hooks.DB)
+	if err != nil {
+		l.Error(err)
+	}
+	p.send(escalation.Team, escalationEvent(EscalationClosed, escalation, question, ""))
+}
+
+// escalationEvent returns the event of the Escalation
+func escalationEvent(kind string, escalation *database.Escalation, question *database.Question, text string) notify.Feedback {
+	return notify.Feedback{
+		Kind:   kind,
+		ID:     escalation.ID,
+		UserID: question.User.ChatID,
+		User:   userName(&question.User),
+		Text:   text,
+		Date:   clock(),
+	}
+}
+
+// escalationSummary returns the question and the correspondence
+func escalationSummary(question *database.Question, db *gorm.DB) string {
+	var b strings.Builder
+	b.WriteString(question.Header)
+	for _, corr := range database.GetCorrespondenceByQuestion(question, db) {
+		if corr.Text == "" || corr.Text == question.Header {
+			continue
+		}
+		sender := "User"
+		if corr.IsEmployee {
+			sender = "Employee"
+		}
+		b.WriteString("\n" + sender + ": " + corr.Text)
+	}
+	return b.String()
+}
+
+// escalationEnabled reports whether the escalation plugin is enabled in the configuration
+func escalationEnabled(conf *viper.Viper) bool {
+	for _, name := range conf.GetStringSlice("plugins") {
+		if name == "escalation" {
+			return true
+		}
+	}
+	return false
+}
+
+// escalationHandler receives the signed replies of partners and queues them to the users
+func escalationHandler(db *gorm.DB, conf *viper.Viper) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		team := strings.ToLower(strings.TrimPrefix(r.URL.Path, escalationPath))
+		partner, ok := getEscalationPartner(team, conf)
+		if !ok || !escalationEnabled(conf) {
+			http.NotFound(w, r)
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, escalationMaxBody))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if !hmac.Equal([]byte(r.Header.Get(notify.SignatureHeader)), []byte(notify.Sign(partner.Secret, body))) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var event notify.Feedback
+		// Only replies are accepted, so our own events echoed back by the partner are never relayed
+		if json.Unmarshal(body, &event) != nil || event.Kind != EscalationReply || strings.TrimSpace(event.Text) == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		escalation := database.GetEscalation(event.ID, team, db)
+		if escalation == nil {
+			http.NotFound(w, r)
+			return
+		}
+		question := database.GetQuestionById(escalation.QuestionID, db)
+		if question == nil {
+			http.NotFound(w, r)
+			return
+		}
+		if err := relayPartnerReply(partner.Label, event.Text, question, db); err != nil {
+			l.Error(err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// relayPartnerReply queues the reply to the user and stores it in the correspondence
+//
+// The outbox retries the delivery, the stored reply is not an event and never goes back to the partner
+func relayPartnerReply(label, text string, question *database.Question, db *gorm.DB) error {
+	text = label + ":\n" + text
+	payload, err := json.Marshal(tg.NewMessage(question.User.ChatID, text))
+	if err != nil {
+		return l.Err(err)
+	}
+	err = database.AddOutboxMessage(question.User.ChatID, "sendMessage", string(payload), int(question.ID), clock(), db)
+	if err != nil {
+		return l.Err(err)
+	}
+	return l.Err(database.AddPartnerCorrespondence(question, text, db))
+}
@@ -0,0 +1,222 @@
+package bot
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"telegram-bot-feedback/internal/app/notify"
+	"telegram-bot-feedback/internal/pkg/database"
+	"testing"
+	"time"
+)
+
+// partnerBot is the feedback bot of the finance team receiving escalation events
+type partnerBot struct {
+	*httptest.Server
+	mu       sync.Mutex
+	statuses []int // statuses of the next requests, 200 when empty
+	events   []notify.Feedback
+	requests int
+}
+
+// newPartnerBot starts the partner and configures it as the "finance" team of the escalation plugin
+func newPartnerBot(t *testing.T, app *App) *partnerBot {
+	p := &partnerBot{}
+	p.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.requests++
+		if len(p.statuses) > 0 {
+			status := p.statuses[0]
+			p.statuses = p.statuses[1:]
+			w.WriteHeader(status)
+			return
+		}
+		var event notify.Feedback
+		if r.Header.Get(notify.SignatureHeader) != notify.Sign("finance-secret", body) || json.Unmarshal(body, &event) != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		p.events = append(p.events, event)
+	}))
+	t.Cleanup(p.Close)
+	app.Conf.Set("escalation", map[string]interface{}{
+		"finance": map[string]interface{}{"url": p.URL, "secret": "finance-secret", "label": "Finance team"},
+	})
+	if loaded := enablePlugins(app, "escalation"); len(loaded) != 1 {
+		t.Fatalf("loaded = %v", loaded)
+	}
+	return p
+}
+
+// waitEvents waits until the partner received n events and returns them
+func (p *partnerBot) waitEvents(t *testing.T, n int) []notify.Feedback {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		p.mu.Lock()
+		events := append([]notify.Feedback(nil), p.events...)
+		p.mu.Unlock()
+		if len(events) >= n {
+			return events
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d events, want %d", len(events), n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// partnerReply returns the reply of the partner to the escalation signed with the secret
+func partnerReply(t *testing.T, id uint, kind, text, secret string) *http.Request {
+	body, err := json.Marshal(notify.Feedback{Kind: kind, ID: id, Text: text})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodPost, escalationPath+"finance", bytes.NewReader(body))
+	r.Header.Set(notify.SignatureHeader, notify.Sign(secret, body))
+	return r
+}
+
+func TestEscalateRelaysQuestionToPartner(t *testing.T) {
+	app, api := newTestApp(t)
+	partner := newPartnerBot(t, app)
+	question := answeredQuestion(t, app)
+
+	parseMessage(commandMessage(2, "/escalate Finance"), app)
+	if got, want := lastSent(api, 2), fmt.Sprintf("Question #%d escalated to finance", question.ID); got != want {
+		t.Fatalf("/escalate = %q, want %q", got, want)
+	}
+	if got, want := lastSent(api, 1), "Your ticket "+ticketNumber(question)+" has been handed to Finance team"; got != want {
+		t.Fatalf("notice = %q, want %q", got, want)
+	}
+	escalation := database.GetOpenEscalation(question, app.DB)
+	if escalation == nil || escalation.Team != "finance" {
+		t.Fatalf("escalation = %+v", escalation)
+	}
+
+	parseMessage(privateMessage(1, 12, "The card ends with 1234"), app)
+	events := partner.waitEvents(t, 2)
+	if events[0].Kind != EscalationOpened || events[0].ID != escalation.ID || events[0].UserID != 1 || !strings.HasPrefix(events[0].Text, "crash") {
+		t.Fatalf("first event = %+v, want the summary", events[0])
+	}
+	if events[1].Kind != EscalationMessage || events[1].Text != "The card ends with 1234" {
+		t.Fatalf("second event = %+v, want the message of the user", events[1])
+	}
+
+	parseMessage(commandMessage(2, "/escalate finance"), app)
+	if got, want := lastSent(api, 2), fmt.Sprintf("Question #%d is already escalated to finance", question.ID); got != want {
+		t.Fatalf("second /escalate = %q", got)
+	}
+	parseMessage(commandMessage(2, "/escalate legal"), app)
+	if got := lastSent(api, 2); got != "Format: /escalate <team>\nTeams: finance" {
+		t.Fatalf("/escalate legal = %q", got)
+	}
+
+	if err := closeQuestion(database.GetQuestionById(int(question.ID), app.DB), app); err != nil {
+		t.Fatal(err)
+	}
+	if events := partner.waitEvents(t, 3); events[2].Kind != EscalationClosed || events[2].ID != escalation.ID {
+		t.Fatalf("events = %+v, want the closing", events)
+	}
+	if database.GetOpenEscalation(question, app.DB) != nil {
+		t.Fatal("the escalation stays open after the question is closed")
+	}
+}
+
+func TestEscalateNeedsQuestion(t *testing.T) {
+	app, api := newTestApp(t)
+	newPartnerBot(t, app)
+	parseMessage(commandMessage(2, "/escalate finance"), app)
+	if got := lastSent(api, 2); got != "Take a question or reply to its message" {
+		t.Fatalf("/escalate = %q", got)
+	}
+	if _, err := database.AddUser(1, "user1", SMain, app.DB); err != nil {
+		t.Fatal(err)
+	}
+	parseMessage(commandMessage(1, "/escalate finance"), app)
+	if strings.Contains(lastSent(api, 1), "escalated") {
+		t.Fatal("a user escalated a question")
+	}
+}
+
+func TestEscalationRetriesDelivery(t *testing.T) {
+	app, _ := newTestApp(t)
+	app.Conf.Set("notify_retries", 2)
+	partner := newPartnerBot(t, app)
+	partner.statuses = []int{http.StatusBadGateway}
+	answeredQuestion(t, app)
+	parseMessage(commandMessage(2, "/escalate finance"), app)
+	if events := partner.waitEvents(t, 1); events[0].Kind != EscalationOpened {
+		t.Fatalf("events = %+v", events)
+	}
+	partner.mu.Lock()
+	defer partner.mu.Unlock()
+	if partner.requests != 2 {
+		t.Fatalf("requests = %d, want the failure and the retry", partner.requests)
+	}
+}
+
+func TestPartnerReplyIsRelayedOnce(t *testing.T) {
+	app, _ := newTestApp(t)
+	partner := newPartnerBot(t, app)
+	question := answeredQuestion(t, app)
+	parseMessage(commandMessage(2, "/escalate finance"), app)
+	partner.waitEvents(t, 1)
+	escalation := database.GetOpenEscalation(question, app.DB)
+	handler := escalationHandler(app.DB, app.Conf)
+
+	w := httptest.NewRecorder()
+	handler(w, partnerReply(t, escalation.ID, EscalationReply, "The refund is on its way", "finance-secret"))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("status = %d", w.Code)
+	}
+	outbox := database.GetDueOutboxMessages(time.Now().Add(time.Minute), app.DB)
+	if len(outbox) != 1 || outbox[0].ChatID != 1 || !strings.Contains(outbox[0].Payload, `"text":"Finance team:\nThe refund is on its way"`) {
+		t.Fatalf("outbox = %+v", outbox)
+	}
+	corr := database.GetCorrespondenceByQuestion(question, app.DB)
+	if last := corr[len(corr)-1]; last.Text != "Finance team:\nThe refund is on its way" || !last.IsEmployee {
+		t.Fatalf("correspondence = %+v", corr)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if events := partner.waitEvents(t, 1); len(events) != 1 {
+		t.Fatalf("the relayed reply is sent back to the partner: %+v", events)
+	}
+
+	tests := []struct {
+		name   string
+		req    *http.Request
+		status int
+	}{
+		{"wrong signature", partnerReply(t, escalation.ID, EscalationReply, "hi", "other"), http.StatusUnauthorized},
+		{"echoed event", partnerReply(t, escalation.ID, EscalationMessage, "hi", "finance-secret"), http.StatusBadRequest},
+		{"empty reply", partnerReply(t, escalation.ID, EscalationReply, " ", "finance-secret"), http.StatusBadRequest},
+		{"unknown escalation", partnerReply(t, escalation.ID+1, EscalationReply, "hi", "finance-secret"), http.StatusNotFound},
+		{"unknown team", httptest.NewRequest(http.MethodPost, escalationPath+"legal", nil), http.StatusNotFound},
+		{"GET", httptest.NewRequest(http.MethodGet, escalationPath+"finance", nil), http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		handler(w, tt.req)
+		if w.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.status)
+		}
+	}
+
+	enablePlugins(app)
+	w = httptest.NewRecorder()
+	handler(w, partnerReply(t, escalation.ID, EscalationReply, "hi", "finance-secret"))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("status without the plugin = %d", w.Code)
+	}
+	if len(database.GetDueOutboxMessages(time.Now().Add(time.Minute), app.DB)) != 1 {
+		t.Fatal("rejected replies are relayed")
+	}
+}
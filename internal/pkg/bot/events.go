@@ -42,19 +42,45 @@ func buttons(key int) []string {
 }
 
 // responserCommand responds to commands
-func responserCommand(command string, user *database.User, app *App) error {
+func responserCommand(message *tg.Message, user *database.User, app *App) error {
+	message = expandAlias(message, user, app)
+	if command := app.pluginCommand(message.Command(), user); command != nil {
+		if ok, err := authorize(command.Permission, user, app); !ok {
+			return l.Err(err)
+		}
+		return l.Err(command.Handler(message, user, app.hooks))
+	}
 	if user.IsEmployee {
-		return l.Err(responserCommandEmployee(command, user, app))
+		permission, ok := employeeCommands[message.Command()]
+		if !ok {
+			return nil
+		}
+		if ok, err := authorize(permission, user, app); !ok {
+			return l.Err(err)
+		}
+		return l.Err(responserCommandEmployee(message, user, app))
 	}
-	return l.Err(responserCommandUser(command, user, app))
+	return l.Err(responserCommandUser(message, user, app))
 }
 
 // responserCommandUser responds to user commands
-func responserCommandUser(command string, user *database.User, app *App) error {
-	switch command {
-	case "/start":
-		message := tg.NewMessage(user.ChatID, "Greetings 👋\nWith my help, you can leave a \"⭐Review\" \nor ask a \"❓Question\"")
-		message.ReplyMarkup = newReplyKeyboardMarkup(buttons(UserMain)...)
+func responserCommandUser(command *tg.Message, user *database.User, app *App) error {
+	switch command.Command() {
+	case "help":
+		return l.Err(sendHelp(user, app))
+	case "settings":
+		return l.Err(userSettings(command, user, app))
+	case "mytickets":
+		return l.Err(listTickets(user, app))
+	case "ticket":
+		return l.Err(showTicket(command, user, app))
+	case "start":
+		text := "Greetings 👋\nWith my help, you can leave a \"⭐Review\" \nor ask a \"❓Question\""
+		if greeting := startGreeting(command.CommandArguments(), app); greeting != "" {
+			text = greeting
+		}
+		message := tg.NewMessage(user.ChatID, text)
+		message.ReplyMarkup = userMainKeyboard(user, app)
 		_, err := app.Bot.Send(message)
 		if err != nil {
 			return l.Err(err)
@@ -66,9 +92,9 @@ func responserCommandUser(command string, user *database.User, app *App) error {
 }
 
 // responserCommandEmployee responds to employee commands
-func responserCommandEmployee(command string, user *database.User, app *App) error {
-	switch command {
-	case "/start":
+func responserCommandEmployee(command *tg.Message, user *database.User, app *App) error {
+	switch command.Command() {
+	case "start":
 		message := tg.NewMessage(user.ChatID, "Greetings 👋\nI implement customer feedback\no receive questions click\n\"❓Receive questions\"")
 		message.ReplyMarkup = newReplyKeyboardMarkup(buttons(EmplMain)...)
 		_, err := app.Bot.Send(message)
@@ -77,6 +103,66 @@ func responserCommandEmployee(command string, user *database.User, app *App) err
 		}
 		err = database.ChangeUserState(SMain, user, app.DB)
 		return l.Err(err)
+	case "broadcast":
+		return l.Err(startBroadcast(command, user, app))
+	case "broadcast_cancel":
+		return l.Err(cancelBroadcast(user, app))
+	case "set":
+		return l.Err(setField(command, user, app))
+	case "export":
+		return l.Err(exportFeedback(command, user, app))
+	case "help":
+		return l.Err(sendHelp(user, app))
+	case "stats":
+		return l.Err(sendStats(command, user, app))
+	case "status":
+		return l.Err(startStatus(user, app))
+	case "resolve":
+		return l.Err(resolveQuestion(command, user, app))
+	case "satisfaction":
+		return l.Err(sendSatisfaction(user, app))
+	case "ban":
+		return l.Err(banUser(command, true, user, app))
+	case "unban":
+		return l.Err(banUser(command, false, user, app))
+	case "banned":
+		return l.Err(sendBanned(user, app))
+	case "history":
+		return l.Err(sendHistory(command, user, app))
+	case "alias":
+		return l.Err(aliasCommand(command, user, app))
+	case "outbox":
+		return l.Err(sendOutbox(user, app))
+	case "admins":
+		return l.Err(sendAdmins(user, app))
+	case "addcategory":
+		return l.Err(addCategory(command, user, app))
+	case "renamecategory":
+		return l.Err(renameCategory(command, user, app))
+	case "removecategory":
+		return l.Err(removeCategory(command, user, app))
+	case "segment":
+		return l.Err(segmentCommand(command, user, app))
+	case "tag":
+		return l.Err(tagQuestion(command, true, user, app))
+	case "untag":
+		return l.Err(tagQuestion(command, false, user, app))
+	case "find":
+		return l.Err(findQuestions(command, user, app))
+	case "t":
+		return l.Err(sendTemplate(command, user, app))
+	case "templates":
+		return l.Err(listTemplates(user, app))
+	case "later":
+		return l.Err(sendLater(command, user, app))
+	case "template_add":
+		return l.Err(addTemplate(command, user, app))
+	case "template_del":
+		return l.Err(deleteTemplate(command, user, app))
+	case "rollout":
+		return l.Err(rolloutCommand(command, user, app))
+	case "review":
+		return l.Err(reviewCommand(command, user, app))
 	}
 	return nil
 }
@@ -86,15 +172,37 @@ func responser(user *database.User, app *App) error {
 	if user.IsEmployee {
 		return l.Err(responserEmployee(user, app))
 	}
+	if !allowAutoReply(user, app) {
+		return nil
+	}
 	return l.Err(responserUser(user, app))
 }
 
+// allowAutoReply limits automatic replies to the user
+//
+// When the limit is reached employees are alerted once per window
+func allowAutoReply(user *database.User, app *App) bool {
+	window := time.Duration(app.Conf.GetInt("auto_reply_window")) * time.Second
+	if app.autoReplies.allow(user.ChatID, app.Conf.GetInt("auto_reply_limit"), window) {
+		return true
+	}
+	if app.autoReplies.notifyOnce(user.ChatID, window) {
+		text := "Automatic replies to @" + user.Nickname + " (" + strconv.Itoa(user.ChatID) + ") are paused: too many messages in " + window.String()
+		for _, employee := range database.GetEmployees(app.DB) {
+			if employee.ChatID != 0 {
+				app.Bot.Send(tg.NewMessage(employee.ChatID, text))
+			}
+		}
+	}
+	return false
+}
+
 // responserUser responds to user message
 func responserUser(user *database.User, app *App) error {
 	switch user.State {
 	case SMain:
 		message := tg.NewMessage(user.ChatID, "If you have any questions or review, I'm listening carefully")
-		message.ReplyMarkup = newReplyKeyboardMarkup(buttons(UserMain)...)
+		message.ReplyMarkup = userMainKeyboard(user, app)
 		_, err := app.Bot.Send(message)
 		return l.Err(err)
 	case SReview:
@@ -103,7 +211,7 @@ func responserUser(user *database.User, app *App) error {
 		_, err := app.Bot.Send(message)
 		return l.Err(err)
 	case SReviewText:
-		message := tg.NewMessage(user.ChatID, "Thank you for your review\nYou can also leave a comment\nOr press \"❌Close\"")
+		message := tg.NewMessage(user.ChatID, translate(user.LanguageCode, MsgReviewThanks))
 		message.ReplyMarkup = newReplyKeyboardMarkup(buttons(UserClose)...)
 		_, err := app.Bot.Send(message)
 		return l.Err(err)
@@ -111,7 +219,10 @@ func responserUser(user *database.User, app *App) error {
 		message := tg.NewMessage(user.ChatID, "Please ask your question\nOr click \"❌Close\"")
 		message.ReplyMarkup = newReplyKeyboardMarkup(buttons(UserClose)...)
 		_, err := app.Bot.Send(message)
-		return l.Err(err)
+		if err != nil {
+			return l.Err(err)
+		}
+		return l.Err(sendCategoryMenu(user, app))
 	case SQuestionDiscussion:
 		question := database.GetOpenQuestionByUser(user, app.DB)
 		if question == nil {
@@ -119,8 +230,7 @@ func responserUser(user *database.User, app *App) error {
 			_, err := app.Bot.Send(message)
 			return l.Err(err)
 		}
-		id := strconv.Itoa(int(question.ID))
-		message := tg.NewMessage(user.ChatID, "Your question #"+id+"\nThank you for your question\nAn available employee will answer you shortly")
+		message := tg.NewMessage(user.ChatID, translate(user.LanguageCode, MsgQuestionThanks, ticketNumber(question)))
 		_, err := app.Bot.Send(message)
 		return l.Err(err)
 	}
@@ -181,7 +291,7 @@ func responserEmployee(user *database.User, app *App) error {
 		_, err = app.Bot.Send(message)
 		return l.Err(err)
 	case SSearchQuestion:
-		message := tg.NewMessage(user.ChatID, "Enter question number")
+		message := tg.NewMessage(user.ChatID, "Enter question number or <field>=<value>")
 		message.ReplyMarkup = newReplyKeyboardMarkup(buttons(EmplExit)...)
 		_, err := app.Bot.Send(message)
 		return l.Err(err)
@@ -204,44 +314,209 @@ func newReplyKeyboardMarkup(text ...string) tg.ReplyKeyboardMarkup {
 	return rkm
 }
 
-// newOneButtonInlineKeyboardMarkup returns InlineKeyboardMarkup with one button by button text
-func newOneButtonInlineKeyboardMarkup(text, data string) tg.InlineKeyboardMarkup {
-	var keyboard [][]tg.InlineKeyboardButton
-	keyboard = append(keyboard, []tg.InlineKeyboardButton{tg.NewInlineKeyboardButtonData(text, data)})
-	rkm := tg.InlineKeyboardMarkup{
-		InlineKeyboard: keyboard,
+// questionKeyboard returns the take, pin and triage buttons of the Question message
+//
+// Once the Question has a final triage status the keyboard is a single status line
+func questionKeyboard(question *database.Question, pinned bool, app *App) tg.InlineKeyboardMarkup {
+	id := strconv.Itoa(int(question.ID))
+	actions := triageActions(app)
+	if action := findTriageAction(question.TriageStatus, actions); action != nil && action.Terminal {
+		return tg.NewInlineKeyboardMarkup(tg.NewInlineKeyboardRow(tg.NewInlineKeyboardButtonData(triageLine(question, action, app), strconv.Itoa(CBTriage)+"-"+id)))
 	}
-	return rkm
+	pin := tg.NewInlineKeyboardButtonData("📌 Pin", strconv.Itoa(CBPin)+"-"+id)
+	if pinned {
+		pin = tg.NewInlineKeyboardButtonData("Unpin", strconv.Itoa(CBUnpin)+"-"+id)
+	}
+	markup := tg.NewInlineKeyboardMarkup(tg.NewInlineKeyboardRow(tg.NewInlineKeyboardButtonData("Take question", strconv.Itoa(CBQuestion)+"-"+id), pin))
+	if row := triageRow(question, actions); len(row) > 0 {
+		markup.InlineKeyboard = append(markup.InlineKeyboard, row)
+	}
+	return markup
 }
 
 // sendQuestions sends Questions to the chat
-func sendQuestions(to *database.User, bot *tg.Client, question []database.Question) error {
-	for _, q := range question {
-		id := strconv.Itoa(int(q.ID))
-		key := strconv.Itoa(CBQuestion) + "-"
-		text := "Question #" + id + "\n" + q.Header
-		message := tg.NewMessage(to.ChatID, text)
-		message.ReplyMarkup = newOneButtonInlineKeyboardMarkup("Take question", key+id)
-		_, err := bot.Send(message)
+func sendQuestions(to *database.User, app *App, question []database.Question) error {
+	for i := range question {
+		err := sendQuestion(to, &question[i], nil, nil, app)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendQuestion sends the Question to the chat, entities keep the formatting of the header
+func sendQuestion(to *database.User, question *database.Question, entities []*tg.MessageEntity, duplicate *database.Question, app *App) error {
+	chunks := splitMessage(questionTitle(question, duplicate, app), question.Header, entities)
+	for i, chunk := range chunks {
+		message := tg.NewMessage(to.ChatID, chunk.Text)
+		message.Entities = chunk.Entities
+		if i == 0 {
+			message.ReplyToMessageID = duplicateReply(to.ChatID, duplicate, app)
+			message.AllowSendingWithoutReply = true
+		}
+		if i == len(chunks)-1 {
+			message.ReplyMarkup = questionKeyboard(question, false, app)
+		}
+		sent, err := app.Bot.Send(message)
 		if err != nil {
 			return l.Err(err)
 		}
+		addMessageLink(sent, question, app)
 	}
 	return nil
 }
 
+// sendNewQuestion sends the new Question to receivers and admins from configuration
+//
+// Every chat receives the Question once. An attachment of the first message is copied with the header
+// in its caption, or after the header message if the caption can't hold it. A possible duplicate
+// is sent as a reply to the earlier Question. Returns false if no chat received the Question
+func sendNewQuestion(question *database.Question, message *tg.Message, app *App) bool {
+	entities := questionEntities(message)
+	duplicate := findDuplicate(question, message, app)
+	delivered := false
+	var copies []*tg.Message
+	for _, recipient := range questionRecipients(app) {
+		copy, ok := sendNewQuestionTo(&recipient, question, message, entities, duplicate, app)
+		if ok {
+			delivered = true
+		}
+		if copy != nil {
+			copies = append(copies, copy)
+		}
+	}
+	transcribeVoice(message, question, copies, app)
+	if sendToTopic(question, message, app) {
+		delivered = true
+	}
+	return delivered
+}
+
+// sendNewQuestionTo sends the new Question with its attachment to the chat of the recipient
+//
+// The chat is locked meanwhile, so the header and the attachment arrive together.
+// Returns the copy of the attachment and whether the Question was delivered
+func sendNewQuestionTo(recipient *database.User, question *database.Question, message *tg.Message, entities []*tg.MessageEntity, duplicate *database.Question, app *App) (*tg.Message, bool) {
+	defer app.outgoing.lock(recipient.ChatID)()
+	if copy := sendQuestionWithMedia(recipient.ChatID, question, message, duplicate, app); copy != nil {
+		return copy, true
+	}
+	if err := sendQuestion(recipient, question, entities, duplicate, app); err != nil {
+		l.Error(err)
+		return nil, false
+	}
+	if item := messageShare(message); item != nil {
+		if _, err := sendShare(recipient.ChatID, question, item, app); err != nil {
+			l.Error(err)
+		}
+		return nil, true
+	}
+	if mediaType(message) == "" {
+		return nil, true
+	}
+	sent, err := app.Bot.Send(tg.NewCopyMessage(recipient.ChatID, message.Chat.ID, message.MessageID))
+	if err != nil {
+		l.Error(l.Err(err))
+		return nil, true
+	}
+	sent.Chat = &tg.Chat{ID: recipient.ChatID}
+	sent.Caption, sent.CaptionEntities = message.Caption, message.CaptionEntities
+	addMessageLink(sent, question, app)
+	return sent, true
+}
+
+// questionRecipients returns the receivers and the admins a new Question is sent to
+//
+// Admins from configuration receive every Question, even while they are answering another one
+func questionRecipients(app *App) []database.User {
+	sent := map[int]bool{}
+	var recipients []database.User
+	candidates := database.GetReceivers(app.DB)
+	candidates = append(candidates, database.GetEmployeesByChatIDs(app.Conf.GetIntSlice("admins"), app.DB)...)
+	for _, recipient := range candidates {
+		if recipient.ChatID == 0 || sent[recipient.ChatID] {
+			continue
+		}
+		sent[recipient.ChatID] = true
+		recipients = append(recipients, recipient)
+	}
+	return recipients
+}
+
+// captionMedia are the attachment types which have a caption
+var captionMedia = map[string]bool{"photo": true, "video": true, "animation": true, "document": true, "voice": true, "audio": true}
+
+// sendQuestionWithMedia copies the attachment of the new Question with the header merged into the caption
+//
+// Returns the copy or nil if the attachment has no caption or the header doesn't fit, then header and attachment are sent separately
+func sendQuestionWithMedia(chatId int, question *database.Question, message *tg.Message, duplicate *database.Question, app *App) *tg.Message {
+	title := questionTitle(question, duplicate, app)
+	caption := title + "\n" + message.Caption
+	if !captionMedia[mediaType(message)] || tg.UTF16Len(caption) > tg.MaxCaptionLength {
+		return nil
+	}
+	copy := tg.NewCopyMessage(chatId, message.Chat.ID, message.MessageID)
+	copy.Caption = caption
+	copy.CaptionEntities = shiftEntities(sendableEntities(message.CaptionEntities, tg.UTF16Len(message.Caption)), tg.UTF16Len(title)+1)
+	markup := questionKeyboard(question, false, app)
+	copy.ReplyMarkup = markup
+	copy.ReplyToMessageID = duplicateReply(chatId, duplicate, app)
+	copy.AllowSendingWithoutReply = true
+	sent, err := app.Bot.Send(copy)
+	if err != nil {
+		l.Error(l.Err(err))
+		return nil
+	}
+	sent.Chat = &tg.Chat{ID: chatId}
+	sent.Caption, sent.CaptionEntities, sent.ReplyMarkup = copy.Caption, nil, &markup
+	for i := range copy.CaptionEntities {
+		sent.CaptionEntities = append(sent.CaptionEntities, &copy.CaptionEntities[i])
+	}
+	addMessageLink(sent, question, app)
+	return sent
+}
+
 // sendCorrespondenceFromUser forwarding message from user to employee
-func sendCorrespondenceFromUser(question *database.Question, message *tg.Message, bot *tg.Client) error {
+//
+// In privacy mode the message is copied under the Question number
+func sendCorrespondenceFromUser(question *database.Question, message *tg.Message, app *App) error {
+	defer app.outgoing.lock(question.Answerer.ChatID)()
+	if privacyMode(app) {
+		sent, err := mirrorMessage(question.Answerer.ChatID, question, message, app)
+		if err != nil {
+			return l.Err(err)
+		}
+		transcribeVoice(message, question, []*tg.Message{sent}, app)
+		return nil
+	}
+	if item := messageShare(message); item != nil {
+		_, err := sendShare(question.Answerer.ChatID, question, item, app)
+		return l.Err(err)
+	}
 	copy := tg.NewForward(question.Answerer.ChatID, question.User.ChatID, message.MessageID)
-	_, err := bot.Send(copy)
-	return l.Err(err)
+	sent, err := app.Bot.Send(copy)
+	if err != nil {
+		return l.Err(err)
+	}
+	addMessageLink(sent, question, app)
+	transcribeVoice(message, question, []*tg.Message{sent}, app)
+	return nil
 }
 
 // sendCorrespondenceFromAnswerer sends copy of message from employee to user
-func sendCorrespondenceFromAnswerer(question *database.Question, message *tg.Message, bot *tg.Client) error {
-	copy := tg.NewCopyMessage(question.User.ChatID, question.Answerer.ChatID, message.MessageID)
-	_, err := bot.Send(copy)
-	return l.Err(err)
+//
+// Text with tracked links is sent as a new message
+func sendCorrespondenceFromAnswerer(question *database.Question, message *tg.Message, app *App) error {
+	var answer tg.Config = tg.NewCopyMessage(question.User.ChatID, message.Chat.ID, message.MessageID)
+	if message.Text != "" {
+		if entities, ok := trackLinks(message.Entities, message.Text, int(question.ID), LinkAnswer, app); ok {
+			text := tg.NewMessage(question.User.ChatID, message.Text)
+			text.Entities = entities
+			answer = text
+		}
+	}
+	return l.Err(sendToUser(question.User.ChatID, answer, question, app))
 }
 
 // loadCorrespondence loads Correspondence to the chat by Question ID
@@ -256,17 +531,83 @@ func loadCorrespondence(id int, user *database.User, app *App) error {
 	if err != nil {
 		return l.Err(err)
 	}
+	err = awaitReply(question, app)
+	if err != nil {
+		return l.Err(err)
+	}
+	if fields := fieldsText(question, app); fields != "" {
+		_, err := app.Bot.Send(tg.NewMessage(user.ChatID, "Question #"+strconv.Itoa(int(question.ID))+"\n"+fields))
+		if err != nil {
+			return l.Err(err)
+		}
+	}
 	correspondence := database.GetCorrespondenceByQuestion(question, app.DB)
 	for _, corr := range correspondence {
-		copy := tg.NewForward(user.ChatID, corr.User.ChatID, corr.MessageID)
-		_, err := app.Bot.Send(copy)
+		var copy tg.Config = tg.NewForward(user.ChatID, corr.User.ChatID, corr.MessageID)
+		if privacyMode(app) {
+			copy = tg.NewCopyMessage(user.ChatID, corr.User.ChatID, corr.MessageID)
+		}
+		sent, err := app.Bot.Send(copy)
 		if err != nil {
 			return l.Err(err)
 		}
+		sent.Chat = &tg.Chat{ID: user.ChatID}
+		if !corr.User.IsEmployee {
+			addMessageLink(sent, question, app)
+		}
 	}
 	return nil
 }
 
+// addMessageLink saves which Question the message in the employee chat belongs to
+func addMessageLink(sent *tg.Message, question *database.Question, app *App) {
+	if sent == nil || sent.Chat == nil {
+		return
+	}
+	threadId := 0
+	if sent.IsTopicMessage {
+		threadId = sent.MessageThreadID
+	}
+	err := database.AddMessageLink(sent.Chat.ID, threadId, sent.MessageID, question, app.DB)
+	if err != nil {
+		l.Error(err)
+	}
+}
+
+// linkedQuestion returns the open Question of the message the employee replied to
+func linkedQuestion(message *tg.Message, app *App) *database.Question {
+	if message.ReplyToMessage == nil {
+		return nil
+	}
+	link := database.GetMessageLink(message.Chat.ID, message.ReplyToMessage.MessageID, app.DB)
+	if link == nil {
+		return nil
+	}
+	question := database.GetQuestionById(link.QuestionID, app.DB)
+	if question == nil || question.IsClosed {
+		return nil
+	}
+	return question
+}
+
+// answerLinkedQuestion sends the employee reply to the user of the replied message
+func answerLinkedQuestion(question *database.Question, user *database.User, message *tg.Message, app *App) error {
+	err := sendCorrespondenceFromAnswerer(question, message, app)
+	if err != nil {
+		return l.Err(err)
+	}
+	err = database.ChangeQuestionHaveAnswer(true, question, app.DB)
+	if err != nil {
+		return l.Err(err)
+	}
+	err = stopAwaitingReply(question, app)
+	if err != nil {
+		return l.Err(err)
+	}
+	_, err = database.AddCorrespondenceToQuestion(question, user, message.MessageID, questionHeader(message), app.DB)
+	return l.Err(err)
+}
+
 // loadReviews loads Reviews by date interval
 func loadReviews(interval int, user *database.User, app *App) {
 	fDate := time.Now().UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
@@ -311,11 +652,21 @@ func loadFullQuestionById(id string, user *database.User, app *App) {
 		app.Bot.Send(message)
 		return
 	}
-	message := tg.NewMessage(user.ChatID, question.Header)
+	text := question.Header
+	if fields := fieldsText(question, app); fields != "" {
+		text = text + "\n\n" + fields
+	}
+	if question.TicketID != "" {
+		text = "Ticket: " + question.TicketID + "\n" + text
+	}
+	message := tg.NewMessage(user.ChatID, text)
 	app.Bot.Send(message)
 	correspondence := database.GetCorrespondenceByQuestion(question, app.DB)
 	for _, corr := range correspondence {
-		copy := tg.NewForward(user.ChatID, corr.User.ChatID, corr.MessageID)
+		var copy tg.Config = tg.NewForward(user.ChatID, corr.User.ChatID, corr.MessageID)
+		if privacyMode(app) {
+			copy = tg.NewCopyMessage(user.ChatID, corr.User.ChatID, corr.MessageID)
+		}
 		_, err := app.Bot.Send(copy)
 		if err != nil {
 			return
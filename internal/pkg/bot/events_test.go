@@ -0,0 +1,257 @@
+package bot
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"telegram-bot-feedback/internal/pkg/database"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+	"testing"
+	"time"
+)
+
+// questionSentTo counts the messages with the question the chat received
+func questionSentTo(api *testAPI, chatID int, header string) int {
+	n := 0
+	for _, text := range api.sentTo(chatID) {
+		if strings.Contains(text, header) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestNewQuestionReachesEveryAdmin(t *testing.T) {
+	app, api := newTestApp(t)
+	app.Conf.Set("admins", []int{2, 3})
+	if err := database.AddEmployeeByID(app.DB, 3); err != nil {
+		t.Fatal(err)
+	}
+	// Admin 2 is also a receiver, it gets the question once
+	if err := database.ChangeUserIsReceiver(true, database.GetUserByChatID(2, app.DB), app.DB); err != nil {
+		t.Fatal(err)
+	}
+	askQuestion(t, app, "It crashes")
+	if questionSentTo(api, 2, "It crashes") != 1 || questionSentTo(api, 3, "It crashes") != 1 {
+		t.Fatalf("admin 2 got %q, admin 3 got %q", api.sentTo(2), api.sentTo(3))
+	}
+}
+
+func TestBusyAdminReceivesNewQuestion(t *testing.T) {
+	app, api := newTestApp(t)
+	app.Conf.Set("admins", []int{2, 3})
+	if err := database.AddEmployeeByID(app.DB, 3); err != nil {
+		t.Fatal(err)
+	}
+	// Admin 2 is answering the question of another user
+	other, err := database.AddUser(4, "user4", SQuestionDiscussion, app.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	busy, err := database.AddQuestion("Where is my order", 7, other, app.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.ChangeQuestionAnswerer(int(database.GetUserByChatID(2, app.DB).ID), busy, app.DB); err != nil {
+		t.Fatal(err)
+	}
+	askQuestion(t, app, "It crashes")
+	if questionSentTo(api, 2, "It crashes") != 1 || questionSentTo(api, 3, "It crashes") != 1 {
+		t.Fatalf("admin 2 got %q, admin 3 got %q", api.sentTo(2), api.sentTo(3))
+	}
+}
+
+func TestAdminReplyReachesUser(t *testing.T) {
+	app, api := newTestApp(t)
+	question := askQuestion(t, app, "It crashes")
+	if err := database.ChangeUserState(SMain, database.GetUserByChatID(2, app.DB), app.DB); err != nil {
+		t.Fatal(err)
+	}
+	take := &tg.CallbackQuery{
+		ID:      "take",
+		From:    &tg.User{ID: 2},
+		Message: &tg.Message{MessageID: 50, Chat: &tg.Chat{ID: 2, Type: "private"}},
+		Data:    strconv.Itoa(CBQuestion) + "-" + strconv.Itoa(int(question.ID)),
+	}
+	if err := parseCallback(take, app); err != nil {
+		t.Fatal(err)
+	}
+	api.reset()
+	parseMessage(privateMessage(2, 60, "Please update the app"), app)
+	delivered := false
+	for _, call := range api.requests() {
+		if call.chatID() == 1 && call.Method != "getChat" {
+			delivered = true
+		}
+	}
+	if !delivered {
+		t.Fatalf("the reply is not sent to the user: %+v", api.requests())
+	}
+}
+
+// reopen closes the store of the App and returns a new App with the store opened from path
+func reopen(t *testing.T, app *App, path string) *App {
+	sqlDB, err := app.DB.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sqlDB.Close(); err != nil {
+		t.Fatal(err)
+	}
+	db, err := database.Init(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return NewApp(app.Bot, db, app.Conf)
+}
+
+func TestReplyToQuestionAfterRestart(t *testing.T) {
+	app, api := newTestApp(t)
+	path := filepath.Join(t.TempDir(), "bot.db")
+	db, err := database.Init(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.AddEmployeeByID(db, 2); err != nil {
+		t.Fatal(err)
+	}
+	app = NewApp(app.Bot, db, app.Conf)
+	question := askQuestion(t, app, "It crashes")
+	link := database.GetQuestionMessageLink(2, question, app.DB)
+	if link == nil {
+		t.Fatal("the question message is not linked")
+	}
+	app = reopen(t, app, path)
+	api.reset()
+	reply := privateMessage(2, 70, "Please update the app")
+	reply.ReplyToMessage = &tg.Message{MessageID: link.MessageID, Chat: reply.Chat}
+	parseMessage(reply, app)
+	copies := api.requests("copyMessage")
+	if len(copies) != 1 || copies[0].chatID() != 1 || copies[0].Params["message_id"] != float64(70) {
+		t.Fatalf("copies = %+v", copies)
+	}
+	if question := database.GetQuestionById(int(question.ID), app.DB); !question.HaveAnswer {
+		t.Fatal("the question is not answered")
+	}
+}
+
+// askWithMedia sends the question of user 1 with the attachment set by attach
+func askWithMedia(t *testing.T, app *App, caption string, attach func(message *tg.Message)) *database.Question {
+	user, err := database.AddUser(1, "user1", SQuestion, app.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	message := privateMessage(1, 5, "")
+	message.Caption = caption
+	attach(message)
+	parseMessage(message, app)
+	question := database.GetOpenQuestionByUser(user, app.DB)
+	if question == nil {
+		t.Fatal("the question is not opened")
+	}
+	return question
+}
+
+func TestPhotoQuestionIsCopiedWithCaption(t *testing.T) {
+	app, api := newTestApp(t)
+	question := askWithMedia(t, app, "broken screen", func(message *tg.Message) {
+		message.Photo = []*tg.PhotoSize{{FileID: "small"}, {FileID: "photo"}}
+	})
+	if question.Header != "[photo] broken screen" {
+		t.Fatalf("header = %q", question.Header)
+	}
+	copies := api.requests("copyMessage")
+	if len(copies) != 1 || copies[0].chatID() != 2 || copies[0].Params["from_chat_id"] != float64(1) || copies[0].Params["message_id"] != float64(5) {
+		t.Fatalf("copies = %+v", copies)
+	}
+	if caption, _ := copies[0].Params["caption"].(string); !strings.HasSuffix(caption, "\nbroken screen") {
+		t.Fatalf("caption = %q", caption)
+	}
+	if link := database.GetMessageLink(2, 101, app.DB); link == nil || link.QuestionID != int(question.ID) {
+		t.Fatal("the copy is not linked with the question")
+	}
+}
+
+func TestStickerQuestionIsSentAfterTheHeader(t *testing.T) {
+	app, api := newTestApp(t)
+	askWithMedia(t, app, "", func(message *tg.Message) {
+		message.Sticker = &tg.Sticker{FileID: "sticker"}
+	})
+	var methods []string
+	for _, call := range api.requests("sendMessage", "copyMessage") {
+		if call.chatID() == 2 {
+			methods = append(methods, call.Method)
+		}
+	}
+	if strings.Join(methods, " ") != "sendMessage copyMessage" {
+		t.Fatalf("requests to the employee = %v", methods)
+	}
+	if questionSentTo(api, 2, "[sticker]") != 1 {
+		t.Fatalf("the employee got %q", api.sentTo(2))
+	}
+}
+
+func TestPhotoQuestionInPrivacyModeIsNotForwarded(t *testing.T) {
+	app, api := newTestApp(t)
+	app.Conf.Set("privacy_mode", true)
+	askWithMedia(t, app, "", func(message *tg.Message) {
+		message.Photo = []*tg.PhotoSize{{FileID: "small"}, {FileID: "photo"}}
+	})
+	if len(api.requests("forwardMessage")) != 0 {
+		t.Fatal("the photo is forwarded in privacy mode")
+	}
+	if copies := api.requests("copyMessage"); len(copies) != 1 || copies[0].chatID() != 2 {
+		t.Fatalf("copies = %+v", copies)
+	}
+}
+
+func TestConcurrentQuestionsDoNotInterleaveHeaderAndAttachment(t *testing.T) {
+	app, api := newTestApp(t)
+	api.onRequest = func(call apiCall) {
+		// Holds every send long enough for the other users to get in between
+		time.Sleep(time.Millisecond)
+	}
+	const users = 20
+	var wg sync.WaitGroup
+	for i := 0; i < users; i++ {
+		chatID := 100 + i
+		if _, err := database.AddUser(chatID, "user"+strconv.Itoa(chatID), SQuestion, app.DB); err != nil {
+			t.Fatal(err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			message := privateMessage(chatID, 5, "")
+			message.Sticker = &tg.Sticker{FileID: "sticker"}
+			parseMessage(message, app)
+		}()
+	}
+	wg.Wait()
+	var sent []apiCall
+	for _, call := range api.requests("sendMessage", "copyMessage") {
+		if call.chatID() == 2 {
+			sent = append(sent, call)
+		}
+	}
+	if len(sent) != 2*users {
+		t.Fatalf("sent = %d, want %d", len(sent), 2*users)
+	}
+	for i := 0; i < len(sent); i += 2 {
+		header, copy := sent[i], sent[i+1]
+		var id int
+		if _, err := fmt.Sscanf(header.text(), "Question #%d", &id); header.Method != "sendMessage" || err != nil || copy.Method != "copyMessage" {
+			t.Fatalf("message %d is %s %q, then %s", i, header.Method, header.text(), copy.Method)
+		}
+		question := database.GetQuestionById(id, app.DB)
+		if question == nil || copy.Params["from_chat_id"] != float64(question.User.ChatID) {
+			t.Fatalf("the header of question #%d is followed by the sticker from %v", id, copy.Params["from_chat_id"])
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package bot
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	l "telegram-bot-feedback/internal/pkg/logger"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+	"time"
+)
+
+// Export settings
+const (
+	// exportDateLayout is the date format of /export arguments
+	exportDateLayout = "2006-01-02"
+	// exportMaxSize is the Telegram upload limit
+	exportMaxSize = 50 << 20
+	// exportFlushRows is how many rows are written between buffer flushes
+	exportFlushRows = 500
+)
+
+// feedbackRow is one Review or Question in the export
+type feedbackRow struct {
+	ID       uint              `json:"id"`
+	User     string            `json:"user"`
+	Date     time.Time         `json:"date"`
+	Category string            `json:"category"`
+	Status   string            `json:"status"`
+	Text     string            `json:"text"`
+	Share    *exportShare      `json:"share,omitempty"`
+	Fields   map[string]string `json:"fields,omitempty"`
+}
+
+// exportShare is the first contact, location or venue of the Question in the export
+type exportShare struct {
+	Kind      string  `json:"kind"`
+	Phone     string  `json:"phone,omitempty"`
+	Name      string  `json:"name,omitempty"`
+	Latitude  float64 `json:"latitude,omitempty"`
+	Longitude float64 `json:"longitude,omitempty"`
+	Address   string  `json:"address,omitempty"`
+	Live      bool    `json:"live,omitempty"`
+}
+
+// shareColumns are the CSV columns of exportShare
+var shareColumns = []string{"share", "phone", "contact_name", "latitude", "longitude", "address", "live_location"}
+
+// newExportShare returns the export of the item
+func newExportShare(item *database.SharedItem) *exportShare {
+	share := &exportShare{Kind: item.Kind, Address: item.Address, Live: item.IsLive}
+	switch item.Kind {
+	case database.ShareContact:
+		share.Phone = item.PhoneNumber
+		share.Name = strings.TrimSpace(item.FirstName + " " + item.LastName)
+	case database.ShareVenue:
+		share.Name = item.Title
+		fallthrough
+	default:
+		share.Latitude, share.Longitude = item.Latitude, item.Longitude
+	}
+	return share
+}
+
+// record returns the CSV columns of the share, empty ones if there is none
+func (share *exportShare) record() []string {
+	if share == nil {
+		return make([]string, len(shareColumns))
+	}
+	var latitude, longitude, live string
+	if share.Kind != database.ShareContact {
+		latitude = strconv.FormatFloat(share.Latitude, 'f', -1, 64)
+		longitude = strconv.FormatFloat(share.Longitude, 'f', -1, 64)
+	}
+	if share.Live {
+		live = "yes"
+	}
+	return []string{share.Kind, share.Phone, share.Name, latitude, longitude, share.Address, live}
+}
+
+// parseExportArgs parses "[from] [to] [format]"
+//
+// Dates are inclusive, the default range is all time and the default format is csv
+func parseExportArgs(args string) (from, to time.Time, format string, err error) {
+	format = "csv"
+	to = time.Now().UTC()
+	var dates []time.Time
+	for _, arg := range strings.Fields(args) {
+		switch strings.ToLower(arg) {
+		case "csv", "json":
+			format = strings.ToLower(arg)
+			continue
+		}
+		date, err := time.Parse(exportDateLayout, arg)
+		if err != nil {
+			return from, to, format, l.NewError("Wrong date \"" + arg + "\", use YYYY-MM-DD")
+		}
+		dates = append(dates, date)
+	}
+	switch len(dates) {
+	case 0:
+	case 1:
+		from = dates[0]
+	case 2:
+		from = dates[0]
+		to = dates[1].Add(24*time.Hour - time.Nanosecond)
+	default:
+		return from, to, format, l.NewError("Format: /export [from] [to] [csv|json]")
+	}
+	if to.Before(from) {
+		return from, to, format, l.NewError("The end date is before the start date")
+	}
+	return from, to, format, nil
+}
+
+// exportFeedback sends Reviews and Questions in the date range as a document
+//
+// Format: /export [from] [to] [csv|json]
+func exportFeedback(message *tg.Message, user *database.User, app *App) error {
+	from, to, format, err := parseExportArgs(message.CommandArguments())
+	if err != nil {
+		_, err := app.Bot.Send(tg.NewMessage(user.ChatID, err.Error()))
+		return l.Err(err)
+	}
+	stop := app.Bot.StartTyping(user.ChatID)
+	defer stop()
+	err = database.SetSetting(database.BusySetting, "export", app.DB)
+	if err != nil {
+		return l.Err(err)
+	}
+	defer database.SetSetting(database.BusySetting, "", app.DB)
+	rows := feedbackRows(from, to, app)
+	var data []byte
+	var truncated bool
+	if format == "json" {
+		data, truncated, err = renderJSON(rows)
+	} else {
+		data, truncated, err = renderCSV(rows, getFields(app.Conf))
+	}
+	if err != nil {
+		return l.Err(err)
+	}
+	if truncated {
+		_, err := app.Bot.Send(tg.NewMessage(user.ChatID, "The export exceeds 50MB and was truncated, narrow the date range"))
+		if err != nil {
+			return l.Err(err)
+		}
+	}
+	name := "feedback-" + from.Format(exportDateLayout) + "-" + to.Format(exportDateLayout) + "." + format
+	document := tg.NewDocument(user.ChatID, tg.FileBytes{Name: name, Bytes: data})
+	document.Caption = strconv.Itoa(len(rows)) + " records"
+	_, err = app.Bot.Send(&document)
+	return l.Err(err)
+}
+
+// feedbackRows returns Reviews and Questions in the date range ordered by date
+func feedbackRows(from, to time.Time, app *App) []feedbackRow {
+	var rows []feedbackRow
+	for _, r := range database.GetReviewsInRange(to, from, app.DB) {
+		rows = append(rows, feedbackRow{
+			ID:       r.ID,
+			User:     userName(&r.User),
+			Date:     r.CreatedAt,
+			Category: "review",
+			Status:   strconv.Itoa(r.Rating) + "/5",
+			Text:     r.Text,
+		})
+	}
+	for _, q := range database.GetQuestionsInRange(to, from, app.DB) {
+		row := feedbackRow{
+			ID:       q.ID,
+			User:     userName(&q.User),
+			Date:     q.CreatedAt,
+			Category: "question",
+			Status:   questionStatus(&q),
+			Text:     q.Header,
+			Fields:   map[string]string{},
+		}
+		if item := database.GetFirstSharedItem(&q, app.DB); item != nil {
+			row.Share = newExportShare(item)
+		}
+		for _, f := range database.GetQuestionFields(&q, app.DB) {
+			row.Fields[f.Name] = f.Value
+		}
+		rows = append(rows, row)
+	}
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].Date.Before(rows[j].Date) })
+	return rows
+}
+
+// renderCSV writes rows as CSV, returns true if the limit was reached
+func renderCSV(rows []feedbackRow, fields []Field) ([]byte, bool, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	header := []string{"id", "user", "date", "category", "status", "text"}
+	header = append(header, shareColumns...)
+	for _, f := range fields {
+		header = append(header, f.Name)
+	}
+	if err := w.Write(header); err != nil {
+		return nil, false, l.Err(err)
+	}
+	for i, row := range rows {
+		record := []string{strconv.Itoa(int(row.ID)), row.User, row.Date.UTC().Format(time.RFC3339), row.Category, row.Status, row.Text}
+		record = append(record, row.Share.record()...)
+		for _, f := range fields {
+			record = append(record, row.Fields[f.Name])
+		}
+		if err := w.Write(record); err != nil {
+			return nil, false, l.Err(err)
+		}
+		if i%exportFlushRows == 0 {
+			w.Flush()
+			if buf.Len() > exportMaxSize {
+				return buf.Bytes()[:exportMaxSize], true, nil
+			}
+		}
+	}
+	w.Flush()
+	if buf.Len() > exportMaxSize {
+		return buf.Bytes()[:exportMaxSize], true, nil
+	}
+	return buf.Bytes(), false, l.Err(w.Error())
+}
+
+// renderJSON writes rows as a JSON array, returns true if the limit was reached
+func renderJSON(rows []feedbackRow) ([]byte, bool, error) {
+	var buf bytes.Buffer
+	buf.WriteString("[")
+	for i, row := range rows {
+		data, err := json.Marshal(row)
+		if err != nil {
+			return nil, false, l.Err(err)
+		}
+		if buf.Len()+len(data)+2 > exportMaxSize {
+			buf.WriteString("]")
+			return buf.Bytes(), true, nil
+		}
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		buf.Write(data)
+	}
+	buf.WriteString("]")
+	return buf.Bytes(), false, nil
+}
+
+// questionStatus returns the status of the Question
+func questionStatus(question *database.Question) string {
+	switch {
+	case question.IsClosed:
+		return "closed"
+	case question.HaveAnswer:
+		return "answered"
+	case question.AnswererID != 0:
+		return "taken"
+	}
+	return "open"
+}
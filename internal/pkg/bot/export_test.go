@@ -0,0 +1,93 @@
+package bot
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseExportArgs(t *testing.T) {
+	day := func(s string) time.Time {
+		date, _ := time.Parse(exportDateLayout, s)
+		return date
+	}
+	tests := []struct {
+		args   string
+		from   time.Time
+		to     time.Time
+		format string
+	}{
+		{"", time.Time{}, time.Time{}, "csv"},
+		{"JSON", time.Time{}, time.Time{}, "json"},
+		{"2024-03-01", day("2024-03-01"), time.Time{}, "csv"},
+		{"2024-03-01 2024-03-31 json", day("2024-03-01"), day("2024-04-01").Add(-time.Nanosecond), "json"},
+		{"csv 2024-03-05 2024-03-05", day("2024-03-05"), day("2024-03-06").Add(-time.Nanosecond), "csv"},
+	}
+	for _, tt := range tests {
+		from, to, format, err := parseExportArgs(tt.args)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.args, err)
+		}
+		if !tt.to.IsZero() && !to.Equal(tt.to) || tt.to.IsZero() && time.Since(to) > time.Minute {
+			t.Errorf("%q: to = %v", tt.args, to)
+		}
+		if !from.Equal(tt.from) || format != tt.format {
+			t.Errorf("%q: from = %v, format = %q", tt.args, from, format)
+		}
+	}
+	for _, args := range []string{"yesterday", "2024-13-01", "2024-03-01 2024-03-02 2024-03-03", "2024-03-02 2024-03-01"} {
+		if _, _, _, err := parseExportArgs(args); err == nil {
+			t.Errorf("%q is accepted", args)
+		}
+	}
+}
+
+func TestRenderCSVEscapesText(t *testing.T) {
+	text := "It crashes on start\nError: \"no, it's broken\", again"
+	rows := []feedbackRow{{ID: 1, User: "@user1", Date: time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC), Category: "question", Status: "open", Text: text}}
+	data, truncated, err := renderCSV(rows, nil)
+	if err != nil || truncated {
+		t.Fatalf("truncated = %t, %v", truncated, err)
+	}
+	if !bytes.Contains(data, []byte(`"It crashes on start`+"\n"+`Error: ""no, it's broken"", again"`)) {
+		t.Fatalf("the text is not quoted:\n%s", data)
+	}
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[1][5] != text || records[1][2] != "2024-03-01T10:00:00Z" {
+		t.Fatalf("records = %q", records)
+	}
+}
+
+func TestExportCommandSendsDocument(t *testing.T) {
+	app, api := newTestApp(t)
+	askQuestion(t, app, "It crashes\n\"again\"")
+	api.reset()
+	parseMessage(commandMessage(2, "/export json"), app)
+	documents := api.requests("sendDocument")
+	if len(documents) != 1 || documents[0].chatID() != 2 || documents[0].Params["caption"] != "1 records" {
+		t.Fatalf("documents = %+v", documents)
+	}
+	var rows []feedbackRow
+	if err := json.Unmarshal([]byte(documents[0].Params["document"].(string)), &rows); err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].Text != "It crashes\n\"again\"" || rows[0].Status != "open" {
+		t.Fatalf("rows = %+v", rows)
+	}
+
+	api.reset()
+	parseMessage(commandMessage(2, "/export 2000-01-01 2000-01-31"), app)
+	documents = api.requests("sendDocument")
+	if len(documents) != 1 || documents[0].Params["caption"] != "0 records" {
+		t.Fatalf("documents = %+v", documents)
+	}
+	if data := documents[0].Params["document"].(string); !strings.HasPrefix(data, "id,user,date") || strings.Count(data, "\n") != 1 {
+		t.Fatalf("csv = %q", data)
+	}
+}
@@ -0,0 +1,170 @@
+package bot
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	l "telegram-bot-feedback/internal/pkg/logger"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+
+	"github.com/spf13/viper"
+)
+
+// Custom field types
+const (
+	FieldString = "string"
+	FieldNumber = "number"
+	FieldEnum   = "enum"
+)
+
+// Field is a custom Question field defined in the configuration
+//
+// Example: {"name": "order", "type": "number", "required": true, "category": ""}
+type Field struct {
+	Name     string   `mapstructure:"name"`
+	Type     string   `mapstructure:"type"`
+	Required bool     `mapstructure:"required"`
+	Values   []string `mapstructure:"values"`   // allowed values of enum field
+	Category string   `mapstructure:"category"` // empty for all categories
+}
+
+// getFields returns the custom fields from the configuration
+func getFields(conf *viper.Viper) []Field {
+	var fields []Field
+	err := conf.UnmarshalKey("fields", &fields)
+	if err != nil {
+		l.Error(l.Err(err))
+		return nil
+	}
+	return fields
+}
+
+// fieldsForCategory returns the custom fields of the category
+func fieldsForCategory(category string, conf *viper.Viper) []Field {
+	var result []Field
+	for _, field := range getFields(conf) {
+		if field.Category == "" || strings.EqualFold(field.Category, category) {
+			result = append(result, field)
+		}
+	}
+	return result
+}
+
+// findField returns the custom field by name
+func findField(name string, fields []Field) *Field {
+	for _, field := range fields {
+		if strings.EqualFold(field.Name, name) {
+			return &field
+		}
+	}
+	return nil
+}
+
+// parse validates the value by field type and returns the normalized value
+func (f Field) parse(value string) (string, float64, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", 0, l.NewError("Value of \"" + f.Name + "\" is empty")
+	}
+	switch f.Type {
+	case FieldNumber:
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return "", 0, l.NewError("\"" + f.Name + "\" must be a number")
+		}
+		return strconv.FormatFloat(number, 'f', -1, 64), number, nil
+	case FieldEnum:
+		for _, v := range f.Values {
+			if strings.EqualFold(v, value) {
+				return v, 0, nil
+			}
+		}
+		return "", 0, l.NewError("\"" + f.Name + "\" must be one of: " + strings.Join(f.Values, ", "))
+	case FieldString, "":
+		return value, 0, nil
+	}
+	return "", 0, l.NewError("Unknown type of field \"" + f.Name + "\"")
+}
+
+// setField sets a custom field of the Question answered by the employee
+//
+// Format: /set <field> <value>
+func setField(message *tg.Message, user *database.User, app *App) error {
+	args := strings.SplitN(message.CommandArguments(), " ", 2)
+	if len(args) < 2 {
+		_, err := app.Bot.Send(tg.NewMessage(user.ChatID, "Format: /set <field> <value>"))
+		return l.Err(err)
+	}
+	question := database.GetOpenQuestionByAnswerer(user, app.DB)
+	if question == nil {
+		_, err := app.Bot.Send(tg.NewMessage(user.ChatID, "Take a question first"))
+		return l.Err(err)
+	}
+	field := findField(args[0], fieldsForCategory(questionCategory(question, app), app.Conf))
+	if field == nil {
+		_, err := app.Bot.Send(tg.NewMessage(user.ChatID, "Unknown field \""+args[0]+"\""))
+		return l.Err(err)
+	}
+	value, number, err := field.parse(args[1])
+	if err != nil {
+		_, err := app.Bot.Send(tg.NewMessage(user.ChatID, err.Error()))
+		return l.Err(err)
+	}
+	err = database.SetQuestionField(question, field.Name, value, number, app.DB)
+	if err != nil {
+		return l.Err(err)
+	}
+	_, err = app.Bot.Send(tg.NewMessage(user.ChatID, field.Name+" = "+value))
+	return l.Err(err)
+}
+
+// fieldsText returns the custom fields of the Question as text
+//
+// Missing required fields are marked
+func fieldsText(question *database.Question, app *App) string {
+	values := map[string]string{}
+	for _, v := range database.GetQuestionFields(question, app.DB) {
+		values[strings.ToLower(v.Name)] = v.Value
+	}
+	var lines []string
+	for _, field := range fieldsForCategory(questionCategory(question, app), app.Conf) {
+		value, ok := values[strings.ToLower(field.Name)]
+		switch {
+		case ok:
+			lines = append(lines, field.Name+": "+value)
+		case field.Required:
+			lines = append(lines, field.Name+": ❗required")
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// findQuestionsByField sends the Questions with the field value
+//
+// Format: <field>=<value>
+func findQuestionsByField(query string, user *database.User, app *App) error {
+	name, value, _ := strings.Cut(query, "=")
+	field := findField(strings.TrimSpace(name), getFields(app.Conf))
+	if field == nil {
+		_, err := app.Bot.Send(tg.NewMessage(user.ChatID, "Unknown field \""+strings.TrimSpace(name)+"\""))
+		return l.Err(err)
+	}
+	value, _, err := field.parse(value)
+	if err != nil {
+		_, err := app.Bot.Send(tg.NewMessage(user.ChatID, err.Error()))
+		return l.Err(err)
+	}
+	questions := database.GetQuestionsByField(field.Name, value, app.DB)
+	if len(questions) == 0 {
+		_, err := app.Bot.Send(tg.NewMessage(user.ChatID, "Question not found"))
+		return l.Err(err)
+	}
+	sort.Slice(questions, func(i, j int) bool { return questions[i].ID < questions[j].ID })
+	var text string
+	for _, q := range questions {
+		text = text + "#" + strconv.Itoa(int(q.ID)) + " " + q.Header + "\n"
+	}
+	_, err = app.Bot.Send(tg.NewMessage(user.ChatID, text))
+	return l.Err(err)
+}
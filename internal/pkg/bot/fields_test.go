@@ -0,0 +1,89 @@
+package bot
+
+import (
+	"telegram-bot-feedback/internal/pkg/database"
+	"testing"
+)
+
+func TestFieldParse(t *testing.T) {
+	enum := Field{Name: "priority", Type: FieldEnum, Values: []string{"Low", "High"}}
+	tests := []struct {
+		field  Field
+		value  string
+		want   string
+		number float64
+		fails  bool
+	}{
+		{Field{Name: "order", Type: FieldNumber}, " 12.50 ", "12.5", 12.5, false},
+		{Field{Name: "order", Type: FieldNumber}, "-3", "-3", -3, false},
+		{Field{Name: "order", Type: FieldNumber}, "12a", "", 0, true},
+		{enum, "high", "High", 0, false},
+		{enum, "urgent", "", 0, true},
+		{Field{Name: "note", Type: FieldString}, "  text  ", "text", 0, false},
+		{Field{Name: "note"}, "untyped", "untyped", 0, false},
+		{Field{Name: "note"}, "   ", "", 0, true},
+		{Field{Name: "date", Type: "date"}, "2024-01-01", "", 0, true},
+	}
+	for _, test := range tests {
+		value, number, err := test.field.parse(test.value)
+		if (err != nil) != test.fails || value != test.want || number != test.number {
+			t.Errorf("%s(%q) = %q, %v, %v", test.field.Name, test.value, value, number, err)
+		}
+	}
+}
+
+// answeredQuestion returns the Question of user 1 taken by employee 2
+func answeredQuestion(t *testing.T, app *App) *database.Question {
+	user, err := database.AddUser(1, "user1", SQuestionDiscussion, app.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	question, err := database.AddQuestion("crash", 5, user, app.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.ChangeQuestionAnswerer(int(database.GetUserByChatID(2, app.DB).ID), question, app.DB); err != nil {
+		t.Fatal(err)
+	}
+	return question
+}
+
+func TestFieldsAddedLater(t *testing.T) {
+	app, api := newTestApp(t)
+	app.Conf.Set("fields", []map[string]interface{}{{"name": "order", "type": "number"}})
+	question := answeredQuestion(t, app)
+	parseMessage(commandMessage(2, "/set order 42"), app)
+	if got := lastSent(api, 2); got != "order = 42" {
+		t.Fatalf("/set = %q", got)
+	}
+	parseMessage(commandMessage(2, "/set order many"), app)
+	if got := lastSent(api, 2); got != `"order" must be a number` {
+		t.Fatalf("/set of a wrong value = %q", got)
+	}
+
+	// A required field added to the configuration later is missing on the old Question
+	app.Conf.Set("fields", []map[string]interface{}{
+		{"name": "order", "type": "number"},
+		{"name": "priority", "type": "enum", "values": []string{"low", "high"}, "required": true},
+	})
+	if got := fieldsText(question, app); got != "order: 42\npriority: ❗required" {
+		t.Fatalf("fields = %q", got)
+	}
+	parseMessage(commandMessage(2, "/set Priority HIGH"), app)
+	if got := fieldsText(question, app); got != "order: 42\npriority: high" {
+		t.Fatalf("fields = %q", got)
+	}
+
+	// A removed field is hidden, its value is kept
+	app.Conf.Set("fields", []map[string]interface{}{{"name": "priority", "type": "enum", "values": []string{"low", "high"}}})
+	if got := fieldsText(question, app); got != "priority: high" {
+		t.Fatalf("fields = %q", got)
+	}
+	if len(database.GetQuestionFields(question, app.DB)) != 2 {
+		t.Fatal("the value of the removed field is lost")
+	}
+	parseMessage(commandMessage(2, "/set order 1"), app)
+	if got := lastSent(api, 2); got != `Unknown field "order"` {
+		t.Fatalf("/set of a removed field = %q", got)
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !windows
+
+package bot
+
+import "golang.org/x/sys/unix"
+
+// freeSpace returns the free disk space in bytes available in the directory
+func freeSpace(dir string) (uint64, error) {
+	var stat unix.Statfs_t
+	if err := unix.Statfs(dir, &stat); err != nil {
+		return 0, err
+	}
+	return stat.Bavail * uint64(stat.Bsize), nil
+}
@@ -0,0 +1,104 @@
+package bot
+
+import (
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	l "telegram-bot-feedback/internal/pkg/logger"
+	"telegram-bot-feedback/internal/pkg/metrics"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+	"time"
+)
+
+// groupMode reports whether questions are collected in groups, "group_mode" in the configuration
+func groupMode(app *App) bool {
+	return app.Conf.GetBool("group_mode")
+}
+
+// parseGroupMessage turns a group message addressed to the bot into a Question
+//
+// Only messages mentioning the bot or replying to it are read, everything else in the group is ignored.
+// The user has to start the private chat first because answers are delivered there
+func parseGroupMessage(message *tg.Message, app *App) error {
+	if !groupMode(app) || message.Chat.IsChannel() {
+		return nil
+	}
+	refreshBotUsername(message, app)
+	if !addressedToBot(message, app.Bot.Self) {
+		return nil
+	}
+	user := database.GetUserByChatID(message.From.ID, app.DB)
+	if user != nil && user.IsEmployee {
+		return nil
+	}
+	if limit := app.Conf.GetInt("rate_limit"); limit > 0 && !app.messages.allow(message.From.ID, limit, time.Minute) {
+		return nil
+	}
+	if user == nil {
+		return l.Err(replyInGroup(message, translate(message.From.LanguageCode, MsgGroupStart, app.Bot.Self.UserName), app))
+	}
+	if database.GetOpenQuestionByUser(user, app.DB) != nil {
+		return l.Err(replyInGroup(message, translate(user.LanguageCode, MsgGroupOpenQuestion, app.Bot.Self.UserName), app))
+	}
+	question, err := database.AddQuestion(questionHeader(message), 0, user, app.DB)
+	if err != nil {
+		return l.Err(err)
+	}
+	metrics.Submissions.Inc("question")
+	app.emit(Event{Type: EventQuestionOpened, Question: question})
+	delivered := sendNewQuestion(question, message, app)
+	notifyQuestion(delivered, question, user, app)
+	err = database.ChangeUserState(SQuestionDiscussion, user, app.DB)
+	if err != nil {
+		return l.Err(err)
+	}
+	err = replyInGroup(message, translate(user.LanguageCode, MsgGroupThanks, ticketNumber(question), app.Bot.Self.UserName), app)
+	if err != nil {
+		return l.Err(err)
+	}
+	return l.Err(responser(user, app))
+}
+
+// addressedToBot reports whether the message mentions the bot anywhere in the text or caption
+// or replies to a message of the bot
+//
+// Replies to the service message that created a forum topic don't count, every message of a topic replies to it
+func addressedToBot(message *tg.Message, bot tg.User) bool {
+	if reply := message.ReplyToMessage; reply != nil && reply.ForumTopicCreated == nil && reply.From != nil && reply.From.ID == bot.ID {
+		return true
+	}
+	for _, mention := range message.Mentions() {
+		if bot.UserName != "" && strings.EqualFold(mention, "@"+bot.UserName) {
+			return true
+		}
+	}
+	for _, entity := range append(append([]*tg.MessageEntity{}, message.Entities...), message.CaptionEntities...) {
+		if entity.IsTextMention() && entity.User != nil && entity.User.ID == bot.ID {
+			return true
+		}
+	}
+	return false
+}
+
+// refreshBotUsername updates the cached username of the bot when a replied message of the bot shows a new one
+func refreshBotUsername(message *tg.Message, app *App) {
+	reply := message.ReplyToMessage
+	if reply == nil || reply.From == nil || reply.From.ID != app.Bot.Self.ID || reply.From.UserName == "" {
+		return
+	}
+	if reply.From.UserName != app.Bot.Self.UserName {
+		l.Info(l.NewError("Bot username changed from @" + app.Bot.Self.UserName + " to @" + reply.From.UserName))
+		app.Bot.Self.UserName = reply.From.UserName
+	}
+}
+
+// replyInGroup replies to the group message, in its topic if the group is a forum
+func replyInGroup(message *tg.Message, text string, app *App) error {
+	reply := tg.NewMessage(message.Chat.ID, text)
+	reply.ReplyToMessageID = message.MessageID
+	reply.AllowSendingWithoutReply = true
+	if message.IsTopicMessage {
+		reply.MessageThreadID = message.MessageThreadID
+	}
+	_, err := app.Bot.Send(reply)
+	return l.Err(err)
+}
@@ -0,0 +1,170 @@
+package bot
+
+import (
+	"fmt"
+	"telegram-bot-feedback/internal/pkg/database"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+	"testing"
+)
+
+// communityGroup is the group where the bot collects questions in group mode tests
+const communityGroup = -1001111111111
+
+// groupMessage returns the message of the user in the community group
+func groupMessage(chatID, messageID int, text string, entities ...*tg.MessageEntity) *tg.Message {
+	message := privateMessage(chatID, messageID, text)
+	message.Chat = &tg.Chat{ID: communityGroup, Type: "supergroup", Title: "Community"}
+	message.Entities = entities
+	return message
+}
+
+// groupModeApp returns the App in group mode with user 5 who started the private chat
+func groupModeApp(t *testing.T) (*App, *testAPI) {
+	app, api := newTestApp(t)
+	app.Conf.Set("group_mode", true)
+	if _, err := database.AddUser(5, "user5", SMain, app.DB); err != nil {
+		t.Fatal(err)
+	}
+	return app, api
+}
+
+// groupReplies returns the messages sent to the community group
+func groupReplies(api *testAPI) []apiCall {
+	var replies []apiCall
+	for _, call := range api.requests("sendMessage") {
+		if call.chatID() == communityGroup {
+			replies = append(replies, call)
+		}
+	}
+	return replies
+}
+
+func TestAddressedToBot(t *testing.T) {
+	bot := tg.User{ID: 1, IsBot: true, UserName: "feedback_bot"}
+	mention := func(offset, length int) *tg.MessageEntity {
+		return &tg.MessageEntity{Type: "mention", Offset: offset, Length: length}
+	}
+	fromBot := &tg.Message{MessageID: 3, From: &bot}
+	tests := []struct {
+		name    string
+		message *tg.Message
+		want    bool
+	}{
+		{"mention after emoji", groupMessage(5, 1, "hi 👋 @feedback_bot the app crashes", mention(6, 13)), true},
+		{"mention in another case", groupMessage(5, 1, "😀😀 please, @Feedback_Bot!", mention(13, 13)), true},
+		{"another bot", groupMessage(5, 1, "hi @other_bot", mention(3, 10)), false},
+		{"username without an entity", groupMessage(5, 1, "hi @feedback_bot"), false},
+		{"entity offset off by the emoji", groupMessage(5, 1, "hi 👋 @feedback_bot", mention(5, 13)), false},
+		{"text mention", groupMessage(5, 1, "hi Feedback", &tg.MessageEntity{Type: "text_mention", Offset: 3, Length: 8, User: &bot}), true},
+		{"reply to the bot", func() *tg.Message {
+			m := groupMessage(5, 1, "it crashes")
+			m.ReplyToMessage = fromBot
+			return m
+		}(), true},
+		{"reply to the topic of the bot", func() *tg.Message {
+			m := groupMessage(5, 1, "it crashes")
+			m.ReplyToMessage = &tg.Message{MessageID: 3, From: &bot, ForumTopicCreated: &tg.ForumTopicCreated{Name: "Support"}}
+			return m
+		}(), false},
+		{"caption mention", func() *tg.Message {
+			m := groupMessage(5, 1, "")
+			m.Caption = "see @feedback_bot"
+			m.CaptionEntities = []*tg.MessageEntity{mention(4, 13)}
+			return m
+		}(), true},
+		{"plain message", groupMessage(5, 1, "hello everyone"), false},
+	}
+	for _, tt := range tests {
+		if got := addressedToBot(tt.message, bot); got != tt.want {
+			t.Errorf("%s: addressedToBot = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+	if addressedToBot(groupMessage(5, 1, "@", mention(0, 1)), tg.User{ID: 1}) {
+		t.Error("a bot without a username is mentioned by @")
+	}
+}
+
+func TestGroupMentionOpensQuestion(t *testing.T) {
+	app, api := groupModeApp(t)
+	message := groupMessage(5, 40, "hi 👋 @feedback_bot the app crashes", &tg.MessageEntity{Type: "mention", Offset: 6, Length: 13})
+	message.IsTopicMessage, message.MessageThreadID = true, 8
+	parseMessage(message, app)
+
+	user := database.GetUserByChatID(5, app.DB)
+	question := database.GetOpenQuestionByUser(user, app.DB)
+	if question == nil || user.State != SQuestionDiscussion {
+		t.Fatalf("question = %+v, state = %d", question, user.State)
+	}
+	replies := groupReplies(api)
+	want := fmt.Sprintf("Thank you, your ticket %s was sent to the team. The answer will come in private messages from @feedback_bot", ticketNumber(question))
+	if len(replies) != 1 || replies[0].text() != want {
+		t.Fatalf("group replies = %+v", replies)
+	}
+	if replies[0].Params["reply_to_message_id"] != float64(40) || replies[0].Params["message_thread_id"] != float64(8) {
+		t.Fatalf("reply = %+v, want it in the topic under the message", replies[0].Params)
+	}
+	if lastSent(api, 2) == "" {
+		t.Fatal("the question is not sent to the admin")
+	}
+
+	parseMessage(groupMessage(5, 41, "@feedback_bot one more", &tg.MessageEntity{Type: "mention", Offset: 0, Length: 13}), app)
+	if replies := groupReplies(api); len(replies) != 2 || replies[1].text() != "You already have an open question, continue it in private messages with @feedback_bot" {
+		t.Fatalf("second mention = %+v", replies)
+	}
+	if replies := groupReplies(api); replies[1].Params["message_thread_id"] != nil {
+		t.Fatalf("a reply outside a topic has a thread: %+v", replies[1].Params)
+	}
+}
+
+func TestGroupIgnoresOtherMessages(t *testing.T) {
+	app, api := groupModeApp(t)
+	parseMessage(groupMessage(5, 40, "hello everyone"), app)
+	parseMessage(groupMessage(5, 41, "ask @other_bot", &tg.MessageEntity{Type: "mention", Offset: 4, Length: 10}), app)
+	if calls := api.requests(); len(calls) != 0 {
+		t.Fatalf("requests = %+v", calls)
+	}
+
+	app.Conf.Set("group_mode", false)
+	parseMessage(groupMessage(5, 42, "@feedback_bot hi", &tg.MessageEntity{Type: "mention", Offset: 0, Length: 13}), app)
+	if calls := api.requests(); len(calls) != 0 {
+		t.Fatalf("requests without group mode = %+v", calls)
+	}
+
+	app.Conf.Set("group_mode", true)
+	post := &tg.Message{MessageID: 43, Chat: &tg.Chat{ID: communityGroup, Type: "channel"}, Text: "@feedback_bot hi",
+		Entities: []*tg.MessageEntity{{Type: "mention", Offset: 0, Length: 13}}}
+	if err := parseUpdate(&tg.Update{UpdateID: 1, ChannelPost: post}, app); err != nil {
+		t.Fatal(err)
+	}
+	if calls := api.requests(); len(calls) != 0 {
+		t.Fatalf("requests for a channel post = %+v", calls)
+	}
+}
+
+func TestGroupAsksUnknownUserToStart(t *testing.T) {
+	app, api := groupModeApp(t)
+	parseMessage(groupMessage(9, 40, "@feedback_bot hi", &tg.MessageEntity{Type: "mention", Offset: 0, Length: 13}), app)
+	if replies := groupReplies(api); len(replies) != 1 || replies[0].text() != "Please start a private chat with @feedback_bot first, answers are sent there" {
+		t.Fatalf("replies = %+v", replies)
+	}
+	if database.GetUserByChatID(9, app.DB) != nil {
+		t.Fatal("the user is added from the group")
+	}
+}
+
+func TestGroupFollowsBotUsernameChange(t *testing.T) {
+	app, api := groupModeApp(t)
+	t.Cleanup(func() { app.Bot.Self.UserName = "feedback_bot" })
+	message := groupMessage(5, 40, "thanks")
+	message.ReplyToMessage = &tg.Message{MessageID: 3, From: &tg.User{ID: app.Bot.Self.ID, IsBot: true, UserName: "support_bot"}}
+	parseMessage(message, app)
+	if app.Bot.Self.UserName != "support_bot" {
+		t.Fatalf("username = %q, want the new one", app.Bot.Self.UserName)
+	}
+	if replies := groupReplies(api); len(replies) != 1 || replies[0].text()[len(replies[0].text())-len("@support_bot"):] != "@support_bot" {
+		t.Fatalf("replies = %+v, want the new username", replies)
+	}
+	if addressedToBot(groupMessage(5, 41, "@feedback_bot hi", &tg.MessageEntity{Type: "mention", Offset: 0, Length: 13}), app.Bot.Self) {
+		t.Fatal("the old username still addresses the bot")
+	}
+}
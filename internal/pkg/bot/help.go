@@ -0,0 +1,121 @@
+package bot
+
+import (
+	"strconv"
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	l "telegram-bot-feedback/internal/pkg/logger"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+)
+
+// helpLinesPerPage is the number of lines after which /help continues on the next page
+//
+// Groups are not split between pages
+const helpLinesPerPage = 20
+
+// helpStartPayload is the /start payload of the deep link that opens /help in the private chat
+const helpStartPayload = "help"
+
+// helpPages returns the /help text of the user grouped by command group and split into pages
+func helpPages(user *database.User, app *App) []string {
+	byGroup := map[string][]string{}
+	for _, spec := range visibleCommands(user, app) {
+		line := "/" + spec.Name
+		if spec.Args != "" {
+			line += " " + spec.Args
+		}
+		byGroup[spec.Group] = append(byGroup[spec.Group], line+" - "+spec.description(user.LanguageCode))
+	}
+	var pages []string
+	var page []string
+	for _, group := range commandGroups {
+		lines := byGroup[group]
+		if len(lines) == 0 {
+			continue
+		}
+		if len(page) > 0 && len(page)+len(lines)+1 > helpLinesPerPage {
+			pages = append(pages, strings.Join(page, "\n"))
+			page = nil
+		}
+		if len(page) > 0 {
+			page = append(page, "")
+		}
+		page = append(page, translate(user.LanguageCode, "group_"+group))
+		page = append(page, lines...)
+	}
+	if len(page) > 0 {
+		pages = append(pages, strings.Join(page, "\n"))
+	}
+	return pages
+}
+
+// helpKeyboard returns the previous and next buttons of the /help page
+func helpKeyboard(page, pages int) *tg.InlineKeyboardMarkup {
+	if pages < 2 {
+		return nil
+	}
+	var navigation []tg.InlineKeyboardButton
+	if page > 0 {
+		navigation = append(navigation, tg.NewInlineKeyboardButtonData("◀️", strconv.Itoa(CBHelpPage)+"-"+strconv.Itoa(page-1)))
+	}
+	navigation = append(navigation, tg.NewInlineKeyboardButtonData(strconv.Itoa(page+1)+"/"+strconv.Itoa(pages), strconv.Itoa(CBHelpPage)+"-"+strconv.Itoa(page)))
+	if page < pages-1 {
+		navigation = append(navigation, tg.NewInlineKeyboardButtonData("▶️", strconv.Itoa(CBHelpPage)+"-"+strconv.Itoa(page+1)))
+	}
+	keyboard := tg.NewInlineKeyboardMarkup(navigation)
+	return &keyboard
+}
+
+// sendHelp sends the first page of /help
+func sendHelp(user *database.User, app *App) error {
+	pages := helpPages(user, app)
+	if len(pages) == 0 {
+		return nil
+	}
+	message := tg.NewMessage(user.ChatID, pages[0])
+	if keyboard := helpKeyboard(0, len(pages)); keyboard != nil {
+		message.ReplyMarkup = keyboard
+	}
+	_, err := app.Bot.Send(message)
+	return l.Err(err)
+}
+
+// turnHelpPage shows another page of /help
+func turnHelpPage(data string, user *database.User, callback *tg.CallbackQuery, app *App) error {
+	page, err := strconv.Atoi(data)
+	if err != nil {
+		return l.Err(l.NewError("no page"))
+	}
+	_, err = app.Bot.Request(tg.NewCallback(callback.ID, ""))
+	if err != nil {
+		return l.Err(err)
+	}
+	pages := helpPages(user, app)
+	if page < 0 || page >= len(pages) {
+		return nil
+	}
+	edit := tg.NewEditMessageText(callback.Message.Chat.ID, callback.Message.MessageID, pages[page])
+	edit.ReplyMarkup = helpKeyboard(page, len(pages))
+	_, err = app.Bot.Send(edit)
+	if tg.IsMessageNotModified(err) {
+		return nil
+	}
+	return l.Err(err)
+}
+
+// helpInGroup answers /help in a group with a link to /help in the private chat
+func helpInGroup(message *tg.Message, app *App) error {
+	if _, bot, found := strings.Cut(message.CommandWithAt(), "@"); found && !strings.EqualFold(bot, app.Bot.Self.UserName) {
+		return nil
+	}
+	reply := tg.NewMessage(message.Chat.ID, translate(message.From.LanguageCode, MsgHelpInPrivate))
+	reply.ReplyToMessageID = message.MessageID
+	reply.AllowSendingWithoutReply = true
+	if message.IsTopicMessage {
+		reply.MessageThreadID = message.MessageThreadID
+	}
+	link := "https://t.me/" + app.Bot.Self.UserName + "?start=" + helpStartPayload
+	reply.ReplyMarkup = tg.NewInlineKeyboardMarkup(tg.NewInlineKeyboardRow(tg.NewInlineKeyboardButtonURL("/help", link)))
+	_, err := app.Bot.Send(reply)
+	return l.Err(err)
+}
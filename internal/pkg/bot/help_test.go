@@ -0,0 +1,213 @@
+package bot
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+	"testing"
+)
+
+// helpCommands returns the commands and descriptions listed in the /help pages
+func helpCommands(pages []string) [][2]string {
+	var commands [][2]string
+	for _, page := range pages {
+		for _, line := range strings.Split(page, "\n") {
+			if !strings.HasPrefix(line, "/") {
+				continue
+			}
+			usage, description, _ := strings.Cut(line, " - ")
+			name, _, _ := strings.Cut(usage[1:], " ")
+			commands = append(commands, [2]string{name, description})
+		}
+	}
+	return commands
+}
+
+// menuCommands returns the commands and descriptions of the setMyCommands request
+func menuCommands(call apiCall) [][2]string {
+	var commands [][2]string
+	list, _ := call.Params["commands"].([]interface{})
+	for _, item := range list {
+		command := item.(map[string]interface{})
+		commands = append(commands, [2]string{command["command"].(string), command["description"].(string)})
+	}
+	return commands
+}
+
+// helpMenu returns the setMyCommands request of the scope and the language
+func helpMenu(t *testing.T, api *testAPI, scope, language string) apiCall {
+	t.Helper()
+	for _, call := range api.requests("setMyCommands") {
+		s, _ := call.Params["scope"].(map[string]interface{})
+		code, _ := call.Params["language_code"].(string)
+		if s["type"] == scope && code == language {
+			return call
+		}
+	}
+	t.Fatalf("no command menu for %s %q", scope, language)
+	return apiCall{}
+}
+
+// mainState lets admin 2 run commands
+func mainState(t *testing.T, app *App) {
+	if err := database.ChangeUserState(SMain, database.GetUserByChatID(2, app.DB), app.DB); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHelpMatchesCommandMenu(t *testing.T) {
+	app, api := newTestApp(t)
+	enablePlugins(app, "donations")
+	registerCommands(app)
+
+	for language := range catalog {
+		user := &database.User{LanguageCode: language}
+		code := language
+		if language == defaultLanguage {
+			code = ""
+		}
+		help := helpCommands(helpPages(user, app))
+		if menu := menuCommands(helpMenu(t, api, "all_private_chats", code)); !reflect.DeepEqual(help, menu) {
+			t.Errorf("%s: /help %v\nmenu %v", language, help, menu)
+		}
+		for _, command := range help {
+			if command[1] == "" {
+				t.Errorf("%s: /%s has no description", language, command[0])
+			}
+		}
+	}
+
+	admin := database.GetUserByChatID(2, app.DB)
+	menu := helpMenu(t, api, "chat", "")
+	help := helpCommands(helpPages(admin, app))
+	if !reflect.DeepEqual(help, menuCommands(menu)) || menu.Params["scope"].(map[string]interface{})["chat_id"] != float64(2) {
+		t.Fatalf("admin /help %v\nmenu %+v", help, menu.Params)
+	}
+}
+
+func TestHelpFollowsAudienceAndPermissions(t *testing.T) {
+	app, _ := newTestApp(t)
+	names := func(user *database.User) map[string]bool {
+		set := map[string]bool{}
+		for _, command := range helpCommands(helpPages(user, app)) {
+			set[command[0]] = true
+		}
+		return set
+	}
+	user := names(&database.User{})
+	if !user["mytickets"] || !user["help"] || user["stats"] || user["ban"] || user["donate"] {
+		t.Fatalf("user commands = %v", user)
+	}
+	admin := names(database.GetUserByChatID(2, app.DB))
+	if !admin["ban"] || !admin["export"] || !admin["stats"] || admin["mytickets"] {
+		t.Fatalf("admin commands = %v", admin)
+	}
+	restricted := names(operator(t, app, PermBroadcastSegment))
+	if !restricted["broadcast"] || !restricted["stats"] || restricted["ban"] || restricted["export"] || restricted["segment"] {
+		t.Fatalf("operator commands = %v", restricted)
+	}
+}
+
+func TestHelpIsTranslated(t *testing.T) {
+	app, api := newTestApp(t)
+	if _, err := database.AddUser(1, "user1", SMain, app.DB); err != nil {
+		t.Fatal(err)
+	}
+	message := commandMessage(1, "/help")
+	message.From.LanguageCode = "ru"
+	parseUpdate(&tg.Update{Message: message}, app)
+	got := lastSent(api, 1)
+	if !strings.HasPrefix(got, translate("ru", "group_"+GroupGeneral)+"\n") || !strings.Contains(got, "/help - Список команд") {
+		t.Fatalf("/help = %q", got)
+	}
+}
+
+func TestHelpPages(t *testing.T) {
+	app, api := newTestApp(t)
+	mainState(t, app)
+	admin := database.GetUserByChatID(2, app.DB)
+	pages := helpPages(admin, app)
+	if len(pages) < 2 {
+		t.Fatalf("%d pages of admin /help", len(pages))
+	}
+	seen := map[string]bool{}
+	for _, page := range pages {
+		lines := strings.Split(page, "\n")
+		if len(lines) > helpLinesPerPage && strings.Count(page, "\n\n") > 0 {
+			t.Errorf("page of %d lines with several groups", len(lines))
+		}
+		for _, line := range lines {
+			if line != "" && !strings.HasPrefix(line, "/") {
+				if seen[line] {
+					t.Errorf("group %q is split between pages", line)
+				}
+				seen[line] = true
+			}
+		}
+	}
+
+	parseMessage(commandMessage(2, "/help"), app)
+	messages := api.requests("sendMessage")
+	sent := messages[len(messages)-1]
+	if sent.text() != pages[0] || sent.Params["reply_markup"] == nil {
+		t.Fatalf("/help = %+v", sent.Params)
+	}
+	callback := &tg.CallbackQuery{ID: "help", From: &tg.User{ID: 2}, Message: &tg.Message{MessageID: 30, Chat: &tg.Chat{ID: 2, Type: "private"}},
+		Data: fmt.Sprintf("%d-1", CBHelpPage)}
+	if err := parseCallback(callback, app); err != nil {
+		t.Fatal(err)
+	}
+	edits := api.requests("editMessageText")
+	if len(edits) != 1 || edits[0].text() != pages[1] || edits[0].Params["message_id"] != float64(30) {
+		t.Fatalf("edits = %+v", edits)
+	}
+	keyboard := edits[0].Params["reply_markup"].(map[string]interface{})["inline_keyboard"].([]interface{})[0].([]interface{})
+	if first := keyboard[0].(map[string]interface{}); first["text"] != "◀️" || first["callback_data"] != fmt.Sprintf("%d-0", CBHelpPage) {
+		t.Fatalf("keyboard = %v", keyboard)
+	}
+
+	callback.Data = fmt.Sprintf("%d-99", CBHelpPage)
+	if err := parseCallback(callback, app); err != nil || len(api.requests("editMessageText")) != 1 {
+		t.Fatalf("page out of range: %v", err)
+	}
+	if keyboard := helpKeyboard(0, 1); keyboard != nil {
+		t.Fatalf("keyboard of a single page = %+v", keyboard)
+	}
+}
+
+func TestHelpInGroupLinksToPrivateChat(t *testing.T) {
+	app, api := newTestApp(t)
+	message := groupMessage(5, 40, "/help@feedback_bot", &tg.MessageEntity{Type: "bot_command", Offset: 0, Length: 18})
+	message.IsTopicMessage, message.MessageThreadID = true, 8
+	parseMessage(message, app)
+	replies := groupReplies(api)
+	if len(replies) != 1 || replies[0].text() != "The list of commands is in the private chat" {
+		t.Fatalf("replies = %+v", replies)
+	}
+	params := replies[0].Params
+	button := params["reply_markup"].(map[string]interface{})["inline_keyboard"].([]interface{})[0].([]interface{})[0].(map[string]interface{})
+	if button["url"] != "https://t.me/feedback_bot?start=help" || params["reply_to_message_id"] != float64(40) || params["message_thread_id"] != float64(8) {
+		t.Fatalf("reply = %+v", params)
+	}
+	if strings.Contains(replies[0].text(), "/mytickets") {
+		t.Fatal("the commands are listed in the group")
+	}
+
+	parseMessage(groupMessage(5, 41, "/help@other_bot", &tg.MessageEntity{Type: "bot_command", Offset: 0, Length: 15}), app)
+	if len(groupReplies(api)) != 1 {
+		t.Fatal("/help of another bot is answered")
+	}
+}
+
+func TestStartHelpPayloadSendsHelp(t *testing.T) {
+	app, api := newTestApp(t)
+	if _, err := database.AddUser(1, "user1", SMain, app.DB); err != nil {
+		t.Fatal(err)
+	}
+	parseMessage(commandMessage(1, "/start help"), app)
+	if got := lastSent(api, 1); got != helpPages(database.GetUserByChatID(1, app.DB), app)[0] {
+		t.Fatalf("last message = %q, want /help", got)
+	}
+}
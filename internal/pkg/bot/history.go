@@ -0,0 +1,95 @@
+package bot
+
+import (
+	"strconv"
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	l "telegram-bot-feedback/internal/pkg/logger"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+	"time"
+)
+
+// historyTimeLayout is the timestamp format of the transcript
+const historyTimeLayout = "2006-01-02 15:04"
+
+// parseHistoryArgs parses "[limit] [from] [to]" after the user
+func parseHistoryArgs(args []string) (database.DialogOptions, error) {
+	opts := database.DialogOptions{}
+	var dates []time.Time
+	for _, arg := range args {
+		if limit, err := strconv.Atoi(arg); err == nil && limit > 0 {
+			opts.Limit = limit
+			continue
+		}
+		date, err := time.Parse(exportDateLayout, arg)
+		if err != nil {
+			return opts, l.NewError("Format: /history <user_id|reply> [limit] [from] [to], dates in the format YYYY-MM-DD")
+		}
+		dates = append(dates, date)
+	}
+	switch len(dates) {
+	case 0:
+	case 1:
+		opts.From = dates[0]
+	case 2:
+		opts.From = dates[0]
+		opts.To = dates[1].Add(24 * time.Hour)
+	default:
+		return opts, l.NewError("Format: /history <user_id|reply> [limit] [from] [to]")
+	}
+	return opts, nil
+}
+
+// sendHistory sends the transcript of the dialog with the user
+//
+// Format: /history <user_id|reply> [limit] [from] [to]
+func sendHistory(message *tg.Message, user *database.User, app *App) error {
+	args := strings.Fields(message.CommandArguments())
+	target := linkedUser(message, app)
+	if target == nil && len(args) > 0 {
+		if chatId, err := strconv.Atoi(args[0]); err == nil {
+			target = database.GetUserByChatID(chatId, app.DB)
+			args = args[1:]
+		}
+	}
+	if target == nil {
+		_, err := app.Bot.Send(tg.NewMessage(user.ChatID, "Reply to a forwarded user message or enter the user ID\n/history <user_id> [limit] [from] [to]"))
+		return l.Err(err)
+	}
+	opts, err := parseHistoryArgs(args)
+	if err != nil {
+		_, err := app.Bot.Send(tg.NewMessage(user.ChatID, err.Error()))
+		return l.Err(err)
+	}
+	transcript := renderTranscript(database.ListDialog(int(target.ID), opts, app.DB))
+	if transcript == "" {
+		_, err := app.Bot.Send(tg.NewMessage(user.ChatID, "No messages"))
+		return l.Err(err)
+	}
+	title := "History of " + displayName(target, app)
+	if tg.UTF16Len(title)+1+tg.UTF16Len(transcript) <= tg.MaxMessageLength {
+		_, err := app.Bot.Send(tg.NewMessage(user.ChatID, title+"\n"+transcript))
+		return l.Err(err)
+	}
+	document := tg.NewDocument(user.ChatID, tg.FileBytes{Name: "history-" + strconv.Itoa(target.ChatID) + ".txt", Bytes: []byte(transcript)})
+	document.Caption = title
+	_, err = app.Bot.Send(&document)
+	return l.Err(err)
+}
+
+// renderTranscript returns the dialog lines "[time] #question User|Employee: text"
+func renderTranscript(messages []database.DialogMessage) string {
+	var b strings.Builder
+	for _, m := range messages {
+		direction := "User"
+		if m.FromEmployee {
+			direction = "Employee"
+		}
+		text := m.Text
+		if text == "" {
+			text = "[message]"
+		}
+		b.WriteString("[" + m.Time.Format(historyTimeLayout) + "] #" + strconv.Itoa(m.QuestionID) + " " + direction + ": " + text + "\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,83 @@
+package bot
+
+import (
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	"testing"
+)
+
+// addDialog adds the answers to the Question, even ones are from the employee
+func addDialog(t *testing.T, app *App, question *database.Question, texts ...string) {
+	user := database.GetUserByChatID(1, app.DB)
+	employee := database.GetUserByChatID(2, app.DB)
+	for i, text := range texts {
+		from := user
+		if i%2 == 0 {
+			from = employee
+		}
+		if _, err := database.AddCorrespondenceToQuestion(question, from, 10+i, text, app.DB); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestHistoryIsSentInline(t *testing.T) {
+	app, api := newTestApp(t)
+	question := answeredQuestion(t, app)
+	addDialog(t, app, question, "restart it", "thanks")
+	parseMessage(commandMessage(2, "/history 1"), app)
+	lines := strings.Split(strings.TrimSuffix(lastSent(api, 2), "\n"), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[0], "History of ") {
+		t.Fatalf("history = %q", lines)
+	}
+	want := []string{"#1 User: crash", "#1 Employee: restart it", "#1 User: thanks"}
+	for i, suffix := range want {
+		if !strings.HasPrefix(lines[i+1], "[") || !strings.HasSuffix(lines[i+1], "] "+suffix) {
+			t.Fatalf("line %d = %q, want %q", i+1, lines[i+1], suffix)
+		}
+	}
+
+	parseMessage(commandMessage(2, "/history 1 1"), app)
+	if got := lastSent(api, 2); strings.Count(got, "\n") != 2 || !strings.HasSuffix(got, "#1 User: thanks\n") {
+		t.Fatalf("the last message = %q", got)
+	}
+	if len(api.requests("sendDocument")) != 0 {
+		t.Fatal("the short history is sent as a document")
+	}
+}
+
+func TestLongHistoryIsSentAsDocument(t *testing.T) {
+	app, api := newTestApp(t)
+	question := answeredQuestion(t, app)
+	long := strings.Repeat("a", 1000)
+	addDialog(t, app, question, long, long, long, long, long)
+	parseMessage(commandMessage(2, "/history 1"), app)
+	documents := api.requests("sendDocument")
+	if len(documents) != 1 || documents[0].chatID() != 2 {
+		t.Fatalf("documents = %+v", documents)
+	}
+	transcript, _ := documents[0].Params["document"].(string)
+	if strings.Count(transcript, "\n") != 6 || strings.Count(transcript, "Employee: "+long) != 3 {
+		t.Fatalf("transcript = %q", transcript)
+	}
+	if caption, _ := documents[0].Params["caption"].(string); !strings.HasPrefix(caption, "History of ") {
+		t.Fatalf("caption = %q", caption)
+	}
+}
+
+func TestHistoryArguments(t *testing.T) {
+	app, api := newTestApp(t)
+	answeredQuestion(t, app)
+	parseMessage(commandMessage(2, "/history"), app)
+	if got := lastSent(api, 2); !strings.HasPrefix(got, "Reply to a forwarded user message") {
+		t.Fatalf("/history without a user = %q", got)
+	}
+	parseMessage(commandMessage(2, "/history 1 yesterday"), app)
+	if got := lastSent(api, 2); !strings.HasPrefix(got, "Format: /history") {
+		t.Fatalf("/history with a wrong date = %q", got)
+	}
+	parseMessage(commandMessage(2, "/history 1 2000-01-01 2000-01-02"), app)
+	if got := lastSent(api, 2); got != "No messages" {
+		t.Fatalf("/history of other dates = %q", got)
+	}
+}
@@ -0,0 +1,182 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Message catalog keys
+const (
+	MsgReviewThanks   = "review_thanks"
+	MsgQuestionThanks = "question_thanks"
+	MsgSlowDown       = "slow_down"
+	MsgBanned         = "banned"
+	// Group mode
+	MsgGroupThanks       = "group_thanks"
+	MsgGroupStart        = "group_start"
+	MsgGroupOpenQuestion = "group_open_question"
+	MsgHelpInPrivate     = "help_in_private"
+	// Feedback form Web App
+	MsgFormButton       = "form_button"
+	MsgFormError        = "form_error"
+	MsgFormNoText       = "form_no_text"
+	MsgFormOpenQuestion = "form_open_question"
+	// Ticket tracking
+	MsgTicketsTitle     = "tickets_title"
+	MsgTicketsEmpty     = "tickets_empty"
+	MsgTicketFormat     = "ticket_format"
+	MsgTicketNotFound   = "ticket_not_found"
+	MsgTicketLastReply  = "ticket_last_reply"
+	MsgTicketNoReply    = "ticket_no_reply"
+	MsgTicketNew        = "ticket_new"
+	MsgTicketInProgress = "ticket_in_progress"
+	MsgTicketClosed     = "ticket_closed"
+)
+
+// defaultLanguage is used when the user language is not in the catalog
+const defaultLanguage = "en"
+
+// catalog is the message catalog by language code, new languages are added here
+var catalog = map[string]map[string]string{
+	"en": {
+		MsgReviewThanks:            "Thank you for your review\nYou can also leave a comment\nOr press \"❌Close\"",
+		MsgQuestionThanks:          "Your ticket %s\nThank you for your question\nAn available employee will answer you shortly",
+		MsgSlowDown:                "Please slow down, your messages are not delivered",
+		MsgBanned:                  "You are blocked, your messages are not delivered",
+		MsgGroupThanks:             "Thank you, your ticket %s was sent to the team. The answer will come in private messages from @%s",
+		MsgGroupStart:              "Please start a private chat with @%s first, answers are sent there",
+		MsgGroupOpenQuestion:       "You already have an open question, continue it in private messages with @%s",
+		MsgHelpInPrivate:           "The list of commands is in the private chat",
+		MsgFormButton:              "📝Feedback form",
+		MsgFormError:               "Sorry, we couldn't read the form. Please fill it in again",
+		MsgFormNoText:              "Please describe your question in the form",
+		MsgFormOpenQuestion:        "You already have an open ticket %s, please continue it here",
+		MsgTicketsTitle:            "Your tickets:",
+		MsgTicketsEmpty:            "You have no tickets yet",
+		MsgTicketFormat:            "Send /ticket F-1024 to see a ticket",
+		MsgTicketNotFound:          "Ticket %s was not found",
+		MsgTicketLastReply:         "Last reply, %s:",
+		MsgTicketNoReply:           "No reply yet",
+		MsgTicketNew:               "New",
+		MsgTicketInProgress:        "In progress",
+		MsgTicketClosed:            "Closed",
+		"group_" + GroupGeneral:    "General",
+		"group_" + GroupQuestions:  "Questions",
+		"group_" + GroupBroadcasts: "Broadcasts",
+		"group_" + GroupModeration: "Moderation",
+		"group_" + GroupReports:    "Reports",
+		"group_" + GroupPlugins:    "More",
+		"cmd_start":                "Start chatting with the bot",
+		"cmd_help":                 "List of commands",
+		"cmd_settings":             "Receipts, quiet hours and time zone",
+		"cmd_mytickets":            "Your recent tickets",
+		"cmd_ticket":               "Status and last reply of a ticket",
+		"cmd_resolve":              "Resolve the taken question",
+		"cmd_set":                  "Set a field of the taken question",
+		"cmd_history":              "Last messages of a user",
+		"cmd_alias":                "Command shortcuts",
+		"cmd_addcategory":          "Add a category or change its emoji",
+		"cmd_renamecategory":       "Rename a category",
+		"cmd_removecategory":       "Remove a category",
+		"cmd_tag":                  "Tag the replied question",
+		"cmd_untag":                "Remove tags of the replied question",
+		"cmd_find":                 "Search questions by text and tags",
+		"cmd_t":                    "Answer with a template",
+		"cmd_templates":            "List reply templates",
+		"cmd_later":                "Answer after the user's quiet hours",
+		"cmd_template_add":         "Add a reply template",
+		"cmd_template_del":         "Delete a reply template",
+		"cmd_broadcast":            "Copy the replied message to users",
+		"cmd_broadcast_cancel":     "Stop the running broadcast",
+		"cmd_segment":              "Manage broadcast segments",
+		"cmd_ban":                  "Ban a user",
+		"cmd_unban":                "Remove a ban",
+		"cmd_banned":               "List banned users",
+		"cmd_stats":                "Statistics",
+		"cmd_status":               "Live bot health",
+		"cmd_satisfaction":         "Satisfaction for 30 days",
+		"cmd_export":               "Export feedback",
+		"cmd_outbox":               "Queued and failed replies",
+		"cmd_admins":               "Employees and permissions",
+		"cmd_rollout":              "Share of questions with automation features",
+		"cmd_review":               "Review answer quality",
+	},
+	"ru": {
+		MsgReviewThanks:            "Спасибо за ваш отзыв\nВы также можете оставить комментарий\nИли нажмите \"❌Close\"",
+		MsgQuestionThanks:          "Ваше обращение %s\nСпасибо за ваш вопрос\nСвободный сотрудник скоро вам ответит",
+		MsgSlowDown:                "Пожалуйста, пишите реже, ваши сообщения не доставлены",
+		MsgBanned:                  "Вы заблокированы, ваши сообщения не доставляются",
+		MsgGroupThanks:             "Спасибо, ваше обращение %s отправлено команде. Ответ придёт в личные сообщения от @%s",
+		MsgGroupStart:              "Пожалуйста, сначала начните личный чат с @%s, ответы приходят туда",
+		MsgGroupOpenQuestion:       "У вас уже есть открытый вопрос, продолжите его в личных сообщениях с @%s",
+		MsgHelpInPrivate:           "Список команд — в личном чате",
+		MsgFormButton:              "📝Форма обратной связи",
+		MsgFormError:               "Извините, не удалось прочитать форму. Пожалуйста, заполните её ещё раз",
+		MsgFormNoText:              "Пожалуйста, опишите ваш вопрос в форме",
+		MsgFormOpenQuestion:        "У вас уже есть открытое обращение %s, пожалуйста, продолжите его здесь",
+		MsgTicketsTitle:            "Ваши обращения:",
+		MsgTicketsEmpty:            "У вас пока нет обращений",
+		MsgTicketFormat:            "Отправьте /ticket F-1024, чтобы открыть обращение",
+		MsgTicketNotFound:          "Обращение %s не найдено",
+		MsgTicketLastReply:         "Последний ответ, %s:",
+		MsgTicketNoReply:           "Ответа пока нет",
+		MsgTicketNew:               "Новое",
+		MsgTicketInProgress:        "В работе",
+		MsgTicketClosed:            "Закрыто",
+		"group_" + GroupGeneral:    "Общее",
+		"group_" + GroupQuestions:  "Вопросы",
+		"group_" + GroupBroadcasts: "Рассылки",
+		"group_" + GroupModeration: "Модерация",
+		"group_" + GroupReports:    "Отчёты",
+		"group_" + GroupPlugins:    "Ещё",
+		"cmd_start":                "Начать общение с ботом",
+		"cmd_help":                 "Список команд",
+		"cmd_settings":             "Уведомления о получении, тихие часы и часовой пояс",
+		"cmd_mytickets":            "Ваши последние обращения",
+		"cmd_ticket":               "Статус и последний ответ по обращению",
+		"cmd_resolve":              "Решить взятый вопрос",
+		"cmd_set":                  "Заполнить поле взятого вопроса",
+		"cmd_history":              "Последние сообщения пользователя",
+		"cmd_alias":                "Сокращения команд",
+		"cmd_addcategory":          "Добавить категорию или сменить её эмодзи",
+		"cmd_renamecategory":       "Переименовать категорию",
+		"cmd_removecategory":       "Удалить категорию",
+		"cmd_tag":                  "Добавить теги вопросу из ответа",
+		"cmd_untag":                "Удалить теги вопроса из ответа",
+		"cmd_find":                 "Поиск вопросов по тексту и тегам",
+		"cmd_t":                    "Ответить шаблоном",
+		"cmd_templates":            "Шаблоны ответов",
+		"cmd_later":                "Ответить после тихих часов пользователя",
+		"cmd_template_add":         "Добавить шаблон ответа",
+		"cmd_template_del":         "Удалить шаблон ответа",
+		"cmd_broadcast":            "Разослать сообщение пользователям",
+		"cmd_broadcast_cancel":     "Остановить рассылку",
+		"cmd_segment":              "Сегменты рассылок",
+		"cmd_ban":                  "Заблокировать пользователя",
+		"cmd_unban":                "Снять блокировку",
+		"cmd_banned":               "Заблокированные пользователи",
+		"cmd_stats":                "Статистика",
+		"cmd_status":               "Состояние бота",
+		"cmd_satisfaction":         "Удовлетворённость за 30 дней",
+		"cmd_export":               "Выгрузка отзывов и вопросов",
+		"cmd_outbox":               "Очередь и недоставленные ответы",
+		"cmd_admins":               "Сотрудники и права",
+		"cmd_rollout":              "Доля вопросов с автоматизацией",
+		"cmd_review":               "Проверка качества ответов",
+	},
+}
+
+// translate returns the message by key in the language, English is the fallback
+//
+// Language codes like "ru-RU" are matched by the base language
+func translate(language, key string, args ...interface{}) string {
+	language, _, _ = strings.Cut(strings.ToLower(language), "-")
+	text, ok := catalog[language][key]
+	if !ok {
+		text = catalog[defaultLanguage][key]
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(text, args...)
+	}
+	return text
+}
@@ -0,0 +1,75 @@
+package bot
+
+import (
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+	"testing"
+)
+
+func TestTranslate(t *testing.T) {
+	tests := []struct {
+		language string
+		want     string
+	}{
+		{"ru", "Ваше обращение F-1\nСпасибо за ваш вопрос\nСвободный сотрудник скоро вам ответит"},
+		{"RU-ru", "Ваше обращение F-1\nСпасибо за ваш вопрос\nСвободный сотрудник скоро вам ответит"},
+		{"en", "Your ticket F-1\nThank you for your question\nAn available employee will answer you shortly"},
+		{"xx", "Your ticket F-1\nThank you for your question\nAn available employee will answer you shortly"},
+		{"", "Your ticket F-1\nThank you for your question\nAn available employee will answer you shortly"},
+	}
+	for _, tt := range tests {
+		if got := translate(tt.language, MsgQuestionThanks, "F-1"); got != tt.want {
+			t.Errorf("%q: %q", tt.language, got)
+		}
+	}
+}
+
+func TestCatalogMatchesDefaultLanguage(t *testing.T) {
+	for language, messages := range catalog {
+		for key, text := range messages {
+			base, ok := catalog[defaultLanguage][key]
+			if !ok {
+				t.Errorf("%s: %q is missing in %q", language, key, defaultLanguage)
+				continue
+			}
+			if strings.Count(text, "%") != strings.Count(base, "%") {
+				t.Errorf("%s: %q has other arguments than in %q", language, key, defaultLanguage)
+			}
+		}
+	}
+}
+
+// languageMessage returns the message of user 1 with the language
+func languageMessage(messageID int, text, language string) *tg.Update {
+	message := privateMessage(1, messageID, text)
+	message.From.LanguageCode = language
+	return &tg.Update{Message: message}
+}
+
+func TestAcknowledgementInUserLanguage(t *testing.T) {
+	for language, want := range map[string]string{"ru": "Спасибо за ваш вопрос", "de": "Thank you for your question"} {
+		app, api := newTestApp(t)
+		if _, err := database.AddUser(1, "user1", SQuestion, app.DB); err != nil {
+			t.Fatal(err)
+		}
+		parseUpdate(languageMessage(5, "It crashes", language), app)
+		if got := lastSent(api, 1); !strings.Contains(got, want) {
+			t.Errorf("%s: acknowledgement %q", language, got)
+		}
+	}
+}
+
+func TestSlowDownInUserLanguage(t *testing.T) {
+	app, api := newTestApp(t)
+	app.Conf.Set("rate_limit", 1)
+	if _, err := database.AddUser(1, "user1", SMain, app.DB); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		parseUpdate(languageMessage(5+i, "hello", "ru"), app)
+	}
+	if got := api.sentTo(1); len(got) != 1 || got[0] != translate("ru", MsgSlowDown) {
+		t.Fatalf("the user got %q", got)
+	}
+}
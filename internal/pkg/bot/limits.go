@@ -0,0 +1,65 @@
+package bot
+
+import (
+	"sync"
+	"time"
+)
+
+// slidingWindow counts events by key within a time window
+//
+// The zero value is ready to use
+type slidingWindow struct {
+	mu       sync.Mutex
+	events   map[int][]time.Time
+	notified map[int]time.Time
+}
+
+// allow registers the event and returns false if the key has reached the limit within the window
+func (w *slidingWindow) allow(key, limit int, window time.Duration) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.events == nil {
+		w.events = map[int][]time.Time{}
+	}
+	now := time.Now()
+	events := w.events[key]
+	i := 0
+	for i < len(events) && now.Sub(events[i]) >= window {
+		i++
+	}
+	events = events[i:]
+	if len(events) >= limit {
+		w.events[key] = events
+		return false
+	}
+	w.events[key] = append(events, now)
+	return true
+}
+
+// active returns the number of keys with events within the window, keys without them are dropped
+func (w *slidingWindow) active(window time.Duration) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	now := time.Now()
+	for key, events := range w.events {
+		if len(events) == 0 || now.Sub(events[len(events)-1]) >= window {
+			delete(w.events, key)
+		}
+	}
+	return len(w.events)
+}
+
+// notifyOnce returns true once per window for the key
+func (w *slidingWindow) notifyOnce(key int, window time.Duration) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.notified == nil {
+		w.notified = map[int]time.Time{}
+	}
+	now := time.Now()
+	if last, ok := w.notified[key]; ok && now.Sub(last) < window {
+		return false
+	}
+	w.notified[key] = now
+	return true
+}
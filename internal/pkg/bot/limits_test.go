@@ -0,0 +1,53 @@
+package bot
+
+import (
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	"testing"
+)
+
+func TestAutoRespondersDoNotLoop(t *testing.T) {
+	app, api := newTestApp(t)
+	app.Conf.Set("auto_reply_limit", 3)
+	if _, err := database.AddUser(1, "user1", SMain, app.DB); err != nil {
+		t.Fatal(err)
+	}
+	// The other side is an auto-responder which presses the button the bot offers
+	rounds := 0
+	reply := "❓Question"
+	for ; rounds < 20; rounds++ {
+		before := len(api.sentTo(1))
+		parseMessage(privateMessage(1, 10+rounds, reply), app)
+		sent := api.sentTo(1)
+		if len(sent) == before {
+			break
+		}
+		reply = "❓Question"
+		if strings.HasPrefix(sent[len(sent)-1], "Please ask your question") {
+			reply = "❌Close"
+		}
+	}
+	if rounds != 3 || len(api.sentTo(1)) != 3 {
+		t.Fatalf("%d rounds, the user got %d replies", rounds, len(api.sentTo(1)))
+	}
+	parseMessage(privateMessage(1, 50, reply), app)
+	alerts := 0
+	for _, text := range api.sentTo(2) {
+		if strings.Contains(text, "Automatic replies to @user1 (1) are paused") {
+			alerts++
+		}
+	}
+	if alerts != 1 || len(api.sentTo(1)) != 3 {
+		t.Fatalf("%d alerts, the user got %d replies", alerts, len(api.sentTo(1)))
+	}
+}
+
+func TestBotsAreNotAnswered(t *testing.T) {
+	app, api := newTestApp(t)
+	message := privateMessage(1, 10, "/start")
+	message.From.IsBot = true
+	parseMessage(message, app)
+	if len(api.requests()) != 0 || database.GetUserByChatID(1, app.DB) != nil {
+		t.Fatalf("the bot is answered: %+v", api.requests())
+	}
+}
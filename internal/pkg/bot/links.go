@@ -0,0 +1,149 @@
+package bot
+
+import (
+	"crypto/rand"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	l "telegram-bot-feedback/internal/pkg/logger"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+// Link sources
+const (
+	LinkAnswer    = "answer"
+	LinkBroadcast = "broadcast"
+)
+
+// linkPath is the path of the redirect handler
+const linkPath = "/l/"
+
+// linkAlphabet is used for short link codes
+const linkAlphabet = "abcdefghijkmnpqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// trackLinks points links to the configured domains at the redirect handler
+//
+// "url" entities become "text_link" entities, so the text and offsets of other entities are not changed.
+// Returns false if no link was rewritten
+func trackLinks(entities []*tg.MessageEntity, text string, questionID int, source string, app *App) ([]tg.MessageEntity, bool) {
+	base := strings.TrimSuffix(app.Conf.GetString("link_base_url"), "/")
+	if base == "" || len(entities) == 0 {
+		return nil, false
+	}
+	result := make([]tg.MessageEntity, 0, len(entities))
+	changed := false
+	for _, entity := range entities {
+		e := *entity
+		var target string
+		switch e.Type {
+		case "url":
+			target = entitySubstring(text, e.Offset, e.Length)
+		case "text_link":
+			target = e.URL
+		}
+		if target != "" && trackedDomain(target, app.Conf) {
+			code, err := newLinkCode()
+			if err == nil {
+				err = database.AddLink(code, target, questionID, source, app.DB)
+			}
+			if err != nil {
+				l.Error(l.Err(err))
+			} else {
+				e.Type = "text_link"
+				e.URL = base + linkPath + code
+				changed = true
+			}
+		}
+		result = append(result, e)
+	}
+	return result, changed
+}
+
+// trackedDomain reports whether the link belongs to a domain from "link_domains"
+func trackedDomain(link string, conf *viper.Viper) bool {
+	if !strings.Contains(link, "://") {
+		link = "http://" + link
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, domain := range conf.GetStringSlice("link_domains") {
+		domain = strings.ToLower(domain)
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// entitySubstring returns the text of the entity, offset and length are in UTF-16 code units
+func entitySubstring(text string, offset, length int) string {
+	var b strings.Builder
+	pos := 0
+	for _, r := range text {
+		if pos >= offset+length {
+			break
+		}
+		if pos >= offset {
+			b.WriteRune(r)
+		}
+		pos += tg.UTF16Len(string(r))
+	}
+	return b.String()
+}
+
+// newLinkCode returns a random short code
+func newLinkCode() (string, error) {
+	code := make([]byte, 8)
+	max := big.NewInt(int64(len(linkAlphabet)))
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = linkAlphabet[n.Int64()]
+	}
+	return string(code), nil
+}
+
+// linkHandler logs the click and redirects to the target
+func linkHandler(db *gorm.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		link := database.GetLinkByCode(strings.TrimPrefix(r.URL.Path, linkPath), db)
+		if link == nil {
+			http.NotFound(w, r)
+			return
+		}
+		if err := database.AddLinkClick(link, db); err != nil {
+			l.Error(err)
+		}
+		http.Redirect(w, r, link.Target, http.StatusFound)
+	}
+}
+
+// linkStats returns click statistics
+func linkStats(app *App) string {
+	stats := database.GetLinkStats(app.DB)
+	if len(stats) == 0 {
+		return "No tracked links"
+	}
+	text := "Link clicks:\n"
+	for _, s := range stats {
+		text = text + s.Target + " (" + s.Source + ") - " + strconv.Itoa(int(s.Clicks)) + " clicks / " + strconv.Itoa(int(s.Links)) + " links\n"
+	}
+	return text
+}
+
+// RegisterHandlers adds the bot HTTP handlers to the mux
+func RegisterHandlers(mux *http.ServeMux, db *gorm.DB, conf *viper.Viper) {
+	mux.Handle(linkPath, linkHandler(db))
+	mux.Handle(escalationPath, escalationHandler(db, conf))
+}
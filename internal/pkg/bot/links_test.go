@@ -0,0 +1,81 @@
+package bot
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+	"testing"
+)
+
+func TestTrackLinksOnlyConfiguredDomains(t *testing.T) {
+	app, _ := newTestApp(t)
+	app.Conf.Set("link_base_url", "https://bot.example.com/")
+	app.Conf.Set("link_domains", []string{"example.org"})
+	text := "🙂 See docs.example.org/faq and https://other.com, *done*"
+	entities := []*tg.MessageEntity{
+		{Type: "url", Offset: 7, Length: 20},
+		{Type: "url", Offset: 32, Length: 17},
+		{Type: "bold", Offset: 51, Length: 6},
+		{Type: "text_link", Offset: 0, Length: 2, URL: "https://EXAMPLE.org/pricing"},
+	}
+	tracked, changed := trackLinks(entities, text, 7, LinkAnswer, app)
+	if !changed || len(tracked) != 4 {
+		t.Fatalf("changed = %t, entities = %+v", changed, tracked)
+	}
+	targets := []string{"docs.example.org/faq", "", "", "https://EXAMPLE.org/pricing"}
+	for i, target := range targets {
+		e := tracked[i]
+		if e.Offset != entities[i].Offset || e.Length != entities[i].Length {
+			t.Fatalf("entity %d moved: %+v", i, e)
+		}
+		if target == "" {
+			if e != *entities[i] {
+				t.Fatalf("entity %d is changed: %+v", i, e)
+			}
+			continue
+		}
+		code := strings.TrimPrefix(e.URL, "https://bot.example.com"+linkPath)
+		link := database.GetLinkByCode(code, app.DB)
+		if e.Type != "text_link" || link == nil || link.Target != target || link.QuestionID != 7 || link.Source != LinkAnswer {
+			t.Fatalf("entity %d = %+v, link = %+v", i, e, link)
+		}
+	}
+}
+
+func TestTrackLinksDisabled(t *testing.T) {
+	app, _ := newTestApp(t)
+	app.Conf.Set("link_domains", []string{"example.org"})
+	entities := []*tg.MessageEntity{{Type: "url", Offset: 0, Length: 11}}
+	if _, changed := trackLinks(entities, "example.org", 1, LinkAnswer, app); changed {
+		t.Fatal("links are rewritten without link_base_url")
+	}
+	app.Conf.Set("link_base_url", "https://bot.example.com")
+	if _, changed := trackLinks(entities, "example.com", 1, LinkAnswer, app); changed {
+		t.Fatal("a link to another domain is rewritten")
+	}
+}
+
+func TestLinkHandlerRedirectsAndCounts(t *testing.T) {
+	app, _ := newTestApp(t)
+	if err := database.AddLink("abc", "https://example.org/faq", 1, LinkBroadcast, app.DB); err != nil {
+		t.Fatal(err)
+	}
+	handler := linkHandler(app.DB)
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodGet, linkPath+"abc", nil))
+		if w.Code != http.StatusFound || w.Header().Get("Location") != "https://example.org/faq" {
+			t.Fatalf("response = %d %q", w.Code, w.Header().Get("Location"))
+		}
+	}
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, linkPath+"missing", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("unknown code answered %d", w.Code)
+	}
+	if stats := linkStats(app); !strings.Contains(stats, "https://example.org/faq (broadcast) - 2 clicks / 1 links") {
+		t.Fatalf("stats = %q", stats)
+	}
+}
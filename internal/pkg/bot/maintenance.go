@@ -0,0 +1,79 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	l "telegram-bot-feedback/internal/pkg/logger"
+	"time"
+)
+
+// Maintenance settings
+const (
+	// maintenanceSetting is the store key of the date of the last maintenance
+	maintenanceSetting = "maintenance_last"
+	// dataDir is the directory of the database file
+	dataDir = "database"
+	// mb is one megabyte
+	mb = 1 << 20
+)
+
+// runMaintenance vacuums the database every day at "maintenance_time"
+//
+// The maintenance is postponed while an export or a backup is in progress
+func runMaintenance(ctx context.Context, app *App) {
+	runDaily(ctx, "maintenance_time", maintenanceSetting, app, func(now time.Time) bool {
+		if busy := database.GetSetting(database.BusySetting, app.DB); busy != "" {
+			l.Info(l.NewError("Maintenance postponed: " + busy + " in progress"))
+			return false
+		}
+		maintain(app)
+		return true
+	})
+}
+
+// maintain vacuums the database, logs the storage usage and warns about low disk space
+func maintain(app *App) {
+	started := time.Now()
+	before, err := database.Size(app.DB)
+	if err != nil {
+		l.Error(err)
+	}
+	err = database.Vacuum(app.DB)
+	if err != nil {
+		l.Error(err)
+	}
+	after, err := database.Size(app.DB)
+	if err != nil {
+		l.Error(err)
+	}
+	l.Info(l.NewError(fmt.Sprintf("Maintenance done in %s, database %.1f MB -> %.1f MB\n%s",
+		time.Since(started).Round(time.Millisecond), float64(before)/mb, float64(after)/mb, storageStats(app))))
+	if app.Conf.GetString("storage_driver") == "sqlite_memory" {
+		return
+	}
+	free, err := freeSpace(dataDir)
+	if err != nil {
+		l.Error(l.Err(err))
+		return
+	}
+	if min := app.Conf.GetInt64("min_free_disk_mb"); min > 0 && free < uint64(min)*mb {
+		report(fmt.Sprintf("Low disk space: %.0f MB free in the data directory", float64(free)/mb), app)
+	}
+}
+
+// storageStats returns the database size, table row counts and free disk space
+func storageStats(app *App) string {
+	var b strings.Builder
+	if size, err := database.Size(app.DB); err == nil {
+		fmt.Fprintf(&b, "Database: %.1f MB\n", float64(size)/mb)
+	}
+	if free, err := freeSpace(dataDir); err == nil {
+		fmt.Fprintf(&b, "Free disk: %.0f MB\n", float64(free)/mb)
+	}
+	for _, count := range database.GetTableCounts(app.DB) {
+		fmt.Fprintf(&b, "%s: %d\n", count.Table, count.Rows)
+	}
+	return b.String()
+}
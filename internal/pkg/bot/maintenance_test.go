@@ -0,0 +1,80 @@
+package bot
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	"testing"
+	"time"
+)
+
+// runMaintenanceOnce runs one check of the maintenance job
+func runMaintenanceOnce(app *App) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	runMaintenance(ctx, app)
+}
+
+func TestMaintenanceWaitsForExport(t *testing.T) {
+	app, _ := newTestApp(t)
+	app.Conf.Set("maintenance_time", "00:00")
+	app.Conf.Set("timezone", "UTC")
+	app.Conf.Set("storage_driver", "sqlite_memory")
+	now := time.Date(2024, 3, 5, 3, 0, 0, 0, time.UTC)
+	setClock(t, func() time.Time { return now })
+	if err := database.SetSetting(database.BusySetting, "export", app.DB); err != nil {
+		t.Fatal(err)
+	}
+	runMaintenanceOnce(app)
+	if last := database.GetSetting(maintenanceSetting, app.DB); last != "" {
+		t.Fatalf("maintenance ran during the export on %q", last)
+	}
+	if err := database.SetSetting(database.BusySetting, "", app.DB); err != nil {
+		t.Fatal(err)
+	}
+	runMaintenanceOnce(app)
+	if last := database.GetSetting(maintenanceSetting, app.DB); last != "2024-03-05" {
+		t.Fatalf("the last maintenance = %q", last)
+	}
+}
+
+func TestMaintenanceWarnsAboutLowDiskSpace(t *testing.T) {
+	app, api := newTestApp(t)
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	work := t.TempDir()
+	if err := os.Mkdir(filepath.Join(work, dataDir), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(work); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(dir) })
+	app.Conf.Set("report_chat", 3)
+
+	maintain(app)
+	if len(api.sentTo(3)) != 0 {
+		t.Fatalf("warnings without the threshold = %q", api.sentTo(3))
+	}
+	app.Conf.Set("min_free_disk_mb", 1<<40)
+	maintain(app)
+	if sent := api.sentTo(3); len(sent) != 1 || !strings.HasPrefix(sent[0], "Low disk space: ") {
+		t.Fatalf("warnings = %q", sent)
+	}
+}
+
+func TestStorageStats(t *testing.T) {
+	app, api := newTestApp(t)
+	if err := database.ChangeUserState(SMain, database.GetUserByChatID(2, app.DB), app.DB); err != nil {
+		t.Fatal(err)
+	}
+	parseMessage(commandMessage(2, "/stats storage"), app)
+	got := lastSent(api, 2)
+	if !strings.HasPrefix(got, "Database: ") || !strings.Contains(got, "\nusers: 1\n") || !strings.Contains(got, "\nquestions: 0\n") {
+		t.Fatalf("/stats storage = %q", got)
+	}
+}
@@ -0,0 +1,76 @@
+package bot
+
+import (
+	"strconv"
+	"telegram-bot-feedback/internal/pkg/database"
+	l "telegram-bot-feedback/internal/pkg/logger"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+)
+
+// parseMyChatMember tracks the status of the bot in chats
+//
+// In a private chat "kicked" means the user blocked the bot. In groups the bot introduces itself when added
+// and forgets the group when removed
+func parseMyChatMember(update *tg.ChatMemberUpdated, app *App) error {
+	oldStatus, newStatus := update.OldChatMember.Status, update.NewChatMember.Status
+	l.Info(l.NewError("Chat " + strconv.Itoa(update.Chat.ID) + " (" + update.Chat.Type + "): " + oldStatus + " -> " + newStatus +
+		" by " + strconv.Itoa(update.From.ID)))
+	recordChatCapabilities(&update.Chat, app)
+	if oldStatus == newStatus {
+		return nil
+	}
+	if update.Chat.IsPrivate() {
+		user := database.GetUserByChatID(update.Chat.ID, app.DB)
+		if user == nil {
+			return nil
+		}
+		return l.Err(database.ChangeUserIsBlocked(!isChatMember(newStatus), user, app.DB))
+	}
+	if !isChatMember(newStatus) {
+		return l.Err(database.RemoveGroup(update.Chat.ID, app.DB))
+	}
+	err := database.SetGroup(update.Chat.ID, update.Chat.Title, app.DB)
+	if err != nil {
+		return l.Err(err)
+	}
+	if isChatMember(oldStatus) || update.Chat.IsChannel() {
+		return nil
+	}
+	text := "Hello! I collect feedback in private messages, write to @" + app.Bot.Self.UserName + " to leave a review or ask a question"
+	_, err = app.Bot.Send(tg.NewMessage(update.Chat.ID, text))
+	return l.Err(err)
+}
+
+// isChatMember reports whether the status means the bot is in the chat
+func isChatMember(status string) bool {
+	return status != "left" && status != "kicked" && status != ""
+}
+
+// syncGroupAdmins makes the creator and the administrators of "admins_group" employees
+//
+// Employees are only added, demoted administrators keep their access until removed in the console
+func syncGroupAdmins(app *App) {
+	group := app.Conf.GetInt("admins_group")
+	if group == 0 {
+		return
+	}
+	members, err := app.Bot.GetChatAdministrators(group)
+	if err != nil {
+		l.Error(l.Err(err))
+		return
+	}
+	for _, member := range members {
+		if !member.IsCreator() && !member.IsAdministrator() || member.User.IsBot {
+			continue
+		}
+		if user := database.GetUserByChatID(member.User.ID, app.DB); user != nil && user.IsEmployee {
+			continue
+		}
+		err := database.AddEmployeeByID(app.DB, member.User.ID)
+		if err != nil {
+			l.Error(err)
+			continue
+		}
+		l.Info(l.NewError("Administrator " + strconv.Itoa(member.User.ID) + " of the admins group is added as an employee"))
+	}
+}
@@ -0,0 +1,144 @@
+package bot
+
+import (
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	l "telegram-bot-feedback/internal/pkg/logger"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+	"testing"
+)
+
+// memberUpdate returns the Update of the bot status in the chat changed by user 1
+func memberUpdate(chat tg.Chat, oldStatus, newStatus string) *tg.Update {
+	bot := tg.User{ID: 1, IsBot: true, UserName: "feedback_bot"}
+	return &tg.Update{MyChatMember: &tg.ChatMemberUpdated{
+		Chat:          chat,
+		From:          tg.User{ID: 1, FirstName: "User"},
+		OldChatMember: tg.ChatMember{Status: oldStatus, User: bot},
+		NewChatMember: tg.ChatMember{Status: newStatus, User: bot},
+	}}
+}
+
+// statsText returns the /stats answer to admin 2
+func statsText(t *testing.T, app *App, api *testAPI) string {
+	if err := database.ChangeUserState(SMain, database.GetUserByChatID(2, app.DB), app.DB); err != nil {
+		t.Fatal(err)
+	}
+	parseMessage(commandMessage(2, "/stats"), app)
+	return lastSent(api, 2)
+}
+
+func TestPrivateChatBlockAndUnblock(t *testing.T) {
+	app, api := newTestApp(t)
+	if _, err := database.AddUser(1, "user1", SMain, app.DB); err != nil {
+		t.Fatal(err)
+	}
+	private := tg.Chat{ID: 1, Type: "private"}
+	if err := parseUpdate(memberUpdate(private, "member", "kicked"), app); err != nil {
+		t.Fatal(err)
+	}
+	if !database.GetUserByChatID(1, app.DB).IsBlocked {
+		t.Fatal("the user who blocked the bot is reachable")
+	}
+	if len(database.GetBroadcastUsers(app.DB)) != 0 {
+		t.Fatal("the blocked user receives broadcasts")
+	}
+	if got := statsText(t, app, api); !strings.Contains(got, "Users: 1 (active: 0)") || !strings.Contains(got, "\nBlocked the bot: 1\n") {
+		t.Fatalf("/stats = %q", got)
+	}
+
+	if err := parseUpdate(memberUpdate(private, "kicked", "member"), app); err != nil {
+		t.Fatal(err)
+	}
+	if database.GetUserByChatID(1, app.DB).IsBlocked {
+		t.Fatal("the user who unblocked the bot is unreachable")
+	}
+	// Unknown users are ignored
+	if err := parseUpdate(memberUpdate(tg.Chat{ID: 9, Type: "private"}, "member", "kicked"), app); err != nil {
+		t.Fatal(err)
+	}
+	if database.GetUserByChatID(9, app.DB) != nil {
+		t.Fatal("the unknown user is added")
+	}
+}
+
+func TestBotAddedToAndRemovedFromGroup(t *testing.T) {
+	app, api := newTestApp(t)
+	group := tg.Chat{ID: -100, Type: "supergroup", Title: "Customers"}
+	if err := parseUpdate(memberUpdate(group, "left", "member"), app); err != nil {
+		t.Fatal(err)
+	}
+	if sent := api.sentTo(-100); len(sent) != 1 || !strings.HasPrefix(sent[0], "Hello! I collect feedback") {
+		t.Fatalf("intro = %q", sent)
+	}
+	if got := statsText(t, app, api); !strings.Contains(got, "\nGroups: 1\n") {
+		t.Fatalf("/stats = %q", got)
+	}
+
+	// Promotion is not a new membership, the intro isn't repeated
+	if err := parseUpdate(memberUpdate(group, "member", "administrator"), app); err != nil {
+		t.Fatal(err)
+	}
+	if len(api.sentTo(-100)) != 1 {
+		t.Fatalf("intros = %q", api.sentTo(-100))
+	}
+
+	if err := parseUpdate(memberUpdate(group, "administrator", "kicked"), app); err != nil {
+		t.Fatal(err)
+	}
+	if got := statsText(t, app, api); !strings.Contains(got, "\nGroups: 0\n") {
+		t.Fatalf("/stats after the removal = %q", got)
+	}
+
+	// Channels are recorded without the intro
+	channel := tg.Chat{ID: -200, Type: "channel", Title: "News"}
+	if err := parseUpdate(memberUpdate(channel, "left", "administrator"), app); err != nil {
+		t.Fatal(err)
+	}
+	if len(api.sentTo(-200)) != 0 {
+		t.Fatalf("intro in the channel = %q", api.sentTo(-200))
+	}
+	if got := statsText(t, app, api); !strings.Contains(got, "\nGroups: 1\n") {
+		t.Fatalf("/stats with the channel = %q", got)
+	}
+}
+
+func TestGroupAdminsBecomeEmployees(t *testing.T) {
+	app, api := newTestApp(t)
+	syncGroupAdmins(app)
+	if len(api.requests("getChatAdministrators")) != 0 {
+		t.Fatal("the administrators are requested without admins_group")
+	}
+
+	app.Conf.Set("admins_group", -1001234567890)
+	if _, err := database.AddUser(11, "ann", SMain, app.DB); err != nil {
+		t.Fatal(err)
+	}
+	api.result("getChatAdministrators", `[
+		{"status":"creator","user":{"id":10,"is_bot":false,"first_name":"Owner"}},
+		{"status":"administrator","user":{"id":11,"is_bot":false,"first_name":"Ann"}},
+		{"status":"administrator","user":{"id":12,"is_bot":true,"first_name":"Helper"}},
+		{"status":"administrator","user":{"id":2,"is_bot":false,"first_name":"Admin"}}
+	]`)
+	syncGroupAdmins(app)
+	if calls := api.requests("getChatAdministrators"); len(calls) != 1 || calls[0].chatID() != -1001234567890 {
+		t.Fatalf("requests = %+v", calls)
+	}
+	for _, id := range []int{10, 11, 2} {
+		if user := database.GetUserByChatID(id, app.DB); user == nil || !user.IsEmployee {
+			t.Errorf("administrator %d is not an employee: %+v", id, user)
+		}
+	}
+	if user := database.GetUserByChatID(11, app.DB); user.Nickname != "ann" {
+		t.Fatalf("the existing user is replaced: %+v", user)
+	}
+	if user := database.GetUserByChatID(12, app.DB); user != nil {
+		t.Fatalf("the bot administrator is added: %+v", user)
+	}
+
+	api.fail("getChatAdministrators", 400, "Bad Request: chat not found")
+	syncGroupAdmins(app)
+	if text, _ := l.LastError(); !strings.Contains(text, "chat not found") {
+		t.Fatalf("last error = %q", text)
+	}
+}
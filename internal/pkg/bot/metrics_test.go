@@ -0,0 +1,69 @@
+package bot
+
+import (
+	"bufio"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	"telegram-bot-feedback/internal/pkg/metrics"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+	"testing"
+)
+
+// scrapeMetric returns the value of the series from the metrics endpoint, 0 if it is not written
+func scrapeMetric(t *testing.T, series string) float64 {
+	server := httptest.NewServer(metrics.Handler())
+	defer server.Close()
+	resp, err := server.Client().Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if value, found := strings.CutPrefix(scanner.Text(), series+" "); found {
+			v, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return v
+		}
+	}
+	return 0
+}
+
+func TestMetricsCountHandledUpdates(t *testing.T) {
+	app, _ := newTestApp(t)
+	if _, err := database.AddUser(1, "user1", SQuestion, app.DB); err != nil {
+		t.Fatal(err)
+	}
+	messages := scrapeMetric(t, `feedback_updates_total{type="message"}`)
+	edits := scrapeMetric(t, `feedback_updates_total{type="edited_message"}`)
+	handled := scrapeMetric(t, `feedback_handler_duration_seconds_count{type="message"}`)
+	questions := scrapeMetric(t, `feedback_submissions_total{kind="question"}`)
+
+	updates := []tg.Update{
+		{UpdateID: 1, Message: privateMessage(1, 5, "the app crashes")},
+		{UpdateID: 2, Message: privateMessage(1, 6, "on start")},
+		{UpdateID: 3, EditedMessage: privateMessage(1, 6, "on every start")},
+	}
+	for i := range updates {
+		if err := app.HandleUpdate(&updates[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := scrapeMetric(t, `feedback_updates_total{type="message"}`) - messages; got != 2 {
+		t.Fatalf("messages = %v, want 2", got)
+	}
+	if got := scrapeMetric(t, `feedback_updates_total{type="edited_message"}`) - edits; got != 1 {
+		t.Fatalf("edited messages = %v, want 1", got)
+	}
+	if got := scrapeMetric(t, `feedback_handler_duration_seconds_count{type="message"}`) - handled; got != 2 {
+		t.Fatalf("handled messages = %v, want 2", got)
+	}
+	if got := scrapeMetric(t, `feedback_submissions_total{kind="question"}`) - questions; got != 1 {
+		t.Fatalf("questions = %v, want 1", got)
+	}
+}
@@ -0,0 +1,112 @@
+package bot
+
+import (
+	"strconv"
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	l "telegram-bot-feedback/internal/pkg/logger"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+	"time"
+)
+
+// ticketPrefix starts the ticket number users see
+//
+// The number is stored with the Question and kept by the vault restore, so ticket numbers are unique and stable.
+// It is not TicketID, the ID of the Question in the external ticket system
+const ticketPrefix = "F-"
+
+// myTicketsLimit is the number of tickets in /mytickets
+const myTicketsLimit = 10
+
+// ticketNumber returns the ticket number of the Question, e.g. "F-1024"
+func ticketNumber(question *database.Question) string {
+	return ticketPrefix + strconv.Itoa(question.Number)
+}
+
+// parseTicketNumber returns the number of "F-1024", "#1024" or "1024", 0 if the text is not a ticket number
+func parseTicketNumber(text string) int {
+	text = strings.TrimSpace(text)
+	if len(text) > len(ticketPrefix) && strings.EqualFold(text[:len(ticketPrefix)], ticketPrefix) {
+		text = text[len(ticketPrefix):]
+	}
+	id, err := strconv.Atoi(strings.TrimPrefix(text, "#"))
+	if err != nil || id <= 0 {
+		return 0
+	}
+	return id
+}
+
+// ticketStatus returns the status icon and name of the Question in the language
+func ticketStatus(question *database.Question, language string) string {
+	switch {
+	case question.IsClosed:
+		return "✅ " + translate(language, MsgTicketClosed)
+	case question.HaveAnswer || question.AnswererID != 0:
+		return "💬 " + translate(language, MsgTicketInProgress)
+	default:
+		return "🆕 " + translate(language, MsgTicketNew)
+	}
+}
+
+// listTickets sends the last tickets of the user
+//
+// Closed tickets older than "ticket_retention_days" are left out, /ticket still finds them
+func listTickets(user *database.User, app *App) error {
+	closedAfter := time.Time{}
+	if days := app.Conf.GetInt("ticket_retention_days"); days > 0 {
+		closedAfter = clock().AddDate(0, 0, -days)
+	}
+	questions := database.GetUserQuestions(user, closedAfter, myTicketsLimit, app.DB)
+	if len(questions) == 0 {
+		_, err := app.Bot.Send(tg.NewMessage(user.ChatID, translate(user.LanguageCode, MsgTicketsEmpty)))
+		return l.Err(err)
+	}
+	var b strings.Builder
+	b.WriteString(translate(user.LanguageCode, MsgTicketsTitle))
+	for _, question := range questions {
+		b.WriteString("\n" + ticketNumber(&question) + " " + question.CreatedAt.Format(exportDateLayout) + " " +
+			ticketStatus(&question, user.LanguageCode) + "\n" + questionPreview(question.Header))
+	}
+	b.WriteString("\n\n" + translate(user.LanguageCode, MsgTicketFormat))
+	_, err := app.Bot.Send(tg.NewMessage(user.ChatID, b.String()))
+	return l.Err(err)
+}
+
+// showTicket sends the text, status and the last reply of the ticket
+//
+// Format: /ticket F-1024, only the tickets of the user are found
+func showTicket(message *tg.Message, user *database.User, app *App) error {
+	number := parseTicketNumber(message.CommandArguments())
+	if number == 0 {
+		_, err := app.Bot.Send(tg.NewMessage(user.ChatID, translate(user.LanguageCode, MsgTicketFormat)))
+		return l.Err(err)
+	}
+	question := database.GetUserQuestionByNumber(number, user, app.DB)
+	if question == nil {
+		_, err := app.Bot.Send(tg.NewMessage(user.ChatID, translate(user.LanguageCode, MsgTicketNotFound, ticketPrefix+strconv.Itoa(number))))
+		return l.Err(err)
+	}
+	title := ticketNumber(question) + " " + ticketStatus(question, user.LanguageCode) + "\n" + question.CreatedAt.Format(historyTimeLayout)
+	body := question.Header + "\n\n"
+	if reply := database.GetLastEmployeeReply(question, app.DB); reply != nil && reply.Text != "" {
+		body += translate(user.LanguageCode, MsgTicketLastReply, reply.CreatedAt.Format(historyTimeLayout)) + "\n" + reply.Text
+	} else {
+		body += translate(user.LanguageCode, MsgTicketNoReply)
+	}
+	for _, part := range splitMessage(title, body, nil) {
+		_, err := app.Bot.Send(tg.NewMessage(user.ChatID, part.Text))
+		if err != nil {
+			return l.Err(err)
+		}
+	}
+	return nil
+}
+
+// questionPreview returns the first line of the text cut to 60 characters
+func questionPreview(text string) string {
+	text, _, _ = strings.Cut(text, "\n")
+	if runes := []rune(text); len(runes) > 60 {
+		text = string(runes[:60]) + "…"
+	}
+	return text
+}
@@ -0,0 +1,160 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"telegram-bot-feedback/internal/pkg/database"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+	"testing"
+	"time"
+)
+
+// commandMessage returns the command of the user in the private chat
+func commandMessage(chatID int, text string) *tg.Message {
+	message := privateMessage(chatID, 7, text)
+	command, _, _ := strings.Cut(text, " ")
+	message.Entities = []*tg.MessageEntity{{Type: "bot_command", Offset: 0, Length: len(command)}}
+	return message
+}
+
+// lastSent returns the last text sent to the chat
+func lastSent(api *testAPI, chatID int) string {
+	texts := api.sentTo(chatID)
+	if len(texts) == 0 {
+		return ""
+	}
+	return texts[len(texts)-1]
+}
+
+func TestTicketNumbersOfConcurrentQuestions(t *testing.T) {
+	app, api := newTestApp(t)
+	const users = 20
+	for i := 0; i < users; i++ {
+		if _, err := database.AddUser(100+i, fmt.Sprint("user", 100+i), SQuestion, app.DB); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < users; i++ {
+		wg.Add(1)
+		go func(chatID int) {
+			defer wg.Done()
+			parseMessage(privateMessage(chatID, 5, fmt.Sprint("Question of ", chatID)), app)
+		}(100 + i)
+	}
+	wg.Wait()
+	numbers := map[string]int{}
+	for i := 0; i < users; i++ {
+		chatID := 100 + i
+		var number string
+		for _, text := range api.sentTo(chatID) {
+			if strings.HasPrefix(text, "Your ticket ") {
+				number, _, _ = strings.Cut(strings.TrimPrefix(text, "Your ticket "), "\n")
+			}
+		}
+		if number == "" {
+			t.Fatalf("user %d got no ticket number: %q", chatID, api.sentTo(chatID))
+		}
+		if other, ok := numbers[number]; ok {
+			t.Fatalf("users %d and %d got the same ticket %s", other, chatID, number)
+		}
+		numbers[number] = chatID
+		// The number finds the question of the user
+		question := database.GetUserQuestionByNumber(parseTicketNumber(number), database.GetUserByChatID(chatID, app.DB), app.DB)
+		if question == nil || question.Header != fmt.Sprint("Question of ", chatID) {
+			t.Fatalf("ticket %s of user %d is %+v", number, chatID, question)
+		}
+	}
+}
+
+func TestTicketNumberIsNotTheQuestionID(t *testing.T) {
+	app, api := newTestApp(t)
+	// The store was restored from a snapshot with 1023 tickets
+	if err := database.SetSetting(database.LastNumberSetting, "1023", app.DB); err != nil {
+		t.Fatal(err)
+	}
+	question := askQuestion(t, app, "It crashes")
+	if question.ID == 1024 || ticketNumber(question) != "F-1024" {
+		t.Fatalf("question %d got ticket %s, want F-1024", question.ID, ticketNumber(question))
+	}
+	if err := database.ChangeQuestionTicketID("EXT-7", question, app.DB); err != nil {
+		t.Fatal(err)
+	}
+	parseMessage(commandMessage(1, "/ticket F-1024"), app)
+	if got := lastSent(api, 1); !strings.HasPrefix(got, "F-1024 ") || !strings.Contains(got, "It crashes") {
+		t.Fatalf("/ticket F-1024 = %q", got)
+	}
+	parseMessage(commandMessage(1, fmt.Sprint("/ticket F-", question.ID)), app)
+	if got := lastSent(api, 1); got != fmt.Sprintf("Ticket F-%d was not found", question.ID) {
+		t.Fatalf("/ticket by the question ID = %q", got)
+	}
+}
+
+func TestTicketsAreScopedToTheUser(t *testing.T) {
+	app, api := newTestApp(t)
+	owner, err := database.AddUser(1, "user1", SMain, app.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := database.AddUser(3, "user3", SMain, app.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	question, err := database.AddQuestion("My secret problem", 5, owner, app.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.AddQuestion("Other problem", 6, other, app.DB); err != nil {
+		t.Fatal(err)
+	}
+	number := ticketNumber(question)
+
+	parseMessage(commandMessage(3, "/ticket "+number), app)
+	if got := lastSent(api, 3); got != "Ticket "+number+" was not found" {
+		t.Fatalf("another user got %q", got)
+	}
+	parseMessage(commandMessage(3, "/mytickets"), app)
+	if got := lastSent(api, 3); strings.Contains(got, "My secret problem") || !strings.Contains(got, "Other problem") {
+		t.Fatalf("/mytickets of another user = %q", got)
+	}
+	parseMessage(commandMessage(1, "/ticket "+number), app)
+	if got := lastSent(api, 1); !strings.Contains(got, "My secret problem") {
+		t.Fatalf("the owner got %q", got)
+	}
+}
+
+func TestTicketRetentionCountsFromClosing(t *testing.T) {
+	app, api := newTestApp(t)
+	app.Conf.Set("ticket_retention_days", 30)
+	user, err := database.AddUser(1, "user1", SMain, app.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	longRunning, err := database.AddQuestion("Long running", 5, user, app.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forgotten, err := database.AddQuestion("Forgotten", 6, user, app.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().AddDate(0, 0, -40)
+	app.DB.Model(&database.Question{}).Where("id IN ?", []uint{longRunning.ID, forgotten.ID}).UpdateColumn("created_at", old)
+	if err := database.ChangeQuestionIsClosed(true, longRunning, app.DB); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.ChangeQuestionIsClosed(true, forgotten, app.DB); err != nil {
+		t.Fatal(err)
+	}
+	app.DB.Model(forgotten).UpdateColumn("closed_at", old.Add(time.Hour))
+
+	parseMessage(commandMessage(1, "/mytickets"), app)
+	if got := lastSent(api, 1); !strings.Contains(got, "Long running") || strings.Contains(got, "Forgotten") {
+		t.Fatalf("/mytickets = %q, want the ticket closed today only", got)
+	}
+	parseMessage(commandMessage(1, "/ticket "+ticketNumber(forgotten)), app)
+	if got := lastSent(api, 1); !strings.Contains(got, "Forgotten") {
+		t.Fatalf("/ticket of an old ticket = %q", got)
+	}
+}
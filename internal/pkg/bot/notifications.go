@@ -0,0 +1,42 @@
+package bot
+
+import (
+	"telegram-bot-feedback/internal/app/notify"
+	"telegram-bot-feedback/internal/pkg/database"
+	l "telegram-bot-feedback/internal/pkg/logger"
+)
+
+// notifyQuestion pushes the new Question to the configured notifiers in the background
+//
+// Notifiers run only after the Question reached an employee chat, delivered is the result of sendNewQuestion
+func notifyQuestion(delivered bool, question *database.Question, user *database.User, app *App) {
+	if !delivered {
+		l.Warn(l.WithFields(l.NewError("The question reached no employee, notifiers are skipped"), "question", question.ID))
+		return
+	}
+	app.notifier.Notify(notify.Feedback{
+		Kind:     "question",
+		ID:       question.ID,
+		UserID:   user.ChatID,
+		User:     userName(user),
+		Category: questionCategory(question, app),
+		Text:     question.Header,
+		Date:     question.CreatedAt,
+	})
+}
+
+// notifyReview pushes the finished Review to the configured notifiers in the background
+func notifyReview(review *database.Review, text string, user *database.User, app *App) {
+	if review == nil {
+		return
+	}
+	app.notifier.Notify(notify.Feedback{
+		Kind:   "review",
+		ID:     review.ID,
+		UserID: user.ChatID,
+		User:   userName(user),
+		Rating: review.Rating,
+		Text:   text,
+		Date:   review.CreatedAt,
+	})
+}
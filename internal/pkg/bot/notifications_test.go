@@ -0,0 +1,52 @@
+package bot
+
+import (
+	"context"
+	"telegram-bot-feedback/internal/app/notify"
+	"telegram-bot-feedback/internal/pkg/database"
+	"testing"
+	"time"
+)
+
+// recordingNotifier passes the Feedback to the channel
+type recordingNotifier chan notify.Feedback
+
+func (n recordingNotifier) Notify(ctx context.Context, feedback notify.Feedback) error {
+	n <- feedback
+	return nil
+}
+
+// notifiedQuestion asks a question as user 1 and returns the notified Feedback, nil if notifiers didn't run
+func notifiedQuestion(t *testing.T, app *App) *notify.Feedback {
+	notifier := make(recordingNotifier, 1)
+	app.notifier = &notify.Dispatcher{Notifiers: []notify.Notifier{notifier}}
+	if _, err := database.AddUser(1, "user1", SQuestion, app.DB); err != nil {
+		t.Fatal(err)
+	}
+	parseMessage(privateMessage(1, 5, "It crashes"), app)
+	select {
+	case feedback := <-notifier:
+		return &feedback
+	case <-time.After(200 * time.Millisecond):
+		return nil
+	}
+}
+
+func TestNotifyQuestionAfterDelivery(t *testing.T) {
+	app, api := newTestApp(t)
+	feedback := notifiedQuestion(t, app)
+	if len(api.sentTo(2)) == 0 {
+		t.Fatal("the question is not sent to the admin")
+	}
+	if feedback == nil || feedback.Kind != "question" || feedback.Text != "It crashes" || feedback.UserID != 1 {
+		t.Fatalf("feedback = %+v, want the question", feedback)
+	}
+}
+
+func TestNotifyQuestionSkippedWithoutDelivery(t *testing.T) {
+	app, api := newTestApp(t)
+	api.fail("sendMessage", 403, "Forbidden: bot was blocked by the user")
+	if feedback := notifiedQuestion(t, app); feedback != nil {
+		t.Fatalf("notified %+v, the question reached no employee", feedback)
+	}
+}
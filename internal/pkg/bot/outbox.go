@@ -0,0 +1,185 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	l "telegram-bot-feedback/internal/pkg/logger"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+	"time"
+)
+
+// Outbox settings
+const (
+	// outboxInterval is how often the outbox is checked
+	outboxInterval = 2 * time.Second
+	// outboxMaxAttempts is how many times a message is sent before it is marked dead
+	outboxMaxAttempts = 10
+	// outboxBaseDelay is the delay after the first failure, it doubles with every attempt
+	outboxBaseDelay = 5 * time.Second
+	// outboxMaxDelay is the longest delay between attempts
+	outboxMaxDelay = 30 * time.Minute
+	// outboxDeadShown is how many dead messages /outbox shows
+	outboxDeadShown = 10
+)
+
+// sendToUser sends the reply to the user through the outbox
+//
+// The message is sent at once unless earlier messages to the chat are waiting, then or after a transient
+// failure it is queued to keep the order, after a failure it waits for the first backoff delay. Returns the error only if the message can't be delivered at all
+func sendToUser(chatId int, message tg.Config, question *database.Question, app *App) error {
+	method := outboxMethod(message)
+	if method == "" {
+		_, err := app.Bot.Send(message)
+		return l.Err(err)
+	}
+	next := clock()
+	if !database.HasOutboxMessages(chatId, app.DB) {
+		_, err := app.Bot.Send(message)
+		if err == nil {
+			markAnswered(question, app)
+			return nil
+		}
+		if !isTransientError(err) {
+			return l.Err(err)
+		}
+		l.Error(l.Err(err))
+		next = next.Add(outboxDelay(1, err))
+	}
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return l.Err(err)
+	}
+	return database.AddOutboxMessage(chatId, method, string(payload), int(question.ID), next, app.DB)
+}
+
+// outboxMethod returns the Bot API method of the message or empty string if the outbox doesn't support it
+func outboxMethod(message tg.Config) string {
+	switch message.(type) {
+	case tg.CopyMessageConf:
+		return "copyMessage"
+	case tg.SendMessageConf:
+		return "sendMessage"
+	}
+	return ""
+}
+
+// isTransientError reports whether sending may succeed later: network errors, flood limits and server errors
+func isTransientError(err error) bool {
+	if errors.Is(err, tg.ErrEmptyText) {
+		return false
+	}
+	apiErr, ok := tg.AsError(err)
+	if !ok {
+		return true
+	}
+	return apiErr.IsTooManyRequests() || apiErr.Code >= 500
+}
+
+// runOutbox delivers queued messages until ctx is done
+func runOutbox(ctx context.Context, app *App) {
+	ticker := time.NewTicker(outboxInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			releaseQuietMessages(app)
+			drainOutbox(ctx, app)
+		}
+	}
+}
+
+// drainOutbox sends the due message of every chat, one message per chat keeps the order
+func drainOutbox(ctx context.Context, app *App) {
+	for _, message := range database.GetDueOutboxMessages(clock(), app.DB) {
+		if ctx.Err() != nil {
+			return
+		}
+		message := message
+		resp, err := app.Bot.MakeRequestWithContext(ctx, message.Method, json.RawMessage(message.Payload))
+		switch {
+		case err == nil:
+			err = database.RemoveOutboxMessage(&message, app.DB)
+			if err != nil {
+				l.Error(err)
+			}
+			if message.Method == "sendPoll" {
+				saveSurvey(resp, message.QuestionID, app)
+				continue
+			}
+			if question := database.GetQuestionById(message.QuestionID, app.DB); question != nil {
+				// The answer is already saved, the reaction is still due
+				question.HaveAnswer = false
+				markAnswered(question, app)
+			}
+		case ctx.Err() != nil:
+			return
+		case !isTransientError(err) || message.Attempts+1 >= outboxMaxAttempts:
+			l.Error(l.Err(err))
+			err = database.ChangeOutboxMessageIsDead(err.Error(), &message, app.DB)
+			if err != nil {
+				l.Error(err)
+			}
+		default:
+			err = database.ChangeOutboxMessageAttempt(err.Error(), clock().Add(outboxDelay(message.Attempts+1, err)), &message, app.DB)
+			if err != nil {
+				l.Error(err)
+			}
+		}
+	}
+}
+
+// saveSurvey stores the ID of the satisfaction poll sent from the outbox in the Question
+func saveSurvey(resp *tg.APIResponse, questionId int, app *App) {
+	sent := tg.Message{}
+	err := json.Unmarshal(resp.Result, &sent)
+	if err != nil {
+		l.Error(l.Err(err))
+		return
+	}
+	question := database.GetQuestionById(questionId, app.DB)
+	if question == nil || sent.Poll == nil {
+		return
+	}
+	err = database.ChangeQuestionSurvey(sent.Poll.ID, question, app.DB)
+	if err != nil {
+		l.Error(err)
+	}
+}
+
+// outboxDelay returns the exponential delay after the attempt, not shorter than Telegram asks
+func outboxDelay(attempt int, err error) time.Duration {
+	delay := outboxBaseDelay
+	for i := 1; i < attempt && delay < outboxMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > outboxMaxDelay {
+		delay = outboxMaxDelay
+	}
+	if retryAfter, ok := tg.RetryAfter(err); ok && retryAfter > delay {
+		delay = retryAfter
+	}
+	return delay
+}
+
+// sendOutbox sends the outbox depth and the last dead messages to the employee
+func sendOutbox(user *database.User, app *App) error {
+	stats := database.GetOutboxStats(app.DB)
+	var b strings.Builder
+	b.WriteString("Pending: " + strconv.Itoa(int(stats.Pending)) + "\nDead: " + strconv.Itoa(int(stats.Dead)) +
+		"\nHeld for quiet hours: " + strconv.Itoa(int(database.CountQuietMessages(app.DB))))
+	for _, message := range database.GetDeadOutboxMessages(outboxDeadShown, app.DB) {
+		b.WriteString("\n\n" + message.CreatedAt.Format(historyTimeLayout) + " chat " + strconv.Itoa(message.ChatID))
+		if message.QuestionID != 0 {
+			b.WriteString(", question #" + strconv.Itoa(message.QuestionID))
+		}
+		b.WriteString("\n" + message.Error)
+	}
+	_, err := app.Bot.Send(tg.NewMessage(user.ChatID, b.String()))
+	return l.Err(err)
+}
@@ -0,0 +1,123 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+	"testing"
+	"time"
+)
+
+// drainOutboxAt drains the outbox at the time
+func drainOutboxAt(t *testing.T, app *App, now time.Time) {
+	setClock(t, func() time.Time { return now })
+	drainOutbox(context.Background(), app)
+}
+
+func TestOutboxKeepsOrderAfterTransientFailure(t *testing.T) {
+	app, api := newTestApp(t)
+	question := answeredQuestion(t, app)
+	api.failChat("sendMessage", 1, apiError(http.StatusInternalServerError, "Internal Server Error", 0))
+	if err := sendToUser(1, tg.NewMessage(1, "first"), question, app); err != nil {
+		t.Fatal(err)
+	}
+	// The second reply waits behind the first one
+	if err := sendToUser(1, tg.NewMessage(1, "second"), question, app); err != nil {
+		t.Fatal(err)
+	}
+	if sent := api.sentTo(1); len(sent) != 1 || sent[0] != "first" {
+		t.Fatalf("sent = %q, want only the failed attempt", sent)
+	}
+	if err := database.ChangeUserState(SMain, database.GetUserByChatID(2, app.DB), app.DB); err != nil {
+		t.Fatal(err)
+	}
+	parseMessage(commandMessage(2, "/outbox"), app)
+	if got := lastSent(api, 2); !strings.HasPrefix(got, "Pending: 2\nDead: 0\n") {
+		t.Fatalf("/outbox = %q", got)
+	}
+
+	// Nothing is resent before the backoff delay
+	now := time.Now()
+	drainOutboxAt(t, app, now)
+	if len(api.sentTo(1)) != 1 {
+		t.Fatalf("sent before the delay = %q", api.sentTo(1))
+	}
+	for i := 1; i <= 2; i++ {
+		drainOutboxAt(t, app, now.Add(time.Duration(i)*time.Minute))
+	}
+	if sent := api.sentTo(1); strings.Join(sent, ",") != "first,first,second" {
+		t.Fatalf("sent = %q, want the replies in order", sent)
+	}
+	if database.HasOutboxMessages(1, app.DB) {
+		t.Fatal("delivered messages are kept")
+	}
+}
+
+func TestOutboxMarksPermanentFailuresDead(t *testing.T) {
+	app, api := newTestApp(t)
+	question := answeredQuestion(t, app)
+	// A permanent error of the first attempt is returned at once
+	api.failChat("sendMessage", 1, apiError(http.StatusForbidden, "Forbidden: bot was blocked by the user", 0))
+	if err := sendToUser(1, tg.NewMessage(1, "blocked"), question, app); err == nil {
+		t.Fatal("the permanent error is not returned")
+	}
+	if database.HasOutboxMessages(1, app.DB) {
+		t.Fatal("the message is queued after the permanent error")
+	}
+
+	api.failChat("sendMessage", 1,
+		apiError(http.StatusTooManyRequests, "Too Many Requests: retry after 600", 600),
+		apiError(http.StatusBadRequest, "Bad Request: chat not found", 0))
+	if err := sendToUser(1, tg.NewMessage(1, "queued"), question, app); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	// Telegram asks to wait longer than the backoff
+	drainOutboxAt(t, app, now.Add(time.Minute))
+	if len(api.sentTo(1)) != 2 {
+		t.Fatalf("sent before retry_after = %q", api.sentTo(1))
+	}
+	drainOutboxAt(t, app, now.Add(11*time.Minute))
+	if database.HasOutboxMessages(1, app.DB) {
+		t.Fatal("the message is still waiting after the permanent error")
+	}
+	drainOutboxAt(t, app, now.Add(time.Hour))
+	if len(api.sentTo(1)) != 3 {
+		t.Fatalf("the dead message is resent: %q", api.sentTo(1))
+	}
+	if err := sendOutbox(database.GetUserByChatID(2, app.DB), app); err != nil {
+		t.Fatal(err)
+	}
+	if got := lastSent(api, 2); !strings.HasPrefix(got, "Pending: 0\nDead: 1\n") || !strings.Contains(got, "chat 1, question #1\nBad Request: chat not found") {
+		t.Fatalf("/outbox = %q", got)
+	}
+}
+
+func TestOutboxDelay(t *testing.T) {
+	if d := outboxDelay(1, nil); d != outboxBaseDelay {
+		t.Fatalf("the first delay = %s", d)
+	}
+	if d := outboxDelay(3, nil); d != 4*outboxBaseDelay {
+		t.Fatalf("the third delay = %s", d)
+	}
+	if d := outboxDelay(30, nil); d != outboxMaxDelay {
+		t.Fatalf("the delay is not capped: %s", d)
+	}
+}
+
+func TestEmptyTextIsNotQueued(t *testing.T) {
+	app, api := newTestApp(t)
+	question := answeredQuestion(t, app)
+	if err := sendToUser(1, tg.NewMessage(1, " "), question, app); !errors.Is(err, tg.ErrEmptyText) {
+		t.Fatalf("err = %v, want ErrEmptyText", err)
+	}
+	if isTransientError(tg.ErrEmptyText) {
+		t.Fatal("empty text is retried")
+	}
+	if database.HasOutboxMessages(1, app.DB) || len(api.requests()) != 0 {
+		t.Fatal("the empty text is queued or sent")
+	}
+}
@@ -5,7 +5,9 @@ import (
 	"strings"
 	"telegram-bot-feedback/internal/pkg/database"
 	l "telegram-bot-feedback/internal/pkg/logger"
+	"telegram-bot-feedback/internal/pkg/metrics"
 	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+	"time"
 )
 
 // User states
@@ -23,6 +25,17 @@ const (
 // Callback data types
 const (
 	CBQuestion int = iota + 1
+	CBCategory
+	CBCategoryPage
+	CBHelpPage
+	CBFindPage
+	CBReviewApprove
+	CBReviewNeedsWork
+	CBReviewSkip
+	CBPin
+	CBUnpin
+	CBSettings
+	CBTriage
 )
 
 // Date intervals
@@ -34,7 +47,23 @@ const (
 )
 
 // parseUpdate parse bot Update
+//
+// The Update is handled once, an error is logged and the next Update goes on
 func parseUpdate(update *tg.Update, app *App) (err error) {
+	from := update.SentFrom()
+	if !app.filterUpdate(update) || (from != nil && isBanned(from, app)) {
+		return nil
+	}
+	if from != nil {
+		updateProfile(from, app)
+	}
+	if handled, err := app.handleUpdate(update); handled {
+		// Handled Updates are not retried, a payment must not be processed twice
+		if err != nil {
+			l.Error(err)
+		}
+		return nil
+	}
 	if update.Message != nil {
 		err = parseMessage(update.Message, app)
 		if err != nil {
@@ -47,15 +76,93 @@ func parseUpdate(update *tg.Update, app *App) (err error) {
 			l.Err(err)
 		}
 	}
-	if err == nil {
-		app.Conf.Set("offset", update.UpdateID+1)
-		err = app.Conf.WriteConfig()
+	if update.PollAnswer != nil {
+		err = parsePollAnswer(update.PollAnswer, app)
+		if err != nil {
+			l.Err(err)
+		}
+	}
+	if update.MyChatMember != nil {
+		err = parseMyChatMember(update.MyChatMember, app)
+		if err != nil {
+			l.Err(err)
+		}
 	}
 	return l.Err(err)
 }
 
+// parsedUpdates are the Update types parseUpdate handles
+var parsedUpdates = []string{tg.UpdateTypeMessage, tg.UpdateTypeCallbackQuery, tg.UpdateTypePollAnswer, tg.UpdateTypeMyChatMember}
+
+// allowedUpdates returns the Update types the bot requests from Telegram
+//
+// The types parsed by the bot and declared by the enabled plugins, "allowed_updates" overrides them
+func (app *App) allowedUpdates() []string {
+	if types := app.Conf.GetStringSlice("allowed_updates"); len(types) > 0 {
+		return types
+	}
+	types := append([]string{}, parsedUpdates...)
+	seen := map[string]bool{}
+	for _, t := range types {
+		seen[t] = true
+	}
+	for _, plugin := range app.plugins {
+		provider, ok := plugin.(UpdateTypesProvider)
+		if !ok {
+			continue
+		}
+		for _, t := range provider.UpdateTypes() {
+			if !seen[t] {
+				seen[t] = true
+				types = append(types, t)
+			}
+		}
+	}
+	return types
+}
+
+// updateType returns the type of the Update for metrics
+func updateType(update *tg.Update) string {
+	switch {
+	case update.Message != nil:
+		return "message"
+	case update.EditedMessage != nil:
+		return "edited_message"
+	case update.CallbackQuery != nil:
+		return "callback_query"
+	case update.PollAnswer != nil:
+		return "poll_answer"
+	case update.Poll != nil:
+		return "poll"
+	case update.MyChatMember != nil:
+		return "my_chat_member"
+	}
+	return "other"
+}
+
 // parseMessage parse Message
 func parseMessage(message *tg.Message, app *App) (err error) {
+	if message.MigrateToChatID != 0 || message.MigrateFromChatID != 0 {
+		return l.Err(migrateAdminChat(message, app))
+	}
+	if message.From == nil || message.From.IsBot {
+		return nil
+	}
+	if !message.Chat.IsPrivate() {
+		switch message.Command() {
+		case "help":
+			return l.Err(helpInGroup(message, app))
+		case "start":
+			return l.Err(recordGroupSource(message, app))
+		}
+		if message.IsTopicMessage && message.Chat.ID == adminChat(app) {
+			return l.Err(parseTopicMessage(message, app))
+		}
+		return l.Err(parseGroupMessage(message, app))
+	}
+	if !allowMessage(message, app) {
+		return nil
+	}
 	if isCommand, err := parseCommand(message, app); isCommand {
 		return l.Err(err)
 	}
@@ -63,12 +170,44 @@ func parseMessage(message *tg.Message, app *App) (err error) {
 	if user == nil {
 		return l.Err(l.NewError("User " + strconv.Itoa(int(message.From.ID)) + " is not found"))
 	}
+	if user.IsBlocked {
+		err = database.ChangeUserIsBlocked(false, user, app.DB)
+		if err != nil {
+			return l.Err(err)
+		}
+	}
 	if user.IsEmployee {
 		return l.Err(parseMessageEmployee(user, message, app))
 	}
+	if message.WebAppData != nil {
+		return l.Err(submitFeedbackForm(message, user, app))
+	}
 	return l.Err(parseMessageUser(user, message, app))
 }
 
+// allowMessage limits messages from users to "rate_limit" per minute
+//
+// Messages over the limit are dropped, the user is asked to slow down once per minute
+func allowMessage(message *tg.Message, app *App) bool {
+	limit := app.Conf.GetInt("rate_limit")
+	if limit <= 0 {
+		return true
+	}
+	if user := database.GetUserByChatID(message.From.ID, app.DB); user != nil && user.IsEmployee {
+		return true
+	}
+	if app.messages.allow(message.From.ID, limit, time.Minute) {
+		return true
+	}
+	if app.messages.notifyOnce(message.From.ID, time.Minute) {
+		_, err := app.Bot.Send(tg.NewMessage(message.Chat.ID, translate(message.From.LanguageCode, MsgSlowDown)))
+		if err != nil {
+			l.Error(l.Err(err))
+		}
+	}
+	return false
+}
+
 // parseMessageUser parse Message from user
 func parseMessageUser(user *database.User, message *tg.Message, app *App) (err error) {
 	switch user.State {
@@ -121,10 +260,12 @@ func parseMessageUser(user *database.User, message *tg.Message, app *App) (err e
 	case SReviewText:
 		switch message.Text {
 		case "❌Close":
+			review := database.GetEmptyReview(user, app.DB)
 			err := database.ChangeTextReviewByUser("-", user, app.DB)
 			if err != nil {
 				return l.Err(err)
 			}
+			notifyReview(review, "", user, app)
 			err = database.ChangeUserState(SMain, user, app.DB)
 			if err != nil {
 				return l.Err(err)
@@ -135,10 +276,12 @@ func parseMessageUser(user *database.User, message *tg.Message, app *App) (err e
 			}
 			return l.Err(err)
 		default:
-			err := database.ChangeTextReviewByUser(message.Text, user, app.DB)
+			review := database.GetEmptyReview(user, app.DB)
+			err := database.ChangeTextReviewByUser(messageText(message), user, app.DB)
 			if err != nil {
 				return l.Err(err)
 			}
+			notifyReview(review, messageText(message), user, app)
 			err = database.ChangeUserState(SMain, user, app.DB)
 			if err != nil {
 				return l.Err(err)
@@ -162,20 +305,35 @@ func parseMessageUser(user *database.User, message *tg.Message, app *App) (err e
 			}
 			return l.Err(err)
 		default:
-			question, err := database.AddQuestion(message.Text, user, app.DB)
+			question, err := database.AddQuestion(questionHeader(message), message.MessageID, user, app.DB)
 			if err != nil {
 				return l.Err(err)
 			}
-			questions := []database.Question{*question}
-			receivers := database.GetReceivers(app.DB)
-			for _, receiver := range receivers {
-				sendQuestions(&receiver, app.Bot, questions)
+			if user.CategoryID != 0 {
+				err = database.ChangeUserCategory(0, user, app.DB)
+				if err != nil {
+					return l.Err(err)
+				}
+			}
+			metrics.Submissions.Inc("question")
+			err = recordShare(message, question, app)
+			if err != nil {
+				return l.Err(err)
 			}
+			if mediaType(message) != "" {
+				_, err = database.AddCorrespondenceToQuestion(question, user, message.MessageID, questionHeader(message), app.DB)
+				if err != nil {
+					return l.Err(err)
+				}
+			}
+			app.emit(Event{Type: EventQuestionOpened, Question: question})
+			delivered := sendNewQuestion(question, message, app)
+			notifyQuestion(delivered, question, user, app)
 			err = database.ChangeUserState(SQuestionDiscussion, user, app.DB)
 			if err != nil {
 				return l.Err(err)
 			}
-			err = responser(user, app)
+			err = acknowledgeQuestion(message, user, app)
 			if err != nil {
 				database.ChangeUserState(SQuestion, user, app.DB)
 			}
@@ -190,16 +348,16 @@ func parseMessageUser(user *database.User, message *tg.Message, app *App) (err e
 			}
 			question := database.GetOpenQuestionByUser(user, app.DB)
 			if question != nil {
-				_, err = database.AddCorrespondence(user, message.MessageID, app.DB)
+				_, err = database.AddCorrespondence(user, message.MessageID, questionHeader(message), app.DB)
 				if err != nil {
 					return l.Err(err)
 				}
-				err = database.ChangeQuestionIsClosed(true, question, app.DB)
+				err = closeQuestion(question, app)
 				if err != nil {
 					return l.Err(err)
 				}
 				if question.Answerer.ID != 0 {
-					err = sendCorrespondenceFromUser(question, message, app.Bot)
+					err = sendCorrespondenceFromUser(question, message, app)
 					if err != nil {
 						return l.Err(err)
 					}
@@ -216,17 +374,30 @@ func parseMessageUser(user *database.User, message *tg.Message, app *App) (err e
 				return nil
 			}
 			if question.Answerer.ID != 0 {
-				err = sendCorrespondenceFromUser(question, message, app.Bot)
+				err = sendCorrespondenceFromUser(question, message, app)
+				if err != nil {
+					return l.Err(err)
+				}
+				err = awaitReply(question, app)
 				if err != nil {
 					return l.Err(err)
 				}
 			}
+			sendToTopic(question, message, app)
 			err = database.ChangeQuestionHaveAnswer(false, question, app.DB)
 			if err != nil {
 				return l.Err(err)
 			}
-			_, err = database.AddCorrespondence(user, message.MessageID, app.DB)
-			return l.Err(err)
+			_, err = database.AddCorrespondence(user, message.MessageID, questionHeader(message), app.DB)
+			if err != nil {
+				return l.Err(err)
+			}
+			err = recordShare(message, question, app)
+			if err != nil {
+				return l.Err(err)
+			}
+			app.emit(Event{Type: EventQuestionMessage, Question: question, Text: questionHeader(message)})
+			return nil
 		}
 	default:
 		return nil
@@ -235,6 +406,9 @@ func parseMessageUser(user *database.User, message *tg.Message, app *App) (err e
 
 // parseMessageUser parse Message from employee
 func parseMessageEmployee(user *database.User, message *tg.Message, app *App) (err error) {
+	if question := linkedQuestion(message, app); question != nil {
+		return l.Err(answerLinkedQuestion(question, user, message, app))
+	}
 	switch user.State {
 	case SNew:
 		return database.ChangeUserState(SMain, user, app.DB)
@@ -263,7 +437,7 @@ func parseMessageEmployee(user *database.User, message *tg.Message, app *App) (e
 				}
 				return l.Err(responser(user, app))
 			}
-			sendQuestions(user, app.Bot, questions)
+			sendQuestions(user, app, questions)
 			return l.Err(err)
 		case "⭐Reviews":
 			err := database.ChangeUserState(SReview, user, app.DB)
@@ -328,6 +502,10 @@ func parseMessageEmployee(user *database.User, message *tg.Message, app *App) (e
 				if err != nil {
 					return l.Err(err)
 				}
+				err = stopAwaitingReply(question, app)
+				if err != nil {
+					return l.Err(err)
+				}
 			}
 			err = responser(user, app)
 			if err != nil {
@@ -337,7 +515,7 @@ func parseMessageEmployee(user *database.User, message *tg.Message, app *App) (e
 		default:
 			question := database.GetOpenQuestionByAnswerer(user, app.DB)
 			if question != nil {
-				err = sendCorrespondenceFromAnswerer(question, message, app.Bot)
+				err = sendCorrespondenceFromAnswerer(question, message, app)
 				if err != nil {
 					return l.Err(err)
 				}
@@ -345,7 +523,11 @@ func parseMessageEmployee(user *database.User, message *tg.Message, app *App) (e
 				if err != nil {
 					return l.Err(err)
 				}
-				_, err = database.AddCorrespondence(user, message.MessageID, app.DB)
+				err = stopAwaitingReply(question, app)
+				if err != nil {
+					return l.Err(err)
+				}
+				_, err = database.AddCorrespondence(user, message.MessageID, questionHeader(message), app.DB)
 				return l.Err(err)
 			}
 			return nil
@@ -363,6 +545,9 @@ func parseMessageEmployee(user *database.User, message *tg.Message, app *App) (e
 			}
 			return l.Err(err)
 		default:
+			if strings.Contains(message.Text, "=") {
+				return l.Err(findQuestionsByField(message.Text, user, app))
+			}
 			loadFullQuestionById(message.Text, user, app)
 			return nil
 		}
@@ -373,23 +558,40 @@ func parseMessageEmployee(user *database.User, message *tg.Message, app *App) (e
 
 // parseCommand parse commands
 func parseCommand(message *tg.Message, app *App) (bool, error) {
-	switch message.Text {
-	case "/start":
+	if _, bot, found := strings.Cut(message.CommandWithAt(), "@"); found && !strings.EqualFold(bot, app.Bot.Self.UserName) {
+		return true, nil
+	}
+	switch message.Command() {
+	case "start":
+		firstContact := database.GetUserByChatID(message.From.ID, app.DB) == nil
 		user, err := database.AddUser(message.From.ID, message.From.UserName, SNew, app.DB)
 		if err != nil {
 			return true, l.Err(err)
 		}
+		err = recordSource(message, user, firstContact, app)
+		if err != nil {
+			l.Error(err)
+		}
 		question := database.GetOpenQuestionByUser(user, app.DB)
 		if question != nil {
-			err = database.ChangeQuestionIsClosed(true, question, app.DB)
+			err = closeQuestion(question, app)
 			if err != nil {
 				return true, l.Err(err)
 			}
 		}
-		err = responserCommand(message.Text, user, app)
+		err = responserCommand(message, user, app)
+		if err == nil && message.CommandArguments() == helpStartPayload {
+			err = sendHelp(user, app)
+		}
 		return true, l.Err(err)
-	default:
+	case "":
 		return false, nil
+	default:
+		user := database.GetUserByChatID(message.From.ID, app.DB)
+		if user == nil {
+			return false, nil
+		}
+		return true, l.Err(responserCommand(message, user, app))
 	}
 }
 
@@ -399,6 +601,20 @@ func parseCallback(callback *tg.CallbackQuery, app *App) error {
 	if user == nil {
 		return l.Err(l.NewError("User " + strconv.Itoa(int(callback.Message.Chat.ID)) + " is not found"))
 	}
+	switch key, data := splitCallbackData(callback); {
+	case key == CBHelpPage:
+		return l.Err(turnHelpPage(data, user, callback, app))
+	case key == CBFindPage && user.IsEmployee:
+		return l.Err(turnFindPage(data, user, callback, app))
+	case (key == CBReviewApprove || key == CBReviewNeedsWork || key == CBReviewSkip) && user.IsEmployee:
+		return l.Err(answerReview(key, data, user, callback, app))
+	case key == CBSettings:
+		return l.Err(changeQuietSettings(data, user, callback, app))
+	case (key == CBPin || key == CBUnpin) && user.IsEmployee:
+		return l.Err(togglePin(key == CBPin, data, callback, app))
+	case key == CBTriage && user.IsEmployee:
+		return l.Err(triage(data, user, callback, app))
+	}
 	if user.IsEmployee {
 		return l.Err(parseCallbackEmployee(user, callback, app))
 	}
@@ -406,10 +622,16 @@ func parseCallback(callback *tg.CallbackQuery, app *App) error {
 }
 
 // parseCallbackUser parse CallbackQuery from user
-//
-// (not used)
 func parseCallbackUser(user *database.User, callback *tg.CallbackQuery, app *App) (err error) {
-	return nil
+	key, data := splitCallbackData(callback)
+	switch key {
+	case CBCategory:
+		return l.Err(chooseCategory(data, user, callback, app))
+	case CBCategoryPage:
+		return l.Err(turnCategoryPage(data, callback, app))
+	default:
+		return l.Err(answerCallback(callback, app))
+	}
 }
 
 // parseCallbackUser parse CallbackQuery from employee
@@ -423,6 +645,14 @@ func parseCallbackEmployee(user *database.User, callback *tg.CallbackQuery, app
 			if err != nil {
 				return l.Err(l.NewError("no id"))
 			}
+			if database.GetNewQuestionById(id, app.DB) == nil {
+				_, err := app.Bot.Request(tg.NewCallbackWithAlert(callback.ID, "Question already taken"))
+				return l.Err(err)
+			}
+			err = answerCallback(callback, app)
+			if err != nil {
+				l.Error(err)
+			}
 			err = loadCorrespondence(id, user, app)
 			if err != nil {
 				return l.Err(err)
@@ -437,13 +667,19 @@ func parseCallbackEmployee(user *database.User, callback *tg.CallbackQuery, app
 			}
 			return l.Err(err)
 		default:
-			return nil
+			return l.Err(answerCallback(callback, app))
 		}
 	default:
-		return nil
+		return l.Err(answerCallback(callback, app))
 	}
 }
 
+// answerCallback stops the loading animation of the button without a notification
+func answerCallback(callback *tg.CallbackQuery, app *App) error {
+	_, err := app.Bot.Request(tg.NewCallback(callback.ID, ""))
+	return l.Err(err)
+}
+
 // parseReview parse rating Review
 func parseReview(rating string, user *database.User, app *App) error {
 	var r int
@@ -460,7 +696,66 @@ func parseReview(rating string, user *database.User, app *App) error {
 		r = 5
 	}
 	review := database.Review{User: *user, Rating: r}
-	return l.Err(app.DB.Save(&review).Error)
+	err := app.DB.Save(&review).Error
+	if err == nil {
+		metrics.Submissions.Inc("review")
+	}
+	return l.Err(err)
+}
+
+// messageText returns Text or Caption of the Message
+func messageText(message *tg.Message) string {
+	if message.Text != "" {
+		return message.Text
+	}
+	return message.Caption
+}
+
+// mediaType returns the type of attachment of the Message or empty string
+func mediaType(message *tg.Message) string {
+	switch {
+	case len(message.Photo) > 0:
+		return "photo"
+	case message.Video != nil:
+		return "video"
+	case message.Animation != nil:
+		return "animation"
+	case message.Document != nil:
+		return "document"
+	case message.Voice != nil:
+		return "voice"
+	case message.Audio != nil:
+		return "audio"
+	case message.VideoNote != nil:
+		return "video note"
+	case message.Sticker != nil:
+		return "sticker"
+	}
+	return ""
+}
+
+// questionHeader returns the Question header from the first Message
+func questionHeader(message *tg.Message) string {
+	if item := messageShare(message); item != nil {
+		return shareText(item)
+	}
+	text := messageText(message)
+	if media := mediaType(message); media != "" {
+		return strings.TrimSpace("[" + media + "] " + text)
+	}
+	return text
+}
+
+// questionEntities returns the formatting of questionHeader
+func questionEntities(message *tg.Message) []*tg.MessageEntity {
+	entities := message.Entities
+	if message.Text == "" {
+		entities = message.CaptionEntities
+	}
+	if media := mediaType(message); media != "" {
+		return quoteEntities("["+media+"] ", entities)
+	}
+	return entities
 }
 
 // splitCallbackData split data from CallbackQuery
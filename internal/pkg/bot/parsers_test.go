@@ -0,0 +1,57 @@
+package bot
+
+import (
+	"telegram-bot-feedback/internal/pkg/database"
+	"testing"
+)
+
+func TestCommandsOfOtherBotsAreIgnored(t *testing.T) {
+	app, api := newTestApp(t)
+	if _, err := database.AddUser(1, "user1", SMain, app.DB); err != nil {
+		t.Fatal(err)
+	}
+	parseMessage(commandMessage(1, "/mytickets@other_bot"), app)
+	if sent := api.sentTo(1); len(sent) != 0 {
+		t.Fatalf("the command of another bot is answered: %q", sent)
+	}
+	parseMessage(commandMessage(1, "/mytickets@Feedback_Bot"), app)
+	if len(api.sentTo(1)) == 0 {
+		t.Fatal("the command addressed to the bot is not answered")
+	}
+}
+
+func TestRateLimitDropsBurst(t *testing.T) {
+	app, api := newTestApp(t)
+	app.Conf.Set("rate_limit", 3)
+	answeredQuestion(t, app)
+	for i := 0; i < 8; i++ {
+		parseMessage(privateMessage(1, 10+i, "spam"), app)
+	}
+	relayed := 0
+	for _, call := range api.requests("forwardMessage", "copyMessage") {
+		if call.chatID() == 2 {
+			relayed++
+		}
+	}
+	if relayed != 3 {
+		t.Fatalf("%d messages relayed, want 3", relayed)
+	}
+	if notices := api.sentTo(1); len(notices) != 1 || notices[0] != translate("", MsgSlowDown) {
+		t.Fatalf("the user got %q", notices)
+	}
+}
+
+func TestRateLimitSkipsEmployees(t *testing.T) {
+	app, api := newTestApp(t)
+	app.Conf.Set("rate_limit", 1)
+	answeredQuestion(t, app)
+	if err := database.ChangeUserState(SQuestionDiscussion, database.GetUserByChatID(2, app.DB), app.DB); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		parseMessage(privateMessage(2, 10+i, "answer"), app)
+	}
+	if copies := api.requests("copyMessage", "forwardMessage"); len(copies) != 3 {
+		t.Fatalf("%d answers relayed, want 3", len(copies))
+	}
+}
@@ -0,0 +1,139 @@
+package bot
+
+import (
+	"strconv"
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	l "telegram-bot-feedback/internal/pkg/logger"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+)
+
+// Employee permissions
+const (
+	PermBroadcastAll     = "broadcast:all"
+	PermBroadcastSegment = "broadcast:segment"
+	PermExport           = "export"
+	PermBan              = "ban"
+	PermRollout          = "rollout"
+	PermReview           = "review"
+)
+
+// allPermissions are the permissions of employees without a role
+var allPermissions = []string{PermBroadcastAll, PermBroadcastSegment, PermExport, PermBan, PermRollout, PermReview}
+
+// employeeCommands are the built-in employee commands with the permission they need, "" means any employee
+//
+// Commands missing here are refused, so every new command has to be declared in builtinCommands
+var employeeCommands = func() map[string]string {
+	commands := map[string]string{}
+	for _, spec := range builtinCommands {
+		if spec.Audience&AudienceEmployee != 0 {
+			commands[spec.Name] = spec.Permission
+		}
+	}
+	return commands
+}()
+
+// permissions returns the permissions of the employee role from "roles" in the configuration
+//
+// Employees without a role have all permissions
+func permissions(user *database.User, app *App) []string {
+	if user.Role == "" {
+		return allPermissions
+	}
+	return app.Conf.GetStringSlice("roles." + user.Role)
+}
+
+// hasPermission reports whether the employee has the permission, broadcast:all includes broadcast:segment
+func hasPermission(user *database.User, permission string, app *App) bool {
+	if permission == "" {
+		return true
+	}
+	for _, p := range permissions(user, app) {
+		if p == permission || permission == PermBroadcastSegment && p == PermBroadcastAll {
+			return true
+		}
+	}
+	return false
+}
+
+// authorize reports whether the employee may run the command with the permission, otherwise tells the employee why not
+func authorize(permission string, user *database.User, app *App) (bool, error) {
+	if hasPermission(user, permission, app) {
+		return true, nil
+	}
+	_, err := app.Bot.Send(tg.NewMessage(user.ChatID, "You need the \""+permission+"\" permission"))
+	return false, l.Err(err)
+}
+
+// sendAdmins sends the employees with their roles and effective permissions
+func sendAdmins(user *database.User, app *App) error {
+	var b strings.Builder
+	for _, employee := range database.GetEmployees(app.DB) {
+		employee := employee
+		b.WriteString(userName(&employee))
+		if employee.ChatID == user.ChatID {
+			b.WriteString(" (you)")
+		}
+		role := employee.Role
+		if role == "" {
+			role = "full access"
+		}
+		b.WriteString("\nRole: " + role + "\nPermissions: ")
+		if perms := permissions(&employee, app); len(perms) > 0 {
+			b.WriteString(strings.Join(perms, ", "))
+		} else {
+			b.WriteString("none")
+		}
+		b.WriteString("\n\n")
+	}
+	text := strings.TrimSpace(b.String())
+	if text == "" {
+		text = "No employees"
+	}
+	_, err := app.Bot.Send(tg.NewMessage(user.ChatID, text))
+	return l.Err(err)
+}
+
+// segmentCommand handles /segment add|del <segment> <user_id...> and /segment to list segments
+func segmentCommand(message *tg.Message, user *database.User, app *App) error {
+	args := strings.Fields(message.CommandArguments())
+	if len(args) == 0 {
+		var b strings.Builder
+		for _, segment := range database.GetSegments(app.DB) {
+			b.WriteString(segment.Name + " - " + strconv.Itoa(int(segment.Users)) + "\n")
+		}
+		text := b.String()
+		if text == "" {
+			text = "No segments\n/segment add|del <segment> <user_id...>"
+		}
+		_, err := app.Bot.Send(tg.NewMessage(user.ChatID, text))
+		return l.Err(err)
+	}
+	if len(args) < 3 || (args[0] != "add" && args[0] != "del") || !aliasName.MatchString(args[1]) {
+		_, err := app.Bot.Send(tg.NewMessage(user.ChatID, "Format: /segment add|del <segment> <user_id...>, segment is 1-32 characters a-z, 0-9 or _"))
+		return l.Err(err)
+	}
+	changed := 0
+	for _, arg := range args[2:] {
+		id, err := strconv.Atoi(arg)
+		if err != nil {
+			continue
+		}
+		target := database.GetUserByChatID(id, app.DB)
+		if target == nil {
+			continue
+		}
+		if args[0] == "add" {
+			err = database.AddUserToSegment(args[1], target, app.DB)
+		} else {
+			err = database.RemoveUserFromSegment(args[1], target, app.DB)
+		}
+		if err != nil {
+			return l.Err(err)
+		}
+		changed++
+	}
+	_, err := app.Bot.Send(tg.NewMessage(user.ChatID, "Segment "+args[1]+": "+strconv.Itoa(changed)+" users changed"))
+	return l.Err(err)
+}
@@ -0,0 +1,205 @@
+package bot
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	"testing"
+	"time"
+)
+
+// operator makes admin 2 an employee with the role and the permissions
+func operator(t *testing.T, app *App, permissions ...string) *database.User {
+	t.Helper()
+	app.Conf.Set("roles.operator", permissions)
+	employee := database.GetUserByChatID(2, app.DB)
+	if err := database.ChangeUserRole("operator", employee, app.DB); err != nil {
+		t.Fatal(err)
+	}
+	return database.GetUserByChatID(2, app.DB)
+}
+
+// waitBroadcast waits for the running broadcast to finish
+func waitBroadcast(t *testing.T, app *App) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for app.broadcaster.running() {
+		if time.Now().After(deadline) {
+			t.Fatal("the broadcast doesn't finish")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestEveryEmployeeCommandDeclaresPermission(t *testing.T) {
+	file, err := parser.ParseFile(token.NewFileSet(), "events.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handled := 0
+	ast.Inspect(file, func(node ast.Node) bool {
+		function, ok := node.(*ast.FuncDecl)
+		if !ok || function.Name.Name != "responserCommandEmployee" {
+			return true
+		}
+		ast.Inspect(function.Body, func(node ast.Node) bool {
+			clause, ok := node.(*ast.CaseClause)
+			if !ok {
+				return true
+			}
+			for _, expr := range clause.List {
+				name, err := strconv.Unquote(expr.(*ast.BasicLit).Value)
+				if err != nil {
+					t.Fatal(err)
+				}
+				handled++
+				if _, ok := employeeCommands[name]; !ok {
+					t.Errorf("/%s is handled but has no declared permission", name)
+				}
+			}
+			return true
+		})
+		return false
+	})
+	if handled == 0 {
+		t.Fatal("no employee commands found in responserCommandEmployee")
+	}
+}
+
+func TestHasPermission(t *testing.T) {
+	app, _ := newTestApp(t)
+	full := database.GetUserByChatID(2, app.DB)
+	for _, permission := range allPermissions {
+		if !hasPermission(full, permission, app) {
+			t.Errorf("an employee without a role lacks %q", permission)
+		}
+	}
+	employee := operator(t, app, PermBroadcastAll)
+	if !hasPermission(employee, PermBroadcastSegment, app) {
+		t.Error("broadcast:all doesn't include broadcast:segment")
+	}
+	if hasPermission(employee, PermExport, app) {
+		t.Error("the role has a permission it doesn't list")
+	}
+	employee = operator(t, app, PermBroadcastSegment)
+	if hasPermission(employee, PermBroadcastAll, app) {
+		t.Error("broadcast:segment includes broadcast:all")
+	}
+	if !hasPermission(employee, "", app) {
+		t.Error("a command without a permission is refused")
+	}
+	employee.Role = "unknown"
+	if hasPermission(employee, PermBroadcastSegment, app) {
+		t.Error("an unknown role has permissions")
+	}
+}
+
+func TestSegmentOperatorCannotBroadcastToAll(t *testing.T) {
+	app, api := newTestApp(t)
+	broadcastUsers(t, app, 10, 11, 12)
+	if err := database.AddUserToSegment("beta", database.GetUserByChatID(11, app.DB), app.DB); err != nil {
+		t.Fatal(err)
+	}
+	operator(t, app, PermBroadcastSegment)
+
+	all := commandMessage(2, "/broadcast")
+	all.ReplyToMessage = privateMessage(2, 40, "News")
+	parseMessage(all, app)
+	if got := lastSent(api, 2); got != `You need the "broadcast:all" permission` {
+		t.Fatalf("/broadcast = %q", got)
+	}
+	if app.broadcaster.running() || len(api.requests("copyMessage")) != 0 {
+		t.Fatal("the broadcast to all users started")
+	}
+
+	segment := commandMessage(2, "/broadcast beta")
+	segment.ReplyToMessage = privateMessage(2, 40, "News")
+	parseMessage(segment, app)
+	waitBroadcast(t, app)
+	if copiedTo(api, 11) != 1 || copiedTo(api, 10) != 0 || copiedTo(api, 12) != 0 {
+		t.Fatalf("copies = %+v, want only user 11", api.requests("copyMessage"))
+	}
+
+	parseMessage(commandMessage(2, "/segment add beta 10"), app)
+	if got := lastSent(api, 2); got != `You need the "broadcast:all" permission` {
+		t.Fatalf("/segment = %q", got)
+	}
+	if n := len(database.GetBroadcastUsersInSegment("beta", app.DB)); n != 1 {
+		t.Fatalf("segment has %d users, /segment changed it", n)
+	}
+}
+
+func TestSegmentOperatorCannotCancelBroadcastToAll(t *testing.T) {
+	app, api := newTestApp(t)
+	var users []int
+	for i := 0; i < 50; i++ {
+		users = append(users, 100+i)
+	}
+	broadcastUsers(t, app, users...)
+	if err := database.AddEmployeeByID(app.DB, 3); err != nil {
+		t.Fatal(err)
+	}
+	all := commandMessage(3, "/broadcast")
+	all.ReplyToMessage = privateMessage(3, 40, "News")
+	parseMessage(all, app)
+	if !app.broadcaster.running() {
+		t.Fatal("the broadcast to all users didn't start")
+	}
+
+	operator(t, app, PermBroadcastSegment)
+	parseMessage(commandMessage(2, "/broadcast_cancel"), app)
+	if got := lastSent(api, 2); got != `You need the "broadcast:all" permission` {
+		t.Fatalf("/broadcast_cancel = %q", got)
+	}
+	if !app.broadcaster.running() {
+		t.Fatal("the segment operator cancelled the broadcast to all users")
+	}
+
+	parseMessage(commandMessage(3, "/broadcast_cancel"), app)
+	if got := lastSent(api, 3); got != "Broadcast is cancelling" {
+		t.Fatalf("/broadcast_cancel of the starter = %q", got)
+	}
+	waitBroadcast(t, app)
+}
+
+func TestSegmentCommand(t *testing.T) {
+	app, api := newTestApp(t)
+	broadcastUsers(t, app, 10, 11)
+	parseMessage(commandMessage(2, "/segment add beta 10 11 99 x"), app)
+	if got := lastSent(api, 2); got != "Segment beta: 2 users changed" {
+		t.Fatalf("/segment add = %q", got)
+	}
+	parseMessage(commandMessage(2, "/segment del beta 10"), app)
+	parseMessage(commandMessage(2, "/segment"), app)
+	if got := lastSent(api, 2); got != "beta - 1\n" {
+		t.Fatalf("/segment = %q", got)
+	}
+	parseMessage(commandMessage(2, "/segment add Beta! 10"), app)
+	if got := lastSent(api, 2); !strings.HasPrefix(got, "Format:") {
+		t.Fatalf("/segment with a bad name = %q", got)
+	}
+}
+
+func TestAdminsShowsEffectivePermissions(t *testing.T) {
+	app, api := newTestApp(t)
+	if err := database.AddEmployeeByID(app.DB, 3); err != nil {
+		t.Fatal(err)
+	}
+	app.Conf.Set("roles.operator", []string{PermBroadcastSegment})
+	if err := database.ChangeUserRole("operator", database.GetUserByChatID(3, app.DB), app.DB); err != nil {
+		t.Fatal(err)
+	}
+	parseMessage(commandMessage(2, "/admins"), app)
+	got := lastSent(api, 2)
+	for _, want := range []string{
+		" (you)\nRole: full access\nPermissions: " + strings.Join(allPermissions, ", "),
+		"\nRole: operator\nPermissions: broadcast:segment",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("/admins = %q, want %q", got, want)
+		}
+	}
+}
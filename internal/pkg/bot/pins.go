@@ -0,0 +1,66 @@
+package bot
+
+import (
+	"strconv"
+	"telegram-bot-feedback/internal/pkg/database"
+	l "telegram-bot-feedback/internal/pkg/logger"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+)
+
+// togglePin pins or unpins the Question message of the button and flips the button
+//
+// The button tells what to do, so a message unpinned outside the bot is reconciled by the next press.
+// Pinning is silent, the state is stored in the MessageLink
+func togglePin(pin bool, data string, callback *tg.CallbackQuery, app *App) error {
+	chat := callback.Message.Chat
+	id, err := strconv.Atoi(data)
+	if err != nil {
+		return l.Err(answerCallback(callback, app))
+	}
+	question := database.GetQuestionById(id, app.DB)
+	if question == nil {
+		return l.Err(answerCallback(callback, app))
+	}
+	allowed, err := canPin(chat, app)
+	if err != nil {
+		return l.Err(err)
+	}
+	if !allowed {
+		_, err := app.Bot.Request(tg.NewCallbackWithAlert(callback.ID, "The bot needs the right to pin messages in this chat"))
+		return l.Err(err)
+	}
+	var config tg.Config = tg.UnpinChatMessageConf{ChatID: chat.ID, MessageID: callback.Message.MessageID}
+	if pin {
+		config = tg.PinChatMessageConf{ChatID: chat.ID, MessageID: callback.Message.MessageID, DisableNotification: true}
+	}
+	if _, failed := app.Bot.Request(config); failed != nil {
+		l.Error(l.Err(failed))
+		_, err := app.Bot.Request(tg.NewCallbackWithAlert(callback.ID, "Telegram refused: "+failed.Error()))
+		return l.Err(err)
+	}
+	if link := database.GetMessageLink(chat.ID, callback.Message.MessageID, app.DB); link != nil && link.IsPinned != pin {
+		err = database.ChangeMessageLinkPinned(pin, link, app.DB)
+		if err != nil {
+			return l.Err(err)
+		}
+	}
+	_, err = app.Bot.Send(tg.NewEditMessageReplyMarkup(chat.ID, callback.Message.MessageID, questionKeyboard(question, pin, app)))
+	if err != nil && !tg.IsMessageNotModified(err) {
+		l.Error(l.Err(err))
+	}
+	return l.Err(answerCallback(callback, app))
+}
+
+// canPin reports whether the bot may pin messages in the chat
+//
+// The bot can always pin in private chats, in groups it has to be an administrator with the pin right
+func canPin(chat *tg.Chat, app *App) (bool, error) {
+	if chat.IsPrivate() {
+		return true, nil
+	}
+	member, err := app.Bot.GetChatMember(tg.GetChatMemberConf{ChatID: chat.ID, UserID: app.Bot.Self.ID})
+	if err != nil {
+		return false, l.Err(err)
+	}
+	return member.IsCreator() || (member.IsAdministrator() && member.CanPinMessages), nil
+}
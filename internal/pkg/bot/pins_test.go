@@ -0,0 +1,165 @@
+package bot
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+	"testing"
+)
+
+// adminGroup is the admin group of the pin tests
+const adminGroup = -1003333333333
+
+// pinCallback returns the press of the pin or unpin button on message 50 in the chat
+func pinCallback(id string, chatID int, pin bool, question *database.Question) *tg.CallbackQuery {
+	key, chatType := CBUnpin, "private"
+	if pin {
+		key = CBPin
+	}
+	if chatID < 0 {
+		chatType = "supergroup"
+	}
+	return &tg.CallbackQuery{
+		ID:      id,
+		From:    &tg.User{ID: 2},
+		Message: &tg.Message{MessageID: 50, Chat: &tg.Chat{ID: chatID, Type: chatType}},
+		Data:    strconv.Itoa(key) + "-" + strconv.Itoa(int(question.ID)),
+	}
+}
+
+// pinnedQuestion opens a Question linked with message 50 in the chat
+func pinnedQuestion(t *testing.T, app *App, chatID int) *database.Question {
+	t.Helper()
+	question := askQuestion(t, app, "It crashes")
+	if err := database.AddMessageLink(chatID, 0, 50, question, app.DB); err != nil {
+		t.Fatal(err)
+	}
+	return question
+}
+
+// pinButton returns the text of the pin button in the last markup edit
+func pinButton(t *testing.T, api *testAPI) string {
+	t.Helper()
+	edits := api.requests("editMessageReplyMarkup")
+	if len(edits) == 0 {
+		t.Fatal("the buttons are not edited")
+	}
+	markup := fmt.Sprint(edits[len(edits)-1].Params["reply_markup"])
+	for _, text := range []string{"📌 Pin", "Unpin"} {
+		if strings.Contains(markup, text) {
+			return text
+		}
+	}
+	return ""
+}
+
+// isPinned returns the stored pin state of message 50 in the chat
+func isPinned(app *App, chatID int) bool {
+	return database.GetMessageLink(chatID, 50, app.DB).IsPinned
+}
+
+func TestPinToggles(t *testing.T) {
+	app, api := newTestApp(t)
+	question := pinnedQuestion(t, app, 2)
+
+	if err := parseCallback(pinCallback("pin", 2, true, question), app); err != nil {
+		t.Fatal(err)
+	}
+	pins := api.requests("pinChatMessage")
+	if len(pins) != 1 || pins[0].chatID() != 2 || pins[0].Params["message_id"] != float64(50) || pins[0].Params["disable_notification"] != true {
+		t.Fatalf("pins = %+v", pins)
+	}
+	if !isPinned(app, 2) || pinButton(t, api) != "Unpin" {
+		t.Fatalf("pinned = %t, button = %q", isPinned(app, 2), pinButton(t, api))
+	}
+	if len(api.requests("getChatMember")) != 0 {
+		t.Fatal("the rights are checked in the private chat")
+	}
+
+	if err := parseCallback(pinCallback("unpin", 2, false, question), app); err != nil {
+		t.Fatal(err)
+	}
+	if unpins := api.requests("unpinChatMessage"); len(unpins) != 1 || unpins[0].Params["message_id"] != float64(50) {
+		t.Fatalf("unpins = %+v", unpins)
+	}
+	if isPinned(app, 2) || pinButton(t, api) != "📌 Pin" {
+		t.Fatalf("pinned = %t, button = %q", isPinned(app, 2), pinButton(t, api))
+	}
+	if answers := callbackAnswers(api); !reflect.DeepEqual(answers["pin"], []string{""}) || !reflect.DeepEqual(answers["unpin"], []string{""}) {
+		t.Fatalf("callback answers = %q", answers)
+	}
+}
+
+func TestPinReconcilesManualUnpin(t *testing.T) {
+	app, api := newTestApp(t)
+	question := pinnedQuestion(t, app, 2)
+	if err := parseCallback(pinCallback("pin", 2, true, question), app); err != nil {
+		t.Fatal(err)
+	}
+	// An admin unpinned the message in Telegram, the button still shows Unpin, the stored state is stale
+	if err := parseCallback(pinCallback("unpin", 2, false, question), app); err != nil {
+		t.Fatal(err)
+	}
+	if isPinned(app, 2) || pinButton(t, api) != "📌 Pin" {
+		t.Fatal("the stale state is not reconciled")
+	}
+	// The message was pinned outside the bot, Pin pins it again and stores the state
+	if err := parseCallback(pinCallback("again", 2, true, question), app); err != nil {
+		t.Fatal(err)
+	}
+	if !isPinned(app, 2) || len(api.requests("pinChatMessage")) != 2 {
+		t.Fatal("the state is not stored after pinning again")
+	}
+}
+
+func TestPinNeedsRights(t *testing.T) {
+	app, api := newTestApp(t)
+	question := pinnedQuestion(t, app, adminGroup)
+	api.result("getChatMember", `{"status":"member","user":{"id":1,"is_bot":true,"first_name":"Feedback"}}`)
+	data := strconv.Itoa(int(question.ID))
+	if err := togglePin(true, data, pinCallback("member", adminGroup, true, question), app); err != nil {
+		t.Fatal(err)
+	}
+	members := api.requests("getChatMember")
+	if len(members) != 1 || members[0].chatID() != adminGroup || members[0].Params["user_id"] != float64(1) {
+		t.Fatalf("getChatMember = %+v, want the bot itself", members)
+	}
+	api.result("getChatMember", `{"status":"administrator","can_pin_messages":false,"user":{"id":1,"is_bot":true,"first_name":"Feedback"}}`)
+	if err := togglePin(true, data, pinCallback("admin", adminGroup, true, question), app); err != nil {
+		t.Fatal(err)
+	}
+	answers := callbackAnswers(api)
+	want := []string{"!The bot needs the right to pin messages in this chat"}
+	if !reflect.DeepEqual(answers["member"], want) || !reflect.DeepEqual(answers["admin"], want) {
+		t.Fatalf("callback answers = %q", answers)
+	}
+	if len(api.requests("pinChatMessage", "editMessageReplyMarkup")) != 0 || isPinned(app, adminGroup) {
+		t.Fatal("the message is pinned without the right")
+	}
+
+	api.result("getChatMember", `{"status":"administrator","can_pin_messages":true,"user":{"id":1,"is_bot":true,"first_name":"Feedback"}}`)
+	if err := togglePin(true, data, pinCallback("allowed", adminGroup, true, question), app); err != nil {
+		t.Fatal(err)
+	}
+	if !isPinned(app, adminGroup) || len(api.requests("pinChatMessage")) != 1 {
+		t.Fatal("the administrator with the right doesn't pin")
+	}
+}
+
+func TestPinRefusedByTelegram(t *testing.T) {
+	app, api := newTestApp(t)
+	question := pinnedQuestion(t, app, 2)
+	api.fail("pinChatMessage", 400, "Bad Request: message to pin not found")
+	if err := parseCallback(pinCallback("pin", 2, true, question), app); err != nil {
+		t.Fatal(err)
+	}
+	if answers := callbackAnswers(api)["pin"]; len(answers) != 1 || !strings.HasPrefix(answers[0], "!Telegram refused: ") || !strings.Contains(answers[0], "message to pin not found") {
+		t.Fatalf("callback answers = %q", answers)
+	}
+	if isPinned(app, 2) || len(api.requests("editMessageReplyMarkup")) != 0 {
+		t.Fatal("a refused pin changes the state")
+	}
+}
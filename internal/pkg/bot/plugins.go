@@ -0,0 +1,177 @@
+package bot
+
+import (
+	"telegram-bot-feedback/internal/pkg/database"
+	l "telegram-bot-feedback/internal/pkg/logger"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+// Plugin is an optional extension of the bot
+//
+// Plugins are compiled in (see availablePlugins) and enabled by name
+// in the configuration: "plugins": ["tickets"]
+//
+// A plugin can also implement UpdateFilter, UpdateHandler, UpdateTypesProvider, CommandProvider, StatsProvider and EventSubscriber
+type Plugin interface {
+	// Name returns the name used in the configuration
+	Name() string
+	// Init is called once when the bot starts
+	Init(hooks *Hooks) error
+}
+
+// UpdateFilter is a Plugin which can drop Updates before they are parsed
+type UpdateFilter interface {
+	// FilterUpdate returns false to drop the Update
+	FilterUpdate(update *tg.Update) bool
+}
+
+// UpdateHandler is a Plugin which handles Updates the bot doesn't, e.g. payments
+type UpdateHandler interface {
+	// HandleUpdate returns true if the Update was handled and must not be parsed by the bot
+	HandleUpdate(update *tg.Update) (bool, error)
+}
+
+// UpdateTypesProvider is an UpdateHandler which needs Update types the bot doesn't request, e.g. "pre_checkout_query"
+type UpdateTypesProvider interface {
+	// UpdateTypes returns the types, see tg.UpdateTypeMessage and others
+	UpdateTypes() []string
+}
+
+// StatsProvider is a Plugin which adds /stats sections
+type StatsProvider interface {
+	// StatsSections returns the texts of the sections by name
+	StatsSections() map[string]func() string
+}
+
+// CommandProvider is a Plugin which adds bot commands
+type CommandProvider interface {
+	Commands() []Command
+}
+
+// EventSubscriber is a Plugin which receives Question events
+type EventSubscriber interface {
+	OnEvent(event Event)
+}
+
+// Command is a bot command provided by a Plugin
+type Command struct {
+	Name        string // without "/"
+	Employee    bool   // available only for employees
+	Permission  string // permission the employee needs, "" for none
+	Description string // shown in /help and the command menu
+	Handler     func(message *tg.Message, user *database.User, hooks *Hooks) error
+}
+
+// Event types
+const (
+	EventQuestionOpened int = iota + 1
+	EventQuestionClosed
+	EventQuestionMessage
+)
+
+// Event is sent to EventSubscriber plugins
+type Event struct {
+	Type     int
+	Question *database.Question
+	Text     string // the message of the user for EventQuestionMessage
+}
+
+// Hooks is the API available to plugins
+type Hooks struct {
+	Bot  *tg.Client   // sends messages
+	DB   *gorm.DB     // storage, see package database
+	Conf *viper.Viper // configuration
+}
+
+// availablePlugins returns all compiled-in plugins
+func availablePlugins() []Plugin {
+	return []Plugin{
+		&TicketPlugin{Backend: NoopTicketBackend{}},
+		&DonationPlugin{},
+		&EscalationPlugin{},
+	}
+}
+
+// initPlugins initializes the plugins enabled in the configuration
+func (app *App) initPlugins() {
+	enabled := map[string]bool{}
+	for _, name := range app.Conf.GetStringSlice("plugins") {
+		enabled[name] = true
+	}
+	hooks := &Hooks{Bot: app.Bot, DB: app.DB, Conf: app.Conf}
+	for _, plugin := range availablePlugins() {
+		if !enabled[plugin.Name()] {
+			continue
+		}
+		err := plugin.Init(hooks)
+		if err != nil {
+			l.Error(l.Err(err))
+			continue
+		}
+		app.plugins = append(app.plugins, plugin)
+	}
+	app.hooks = hooks
+}
+
+// filterUpdate returns false if any plugin drops the Update
+func (app *App) filterUpdate(update *tg.Update) bool {
+	for _, plugin := range app.plugins {
+		if filter, ok := plugin.(UpdateFilter); ok && !filter.FilterUpdate(update) {
+			return false
+		}
+	}
+	return true
+}
+
+// handleUpdate passes the Update to UpdateHandler plugins, returns true if one of them handled it
+func (app *App) handleUpdate(update *tg.Update) (bool, error) {
+	for _, plugin := range app.plugins {
+		if handler, ok := plugin.(UpdateHandler); ok {
+			if handled, err := handler.HandleUpdate(update); handled {
+				return true, l.Err(err)
+			}
+		}
+	}
+	return false, nil
+}
+
+// pluginStats returns the /stats sections of plugins
+func (app *App) pluginStats() map[string]func() string {
+	sections := map[string]func() string{}
+	for _, plugin := range app.plugins {
+		if provider, ok := plugin.(StatsProvider); ok {
+			for name, section := range provider.StatsSections() {
+				sections[name] = section
+			}
+		}
+	}
+	return sections
+}
+
+// pluginCommand returns the plugin command available to the User
+func (app *App) pluginCommand(name string, user *database.User) *Command {
+	for _, plugin := range app.plugins {
+		provider, ok := plugin.(CommandProvider)
+		if !ok {
+			continue
+		}
+		for _, command := range provider.Commands() {
+			if command.Name == name && (!command.Employee || user.IsEmployee) {
+				return &command
+			}
+		}
+	}
+	return nil
+}
+
+// emit sends the Event to plugins
+func (app *App) emit(event Event) {
+	for _, plugin := range app.plugins {
+		if subscriber, ok := plugin.(EventSubscriber); ok {
+			subscriber.OnEvent(event)
+		}
+	}
+}
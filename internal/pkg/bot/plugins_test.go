@@ -0,0 +1,53 @@
+package bot
+
+import (
+	"reflect"
+	"telegram-bot-feedback/internal/pkg/database"
+	"testing"
+)
+
+// enablePlugins loads the plugins again with the names in the configuration
+func enablePlugins(app *App, names ...string) []string {
+	app.Conf.Set("plugins", names)
+	app.plugins = nil
+	app.initPlugins()
+	loaded := []string{}
+	for _, plugin := range app.plugins {
+		loaded = append(loaded, plugin.Name())
+	}
+	return loaded
+}
+
+func TestPluginsAreDisabledByDefault(t *testing.T) {
+	app, _ := newTestApp(t)
+	if len(app.plugins) != 0 {
+		t.Fatalf("plugins = %v", app.plugins)
+	}
+	if app.pluginCommand("donate", &database.User{}) != nil {
+		t.Fatal("/donate is available without the plugin")
+	}
+}
+
+func TestPluginsAreEnabledByName(t *testing.T) {
+	app, _ := newTestApp(t)
+	loaded := enablePlugins(app, "donations", "unknown", "tickets")
+	if !reflect.DeepEqual(loaded, []string{"tickets", "donations"}) {
+		t.Fatalf("loaded = %v", loaded)
+	}
+	if app.pluginCommand("donate", &database.User{}) == nil {
+		t.Fatal("/donate is not available")
+	}
+	loaded = enablePlugins(app, "tickets")
+	if !reflect.DeepEqual(loaded, []string{"tickets"}) || app.pluginCommand("donate", &database.User{}) != nil {
+		t.Fatalf("loaded = %v after disabling donations", loaded)
+	}
+}
+
+func TestPluginWithFailedInitIsSkipped(t *testing.T) {
+	app, _ := newTestApp(t)
+	app.Conf.Set("donation_currency", "USD")
+	loaded := enablePlugins(app, "donations", "escalation", "tickets")
+	if !reflect.DeepEqual(loaded, []string{"tickets"}) {
+		t.Fatalf("loaded = %v", loaded)
+	}
+}
@@ -0,0 +1,101 @@
+package bot
+
+import (
+	"strconv"
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	l "telegram-bot-feedback/internal/pkg/logger"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+)
+
+// privacyMode reports whether user messages are copied to employees under the Question number instead of forwarded
+func privacyMode(app *App) bool {
+	return app.Conf.GetBool("privacy_mode")
+}
+
+// mirrorMessage re-sends the user message to the chat with the "Question #N" header instead of forwarding it
+//
+// The header replaces the sender, so employees don't see the user profile and replies to the copy
+// are routed by the Question. Attachments are sent again by file ID without re-uploading, with the header
+// in the caption or before them when the caption can't hold it. Returns the copy of the attachment, nil for text
+func mirrorMessage(chatId int, question *database.Question, message *tg.Message, app *App) (*tg.Message, error) {
+	title := "Question #" + strconv.Itoa(int(question.ID))
+	text, entities := message.Text, message.Entities
+	if text == "" {
+		text, entities = message.Caption, message.CaptionEntities
+	}
+	caption := title + "\n" + message.Caption
+	media := mirrorMedia(chatId, message, "", nil)
+	if media != nil && captionMedia[mediaType(message)] && tg.UTF16Len(caption) <= tg.MaxCaptionLength {
+		shifted := shiftEntities(sendableEntities(message.CaptionEntities, tg.UTF16Len(message.Caption)), tg.UTF16Len(title)+1)
+		media = mirrorMedia(chatId, message, strings.TrimSuffix(caption, "\n"), shifted)
+	} else {
+		chunks := []chunk{{Text: title}}
+		if text != "" {
+			chunks = splitMessage(title, text, entities)
+		}
+		for _, chunk := range chunks {
+			header := tg.NewMessage(chatId, chunk.Text)
+			header.Entities = chunk.Entities
+			sent, err := app.Bot.Send(header)
+			if err != nil {
+				return nil, l.Err(err)
+			}
+			addMessageLink(sent, question, app)
+		}
+		if message.Text != "" {
+			return nil, nil
+		}
+		if item := messageShare(message); item != nil {
+			return sendShare(chatId, question, item, app)
+		}
+	}
+	if media == nil {
+		// Polls, dice and other content without a file are copied
+		media = tg.NewCopyMessage(chatId, message.Chat.ID, message.MessageID)
+	}
+	sent, err := app.Bot.Send(media)
+	if err != nil {
+		return nil, l.Err(err)
+	}
+	sent.Chat = &tg.Chat{ID: chatId}
+	addMessageLink(sent, question, app)
+	return sent, nil
+}
+
+// mirrorMedia returns the message which sends the attachment again by its file ID with the caption
+//
+// Stickers and video notes have no caption. Returns nil for messages without a file
+func mirrorMedia(chatId int, message *tg.Message, caption string, entities []tg.MessageEntity) tg.Config {
+	switch {
+	case len(message.Photo) > 0:
+		photo := tg.NewPhoto(chatId, tg.FileID(message.Photo[len(message.Photo)-1].FileID))
+		photo.Caption, photo.CaptionEntities = caption, entities
+		return photo
+	case message.Video != nil:
+		video := tg.NewVideo(chatId, tg.FileID(message.Video.FileID))
+		video.Caption, video.CaptionEntities = caption, entities
+		return video
+	case message.Animation != nil:
+		animation := tg.NewAnimation(chatId, tg.FileID(message.Animation.FileID))
+		animation.Caption, animation.CaptionEntities = caption, entities
+		return animation
+	case message.Document != nil:
+		document := tg.NewDocument(chatId, tg.FileID(message.Document.FileID))
+		document.Caption, document.CaptionEntities = caption, entities
+		return document
+	case message.Voice != nil:
+		voice := tg.NewVoice(chatId, tg.FileID(message.Voice.FileID))
+		voice.Caption, voice.CaptionEntities = caption, entities
+		return voice
+	case message.Audio != nil:
+		audio := tg.NewAudio(chatId, tg.FileID(message.Audio.FileID))
+		audio.Caption, audio.CaptionEntities = caption, entities
+		return audio
+	case message.VideoNote != nil:
+		return tg.NewVideoNote(chatId, message.VideoNote.Length, tg.FileID(message.VideoNote.FileID))
+	case message.Sticker != nil:
+		return tg.NewSticker(chatId, tg.FileID(message.Sticker.FileID))
+	}
+	return nil
+}
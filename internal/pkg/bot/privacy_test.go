@@ -0,0 +1,141 @@
+package bot
+
+import (
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+	"testing"
+)
+
+func TestMirrorMediaReusesFileID(t *testing.T) {
+	tests := []struct {
+		name    string
+		message tg.Message
+		method  string
+		field   string
+	}{
+		{"photo", tg.Message{Photo: []*tg.PhotoSize{{FileID: "small"}, {FileID: "file"}}}, "sendPhoto", "photo"},
+		{"video", tg.Message{Video: &tg.Video{FileID: "file"}}, "sendVideo", "video"},
+		{"animation", tg.Message{Animation: &tg.Animation{FileID: "file"}, Document: &tg.Document{FileID: "doc"}}, "sendAnimation", "animation"},
+		{"document", tg.Message{Document: &tg.Document{FileID: "file"}}, "sendDocument", "document"},
+		{"voice", tg.Message{Voice: &tg.Voice{FileID: "file"}}, "sendVoice", "voice"},
+		{"audio", tg.Message{Audio: &tg.Audio{FileID: "file"}}, "sendAudio", "audio"},
+		{"video note", tg.Message{VideoNote: &tg.VideoNote{FileID: "file", Length: 240}}, "sendVideoNote", "video_note"},
+		{"sticker", tg.Message{Sticker: &tg.Sticker{FileID: "file"}}, "sendSticker", "sticker"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, api := newTestApp(t)
+			config := mirrorMedia(2, &tt.message, "Question #1", nil)
+			if config == nil {
+				t.Fatal("no config for the attachment")
+			}
+			if _, err := app.Bot.Send(config); err != nil {
+				t.Fatal(err)
+			}
+			calls := api.requests()
+			if len(calls) != 1 || calls[0].Method != tt.method {
+				t.Fatalf("requests %v, want %s", calls, tt.method)
+			}
+			// An upload would be a multipart request with the file content
+			if got := calls[0].Params[tt.field]; got != "file" {
+				t.Fatalf("%s = %v, want the file ID without an upload", tt.field, got)
+			}
+		})
+	}
+}
+
+func TestMirrorMediaWithoutFile(t *testing.T) {
+	if config := mirrorMedia(2, &tg.Message{Text: "text"}, "", nil); config != nil {
+		t.Fatalf("config %T for a text message", config)
+	}
+}
+
+// privacyQuestion returns the App in privacy mode with the open Question of user 1
+func privacyQuestion(t *testing.T) (*App, *testAPI, *database.Question) {
+	app, api := newTestApp(t)
+	app.Conf.Set("privacy_mode", true)
+	user, err := database.AddUser(1, "user1", SQuestionDiscussion, app.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	question, err := database.AddQuestion("help", 1, user, app.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return app, api, question
+}
+
+func TestMirrorMessageCaptionHeader(t *testing.T) {
+	app, api, question := privacyQuestion(t)
+	message := privateMessage(1, 5, "")
+	message.Photo = []*tg.PhotoSize{{FileID: "photo"}}
+	message.Caption = "broken screen"
+	if _, err := mirrorMessage(2, question, message, app); err != nil {
+		t.Fatal(err)
+	}
+	calls := api.requests()
+	if len(calls) != 1 || calls[0].Method != "sendPhoto" {
+		t.Fatalf("requests %v, want one sendPhoto", calls)
+	}
+	if got := calls[0].Params["caption"]; got != "Question #1\nbroken screen" {
+		t.Fatalf("caption = %q", got)
+	}
+	if link := database.GetMessageLink(2, 101, app.DB); link == nil || link.QuestionID != int(question.ID) {
+		t.Fatal("the copy is not linked with the question")
+	}
+}
+
+func TestMirrorMessageLongCaption(t *testing.T) {
+	app, api, question := privacyQuestion(t)
+	message := privateMessage(1, 5, "")
+	message.Document = &tg.Document{FileID: "doc"}
+	message.Caption = strings.Repeat("a", tg.MaxCaptionLength)
+	if _, err := mirrorMessage(2, question, message, app); err != nil {
+		t.Fatal(err)
+	}
+	calls := api.requests()
+	if len(calls) != 2 || calls[0].Method != "sendMessage" || calls[1].Method != "sendDocument" {
+		t.Fatalf("requests %v, want the header and the document", calls)
+	}
+	if !strings.HasPrefix(calls[0].text(), "Question #1\naaa") {
+		t.Fatalf("header = %q", calls[0].text())
+	}
+	if _, ok := calls[1].Params["caption"]; ok {
+		t.Fatal("the document has a caption")
+	}
+}
+
+func TestMirrorMessageText(t *testing.T) {
+	app, api, question := privacyQuestion(t)
+	if _, err := mirrorMessage(2, question, privateMessage(1, 5, "hello"), app); err != nil {
+		t.Fatal(err)
+	}
+	if texts := api.sentTo(2); len(texts) != 1 || texts[0] != "Question #1\nhello" {
+		t.Fatalf("sent %q", texts)
+	}
+	if calls := api.requests("forwardMessage"); len(calls) != 0 {
+		t.Fatal("the message is forwarded")
+	}
+}
+
+func TestLoadFullQuestionDoesNotForwardInPrivacyMode(t *testing.T) {
+	app, api, _ := privacyQuestion(t)
+	if _, err := database.AddCorrespondence(database.GetUserByChatID(1, app.DB), 5, "hello", app.DB); err != nil {
+		t.Fatal(err)
+	}
+	employee := database.GetUserByChatID(2, app.DB)
+	loadFullQuestionById("1", employee, app)
+	if calls := api.requests("forwardMessage"); len(calls) != 0 {
+		t.Fatalf("%d messages forwarded in privacy mode", len(calls))
+	}
+	if calls := api.requests("copyMessage"); len(calls) != 1 {
+		t.Fatalf("%d messages copied, want 1", len(calls))
+	}
+	app.Conf.Set("privacy_mode", false)
+	api.reset()
+	loadFullQuestionById("1", employee, app)
+	if calls := api.requests("forwardMessage"); len(calls) != 1 {
+		t.Fatalf("%d messages forwarded without privacy mode, want 1", len(calls))
+	}
+}
@@ -0,0 +1,157 @@
+package bot
+
+import (
+	"container/list"
+	"strconv"
+	"strings"
+	"sync"
+	"telegram-bot-feedback/internal/pkg/database"
+	l "telegram-bot-feedback/internal/pkg/logger"
+	"telegram-bot-feedback/internal/pkg/metrics"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+	"time"
+)
+
+// Profile cache settings
+const (
+	// profileCacheSize is how many profiles are kept in memory
+	profileCacheSize = 10000
+	// profileCacheTTL is how long a cached profile is trusted before it is compared with the database again
+	profileCacheTTL = time.Hour
+	// profileTTL is the age of the stored profile after which displayName asks getChat
+	profileTTL = 7 * 24 * time.Hour
+)
+
+// profile is the display data of a user
+type profile struct {
+	nickname     string
+	firstName    string
+	lastName     string
+	languageCode string
+}
+
+// profileEntry is a cached profile
+type profileEntry struct {
+	chatID  int
+	profile profile
+	cached  time.Time
+}
+
+// profileCache is an LRU cache of the stored profiles, so unchanged profiles don't touch the database
+//
+// The zero value is ready to use
+type profileCache struct {
+	mu      sync.Mutex
+	order   list.List
+	entries map[int]*list.Element
+}
+
+// get returns the profile cached within profileCacheTTL
+func (c *profileCache) get(chatID int) (profile, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[chatID]
+	if !ok {
+		return profile{}, false
+	}
+	entry := element.Value.(*profileEntry)
+	if time.Since(entry.cached) >= profileCacheTTL {
+		c.order.Remove(element)
+		delete(c.entries, chatID)
+		return profile{}, false
+	}
+	c.order.MoveToFront(element)
+	return entry.profile, true
+}
+
+// put caches the profile, the least recently used one is dropped when the cache is full
+func (c *profileCache) put(chatID int, p profile) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = map[int]*list.Element{}
+	}
+	if element, ok := c.entries[chatID]; ok {
+		element.Value = &profileEntry{chatID: chatID, profile: p, cached: time.Now()}
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[chatID] = c.order.PushFront(&profileEntry{chatID: chatID, profile: p, cached: time.Now()})
+	if c.order.Len() > profileCacheSize {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*profileEntry).chatID)
+	}
+}
+
+// updateProfile saves the name and language of the user from the Update if they have changed
+func updateProfile(from *tg.User, app *App) {
+	current := profile{nickname: from.UserName, firstName: from.FirstName, lastName: from.LastName, languageCode: from.LanguageCode}
+	if cached, ok := app.profiles.get(from.ID); ok && cached == current {
+		metrics.ProfileCache.Inc("hit")
+		return
+	}
+	metrics.ProfileCache.Inc("miss")
+	user := database.GetUserByChatID(from.ID, app.DB)
+	if user == nil {
+		return
+	}
+	if userProfile(user) != current || user.ProfileAt == nil {
+		err := database.ChangeUserProfile(current.nickname, current.firstName, current.lastName, current.languageCode, user, app.DB)
+		if err != nil {
+			l.Error(err)
+			return
+		}
+	}
+	app.profiles.put(from.ID, current)
+}
+
+// userProfile returns the stored profile of the User
+func userProfile(user *database.User) profile {
+	return profile{nickname: user.Nickname, firstName: user.FirstName, lastName: user.LastName, languageCode: user.LanguageCode}
+}
+
+// refreshProfile updates the stored profile older than profileTTL with getChat
+func refreshProfile(user *database.User, app *App) {
+	if user.ChatID == 0 || user.ProfileAt != nil && time.Since(*user.ProfileAt) < profileTTL {
+		return
+	}
+	metrics.ProfileCache.Inc("refresh")
+	chat, err := app.Bot.GetChat(tg.GetChatConf{ChatID: user.ChatID})
+	if err != nil {
+		l.Error(l.Err(err))
+		return
+	}
+	err = database.ChangeUserProfile(chat.Username, chat.FirstName, chat.LastName, user.LanguageCode, user, app.DB)
+	if err != nil {
+		l.Error(err)
+		return
+	}
+	app.profiles.put(user.ChatID, userProfile(user))
+}
+
+// displayName returns userName with the refreshed profile
+func displayName(user *database.User, app *App) string {
+	refreshProfile(user, app)
+	return userName(user)
+}
+
+// profileName returns @nickname, the full name or empty string if the User has neither
+func profileName(user *database.User) string {
+	if user.Nickname != "" {
+		return "@" + user.Nickname
+	}
+	return strings.TrimSpace(user.FirstName + " " + user.LastName)
+}
+
+// userName returns @nickname, the full name with Telegram ID or Telegram ID of the User
+func userName(user *database.User) string {
+	name := profileName(user)
+	switch {
+	case name == "":
+		return strconv.Itoa(user.ChatID)
+	case user.Nickname == "":
+		return name + " (" + strconv.Itoa(user.ChatID) + ")"
+	}
+	return name
+}
@@ -0,0 +1,86 @@
+package bot
+
+import (
+	"telegram-bot-feedback/internal/pkg/database"
+	"telegram-bot-feedback/internal/pkg/metrics"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+	"testing"
+	"time"
+)
+
+func TestProfileChangePropagates(t *testing.T) {
+	app, api := newTestApp(t)
+	if _, err := database.AddUser(1, "user1", SMain, app.DB); err != nil {
+		t.Fatal(err)
+	}
+	from := &tg.User{ID: 1, FirstName: "Ann", UserName: "ann"}
+	updateProfile(from, app)
+	hits := metrics.ProfileCache.Value("hit")
+	updateProfile(from, app)
+	if metrics.ProfileCache.Value("hit") != hits+1 {
+		t.Fatal("the unchanged profile is not taken from the cache")
+	}
+	if got := displayName(database.GetUserByChatID(1, app.DB), app); got != "@ann" {
+		t.Fatalf("name = %q", got)
+	}
+
+	// The user renames and drops the username
+	updateProfile(&tg.User{ID: 1, FirstName: "Anna", LastName: "Smith"}, app)
+	user := database.GetUserByChatID(1, app.DB)
+	if got := displayName(user, app); got != "Anna Smith (1)" {
+		t.Fatalf("name after the change = %q", got)
+	}
+	if len(api.requests("getChat")) != 0 {
+		t.Fatal("getChat is called for a fresh profile")
+	}
+}
+
+func TestStaleProfileIsRefreshed(t *testing.T) {
+	app, api := newTestApp(t)
+	user, err := database.AddUser(1, "old", SMain, app.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api.result("getChat", `{"id":1,"type":"private","username":"new","first_name":"Ann"}`)
+	if got := displayName(user, app); got != "@new" {
+		t.Fatalf("name of the user without a profile = %q", got)
+	}
+	if len(api.requests("getChat")) != 1 {
+		t.Fatalf("getChat calls = %d", len(api.requests("getChat")))
+	}
+	user = database.GetUserByChatID(1, app.DB)
+	if got := displayName(user, app); got != "@new" || len(api.requests("getChat")) != 1 {
+		t.Fatalf("name = %q, getChat calls = %d, want one", got, len(api.requests("getChat")))
+	}
+
+	stale := time.Now().Add(-profileTTL - time.Hour)
+	user.ProfileAt = &stale
+	if err := app.DB.Save(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	displayName(database.GetUserByChatID(1, app.DB), app)
+	if len(api.requests("getChat")) != 2 {
+		t.Fatal("the stale profile is not refreshed")
+	}
+}
+
+func TestProfileCacheDropsLeastRecentlyUsed(t *testing.T) {
+	var cache profileCache
+	for id := 1; id <= profileCacheSize; id++ {
+		cache.put(id, profile{nickname: "user"})
+	}
+	// Reading the first profile makes the second one the oldest
+	if _, ok := cache.get(1); !ok {
+		t.Fatal("the first profile is missing")
+	}
+	cache.put(profileCacheSize+1, profile{nickname: "new"})
+	if _, ok := cache.get(2); ok {
+		t.Fatal("the least recently used profile is kept")
+	}
+	if _, ok := cache.get(1); !ok {
+		t.Fatal("the recently used profile is dropped")
+	}
+	if p, ok := cache.get(profileCacheSize + 1); !ok || p.nickname != "new" {
+		t.Fatalf("the new profile = %+v, %t", p, ok)
+	}
+}
@@ -0,0 +1,178 @@
+package bot
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	l "telegram-bot-feedback/internal/pkg/logger"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+)
+
+// sampleForReview puts the closed Question in the quality review queue if it falls into the sample
+//
+// "review_sample" is the percent of answered Questions sampled. The bucket is a hash of "review_seed"
+// and the Question number, so the sample does not depend on who answered, when or how the Question was closed
+func sampleForReview(question *database.Question, app *App) {
+	if question.AnswererID == 0 {
+		return
+	}
+	if rolloutBucket("review:"+app.Conf.GetString("review_seed"), question.ID) >= clampPercent(app.Conf.GetInt("review_sample")) {
+		return
+	}
+	err := database.AddQualityReview(question, app.DB)
+	if err != nil {
+		l.Error(err)
+	}
+}
+
+// reviewCommand serves the next transcript of the review queue or comments the last verdict
+//
+// Format: /review [comment <text>]
+func reviewCommand(message *tg.Message, user *database.User, app *App) error {
+	args := strings.TrimSpace(message.CommandArguments())
+	if args == "" {
+		return l.Err(serveReview(0, user, app))
+	}
+	action, comment, _ := strings.Cut(args, " ")
+	comment = strings.TrimSpace(comment)
+	if action != "comment" || comment == "" {
+		_, err := app.Bot.Send(tg.NewMessage(user.ChatID, "Format: /review [comment <text>]"))
+		return l.Err(err)
+	}
+	review := database.GetLastQualityReview(int(user.ID), app.DB)
+	if review == nil {
+		_, err := app.Bot.Send(tg.NewMessage(user.ChatID, "Review a transcript first"))
+		return l.Err(err)
+	}
+	err := database.ChangeQualityComment(comment, review, app.DB)
+	if err != nil {
+		return l.Err(err)
+	}
+	_, err = app.Bot.Send(tg.NewMessage(user.ChatID, "Comment on review #"+strconv.Itoa(int(review.ID))+" saved"))
+	return l.Err(err)
+}
+
+// serveReview sends the first unreviewed transcript after the QualityReview ID with the verdict buttons
+func serveReview(afterID uint, user *database.User, app *App) error {
+	review := database.GetNextQualityReview(afterID, int(user.ID), app.DB)
+	if review == nil {
+		text := "The review queue is empty"
+		if afterID != 0 && database.GetNextQualityReview(0, int(user.ID), app.DB) != nil {
+			text = "No more transcripts, /review starts from the beginning of the queue"
+		}
+		_, err := app.Bot.Send(tg.NewMessage(user.ChatID, text))
+		return l.Err(err)
+	}
+	question := database.GetQuestionById(review.QuestionID, app.DB)
+	if question == nil {
+		return l.Err(serveReview(review.ID, user, app))
+	}
+	title := fmt.Sprintf("Review #%d (%d unreviewed)\nQuestion #%d answered by %s",
+		review.ID, database.CountQualityReviews(app.DB), question.ID, userName(&question.Answerer))
+	transcript := renderTranscript(questionTranscript(question, app))
+	if tg.UTF16Len(title)+2+tg.UTF16Len(transcript) <= tg.MaxMessageLength {
+		reply := tg.NewMessage(user.ChatID, title+"\n\n"+transcript)
+		reply.ReplyMarkup = reviewKeyboard(review.ID)
+		_, err := app.Bot.Send(reply)
+		return l.Err(err)
+	}
+	document := tg.NewDocument(user.ChatID, tg.FileBytes{Name: "question-" + strconv.Itoa(int(question.ID)) + ".txt", Bytes: []byte(transcript)})
+	document.Caption = title
+	document.ReplyMarkup = reviewKeyboard(review.ID)
+	_, err := app.Bot.Send(&document)
+	return l.Err(err)
+}
+
+// questionTranscript returns the messages of the Question
+func questionTranscript(question *database.Question, app *App) []database.DialogMessage {
+	var messages []database.DialogMessage
+	for _, m := range database.ListDialog(question.UserID, database.DialogOptions{}, app.DB) {
+		if m.QuestionID == int(question.ID) {
+			messages = append(messages, m)
+		}
+	}
+	return messages
+}
+
+// reviewKeyboard returns the verdict and skip buttons of the QualityReview
+func reviewKeyboard(id uint) tg.InlineKeyboardMarkup {
+	data := "-" + strconv.Itoa(int(id))
+	return tg.NewInlineKeyboardMarkup(tg.NewInlineKeyboardRow(
+		tg.NewInlineKeyboardButtonData("✅ Approve", strconv.Itoa(CBReviewApprove)+data),
+		tg.NewInlineKeyboardButtonData("🛠 Needs work", strconv.Itoa(CBReviewNeedsWork)+data),
+		tg.NewInlineKeyboardButtonData("⏭ Skip", strconv.Itoa(CBReviewSkip)+data),
+	))
+}
+
+// answerReview records the verdict of the review button or skips to the next transcript
+//
+// The verdict is saved only if nobody reviewed the transcript before
+func answerReview(key int, data string, user *database.User, callback *tg.CallbackQuery, app *App) error {
+	if !hasPermission(user, PermReview, app) {
+		_, err := app.Bot.Request(tg.NewCallback(callback.ID, "You need the \""+PermReview+"\" permission"))
+		return l.Err(err)
+	}
+	id, err := strconv.Atoi(data)
+	if err != nil {
+		return l.Err(l.NewError("no id"))
+	}
+	verdict := database.VerdictApproved
+	switch key {
+	case CBReviewNeedsWork:
+		verdict = database.VerdictNeedsWork
+	case CBReviewSkip:
+		verdict = ""
+	}
+	saved, notice := false, ""
+	if verdict != "" {
+		saved, err = database.SetQualityVerdict(uint(id), verdict, int(user.ID), app.DB)
+		if err != nil {
+			return l.Err(err)
+		}
+		notice = "Saved"
+		if !saved {
+			notice = "Already reviewed"
+		}
+	}
+	_, err = app.Bot.Request(tg.NewCallback(callback.ID, notice))
+	if err != nil {
+		return l.Err(err)
+	}
+	empty := tg.InlineKeyboardMarkup{InlineKeyboard: [][]tg.InlineKeyboardButton{}}
+	_, err = app.Bot.Send(tg.NewEditMessageReplyMarkup(callback.Message.Chat.ID, callback.Message.MessageID, empty))
+	if err != nil && !tg.IsMessageNotModified(err) {
+		return l.Err(err)
+	}
+	if saved {
+		_, err = app.Bot.Send(tg.NewMessage(user.ChatID, "Review #"+data+": "+verdictName(verdict)+"\nAdd a comment with /review comment <text>"))
+		if err != nil {
+			return l.Err(err)
+		}
+	}
+	return l.Err(serveReview(uint(id), user, app))
+}
+
+// verdictName returns the readable verdict
+func verdictName(verdict string) string {
+	if verdict == database.VerdictNeedsWork {
+		return "needs work"
+	}
+	return verdict
+}
+
+// qualityStats returns the review outcome of every answering employee
+func qualityStats(app *App) string {
+	var b strings.Builder
+	b.WriteString("Quality review: " + strconv.Itoa(clampPercent(app.Conf.GetInt("review_sample"))) + "% of answered questions sampled, " +
+		strconv.Itoa(int(database.CountQualityReviews(app.DB))) + " unreviewed")
+	for _, s := range database.GetQualityStats(app.DB) {
+		name := "#" + strconv.Itoa(s.AnswererID)
+		if answerer := database.GetUserById(s.AnswererID, app.DB); answerer != nil {
+			name = userName(answerer)
+		}
+		fmt.Fprintf(&b, "\n%s: %d reviewed, approved %.0f%%, needs work %d, comments %d",
+			name, s.Reviewed, share(s.Approved, s.Reviewed), s.Reviewed-s.Approved, s.Comments)
+	}
+	return b.String()
+}
@@ -0,0 +1,239 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+	"testing"
+)
+
+// closedQuestion adds the Question of the user answered by employee 2 and closes it
+func closedQuestion(t *testing.T, app *App, chatID int, header, answer string) *database.Question {
+	t.Helper()
+	user, err := database.AddUser(chatID, fmt.Sprintf("user%d", chatID), SMain, app.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	question, err := database.AddQuestion(header, 5, user, app.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	employee := database.GetUserByChatID(2, app.DB)
+	if err := database.ChangeQuestionAnswerer(int(employee.ID), question, app.DB); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.AddCorrespondenceToQuestion(question, user, 5, header, app.DB); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.AddCorrespondenceToQuestion(question, employee, 6, answer, app.DB); err != nil {
+		t.Fatal(err)
+	}
+	if err := closeQuestion(question, app); err != nil {
+		t.Fatal(err)
+	}
+	return question
+}
+
+// owner adds admin 4 who reviews the answers of employee 2
+func owner(t *testing.T, app *App) *database.User {
+	app.Conf.Set("admins", []int{2, 4})
+	if err := database.AddEmployeeByID(app.DB, 4); err != nil {
+		t.Fatal(err)
+	}
+	return database.GetUserByChatID(4, app.DB)
+}
+
+// reviewCallback returns the press of the review button by the chat
+func reviewCallback(chatID, key int, reviewID uint) *tg.CallbackQuery {
+	return &tg.CallbackQuery{
+		ID:      "review",
+		From:    &tg.User{ID: chatID},
+		Message: &tg.Message{MessageID: 50, Chat: &tg.Chat{ID: chatID, Type: "private"}},
+		Data:    fmt.Sprintf("%d-%d", key, reviewID),
+	}
+}
+
+// queued reports whether the Question is in the quality review queue
+func queued(question *database.Question, app *App) bool {
+	var count int64
+	app.DB.Model(&database.QualityReview{}).Where("question_id = ?", question.ID).Count(&count)
+	return count == 1
+}
+
+// callbackAnswers returns the answers by callback ID, the alert texts are prefixed with "!"
+func callbackAnswers(api *testAPI) map[string][]string {
+	answers := map[string][]string{}
+	for _, call := range api.requests("answerCallbackQuery") {
+		id, _ := call.Params["callback_query_id"].(string)
+		text := call.text()
+		if alert, _ := call.Params["show_alert"].(bool); alert {
+			text = "!" + text
+		}
+		answers[id] = append(answers[id], text)
+	}
+	return answers
+}
+
+func TestReviewSampleIsSeeded(t *testing.T) {
+	app, _ := newTestApp(t)
+	app.Conf.Set("review_sample", 30)
+	app.Conf.Set("review_seed", "s1")
+	var sampled, other int
+	for i := 0; i < 40; i++ {
+		question := closedQuestion(t, app, 100+i, "question", "answer")
+		want := rolloutBucket("review:s1", question.ID) < 30
+		if got := queued(question, app); got != want {
+			t.Fatalf("#%d: queued = %t, want %t", question.ID, got, want)
+		}
+		if want {
+			sampled++
+		}
+		if rolloutBucket("review:s2", question.ID) < 30 != want {
+			other++
+		}
+	}
+	if sampled == 0 || sampled == 40 || other == 0 {
+		t.Fatalf("%d of 40 sampled, %d differ with another seed", sampled, other)
+	}
+
+	app.Conf.Set("review_sample", 0)
+	if queued(closedQuestion(t, app, 150, "question", "answer"), app) {
+		t.Fatal("a question is sampled at 0%")
+	}
+
+	user, err := database.AddUser(200, "user200", SMain, app.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.Conf.Set("review_sample", 100)
+	unanswered, err := database.AddQuestion("spam", 5, user, app.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := closeQuestion(unanswered, app); err != nil {
+		t.Fatal(err)
+	}
+	if queued(unanswered, app) {
+		t.Fatal("a question nobody answered is sampled")
+	}
+}
+
+func TestReviewQueue(t *testing.T) {
+	app, api := newTestApp(t)
+	app.Conf.Set("review_sample", 100)
+	reviewer := owner(t, app)
+	first := closedQuestion(t, app, 10, "The app crashes", "Update to 2.1")
+	second := closedQuestion(t, app, 11, "Where is my refund", "Tomorrow")
+
+	parseMessage(commandMessage(4, "/review"), app)
+	messages := api.requests("sendMessage")
+	served := messages[len(messages)-1]
+	if !strings.HasPrefix(served.text(), fmt.Sprintf("Review #1 (2 unreviewed)\nQuestion #%d answered by ", first.ID)) ||
+		!strings.Contains(served.text(), "User: The app crashes\n") || !strings.Contains(served.text(), "Employee: Update to 2.1\n") {
+		t.Fatalf("transcript = %q", served.text())
+	}
+	if served.Params["reply_markup"] == nil {
+		t.Fatal("no verdict buttons")
+	}
+
+	if err := parseCallback(reviewCallback(4, CBReviewApprove, 1), app); err != nil {
+		t.Fatal(err)
+	}
+	sent := api.sentTo(4)
+	if sent[len(sent)-2] != "Review #1: approved\nAdd a comment with /review comment <text>" ||
+		!strings.HasPrefix(sent[len(sent)-1], fmt.Sprintf("Review #2 (1 unreviewed)\nQuestion #%d", second.ID)) {
+		t.Fatalf("after approval = %q", sent[len(sent)-2:])
+	}
+	if edits := api.requests("editMessageReplyMarkup"); len(edits) != 1 || edits[0].Params["message_id"] != float64(50) {
+		t.Fatalf("edits = %+v, want the buttons removed", edits)
+	}
+
+	parseMessage(commandMessage(4, "/review comment Polite and fast"), app)
+	if got := lastSent(api, 4); got != "Comment on review #1 saved" {
+		t.Fatalf("/review comment = %q", got)
+	}
+
+	// The stale button of the reviewed transcript doesn't change the verdict
+	count := len(api.sentTo(4))
+	if err := parseCallback(reviewCallback(4, CBReviewNeedsWork, 1), app); err != nil {
+		t.Fatal(err)
+	}
+	if answers := callbackAnswers(api)["review"]; answers[len(answers)-1] != "Already reviewed" {
+		t.Fatalf("callback answers = %q", answers)
+	}
+	if sent := api.sentTo(4)[count:]; len(sent) != 1 || !strings.HasPrefix(sent[0], "Review #2") {
+		t.Fatalf("after a double review = %q", sent)
+	}
+
+	if err := parseCallback(reviewCallback(4, CBReviewNeedsWork, 2), app); err != nil {
+		t.Fatal(err)
+	}
+	if got := lastSent(api, 4); got != "The review queue is empty" {
+		t.Fatalf("after the last review = %q", got)
+	}
+
+	mainState(t, app)
+	parseMessage(commandMessage(2, "/stats quality"), app)
+	want := "Quality review: 100% of answered questions sampled, 0 unreviewed\n" + userName(database.GetUserByChatID(2, app.DB)) +
+		": 2 reviewed, approved 50%, needs work 1, comments 1"
+	if got := lastSent(api, 2); got != want {
+		t.Fatalf("/stats quality = %q, want %q", got, want)
+	}
+	if review := database.GetLastQualityReview(int(reviewer.ID), app.DB); review == nil || review.Verdict != database.VerdictNeedsWork {
+		t.Fatalf("last review = %+v", review)
+	}
+}
+
+func TestReviewSkipsAndPersists(t *testing.T) {
+	app, api := newTestApp(t)
+	app.Conf.Set("review_sample", 100)
+	owner(t, app)
+	closedQuestion(t, app, 10, "first", "answer")
+	closedQuestion(t, app, 11, "second", "answer")
+
+	if err := parseCallback(reviewCallback(4, CBReviewSkip, 1), app); err != nil {
+		t.Fatal(err)
+	}
+	if got := lastSent(api, 4); !strings.HasPrefix(got, "Review #2 (2 unreviewed)") {
+		t.Fatalf("after skip = %q", got)
+	}
+	if err := parseCallback(reviewCallback(4, CBReviewSkip, 2), app); err != nil {
+		t.Fatal(err)
+	}
+	if got := lastSent(api, 4); got != "No more transcripts, /review starts from the beginning of the queue" {
+		t.Fatalf("after the last skip = %q", got)
+	}
+
+	restarted := NewApp(app.Bot, app.DB, app.Conf)
+	parseMessage(commandMessage(4, "/review"), restarted)
+	if got := lastSent(api, 4); !strings.HasPrefix(got, "Review #1 (2 unreviewed)") {
+		t.Fatalf("/review after a restart = %q", got)
+	}
+
+	// Employee 2 answered both questions and can't review them
+	parseMessage(commandMessage(2, "/review"), app)
+	if got := lastSent(api, 2); got != "The review queue is empty" {
+		t.Fatalf("/review of the answerer = %q", got)
+	}
+	parseMessage(commandMessage(4, "/review comment"), app)
+	if got := lastSent(api, 4); got != "Format: /review [comment <text>]" {
+		t.Fatalf("/review comment = %q", got)
+	}
+}
+
+func TestReviewNeedsPermission(t *testing.T) {
+	app, api := newTestApp(t)
+	app.Conf.Set("review_sample", 100)
+	operator(t, app, PermExport)
+	closedQuestion(t, app, 10, "first", "answer")
+	if err := parseCallback(reviewCallback(2, CBReviewApprove, 1), app); err != nil {
+		t.Fatal(err)
+	}
+	if answers := callbackAnswers(api)["review"]; len(answers) != 1 || answers[0] != `You need the "review" permission` {
+		t.Fatalf("callback answers = %q", answers)
+	}
+	if database.CountQualityReviews(app.DB) != 1 {
+		t.Fatal("the verdict is saved without the permission")
+	}
+}
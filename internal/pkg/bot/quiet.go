@@ -0,0 +1,294 @@
+package bot
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	l "telegram-bot-feedback/internal/pkg/logger"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+	"time"
+)
+
+// quietOff is the quiet hours preference of a user who wants every notification at once
+const quietOff = "off"
+
+// quietPresets are the quiet hours offered by the /settings buttons
+var quietPresets = []string{"22:00-07:00", "23:00-08:00", "00:00-09:00"}
+
+// quietWindow is the daily quiet hours in minutes after midnight, the end is before the start when the window passes midnight
+type quietWindow struct {
+	start, end int
+}
+
+// parseQuietWindow parses "HH:MM-HH:MM", ok is false for "", "off" and malformed windows
+func parseQuietWindow(spec string) (quietWindow, bool) {
+	from, to, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found {
+		return quietWindow{}, false
+	}
+	start, err := time.Parse("15:04", strings.TrimSpace(from))
+	if err != nil {
+		return quietWindow{}, false
+	}
+	end, err := time.Parse("15:04", strings.TrimSpace(to))
+	if err != nil {
+		return quietWindow{}, false
+	}
+	window := quietWindow{start: start.Hour()*60 + start.Minute(), end: end.Hour()*60 + end.Minute()}
+	return window, window.start != window.end
+}
+
+// until returns the end of the quiet hours if the time is inside them
+func (w quietWindow) until(now time.Time) (time.Time, bool) {
+	minute := now.Hour()*60 + now.Minute()
+	inside := w.start <= minute && minute < w.end
+	if w.start > w.end {
+		inside = minute >= w.start || minute < w.end
+	}
+	if !inside {
+		return time.Time{}, false
+	}
+	end := time.Date(now.Year(), now.Month(), now.Day(), w.end/60, w.end%60, 0, 0, now.Location())
+	if !end.After(now) {
+		end = end.AddDate(0, 0, 1)
+	}
+	return end, true
+}
+
+// quietHours returns the quiet hours preference of the user, "quiet_hours" if the user hasn't chosen
+func quietHours(user *database.User, hooks *Hooks) string {
+	if user.QuietHours != "" {
+		return user.QuietHours
+	}
+	return hooks.Conf.GetString("quiet_hours")
+}
+
+// userLocation returns the time zone of the user, "timezone" if the user hasn't chosen
+func userLocation(user *database.User, hooks *Hooks) *time.Location {
+	name := user.Timezone
+	if name == "" {
+		name = hooks.Conf.GetString("timezone")
+	}
+	location, err := loadZone(name)
+	if err != nil {
+		l.Error(l.Err(err))
+		return time.Local
+	}
+	return location
+}
+
+// loadZone returns the time zone by IANA name or by offset from UTC, e.g. "UTC+3" or "UTC-5:30"
+func loadZone(name string) (*time.Location, error) {
+	offset, ok := strings.CutPrefix(name, "UTC")
+	if !ok || offset == "" {
+		return time.LoadLocation(name)
+	}
+	sign := 1
+	switch offset[0] {
+	case '-':
+		sign = -1
+	case '+':
+	default:
+		return nil, l.NewError("Wrong time zone \"" + name + "\"")
+	}
+	hours, minutes, _ := strings.Cut(offset[1:], ":")
+	h, err := strconv.Atoi(hours)
+	if err != nil || h > 14 {
+		return nil, l.NewError("Wrong time zone \"" + name + "\"")
+	}
+	m := 0
+	if minutes != "" {
+		m, err = strconv.Atoi(minutes)
+		if err != nil || m >= 60 {
+			return nil, l.NewError("Wrong time zone \"" + name + "\"")
+		}
+	}
+	return time.FixedZone(name, sign*(h*3600+m*60)), nil
+}
+
+// zoneName returns "UTC+3" for the offset in seconds
+func zoneName(offset int) string {
+	sign := "+"
+	if offset < 0 {
+		sign, offset = "-", -offset
+	}
+	name := "UTC" + sign + strconv.Itoa(offset/3600)
+	if minutes := offset % 3600 / 60; minutes != 0 {
+		name += ":" + strconv.Itoa(minutes/10) + strconv.Itoa(minutes%10)
+	}
+	return name
+}
+
+// quietUntil returns the end of the quiet hours of the user if the time is inside them
+func quietUntil(user *database.User, now time.Time, hooks *Hooks) (time.Time, bool) {
+	window, ok := parseQuietWindow(quietHours(user, hooks))
+	if !ok {
+		return time.Time{}, false
+	}
+	return window.until(now.In(userLocation(user, hooks)))
+}
+
+// holdMessage queues the message until the quiet hours of the user end, returns false outside the quiet hours
+//
+// Collapsing messages of the same Question replace each other while they wait
+func holdMessage(user *database.User, method string, message interface{}, questionId int, collapse bool, hooks *Hooks) (bool, error) {
+	until, quiet := quietUntil(user, clock(), hooks)
+	if !quiet {
+		return false, nil
+	}
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return false, l.Err(err)
+	}
+	err = database.AddQuietMessage(user.ChatID, method, string(payload), questionId, collapse, until, hooks.DB)
+	if err != nil {
+		return false, l.Err(err)
+	}
+	return true, nil
+}
+
+// sendNotice sends the non-urgent notification about the Question, during the quiet hours of the user it is held
+//
+// Notices of the same Question held together collapse into the last one
+func sendNotice(user *database.User, message tg.SendMessageConf, questionId int, hooks *Hooks) error {
+	held, err := holdMessage(user, "sendMessage", message, questionId, true, hooks)
+	if err != nil || held {
+		return l.Err(err)
+	}
+	_, err = hooks.Bot.Send(message)
+	return l.Err(err)
+}
+
+// releaseQuietMessages moves the messages whose quiet hours are over to the outbox, which keeps their order
+func releaseQuietMessages(app *App) {
+	for _, message := range database.GetDueQuietMessages(clock(), app.DB) {
+		message := message
+		err := database.AddOutboxMessage(message.ChatID, message.Method, message.Payload, message.QuestionID, clock(), app.DB)
+		if err != nil {
+			l.Error(err)
+			continue
+		}
+		err = database.RemoveQuietMessage(&message, app.DB)
+		if err != nil {
+			l.Error(err)
+		}
+	}
+}
+
+// sendLater answers the Question with the text when the quiet hours of the user end
+//
+// Format: /later <text> in reply to a message of the Question, or without a reply for the taken Question.
+// Other answers of employees are delivered at once, outside the quiet hours so is this one
+func sendLater(message *tg.Message, user *database.User, app *App) error {
+	text := strings.TrimSpace(message.CommandArguments())
+	if text == "" {
+		_, err := app.Bot.Send(tg.NewMessage(user.ChatID, "Format: /later <text> in reply to a question, the answer waits for the end of the user's quiet hours"))
+		return l.Err(err)
+	}
+	question := templateQuestion(message, user, app)
+	if question == nil {
+		_, err := app.Bot.Send(tg.NewMessage(user.ChatID, "Reply with /later to a message of an open question"))
+		return l.Err(err)
+	}
+	answer := tg.NewMessage(question.User.ChatID, text)
+	held, err := holdMessage(&question.User, "sendMessage", answer, int(question.ID), false, app.hooks)
+	if err != nil {
+		return l.Err(err)
+	}
+	if held {
+		until, _ := quietUntil(&question.User, clock(), app.hooks)
+		_, err = app.Bot.Send(tg.NewMessage(user.ChatID, "The answer will be sent at "+until.Format("15:04")+" "+zoneName(zoneOffset(until))+", after the quiet hours of the user"))
+	} else {
+		err = sendToUser(question.User.ChatID, answer, question, app)
+	}
+	if err != nil {
+		return l.Err(err)
+	}
+	return l.Err(recordAnswer(question, user, message.MessageID, text, app))
+}
+
+// zoneOffset returns the offset of the time zone of the time in seconds
+func zoneOffset(t time.Time) int {
+	_, offset := t.Zone()
+	return offset
+}
+
+// quietSettingsText returns the quiet hours and the time zone of the user
+func quietSettingsText(user *database.User, app *App) string {
+	window := quietHours(user, app.hooks)
+	if _, ok := parseQuietWindow(window); !ok {
+		window = quietOff
+	}
+	location := userLocation(user, app.hooks)
+	return "Quiet hours: " + window + ", " + location.String() + " (now " + clock().In(location).Format("15:04") + ")" +
+		"\nResolution notices and surveys wait for the end of the quiet hours" +
+		"\n/settings quiet HH:MM-HH:MM|off|default\n/settings timezone Europe/Berlin|UTC+3|default"
+}
+
+// quietKeyboard returns the quiet hours presets and the time zone buttons, the zone moves by an hour
+func quietKeyboard(user *database.User, app *App) tg.InlineKeyboardMarkup {
+	data := strconv.Itoa(CBSettings) + "-"
+	var presets []tg.InlineKeyboardButton
+	for i, preset := range quietPresets {
+		label := preset
+		if user.QuietHours == preset {
+			label = "• " + label
+		}
+		presets = append(presets, tg.NewInlineKeyboardButtonData(label, data+"q"+strconv.Itoa(i)))
+	}
+	offset := zoneOffset(clock().In(userLocation(user, app.hooks)))
+	return tg.NewInlineKeyboardMarkup(
+		presets,
+		tg.NewInlineKeyboardRow(
+			tg.NewInlineKeyboardButtonData("Off", data+"qoff"),
+			tg.NewInlineKeyboardButtonData("Default", data+"qdefault"),
+		),
+		tg.NewInlineKeyboardRow(
+			tg.NewInlineKeyboardButtonData("◀️", data+"west"),
+			tg.NewInlineKeyboardButtonData(zoneName(offset), data+"zone"),
+			tg.NewInlineKeyboardButtonData("▶️", data+"east"),
+		),
+	)
+}
+
+// changeQuietSettings applies the /settings button and updates the settings message
+func changeQuietSettings(data string, user *database.User, callback *tg.CallbackQuery, app *App) error {
+	var err error
+	switch {
+	case data == "qoff":
+		err = database.ChangeUserQuietHours(quietOff, user, app.DB)
+	case data == "qdefault":
+		err = database.ChangeUserQuietHours("", user, app.DB)
+	case strings.HasPrefix(data, "q"):
+		i, convErr := strconv.Atoi(data[1:])
+		if convErr != nil || i < 0 || i >= len(quietPresets) {
+			return l.Err(answerCallback(callback, app))
+		}
+		err = database.ChangeUserQuietHours(quietPresets[i], user, app.DB)
+	case data == "west" || data == "east":
+		offset := zoneOffset(clock().In(userLocation(user, app.hooks)))/3600*3600 - 3600
+		if data == "east" {
+			offset += 2 * 3600
+		}
+		if offset < -12*3600 || offset > 14*3600 {
+			return l.Err(answerCallback(callback, app))
+		}
+		err = database.ChangeUserTimezone(zoneName(offset), user, app.DB)
+	}
+	if err != nil {
+		return l.Err(err)
+	}
+	err = answerCallback(callback, app)
+	if err != nil {
+		return l.Err(err)
+	}
+	edit := tg.NewEditMessageText(callback.Message.Chat.ID, callback.Message.MessageID, settingsText(user, app))
+	markup := quietKeyboard(user, app)
+	edit.ReplyMarkup = &markup
+	_, err = app.Bot.Send(edit)
+	if tg.IsMessageNotModified(err) {
+		return nil
+	}
+	return l.Err(err)
+}
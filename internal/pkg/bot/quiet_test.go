@@ -0,0 +1,283 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+	"testing"
+	"time"
+)
+
+// quietAt sets the quiet hours 22:00-07:00 in UTC and the clock to the time of October 17
+func quietAt(t *testing.T, app *App, hour, minute int) time.Time {
+	app.Conf.Set("quiet_hours", "22:00-07:00")
+	app.Conf.Set("timezone", "UTC")
+	now := time.Date(2026, 10, 17, hour, minute, 0, 0, time.UTC)
+	setClock(t, func() time.Time { return now })
+	return now
+}
+
+func TestQuietWindowUntil(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip(err)
+	}
+	at := func(day, hour, minute int, location *time.Location) time.Time {
+		return time.Date(2026, 10, day, hour, minute, 0, 0, location)
+	}
+	tests := []struct {
+		window string
+		now    time.Time
+		until  time.Time
+		quiet  bool
+	}{
+		{"22:00-07:00", at(17, 23, 30, time.UTC), at(18, 7, 0, time.UTC), true},
+		{"22:00-07:00", at(17, 22, 0, time.UTC), at(18, 7, 0, time.UTC), true},
+		{"22:00-07:00", at(18, 3, 0, time.UTC), at(18, 7, 0, time.UTC), true},
+		{"22:00-07:00", at(18, 0, 0, time.UTC), at(18, 7, 0, time.UTC), true},
+		{"22:00-07:00", at(18, 7, 0, time.UTC), time.Time{}, false},
+		{"22:00-07:00", at(17, 21, 59, time.UTC), time.Time{}, false},
+		{"13:00-14:30", at(17, 13, 45, time.UTC), at(17, 14, 30, time.UTC), true},
+		{"13:00-14:30", at(17, 12, 59, time.UTC), time.Time{}, false},
+		{"13:00-14:30", at(17, 14, 30, time.UTC), time.Time{}, false},
+		{"23:00-08:00", at(17, 23, 15, berlin), at(18, 8, 0, berlin), true},
+	}
+	for _, tt := range tests {
+		window, ok := parseQuietWindow(tt.window)
+		if !ok {
+			t.Fatalf("%s is not parsed", tt.window)
+		}
+		until, quiet := window.until(tt.now)
+		if quiet != tt.quiet || !until.Equal(tt.until) {
+			t.Errorf("%s at %s = %s, %t, want %s, %t", tt.window, tt.now, until, quiet, tt.until, tt.quiet)
+		}
+	}
+	for _, spec := range []string{"", quietOff, "22:00", "25:00-07:00", "22:00-7", "22:00-22:00"} {
+		if _, ok := parseQuietWindow(spec); ok {
+			t.Errorf("%q is a quiet window", spec)
+		}
+	}
+}
+
+func TestLoadZone(t *testing.T) {
+	tests := []struct {
+		name   string
+		offset int
+	}{
+		{"UTC+3", 3 * 3600},
+		{"UTC-5:30", -(5*3600 + 30*60)},
+		{"UTC+14", 14 * 3600},
+		{"UTC", 0},
+	}
+	for _, tt := range tests {
+		location, err := loadZone(tt.name)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if offset := zoneOffset(time.Date(2026, 1, 1, 0, 0, 0, 0, location)); offset != tt.offset {
+			t.Errorf("%s: offset = %d, want %d", tt.name, offset, tt.offset)
+		}
+		if tt.offset != 0 && zoneName(tt.offset) != tt.name {
+			t.Errorf("zoneName(%d) = %q, want %q", tt.offset, zoneName(tt.offset), tt.name)
+		}
+	}
+	for _, name := range []string{"UTC*3", "UTC+15", "UTC+3:60", "UTC+x", "Mars/Base"} {
+		if _, err := loadZone(name); err == nil {
+			t.Errorf("%q is a time zone", name)
+		}
+	}
+	if zoneName(0) != "UTC+0" {
+		t.Errorf("zoneName(0) = %q", zoneName(0))
+	}
+}
+
+func TestQuietHoursOfUserOverrideDefault(t *testing.T) {
+	app, _ := newTestApp(t)
+	now := quietAt(t, app, 23, 30)
+	user := &database.User{}
+	if until, quiet := quietUntil(user, now, app.hooks); !quiet || !until.Equal(now.Add(7*time.Hour+30*time.Minute)) {
+		t.Fatalf("default window: %s, %t", until, quiet)
+	}
+	if _, quiet := quietUntil(&database.User{QuietHours: quietOff}, now, app.hooks); quiet {
+		t.Fatal("the user who turned the quiet hours off is held")
+	}
+	// 23:30 UTC is 02:30 in UTC+3, still inside, the window ends at 07:00 of UTC+3
+	until, quiet := quietUntil(&database.User{Timezone: "UTC+3"}, now, app.hooks)
+	if !quiet || !until.Equal(time.Date(2026, 10, 18, 4, 0, 0, 0, time.UTC)) {
+		t.Fatalf("UTC+3: %s, %t", until, quiet)
+	}
+	if _, quiet := quietUntil(&database.User{Timezone: "UTC-3"}, now, app.hooks); quiet {
+		t.Fatal("20:30 in UTC-3 is inside the quiet hours")
+	}
+}
+
+func TestResolveNoticeWaitsForQuietHours(t *testing.T) {
+	app, api := newTestApp(t)
+	quietAt(t, app, 23, 30)
+	question := resolvedQuestion(t, app, api)
+	if len(api.sentTo(1)) != 0 || len(api.requests("sendPoll")) != 0 {
+		t.Fatalf("sent during the quiet hours: %q, %d polls", api.sentTo(1), len(api.requests("sendPoll")))
+	}
+	if count := database.CountQuietMessages(app.DB); count != 2 {
+		t.Fatalf("%d held messages, want the notice and the survey", count)
+	}
+
+	// A later notice of the same ticket replaces the held one
+	notice := tg.NewMessage(1, "Your ticket "+ticketNumber(question)+" has been reopened and resolved again")
+	if err := sendNotice(&question.User, notice, int(question.ID), app.hooks); err != nil {
+		t.Fatal(err)
+	}
+	if count := database.CountQuietMessages(app.DB); count != 2 {
+		t.Fatalf("%d held messages, want the notices collapsed", count)
+	}
+
+	// The held messages are in the database, a restart doesn't lose them
+	releaseQuietMessages(app)
+	if len(database.GetDueQuietMessages(time.Date(2026, 10, 18, 6, 59, 0, 0, time.UTC), app.DB)) != 0 {
+		t.Fatal("messages are due before the end of the quiet hours")
+	}
+	morning := time.Date(2026, 10, 18, 7, 0, 0, 0, time.UTC)
+	setClock(t, func() time.Time { return morning })
+	releaseQuietMessages(app)
+	if database.CountQuietMessages(app.DB) != 0 {
+		t.Fatal("released messages are still held")
+	}
+	// The outbox sends one message of a chat per pass
+	drainOutbox(context.Background(), app)
+	drainOutbox(context.Background(), app)
+	if sent := api.sentTo(1); len(sent) != 1 || !strings.Contains(sent[0], "resolved again") {
+		t.Fatalf("sent = %q, want only the last notice", sent)
+	}
+	if len(api.requests("sendPoll")) != 1 {
+		t.Fatal("the survey is not sent after the quiet hours")
+	}
+	if question := database.GetQuestionById(int(question.ID), app.DB); question.SurveyPollID != "poll1" {
+		t.Fatalf("survey = %q, want the poll sent from the outbox stored", question.SurveyPollID)
+	}
+}
+
+func TestResolveNoticeOutsideQuietHours(t *testing.T) {
+	app, api := newTestApp(t)
+	quietAt(t, app, 12, 0)
+	resolvedQuestion(t, app, api)
+	if sent := api.sentTo(1); len(sent) != 1 || !strings.Contains(sent[0], "has been resolved") {
+		t.Fatalf("sent = %q", sent)
+	}
+	if len(api.requests("sendPoll")) != 1 || database.CountQuietMessages(app.DB) != 0 {
+		t.Fatal("messages are held outside the quiet hours")
+	}
+}
+
+func TestAnswersBypassQuietHours(t *testing.T) {
+	app, api := newTestApp(t)
+	quietAt(t, app, 3, 0)
+	answeredQuestion(t, app)
+	addTestTemplate(t, app, "hi", "Hello {{user}}")
+	parseMessage(commandMessage(2, "/t hi"), app)
+	if sent := api.sentTo(1); len(sent) != 1 || database.CountQuietMessages(app.DB) != 0 {
+		t.Fatalf("sent = %q, want the answer at once", sent)
+	}
+}
+
+func TestSendLater(t *testing.T) {
+	app, api := newTestApp(t)
+	quietAt(t, app, 3, 0)
+	question := answeredQuestion(t, app)
+	parseMessage(commandMessage(2, "/later we fixed it"), app)
+	if got := lastSent(api, 2); got != "The answer will be sent at 07:00 UTC+0, after the quiet hours of the user" {
+		t.Fatalf("reply = %q", got)
+	}
+	if len(api.sentTo(1)) != 0 || database.CountQuietMessages(app.DB) != 1 {
+		t.Fatal("the answer is not held")
+	}
+	if question := database.GetQuestionById(int(question.ID), app.DB); !question.HaveAnswer {
+		t.Fatal("the held answer is not recorded")
+	}
+
+	quietAt(t, app, 12, 0)
+	parseMessage(commandMessage(2, "/later and deployed it"), app)
+	if sent := api.sentTo(1); len(sent) != 1 || sent[0] != "and deployed it" {
+		t.Fatalf("sent = %q, want the answer at once outside the quiet hours", sent)
+	}
+	if database.CountQuietMessages(app.DB) != 1 {
+		t.Fatal("the answer outside the quiet hours is held")
+	}
+
+	parseMessage(commandMessage(2, "/later"), app)
+	if got := lastSent(api, 2); !strings.HasPrefix(got, "Format: /later <text>") {
+		t.Fatalf("/later without text = %q", got)
+	}
+}
+
+func TestQuietSettingsCommand(t *testing.T) {
+	app, api := newTestApp(t)
+	quietAt(t, app, 12, 0)
+	answeredQuestion(t, app)
+	tests := []struct {
+		command   string
+		quiet, tz string
+	}{
+		{"/settings quiet 23:00-08:00", "23:00-08:00", ""},
+		{"/settings quiet 25:00-08:00", "23:00-08:00", ""},
+		{"/settings timezone UTC+3", "23:00-08:00", "UTC+3"},
+		{"/settings timezone Mars/Base", "23:00-08:00", "UTC+3"},
+		{"/settings quiet off", quietOff, "UTC+3"},
+		{"/settings quiet default", "", "UTC+3"},
+		{"/settings timezone default", "", ""},
+	}
+	for _, tt := range tests {
+		parseMessage(commandMessage(1, tt.command), app)
+		user := database.GetUserByChatID(1, app.DB)
+		if user.QuietHours != tt.quiet || user.Timezone != tt.tz {
+			t.Errorf("%s: quiet %q, zone %q, want %q, %q", tt.command, user.QuietHours, user.Timezone, tt.quiet, tt.tz)
+		}
+	}
+	if got := lastSent(api, 1); !strings.Contains(got, "Quiet hours: 22:00-07:00, UTC (now 12:00)") {
+		t.Fatalf("settings = %q", got)
+	}
+	if markup := api.requests("sendMessage"); markup[len(markup)-1].Params["reply_markup"] == nil {
+		t.Fatal("the settings have no buttons")
+	}
+}
+
+func TestQuietSettingsButtons(t *testing.T) {
+	app, api := newTestApp(t)
+	quietAt(t, app, 12, 0)
+	answeredQuestion(t, app)
+	press := func(data string) {
+		t.Helper()
+		callback := &tg.CallbackQuery{ID: data, From: &tg.User{ID: 1}, Message: &tg.Message{MessageID: 60, Chat: &tg.Chat{ID: 1, Type: "private"}},
+			Data: strconv.Itoa(CBSettings) + "-" + data}
+		if err := parseCallback(callback, app); err != nil {
+			t.Fatal(err)
+		}
+	}
+	press("q1")
+	press("west")
+	press("west")
+	user := database.GetUserByChatID(1, app.DB)
+	if user.QuietHours != quietPresets[1] || user.Timezone != "UTC-2" {
+		t.Fatalf("quiet %q, zone %q", user.QuietHours, user.Timezone)
+	}
+	edits := api.requests("editMessageText")
+	if len(edits) != 3 || !strings.Contains(edits[2].text(), "Quiet hours: 23:00-08:00, UTC-2 (now 10:00)") {
+		t.Fatalf("edits = %+v", edits)
+	}
+	if markup := edits[2].Params["reply_markup"]; !strings.Contains(fmt.Sprint(markup), "• 23:00-08:00") {
+		t.Fatalf("markup = %v, want the chosen preset marked", markup)
+	}
+
+	press("qoff")
+	press("east")
+	press("q9")
+	user = database.GetUserByChatID(1, app.DB)
+	if user.QuietHours != quietOff || user.Timezone != "UTC-1" || len(api.requests("editMessageText")) != 5 {
+		t.Fatalf("quiet %q, zone %q, %d edits", user.QuietHours, user.Timezone, len(api.requests("editMessageText")))
+	}
+	if answers := callbackAnswers(api); len(answers["q9"]) != 1 || len(answers["east"]) != 1 {
+		t.Fatalf("callback answers = %q", answers)
+	}
+}
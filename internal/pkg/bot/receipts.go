@@ -0,0 +1,90 @@
+package bot
+
+import (
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	l "telegram-bot-feedback/internal/pkg/logger"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+)
+
+// Receipt modes
+const (
+	ReceiptText     = "text"
+	ReceiptReaction = "reaction"
+)
+
+// answeredReaction replaces the receipt reaction when the question is answered
+const answeredReaction = "✅"
+
+// receiptMode returns how the user's questions are acknowledged, the user preference overrides "receipts"
+func receiptMode(user *database.User, app *App) string {
+	if user.Receipts != "" {
+		return user.Receipts
+	}
+	return app.Conf.GetString("receipts")
+}
+
+// acknowledgeQuestion reacts to the message of the new question with "ack_reaction"
+//
+// The text receipt is sent in the text mode or when the reaction fails (e.g. reactions are disabled)
+func acknowledgeQuestion(message *tg.Message, user *database.User, app *App) error {
+	if receiptMode(user, app) == ReceiptReaction {
+		_, err := app.Bot.RequestOK(tg.NewSetMessageReaction(message.Chat.ID, message.MessageID, app.Conf.GetString("ack_reaction")))
+		if err == nil {
+			return nil
+		}
+		l.Error(l.Err(err))
+	}
+	return l.Err(responser(user, app))
+}
+
+// markAnswered changes the receipt reaction of the question to answeredReaction on the first answer
+func markAnswered(question *database.Question, app *App) {
+	if question.HaveAnswer || question.MessageID == 0 || receiptMode(&question.User, app) != ReceiptReaction {
+		return
+	}
+	_, err := app.Bot.RequestOK(tg.NewSetMessageReaction(question.User.ChatID, question.MessageID, answeredReaction))
+	if err != nil {
+		l.Error(l.Err(err))
+	}
+}
+
+// userSettings shows and changes the user preferences
+//
+// Format: /settings receipts text|reaction, /settings quiet HH:MM-HH:MM|off|default, /settings timezone <zone>|default.
+// The quiet hours and the time zone can also be changed with the buttons
+func userSettings(message *tg.Message, user *database.User, app *App) error {
+	args := strings.Fields(message.CommandArguments())
+	var err error
+	switch {
+	case len(args) != 2:
+	case args[0] == "receipts" && (args[1] == ReceiptText || args[1] == ReceiptReaction):
+		err = database.ChangeUserReceipts(args[1], user, app.DB)
+	case args[0] == "quiet" && args[1] == "default":
+		err = database.ChangeUserQuietHours("", user, app.DB)
+	case args[0] == "quiet" && args[1] == quietOff:
+		err = database.ChangeUserQuietHours(quietOff, user, app.DB)
+	case args[0] == "quiet":
+		if _, ok := parseQuietWindow(args[1]); ok {
+			err = database.ChangeUserQuietHours(args[1], user, app.DB)
+		}
+	case args[0] == "timezone" && args[1] == "default":
+		err = database.ChangeUserTimezone("", user, app.DB)
+	case args[0] == "timezone":
+		if _, zoneErr := loadZone(args[1]); zoneErr == nil {
+			err = database.ChangeUserTimezone(args[1], user, app.DB)
+		}
+	}
+	if err != nil {
+		return l.Err(err)
+	}
+	reply := tg.NewMessage(user.ChatID, settingsText(user, app))
+	reply.ReplyMarkup = quietKeyboard(user, app)
+	_, err = app.Bot.Send(reply)
+	return l.Err(err)
+}
+
+// settingsText returns the preferences of the user with the commands changing them
+func settingsText(user *database.User, app *App) string {
+	return "Receipts: " + receiptMode(user, app) + "\n/settings receipts text|reaction\n\n" + quietSettingsText(user, app)
+}
@@ -0,0 +1,91 @@
+package bot
+
+import (
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	"testing"
+)
+
+// reactions returns the emoji of setMessageReaction requests to the message of chat 1
+func reactions(api *testAPI, messageID int) []string {
+	var emoji []string
+	for _, call := range api.requests("setMessageReaction") {
+		if call.chatID() != 1 || call.Params["message_id"] != float64(messageID) {
+			continue
+		}
+		for _, r := range call.Params["reaction"].([]interface{}) {
+			emoji = append(emoji, r.(map[string]interface{})["emoji"].(string))
+		}
+	}
+	return emoji
+}
+
+// answerAsEmployee sends the answer of employee 2 who took the question
+func answerAsEmployee(t *testing.T, app *App, question *database.Question, messageID int) {
+	employee := database.GetUserByChatID(2, app.DB)
+	if err := database.ChangeQuestionAnswerer(int(employee.ID), question, app.DB); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.ChangeUserState(SQuestionDiscussion, employee, app.DB); err != nil {
+		t.Fatal(err)
+	}
+	parseMessage(privateMessage(2, messageID, "Please update the app"), app)
+}
+
+func TestReactionReceipt(t *testing.T) {
+	app, api := newTestApp(t)
+	app.Conf.Set("receipts", ReceiptReaction)
+	question := askQuestion(t, app, "It crashes")
+	if got := reactions(api, 5); strings.Join(got, " ") != "👀" {
+		t.Fatalf("reactions = %v", got)
+	}
+	if sent := api.sentTo(1); len(sent) != 0 {
+		t.Fatalf("the text receipt is sent too: %q", sent)
+	}
+	answerAsEmployee(t, app, question, 60)
+	parseMessage(privateMessage(2, 61, "Does it help?"), app)
+	if got := reactions(api, 5); strings.Join(got, " ") != "👀 ✅" {
+		t.Fatalf("reactions after the answers = %v", got)
+	}
+}
+
+func TestReactionReceiptFallsBackToText(t *testing.T) {
+	app, api := newTestApp(t)
+	app.Conf.Set("receipts", ReceiptReaction)
+	api.fail("setMessageReaction", 400, "Bad Request: REACTION_INVALID")
+	askQuestion(t, app, "It crashes")
+	if sent := lastSent(api, 1); !strings.Contains(sent, "Thank you for your question") {
+		t.Fatalf("the user got %q", sent)
+	}
+}
+
+func TestTextReceiptByDefault(t *testing.T) {
+	app, api := newTestApp(t)
+	question := askQuestion(t, app, "It crashes")
+	answerAsEmployee(t, app, question, 60)
+	if len(api.requests("setMessageReaction")) != 0 {
+		t.Fatal("reactions are sent in the text mode")
+	}
+	if sent := lastSent(api, 1); sent == "" {
+		t.Fatal("no text receipt")
+	}
+}
+
+func TestReceiptSettingOverridesConfig(t *testing.T) {
+	app, api := newTestApp(t)
+	if _, err := database.AddUser(1, "user1", SMain, app.DB); err != nil {
+		t.Fatal(err)
+	}
+	parseMessage(commandMessage(1, "/settings receipts reaction"), app)
+	if user := database.GetUserByChatID(1, app.DB); user.Receipts != ReceiptReaction {
+		t.Fatalf("receipts = %q", user.Receipts)
+	}
+	if err := database.ChangeUserState(SQuestion, database.GetUserByChatID(1, app.DB), app.DB); err != nil {
+		t.Fatal(err)
+	}
+	api.reset()
+	parseMessage(privateMessage(1, 5, "It crashes"), app)
+	if got := reactions(api, 5); len(got) != 1 {
+		t.Fatalf("reactions = %v", got)
+	}
+}
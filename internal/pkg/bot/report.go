@@ -0,0 +1,53 @@
+package bot
+
+import (
+	"fmt"
+	"telegram-bot-feedback/internal/pkg/database"
+	l "telegram-bot-feedback/internal/pkg/logger"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+	"time"
+)
+
+// runningSetting is the store marker of a running bot, it is cleared on the clean exit
+const runningSetting = "running"
+
+// startupReport reports the recovery after an unclean shutdown and marks the bot as running
+func startupReport(app *App) {
+	if database.GetSetting(runningSetting, app.DB) == "1" {
+		counts := database.GetCounts(app.DB)
+		report(fmt.Sprintf("Recovered after an unclean shutdown\nOpen questions: %d (kept)\nUpdates are fetched from offset %d\nInterrupted broadcasts are not resumed",
+			counts.OpenQuestions, app.offset()), app)
+	}
+	err := database.SetSetting(runningSetting, "1", app.DB)
+	if err != nil {
+		l.Error(err)
+	}
+	err = database.SetSetting(database.BusySetting, "", app.DB)
+	if err != nil {
+		l.Error(err)
+	}
+}
+
+// shutdownReport stops in-flight work, reports what was in flight and sets the clean exit marker
+func shutdownReport(app *App) {
+	started := time.Now()
+	broadcast := app.broadcaster.stop()
+	counts := database.GetCounts(app.DB)
+	report(fmt.Sprintf("Shutdown\nOpen questions: %d\nBroadcast interrupted: %t\nOffset saved: %d\nDrain: %s",
+		counts.OpenQuestions, broadcast, app.offset(), time.Since(started).Round(time.Millisecond)), app)
+	err := database.SetSetting(runningSetting, "0", app.DB)
+	if err != nil {
+		l.Error(err)
+	}
+}
+
+// report writes the text to the log and sends it to "report_chat" if it is set
+func report(text string, app *App) {
+	l.Info(l.NewError(text))
+	if chat := app.Conf.GetInt("report_chat"); chat != 0 {
+		_, err := app.Bot.Send(tg.NewMessage(chat, text))
+		if err != nil {
+			l.Error(l.Err(err))
+		}
+	}
+}
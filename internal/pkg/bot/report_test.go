@@ -0,0 +1,57 @@
+package bot
+
+import (
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	"testing"
+)
+
+func TestCleanShutdownReport(t *testing.T) {
+	app, api := newTestApp(t)
+	app.Conf.Set("report_chat", 99)
+	startupReport(app)
+	if len(api.sentTo(99)) != 0 || database.GetSetting(runningSetting, app.DB) != "1" {
+		t.Fatalf("first start reported %q", api.sentTo(99))
+	}
+	askQuestion(t, app, "It crashes")
+	shutdownReport(app)
+	sent := api.sentTo(99)
+	if len(sent) != 1 || !strings.HasPrefix(sent[0], "Shutdown\nOpen questions: 1\nBroadcast interrupted: false\n") {
+		t.Fatalf("shutdown report = %q", sent)
+	}
+	if database.GetSetting(runningSetting, app.DB) != "0" {
+		t.Fatal("the clean exit is not marked")
+	}
+	startupReport(app)
+	if len(api.sentTo(99)) != 1 {
+		t.Fatalf("the start after a clean exit reported %q", api.sentTo(99)[1:])
+	}
+}
+
+func TestUncleanShutdownIsReportedOnStart(t *testing.T) {
+	app, api := newTestApp(t)
+	app.Conf.Set("report_chat", 99)
+	startupReport(app)
+	askQuestion(t, app, "It crashes")
+	if err := database.SetSetting(database.BusySetting, "export", app.DB); err != nil {
+		t.Fatal(err)
+	}
+	// The process is killed, the next start finds the running marker
+	startupReport(app)
+	sent := api.sentTo(99)
+	if len(sent) != 1 || !strings.HasPrefix(sent[0], "Recovered after an unclean shutdown\nOpen questions: 1 (kept)\n") {
+		t.Fatalf("recovery report = %q", sent)
+	}
+	if database.GetSetting(database.BusySetting, app.DB) != "" || database.GetSetting(runningSetting, app.DB) != "1" {
+		t.Fatal("the markers are not reset")
+	}
+}
+
+func TestReportWithoutChatOnlyLogs(t *testing.T) {
+	app, api := newTestApp(t)
+	startupReport(app)
+	shutdownReport(app)
+	if len(api.requests()) != 0 {
+		t.Fatalf("requests = %+v", api.requests())
+	}
+}
@@ -0,0 +1,159 @@
+package bot
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	l "telegram-bot-feedback/internal/pkg/logger"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+)
+
+// Automation features that can be rolled out to a part of Questions
+const (
+	FeatureDuplicates    = "duplicates"
+	FeatureSurvey        = "survey"
+	FeatureTranscription = "transcription"
+)
+
+// rolloutFeatures are the features /rollout manages
+var rolloutFeatures = []string{FeatureDuplicates, FeatureSurvey, FeatureTranscription}
+
+// rolloutSettingPrefix is the Setting key prefix of the /rollout override of a feature
+const rolloutSettingPrefix = "rollout_"
+
+// rolloutBucket returns the bucket of the Question for the feature, 0-99
+//
+// The bucket depends only on the feature and the Question number, so a conversation never
+// switches cohorts, and each feature splits Questions independently
+func rolloutBucket(feature string, questionID uint) int {
+	hash := fnv.New32a()
+	hash.Write([]byte(feature + ":" + strconv.Itoa(int(questionID))))
+	return int(hash.Sum32() % 100)
+}
+
+// clampPercent limits the percent to 0-100
+func clampPercent(percent int) int {
+	if percent < 0 {
+		return 0
+	}
+	if percent > 100 {
+		return 100
+	}
+	return percent
+}
+
+// rolloutPercent returns the percent of Questions the feature applies to
+//
+// The /rollout override wins over "rollout" in the configuration, features missing in both apply to all
+func rolloutPercent(feature string, app *App) int {
+	if value := database.GetSetting(rolloutSettingPrefix+feature, app.DB); value != "" {
+		if percent, err := strconv.Atoi(value); err == nil {
+			return clampPercent(percent)
+		}
+	}
+	if key := "rollout." + feature; app.Conf.IsSet(key) {
+		return clampPercent(app.Conf.GetInt(key))
+	}
+	return 100
+}
+
+// featureEnabled reports whether the feature applies to the Question and records its cohort
+func featureEnabled(feature string, question *database.Question, app *App) bool {
+	enabled := rolloutBucket(feature, question.ID) < rolloutPercent(feature, app)
+	err := database.SetRolloutCohort(feature, enabled, question, app.DB)
+	if err != nil {
+		l.Error(err)
+	}
+	return enabled
+}
+
+// isRolloutFeature reports whether the feature is managed by /rollout
+func isRolloutFeature(feature string) bool {
+	for _, f := range rolloutFeatures {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// rolloutCommand shows or changes the rollout of features
+//
+// Format: /rollout [feature <percent|off|reset>], off is the kill switch and reset returns to the configuration
+func rolloutCommand(message *tg.Message, user *database.User, app *App) error {
+	args := strings.Fields(message.CommandArguments())
+	if len(args) == 0 {
+		_, err := app.Bot.Send(tg.NewMessage(user.ChatID, rolloutText(app)))
+		return l.Err(err)
+	}
+	if len(args) != 2 || !isRolloutFeature(args[0]) {
+		_, err := app.Bot.Send(tg.NewMessage(user.ChatID, "Format: /rollout [feature <percent|off|reset>]\nFeatures: "+strings.Join(rolloutFeatures, ", ")))
+		return l.Err(err)
+	}
+	feature, value := args[0], strings.ToLower(args[1])
+	switch value {
+	case "off":
+		value = "0"
+	case "reset":
+		value = ""
+	default:
+		percent, err := strconv.Atoi(strings.TrimSuffix(value, "%"))
+		if err != nil || percent < 0 || percent > 100 {
+			_, err := app.Bot.Send(tg.NewMessage(user.ChatID, "The percent must be from 0 to 100"))
+			return l.Err(err)
+		}
+		value = strconv.Itoa(percent)
+	}
+	err := database.SetSetting(rolloutSettingPrefix+feature, value, app.DB)
+	if err != nil {
+		return l.Err(err)
+	}
+	l.Info(l.WithFields(l.NewError("Rollout changed"), "feature", feature, "percent", rolloutPercent(feature, app), "employee", user.ChatID))
+	_, err = app.Bot.Send(tg.NewMessage(user.ChatID, feature+": "+strconv.Itoa(rolloutPercent(feature, app))+"%"))
+	return l.Err(err)
+}
+
+// rolloutText returns the percent of every feature
+func rolloutText(app *App) string {
+	var b strings.Builder
+	b.WriteString("Rollout:")
+	for _, feature := range rolloutFeatures {
+		b.WriteString("\n" + feature + ": " + strconv.Itoa(rolloutPercent(feature, app)) + "%")
+		if database.GetSetting(rolloutSettingPrefix+feature, app.DB) != "" {
+			b.WriteString(" (set by /rollout)")
+		}
+	}
+	return b.String()
+}
+
+// rolloutStats returns the outcome of Questions with and without each feature
+func rolloutStats(app *App) string {
+	var b strings.Builder
+	b.WriteString(rolloutText(app))
+	for _, feature := range rolloutFeatures {
+		stats := database.GetCohortStats(feature, app.DB)
+		if len(stats) == 0 {
+			continue
+		}
+		b.WriteString("\n\n" + feature + ":")
+		for _, s := range stats {
+			cohort := "without"
+			if s.Enabled {
+				cohort = "with"
+			}
+			fmt.Fprintf(&b, "\n%s: %d questions, answered %.0f%%, closed %.0f%%, survey %.2f (%d)",
+				cohort, s.Questions, share(s.Answered, s.Questions), share(s.Closed, s.Questions), s.Score, s.Surveyed)
+		}
+	}
+	return b.String()
+}
+
+// share returns part of total in percent
+func share(part, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part) * 100 / float64(total)
+}
@@ -0,0 +1,140 @@
+package bot
+
+import (
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	"testing"
+)
+
+func TestRolloutBucket(t *testing.T) {
+	const questions = 10000
+	enabled := map[int]int{}
+	differ := 0
+	for id := uint(1); id <= questions; id++ {
+		bucket := rolloutBucket(FeatureSurvey, id)
+		if bucket < 0 || bucket > 99 || bucket != rolloutBucket(FeatureSurvey, id) {
+			t.Fatalf("bucket of #%d = %d", id, bucket)
+		}
+		for _, percent := range []int{10, 30, 60} {
+			if bucket < percent {
+				enabled[percent]++
+			}
+		}
+		if bucket != rolloutBucket(FeatureDuplicates, id) {
+			differ++
+		}
+	}
+	for percent, n := range enabled {
+		if share := n * 100 / questions; share < percent-3 || share > percent+3 {
+			t.Errorf("%d%% rollout applies to %d%% of questions", percent, share)
+		}
+	}
+	if differ < questions/2 {
+		t.Fatalf("features share buckets of %d questions", questions-differ)
+	}
+}
+
+func TestRolloutPercent(t *testing.T) {
+	app, _ := newTestApp(t)
+	if got := rolloutPercent(FeatureSurvey, app); got != 100 {
+		t.Fatalf("default = %d, want all questions", got)
+	}
+	for value, want := range map[int]int{20: 20, 150: 100, -5: 0} {
+		app.Conf.Set("rollout.survey", value)
+		if got := rolloutPercent(FeatureSurvey, app); got != want {
+			t.Errorf("configured %d = %d, want %d", value, got, want)
+		}
+	}
+	app.Conf.Set("rollout.survey", 20)
+	if err := database.SetSetting(rolloutSettingPrefix+FeatureSurvey, "70", app.DB); err != nil {
+		t.Fatal(err)
+	}
+	if got := rolloutPercent(FeatureSurvey, app); got != 70 {
+		t.Fatalf("override = %d, want it to win over the configuration", got)
+	}
+	if err := database.SetSetting(rolloutSettingPrefix+FeatureSurvey, "abc", app.DB); err != nil {
+		t.Fatal(err)
+	}
+	if got := rolloutPercent(FeatureSurvey, app); got != 20 {
+		t.Fatalf("invalid override = %d, want the configuration", got)
+	}
+}
+
+func TestKillSwitchPersists(t *testing.T) {
+	app, api := newTestApp(t)
+	app.Conf.Set("rollout.duplicates", 50)
+	parseMessage(commandMessage(2, "/rollout duplicates off"), app)
+	if got := lastSent(api, 2); got != "duplicates: 0%" {
+		t.Fatalf("/rollout duplicates off = %q", got)
+	}
+
+	restarted := NewApp(app.Bot, app.DB, app.Conf)
+	if got := rolloutPercent(FeatureDuplicates, restarted); got != 0 {
+		t.Fatalf("after a restart = %d%%, want the kill switch kept", got)
+	}
+	parseMessage(commandMessage(2, "/rollout"), restarted)
+	if got := lastSent(api, 2); !strings.Contains(got, "\nduplicates: 0% (set by /rollout)\nsurvey: 100%\n") {
+		t.Fatalf("/rollout = %q", got)
+	}
+
+	earlierQuestion(t, app, "The app crashes when I open settings")
+	askQuestion(t, restarted, "the app crashes when I open the settings!")
+	for _, call := range api.requests("sendMessage") {
+		if strings.Contains(call.text(), "possible duplicate") {
+			t.Fatal("a killed feature still applies")
+		}
+	}
+
+	parseMessage(commandMessage(2, "/rollout duplicates reset"), restarted)
+	if got := lastSent(api, 2); got != "duplicates: 50%" {
+		t.Fatalf("/rollout duplicates reset = %q, want the configuration", got)
+	}
+	parseMessage(commandMessage(2, "/rollout duplicates 25%"), restarted)
+	if got := lastSent(api, 2); got != "duplicates: 25%" {
+		t.Fatalf("/rollout duplicates 25%% = %q", got)
+	}
+	for _, args := range []string{"duplicates 101", "duplicates -1", "duplicates many"} {
+		parseMessage(commandMessage(2, "/rollout "+args), restarted)
+		if got := lastSent(api, 2); got != "The percent must be from 0 to 100" {
+			t.Errorf("/rollout %s = %q", args, got)
+		}
+	}
+	parseMessage(commandMessage(2, "/rollout faq 10"), restarted)
+	if got := lastSent(api, 2); !strings.HasPrefix(got, "Format: /rollout") {
+		t.Fatalf("/rollout of an unknown feature = %q", got)
+	}
+	if got := rolloutPercent(FeatureDuplicates, restarted); got != 25 {
+		t.Fatalf("percent = %d after invalid commands", got)
+	}
+}
+
+func TestFeatureEnabledRecordsCohort(t *testing.T) {
+	app, api := newTestApp(t)
+	app.Conf.Set("rollout.survey", 50)
+	var with, without int64
+	for i := 0; i < 20; i++ {
+		question := taggedQuestion(t, app, "question", nil)
+		enabled := featureEnabled(FeatureSurvey, question, app)
+		if enabled != (rolloutBucket(FeatureSurvey, question.ID) < 50) || featureEnabled(FeatureSurvey, question, app) != enabled {
+			t.Fatalf("#%d: enabled = %t in bucket %d", question.ID, enabled, rolloutBucket(FeatureSurvey, question.ID))
+		}
+		if enabled {
+			with++
+		} else {
+			without++
+		}
+	}
+	stats := database.GetCohortStats(FeatureSurvey, app.DB)
+	counts := map[bool]int64{}
+	for _, s := range stats {
+		counts[s.Enabled] = s.Questions
+	}
+	if counts[true] != with || counts[false] != without {
+		t.Fatalf("cohorts = %+v, want %d with and %d without", stats, with, without)
+	}
+
+	parseMessage(commandMessage(2, "/stats rollout"), app)
+	if got := lastSent(api, 2); !strings.Contains(got, "\n\nsurvey:\n") || !strings.Contains(got, "questions, answered 0%") {
+		t.Fatalf("/stats rollout = %q", got)
+	}
+}
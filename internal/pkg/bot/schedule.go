@@ -0,0 +1,58 @@
+package bot
+
+import (
+	"context"
+	"telegram-bot-feedback/internal/pkg/database"
+	l "telegram-bot-feedback/internal/pkg/logger"
+	"time"
+)
+
+// dailyCheckInterval is how often the time of daily jobs is checked
+const dailyCheckInterval = time.Minute
+
+// clock returns the current time, replaced in tests
+var clock = time.Now
+
+// runDaily runs the job every day at the time from the configuration key ("HH:MM" in "timezone")
+//
+// The date of the last run is stored by the setting key, so a restart doesn't run the job twice.
+// The job returns false to be retried at the next check
+func runDaily(ctx context.Context, key, setting string, app *App, job func(now time.Time) bool) {
+	spec := app.Conf.GetString(key)
+	if spec == "" {
+		return
+	}
+	at, err := time.Parse("15:04", spec)
+	if err != nil {
+		l.Error(l.NewError("Wrong " + key + " \"" + spec + "\", use HH:MM"))
+		return
+	}
+	location, err := time.LoadLocation(app.Conf.GetString("timezone"))
+	if err != nil {
+		l.Error(l.Err(err))
+		return
+	}
+	ticker := time.NewTicker(dailyCheckInterval)
+	defer ticker.Stop()
+	for {
+		if now := clock().In(location); dailyDue(now, at, database.GetSetting(setting, app.DB)) && job(now) {
+			err = database.SetSetting(setting, now.Format(exportDateLayout), app.DB)
+			if err != nil {
+				l.Error(err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// dailyDue reports whether the time of the day has come and the job did not run today
+func dailyDue(now, at time.Time, last string) bool {
+	if last == now.Format(exportDateLayout) {
+		return false
+	}
+	return now.Hour() > at.Hour() || (now.Hour() == at.Hour() && now.Minute() >= at.Minute())
+}
@@ -0,0 +1,111 @@
+package bot
+
+import (
+	"strconv"
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	l "telegram-bot-feedback/internal/pkg/logger"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+)
+
+// messageShare returns the contact, location or venue of the Message, nil if there is none
+//
+// A venue message also has the location, so the venue is checked first
+func messageShare(message *tg.Message) *database.SharedItem {
+	switch {
+	case message.Contact != nil:
+		contact := message.Contact
+		return &database.SharedItem{
+			MessageID:     message.MessageID,
+			Kind:          database.ShareContact,
+			PhoneNumber:   contact.PhoneNumber,
+			FirstName:     contact.FirstName,
+			LastName:      contact.LastName,
+			ContactUserID: contact.UserID,
+		}
+	case message.Venue != nil:
+		venue := message.Venue
+		return &database.SharedItem{
+			MessageID: message.MessageID,
+			Kind:      database.ShareVenue,
+			Latitude:  venue.Location.Latitude,
+			Longitude: venue.Location.Longitude,
+			Title:     venue.Title,
+			Address:   venue.Address,
+		}
+	case message.Location != nil:
+		location := message.Location
+		return &database.SharedItem{
+			MessageID: message.MessageID,
+			Kind:      database.ShareLocation,
+			Latitude:  location.Latitude,
+			Longitude: location.Longitude,
+			IsLive:    location.LivePeriod > 0,
+		}
+	}
+	return nil
+}
+
+// shareConfig returns the message which shows the item natively in the chat
+//
+// A live location is sent as a plain location at its shared position
+func shareConfig(chatId int, item *database.SharedItem) tg.Config {
+	switch item.Kind {
+	case database.ShareContact:
+		contact := tg.NewContact(chatId, item.PhoneNumber, item.FirstName)
+		contact.LastName = item.LastName
+		return contact
+	case database.ShareVenue:
+		return tg.NewVenue(chatId, item.Title, item.Address, item.Latitude, item.Longitude)
+	}
+	return tg.NewLocation(chatId, item.Latitude, item.Longitude)
+}
+
+// shareText returns the item as a line of text for headers and transcripts
+func shareText(item *database.SharedItem) string {
+	switch item.Kind {
+	case database.ShareContact:
+		return "[contact] " + strings.TrimSpace(item.FirstName+" "+item.LastName) + ", " + item.PhoneNumber
+	case database.ShareVenue:
+		return "[venue] " + item.Title + ", " + item.Address + " (" + coordinates(item) + ")"
+	}
+	if item.IsLive {
+		return "[location] " + coordinates(item) + " (live location, position when shared)"
+	}
+	return "[location] " + coordinates(item)
+}
+
+// coordinates returns "latitude, longitude" of the item
+func coordinates(item *database.SharedItem) string {
+	return strconv.FormatFloat(item.Latitude, 'f', 6, 64) + ", " + strconv.FormatFloat(item.Longitude, 'f', 6, 64)
+}
+
+// recordShare stores the contact, location or venue of the Message in the Question
+func recordShare(message *tg.Message, question *database.Question, app *App) error {
+	item := messageShare(message)
+	if item == nil {
+		return nil
+	}
+	return l.Err(database.AddSharedItem(item, question, app.DB))
+}
+
+// sendShare sends the item to the chat and links the message with the Question
+//
+// A live location is followed by a note, the copy doesn't follow the user
+func sendShare(chatId int, question *database.Question, item *database.SharedItem, app *App) (*tg.Message, error) {
+	sent, err := app.Bot.Send(shareConfig(chatId, item))
+	if err != nil {
+		return nil, l.Err(err)
+	}
+	sent.Chat = &tg.Chat{ID: chatId}
+	addMessageLink(sent, question, app)
+	if item.IsLive {
+		note := tg.NewMessage(chatId, "Live location, the position when it was shared")
+		note.ReplyToMessageID = sent.MessageID
+		note.AllowSendingWithoutReply = true
+		if _, err := app.Bot.Send(note); err != nil {
+			l.Error(l.Err(err))
+		}
+	}
+	return sent, nil
+}
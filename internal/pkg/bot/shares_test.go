@@ -0,0 +1,140 @@
+package bot
+
+import (
+	"bytes"
+	"encoding/csv"
+	"reflect"
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+	"testing"
+)
+
+// shareMessages returns the messages of user 1 with a contact, a venue, a location and a live location
+func shareMessages() map[string]*tg.Message {
+	contact := privateMessage(1, 20, "")
+	contact.Contact = &tg.Contact{PhoneNumber: "+15550100", FirstName: "Ann", LastName: "Lee", UserID: 1}
+	venue := privateMessage(1, 21, "")
+	venue.Location = &tg.Location{Latitude: 52.52, Longitude: 13.405}
+	venue.Venue = &tg.Venue{Location: tg.Location{Latitude: 52.52, Longitude: 13.405}, Title: "Office", Address: "Main st. 1"}
+	location := privateMessage(1, 22, "")
+	location.Location = &tg.Location{Latitude: 55.75, Longitude: 37.6173}
+	live := privateMessage(1, 23, "")
+	live.Location = &tg.Location{Latitude: 55.75, Longitude: 37.6173, LivePeriod: 900}
+	return map[string]*tg.Message{"contact": contact, "venue": venue, "location": location, "live": live}
+}
+
+func TestMessageShareConfig(t *testing.T) {
+	messages := shareMessages()
+	contact := tg.NewContact(2, "+15550100", "Ann")
+	contact.LastName = "Lee"
+	tests := []struct {
+		name string
+		kind string
+		live bool
+		want tg.Config
+		text string
+	}{
+		{"contact", database.ShareContact, false, contact, "[contact] Ann Lee, +15550100"},
+		{"venue", database.ShareVenue, false, tg.NewVenue(2, "Office", "Main st. 1", 52.52, 13.405), "[venue] Office, Main st. 1 (52.520000, 13.405000)"},
+		{"location", database.ShareLocation, false, tg.NewLocation(2, 55.75, 37.6173), "[location] 55.750000, 37.617300"},
+		{"live", database.ShareLocation, true, tg.NewLocation(2, 55.75, 37.6173), "[location] 55.750000, 37.617300 (live location, position when shared)"},
+	}
+	for _, tt := range tests {
+		item := messageShare(messages[tt.name])
+		if item == nil || item.Kind != tt.kind || item.IsLive != tt.live || item.MessageID != messages[tt.name].MessageID {
+			t.Fatalf("%s: item = %+v", tt.name, item)
+		}
+		if got := shareConfig(2, item); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: config = %+v, want %+v", tt.name, got, tt.want)
+		}
+		if got := questionHeader(messages[tt.name]); got != tt.text {
+			t.Errorf("%s: header = %q, want %q", tt.name, got, tt.text)
+		}
+	}
+	if item := messageShare(privateMessage(1, 24, "hello")); item != nil {
+		t.Fatalf("text message share = %+v", item)
+	}
+}
+
+func TestShareOpensQuestion(t *testing.T) {
+	app, api := newTestApp(t)
+	user, err := database.AddUser(1, "user1", SQuestion, app.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parseMessage(shareMessages()["venue"], app)
+	question := database.GetOpenQuestionByUser(user, app.DB)
+	if question == nil || question.Header != "[venue] Office, Main st. 1 (52.520000, 13.405000)" {
+		t.Fatalf("question = %+v", question)
+	}
+	item := database.GetFirstSharedItem(question, app.DB)
+	if item == nil || item.Kind != database.ShareVenue || item.Title != "Office" || item.Latitude != 52.52 {
+		t.Fatalf("shared item = %+v", item)
+	}
+	venues := api.requests("sendVenue")
+	if len(venues) != 1 || venues[0].chatID() != 2 || venues[0].Params["title"] != "Office" || venues[0].Params["latitude"] != 52.52 {
+		t.Fatalf("venues = %+v", venues)
+	}
+	if len(api.requests("copyMessage", "forwardMessage")) != 0 {
+		t.Fatal("the venue is copied as an opaque message")
+	}
+}
+
+func TestShareInDiscussion(t *testing.T) {
+	app, api := newTestApp(t)
+	question := answeredQuestion(t, app)
+	parseMessage(shareMessages()["contact"], app)
+	contacts := api.requests("sendContact")
+	if len(contacts) != 1 || contacts[0].chatID() != 2 || contacts[0].Params["phone_number"] != "+15550100" || contacts[0].Params["last_name"] != "Lee" {
+		t.Fatalf("contacts = %+v", contacts)
+	}
+	if len(api.requests("forwardMessage")) != 0 {
+		t.Fatal("the contact is forwarded")
+	}
+
+	api.reset()
+	parseMessage(shareMessages()["live"], app)
+	locations := api.requests("sendLocation")
+	if len(locations) != 1 || locations[0].Params["live_period"] != nil {
+		t.Fatalf("locations = %+v, want a plain location", locations)
+	}
+	notes := api.requests("sendMessage")
+	if len(notes) != 1 || notes[0].text() != "Live location, the position when it was shared" || notes[0].Params["reply_to_message_id"] == nil {
+		t.Fatalf("notes = %+v", notes)
+	}
+	if item := database.GetFirstSharedItem(question, app.DB); item == nil || item.Kind != database.ShareContact {
+		t.Fatalf("first shared item = %+v, want the contact", item)
+	}
+}
+
+func TestExportShareColumns(t *testing.T) {
+	app, api := newTestApp(t)
+	if _, err := database.AddUser(1, "user1", SQuestion, app.DB); err != nil {
+		t.Fatal(err)
+	}
+	parseMessage(shareMessages()["live"], app)
+	parseMessage(commandMessage(2, "/export"), app)
+	documents := api.requests("sendDocument")
+	if len(documents) != 1 {
+		t.Fatalf("documents = %+v", documents)
+	}
+	records, err := csv.NewReader(bytes.NewReader([]byte(documents[0].Params["document"].(string)))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(records[0][6:13], ","); got != "share,phone,contact_name,latitude,longitude,address,live_location" {
+		t.Fatalf("header = %q", records[0])
+	}
+	if got := records[1][6:13]; !reflect.DeepEqual(got, []string{"location", "", "", "55.75", "37.6173", "", "yes"}) {
+		t.Fatalf("share columns = %q", got)
+	}
+
+	contact := (&exportShare{Kind: database.ShareContact, Phone: "+15550100", Name: "Ann Lee"}).record()
+	if !reflect.DeepEqual(contact, []string{"contact", "+15550100", "Ann Lee", "", "", "", ""}) {
+		t.Fatalf("contact columns = %q", contact)
+	}
+	if empty := (*exportShare)(nil).record(); len(empty) != len(shareColumns) || strings.Join(empty, "") != "" {
+		t.Fatalf("columns without a share = %q", empty)
+	}
+}
@@ -0,0 +1,79 @@
+package bot
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	l "telegram-bot-feedback/internal/pkg/logger"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+)
+
+// startSourcePattern is a /start payload allowed as the acquisition source, the deep link alphabet of Telegram
+var startSourcePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// parseStartSource returns the acquisition source of the /start or startgroup payload
+//
+// Malformed payloads and the /help deep link are not sources
+func parseStartSource(payload string) (string, bool) {
+	payload = strings.TrimSpace(payload)
+	if payload == helpStartPayload || !startSourcePattern.MatchString(payload) {
+		return "", false
+	}
+	return payload, true
+}
+
+// recordSource stores the source of the /start payload if it is the first contact of the User
+//
+// Later /start links never change the source
+func recordSource(message *tg.Message, user *database.User, firstContact bool, app *App) error {
+	payload, _ := message.StartPayload()
+	source, ok := parseStartSource(payload)
+	if !ok || !firstContact || user.Source != "" {
+		return nil
+	}
+	return l.Err(database.ChangeUserSource(source, user, app.DB))
+}
+
+// recordGroupSource stores the startgroup payload the bot was added to the group with
+//
+// Telegram sends it as "/start <payload>" to the group, the first source is kept
+func recordGroupSource(message *tg.Message, app *App) error {
+	if _, bot, found := strings.Cut(message.CommandWithAt(), "@"); found && !strings.EqualFold(bot, app.Bot.Self.UserName) {
+		return nil
+	}
+	source, ok := parseStartSource(message.CommandArguments())
+	if !ok {
+		return nil
+	}
+	return l.Err(database.SetGroupSource(message.Chat.ID, message.Chat.Title, source, app.DB))
+}
+
+// startGreeting returns the greeting of the payload from "start_greetings", empty if there is none
+func startGreeting(payload string, app *App) string {
+	source, ok := parseStartSource(payload)
+	if !ok {
+		return ""
+	}
+	return app.Conf.GetString("start_greetings." + strings.ToLower(source))
+}
+
+// sourceStats returns the number of users and groups by acquisition source
+func sourceStats(app *App) string {
+	users, groups := database.GetUserSources(app.DB), database.GetGroupSources(app.DB)
+	if len(users) == 0 && len(groups) == 0 {
+		return "No sources, share links like t.me/" + app.Bot.Self.UserName + "?start=<source>"
+	}
+	var b strings.Builder
+	b.WriteString("Users by source:")
+	for _, s := range users {
+		b.WriteString("\n" + s.Source + ": " + strconv.Itoa(int(s.Count)))
+	}
+	if len(groups) > 0 {
+		b.WriteString("\n\nGroups by source:")
+		for _, s := range groups {
+			b.WriteString("\n" + s.Source + ": " + strconv.Itoa(int(s.Count)))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,137 @@
+package bot
+
+import (
+	"reflect"
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+	"testing"
+)
+
+// startUpdate returns the /start of the user in the private chat
+func startUpdate(chatID int, text string) *tg.Update {
+	return &tg.Update{Message: commandMessage(chatID, text)}
+}
+
+func TestParseStartSource(t *testing.T) {
+	tests := []struct {
+		payload string
+		want    string
+		ok      bool
+	}{
+		{"promo_website", "promo_website", true},
+		{" Ads-2024 ", "Ads-2024", true},
+		{strings.Repeat("a", 64), strings.Repeat("a", 64), true},
+		{strings.Repeat("a", 65), "", false},
+		{"", "", false},
+		{"promo website", "", false},
+		{"promo.website", "", false},
+		{"промо", "", false},
+		{"a=b&c", "", false},
+		{helpStartPayload, "", false},
+	}
+	for _, tt := range tests {
+		got, ok := parseStartSource(tt.payload)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseStartSource(%q) = %q, %t, want %q, %t", tt.payload, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestSourceIsRecordedOnFirstContactOnly(t *testing.T) {
+	app, _ := newTestApp(t)
+	if err := parseUpdate(startUpdate(7, "/start promo_website"), app); err != nil {
+		t.Fatal(err)
+	}
+	if user := database.GetUserByChatID(7, app.DB); user == nil || user.Source != "promo_website" {
+		t.Fatalf("user = %+v, want the source recorded", user)
+	}
+	if err := parseUpdate(startUpdate(7, "/start newsletter"), app); err != nil {
+		t.Fatal(err)
+	}
+	if user := database.GetUserByChatID(7, app.DB); user.Source != "promo_website" {
+		t.Fatalf("source = %q, want the first one kept", user.Source)
+	}
+
+	if _, err := database.AddUser(8, "user8", SMain, app.DB); err != nil {
+		t.Fatal(err)
+	}
+	if err := parseUpdate(startUpdate(8, "/start newsletter"), app); err != nil {
+		t.Fatal(err)
+	}
+	if user := database.GetUserByChatID(8, app.DB); user.Source != "" {
+		t.Fatalf("source of a known user = %q", user.Source)
+	}
+
+	for chatID, text := range map[int]string{9: "/start bad!payload", 10: "/start " + strings.Repeat("x", 65), 11: "/start help", 12: "/start"} {
+		if err := parseUpdate(startUpdate(chatID, text), app); err != nil {
+			t.Fatal(err)
+		}
+		if user := database.GetUserByChatID(chatID, app.DB); user == nil || user.Source != "" {
+			t.Errorf("%q: user = %+v, want no source", text, user)
+		}
+	}
+}
+
+func TestSourceGreeting(t *testing.T) {
+	app, api := newTestApp(t)
+	app.Conf.Set("start_greetings", map[string]interface{}{"promo_website": "Hi from the website 👋"})
+	if err := parseUpdate(startUpdate(7, "/start Promo_Website"), app); err != nil {
+		t.Fatal(err)
+	}
+	if got := api.sentTo(7); len(got) == 0 || got[0] != "Hi from the website 👋" {
+		t.Fatalf("greeting = %q", got)
+	}
+	if err := parseUpdate(startUpdate(8, "/start newsletter"), app); err != nil {
+		t.Fatal(err)
+	}
+	if got := api.sentTo(8); len(got) == 0 || !strings.HasPrefix(got[0], "Greetings 👋") {
+		t.Fatalf("greeting without a template = %q", got)
+	}
+}
+
+func TestGroupSourceFromStartgroup(t *testing.T) {
+	app, api := newTestApp(t)
+	start := func(text string) {
+		message := commandMessage(5, text)
+		message.Chat = &tg.Chat{ID: -1001, Type: "supergroup", Title: "Partners"}
+		if err := parseUpdate(&tg.Update{Message: message}, app); err != nil {
+			t.Fatal(err)
+		}
+	}
+	start("/start@other_bot partner_chat")
+	start("/start@feedback_bot bad!")
+	if got := database.GetGroupSources(app.DB); got != nil {
+		t.Fatalf("sources = %+v", got)
+	}
+	start("/start@feedback_bot partner_chat")
+	start("/start partner_forum")
+	if got := database.GetGroupSources(app.DB); !reflect.DeepEqual(got, []database.SourceCount{{Source: "partner_chat", Count: 1}}) {
+		t.Fatalf("sources = %+v, want the first one kept", got)
+	}
+	if len(api.sentTo(-1001)) != 0 {
+		t.Fatal("the bot answers /start in the group")
+	}
+}
+
+func TestSourceStats(t *testing.T) {
+	app, api := newTestApp(t)
+	mainState(t, app)
+	parseMessage(commandMessage(2, "/stats sources"), app)
+	if got := lastSent(api, 2); got != "No sources, share links like t.me/feedback_bot?start=<source>" {
+		t.Fatalf("/stats sources = %q", got)
+	}
+	for chatID, source := range map[int]string{7: "ads", 8: "promo_website", 9: "ads"} {
+		if err := parseUpdate(startUpdate(chatID, "/start "+source), app); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := database.SetGroupSource(-1001, "Partners", "partner_chat", app.DB); err != nil {
+		t.Fatal(err)
+	}
+	parseMessage(commandMessage(2, "/stats sources"), app)
+	want := "Users by source:\nads: 2\npromo_website: 1\n\nGroups by source:\npartner_chat: 1"
+	if got := lastSent(api, 2); got != want {
+		t.Fatalf("/stats sources = %q, want %q", got, want)
+	}
+}
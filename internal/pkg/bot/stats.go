@@ -0,0 +1,57 @@
+package bot
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	l "telegram-bot-feedback/internal/pkg/logger"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+)
+
+// sendStats sends statistics to the employee
+//
+// Format: /stats [section]
+func sendStats(message *tg.Message, user *database.User, app *App) error {
+	var text string
+	sections := app.pluginStats()
+	section := strings.ToLower(strings.TrimSpace(message.CommandArguments()))
+	switch section {
+	case "links":
+		text = linkStats(app)
+	case "storage":
+		text = storageStats(app)
+	case "rollout":
+		text = rolloutStats(app)
+	case "sources":
+		text = sourceStats(app)
+	case "quality":
+		text = qualityStats(app)
+	case "":
+		counts := database.GetCounts(app.DB)
+		text = "Users: " + strconv.Itoa(int(counts.Users)) + " (active: " + strconv.Itoa(int(counts.Users-counts.Blocked-counts.Deactivated)) + ")" +
+			"\nQuestions: " + strconv.Itoa(int(counts.Questions)) + " (open: " + strconv.Itoa(int(counts.OpenQuestions)) + ")" +
+			"\nReviews: " + strconv.Itoa(int(counts.Reviews)) +
+			"\nBlocked the bot: " + strconv.Itoa(int(counts.Blocked)) +
+			"\nDeleted accounts: " + strconv.Itoa(int(counts.Deactivated)) +
+			"\nGroups: " + strconv.Itoa(int(counts.Groups)) +
+			"\n\nSections: " + strings.Join(append([]string{"links", "quality", "rollout", "sources", "storage"}, sectionNames(sections)...), ", ")
+	default:
+		text = "Unknown section"
+		if stats, ok := sections[section]; ok {
+			text = stats()
+		}
+	}
+	_, err := app.Bot.Send(tg.NewMessage(user.ChatID, text))
+	return l.Err(err)
+}
+
+// sectionNames returns the names of the sections in alphabetical order
+func sectionNames(sections map[string]func() string) []string {
+	names := make([]string, 0, len(sections))
+	for name := range sections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,118 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"telegram-bot-feedback/internal/pkg/database"
+	l "telegram-bot-feedback/internal/pkg/logger"
+	"telegram-bot-feedback/internal/pkg/metrics"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+	"time"
+)
+
+// statusInterval is how often the live status message is edited
+var statusInterval = time.Minute
+
+// statusUpdater holds the live status message, only one is updated at a time
+type statusUpdater struct {
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// replace stops updating the previous message and waits for its final edit, then reserves the updater
+func (s *statusUpdater) replace(cancel context.CancelFunc) chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel != nil {
+		s.cancel()
+		<-s.done
+	}
+	s.cancel, s.done = cancel, make(chan struct{})
+	return s.done
+}
+
+// finish releases the updater if it still holds the message of done
+func (s *statusUpdater) finish(done chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.done == done {
+		s.cancel, s.done = nil, nil
+	}
+}
+
+// startStatus sends the status message and keeps it updated for "status_minutes"
+//
+// Format: /status, a new /status stops updating the previous message
+func startStatus(user *database.User, app *App) error {
+	duration := time.Duration(app.Conf.GetInt("status_minutes")) * time.Minute
+	until := clock().Add(duration)
+	sent, err := app.Bot.Send(tg.NewMessage(user.ChatID, statusText(until, app)))
+	if err != nil {
+		return l.Err(err)
+	}
+	ctx, cancel := context.WithDeadline(context.Background(), until)
+	done := app.status.replace(cancel)
+	go func() {
+		defer app.status.finish(done)
+		defer close(done)
+		runStatus(ctx, sent.Chat.ID, sent.MessageID, until, app)
+	}()
+	return nil
+}
+
+// runStatus edits the status message every statusInterval until ctx is done, then removes the refresh marker
+func runStatus(ctx context.Context, chatID, messageID int, until time.Time, app *App) {
+	ticker := time.NewTicker(statusInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			editStatus(chatID, messageID, statusText(time.Time{}, app), app)
+			return
+		case <-ticker.C:
+			editStatus(chatID, messageID, statusText(until, app), app)
+		}
+	}
+}
+
+// editStatus replaces the text of the status message, unchanged texts are not errors
+func editStatus(chatID, messageID int, text string, app *App) {
+	_, err := app.Bot.Send(tg.NewEditMessageText(chatID, messageID, text))
+	if tg.IsMessageNotModified(err) {
+		return
+	}
+	if err != nil {
+		l.Error(l.Err(err))
+	}
+}
+
+// statusText returns the health of the bot, the refresh marker shows until when it is updated,
+// a zero until leaves it out
+func statusText(until time.Time, app *App) string {
+	var b strings.Builder
+	now := clock()
+	counts := database.GetCounts(app.DB)
+	outbox := database.GetOutboxStats(app.DB)
+	fmt.Fprintf(&b, "Uptime: %s\n", now.Sub(app.started).Truncate(time.Minute))
+	fmt.Fprintf(&b, "Updates processed: %.0f\n", metrics.Updates.Total())
+	fmt.Fprintf(&b, "Open questions: %d\n", counts.OpenQuestions)
+	fmt.Fprintf(&b, "Outbox: %d pending, %d dead\n", outbox.Pending, outbox.Dead)
+	fmt.Fprintf(&b, "Broadcast running: %t\n", app.broadcaster.running())
+	if size, err := database.Size(app.DB); err == nil {
+		fmt.Fprintf(&b, "Database: %.1f MB\n", float64(size)/mb)
+	}
+	if text, at := l.LastError(); text != "" {
+		fmt.Fprintf(&b, "Last error (%s): %s\n", at.Format(historyTimeLayout), text)
+	} else {
+		b.WriteString("Last error: none\n")
+	}
+	if until.IsZero() {
+		fmt.Fprintf(&b, "\nAs of %s", now.Format(historyTimeLayout))
+	} else {
+		fmt.Fprintf(&b, "\n🔄 Updated every %s until %s", statusInterval, until.Format("15:04"))
+	}
+	return b.String()
+}
@@ -0,0 +1,137 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	l "telegram-bot-feedback/internal/pkg/logger"
+	"testing"
+	"time"
+)
+
+// setStatusInterval replaces the edit interval of the status message for the test
+func setStatusInterval(t *testing.T, interval time.Duration) {
+	previous := statusInterval
+	statusInterval = interval
+	t.Cleanup(func() { statusInterval = previous })
+}
+
+// statusLasts sets the clock so that a status message of one minute is updated for the duration
+func statusLasts(t *testing.T, duration time.Duration) {
+	setClock(t, func() time.Time { return time.Now().Add(duration - time.Minute) })
+}
+
+// statusEdits returns the texts of the edits of the message
+func statusEdits(api *testAPI, messageID int) []string {
+	var texts []string
+	for _, call := range api.requests("editMessageText") {
+		if call.Params["message_id"] == float64(messageID) {
+			texts = append(texts, call.text())
+		}
+	}
+	return texts
+}
+
+// statusMessage makes the next status message have the ID
+func statusMessage(api *testAPI, messageID int) {
+	api.result("sendMessage", fmt.Sprintf(`{"message_id":%d,"date":1,"chat":{"id":2,"type":"private"}}`, messageID))
+}
+
+// waitStatus waits until no status message is updated
+func waitStatus(t *testing.T, app *App) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		app.status.mu.Lock()
+		running := app.status.done != nil
+		app.status.mu.Unlock()
+		if !running {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the status message is still updated")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestStatusIsEditedUntilItExpires(t *testing.T) {
+	app, api := newTestApp(t)
+	app.Conf.Set("status_minutes", 1)
+	setStatusInterval(t, 20*time.Millisecond)
+	statusLasts(t, 200*time.Millisecond)
+
+	statusMessage(api, 400)
+	parseMessage(commandMessage(2, "/status"), app)
+	first := lastSent(api, 2)
+	if !strings.Contains(first, "Open questions: 0") || !strings.Contains(first, "🔄 Updated every 20ms until") {
+		t.Fatalf("status = %q", first)
+	}
+	waitStatus(t, app)
+
+	edits := statusEdits(api, 400)
+	if len(edits) < 4 || len(edits) > 12 {
+		t.Fatalf("%d edits in 200ms with a 20ms interval: %q", len(edits), edits)
+	}
+	for _, text := range edits[:len(edits)-1] {
+		if !strings.Contains(text, "🔄") {
+			t.Fatalf("a refresh lost the marker: %q", text)
+		}
+	}
+	if final := edits[len(edits)-1]; strings.Contains(final, "🔄") || !strings.Contains(final, "\nAs of ") {
+		t.Fatalf("final edit = %q, want the marker removed", final)
+	}
+	count := len(api.requests("editMessageText"))
+	time.Sleep(60 * time.Millisecond)
+	if len(api.requests("editMessageText")) != count {
+		t.Fatal("the expired status is still edited")
+	}
+}
+
+func TestNewStatusStopsThePreviousOne(t *testing.T) {
+	app, api := newTestApp(t)
+	setStatusInterval(t, 10*time.Millisecond)
+	user := database.GetUserByChatID(2, app.DB)
+
+	statusMessage(api, 400)
+	if err := startStatus(user, app); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(35 * time.Millisecond)
+	statusMessage(api, 500)
+	if err := startStatus(user, app); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		app.status.mu.Lock()
+		app.status.cancel()
+		app.status.mu.Unlock()
+		waitStatus(t, app)
+	})
+	edits := statusEdits(api, 400)
+	if len(edits) == 0 || !strings.Contains(edits[len(edits)-1], "\nAs of ") {
+		t.Fatalf("old status edits = %q, want the final edit before the new status", edits)
+	}
+	stopped := len(edits)
+	time.Sleep(50 * time.Millisecond)
+	if n := len(statusEdits(api, 400)); n != stopped {
+		t.Fatalf("the old status is edited %d more times", n-stopped)
+	}
+	if len(statusEdits(api, 500)) == 0 {
+		t.Fatal("the new status is not updated")
+	}
+}
+
+func TestStatusIgnoresNotModified(t *testing.T) {
+	app, api := newTestApp(t)
+	api.fail("editMessageText", 400, "Bad Request: message is not modified: specified new message content and reply markup are exactly the same")
+	editStatus(2, 5, "same", app)
+	if text, _ := l.LastError(); strings.Contains(text, "not modified") {
+		t.Fatalf("not modified is logged as an error: %q", text)
+	}
+	api.fail("editMessageText", 400, "Bad Request: message to edit not found")
+	editStatus(2, 5, "gone", app)
+	if text, _ := l.LastError(); !strings.Contains(text, "message to edit not found") {
+		t.Fatalf("last error = %q, want other edit errors logged", text)
+	}
+}
@@ -0,0 +1,113 @@
+package bot
+
+import (
+	"fmt"
+	"strconv"
+	"telegram-bot-feedback/internal/pkg/database"
+	l "telegram-bot-feedback/internal/pkg/logger"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+	"time"
+)
+
+// surveyOptions are the poll options from the best score (5) to the worst (1)
+var surveyOptions = []string{"😍 Very satisfied", "🙂 Satisfied", "😐 Neutral", "🙁 Dissatisfied", "😡 Very dissatisfied"}
+
+// surveyPeriod is the period of /satisfaction statistics
+const surveyPeriod = 30 * 24 * time.Hour
+
+// resolveQuestion closes the Question and sends the satisfaction survey to the user
+//
+// The Question is the one the employee replied to or is answering
+func resolveQuestion(message *tg.Message, user *database.User, app *App) error {
+	question := linkedQuestion(message, app)
+	if question == nil {
+		question = database.GetOpenQuestionByAnswerer(user, app.DB)
+	}
+	if question == nil {
+		_, err := app.Bot.Send(tg.NewMessage(user.ChatID, "Take a question or reply to its message"))
+		return l.Err(err)
+	}
+	err := closeQuestion(question, app)
+	if err != nil {
+		return l.Err(err)
+	}
+	id := strconv.Itoa(int(question.ID))
+	if user.State == SQuestionDiscussion && question.AnswererID == int(user.ID) {
+		err = database.ChangeUserState(SMain, user, app.DB)
+		if err != nil {
+			return l.Err(err)
+		}
+		err = responser(user, app)
+		if err != nil {
+			return l.Err(err)
+		}
+	}
+	_, err = app.Bot.Send(tg.NewMessage(user.ChatID, "Question #"+id+" resolved"))
+	if err != nil {
+		return l.Err(err)
+	}
+	asker := &question.User
+	if asker.State == SQuestionDiscussion {
+		err = database.ChangeUserState(SMain, asker, app.DB)
+		if err != nil {
+			return l.Err(err)
+		}
+	}
+	notice := tg.NewMessage(asker.ChatID, "Your ticket "+ticketNumber(question)+" has been resolved")
+	notice.ReplyMarkup = userMainKeyboard(asker, app)
+	err = sendNotice(asker, notice, int(question.ID), app.hooks)
+	if err != nil {
+		return l.Err(err)
+	}
+	if !featureEnabled(FeatureSurvey, question, app) {
+		return nil
+	}
+	return l.Err(sendSurvey(question, app))
+}
+
+// sendSurvey sends the non-anonymous satisfaction poll and stores its ID in the Question
+//
+// During the quiet hours of the user the poll is held, the outbox stores the ID when it is sent
+func sendSurvey(question *database.Question, app *App) error {
+	poll := tg.NewPoll(question.User.ChatID, "How satisfied are you with the resolution?", surveyOptions...)
+	poll.IsAnonymous = false
+	held, err := holdMessage(&question.User, "sendPoll", poll, int(question.ID), false, app.hooks)
+	if err != nil || held {
+		return l.Err(err)
+	}
+	sent, err := app.Bot.Send(poll)
+	if err != nil {
+		return l.Err(err)
+	}
+	if sent.Poll == nil {
+		return l.Err(l.NewError("poll is not returned"))
+	}
+	return l.Err(database.ChangeQuestionSurvey(sent.Poll.ID, question, app.DB))
+}
+
+// parsePollAnswer records the survey score
+//
+// An empty answer means the vote was retracted
+func parsePollAnswer(answer *tg.PollAnswer, app *App) error {
+	question := database.GetQuestionBySurvey(answer.PollID, app.DB)
+	if question == nil {
+		return nil
+	}
+	score := 0
+	if len(answer.OptionIDs) > 0 && answer.OptionIDs[0] < len(surveyOptions) {
+		score = len(surveyOptions) - answer.OptionIDs[0]
+	}
+	return l.Err(database.ChangeQuestionSurveyScore(score, question, app.DB))
+}
+
+// sendSatisfaction sends the average survey score and response rate for the last 30 days
+func sendSatisfaction(user *database.User, app *App) error {
+	stats := database.GetSurveyStats(time.Now().Add(-surveyPeriod), app.DB)
+	text := "No surveys in the last 30 days"
+	if stats.Sent > 0 {
+		text = fmt.Sprintf("Last 30 days\nAverage score: %.2f / 5\nResponses: %d of %d (%.0f%%)",
+			stats.Average, stats.Answered, stats.Sent, float64(stats.Answered)*100/float64(stats.Sent))
+	}
+	_, err := app.Bot.Send(tg.NewMessage(user.ChatID, text))
+	return l.Err(err)
+}
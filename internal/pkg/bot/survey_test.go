@@ -0,0 +1,82 @@
+package bot
+
+import (
+	"telegram-bot-feedback/internal/pkg/database"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+	"testing"
+)
+
+// resolvedQuestion resolves the answered Question of user 1 with /resolve, the survey poll ID is "poll1"
+func resolvedQuestion(t *testing.T, app *App, api *testAPI) *database.Question {
+	api.result("sendPoll", `{"message_id":200,"chat":{"id":1,"type":"private"},"poll":{"id":"poll1","question":"How satisfied","is_anonymous":false}}`)
+	question := answeredQuestion(t, app)
+	if err := database.ChangeUserState(SQuestionDiscussion, database.GetUserByChatID(2, app.DB), app.DB); err != nil {
+		t.Fatal(err)
+	}
+	parseMessage(commandMessage(2, "/resolve"), app)
+	return database.GetQuestionById(int(question.ID), app.DB)
+}
+
+// voteSurvey sends the poll answer of user 1
+func voteSurvey(app *App, options ...int) {
+	parseUpdate(&tg.Update{PollAnswer: &tg.PollAnswer{PollID: "poll1", User: tg.User{ID: 1}, OptionIDs: options}}, app)
+}
+
+func TestResolveSendsNonAnonymousSurvey(t *testing.T) {
+	app, api := newTestApp(t)
+	question := resolvedQuestion(t, app, api)
+	polls := api.requests("sendPoll")
+	if len(polls) != 1 || polls[0].chatID() != 1 || polls[0].Params["is_anonymous"] != false {
+		t.Fatalf("polls = %+v", polls)
+	}
+	if options, _ := polls[0].Params["options"].([]interface{}); len(options) != len(surveyOptions) {
+		t.Fatalf("options = %v", polls[0].Params["options"])
+	}
+	if !question.IsClosed || question.SurveyPollID != "poll1" {
+		t.Fatalf("question = %+v", question)
+	}
+}
+
+func TestSurveyScore(t *testing.T) {
+	app, api := newTestApp(t)
+	question := resolvedQuestion(t, app, api)
+	voteSurvey(app, 1)
+	if got := database.GetQuestionById(int(question.ID), app.DB).SurveyScore; got != 4 {
+		t.Fatalf("score = %d, want 4", got)
+	}
+	parseMessage(commandMessage(2, "/satisfaction"), app)
+	if got := lastSent(api, 2); got != "Last 30 days\nAverage score: 4.00 / 5\nResponses: 1 of 1 (100%)" {
+		t.Fatalf("/satisfaction = %q", got)
+	}
+
+	voteSurvey(app)
+	if got := database.GetQuestionById(int(question.ID), app.DB).SurveyScore; got != 0 {
+		t.Fatalf("score = %d after the vote is retracted", got)
+	}
+	parseMessage(commandMessage(2, "/satisfaction"), app)
+	if got := lastSent(api, 2); got != "Last 30 days\nAverage score: 0.00 / 5\nResponses: 0 of 1 (0%)" {
+		t.Fatalf("/satisfaction = %q", got)
+	}
+}
+
+func TestSurveyAnswerAfterArchiving(t *testing.T) {
+	app, api := newTestApp(t)
+	question := resolvedQuestion(t, app, api)
+	if err := app.DB.Delete(question).Error; err != nil {
+		t.Fatal(err)
+	}
+	voteSurvey(app, 0)
+	archived := database.Question{}
+	if err := app.DB.Unscoped().First(&archived, question.ID).Error; err != nil || archived.SurveyScore != 5 {
+		t.Fatalf("score = %d, %v", archived.SurveyScore, err)
+	}
+}
+
+func TestUnknownPollIsIgnored(t *testing.T) {
+	app, api := newTestApp(t)
+	question := resolvedQuestion(t, app, api)
+	parseUpdate(&tg.Update{PollAnswer: &tg.PollAnswer{PollID: "other", User: tg.User{ID: 1}, OptionIDs: []int{0}}}, app)
+	if got := database.GetQuestionById(int(question.ID), app.DB).SurveyScore; got != 0 {
+		t.Fatalf("score = %d", got)
+	}
+}
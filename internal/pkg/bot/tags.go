@@ -0,0 +1,230 @@
+package bot
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	l "telegram-bot-feedback/internal/pkg/logger"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+	"unicode/utf8"
+)
+
+// Tag and search settings
+const (
+	// maxTagLength is the maximum length of a tag
+	maxTagLength = 32
+	// findCandidates is how many newest matching Questions are ranked by /find
+	findCandidates = 200
+	// findPerPage is the number of /find results on a page
+	findPerPage = 5
+	// findSettingPrefix is the Setting key prefix of the last /find query of the employee
+	findSettingPrefix = "find_"
+)
+
+// Search weights, a tag is the strongest signal
+const (
+	tagWeight            = 5
+	headerWeight         = 3
+	correspondenceWeight = 1
+)
+
+// parseTags returns the lowercase tags of "#billing android, urgent" without duplicates
+//
+// Tags longer than maxTagLength are dropped
+func parseTags(args string) []string {
+	var tags []string
+	seen := map[string]bool{}
+	fields := strings.FieldsFunc(args, func(r rune) bool { return r == ',' || r == ' ' || r == '\n' || r == '\t' })
+	for _, field := range fields {
+		tag := strings.ToLower(strings.TrimLeft(field, "#"))
+		if tag == "" || utf8.RuneCountInString(tag) > maxTagLength || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+// repliedQuestion returns the Question of the message the employee replied to, closed ones too
+func repliedQuestion(message *tg.Message, app *App) *database.Question {
+	if message.ReplyToMessage == nil {
+		return nil
+	}
+	link := database.GetMessageLink(message.Chat.ID, message.ReplyToMessage.MessageID, app.DB)
+	if link == nil {
+		return nil
+	}
+	return database.GetQuestionById(link.QuestionID, app.DB)
+}
+
+// tagQuestion adds or removes tags of the Question of the replied message
+//
+// Format: /tag <tags...> or /untag [tags...], /untag without tags removes all of them
+func tagQuestion(message *tg.Message, add bool, user *database.User, app *App) error {
+	question := repliedQuestion(message, app)
+	if question == nil {
+		_, err := app.Bot.Send(tg.NewMessage(user.ChatID, "Reply to a question message"))
+		return l.Err(err)
+	}
+	tags := parseTags(message.CommandArguments())
+	var err error
+	switch {
+	case add && len(tags) == 0:
+	case add:
+		err = database.AddQuestionTags(tags, question, app.DB)
+	default:
+		err = database.RemoveQuestionTags(tags, question, app.DB)
+	}
+	if err != nil {
+		return l.Err(err)
+	}
+	text := "No tags"
+	if tags := database.GetQuestionTags(question, app.DB); len(tags) > 0 {
+		text = "Tags: " + formatTags(tags)
+	}
+	_, err = app.Bot.Send(tg.NewMessage(user.ChatID, "#"+strconv.Itoa(int(question.ID))+" "+text))
+	return l.Err(err)
+}
+
+// formatTags returns "#a #b"
+func formatTags(tags []string) string {
+	return "#" + strings.Join(tags, " #")
+}
+
+// searchResult is a Question found by /find with its relevance
+type searchResult struct {
+	Question database.Question
+	Tags     []string
+	Score    int
+}
+
+// searchScore returns the relevance of the Question to the terms
+//
+// Every exact tag adds tagWeight, every occurrence in the header headerWeight and in the correspondence correspondenceWeight
+func searchScore(terms []string, header string, texts []string, tags []string) int {
+	score := 0
+	header = strings.ToLower(header)
+	for _, term := range terms {
+		for _, tag := range tags {
+			if tag == term {
+				score += tagWeight
+			}
+		}
+		score += strings.Count(header, term) * headerWeight
+		for _, text := range texts {
+			score += strings.Count(strings.ToLower(text), term) * correspondenceWeight
+		}
+	}
+	return score
+}
+
+// searchQuestions returns Questions matching the query ordered by relevance, newer first among equal ones
+func searchQuestions(query string, app *App) []searchResult {
+	terms := parseTags(query)
+	var results []searchResult
+	for _, question := range database.SearchQuestions(terms, findCandidates, app.DB) {
+		var texts []string
+		for _, corr := range database.GetCorrespondenceByQuestion(&question, app.DB) {
+			texts = append(texts, corr.Text)
+		}
+		tags := database.GetQuestionTags(&question, app.DB)
+		score := searchScore(terms, question.Header, texts, tags)
+		if score == 0 {
+			continue
+		}
+		results = append(results, searchResult{Question: question, Tags: tags, Score: score})
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	return results
+}
+
+// findQuestions sends the first page of Questions matching the query
+//
+// Format: /find <query>
+func findQuestions(message *tg.Message, user *database.User, app *App) error {
+	query := strings.TrimSpace(message.CommandArguments())
+	if query == "" {
+		_, err := app.Bot.Send(tg.NewMessage(user.ChatID, "Format: /find <query>"))
+		return l.Err(err)
+	}
+	err := database.SetSetting(findSettingPrefix+strconv.Itoa(user.ChatID), query, app.DB)
+	if err != nil {
+		return l.Err(err)
+	}
+	results := searchQuestions(query, app)
+	reply := tg.NewMessage(user.ChatID, findPage(query, results, 0, user, app))
+	if keyboard := findKeyboard(0, len(results)); keyboard != nil {
+		reply.ReplyMarkup = keyboard
+	}
+	_, err = app.Bot.Send(reply)
+	return l.Err(err)
+}
+
+// turnFindPage shows another page of the last /find of the employee
+func turnFindPage(data string, user *database.User, callback *tg.CallbackQuery, app *App) error {
+	page, err := strconv.Atoi(data)
+	if err != nil {
+		return l.Err(l.NewError("no page"))
+	}
+	_, err = app.Bot.Request(tg.NewCallback(callback.ID, ""))
+	if err != nil {
+		return l.Err(err)
+	}
+	query := database.GetSetting(findSettingPrefix+strconv.Itoa(user.ChatID), app.DB)
+	if query == "" {
+		return nil
+	}
+	results := searchQuestions(query, app)
+	edit := tg.NewEditMessageText(callback.Message.Chat.ID, callback.Message.MessageID, findPage(query, results, page, user, app))
+	edit.ReplyMarkup = findKeyboard(page, len(results))
+	_, err = app.Bot.Send(edit)
+	if tg.IsMessageNotModified(err) {
+		return nil
+	}
+	return l.Err(err)
+}
+
+// findPage returns the text of the results page with statuses, tags and links to the questions
+func findPage(query string, results []searchResult, page int, user *database.User, app *App) string {
+	if len(results) == 0 {
+		return "Nothing found for \"" + query + "\""
+	}
+	var b strings.Builder
+	b.WriteString("Found " + strconv.Itoa(len(results)) + " for \"" + query + "\"")
+	for i := page * findPerPage; i < len(results) && i < (page+1)*findPerPage; i++ {
+		question := &results[i].Question
+		header := []rune(question.Header)
+		if len(header) > 80 {
+			header = append(header[:80], '…')
+		}
+		b.WriteString("\n\n#" + strconv.Itoa(int(question.ID)) + " " + questionStatus(question) + " " + question.CreatedAt.Format(exportDateLayout))
+		b.WriteString("\n" + string(header))
+		if len(results[i].Tags) > 0 {
+			b.WriteString("\n" + formatTags(results[i].Tags))
+		}
+		if url := questionURL(user.ChatID, question, app); url != "" {
+			b.WriteString("\n" + url)
+		}
+	}
+	return b.String()
+}
+
+// findKeyboard returns the previous and next buttons of the results page
+func findKeyboard(page, results int) *tg.InlineKeyboardMarkup {
+	pages := (results + findPerPage - 1) / findPerPage
+	if pages < 2 {
+		return nil
+	}
+	var navigation []tg.InlineKeyboardButton
+	if page > 0 {
+		navigation = append(navigation, tg.NewInlineKeyboardButtonData("◀️", strconv.Itoa(CBFindPage)+"-"+strconv.Itoa(page-1)))
+	}
+	navigation = append(navigation, tg.NewInlineKeyboardButtonData(strconv.Itoa(page+1)+"/"+strconv.Itoa(pages), strconv.Itoa(CBFindPage)+"-"+strconv.Itoa(page)))
+	if page < pages-1 {
+		navigation = append(navigation, tg.NewInlineKeyboardButtonData("▶️", strconv.Itoa(CBFindPage)+"-"+strconv.Itoa(page+1)))
+	}
+	keyboard := tg.NewInlineKeyboardMarkup(navigation)
+	return &keyboard
+}
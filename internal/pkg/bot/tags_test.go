@@ -0,0 +1,172 @@
+package bot
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+	"testing"
+)
+
+// taggedQuestion adds the Question of user 1 with the tags and the correspondence
+func taggedQuestion(t *testing.T, app *App, header string, tags []string, texts ...string) *database.Question {
+	t.Helper()
+	user := database.GetUserByChatID(1, app.DB)
+	if user == nil {
+		var err error
+		if user, err = database.AddUser(1, "user1", SMain, app.DB); err != nil {
+			t.Fatal(err)
+		}
+	}
+	question, err := database.AddQuestion(header, 5, user, app.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, text := range texts {
+		if _, err := database.AddCorrespondenceToQuestion(question, user, 6, text, app.DB); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(tags) > 0 {
+		if err := database.AddQuestionTags(tags, question, app.DB); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return question
+}
+
+// resultIDs returns the Question IDs of the search results
+func resultIDs(results []searchResult) []uint {
+	var ids []uint
+	for _, result := range results {
+		ids = append(ids, result.Question.ID)
+	}
+	return ids
+}
+
+func TestParseTags(t *testing.T) {
+	tests := []struct {
+		args string
+		want []string
+	}{
+		{"billing android urgent", []string{"billing", "android", "urgent"}},
+		{"#Billing, #android,urgent", []string{"billing", "android", "urgent"}},
+		{"billing BILLING #billing\tAndroid\nandroid", []string{"billing", "android"}},
+		{"## , #", nil},
+		{"оплата #Оплата", []string{"оплата"}},
+		{strings.Repeat("a", maxTagLength+1) + " " + strings.Repeat("я", maxTagLength), []string{strings.Repeat("я", maxTagLength)}},
+	}
+	for _, tt := range tests {
+		if got := parseTags(tt.args); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseTags(%q) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestTagByReply(t *testing.T) {
+	app, api := newTestApp(t)
+	question := askQuestion(t, app, "It crashes")
+	if err := database.AddMessageLink(2, 0, 77, question, app.DB); err != nil {
+		t.Fatal(err)
+	}
+
+	parseMessage(replyCommand("/tag #Billing android billing", 77), app)
+	if got, want := lastSent(api, 2), fmt.Sprintf("#%d Tags: #android #billing", question.ID); got != want {
+		t.Fatalf("/tag = %q, want %q", got, want)
+	}
+	parseMessage(replyCommand("/tag android urgent", 77), app)
+	if got := database.GetQuestionTags(question, app.DB); !reflect.DeepEqual(got, []string{"android", "billing", "urgent"}) {
+		t.Fatalf("tags = %q, want no duplicates", got)
+	}
+
+	parseMessage(replyCommand("/untag android", 77), app)
+	if got := database.GetQuestionTags(question, app.DB); !reflect.DeepEqual(got, []string{"billing", "urgent"}) {
+		t.Fatalf("tags after /untag android = %q", got)
+	}
+	parseMessage(replyCommand("/untag", 77), app)
+	if got, want := lastSent(api, 2), fmt.Sprintf("#%d No tags", question.ID); got != want {
+		t.Fatalf("/untag = %q, want %q", got, want)
+	}
+
+	parseMessage(commandMessage(2, "/tag billing"), app)
+	if got := lastSent(api, 2); got != "Reply to a question message" {
+		t.Fatalf("/tag without a reply = %q", got)
+	}
+	parseMessage(replyCommand("/tag billing", 78), app)
+	if got := lastSent(api, 2); got != "Reply to a question message" {
+		t.Fatalf("/tag of another message = %q", got)
+	}
+}
+
+func TestFindRanksByRelevance(t *testing.T) {
+	app, _ := newTestApp(t)
+	tagged := taggedQuestion(t, app, "Card declined", []string{"billing"})
+	header := taggedQuestion(t, app, "Billing page is blank", nil)
+	text := taggedQuestion(t, app, "Question", nil, "my billing address is wrong")
+	taggedQuestion(t, app, "Android crash", []string{"android"})
+	newerHeader := taggedQuestion(t, app, "billing again", nil)
+
+	results := searchQuestions("billing", app)
+	if got, want := resultIDs(results), []uint{tagged.ID, newerHeader.ID, header.ID, text.ID}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("results = %v, want %v", got, want)
+	}
+	if scores := []int{results[0].Score, results[1].Score, results[3].Score}; !reflect.DeepEqual(scores, []int{tagWeight, headerWeight, correspondenceWeight}) {
+		t.Fatalf("scores = %v", scores)
+	}
+
+	both := taggedQuestion(t, app, "Crash after payment", []string{"billing", "android"})
+	if got := resultIDs(searchQuestions("#billing android", app)); got[0] != both.ID || len(got) != 6 {
+		t.Fatalf("results of two terms = %v, want #%d first", got, both.ID)
+	}
+	if got := searchQuestions("100%_", app); got != nil {
+		t.Fatalf("wildcards match %v", resultIDs(got))
+	}
+}
+
+func TestFindPages(t *testing.T) {
+	app, api := newTestApp(t)
+	var ids []uint
+	for i := 0; i < findPerPage+2; i++ {
+		ids = append(ids, taggedQuestion(t, app, fmt.Sprintf("Login fails %d", i), nil).ID)
+	}
+	parseMessage(commandMessage(2, "/find login"), app)
+	messages := api.requests("sendMessage")
+	first := messages[len(messages)-1]
+	if !strings.HasPrefix(first.text(), fmt.Sprintf("Found %d for \"login\"\n\n#%d open", len(ids), ids[len(ids)-1])) {
+		t.Fatalf("first page = %q", first.text())
+	}
+	if strings.Contains(first.text(), fmt.Sprintf("#%d ", ids[1])) || first.Params["reply_markup"] == nil {
+		t.Fatalf("first page = %+v, want the newest %d with buttons", first.Params, findPerPage)
+	}
+
+	callback := &tg.CallbackQuery{ID: "find", From: &tg.User{ID: 2}, Message: &tg.Message{MessageID: 30, Chat: &tg.Chat{ID: 2, Type: "private"}},
+		Data: fmt.Sprintf("%d-1", CBFindPage)}
+	if err := parseCallback(callback, app); err != nil {
+		t.Fatal(err)
+	}
+	edits := api.requests("editMessageText")
+	if len(edits) != 1 || !strings.Contains(edits[0].text(), fmt.Sprintf("#%d open", ids[0])) || strings.Contains(edits[0].text(), fmt.Sprintf("#%d open", ids[len(ids)-1])) {
+		t.Fatalf("second page = %+v", edits)
+	}
+
+	parseMessage(commandMessage(2, "/find nothing"), app)
+	if got := lastSent(api, 2); got != `Nothing found for "nothing"` {
+		t.Fatalf("/find nothing = %q", got)
+	}
+	parseMessage(commandMessage(2, "/find"), app)
+	if got := lastSent(api, 2); got != "Format: /find <query>" {
+		t.Fatalf("/find = %q", got)
+	}
+}
+
+func TestFindResultLinksToAdminMessage(t *testing.T) {
+	app, _ := newTestApp(t)
+	question := taggedQuestion(t, app, "Refund is late", []string{"billing"})
+	const group = -1001234567890
+	addMessageLink(&tg.Message{MessageID: 15, Chat: &tg.Chat{ID: group, Type: "supergroup"}}, question, app)
+	page := findPage("refund", searchQuestions("refund", app), 0, &database.User{ChatID: group}, app)
+	if !strings.HasSuffix(page, "\nRefund is late\n#billing\nhttps://t.me/c/1234567890/15") {
+		t.Fatalf("page = %q", page)
+	}
+}
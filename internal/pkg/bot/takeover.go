@@ -0,0 +1,109 @@
+package bot
+
+import (
+	"context"
+	"strconv"
+	"telegram-bot-feedback/internal/pkg/database"
+	l "telegram-bot-feedback/internal/pkg/logger"
+	"telegram-bot-feedback/internal/pkg/metrics"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+	"time"
+)
+
+// takeoverInterval is how often taken Questions are checked for an unresponsive answerer
+const takeoverInterval = time.Minute
+
+// runTakeover releases Questions whose answerer hasn't replied to the user within "takeover_minutes"
+//
+// The check is off when "takeover_minutes" is 0
+func runTakeover(ctx context.Context, app *App) {
+	ticker := time.NewTicker(takeoverInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if minutes := app.Conf.GetInt("takeover_minutes"); minutes > 0 {
+				takeOver(clock().Add(-time.Duration(minutes)*time.Minute), app)
+			}
+		}
+	}
+}
+
+// takeOver releases the Questions awaiting a reply since before the deadline, notifies the answerers
+// and sends the Questions to free employees
+//
+// The claim is dropped before the messages are sent, so a restart doesn't release a Question twice
+func takeOver(deadline time.Time, app *App) {
+	for _, question := range database.GetQuestionsAwaitingReplyBefore(deadline, app.DB) {
+		question := question
+		answerer := question.Answerer
+		err := database.ChangeQuestionAnswerer(0, &question, app.DB)
+		if err != nil {
+			l.Error(err)
+			continue
+		}
+		err = database.ChangeQuestionAwaitingReplySince(nil, &question, app.DB)
+		if err != nil {
+			l.Error(err)
+		}
+		metrics.Takeovers.Inc(strconv.Itoa(answerer.ChatID))
+		err = releaseAnswerer(&question, &answerer, app)
+		if err != nil {
+			l.Error(err)
+		}
+		reopenQuestion(&question, &answerer, app)
+	}
+}
+
+// releaseAnswerer tells the answerer that the Question was taken away and returns them to the main menu
+func releaseAnswerer(question *database.Question, answerer *database.User, app *App) error {
+	text := "Question #" + strconv.Itoa(int(question.ID)) + " was released because the user didn't get a reply in time"
+	_, err := app.Bot.Send(tg.NewMessage(answerer.ChatID, text))
+	if err != nil {
+		return l.Err(err)
+	}
+	if answerer.State != SQuestionDiscussion {
+		return nil
+	}
+	err = database.ChangeUserState(SMain, answerer, app.DB)
+	if err != nil {
+		return l.Err(err)
+	}
+	return l.Err(responser(answerer, app))
+}
+
+// reopenQuestion sends the released Question to free receivers and admins except the previous answerer
+func reopenQuestion(question *database.Question, previous *database.User, app *App) {
+	sent := map[int]bool{previous.ChatID: true}
+	recipients := database.GetReceivers(app.DB)
+	recipients = append(recipients, database.GetEmployeesByChatIDs(app.Conf.GetIntSlice("admins"), app.DB)...)
+	for _, recipient := range recipients {
+		if recipient.ChatID == 0 || sent[recipient.ChatID] {
+			continue
+		}
+		sent[recipient.ChatID] = true
+		err := sendQuestion(&recipient, question, nil, nil, app)
+		if err != nil {
+			l.Error(err)
+		}
+	}
+}
+
+// awaitReply starts the reply deadline of the answerer if the user isn't waiting already
+func awaitReply(question *database.Question, app *App) error {
+	if question.AwaitingReplySince != nil {
+		return nil
+	}
+	now := clock()
+	return l.Err(database.ChangeQuestionAwaitingReplySince(&now, question, app.DB))
+}
+
+// stopAwaitingReply clears the reply deadline after the answerer replied
+func stopAwaitingReply(question *database.Question, app *App) error {
+	if question.AwaitingReplySince == nil {
+		return nil
+	}
+	return l.Err(database.ChangeQuestionAwaitingReplySince(nil, question, app.DB))
+}
@@ -0,0 +1,135 @@
+package bot
+
+import (
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	"testing"
+	"time"
+)
+
+// takeoverStart is the time the user of the taken Question writes in takeover tests
+var takeoverStart = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// discussedQuestion returns the Question of user 1 taken by admin 2, with admin 3 free to receive it
+func discussedQuestion(t *testing.T, app *App) *database.Question {
+	t.Helper()
+	app.Conf.Set("admins", []int{2, 3})
+	if err := database.AddEmployeeByID(app.DB, 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.ChangeUserState(SMain, database.GetUserByChatID(3, app.DB), app.DB); err != nil {
+		t.Fatal(err)
+	}
+	question := answeredQuestion(t, app)
+	if err := database.ChangeUserState(SQuestionDiscussion, database.GetUserByChatID(2, app.DB), app.DB); err != nil {
+		t.Fatal(err)
+	}
+	return question
+}
+
+// at sets the clock to the offset from takeoverStart
+func at(t *testing.T, offset time.Duration) {
+	setClock(t, func() time.Time { return takeoverStart.Add(offset) })
+}
+
+// reloadQuestion returns the Question as stored
+func reloadQuestion(t *testing.T, question *database.Question, app *App) *database.Question {
+	t.Helper()
+	stored := database.GetQuestionById(int(question.ID), app.DB)
+	if stored == nil {
+		t.Fatal("the question is gone")
+	}
+	return stored
+}
+
+func TestTakeoverReleasesUnansweredQuestion(t *testing.T) {
+	app, api := newTestApp(t)
+	question := discussedQuestion(t, app)
+	before := scrapeMetric(t, `feedback_takeovers_total{answerer="2"}`)
+
+	at(t, 0)
+	parseMessage(privateMessage(1, 10, "hello?"), app)
+	at(t, 5*time.Minute)
+	parseMessage(privateMessage(1, 11, "anyone?"), app)
+	if since := reloadQuestion(t, question, app).AwaitingReplySince; since == nil || !since.Equal(takeoverStart) {
+		t.Fatalf("awaiting since %v, want the first unanswered message", since)
+	}
+
+	at(t, 10*time.Minute+time.Second)
+	takeOver(clock().Add(-10*time.Minute), app)
+	stored := reloadQuestion(t, question, app)
+	if stored.AnswererID != 0 || stored.AwaitingReplySince != nil {
+		t.Fatalf("answerer = %d, awaiting since %v, want released", stored.AnswererID, stored.AwaitingReplySince)
+	}
+	if texts := api.sentTo(2); len(texts) == 0 || !strings.Contains(strings.Join(texts, "\n"), "was released") {
+		t.Fatalf("admin 2 got %q, want the release notice", texts)
+	}
+	if state := database.GetUserByChatID(2, app.DB).State; state != SMain {
+		t.Fatalf("admin 2 state = %d, want the main menu", state)
+	}
+	if got := lastSent(api, 3); !strings.HasPrefix(got, "Question #") {
+		t.Fatalf("admin 3 got %q, want the released question", got)
+	}
+	for _, text := range api.sentTo(2) {
+		if strings.HasPrefix(text, "Question #") && !strings.Contains(text, "released") {
+			t.Fatalf("the question is sent again to the previous answerer: %q", text)
+		}
+	}
+	if got := scrapeMetric(t, `feedback_takeovers_total{answerer="2"}`) - before; got != 1 {
+		t.Fatalf("takeovers = %v, want 1", got)
+	}
+
+	api.reset()
+	takeOver(clock(), app)
+	if len(api.requests()) != 0 {
+		t.Fatalf("the released question is taken over again: %+v", api.requests())
+	}
+}
+
+func TestTakeoverKeepsQuestionAnsweredBeforeDeadline(t *testing.T) {
+	app, api := newTestApp(t)
+	question := discussedQuestion(t, app)
+
+	at(t, 0)
+	parseMessage(privateMessage(1, 10, "hello?"), app)
+	at(t, 10*time.Minute-time.Second)
+	parseMessage(privateMessage(2, 20, "looking into it"), app)
+	if since := reloadQuestion(t, question, app).AwaitingReplySince; since != nil {
+		t.Fatalf("awaiting since %v after the reply", since)
+	}
+
+	at(t, 10*time.Minute)
+	takeOver(clock().Add(-10*time.Minute), app)
+	at(t, 20*time.Minute)
+	takeOver(clock().Add(-10*time.Minute), app)
+	if stored := reloadQuestion(t, question, app); stored.AnswererID == 0 {
+		t.Fatal("the question is released although the answerer replied in time")
+	}
+	if got := api.sentTo(3); len(got) != 0 {
+		t.Fatalf("admin 3 got %q", got)
+	}
+}
+
+func TestTakeoverSurvivesRestart(t *testing.T) {
+	app, api := newTestApp(t)
+	question := discussedQuestion(t, app)
+	at(t, 0)
+	parseMessage(privateMessage(1, 10, "hello?"), app)
+
+	restarted := NewApp(app.Bot, app.DB, app.Conf)
+	at(t, time.Hour)
+	takeOver(clock().Add(-10*time.Minute), restarted)
+	if stored := reloadQuestion(t, question, app); stored.AnswererID != 0 {
+		t.Fatal("the deadline is lost after a restart")
+	}
+	takeOver(clock().Add(-10*time.Minute), restarted)
+	notices := 0
+	for _, text := range api.sentTo(2) {
+		if strings.Contains(text, "was released") {
+			notices++
+		}
+	}
+	if notices != 1 {
+		t.Fatalf("the answerer got %d release notices, want 1", notices)
+	}
+}
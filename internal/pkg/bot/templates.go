@@ -0,0 +1,218 @@
+package bot
+
+import (
+	"regexp"
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	l "telegram-bot-feedback/internal/pkg/logger"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+	"unicode"
+)
+
+// templateName is the format of template names
+var templateName = regexp.MustCompile(`^[a-z0-9_]{1,32}$`)
+
+// templateMatches is the number of close names suggested for an unknown template
+const templateMatches = 3
+
+// addTemplate saves the canned reply of the team
+//
+// Format: /template_add <name> <text>, the text may start on the next line
+func addTemplate(message *tg.Message, user *database.User, app *App) error {
+	name, text := cutTemplateArgs(message.CommandArguments())
+	var reply string
+	switch {
+	case name == "" || text == "":
+		reply = "Format: /template_add <name> <text>\nThe text may use {{user}} and {{ticket}}"
+	case !templateName.MatchString(name):
+		reply = "Template name must be 1-32 characters a-z, 0-9 or _"
+	case database.GetTemplate(name, app.DB) != nil:
+		reply = "Template " + name + " already exists, delete it with /template_del " + name + " first"
+	default:
+		err := database.AddTemplate(name, text, user, app.DB)
+		if err != nil {
+			return l.Err(err)
+		}
+		reply = "Template " + name + " saved, reply to a question with /t " + name
+	}
+	_, err := app.Bot.Send(tg.NewMessage(user.ChatID, reply))
+	return l.Err(err)
+}
+
+// deleteTemplate deletes the canned reply
+//
+// Format: /template_del <name>
+func deleteTemplate(message *tg.Message, user *database.User, app *App) error {
+	name := strings.ToLower(strings.TrimSpace(message.CommandArguments()))
+	template := database.GetTemplate(name, app.DB)
+	if template == nil {
+		_, err := app.Bot.Send(tg.NewMessage(user.ChatID, unknownTemplateText(name, app)))
+		return l.Err(err)
+	}
+	err := database.RemoveTemplate(template, app.DB)
+	if err != nil {
+		return l.Err(err)
+	}
+	_, err = app.Bot.Send(tg.NewMessage(user.ChatID, "Template "+name+" deleted"))
+	return l.Err(err)
+}
+
+// listTemplates sends the names and the first lines of the templates
+func listTemplates(user *database.User, app *App) error {
+	templates := database.GetTemplates(app.DB)
+	if len(templates) == 0 {
+		_, err := app.Bot.Send(tg.NewMessage(user.ChatID, "No templates, add one with /template_add <name> <text>"))
+		return l.Err(err)
+	}
+	var b strings.Builder
+	for _, template := range templates {
+		b.WriteString(template.Name + " - " + questionPreview(template.Text) + "\n")
+	}
+	for _, part := range splitText(b.String()) {
+		_, err := app.Bot.Send(tg.NewMessage(user.ChatID, part))
+		if err != nil {
+			return l.Err(err)
+		}
+	}
+	return nil
+}
+
+// sendTemplate answers the Question with the expanded template
+//
+// Format: /t <name> in reply to a message of the Question, or without a reply for the taken Question.
+// The answer is recorded in the dialog like a typed one
+func sendTemplate(message *tg.Message, user *database.User, app *App) error {
+	name := strings.ToLower(strings.TrimSpace(message.CommandArguments()))
+	if name == "" {
+		_, err := app.Bot.Send(tg.NewMessage(user.ChatID, "Format: /t <name> in reply to a question, /templates lists the names"))
+		return l.Err(err)
+	}
+	question := templateQuestion(message, user, app)
+	if question == nil {
+		_, err := app.Bot.Send(tg.NewMessage(user.ChatID, "Reply with /t "+name+" to a message of an open question"))
+		return l.Err(err)
+	}
+	template := database.GetTemplate(name, app.DB)
+	if template == nil {
+		_, err := app.Bot.Send(tg.NewMessage(user.ChatID, unknownTemplateText(name, app)))
+		return l.Err(err)
+	}
+	text := expandTemplate(template.Text, question)
+	for _, part := range splitText(text) {
+		err := sendToUser(question.User.ChatID, tg.NewMessage(question.User.ChatID, part), question, app)
+		if err != nil {
+			return l.Err(err)
+		}
+	}
+	return l.Err(recordAnswer(question, user, message.MessageID, text, app))
+}
+
+// recordAnswer marks the Question answered and adds the text answer of the employee to the dialog
+func recordAnswer(question *database.Question, user *database.User, messageId int, text string, app *App) error {
+	err := database.ChangeQuestionHaveAnswer(true, question, app.DB)
+	if err != nil {
+		return l.Err(err)
+	}
+	err = stopAwaitingReply(question, app)
+	if err != nil {
+		return l.Err(err)
+	}
+	_, err = database.AddCorrespondenceToQuestion(question, user, messageId, text, app.DB)
+	return l.Err(err)
+}
+
+// templateQuestion returns the open Question of the replied message, or the Question the employee has taken
+func templateQuestion(message *tg.Message, user *database.User, app *App) *database.Question {
+	if message.ReplyToMessage != nil {
+		return linkedQuestion(message, app)
+	}
+	return database.GetOpenQuestionByAnswerer(user, app.DB)
+}
+
+// expandTemplate fills the placeholders from the Question, unknown placeholders stay as they are
+//
+// {{user}} is the first name of the user, or the nickname if there is no name
+func expandTemplate(text string, question *database.Question) string {
+	name := strings.TrimSpace(question.User.FirstName)
+	if name == "" {
+		name = profileName(&question.User)
+	}
+	return strings.NewReplacer("{{user}}", name, "{{ticket}}", ticketNumber(question)).Replace(text)
+}
+
+// cutTemplateArgs splits "<name> <text>" at the first space or line break
+func cutTemplateArgs(args string) (string, string) {
+	args = strings.TrimSpace(args)
+	i := strings.IndexFunc(args, unicode.IsSpace)
+	if i < 0 {
+		return strings.ToLower(args), ""
+	}
+	return strings.ToLower(args[:i]), strings.TrimSpace(args[i:])
+}
+
+// unknownTemplateText tells the template is not found and suggests the closest names
+func unknownTemplateText(name string, app *App) string {
+	var names []string
+	for _, template := range database.GetTemplates(app.DB) {
+		names = append(names, template.Name)
+	}
+	text := "Template " + name + " is not found"
+	if matches := closeNames(name, names, templateMatches); len(matches) > 0 {
+		text += ", did you mean " + strings.Join(matches, ", ") + "?"
+	}
+	return text
+}
+
+// closeNames returns up to limit names within 2 edits of the name or containing it, the closest first
+func closeNames(name string, names []string, limit int) []string {
+	type match struct {
+		name     string
+		distance int
+	}
+	var matches []match
+	for _, candidate := range names {
+		distance := editDistance(name, candidate)
+		if name != "" && strings.Contains(candidate, name) && distance > 1 {
+			distance = 1
+		}
+		if distance <= 2 {
+			matches = append(matches, match{candidate, distance})
+		}
+	}
+	var result []string
+	for d := 0; d <= 2 && len(result) < limit; d++ {
+		for _, m := range matches {
+			if m.distance == d && len(result) < limit {
+				result = append(result, m.name)
+			}
+		}
+	}
+	return result
+}
+
+// editDistance returns the Levenshtein distance of the strings
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur := make([]int, len(rb)+1)
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cur[j] = prev[j-1]
+			if ra[i-1] != rb[j-1] {
+				cur[j]++
+			}
+			if prev[j]+1 < cur[j] {
+				cur[j] = prev[j] + 1
+			}
+			if cur[j-1]+1 < cur[j] {
+				cur[j] = cur[j-1] + 1
+			}
+		}
+		prev = cur
+	}
+	return prev[len(rb)]
+}
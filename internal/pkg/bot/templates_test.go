@@ -0,0 +1,146 @@
+package bot
+
+import (
+	"reflect"
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	"testing"
+)
+
+// addTestTemplate saves the template by admin 2
+func addTestTemplate(t *testing.T, app *App, name, text string) {
+	t.Helper()
+	if err := database.AddTemplate(name, text, database.GetUserByChatID(2, app.DB), app.DB); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExpandTemplate(t *testing.T) {
+	question := &database.Question{User: database.User{FirstName: " Ann ", Nickname: "ann_l"}, TicketID: "T-7"}
+	question.ID = 7
+	number := ticketNumber(question)
+	tests := []struct {
+		text, want string
+	}{
+		{"Hi {{user}}, ticket {{ticket}} is fixed", "Hi Ann, ticket " + number + " is fixed"},
+		{"{{user}} {{user}}", "Ann Ann"},
+		{"Dear {{name}}, {{ ticket }}", "Dear {{name}}, {{ ticket }}"},
+		{"no placeholders", "no placeholders"},
+	}
+	for _, tt := range tests {
+		if got := expandTemplate(tt.text, question); got != tt.want {
+			t.Errorf("expandTemplate(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+	question.User.FirstName = ""
+	if got := expandTemplate("Hi {{user}}", question); got != "Hi @ann_l" {
+		t.Errorf("without a first name = %q", got)
+	}
+}
+
+func TestCloseNames(t *testing.T) {
+	names := []string{"refund", "refunds", "refund_late", "greeting", "reset"}
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{"refnd", []string{"refund", "refunds"}},
+		{"refund_", []string{"refund", "refunds", "refund_late"}},
+		{"greting", []string{"greeting"}},
+		{"fund", []string{"refund", "refunds", "refund_late"}},
+		{"shipping", nil},
+	}
+	for _, tt := range tests {
+		if got := closeNames(tt.name, names, templateMatches); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("closeNames(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+	if got := editDistance("привет", "превед"); got != 2 {
+		t.Errorf("editDistance = %d, want 2 in runes", got)
+	}
+}
+
+func TestTemplateCommands(t *testing.T) {
+	app, api := newTestApp(t)
+	mainState(t, app)
+	parseMessage(commandMessage(2, "/template_add Refund Hi {{user}},\nthe refund of {{ticket}} is on its way"), app)
+	if got := lastSent(api, 2); got != "Template refund saved, reply to a question with /t refund" {
+		t.Fatalf("/template_add = %q", got)
+	}
+	if template := database.GetTemplate("refund", app.DB); template == nil || template.Text != "Hi {{user}},\nthe refund of {{ticket}} is on its way" {
+		t.Fatalf("template = %+v", template)
+	}
+	tests := []struct {
+		command, want string
+	}{
+		{"/template_add refund Another text", "Template refund already exists, delete it with /template_del refund first"},
+		{"/template_add refund", "Format: /template_add <name> <text>\nThe text may use {{user}} and {{ticket}}"},
+		{"/template_add bad-name text", "Template name must be 1-32 characters a-z, 0-9 or _"},
+		{"/templates", "refund - Hi {{user}},"},
+		{"/template_del refnd", "Template refnd is not found, did you mean refund?"},
+		{"/template_del refund", "Template refund deleted"},
+		{"/templates", "No templates, add one with /template_add <name> <text>"},
+	}
+	for _, tt := range tests {
+		parseMessage(commandMessage(2, tt.command), app)
+		if got := lastSent(api, 2); !strings.HasPrefix(got, tt.want) {
+			t.Errorf("%s = %q, want %q", tt.command, got, tt.want)
+		}
+	}
+}
+
+func TestSendTemplateByReply(t *testing.T) {
+	app, api := newTestApp(t)
+	mainState(t, app)
+	question := askQuestion(t, app, "Where is my refund?")
+	if err := database.AddMessageLink(2, 0, 77, question, app.DB); err != nil {
+		t.Fatal(err)
+	}
+	addTestTemplate(t, app, "refund", "Hi {{user}}, the refund of {{ticket}} is on its way")
+	addTestTemplate(t, app, "refunds", "Refunds take 5 days")
+
+	parseMessage(replyCommand("/t refund", 77), app)
+	want := "Hi @user1, the refund of " + ticketNumber(question) + " is on its way"
+	if got := lastSent(api, 1); got != want {
+		t.Fatalf("sent to the user = %q, want %q", got, want)
+	}
+	question = database.GetQuestionById(int(question.ID), app.DB)
+	if !question.HaveAnswer {
+		t.Fatal("the question is not marked answered")
+	}
+	dialog := database.ListDialog(question.UserID, database.DialogOptions{}, app.DB)
+	if last := dialog[len(dialog)-1]; !last.FromEmployee || last.Text != want {
+		t.Fatalf("dialog = %+v, want the expanded answer recorded", dialog)
+	}
+
+	count := len(api.sentTo(1))
+	parseMessage(replyCommand("/t refnd", 77), app)
+	if got := lastSent(api, 2); got != "Template refnd is not found, did you mean refund, refunds?" {
+		t.Fatalf("unknown template = %q", got)
+	}
+	parseMessage(replyCommand("/t refund", 78), app)
+	if got := lastSent(api, 2); got != "Reply with /t refund to a message of an open question" {
+		t.Fatalf("reply to an unlinked message = %q", got)
+	}
+	parseMessage(commandMessage(2, "/t"), app)
+	if got := lastSent(api, 2); !strings.HasPrefix(got, "Format: /t <name>") {
+		t.Fatalf("/t = %q", got)
+	}
+	if len(api.sentTo(1)) != count {
+		t.Fatal("a failed /t reaches the user")
+	}
+}
+
+func TestSendTemplateToTakenQuestion(t *testing.T) {
+	app, api := newTestApp(t)
+	answeredQuestion(t, app)
+	addTestTemplate(t, app, "long", strings.Repeat("a", 4000)+" {{user}} "+strings.Repeat("b", 500))
+	parseMessage(commandMessage(2, "/t long"), app)
+	parts := api.sentTo(1)
+	if len(parts) != 2 || len(parts[0]) > 4096 || len(parts[1]) > 4096 {
+		t.Fatalf("%d parts, want the expansion chunked", len(parts))
+	}
+	if joined := strings.Join(parts, ""); !strings.Contains(joined, "@user1") || strings.Count(joined, "a") != 4000 || strings.Count(joined, "b") != 500 {
+		t.Fatalf("parts = %q", parts)
+	}
+}
@@ -0,0 +1,87 @@
+package bot
+
+import (
+	"telegram-bot-feedback/internal/pkg/database"
+	l "telegram-bot-feedback/internal/pkg/logger"
+)
+
+// TicketBackend creates and closes tickets in an external ticketing system
+type TicketBackend interface {
+	// Open creates a ticket for the Question and returns its external ID
+	Open(question *database.Question) (string, error)
+	// Close closes the ticket by external ID
+	Close(ticketID string, question *database.Question) error
+}
+
+// NoopTicketBackend is the TicketBackend used when no ticketing system is configured
+type NoopTicketBackend struct{}
+
+// Open returns an empty ticket ID
+func (NoopTicketBackend) Open(question *database.Question) (string, error) {
+	return "", nil
+}
+
+// Close does nothing
+func (NoopTicketBackend) Close(ticketID string, question *database.Question) error {
+	return nil
+}
+
+// TicketPlugin mirrors Questions to an external ticketing system
+//
+// Ticketing errors do not interrupt the conversation, they are only logged
+type TicketPlugin struct {
+	Backend TicketBackend
+	hooks   *Hooks
+}
+
+// Name returns "tickets"
+func (p *TicketPlugin) Name() string {
+	return "tickets"
+}
+
+// Init saves the hooks
+func (p *TicketPlugin) Init(hooks *Hooks) error {
+	p.hooks = hooks
+	if p.Backend == nil {
+		p.Backend = NoopTicketBackend{}
+	}
+	return nil
+}
+
+// OnEvent opens a ticket for a new Question and closes it with the Question
+func (p *TicketPlugin) OnEvent(event Event) {
+	switch event.Type {
+	case EventQuestionOpened:
+		ticketID, err := p.Backend.Open(event.Question)
+		if err != nil {
+			l.Error(err)
+			return
+		}
+		if ticketID == "" {
+			return
+		}
+		err = database.ChangeQuestionTicketID(ticketID, event.Question, p.hooks.DB)
+		if err != nil {
+			l.Error(err)
+		}
+	case EventQuestionClosed:
+		if event.Question.TicketID == "" {
+			return
+		}
+		err := p.Backend.Close(event.Question.TicketID, event.Question)
+		if err != nil {
+			l.Error(err)
+		}
+	}
+}
+
+// closeQuestion closes the Question
+func closeQuestion(question *database.Question, app *App) error {
+	err := database.ChangeQuestionIsClosed(true, question, app.DB)
+	if err != nil {
+		return l.Err(err)
+	}
+	sampleForReview(question, app)
+	app.emit(Event{Type: EventQuestionClosed, Question: question})
+	return nil
+}
@@ -0,0 +1,94 @@
+package bot
+
+import (
+	"errors"
+	"telegram-bot-feedback/internal/pkg/database"
+	"testing"
+)
+
+// fakeTicketBackend records the opened and closed tickets
+type fakeTicketBackend struct {
+	openErr error
+	opened  []uint
+	closed  []string
+}
+
+func (b *fakeTicketBackend) Open(question *database.Question) (string, error) {
+	if b.openErr != nil {
+		return "", b.openErr
+	}
+	b.opened = append(b.opened, question.ID)
+	return "EXT-" + question.Header, nil
+}
+
+func (b *fakeTicketBackend) Close(ticketID string, question *database.Question) error {
+	b.closed = append(b.closed, ticketID)
+	return nil
+}
+
+// withTicketBackend enables the tickets plugin with the backend
+func withTicketBackend(t *testing.T, app *App, backend TicketBackend) {
+	plugin := &TicketPlugin{Backend: backend}
+	if err := plugin.Init(app.hooks); err != nil {
+		t.Fatal(err)
+	}
+	app.plugins = append(app.plugins, plugin)
+}
+
+// askQuestion sends the question of user 1 and returns it
+func askQuestion(t *testing.T, app *App, text string) *database.Question {
+	user, err := database.AddUser(1, "user1", SQuestion, app.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parseMessage(privateMessage(1, 5, text), app)
+	question := database.GetOpenQuestionByUser(user, app.DB)
+	if question == nil {
+		t.Fatal("the question is not opened")
+	}
+	return question
+}
+
+func TestTicketPluginOpensAndClosesTickets(t *testing.T) {
+	app, _ := newTestApp(t)
+	backend := &fakeTicketBackend{}
+	withTicketBackend(t, app, backend)
+	question := askQuestion(t, app, "crash")
+	if len(backend.opened) != 1 || backend.opened[0] != question.ID || question.TicketID != "EXT-crash" {
+		t.Fatalf("opened = %v, ticket = %q", backend.opened, question.TicketID)
+	}
+	if err := closeQuestion(question, app); err != nil {
+		t.Fatal(err)
+	}
+	if len(backend.closed) != 1 || backend.closed[0] != "EXT-crash" {
+		t.Fatalf("closed = %v", backend.closed)
+	}
+}
+
+func TestTicketBackendErrorDoesNotStopTheQuestion(t *testing.T) {
+	app, api := newTestApp(t)
+	backend := &fakeTicketBackend{openErr: errors.New("tracker is down")}
+	withTicketBackend(t, app, backend)
+	question := askQuestion(t, app, "crash")
+	if question.TicketID != "" || len(api.sentTo(2)) == 0 {
+		t.Fatalf("ticket = %q, admin got %q", question.TicketID, api.sentTo(2))
+	}
+	if err := closeQuestion(question, app); err != nil {
+		t.Fatal(err)
+	}
+	if len(backend.closed) != 0 {
+		t.Fatalf("closed %v without a ticket", backend.closed)
+	}
+}
+
+func TestNoopTicketBackend(t *testing.T) {
+	app, _ := newTestApp(t)
+	withTicketBackend(t, app, nil)
+	question := askQuestion(t, app, "crash")
+	if question.TicketID != "" {
+		t.Fatalf("ticket = %q, the no-op backend opens none", question.TicketID)
+	}
+	if err := closeQuestion(question, app); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,190 @@
+package bot
+
+import (
+	"strconv"
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	l "telegram-bot-feedback/internal/pkg/logger"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+	"time"
+)
+
+// capabilityAge is how long the recorded type of the admin chat is trusted before getChat is called again
+const capabilityAge = time.Hour
+
+// adminChat returns "admins_group" or the supergroup it was migrated to, 0 if it isn't set
+func adminChat(app *App) int {
+	chat := app.Conf.GetInt("admins_group")
+	for i := 0; chat != 0 && i < 3; i++ {
+		capability := database.GetChatCapability(chat, app.DB)
+		if capability == nil || capability.MigratedTo == 0 {
+			break
+		}
+		chat = capability.MigratedTo
+	}
+	return chat
+}
+
+// refreshAdminChat records the type of the admin chat and whether it has topics
+//
+// Called at startup and when the record is older than capabilityAge
+func refreshAdminChat(app *App) {
+	chatId := adminChat(app)
+	if chatId == 0 {
+		return
+	}
+	chat, err := app.Bot.GetChat(tg.GetChatConf{ChatID: chatId})
+	if err != nil {
+		l.Error(l.Err(err))
+		return
+	}
+	recordChatCapabilities(chat, app)
+}
+
+// recordChatCapabilities stores the type of the admin chat and whether it has topics, other chats are ignored
+//
+// When topics are turned off the topics of users are forgotten, new ones are created when topics come back
+func recordChatCapabilities(chat *tg.Chat, app *App) {
+	if chat == nil || chat.ID == 0 || chat.ID != adminChat(app) {
+		return
+	}
+	previous, err := database.SetChatCapability(chat.ID, chat.Type, chat.IsForum, clock(), app.DB)
+	if err != nil {
+		l.Error(err)
+		return
+	}
+	if previous != nil && previous.Type == chat.Type && previous.IsForum == chat.IsForum {
+		return
+	}
+	l.Info(l.NewError("Admin chat " + strconv.Itoa(chat.ID) + " is a " + chat.Type + ", topics: " + strconv.FormatBool(chat.IsForum)))
+	if previous != nil && previous.IsForum && !chat.IsForum {
+		err = database.RemoveUserTopics(chat.ID, app.DB)
+		if err != nil {
+			l.Error(err)
+		}
+	}
+}
+
+// migrateAdminChat follows the admin chat when its basic group becomes a supergroup
+//
+// Both the service message of the group and the one of the supergroup are handled, the second changes nothing
+func migrateAdminChat(message *tg.Message, app *App) error {
+	from, to := message.Chat.ID, message.MigrateToChatID
+	if message.MigrateFromChatID != 0 {
+		from, to = message.MigrateFromChatID, message.Chat.ID
+	}
+	if from != adminChat(app) {
+		return nil
+	}
+	err := database.ChangeChatMigratedTo(from, to, app.DB)
+	if err != nil {
+		return l.Err(err)
+	}
+	l.Info(l.NewError("Admin chat " + strconv.Itoa(from) + " is migrated to " + strconv.Itoa(to)))
+	refreshAdminChat(app)
+	return nil
+}
+
+// adminChatHasTopics returns the admin chat if it is a forum, 0 otherwise
+func adminChatHasTopics(app *App) int {
+	chat := adminChat(app)
+	if chat == 0 {
+		return 0
+	}
+	capability := database.GetChatCapability(chat, app.DB)
+	if capability == nil || clock().Sub(capability.CheckedAt) > capabilityAge {
+		refreshAdminChat(app)
+		capability = database.GetChatCapability(chat, app.DB)
+	}
+	if capability == nil || !capability.IsForum {
+		return 0
+	}
+	return chat
+}
+
+// sendToTopic copies the user message of the Question to the topic of the user in the admin chat
+//
+// Topics are created lazily, so a conversation started before topics were turned on gets its topic with its
+// next message. Nothing is sent if the admin chat has no topics, returns whether the message was sent
+func sendToTopic(question *database.Question, message *tg.Message, app *App) bool {
+	chat := adminChatHasTopics(app)
+	if chat == 0 {
+		return false
+	}
+	for attempt := 0; attempt < 2; attempt++ {
+		topic, err := userTopic(chat, question, app)
+		if err != nil {
+			l.Error(err)
+			return false
+		}
+		copy := tg.NewCopyMessage(chat, message.Chat.ID, message.MessageID)
+		copy.MessageThreadID = topic.ThreadID
+		sent, err := app.Bot.Send(copy)
+		if err == nil {
+			sent.Chat = &tg.Chat{ID: chat}
+			sent.IsTopicMessage, sent.MessageThreadID = true, topic.ThreadID
+			addMessageLink(sent, question, app)
+			return true
+		}
+		if !isTopicMissing(err) {
+			l.Error(l.Err(err))
+			return false
+		}
+		// The topic was deleted in the chat, the next attempt creates a new one
+		err = database.RemoveUserTopic(topic, app.DB)
+		if err != nil {
+			l.Error(err)
+			return false
+		}
+	}
+	return false
+}
+
+// userTopic returns the topic of the user of the Question, the topic is created if there is none
+func userTopic(chat int, question *database.Question, app *App) (*database.UserTopic, error) {
+	if topic := database.GetUserTopic(chat, question.UserID, app.DB); topic != nil {
+		return topic, nil
+	}
+	name := "User " + strconv.Itoa(question.UserID)
+	if user := database.GetUserById(question.UserID, app.DB); user != nil && !privacyMode(app) {
+		if profile := profileName(user); profile != "" {
+			name = profile
+		}
+	}
+	created, err := app.Bot.CreateForumTopic(tg.CreateForumTopicConf{ChatID: chat, Name: name})
+	if err != nil {
+		return nil, l.Err(err)
+	}
+	return database.AddUserTopic(chat, question.UserID, created.MessageThreadID, app.DB)
+}
+
+// isTopicMissing reports whether the error means the topic is deleted
+func isTopicMissing(err error) bool {
+	text := strings.ToLower(err.Error())
+	return strings.Contains(text, "thread not found") || strings.Contains(text, "topic_deleted")
+}
+
+// parseTopicMessage sends the message of an employee in the topic of a user to the user
+func parseTopicMessage(message *tg.Message, app *App) error {
+	topic := database.GetUserTopicByThread(message.Chat.ID, message.MessageThreadID, app.DB)
+	if topic == nil {
+		return nil
+	}
+	employee := database.GetUserByChatID(message.From.ID, app.DB)
+	if employee == nil || !employee.IsEmployee {
+		return nil
+	}
+	user := database.GetUserById(topic.UserID, app.DB)
+	if user == nil {
+		return nil
+	}
+	question := database.GetOpenQuestionByUser(user, app.DB)
+	if question == nil {
+		return l.Err(replyInGroup(message, "The user has no open question, the message is not sent", app))
+	}
+	err := sendToUser(user.ChatID, tg.NewCopyMessage(user.ChatID, message.Chat.ID, message.MessageID), question, app)
+	if err != nil {
+		return l.Err(err)
+	}
+	return l.Err(recordAnswer(question, employee, message.MessageID, messageText(message), app))
+}
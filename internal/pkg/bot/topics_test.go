@@ -0,0 +1,153 @@
+package bot
+
+import (
+	"telegram-bot-feedback/internal/pkg/database"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+	"testing"
+)
+
+// topicQuestion returns the App with the admin chat and an open Question of user 1
+func topicQuestion(t *testing.T, adminChat int, chat string) (*App, *testAPI, *database.Question) {
+	app, api := newTestApp(t)
+	app.Conf.Set("admins_group", adminChat)
+	api.result("getChat", chat)
+	api.result("createForumTopic", `{"message_thread_id":77,"name":"User","icon_color":0}`)
+	user, err := database.AddUser(1, "user1", SQuestionDiscussion, app.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	question, err := database.AddQuestion("help", 5, user, app.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return app, api, question
+}
+
+// topicCopies returns the copyMessage requests to the topic
+func topicCopies(api *testAPI, chat, thread int) []apiCall {
+	var copies []apiCall
+	for _, call := range api.requests("copyMessage") {
+		if call.chatID() == chat && call.Params["message_thread_id"] == float64(thread) {
+			copies = append(copies, call)
+		}
+	}
+	return copies
+}
+
+// forumUpdate returns the my_chat_member Update of the chat
+func forumUpdate(chat int, isForum bool) *tg.ChatMemberUpdated {
+	return &tg.ChatMemberUpdated{
+		Chat:          tg.Chat{ID: chat, Type: "supergroup", IsForum: isForum},
+		From:          tg.User{ID: 2},
+		OldChatMember: tg.ChatMember{Status: "administrator"},
+		NewChatMember: tg.ChatMember{Status: "administrator"},
+	}
+}
+
+func TestTopicsAfterGroupMigration(t *testing.T) {
+	app, api, _ := topicQuestion(t, -123, `{"id":-123,"type":"group"}`)
+	refreshAdminChat(app)
+	if err := parseMessage(privateMessage(1, 6, "first"), app); err != nil {
+		t.Fatal(err)
+	}
+	if len(api.requests("createForumTopic")) != 0 {
+		t.Fatal("a topic is created in a basic group")
+	}
+
+	api.result("getChat", `{"id":-100123,"type":"supergroup","is_forum":true}`)
+	migrate := &tg.Message{MessageID: 1, Chat: &tg.Chat{ID: -123, Type: "group"}, MigrateToChatID: -100123}
+	if err := parseMessage(migrate, app); err != nil {
+		t.Fatal(err)
+	}
+	if got := adminChat(app); got != -100123 {
+		t.Fatalf("admin chat = %d, want the supergroup", got)
+	}
+	if err := parseMessage(privateMessage(1, 7, "second"), app); err != nil {
+		t.Fatal(err)
+	}
+	topics := api.requests("createForumTopic")
+	if len(topics) != 1 || topics[0].chatID() != -100123 {
+		t.Fatalf("created topics %v, want one in the supergroup", topics)
+	}
+	if len(topicCopies(api, -100123, 77)) != 1 {
+		t.Fatalf("the message is not copied to the topic: %v", api.requests("copyMessage"))
+	}
+}
+
+func TestTopicsTurnedOn(t *testing.T) {
+	app, api, question := topicQuestion(t, -100500, `{"id":-100500,"type":"supergroup"}`)
+	refreshAdminChat(app)
+	if err := parseMessage(privateMessage(1, 6, "first"), app); err != nil {
+		t.Fatal(err)
+	}
+	if len(api.requests("createForumTopic")) != 0 {
+		t.Fatal("a topic is created before topics are turned on")
+	}
+
+	if err := parseMyChatMember(forumUpdate(-100500, true), app); err != nil {
+		t.Fatal(err)
+	}
+	api.result("getChat", `{"id":-100500,"type":"supergroup","is_forum":true}`)
+	for id := 7; id <= 8; id++ {
+		if err := parseMessage(privateMessage(1, id, "more"), app); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := len(api.requests("createForumTopic")); got != 1 {
+		t.Fatalf("created %d topics, want one for the conversation", got)
+	}
+	if got := len(topicCopies(api, -100500, 77)); got != 2 {
+		t.Fatalf("copied %d messages to the topic, want 2", got)
+	}
+	if topic := database.GetUserTopic(-100500, question.UserID, app.DB); topic == nil || topic.ThreadID != 77 {
+		t.Fatalf("topic of the user = %+v", topic)
+	}
+}
+
+func TestTopicsTurnedOff(t *testing.T) {
+	app, api, question := topicQuestion(t, -100500, `{"id":-100500,"type":"supergroup","is_forum":true}`)
+	refreshAdminChat(app)
+	if err := parseMessage(privateMessage(1, 6, "first"), app); err != nil {
+		t.Fatal(err)
+	}
+	if len(topicCopies(api, -100500, 77)) != 1 {
+		t.Fatal("the message is not copied to the topic")
+	}
+
+	api.result("getChat", `{"id":-100500,"type":"supergroup"}`)
+	if err := parseMyChatMember(forumUpdate(-100500, false), app); err != nil {
+		t.Fatal(err)
+	}
+	if database.GetUserTopic(-100500, question.UserID, app.DB) != nil {
+		t.Fatal("the topic is kept after topics are turned off")
+	}
+	api.reset()
+	if err := parseMessage(privateMessage(1, 7, "second"), app); err != nil {
+		t.Fatal(err)
+	}
+	if calls := api.requests("createForumTopic", "copyMessage"); len(calls) != 0 {
+		t.Fatalf("requests %v after topics are turned off", calls)
+	}
+}
+
+func TestTopicMessageIsSentToUser(t *testing.T) {
+	app, api, question := topicQuestion(t, -100500, `{"id":-100500,"type":"supergroup","is_forum":true}`)
+	if _, err := database.AddUserTopic(-100500, question.UserID, 77, app.DB); err != nil {
+		t.Fatal(err)
+	}
+	reply := &tg.Message{
+		MessageID:       30,
+		From:            &tg.User{ID: 2},
+		Chat:            &tg.Chat{ID: -100500, Type: "supergroup", IsForum: true},
+		IsTopicMessage:  true,
+		MessageThreadID: 77,
+		Text:            "fixed",
+	}
+	if err := parseMessage(reply, app); err != nil {
+		t.Fatal(err)
+	}
+	copies := api.requests("copyMessage")
+	if len(copies) != 1 || copies[0].chatID() != 1 {
+		t.Fatalf("copies %v, want one to the user", copies)
+	}
+}
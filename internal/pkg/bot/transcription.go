@@ -0,0 +1,123 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	l "telegram-bot-feedback/internal/pkg/logger"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+	"time"
+)
+
+// transcriptionTimeout limits the download and the transcription of one voice message
+const transcriptionTimeout = 2 * time.Minute
+
+// transcriptionPrefix marks the transcription in captions and stored texts
+const transcriptionPrefix = "📝 "
+
+// Transcriber converts voice messages to text
+type Transcriber interface {
+	// Transcribe returns the text of the audio, empty if there is no speech
+	Transcribe(ctx context.Context, audio io.Reader, mime string) (string, error)
+}
+
+// NoopTranscriber is the Transcriber used when no speech recognition is configured
+type NoopTranscriber struct{}
+
+// Transcribe returns an empty text
+func (NoopTranscriber) Transcribe(ctx context.Context, audio io.Reader, mime string) (string, error) {
+	return "", nil
+}
+
+// transcribeVoice transcribes the voice message in the background and adds the text to the copies
+// sent to employees and to the stored Question
+//
+// The copies are sent before, so a slow or failing Transcriber never delays them. Copies with
+// a caption of the bot get the text in the caption, forwards get it as a reply
+func transcribeVoice(message *tg.Message, question *database.Question, sent []*tg.Message, app *App) {
+	if message.Voice == nil || len(sent) == 0 {
+		return
+	}
+	if _, ok := app.Transcriber.(NoopTranscriber); ok || app.Transcriber == nil {
+		return
+	}
+	if !featureEnabled(FeatureTranscription, question, app) {
+		return
+	}
+	questionID, headerMessage := int(question.ID), question.MessageID
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), transcriptionTimeout)
+		defer cancel()
+		text, err := transcribe(ctx, message.Voice, app)
+		if err != nil {
+			l.Error(err)
+			return
+		}
+		if text == "" {
+			return
+		}
+		err = database.AppendCorrespondenceText(questionID, message.MessageID, "\n"+transcriptionPrefix+text, app.DB)
+		if err != nil {
+			l.Error(err)
+		}
+		if headerMessage == message.MessageID {
+			err = database.AppendQuestionHeader(questionID, "\n"+transcriptionPrefix+text, app.DB)
+			if err != nil {
+				l.Error(err)
+			}
+		}
+		for _, copy := range sent {
+			err := addTranscription(copy, text, app)
+			if err != nil {
+				l.Error(err)
+			}
+		}
+	}()
+}
+
+// transcribe downloads the voice file and runs the Transcriber
+func transcribe(ctx context.Context, voice *tg.Voice, app *App) (string, error) {
+	file, err := app.Bot.GetFile(tg.GetFileConf{FileID: voice.FileID})
+	if err != nil {
+		return "", l.Err(err)
+	}
+	data, err := app.Bot.DownloadFileWithContext(ctx, file)
+	if err != nil {
+		return "", l.Err(err)
+	}
+	text, err := app.Transcriber.Transcribe(ctx, bytes.NewReader(data), voice.MimeType)
+	return text, l.Err(err)
+}
+
+// addTranscription edits the text into the caption of the copy or replies to it with the text
+func addTranscription(copy *tg.Message, text string, app *App) error {
+	if copy == nil || copy.Chat == nil {
+		return nil
+	}
+	caption := strings.TrimRight(copy.Caption, "\n")
+	if caption != "" {
+		caption += "\n\n"
+	}
+	caption += transcriptionPrefix + text
+	if copy.ForwardDate == 0 && tg.UTF16Len(caption) <= tg.MaxCaptionLength {
+		edit := tg.EditMessageCaptionConf{ChatID: copy.Chat.ID, MessageID: copy.MessageID, Caption: caption, ReplyMarkup: copy.ReplyMarkup}
+		for _, entity := range copy.CaptionEntities {
+			edit.CaptionEntities = append(edit.CaptionEntities, *entity)
+		}
+		_, err := app.Bot.Request(edit)
+		return l.Err(err)
+	}
+	for _, chunk := range splitMessage(transcriptionPrefix+"Transcription", text, nil) {
+		reply := tg.NewMessage(copy.Chat.ID, chunk.Text)
+		reply.Entities = chunk.Entities
+		reply.ReplyToMessageID = copy.MessageID
+		reply.AllowSendingWithoutReply = true
+		_, err := app.Bot.Send(reply)
+		if err != nil {
+			return l.Err(err)
+		}
+	}
+	return nil
+}
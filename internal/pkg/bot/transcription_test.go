@@ -0,0 +1,158 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+	"testing"
+	"time"
+)
+
+// fakeTranscriber returns the text once the test releases it
+type fakeTranscriber struct {
+	text    string
+	err     error
+	release chan struct{}
+	mimes   chan string
+}
+
+func newFakeTranscriber(text string, err error) *fakeTranscriber {
+	return &fakeTranscriber{text: text, err: err, release: make(chan struct{}), mimes: make(chan string, 10)}
+}
+
+func (f *fakeTranscriber) Transcribe(ctx context.Context, audio io.Reader, mime string) (string, error) {
+	if data, err := io.ReadAll(audio); err != nil || len(data) == 0 {
+		return "", errors.New("no audio")
+	}
+	f.mimes <- mime
+	<-f.release
+	return f.text, f.err
+}
+
+// withVoiceFile makes getFile return the voice file
+func withVoiceFile(api *testAPI) {
+	api.result("getFile", `{"file_id":"voice","file_unique_id":"v","file_path":"voice/file_1.oga"}`)
+}
+
+// waitRequests waits until the fake server received a request of the method
+func waitRequests(t *testing.T, api *testAPI, method string) []apiCall {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if calls := api.requests(method); len(calls) > 0 {
+			return calls
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no %s request", method)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// voice attaches a voice note to the message
+func voice(message *tg.Message) {
+	message.Voice = &tg.Voice{FileID: "voice", FileUniqueID: "v", MimeType: "audio/ogg"}
+}
+
+func TestVoiceQuestionIsDeliveredBeforeTranscription(t *testing.T) {
+	app, api := newTestApp(t)
+	withVoiceFile(api)
+	transcriber := newFakeTranscriber("the app crashes", nil)
+	app.Transcriber = transcriber
+
+	question := askWithMedia(t, app, "", voice)
+	if copies := api.requests("copyMessage"); len(copies) != 1 || copies[0].chatID() != 2 {
+		t.Fatalf("copies = %+v, want the voice delivered to the admin", copies)
+	}
+	if mime := <-transcriber.mimes; mime != "audio/ogg" {
+		t.Fatalf("mime = %q", mime)
+	}
+	if len(api.requests("editMessageCaption")) != 0 {
+		t.Fatal("the caption is edited before the transcription")
+	}
+
+	close(transcriber.release)
+	edit := waitRequests(t, api, "editMessageCaption")[0]
+	caption, _ := edit.Params["caption"].(string)
+	if want := fmt.Sprintf("Question #%d\n\n📝 the app crashes", question.ID); edit.chatID() != 2 || caption != want {
+		t.Fatalf("edit = %+v", edit.Params)
+	}
+	if edit.Params["reply_markup"] == nil {
+		t.Fatal("the edit drops the Take question button")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(database.GetQuestionById(int(question.ID), app.DB).Header, "📝 the app crashes") {
+		if time.Now().After(deadline) {
+			t.Fatalf("header = %q, want the transcription stored", database.GetQuestionById(int(question.ID), app.DB).Header)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestForwardedVoiceGetsTranscriptionReply(t *testing.T) {
+	app, api := newTestApp(t)
+	withVoiceFile(api)
+	api.result("forwardMessage", `{"message_id":70,"date":1,"forward_date":1,"chat":{"id":2,"type":"private"}}`)
+	transcriber := newFakeTranscriber("please call me back", nil)
+	app.Transcriber = transcriber
+	answeredQuestion(t, app)
+
+	message := privateMessage(1, 12, "")
+	voice(message)
+	parseMessage(message, app)
+	if forwards := api.requests("forwardMessage"); len(forwards) != 1 {
+		t.Fatalf("forwards = %+v", forwards)
+	}
+	close(transcriber.release)
+	var reply *apiCall
+	deadline := time.Now().Add(5 * time.Second)
+	for reply == nil {
+		for _, call := range api.requests("sendMessage") {
+			if call.Params["reply_to_message_id"] == float64(70) {
+				call := call
+				reply = &call
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("no transcription reply to the forward")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if reply.chatID() != 2 || reply.text() != "📝 Transcription\nplease call me back" {
+		t.Fatalf("reply = %+v", reply.Params)
+	}
+	if len(api.requests("editMessageCaption")) != 0 {
+		t.Fatal("the caption of a forward is edited")
+	}
+}
+
+func TestFailedTranscriptionKeepsQuestion(t *testing.T) {
+	app, api := newTestApp(t)
+	withVoiceFile(api)
+	transcriber := newFakeTranscriber("", errors.New("recognizer is down"))
+	close(transcriber.release)
+	app.Transcriber = transcriber
+
+	question := askWithMedia(t, app, "", voice)
+	<-transcriber.mimes
+	time.Sleep(50 * time.Millisecond)
+	if len(api.requests("copyMessage")) != 1 || len(api.requests("editMessageCaption")) != 0 {
+		t.Fatalf("requests = %+v", api.requests())
+	}
+	if header := database.GetQuestionById(int(question.ID), app.DB).Header; strings.Contains(header, "📝") {
+		t.Fatalf("header = %q", header)
+	}
+}
+
+func TestNoopTranscriberSkipsDownload(t *testing.T) {
+	app, api := newTestApp(t)
+	askWithMedia(t, app, "", voice)
+	time.Sleep(20 * time.Millisecond)
+	if len(api.requests("getFile")) != 0 {
+		t.Fatal("the voice is downloaded without a transcriber")
+	}
+}
@@ -0,0 +1,203 @@
+package bot
+
+import (
+	"strconv"
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	l "telegram-bot-feedback/internal/pkg/logger"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+)
+
+// TriageAction is an emoji button of the Question message defined in the configuration
+//
+// Example: {"emoji": "👀", "status": "investigating", "text": "We are looking into {{ticket}}", "terminal": false}
+type TriageAction struct {
+	Emoji    string `mapstructure:"emoji"`
+	Status   string `mapstructure:"status"`
+	Text     string `mapstructure:"text"`     // notification to the user, {{user}} and {{ticket}} are filled, empty for none
+	Terminal bool   `mapstructure:"terminal"` // the status closes the Question
+}
+
+// defaultTriage are the emoji buttons used when "triage" is not set
+var defaultTriage = []TriageAction{
+	{Emoji: "👍", Status: "acknowledged", Text: "We have received your ticket {{ticket}} and will look into it"},
+	{Emoji: "👀", Status: "investigating", Text: "We are investigating your ticket {{ticket}}"},
+	{Emoji: "✅", Status: "resolved", Text: "Your ticket {{ticket}} has been resolved", Terminal: true},
+	{Emoji: "❌", Status: "won't fix", Text: "Your ticket {{ticket}} is closed without a fix, thank you for the feedback", Terminal: true},
+}
+
+// maxTriageStatus is the longest status in bytes, the status is a part of the callback data limited to 64 bytes
+const maxTriageStatus = 40
+
+// triageActions returns the emoji buttons from the configuration, an empty "triage" list turns them off
+//
+// An action whose status can't be put in the callback data is skipped
+func triageActions(app *App) []TriageAction {
+	if !app.Conf.IsSet("triage") {
+		return defaultTriage
+	}
+	var actions []TriageAction
+	err := app.Conf.UnmarshalKey("triage", &actions)
+	if err != nil {
+		l.Error(l.Err(err))
+		return defaultTriage
+	}
+	valid := actions[:0]
+	for _, action := range actions {
+		if action.Status == "" || strings.Contains(action.Status, "-") || len(action.Status) > maxTriageStatus {
+			l.Error(l.WithFields(l.NewError("Triage status must be 1-40 bytes without \"-\""), "status", action.Status))
+			continue
+		}
+		valid = append(valid, action)
+	}
+	return valid
+}
+
+// findTriageAction returns the action of the status, nil if there is none
+func findTriageAction(status string, actions []TriageAction) *TriageAction {
+	if status == "" {
+		return nil
+	}
+	for i := range actions {
+		if actions[i].Status == status {
+			return &actions[i]
+		}
+	}
+	return nil
+}
+
+// triageRow returns the emoji buttons of the Question, the current status is marked
+func triageRow(question *database.Question, actions []TriageAction) []tg.InlineKeyboardButton {
+	data := strconv.Itoa(CBTriage) + "-" + strconv.Itoa(int(question.ID)) + "."
+	var row []tg.InlineKeyboardButton
+	for _, action := range actions {
+		label := action.Emoji
+		if action.Status == question.TriageStatus {
+			label = "• " + label
+		}
+		row = append(row, tg.NewInlineKeyboardButtonData(label, data+action.Status))
+	}
+	return row
+}
+
+// triageLine returns the final status of the Question and who chose it
+func triageLine(question *database.Question, action *TriageAction, app *App) string {
+	line := strings.TrimSpace(action.Emoji + " " + action.Status)
+	if user := database.GetUserById(question.TriageBy, app.DB); user != nil {
+		line += " · " + profileName(user)
+	}
+	return line
+}
+
+// triage sets the status of the emoji button and notifies the user
+//
+// Format of data: <Question ID>.<status>, the status line has no status.
+// A repeated press changes nothing. When two employees press at once the later status wins
+// and the employee whose status was replaced gets an alert, a final status can't be replaced
+func triage(data string, user *database.User, callback *tg.CallbackQuery, app *App) error {
+	idText, status, _ := strings.Cut(data, ".")
+	id, err := strconv.Atoi(idText)
+	if err != nil {
+		return l.Err(answerCallback(callback, app))
+	}
+	actions := triageActions(app)
+	action := findTriageAction(status, actions)
+	question := database.GetQuestionById(id, app.DB)
+	if action == nil || question == nil {
+		return l.Err(answerCallback(callback, app))
+	}
+	for {
+		current := findTriageAction(question.TriageStatus, actions)
+		switch {
+		case question.TriageStatus == action.Status:
+			updateTriageKeyboard(question, callback, app)
+			return l.Err(answerCallback(callback, app))
+		case current != nil && current.Terminal:
+			updateTriageKeyboard(question, callback, app)
+			_, err := app.Bot.Request(tg.NewCallbackWithAlert(callback.ID, "Question #"+idText+" is already "+triageLine(question, current, app)))
+			return l.Err(err)
+		case question.IsClosed:
+			_, err := app.Bot.Request(tg.NewCallbackWithAlert(callback.ID, "Question #"+idText+" is closed"))
+			return l.Err(err)
+		}
+		changed, err := database.ChangeQuestionTriage(action.Status, question.TriageStatus, int(user.ID), question, app.DB)
+		if err != nil {
+			return l.Err(err)
+		}
+		if changed {
+			break
+		}
+		// Another employee has changed the status, check it again
+		question = database.GetQuestionById(id, app.DB)
+		if question == nil {
+			return l.Err(answerCallback(callback, app))
+		}
+	}
+	if action.Terminal {
+		err = finishTriage(question, app)
+		if err != nil {
+			return l.Err(err)
+		}
+	}
+	if action.Text != "" {
+		notice := tg.NewMessage(question.User.ChatID, expandTemplate(action.Text, question))
+		if action.Terminal {
+			notice.ReplyMarkup = userMainKeyboard(&question.User, app)
+		}
+		err = sendNotice(&question.User, notice, id, app.hooks)
+		if err != nil {
+			l.Error(l.Err(err))
+		}
+	}
+	// The status could be replaced by another employee while the user was notified
+	if latest := database.GetQuestionById(id, app.DB); latest != nil && latest.TriageStatus != action.Status {
+		question = latest
+	}
+	updateTriageKeyboard(question, callback, app)
+	if question.TriageStatus != action.Status {
+		line := question.TriageStatus
+		if current := findTriageAction(line, actions); current != nil {
+			line = triageLine(question, current, app)
+		}
+		_, err = app.Bot.Request(tg.NewCallbackWithAlert(callback.ID, "Question #"+idText+" is changed to "+line+" at the same time"))
+		return l.Err(err)
+	}
+	return l.Err(answerCallback(callback, app))
+}
+
+// finishTriage closes the Question of the final status and returns the user and the answerer to the main menu
+func finishTriage(question *database.Question, app *App) error {
+	err := closeQuestion(question, app)
+	if err != nil {
+		return l.Err(err)
+	}
+	asker := &question.User
+	if asker.State == SQuestionDiscussion {
+		err = database.ChangeUserState(SMain, asker, app.DB)
+		if err != nil {
+			return l.Err(err)
+		}
+	}
+	answerer := &question.Answerer
+	if answerer.ID == 0 || answerer.State != SQuestionDiscussion || database.GetOpenQuestionByAnswerer(answerer, app.DB) != nil {
+		return nil
+	}
+	err = database.ChangeUserState(SMain, answerer, app.DB)
+	if err != nil {
+		return l.Err(err)
+	}
+	return l.Err(responser(answerer, app))
+}
+
+// updateTriageKeyboard shows the status of the Question on the pressed message
+func updateTriageKeyboard(question *database.Question, callback *tg.CallbackQuery, app *App) {
+	chat := callback.Message.Chat
+	pinned := false
+	if link := database.GetMessageLink(chat.ID, callback.Message.MessageID, app.DB); link != nil {
+		pinned = link.IsPinned
+	}
+	_, err := app.Bot.Send(tg.NewEditMessageReplyMarkup(chat.ID, callback.Message.MessageID, questionKeyboard(question, pinned, app)))
+	if err != nil && !tg.IsMessageNotModified(err) {
+		l.Error(l.Err(err))
+	}
+}
@@ -0,0 +1,257 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"telegram-bot-feedback/internal/pkg/database"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+	"testing"
+	"time"
+)
+
+// triageQuestion returns the Question of user 1 with the emoji buttons
+func triageQuestion(t *testing.T, app *App) *database.Question {
+	user, err := database.AddUser(1, "user1", SMain, app.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	question, err := database.AddQuestion("It crashes", 5, user, app.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return question
+}
+
+// pressTriage presses the emoji button of the status on the Question message of the admin chat
+func pressTriage(t *testing.T, callbackID, status string, question *database.Question, app *App) {
+	for _, button := range triageRow(question, triageActions(app)) {
+		if !strings.HasSuffix(*button.CallbackData, "."+status) {
+			continue
+		}
+		callback := &tg.CallbackQuery{
+			ID:      callbackID,
+			From:    &tg.User{ID: 2},
+			Message: &tg.Message{MessageID: 50, Chat: &tg.Chat{ID: 2, Type: "private"}},
+			Data:    *button.CallbackData,
+		}
+		if err := parseCallback(callback, app); err != nil {
+			t.Error(err)
+		}
+		return
+	}
+	t.Fatalf("no button of %q", status)
+}
+
+func TestTriageCallbackData(t *testing.T) {
+	app, _ := newTestApp(t)
+	question := &database.Question{}
+	question.ID = 1<<63 - 1
+	actions := triageActions(app)
+	for i, button := range triageRow(question, actions) {
+		data := *button.CallbackData
+		if len(data) > 64 {
+			t.Errorf("%q is longer than 64 bytes", data)
+		}
+		key, rest := splitCallbackData(&tg.CallbackQuery{Data: data})
+		_, status, _ := strings.Cut(rest, ".")
+		if key != CBTriage || status != actions[i].Status {
+			t.Errorf("%q is split into %d %q", data, key, rest)
+		}
+	}
+
+	long := strings.Repeat("s", maxTriageStatus)
+	app.Conf.Set("triage", []map[string]interface{}{
+		{"emoji": "1", "status": "follow-up"},
+		{"emoji": "2", "status": long + "s"},
+		{"emoji": "3", "status": ""},
+		{"emoji": "4", "status": long},
+	})
+	actions = triageActions(app)
+	if len(actions) != 1 || actions[0].Status != long {
+		t.Fatalf("actions = %+v, want only the status of %d bytes", actions, maxTriageStatus)
+	}
+	if data := *triageRow(question, actions)[0].CallbackData; len(data) > 64 {
+		t.Fatalf("%q is longer than 64 bytes", data)
+	}
+}
+
+func TestTriageTransitions(t *testing.T) {
+	tests := []struct {
+		name    string
+		presses []string
+		status  string
+		closed  bool
+		notices int
+		alerts  int
+	}{
+		{"acknowledge", []string{"acknowledged"}, "acknowledged", false, 1, 0},
+		{"double tap", []string{"acknowledged", "acknowledged"}, "acknowledged", false, 1, 0},
+		{"change", []string{"acknowledged", "investigating"}, "investigating", false, 2, 0},
+		{"resolve", []string{"investigating", "resolved"}, "resolved", true, 2, 0},
+		{"double tap on final", []string{"won't fix", "won't fix"}, "won't fix", true, 1, 0},
+		{"change after final", []string{"resolved", "investigating"}, "resolved", true, 1, 1},
+		{"final after final", []string{"resolved", "won't fix"}, "resolved", true, 1, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app, api := newTestApp(t)
+			question := triageQuestion(t, app)
+			for i, status := range test.presses {
+				pressTriage(t, fmt.Sprint(i), status, question, app)
+			}
+			question = database.GetQuestionById(int(question.ID), app.DB)
+			if question.TriageStatus != test.status || question.IsClosed != test.closed {
+				t.Fatalf("status = %q, closed = %v, want %q, %v", question.TriageStatus, question.IsClosed, test.status, test.closed)
+			}
+			if employee := database.GetUserByChatID(2, app.DB); question.TriageBy != int(employee.ID) {
+				t.Fatalf("triage by %d, want the employee %d", question.TriageBy, employee.ID)
+			}
+			if notices := api.sentTo(1); len(notices) != test.notices {
+				t.Fatalf("notices = %q, want %d", notices, test.notices)
+			}
+			alerts := 0
+			for i := range test.presses {
+				answers := callbackAnswers(api)[fmt.Sprint(i)]
+				if len(answers) != 1 {
+					t.Fatalf("press %d is answered %d times", i, len(answers))
+				}
+				if strings.HasPrefix(answers[0], "!") {
+					alerts++
+				}
+			}
+			if alerts != test.alerts {
+				t.Fatalf("alerts = %d, want %d", alerts, test.alerts)
+			}
+			edits := api.requests("editMessageReplyMarkup")
+			rows, _ := edits[len(edits)-1].Params["reply_markup"].(map[string]interface{})["inline_keyboard"].([]interface{})
+			if test.closed != (len(rows) == 1) {
+				t.Fatalf("keyboard has %d rows, the question is closed: %v", len(rows), test.closed)
+			}
+		})
+	}
+}
+
+func TestTriageOverwrittenPressIsAlerted(t *testing.T) {
+	app, api := newTestApp(t)
+	question := triageQuestion(t, app)
+	// Another employee chooses a status while the user is notified about the first one
+	api.onRequest = func(call apiCall) {
+		if call.Method == "sendMessage" && call.chatID() == 1 {
+			other := database.GetQuestionById(int(question.ID), app.DB)
+			if _, err := database.ChangeQuestionTriage("investigating", other.TriageStatus, 3, other, app.DB); err != nil {
+				t.Error(err)
+			}
+		}
+	}
+	pressTriage(t, "first", "acknowledged", question, app)
+	answers := callbackAnswers(api)["first"]
+	if len(answers) != 1 || !strings.HasPrefix(answers[0], "!") || !strings.Contains(answers[0], "investigating") {
+		t.Fatalf("answers = %q, want an alert with the new status", answers)
+	}
+	if status := database.GetQuestionById(int(question.ID), app.DB).TriageStatus; status != "investigating" {
+		t.Fatalf("status = %q, the later status wins", status)
+	}
+}
+
+func TestTriageConcurrentPresses(t *testing.T) {
+	app, api := newTestApp(t)
+	var actions []map[string]interface{}
+	for i := 0; i < 6; i++ {
+		actions = append(actions, map[string]interface{}{"emoji": fmt.Sprint(i), "status": fmt.Sprint("status ", i), "text": "{{ticket}}"})
+	}
+	app.Conf.Set("triage", actions)
+	question := triageQuestion(t, app)
+	var wg sync.WaitGroup
+	for i := range actions {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			pressTriage(t, fmt.Sprint(i), fmt.Sprint("status ", i), question, app)
+		}(i)
+	}
+	wg.Wait()
+	final := database.GetQuestionById(int(question.ID), app.DB).TriageStatus
+	answers := callbackAnswers(api)
+	for i := range actions {
+		id := fmt.Sprint(i)
+		if len(answers[id]) != 1 {
+			t.Fatalf("press %d is answered %d times", i, len(answers[id]))
+		}
+		if fmt.Sprint("status ", i) == final && strings.HasPrefix(answers[id][0], "!") {
+			t.Fatalf("the press of the final status %q is alerted: %q", final, answers[id][0])
+		}
+	}
+	if !strings.HasPrefix(final, "status ") {
+		t.Fatalf("status = %q, want one of the pressed", final)
+	}
+}
+
+func TestTriageConfiguredActions(t *testing.T) {
+	app, api := newTestApp(t)
+	app.Conf.Set("triage", []map[string]interface{}{
+		{"emoji": "🔥", "status": "urgent", "text": "{{user}}, {{ticket}} is urgent"},
+		{"emoji": "🗑", "status": "spam", "terminal": true},
+	})
+	question := triageQuestion(t, app)
+	row := triageRow(question, triageActions(app))
+	if len(row) != 2 || row[0].Text != "🔥" || row[1].Text != "🗑" {
+		t.Fatalf("row = %+v", row)
+	}
+
+	pressTriage(t, "urgent", "urgent", question, app)
+	if notices := api.sentTo(1); len(notices) != 1 || notices[0] != "@user1, "+ticketNumber(question)+" is urgent" {
+		t.Fatalf("notices = %q", notices)
+	}
+	question = database.GetQuestionById(int(question.ID), app.DB)
+	if row := triageRow(question, triageActions(app)); row[0].Text != "• 🔥" {
+		t.Fatalf("row = %+v, want the status marked", row)
+	}
+
+	pressTriage(t, "spam", "spam", question, app)
+	if notices := api.sentTo(1); len(notices) != 1 {
+		t.Fatalf("notices = %q, want none for the action without text", notices)
+	}
+	question = database.GetQuestionById(int(question.ID), app.DB)
+	markup := questionKeyboard(question, false, app)
+	want := "🗑 spam · " + profileName(database.GetUserByChatID(2, app.DB))
+	if len(markup.InlineKeyboard) != 1 || len(markup.InlineKeyboard[0]) != 1 || markup.InlineKeyboard[0][0].Text != want {
+		t.Fatalf("keyboard = %+v, want the status line %q", markup.InlineKeyboard, want)
+	}
+
+	// The status line has no status, pressing it changes nothing
+	callback := &tg.CallbackQuery{ID: "line", From: &tg.User{ID: 2}, Message: &tg.Message{MessageID: 50, Chat: &tg.Chat{ID: 2, Type: "private"}},
+		Data: *markup.InlineKeyboard[0][0].CallbackData}
+	if err := parseCallback(callback, app); err != nil {
+		t.Fatal(err)
+	}
+	if answers := callbackAnswers(api)["line"]; len(answers) != 1 || answers[0] != "" {
+		t.Fatalf("answers = %q", answers)
+	}
+	if status := database.GetQuestionById(int(question.ID), app.DB).TriageStatus; status != "spam" {
+		t.Fatalf("status = %q", status)
+	}
+}
+
+func TestTriageTurnedOff(t *testing.T) {
+	app, _ := newTestApp(t)
+	app.Conf.Set("triage", []map[string]interface{}{})
+	question := triageQuestion(t, app)
+	if markup := questionKeyboard(question, false, app); len(markup.InlineKeyboard) != 1 || len(markup.InlineKeyboard[0]) != 2 {
+		t.Fatalf("keyboard = %+v, want only the take and pin buttons", markup.InlineKeyboard)
+	}
+}
+
+func TestTriageNoticeWaitsForQuietHours(t *testing.T) {
+	app, api := newTestApp(t)
+	quietAt(t, app, 23, 0)
+	question := triageQuestion(t, app)
+	pressTriage(t, "ack", "acknowledged", question, app)
+	pressTriage(t, "look", "investigating", question, app)
+	if len(api.sentTo(1)) != 0 || database.CountQuietMessages(app.DB) != 1 {
+		t.Fatalf("sent = %q, %d held, want one collapsed notice held", api.sentTo(1), database.CountQuietMessages(app.DB))
+	}
+	if due := database.GetDueQuietMessages(time.Date(2026, 10, 18, 7, 0, 0, 0, time.UTC), app.DB); len(due) != 1 || !strings.Contains(due[0].Payload, "We are investigating") {
+		t.Fatalf("held = %+v, want the last notice", due)
+	}
+}
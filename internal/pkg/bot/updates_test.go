@@ -0,0 +1,67 @@
+package bot
+
+import (
+	"context"
+	"reflect"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+	"testing"
+)
+
+// editsPlugin handles edited messages
+type editsPlugin struct{}
+
+func (editsPlugin) Name() string            { return "edits" }
+func (editsPlugin) Init(hooks *Hooks) error { return nil }
+func (editsPlugin) UpdateTypes() []string {
+	return []string{tg.UpdateTypeMessage, tg.UpdateTypeEditedMessage}
+}
+
+func TestAllowedUpdates(t *testing.T) {
+	app, _ := newTestApp(t)
+	base := []string{"message", "callback_query", "poll_answer", "my_chat_member"}
+	if got := app.allowedUpdates(); !reflect.DeepEqual(got, base) {
+		t.Fatalf("allowed updates = %q", got)
+	}
+	enablePlugins(app, "tickets", "donations")
+	if got := app.allowedUpdates(); !reflect.DeepEqual(got, append(base, "pre_checkout_query")) {
+		t.Fatalf("allowed updates with donations = %q", got)
+	}
+	app.plugins = append(app.plugins, editsPlugin{})
+	if got := app.allowedUpdates(); !reflect.DeepEqual(got, append(base, "pre_checkout_query", "edited_message")) {
+		t.Fatalf("allowed updates with the edits plugin = %q, want the new type once", got)
+	}
+	enablePlugins(app, "tickets")
+	if got := app.allowedUpdates(); !reflect.DeepEqual(got, base) {
+		t.Fatalf("allowed updates after disabling donations = %q", got)
+	}
+
+	app.Conf.Set("allowed_updates", []string{"message", "edited_message"})
+	if got := app.allowedUpdates(); !reflect.DeepEqual(got, []string{"message", "edited_message"}) {
+		t.Fatalf("allowed updates with the override = %q", got)
+	}
+}
+
+func TestPollSendsAllowedUpdates(t *testing.T) {
+	app, api := newTestApp(t)
+	api.result("getUpdates", "[]")
+	enablePlugins(app, "donations")
+	app.Bot.AllowedUpdates = app.allowedUpdates()
+	t.Cleanup(func() { app.Bot.AllowedUpdates = nil })
+	updates(context.Background(), app.Bot, 0)
+
+	app.Conf.Set("allowed_updates", []string{"message"})
+	app.Bot.AllowedUpdates = app.allowedUpdates()
+	updates(context.Background(), app.Bot, 0)
+
+	polls := api.requests("getUpdates")
+	if len(polls) != 2 {
+		t.Fatalf("polls = %+v", polls)
+	}
+	want := []interface{}{"message", "callback_query", "poll_answer", "my_chat_member", "pre_checkout_query"}
+	if got := polls[0].Params["allowed_updates"]; !reflect.DeepEqual(got, want) {
+		t.Fatalf("allowed_updates = %v, want %v", got, want)
+	}
+	if got := polls[1].Params["allowed_updates"]; !reflect.DeepEqual(got, []interface{}{"message"}) {
+		t.Fatalf("allowed_updates of the next poll = %v", got)
+	}
+}
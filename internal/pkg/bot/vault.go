@@ -0,0 +1,103 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	l "telegram-bot-feedback/internal/pkg/logger"
+	"telegram-bot-feedback/internal/pkg/vault"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+	"time"
+)
+
+// Vault settings
+const (
+	// vaultSetting is the store key of the date of the last snapshot
+	vaultSetting = "vault_last"
+	// vaultMessagesSetting is the store key of the snapshot message IDs in the vault channel, oldest first
+	vaultMessagesSetting = "vault_messages"
+)
+
+// runVault sends the encrypted snapshot to "vault_channel" every day at "vault_time"
+func runVault(ctx context.Context, app *App) {
+	if app.Conf.GetInt("vault_channel") == 0 {
+		return
+	}
+	key, err := vault.ParseKey(app.Conf.GetString("vault_key"))
+	if err != nil {
+		l.Error(err)
+		return
+	}
+	runDaily(ctx, "vault_time", vaultSetting, app, func(now time.Time) bool {
+		err := pushVault(key, app)
+		if err != nil {
+			l.Error(err)
+			return false
+		}
+		return true
+	})
+}
+
+// pushVault sends the snapshot and deletes the snapshots beyond "vault_keep"
+func pushVault(key []byte, app *App) error {
+	snapshot, err := database.TakeSnapshot(app.DB)
+	if err != nil {
+		return l.Err(err)
+	}
+	settings := snapshot.Settings[:0]
+	for _, s := range snapshot.Settings {
+		if s.Key == runningSetting || strings.HasPrefix(s.Key, findSettingPrefix) {
+			continue
+		}
+		settings = append(settings, s)
+	}
+	snapshot.Settings = settings
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return l.Err(err)
+	}
+	sealed, err := vault.Seal(data, key)
+	if err != nil {
+		return l.Err(err)
+	}
+	channel := app.Conf.GetInt("vault_channel")
+	document := tg.NewDocument(channel, tg.FileBytes{Name: "vault-" + snapshot.CreatedAt.Format(exportDateLayout) + ".bin", Bytes: sealed})
+	document.Caption = "Snapshot v" + strconv.Itoa(snapshot.Version) + ": " + strconv.Itoa(len(snapshot.Users)) + " users, " +
+		strconv.Itoa(len(snapshot.Questions)) + " open questions, " + strconv.Itoa(len(snapshot.Settings)) + " settings"
+	document.DisableNotification = true
+	sent, err := app.Bot.Send(&document)
+	if err != nil {
+		return l.Err(err)
+	}
+	ids := append(vaultMessages(app), sent.MessageID)
+	for keep := app.Conf.GetInt("vault_keep"); keep > 0 && len(ids) > keep; ids = ids[1:] {
+		_, err := app.Bot.Request(tg.NewDeleteMessage(channel, ids[0]))
+		if err != nil && !tg.IsMessageToDeleteNotFound(err) {
+			l.Error(l.Err(err))
+			break
+		}
+	}
+	return l.Err(database.SetSetting(vaultMessagesSetting, joinInts(ids), app.DB))
+}
+
+// vaultMessages returns the IDs of the snapshot messages in the vault channel
+func vaultMessages(app *App) []int {
+	var ids []int
+	for _, field := range strings.Split(database.GetSetting(vaultMessagesSetting, app.DB), ",") {
+		if id, err := strconv.Atoi(field); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// joinInts joins the numbers with commas
+func joinInts(numbers []int) string {
+	fields := make([]string, len(numbers))
+	for i, n := range numbers {
+		fields[i] = strconv.Itoa(n)
+	}
+	return strings.Join(fields, ",")
+}
@@ -0,0 +1,103 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	l "telegram-bot-feedback/internal/pkg/logger"
+	"telegram-bot-feedback/internal/pkg/vault"
+	"testing"
+)
+
+// vaultKey is the hex vault key of the tests
+const vaultKey = "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+
+// vaultChannel is the vault channel of the tests
+const vaultChannel = -1002222222222
+
+// openSnapshot decrypts the snapshot document
+func openSnapshot(t *testing.T, call apiCall, key []byte) *database.Snapshot {
+	t.Helper()
+	sealed, _ := call.Params["document"].(string)
+	data, err := vault.Open([]byte(sealed), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshot := &database.Snapshot{}
+	if err := json.Unmarshal(data, snapshot); err != nil {
+		t.Fatal(err)
+	}
+	return snapshot
+}
+
+func TestPushVault(t *testing.T) {
+	app, api := newTestApp(t)
+	app.Conf.Set("vault_channel", vaultChannel)
+	key, _ := vault.ParseKey(vaultKey)
+	askQuestion(t, app, "the app crashes")
+	for setting, value := range map[string]string{"greeting": "Hi", runningSetting: "1", findSettingPrefix + "2": "crash"} {
+		if err := database.SetSetting(setting, value, app.DB); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := pushVault(key, app); err != nil {
+		t.Fatal(err)
+	}
+	documents := api.requests("sendDocument")
+	if len(documents) != 1 || documents[0].chatID() != vaultChannel || documents[0].Params["disable_notification"] != "true" {
+		t.Fatalf("documents = %+v", documents)
+	}
+	if caption, _ := documents[0].Params["caption"].(string); caption != "Snapshot v1: 2 users, 1 open questions, 1 settings" {
+		t.Fatalf("caption = %q", caption)
+	}
+	if sealed, _ := documents[0].Params["document"].(string); strings.Contains(sealed, "the app crashes") || strings.Contains(sealed, "greeting") {
+		t.Fatal("the snapshot is not encrypted")
+	}
+	snapshot := openSnapshot(t, documents[0], key)
+	if len(snapshot.Settings) != 1 || snapshot.Settings[0].Key != "greeting" || len(snapshot.Questions) != 1 {
+		t.Fatalf("snapshot = %+v, want the open question and the greeting only", snapshot)
+	}
+}
+
+func TestVaultRotation(t *testing.T) {
+	app, api := newTestApp(t)
+	app.Conf.Set("vault_channel", vaultChannel)
+	app.Conf.Set("vault_keep", 2)
+	key, _ := vault.ParseKey(vaultKey)
+	for i := 0; i < 3; i++ {
+		if err := pushVault(key, app); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deletes := api.requests("deleteMessage")
+	if len(deletes) != 1 || deletes[0].chatID() != vaultChannel || deletes[0].Params["message_id"] != float64(101) {
+		t.Fatalf("deletes = %+v, want the oldest snapshot deleted", deletes)
+	}
+	if got := database.GetSetting(vaultMessagesSetting, app.DB); got != "102,103" {
+		t.Fatalf("kept snapshots = %q", got)
+	}
+
+	// A snapshot deleted by hand doesn't stop the rotation
+	api.fail("deleteMessage", 400, "Bad Request: message to delete not found")
+	if err := pushVault(key, app); err != nil {
+		t.Fatal(err)
+	}
+	if got := database.GetSetting(vaultMessagesSetting, app.DB); got != "103,104" {
+		t.Fatalf("kept snapshots = %q", got)
+	}
+}
+
+func TestRunVaultNeedsKey(t *testing.T) {
+	app, api := newTestApp(t)
+	runVault(context.Background(), app)
+	app.Conf.Set("vault_channel", vaultChannel)
+	app.Conf.Set("vault_key", "secret")
+	runVault(context.Background(), app)
+	if text, _ := l.LastError(); !strings.Contains(text, "The vault key must be 64 hex characters") {
+		t.Fatalf("last error = %q", text)
+	}
+	if calls := api.requests(); len(calls) != 0 {
+		t.Fatalf("requests = %+v", calls)
+	}
+}
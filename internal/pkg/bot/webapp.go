@@ -0,0 +1,147 @@
+package bot
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	l "telegram-bot-feedback/internal/pkg/logger"
+	"telegram-bot-feedback/internal/pkg/metrics"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+)
+
+// Feedback form limits
+const (
+	formMaxText        = 3000
+	formMaxAttachments = 10
+)
+
+// feedbackForm is the payload the feedback form Web App sends with Telegram.WebApp.sendData
+type feedbackForm struct {
+	Category    string   `json:"category"`
+	Text        string   `json:"text"`
+	Attachments []string `json:"attachments,omitempty"` // file IDs of the uploaded screenshots
+}
+
+// errFormNoText is returned for a form without the question text
+var errFormNoText = l.NewError("the form has no text")
+
+// parseFeedbackForm decodes and validates the form payload
+func parseFeedbackForm(data string) (*feedbackForm, error) {
+	form := feedbackForm{}
+	if err := json.Unmarshal([]byte(data), &form); err != nil {
+		return nil, l.Err(err)
+	}
+	form.Category = strings.TrimSpace(form.Category)
+	form.Text = strings.TrimSpace(form.Text)
+	if form.Text == "" {
+		return nil, errFormNoText
+	}
+	if len([]rune(form.Text)) > formMaxText {
+		return nil, l.NewError("the form text is longer than " + strconv.Itoa(formMaxText) + " characters")
+	}
+	if len(form.Attachments) > formMaxAttachments {
+		return nil, l.NewError("the form has more than " + strconv.Itoa(formMaxAttachments) + " attachments")
+	}
+	for _, id := range form.Attachments {
+		if strings.TrimSpace(id) == "" || strings.ContainsAny(id, " \n") {
+			return nil, l.NewError("the form has a malformed attachment ID")
+		}
+	}
+	return &form, nil
+}
+
+// submitFeedbackForm opens a Question from the feedback form the user sent
+//
+// A malformed form is logged as a warning and the user is asked to fill it in again
+func submitFeedbackForm(message *tg.Message, user *database.User, app *App) error {
+	form, err := parseFeedbackForm(message.WebAppData.Data)
+	if err != nil {
+		l.Warn(l.WithFields(l.NewError("Malformed feedback form: "+err.Error()), "user", user.ChatID, "button", message.WebAppData.ButtonText))
+		text := translate(user.LanguageCode, MsgFormError)
+		if err == errFormNoText {
+			text = translate(user.LanguageCode, MsgFormNoText)
+		}
+		_, err := app.Bot.Send(tg.NewMessage(user.ChatID, text))
+		return l.Err(err)
+	}
+	if question := database.GetOpenQuestionByUser(user, app.DB); question != nil {
+		_, err := app.Bot.Send(tg.NewMessage(user.ChatID, translate(user.LanguageCode, MsgFormOpenQuestion, ticketNumber(question))))
+		return l.Err(err)
+	}
+	categoryID := 0
+	if form.Category != "" {
+		if category := findCategory(form.Category, app); category != nil {
+			categoryID = int(category.ID)
+		} else {
+			l.Warn(l.WithFields(l.NewError("Unknown category in the feedback form"), "user", user.ChatID, "category", form.Category))
+		}
+	}
+	err = database.ChangeUserCategory(categoryID, user, app.DB)
+	if err != nil {
+		return l.Err(err)
+	}
+	question, err := database.AddQuestion(form.Text, message.MessageID, user, app.DB)
+	if err != nil {
+		return l.Err(err)
+	}
+	if categoryID != 0 {
+		err = database.ChangeUserCategory(0, user, app.DB)
+		if err != nil {
+			return l.Err(err)
+		}
+	}
+	metrics.Submissions.Inc("question")
+	app.emit(Event{Type: EventQuestionOpened, Question: question})
+	formMessage := *message
+	formMessage.Text = form.Text
+	formMessage.WebAppData = nil
+	delivered := sendNewQuestion(question, &formMessage, app)
+	sendFormAttachments(question, form.Attachments, app)
+	notifyQuestion(delivered, question, user, app)
+	err = database.ChangeUserState(SQuestionDiscussion, user, app.DB)
+	if err != nil {
+		return l.Err(err)
+	}
+	ack := tg.NewMessage(user.ChatID, translate(user.LanguageCode, MsgQuestionThanks, ticketNumber(question)))
+	ack.ReplyMarkup = newReplyKeyboardMarkup(buttons(UserClose)...)
+	_, err = app.Bot.Send(ack)
+	return l.Err(err)
+}
+
+// findCategory returns the Category by name ignoring case, nil if there is none
+func findCategory(name string, app *App) *database.Category {
+	for _, category := range database.GetCategories(app.DB) {
+		if strings.EqualFold(category.Name, name) {
+			return &category
+		}
+	}
+	return nil
+}
+
+// sendFormAttachments sends the screenshots of the form to the recipients of the new Question
+func sendFormAttachments(question *database.Question, attachments []string, app *App) {
+	for _, recipient := range questionRecipients(app) {
+		for i, id := range attachments {
+			photo := tg.NewPhoto(recipient.ChatID, tg.FileID(id))
+			photo.Caption = "Question #" + strconv.Itoa(int(question.ID)) + ", attachment " + strconv.Itoa(i+1) + "/" + strconv.Itoa(len(attachments))
+			sent, err := app.Bot.Send(photo)
+			if err != nil {
+				l.Error(l.Err(err))
+				continue
+			}
+			sent.Chat = &tg.Chat{ID: recipient.ChatID}
+			addMessageLink(sent, question, app)
+		}
+	}
+}
+
+// userMainKeyboard returns the main user keyboard, with the feedback form button if "webapp_form_url" is set
+func userMainKeyboard(user *database.User, app *App) tg.ReplyKeyboardMarkup {
+	markup := newReplyKeyboardMarkup(buttons(UserMain)...)
+	url := app.Conf.GetString("webapp_form_url")
+	if url == "" {
+		return markup
+	}
+	return tg.NewWebAppReplyKeyboard(translate(user.LanguageCode, MsgFormButton), url, markup.Keyboard...)
+}
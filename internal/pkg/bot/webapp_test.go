@@ -0,0 +1,165 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+	"testing"
+)
+
+// formMessage returns the message with the feedback form payload of user 1
+func formMessage(data string) *tg.Message {
+	message := privateMessage(1, 30, "")
+	message.WebAppData = &tg.WebAppData{Data: data, ButtonText: "📝Feedback form"}
+	return message
+}
+
+// formUser adds user 1 on the main keyboard
+func formUser(t *testing.T, app *App) *database.User {
+	user, err := database.AddUser(1, "user1", SMain, app.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func TestParseFeedbackForm(t *testing.T) {
+	tests := []struct {
+		data string
+		want *feedbackForm
+		err  string
+	}{
+		{`{"category":" Billing ","text":" charged twice ","attachments":["AgAD1","AgAD2"]}`,
+			&feedbackForm{Category: "Billing", Text: "charged twice", Attachments: []string{"AgAD1", "AgAD2"}}, ""},
+		{`{"text":"only text"}`, &feedbackForm{Text: "only text"}, ""},
+		{`{"category":"Billing","text":"  "}`, nil, "the form has no text"},
+		{`{"category":"Billing"}`, nil, "the form has no text"},
+		{`{"text":"` + strings.Repeat("я", formMaxText+1) + `"}`, nil, "longer than 3000"},
+		{`{"text":"hi","attachments":["` + strings.Repeat(`a","`, formMaxAttachments) + `a"]}`, nil, "more than 10 attachments"},
+		{`{"text":"hi","attachments":["a b"]}`, nil, "malformed attachment"},
+		{`{"text":"hi","attachments":[""]}`, nil, "malformed attachment"},
+		{`{"text":42}`, nil, "cannot unmarshal"},
+		{`not json`, nil, "invalid character"},
+		{``, nil, "unexpected end"},
+	}
+	for _, tt := range tests {
+		form, err := parseFeedbackForm(tt.data)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%.40s: err = %v, want %q", tt.data, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || fmt.Sprint(form) != fmt.Sprint(tt.want) {
+			t.Errorf("%.40s: form = %+v, %v, want %+v", tt.data, form, err, tt.want)
+		}
+	}
+}
+
+func TestFeedbackFormOpensQuestion(t *testing.T) {
+	app, api := newTestApp(t)
+	category, err := database.SetCategory("💳", "Billing", app.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := formUser(t, app)
+	parseMessage(formMessage(`{"category":"billing","text":"I was charged twice","attachments":["AgAD1","AgAD2"]}`), app)
+
+	question := database.GetOpenQuestionByUser(user, app.DB)
+	if question == nil || question.Header != "I was charged twice" || question.CategoryID != int(category.ID) {
+		t.Fatalf("question = %+v", question)
+	}
+	if user := database.GetUserByChatID(1, app.DB); user.State != SQuestionDiscussion || user.CategoryID != 0 {
+		t.Fatalf("user = %+v, want the discussion without a chosen category", user)
+	}
+	if got := lastSent(api, 2); !strings.Contains(got, "I was charged twice") {
+		t.Fatalf("question sent to the admin = %q", got)
+	}
+	photos := api.requests("sendPhoto")
+	if len(photos) != 2 || photos[0].chatID() != 2 || photos[1].Params["photo"] != "AgAD2" {
+		t.Fatalf("photos = %+v", photos)
+	}
+	if caption := photos[1].Params["caption"]; caption != fmt.Sprintf("Question #%d, attachment 2/2", question.ID) {
+		t.Fatalf("caption = %q", caption)
+	}
+	if got, want := lastSent(api, 1), translate("en", MsgQuestionThanks, ticketNumber(question)); got != want {
+		t.Fatalf("ack = %q, want %q", got, want)
+	}
+	messages := api.requests("sendMessage")
+	if markup := fmt.Sprint(messages[len(messages)-1].Params["reply_markup"]); !strings.Contains(markup, "❌Close") {
+		t.Fatalf("ack keyboard = %s", markup)
+	}
+
+	parseMessage(formMessage(`{"text":"one more"}`), app)
+	if got := lastSent(api, 1); got != fmt.Sprintf("You already have an open ticket %s, please continue it here", ticketNumber(question)) {
+		t.Fatalf("second form = %q", got)
+	}
+}
+
+func TestPartialFeedbackForm(t *testing.T) {
+	app, api := newTestApp(t)
+	user := formUser(t, app)
+	parseMessage(formMessage(`{"category":"Unknown","text":"the app crashes"}`), app)
+	question := database.GetOpenQuestionByUser(user, app.DB)
+	if question == nil || question.CategoryID != 0 {
+		t.Fatalf("question = %+v, want it without a category", question)
+	}
+	if len(api.requests("sendPhoto")) != 0 {
+		t.Fatal("photos are sent without attachments")
+	}
+}
+
+func TestMalformedFeedbackForm(t *testing.T) {
+	tests := []struct {
+		data, want string
+	}{
+		{`{"category":"Billing"`, "Sorry, we couldn't read the form. Please fill it in again"},
+		{`{"category":"Billing","text":""}`, "Please describe your question in the form"},
+		{`{"text":"hi","attachments":"AgAD1"}`, "Sorry, we couldn't read the form. Please fill it in again"},
+	}
+	for _, tt := range tests {
+		app, api := newTestApp(t)
+		user := formUser(t, app)
+		if err := parseMessage(formMessage(tt.data), app); err != nil {
+			t.Fatalf("%s: err = %v", tt.data, err)
+		}
+		if got := lastSent(api, 1); got != tt.want {
+			t.Errorf("%s: reply = %q, want %q", tt.data, got, tt.want)
+		}
+		if database.GetOpenQuestionByUser(user, app.DB) != nil || len(api.sentTo(2)) != 0 {
+			t.Errorf("%s: a malformed form opens a question", tt.data)
+		}
+	}
+
+	app, api := newTestApp(t)
+	formUser(t, app)
+	message := formMessage(`[]`)
+	message.From.LanguageCode = "ru"
+	if err := parseUpdate(&tg.Update{UpdateID: 1, Message: message}, app); err != nil {
+		t.Fatal(err)
+	}
+	if got := lastSent(api, 1); got != "Извините, не удалось прочитать форму. Пожалуйста, заполните её ещё раз" {
+		t.Fatalf("reply in Russian = %q", got)
+	}
+}
+
+func TestUserMainKeyboardHasFormButton(t *testing.T) {
+	app, _ := newTestApp(t)
+	user := &database.User{ChatID: 1, LanguageCode: "ru"}
+	if markup := userMainKeyboard(user, app); len(markup.Keyboard) != 2 {
+		t.Fatalf("keyboard without the form URL = %+v", markup.Keyboard)
+	}
+	app.Conf.Set("webapp_form_url", "https://forms.example.com/feedback")
+	markup := userMainKeyboard(user, app)
+	if len(markup.Keyboard) != 3 || len(markup.Keyboard[2]) != 1 {
+		t.Fatalf("keyboard = %+v, want the form button below the main buttons", markup.Keyboard)
+	}
+	button := markup.Keyboard[2][0]
+	if button.Text != "📝Форма обратной связи" || button.WebApp == nil || button.WebApp.URL != "https://forms.example.com/feedback" {
+		t.Fatalf("form button = %+v", button)
+	}
+	if markup.Keyboard[0][0].Text != "⭐Review" || markup.Keyboard[1][0].Text != "❓Question" || !markup.ResizeKeyboard {
+		t.Fatalf("main buttons = %+v", markup)
+	}
+}
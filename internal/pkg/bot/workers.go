@@ -0,0 +1,168 @@
+package bot
+
+import (
+	"context"
+	"hash/fnv"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	l "telegram-bot-feedback/internal/pkg/logger"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+)
+
+// workerPool handles Updates concurrently
+//
+// The Updates of a chat always go to the same worker in the order they were submitted,
+// so the messages of a user are never handled out of order while other chats go in parallel
+type workerPool struct {
+	queues  []chan tg.Update
+	handle  func(update *tg.Update) error
+	commit  func(offset int)
+	wg      sync.WaitGroup
+	depth   atomic.Int64
+	offsets offsetTracker
+}
+
+// newWorkerPool starts the workers, each with a queue of queueSize Updates
+//
+// commit is called with the offset of the next Update once all Updates before it are handled
+func newWorkerPool(workers, queueSize int, handle func(update *tg.Update) error, commit func(offset int)) *workerPool {
+	if workers < 1 {
+		workers = 1
+	}
+	if queueSize < 1 {
+		queueSize = 1
+	}
+	p := &workerPool{handle: handle, commit: commit, offsets: offsetTracker{done: map[int]bool{}}}
+	for i := 0; i < workers; i++ {
+		queue := make(chan tg.Update, queueSize)
+		p.queues = append(p.queues, queue)
+		p.wg.Add(1)
+		go p.work(queue)
+	}
+	return p
+}
+
+// submit queues the Update to the worker of its chat
+//
+// It blocks while the queue is full, so a busy pool holds the poll loop back.
+// Returns false if ctx is done first, the Update is not queued then
+func (p *workerPool) submit(ctx context.Context, update tg.Update) bool {
+	p.offsets.add(update.UpdateID)
+	p.depth.Add(1)
+	select {
+	case p.queues[p.worker(&update)] <- update:
+		return true
+	case <-ctx.Done():
+		p.depth.Add(-1)
+		p.offsets.remove(update.UpdateID)
+		return false
+	}
+}
+
+// close stops accepting Updates and waits until the queued ones are handled
+func (p *workerPool) close() {
+	for _, queue := range p.queues {
+		close(queue)
+	}
+	p.wg.Wait()
+}
+
+// queued returns the number of Updates waiting for a worker or being handled
+func (p *workerPool) queued() int {
+	return int(p.depth.Load())
+}
+
+// worker returns the worker of the Update chat, Updates without a chat go to the first one
+func (p *workerPool) worker(update *tg.Update) int {
+	var chatID int
+	if chat := update.FromChat(); chat != nil {
+		chatID = chat.ID
+	} else if from := update.SentFrom(); from != nil {
+		chatID = from.ID
+	}
+	if chatID == 0 {
+		return 0
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte(strconv.Itoa(chatID)))
+	return int(hash.Sum32() % uint32(len(p.queues)))
+}
+
+// work handles the Updates of the queue until it is closed
+func (p *workerPool) work(queue chan tg.Update) {
+	defer p.wg.Done()
+	for update := range queue {
+		if err := p.handle(&update); err != nil {
+			l.Error(l.WithFields(l.Err(err), "update", update.UpdateID))
+		}
+		p.depth.Add(-1)
+		p.offsets.finish(update.UpdateID, p.commit)
+	}
+}
+
+// offsetTracker finds the offset below which all submitted Updates are handled
+type offsetTracker struct {
+	mu      sync.Mutex
+	pending []int // submitted Update IDs in order
+	done    map[int]bool
+}
+
+// add registers the submitted Update
+func (t *offsetTracker) add(id int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pending = append(t.pending, id)
+}
+
+// remove forgets the Update that was not queued, it is the last one submitted
+func (t *offsetTracker) remove(id int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if n := len(t.pending); n > 0 && t.pending[n-1] == id {
+		t.pending = t.pending[:n-1]
+	}
+}
+
+// finish marks the Update handled and commits the offset if it moved
+//
+// commit runs under the lock, so offsets are committed in increasing order
+func (t *offsetTracker) finish(id int, commit func(offset int)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.done[id] = true
+	offset := 0
+	for len(t.pending) > 0 && t.done[t.pending[0]] {
+		delete(t.done, t.pending[0])
+		offset = t.pending[0] + 1
+		t.pending = t.pending[1:]
+	}
+	if offset != 0 && commit != nil {
+		commit(offset)
+	}
+}
+
+// chatLocks serializes the message sequences sent to a chat
+//
+// Workers handle different users in parallel, so without it the header of one Question
+// and the attachment of another could interleave in an employee chat. The zero value is ready to use
+type chatLocks struct {
+	mu    sync.Mutex
+	locks map[int]*sync.Mutex
+}
+
+// lock locks the chat and returns the function unlocking it
+func (c *chatLocks) lock(chatID int) func() {
+	c.mu.Lock()
+	if c.locks == nil {
+		c.locks = map[int]*sync.Mutex{}
+	}
+	lock, ok := c.locks[chatID]
+	if !ok {
+		lock = &sync.Mutex{}
+		c.locks[chatID] = lock
+	}
+	c.mu.Unlock()
+	lock.Lock()
+	return lock.Unlock
+}
@@ -0,0 +1,132 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"telegram-bot-feedback/internal/pkg/database"
+	tg "telegram-bot-feedback/pkg/telegram-bot-api"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// chatUpdate returns the message Update of the chat
+func chatUpdate(id, chatID int) tg.Update {
+	return tg.Update{UpdateID: id, Message: &tg.Message{MessageID: id, Chat: &tg.Chat{ID: chatID}}}
+}
+
+func TestWorkerPoolKeepsChatOrder(t *testing.T) {
+	var mu sync.Mutex
+	var handled []int
+	pool := newWorkerPool(4, 10, func(update *tg.Update) error {
+		if update.UpdateID%3 == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		mu.Lock()
+		handled = append(handled, update.UpdateID)
+		mu.Unlock()
+		return nil
+	}, nil)
+	for id := 1; id <= 50; id++ {
+		if !pool.submit(context.Background(), chatUpdate(id, 42)) {
+			t.Fatal("update is not queued")
+		}
+	}
+	pool.close()
+	if len(handled) != 50 {
+		t.Fatalf("handled %d updates, want 50", len(handled))
+	}
+	for i, id := range handled {
+		if id != i+1 {
+			t.Fatalf("update %d handled at position %d: %v", id, i, handled)
+		}
+	}
+}
+
+func TestWorkerPoolRunsChatsInParallel(t *testing.T) {
+	release := make(chan struct{})
+	other := make(chan int, 1)
+	pool := newWorkerPool(2, 10, func(update *tg.Update) error {
+		if update.Message.Chat.ID == 1 {
+			<-release
+			return nil
+		}
+		other <- update.Message.Chat.ID
+		return nil
+	}, nil)
+	defer pool.close()
+	blocked := chatUpdate(1, 1)
+	chatID := 2
+	for u := chatUpdate(2, chatID); pool.worker(&u) == pool.worker(&blocked); u = chatUpdate(2, chatID) {
+		chatID++
+	}
+	pool.submit(context.Background(), blocked)
+	pool.submit(context.Background(), chatUpdate(2, chatID))
+	select {
+	case got := <-other:
+		if got != chatID {
+			t.Fatalf("handled chat %d, want %d", got, chatID)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("a slow chat holds back another chat")
+	}
+	close(release)
+}
+
+func TestWorkerPoolHandlesFailingUpdateOnce(t *testing.T) {
+	var calls atomic.Int32
+	var committed []int
+	pool := newWorkerPool(1, 10, func(update *tg.Update) error {
+		calls.Add(1)
+		return errors.New("failed")
+	}, func(offset int) { committed = append(committed, offset) })
+	pool.submit(context.Background(), chatUpdate(7, 1))
+	pool.close()
+	if calls.Load() != 1 {
+		t.Fatalf("handled %d times, want once", calls.Load())
+	}
+	if len(committed) != 1 || committed[0] != 8 {
+		t.Fatalf("committed %v, want [8]", committed)
+	}
+}
+
+func TestOffsetTrackerWaitsForEarlierUpdates(t *testing.T) {
+	tracker := offsetTracker{done: map[int]bool{}}
+	var committed []int
+	commit := func(offset int) { committed = append(committed, offset) }
+	for _, id := range []int{1, 2, 3} {
+		tracker.add(id)
+	}
+	tracker.finish(2, commit)
+	tracker.finish(3, commit)
+	if len(committed) != 0 {
+		t.Fatalf("committed %v before update 1 is handled", committed)
+	}
+	tracker.finish(1, commit)
+	if len(committed) != 1 || committed[0] != 4 {
+		t.Fatalf("committed %v, want [4]", committed)
+	}
+}
+
+func TestSaveOffsetKeepsOffsetInStore(t *testing.T) {
+	db, err := database.InitMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := viper.New()
+	conf.Set("offset", 10)
+	app := &App{DB: db, Conf: conf}
+	if got := app.offset(); got != 10 {
+		t.Fatalf("offset before the first save = %d, want 10 from the configuration", got)
+	}
+	app.saveOffset(25)
+	if got := app.offset(); got != 25 {
+		t.Fatalf("offset = %d, want 25", got)
+	}
+	if got := conf.GetInt("offset"); got != 10 {
+		t.Fatalf("configuration offset changed to %d", got)
+	}
+}
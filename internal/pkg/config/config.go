@@ -23,9 +23,60 @@ func GetConfig() (*viper.Viper, error) {
 			return nil, l.Err(err)
 		}
 	}
+	setDefaults(v)
 	return v, nil
 }
 
+// GetFileConfig returns the configuration stored in the file with default values
+//
+// The file is overwritten, it is used to run the bot without config.json
+func GetFileConfig(path string) (*viper.Viper, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	v.SetConfigType("json")
+	v.Set("offset", 0)
+	if err := v.WriteConfig(); err != nil {
+		return nil, l.Err(err)
+	}
+	setDefaults(v)
+	return v, nil
+}
+
+// setDefaults sets default values of optional settings
+func setDefaults(v *viper.Viper) {
+	v.SetDefault("storage_driver", "sqlite")
+	v.SetDefault("rate_limit", 20)
+	v.SetDefault("send_rate", 30)
+	v.SetDefault("workers", 4)
+	v.SetDefault("update_queue", 100)
+	v.SetDefault("auto_reply_limit", 10)
+	v.SetDefault("auto_reply_window", 60)
+	v.SetDefault("receipts", "text")
+	v.SetDefault("ack_reaction", "👀")
+	v.SetDefault("digest_age", 24)
+	v.SetDefault("timezone", "Local")
+	v.SetDefault("maintenance_time", "04:00")
+	v.SetDefault("vault_time", "03:30")
+	v.SetDefault("vault_keep", 7)
+	v.SetDefault("min_free_disk_mb", 500)
+	v.SetDefault("duplicate_threshold", 0.7)
+	v.SetDefault("duplicate_days", 7)
+	v.SetDefault("review_sample", 0)
+	v.SetDefault("ticket_retention_days", 90)
+	v.SetDefault("takeover_minutes", 0)
+	v.SetDefault("log_level", "info")
+	v.SetDefault("log_format", "text")
+	v.SetDefault("status_minutes", 30)
+	v.SetDefault("notify_retries", 5)
+	v.SetDefault("donation_currency", "XTR")
+	v.SetDefault("donation_amount", 100)
+	v.SetDefault("donation_title", "Support the team")
+	v.SetDefault("donation_description", "A tip for the support team")
+	v.SetDefault("donation_thanks", "Thank you for your support! {amount} {currency} received")
+	v.SetDefault("log_max_size_mb", 0)
+	v.SetDefault("log_max_backups", 5)
+}
+
 // createConfig creates config
 func createConfig(v *viper.Viper) (*viper.Viper, error) {
 	file, _ := os.Create("config.json")
@@ -33,6 +84,9 @@ func createConfig(v *viper.Viper) (*viper.Viper, error) {
 	v.Set("host", "")
 	v.Set("token", "")
 	v.Set("offset", 0)
+	v.Set("admins", []int{})
+	v.Set("fields", []interface{}{})
+	v.Set("plugins", []string{})
 	if err := v.WriteConfig(); err != nil {
 		return nil, l.Err(err)
 	}
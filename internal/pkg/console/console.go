@@ -28,6 +28,7 @@ func Run(cancel context.CancelFunc, db *gorm.DB) {
 			fmt.Println("rbi <id> - removes an employee by user ID")
 			fmt.Println("rbn <nickname> - removes an employee by user Nickname")
 			fmt.Println("ge - displays a list of employees")
+			fmt.Println("role <id> <role|-> - sets the role of an employee, \"-\" for full access")
 			fmt.Println("close - closes the program")
 		case "abi":
 			if len(command) > 1 {
@@ -91,6 +92,31 @@ func Run(cancel context.CancelFunc, db *gorm.DB) {
 				fmt.Printf("UserID: %d Nickname: %s\n", user.ChatID, user.Nickname)
 				fmt.Println("(empty fields are filled when the employee uses the bot)")
 			}
+		case "role":
+			if len(command) > 2 {
+				id, err := strconv.Atoi(command[1])
+				if err != nil {
+					fmt.Println("Wrong format")
+					break
+				}
+				user := database.GetUserByChatID(id, db)
+				if user == nil || !user.IsEmployee {
+					fmt.Println("Employee not found")
+					break
+				}
+				role := command[2]
+				if role == "-" {
+					role = ""
+				}
+				err = database.ChangeUserRole(role, user, db)
+				if err != nil {
+					l.Error(err)
+					break
+				}
+				fmt.Println("Role changed")
+				break
+			}
+			fmt.Println("Enter value")
 		case "close":
 			cancel()
 			return
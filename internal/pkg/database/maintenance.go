@@ -0,0 +1,78 @@
+package database
+
+import (
+	l "telegram-bot-feedback/internal/pkg/logger"
+
+	"gorm.io/gorm"
+)
+
+// autoVacuumIncremental is the SQLite incremental auto_vacuum mode
+const autoVacuumIncremental = 2
+
+// BusySetting is the Setting key of the running export or backup, maintenance waits for it
+const BusySetting = "busy"
+
+// LastNumberSetting is the Setting key of the last ticket number before a restore, new numbers continue after it
+const LastNumberSetting = "last_ticket_number"
+
+// tables are all tables of the database
+var tables = []interface{}{User{}, Review{}, Question{}, QuestionCorrespondence{}, QuestionField{}, MessageLink{}, Link{}, LinkClick{}, Alias{}, Setting{}, OutboxMessage{}, Group{}, Segment{}, Category{}, Donation{}, QuestionTag{}, RolloutCohort{}, Escalation{}, QualityReview{}, SharedItem{}, Template{}, QuietMessage{}, ImportedMessage{}, ChatCapability{}, UserTopic{}}
+
+// TableCount is the number of rows in the table
+type TableCount struct {
+	Table string
+	Rows  int64
+}
+
+// Vacuum frees the space of deleted rows and optimizes the database
+//
+// The first run switches the database to incremental auto_vacuum with a full VACUUM
+func Vacuum(db *gorm.DB) error {
+	var mode int
+	err := db.Raw("PRAGMA auto_vacuum").Scan(&mode).Error
+	if err != nil {
+		return l.Err(err)
+	}
+	if mode != autoVacuumIncremental {
+		err = db.Exec("PRAGMA auto_vacuum = INCREMENTAL").Error
+		if err != nil {
+			return l.Err(err)
+		}
+		err = db.Exec("VACUUM").Error
+	} else {
+		err = db.Exec("PRAGMA incremental_vacuum").Error
+	}
+	if err != nil {
+		return l.Err(err)
+	}
+	return l.Err(db.Exec("PRAGMA optimize").Error)
+}
+
+// Size returns the database size in bytes
+func Size(db *gorm.DB) (int64, error) {
+	var pageCount, pageSize int64
+	err := db.Raw("PRAGMA page_count").Scan(&pageCount).Error
+	if err != nil {
+		return 0, l.Err(err)
+	}
+	err = db.Raw("PRAGMA page_size").Scan(&pageSize).Error
+	if err != nil {
+		return 0, l.Err(err)
+	}
+	return pageCount * pageSize, nil
+}
+
+// GetTableCounts returns the number of rows in every table, including deleted ones
+func GetTableCounts(db *gorm.DB) []TableCount {
+	counts := []TableCount{}
+	for _, table := range tables {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(table); err != nil {
+			continue
+		}
+		count := TableCount{Table: stmt.Schema.Table}
+		db.Unscoped().Model(table).Count(&count.Rows)
+		counts = append(counts, count)
+	}
+	return counts
+}
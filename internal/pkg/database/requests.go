@@ -1,6 +1,9 @@
 package database
 
 import (
+	"path"
+	"sort"
+	"strings"
 	l "telegram-bot-feedback/internal/pkg/logger"
 	"time"
 
@@ -56,16 +59,37 @@ func AddUser(chatId int, nick string, state int, db *gorm.DB) (*User, error) {
 }
 
 // AddQuestion creates Question from User
-func AddQuestion(header string, user *User, db *gorm.DB) (*Question, error) {
+func AddQuestion(header string, messageId int, user *User, db *gorm.DB) (*Question, error) {
 	question := Question{}
 	question.UserID = int(user.ID)
 	question.Header = header
+	question.MessageID = messageId
+	question.CategoryID = user.CategoryID
 	err := db.Save(&question).Error
+	if err == nil {
+		err = assignNumber(&question, db)
+	}
+	question.User = *user
 	return &question, l.Err(err)
 }
 
+// nextNumber is the SQL of the next ticket number, after every stored one and after the last one before a restore
+const nextNumber = "(SELECT MAX(n) + 1 FROM (SELECT COALESCE(MAX(number), 0) AS n FROM questions " +
+	"UNION ALL SELECT CAST(value AS INTEGER) FROM settings WHERE key = ? AND deleted_at IS NULL))"
+
+// assignNumber gives the new Question the next ticket number
+//
+// The number is computed and stored by one statement, so concurrent Questions get different numbers
+func assignNumber(question *Question, db *gorm.DB) error {
+	err := db.Model(&Question{}).Where("id = ?", question.ID).UpdateColumn("number", gorm.Expr(nextNumber, LastNumberSetting)).Error
+	if err != nil {
+		return err
+	}
+	return db.Model(&Question{}).Where("id = ?", question.ID).Select("number").Scan(&question.Number).Error
+}
+
 // AddCorrespondence creates Correspondence from User
-func AddCorrespondence(user *User, messageId int, db *gorm.DB) (*QuestionCorrespondence, error) {
+func AddCorrespondence(user *User, messageId int, text string, db *gorm.DB) (*QuestionCorrespondence, error) {
 	question := &Question{}
 	if user.IsEmployee {
 		question = GetOpenQuestionByAnswerer(user, db)
@@ -80,11 +104,140 @@ func AddCorrespondence(user *User, messageId int, db *gorm.DB) (*QuestionCorresp
 		MessageID:  messageId,
 		User:       *user,
 		IsEmployee: false,
+		Text:       text,
+	}
+	err := db.Save(&corr).Error
+	return &corr, l.Err(err)
+}
+
+// SetQuestionField creates/updates custom field of Question
+func SetQuestionField(question *Question, name, value string, number float64, db *gorm.DB) error {
+	field := QuestionField{}
+	db.Where("question_id = ? AND name = ?", question.ID, name).First(&field)
+	field.QuestionID = int(question.ID)
+	field.Name = name
+	field.Value = value
+	field.Number = number
+	return l.Err(db.Save(&field).Error)
+}
+
+// AddCorrespondenceToQuestion creates Correspondence of Question from User
+func AddCorrespondenceToQuestion(question *Question, user *User, messageId int, text string, db *gorm.DB) (*QuestionCorrespondence, error) {
+	corr := QuestionCorrespondence{
+		QuestionID: int(question.ID),
+		MessageID:  messageId,
+		User:       *user,
+		IsEmployee: user.IsEmployee,
+		Text:       text,
 	}
 	err := db.Save(&corr).Error
 	return &corr, l.Err(err)
 }
 
+// AddMessageLink creates MessageLink of the message in chat with Question, threadId is the forum topic or 0
+func AddMessageLink(chatId, threadId, messageId int, question *Question, db *gorm.DB) error {
+	link := MessageLink{
+		ChatID:     chatId,
+		MessageID:  messageId,
+		ThreadID:   threadId,
+		QuestionID: int(question.ID),
+		UserChatID: question.User.ChatID,
+	}
+	return l.Err(db.Save(&link).Error)
+}
+
+// GetMessageLink returns MessageLink by chat and message
+func GetMessageLink(chatId, messageId int, db *gorm.DB) *MessageLink {
+	link := MessageLink{}
+	err := db.Where("chat_id = ? AND message_id = ?", chatId, messageId).First(&link).Error
+	if err != nil || link.ID == 0 {
+		return nil
+	}
+	return &link
+}
+
+// ChangeMessageLinkPinned change MessageLink "IsPinned"
+func ChangeMessageLinkPinned(state bool, link *MessageLink, db *gorm.DB) error {
+	link.IsPinned = state
+	err := db.Save(link).Error
+	return l.Err(err)
+}
+
+// AddLink creates tracked Link
+func AddLink(code, target string, questionId int, source string, db *gorm.DB) error {
+	link := Link{Code: code, Target: target, QuestionID: questionId, Source: source}
+	return l.Err(db.Save(&link).Error)
+}
+
+// AddLinkClick creates LinkClick of Link
+func AddLinkClick(link *Link, db *gorm.DB) error {
+	click := LinkClick{LinkID: int(link.ID)}
+	return l.Err(db.Save(&click).Error)
+}
+
+// SetAlias creates or updates the Alias of User
+func SetAlias(user *User, name, command string, db *gorm.DB) error {
+	alias := Alias{}
+	db.Where("user_id = ? AND name = ?", user.ID, name).First(&alias)
+	alias.UserID = int(user.ID)
+	alias.Name = name
+	alias.Command = command
+	return l.Err(db.Save(&alias).Error)
+}
+
+// RemoveAlias deletes the Alias of User
+func RemoveAlias(user *User, name string, db *gorm.DB) error {
+	return l.Err(db.Where("user_id = ? AND name = ?", user.ID, name).Delete(&Alias{}).Error)
+}
+
+// AddUserToSegment adds User to the segment
+func AddUserToSegment(name string, user *User, db *gorm.DB) error {
+	segment := Segment{}
+	db.Where("user_id = ? AND name = ?", user.ID, name).First(&segment)
+	segment.UserID = int(user.ID)
+	segment.Name = name
+	return l.Err(db.Save(&segment).Error)
+}
+
+// RemoveUserFromSegment removes User from the segment
+func RemoveUserFromSegment(name string, user *User, db *gorm.DB) error {
+	return l.Err(db.Where("user_id = ? AND name = ?", user.ID, name).Delete(&Segment{}).Error)
+}
+
+// SetCategory creates Category or updates its emoji
+func SetCategory(emoji, name string, db *gorm.DB) (*Category, error) {
+	category := Category{}
+	db.Where("name = ?", name).First(&category)
+	category.Emoji = emoji
+	category.Name = name
+	err := db.Save(&category).Error
+	return &category, l.Err(err)
+}
+
+// RemoveCategory deletes Category, its Questions and Users who chose it are moved to the replacement
+func RemoveCategory(category, replacement *Category, db *gorm.DB) error {
+	return l.Err(db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&Question{}).Where("category_id = ?", category.ID).Update("category_id", replacement.ID).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&User{}).Where("category_id = ?", category.ID).Update("category_id", replacement.ID).Error
+		if err != nil {
+			return err
+		}
+		return tx.Delete(category).Error
+	}))
+}
+
+// SetSetting creates or updates Setting by key
+func SetSetting(key, value string, db *gorm.DB) error {
+	setting := Setting{}
+	db.Where("key = ?", key).First(&setting)
+	setting.Key = key
+	setting.Value = value
+	return l.Err(db.Save(&setting).Error)
+}
+
 // GetEmployees returns the Users with field IsEmployee = true
 func GetEmployees(db *gorm.DB) []User {
 	users := []User{}
@@ -106,6 +259,66 @@ func GetReceivers(db *gorm.DB) []User {
 	return users
 }
 
+// GetBroadcastUsers returns the Users who are not employees, have not blocked the bot and have not deleted the account
+func GetBroadcastUsers(db *gorm.DB) []User {
+	users := []User{}
+	err := db.Where("is_employee = ? AND is_blocked = ? AND is_deactivated = ? AND chat_id <> 0", false, false, false).Order("id asc").Find(&users).Error
+	if err != nil || len(users) == 0 {
+		return nil
+	}
+	return users
+}
+
+// GetBroadcastUsersInSegment returns the Users of the segment that can receive a broadcast
+func GetBroadcastUsersInSegment(name string, db *gorm.DB) []User {
+	users := []User{}
+	err := db.Where("is_employee = ? AND is_blocked = ? AND is_deactivated = ? AND chat_id <> 0", false, false, false).
+		Where("id IN (?)", db.Model(&Segment{}).Select("user_id").Where("name = ?", name)).Order("id asc").Find(&users).Error
+	if err != nil || len(users) == 0 {
+		return nil
+	}
+	return users
+}
+
+// SegmentCount is the number of Users in the segment
+type SegmentCount struct {
+	Name  string
+	Users int64
+}
+
+// GetSegments returns the segments with the number of Users
+func GetSegments(db *gorm.DB) []SegmentCount {
+	segments := []SegmentCount{}
+	err := db.Model(&Segment{}).Select("name, COUNT(*) AS users").Group("name").Order("name asc").Scan(&segments).Error
+	if err != nil || len(segments) == 0 {
+		return nil
+	}
+	return segments
+}
+
+// GetBannedUsers returns the banned Users
+func GetBannedUsers(db *gorm.DB) []User {
+	users := []User{}
+	err := db.Where("is_banned = ?", true).Order("banned_at asc").Find(&users).Error
+	if err != nil || len(users) == 0 {
+		return nil
+	}
+	return users
+}
+
+// GetEmployeesByChatIDs returns the employees by Telegram IDs
+func GetEmployeesByChatIDs(chatIds []int, db *gorm.DB) []User {
+	if len(chatIds) == 0 {
+		return nil
+	}
+	users := []User{}
+	err := db.Where("is_employee = ? AND chat_id IN ?", true, chatIds).Order("id asc").Find(&users).Error
+	if err != nil || len(users) == 0 {
+		return nil
+	}
+	return users
+}
+
 // GetUserByChatID returns User by Telegram ID (or private Chat ID)
 func GetUserByChatID(chatId int, db *gorm.DB) *User {
 	user := User{}
@@ -129,13 +342,23 @@ func GetEmptyReview(user *User, db *gorm.DB) *Review {
 // GetReviewsInRange returns Reviews between two dates
 func GetReviewsInRange(fDate time.Time, sDate time.Time, db *gorm.DB) []Review {
 	reviews := []Review{}
-	err := db.Order("id asc").Where("created_at BETWEEN ? AND ?", sDate, fDate).Find(&reviews).Error
+	err := db.Preload("User").Order("id asc").Where("created_at BETWEEN ? AND ?", sDate, fDate).Find(&reviews).Error
 	if err != nil || len(reviews) == 0 {
 		return nil
 	}
 	return reviews
 }
 
+// GetQuestionsInRange returns Questions between two dates with preloading User
+func GetQuestionsInRange(fDate time.Time, sDate time.Time, db *gorm.DB) []Question {
+	questions := []Question{}
+	err := db.Preload("User").Order("id asc").Where("created_at BETWEEN ? AND ?", sDate, fDate).Find(&questions).Error
+	if err != nil || len(questions) == 0 {
+		return nil
+	}
+	return questions
+}
+
 // GetCountReviewsByRating returns the number of Reviews with each rating
 func GetCountReviewsByRating(db *gorm.DB) [5]int64 {
 	number := [5]int64{}
@@ -197,6 +420,198 @@ func GetNewQuestions(db *gorm.DB) []Question {
 	return questions
 }
 
+// GetNewQuestionsBefore returns new Questions created before the date, the oldest first
+func GetNewQuestionsBefore(date time.Time, db *gorm.DB) []Question {
+	questions := []Question{}
+	err := db.Order("id asc").Find(&questions, "(answerer_id IS NULL OR answerer_id = 0) AND have_answer = ? AND is_closed = ? AND created_at < ?", false, false, date).Error
+	if err != nil || len(questions) == 0 {
+		return nil
+	}
+	return questions
+}
+
+// GetQuestionsAwaitingReplyBefore returns the taken open Questions whose user has been waiting for a reply since before the date
+func GetQuestionsAwaitingReplyBefore(date time.Time, db *gorm.DB) []Question {
+	questions := []Question{}
+	err := db.Preload("User").Preload("Answerer").Order("id asc").Find(&questions, "answerer_id <> 0 AND is_closed = ? AND awaiting_reply_since < ?", false, date).Error
+	if err != nil || len(questions) == 0 {
+		return nil
+	}
+	return questions
+}
+
+// GetQuestionMessageLink returns the first MessageLink of Question in the chat
+func GetQuestionMessageLink(chatId int, question *Question, db *gorm.DB) *MessageLink {
+	link := MessageLink{}
+	err := db.Where("chat_id = ? AND question_id = ?", chatId, question.ID).Order("id asc").First(&link).Error
+	if err != nil || link.ID == 0 {
+		return nil
+	}
+	return &link
+}
+
+// GetQuestionFields returns custom fields of Question
+func GetQuestionFields(question *Question, db *gorm.DB) []QuestionField {
+	fields := []QuestionField{}
+	err := db.Where("question_id = ?", question.ID).Order("id asc").Find(&fields).Error
+	if err != nil || len(fields) == 0 {
+		return nil
+	}
+	return fields
+}
+
+// GetQuestionsByField returns Questions with the custom field value
+func GetQuestionsByField(name, value string, db *gorm.DB) []Question {
+	questions := []Question{}
+	err := db.Where("id IN (?)", db.Model(&QuestionField{}).Select("question_id").Where("name = ? AND value = ?", name, value)).Order("id asc").Find(&questions).Error
+	if err != nil || len(questions) == 0 {
+		return nil
+	}
+	return questions
+}
+
+// GetLinkByCode returns Link by code
+func GetLinkByCode(code string, db *gorm.DB) *Link {
+	link := Link{}
+	err := db.Where("code = ?", code).First(&link).Error
+	if err != nil || link.ID == 0 {
+		return nil
+	}
+	return &link
+}
+
+// LinkStats is the number of links and clicks by target and source
+type LinkStats struct {
+	Target string
+	Source string
+	Links  int64
+	Clicks int64
+}
+
+// GetLinkStats returns LinkStats ordered by clicks
+func GetLinkStats(db *gorm.DB) []LinkStats {
+	stats := []LinkStats{}
+	err := db.Model(&Link{}).
+		Select("links.target, links.source, COUNT(DISTINCT links.id) AS links, COUNT(link_clicks.id) AS clicks").
+		Joins("LEFT JOIN link_clicks ON link_clicks.link_id = links.id AND link_clicks.deleted_at IS NULL").
+		Group("links.target, links.source").Order("clicks desc").Scan(&stats).Error
+	if err != nil || len(stats) == 0 {
+		return nil
+	}
+	return stats
+}
+
+// Counts is the number of records
+type Counts struct {
+	Users         int64
+	Questions     int64
+	OpenQuestions int64
+	Reviews       int64
+	Blocked       int64
+	Deactivated   int64
+	Groups        int64
+}
+
+// GetCounts returns the number of Users, Questions and Reviews
+func GetCounts(db *gorm.DB) Counts {
+	counts := Counts{}
+	db.Model(&User{}).Where("is_employee = ?", false).Count(&counts.Users)
+	db.Model(&Question{}).Count(&counts.Questions)
+	db.Model(&Question{}).Where("is_closed = ?", false).Count(&counts.OpenQuestions)
+	db.Model(&Review{}).Count(&counts.Reviews)
+	db.Model(&User{}).Where("is_employee = ? AND is_blocked = ? AND is_deactivated = ?", false, true, false).Count(&counts.Blocked)
+	db.Model(&User{}).Where("is_employee = ? AND is_deactivated = ?", false, true).Count(&counts.Deactivated)
+	db.Model(&Group{}).Count(&counts.Groups)
+	return counts
+}
+
+// GetQuestionBySurvey returns Question by survey Poll ID, including deleted Questions
+func GetQuestionBySurvey(pollId string, db *gorm.DB) *Question {
+	question := Question{}
+	err := db.Unscoped().Where("survey_poll_id = ?", pollId).First(&question).Error
+	if err != nil || question.ID == 0 {
+		return nil
+	}
+	return &question
+}
+
+// SurveyStats is the result of satisfaction surveys
+type SurveyStats struct {
+	Sent     int64
+	Answered int64
+	Average  float64
+}
+
+// GetSurveyStats returns SurveyStats of surveys sent after the date
+func GetSurveyStats(from time.Time, db *gorm.DB) SurveyStats {
+	stats := SurveyStats{}
+	query := db.Model(&Question{}).Unscoped().Where("survey_sent_at >= ?", from)
+	query.Session(&gorm.Session{}).Count(&stats.Sent)
+	query.Session(&gorm.Session{}).Where("survey_score > 0").Count(&stats.Answered)
+	query.Session(&gorm.Session{}).Where("survey_score > 0").Select("COALESCE(AVG(survey_score), 0)").Scan(&stats.Average)
+	return stats
+}
+
+// GetAlias returns the Alias of User by name
+func GetAlias(user *User, name string, db *gorm.DB) *Alias {
+	alias := Alias{}
+	err := db.Where("user_id = ? AND name = ?", user.ID, name).First(&alias).Error
+	if err != nil || alias.ID == 0 {
+		return nil
+	}
+	return &alias
+}
+
+// GetAliases returns the Aliases of User
+func GetAliases(user *User, db *gorm.DB) []Alias {
+	aliases := []Alias{}
+	err := db.Where("user_id = ?", user.ID).Order("name asc").Find(&aliases).Error
+	if err != nil || len(aliases) == 0 {
+		return nil
+	}
+	return aliases
+}
+
+// GetCategories returns all Categories in the order of creation
+func GetCategories(db *gorm.DB) []Category {
+	categories := []Category{}
+	err := db.Order("id asc").Find(&categories).Error
+	if err != nil || len(categories) == 0 {
+		return nil
+	}
+	return categories
+}
+
+// GetCategoryByID returns Category by ID
+func GetCategoryByID(id int, db *gorm.DB) *Category {
+	category := Category{}
+	err := db.Where("id = ?", id).First(&category).Error
+	if err != nil || category.ID == 0 {
+		return nil
+	}
+	return &category
+}
+
+// GetCategoryByName returns Category by name
+func GetCategoryByName(name string, db *gorm.DB) *Category {
+	category := Category{}
+	err := db.Where("name = ?", name).First(&category).Error
+	if err != nil || category.ID == 0 {
+		return nil
+	}
+	return &category
+}
+
+// GetSetting returns Setting value by key, empty if it is not set
+func GetSetting(key string, db *gorm.DB) string {
+	setting := Setting{}
+	err := db.Where("key = ?", key).First(&setting).Error
+	if err != nil {
+		return ""
+	}
+	return setting.Value
+}
+
 // GetCorrespondenceByQuestion returns Correspondence by Question with preloading User
 func GetCorrespondenceByQuestion(questions *Question, db *gorm.DB) []QuestionCorrespondence {
 	corr := []QuestionCorrespondence{}
@@ -207,6 +622,64 @@ func GetCorrespondenceByQuestion(questions *Question, db *gorm.DB) []QuestionCor
 	return corr
 }
 
+// DialogOptions filters ListDialog, zero values are not applied
+type DialogOptions struct {
+	From  time.Time
+	To    time.Time
+	Limit int // the last Limit messages
+}
+
+// DialogMessage is a message of the dialog with a user
+type DialogMessage struct {
+	QuestionID   int
+	Time         time.Time
+	FromEmployee bool
+	Text         string
+}
+
+// ListDialog returns the messages of User questions and the answers in chronological order
+//
+// The first message of a Question is its Header
+func ListDialog(userId int, opts DialogOptions, db *gorm.DB) []DialogMessage {
+	questions := []Question{}
+	err := db.Where("user_id = ?", userId).Order("id asc").Find(&questions).Error
+	if err != nil || len(questions) == 0 {
+		return nil
+	}
+	ids := make([]uint, len(questions))
+	first := map[int]int{}
+	messages := []DialogMessage{}
+	for i, question := range questions {
+		ids[i] = question.ID
+		first[int(question.ID)] = question.MessageID
+		messages = append(messages, DialogMessage{QuestionID: int(question.ID), Time: question.CreatedAt, Text: question.Header})
+	}
+	corr := []QuestionCorrespondence{}
+	err = db.Preload("User").Where("question_id IN ?", ids).Order("id asc").Find(&corr).Error
+	if err != nil {
+		return nil
+	}
+	for _, c := range corr {
+		fromEmployee := c.IsEmployee || c.User.IsEmployee
+		if !fromEmployee && c.MessageID != 0 && c.MessageID == first[c.QuestionID] {
+			continue
+		}
+		messages = append(messages, DialogMessage{QuestionID: c.QuestionID, Time: c.CreatedAt, FromEmployee: fromEmployee, Text: c.Text})
+	}
+	sort.SliceStable(messages, func(i, j int) bool { return messages[i].Time.Before(messages[j].Time) })
+	filtered := messages[:0]
+	for _, m := range messages {
+		if (!opts.From.IsZero() && m.Time.Before(opts.From)) || (!opts.To.IsZero() && !m.Time.Before(opts.To)) {
+			continue
+		}
+		filtered = append(filtered, m)
+	}
+	if opts.Limit > 0 && len(filtered) > opts.Limit {
+		filtered = filtered[len(filtered)-opts.Limit:]
+	}
+	return filtered
+}
+
 // ChangeUserState change User "State"
 func ChangeUserState(state int, user *User, db *gorm.DB) error {
 	user.State = state
@@ -221,6 +694,95 @@ func ChangeUserIsReceiver(isReceiver bool, user *User, db *gorm.DB) error {
 	return l.Err(err)
 }
 
+// ChangeUserIsBlocked change User "IsBlocked"
+func ChangeUserIsBlocked(isBlocked bool, user *User, db *gorm.DB) error {
+	user.IsBlocked = isBlocked
+	err := db.Save(user).Error
+	return l.Err(err)
+}
+
+// ChangeUserIsDeactivated marks the User as deleted account, it is never cleared
+func ChangeUserIsDeactivated(user *User, db *gorm.DB) error {
+	user.IsDeactivated = true
+	err := db.Save(user).Error
+	return l.Err(err)
+}
+
+// ChangeUserCategory change User "CategoryID", the Category of the next Question
+func ChangeUserCategory(categoryID int, user *User, db *gorm.DB) error {
+	user.CategoryID = categoryID
+	err := db.Save(user).Error
+	return l.Err(err)
+}
+
+// ChangeCategoryName change Category "Name"
+func ChangeCategoryName(name string, category *Category, db *gorm.DB) error {
+	category.Name = name
+	err := db.Save(category).Error
+	return l.Err(err)
+}
+
+// ChangeUserRole change User "Role", empty for full access
+func ChangeUserRole(role string, user *User, db *gorm.DB) error {
+	user.Role = role
+	err := db.Save(user).Error
+	return l.Err(err)
+}
+
+// ChangeUserIsBanned change User "IsBanned" with the reason and date of the ban
+func ChangeUserIsBanned(isBanned bool, reason string, user *User, db *gorm.DB) error {
+	user.IsBanned = isBanned
+	user.BanReason = reason
+	user.BannedAt = nil
+	if isBanned {
+		now := time.Now()
+		user.BannedAt = &now
+	}
+	user.BanNotified = false
+	err := db.Save(user).Error
+	return l.Err(err)
+}
+
+// ChangeUserBanNotified change User "BanNotified"
+func ChangeUserBanNotified(notified bool, user *User, db *gorm.DB) error {
+	user.BanNotified = notified
+	err := db.Save(user).Error
+	return l.Err(err)
+}
+
+// ChangeUserProfile change User "Nickname", "FirstName", "LastName" and "LanguageCode", "ProfileAt" is set to now
+func ChangeUserProfile(nickname, firstName, lastName, languageCode string, user *User, db *gorm.DB) error {
+	now := time.Now()
+	user.Nickname = nickname
+	user.FirstName = firstName
+	user.LastName = lastName
+	user.LanguageCode = languageCode
+	user.ProfileAt = &now
+	err := db.Save(user).Error
+	return l.Err(err)
+}
+
+// ChangeUserQuietHours change User "QuietHours"
+func ChangeUserQuietHours(window string, user *User, db *gorm.DB) error {
+	user.QuietHours = window
+	err := db.Save(user).Error
+	return l.Err(err)
+}
+
+// ChangeUserTimezone change User "Timezone"
+func ChangeUserTimezone(timezone string, user *User, db *gorm.DB) error {
+	user.Timezone = timezone
+	err := db.Save(user).Error
+	return l.Err(err)
+}
+
+// ChangeUserReceipts change User "Receipts"
+func ChangeUserReceipts(receipts string, user *User, db *gorm.DB) error {
+	user.Receipts = receipts
+	err := db.Save(user).Error
+	return l.Err(err)
+}
+
 // ChangeTextReviewByUser change Review "Text" (by User)
 func ChangeTextReviewByUser(text string, user *User, db *gorm.DB) error {
 	review := GetEmptyReview(user, db)
@@ -239,15 +801,749 @@ func ChangeQuestionHaveAnswer(state bool, question *Question, db *gorm.DB) error
 }
 
 // ChangeQuestionAnswerer change Question "Answerer"
+//
+// A preloaded Answerer is dropped when it changes, otherwise Save writes its ID back
 func ChangeQuestionAnswerer(answererID int, question *Question, db *gorm.DB) error {
 	question.AnswererID = answererID
+	if int(question.Answerer.ID) != answererID {
+		question.Answerer = User{}
+	}
+	err := db.Save(question).Error
+	return l.Err(err)
+}
+
+// ChangeQuestionAwaitingReplySince change Question "AwaitingReplySince", nil when the user is not waiting for the answerer
+func ChangeQuestionAwaitingReplySince(date *time.Time, question *Question, db *gorm.DB) error {
+	question.AwaitingReplySince = date
+	err := db.Save(question).Error
+	return l.Err(err)
+}
+
+// AppendQuestionHeader adds the text to the end of the Question "Header"
+func AppendQuestionHeader(questionID int, text string, db *gorm.DB) error {
+	err := db.Model(&Question{}).Where("id = ?", questionID).Update("header", gorm.Expr("header || ?", text)).Error
+	return l.Err(err)
+}
+
+// AppendCorrespondenceText adds the text to the end of the Correspondence "Text" of the message
+func AppendCorrespondenceText(questionID, messageID int, text string, db *gorm.DB) error {
+	err := db.Model(&QuestionCorrespondence{}).Where("question_id = ? AND message_id = ? AND is_employee = ?", questionID, messageID, false).Update("text", gorm.Expr("text || ?", text)).Error
+	return l.Err(err)
+}
+
+// ChangeQuestionTicketID change Question "TicketID"
+func ChangeQuestionTicketID(ticketID string, question *Question, db *gorm.DB) error {
+	question.TicketID = ticketID
+	err := db.Save(question).Error
+	return l.Err(err)
+}
+
+// ChangeQuestionSurvey change Question "SurveyPollID" and "SurveySentAt"
+func ChangeQuestionSurvey(pollId string, question *Question, db *gorm.DB) error {
+	now := time.Now()
+	question.SurveyPollID = pollId
+	question.SurveySentAt = &now
 	err := db.Save(question).Error
 	return l.Err(err)
 }
 
-// ChangeQuestionIsClosed change Question "IsClosed"
+// ChangeQuestionSurveyScore change Question "SurveyScore"
+func ChangeQuestionSurveyScore(score int, question *Question, db *gorm.DB) error {
+	err := db.Unscoped().Model(question).Update("survey_score", score).Error
+	return l.Err(err)
+}
+
+// ChangeQuestionTriage change Question "TriageStatus" and "TriageBy" if the status is still the old one
+//
+// Returns false if another status was written first
+func ChangeQuestionTriage(status, old string, by int, question *Question, db *gorm.DB) (bool, error) {
+	result := db.Model(&Question{}).Where("id = ? AND COALESCE(triage_status, '') = ?", question.ID, old).
+		Updates(map[string]interface{}{"triage_status": status, "triage_by": by})
+	if result.Error != nil {
+		return false, l.Err(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+	question.TriageStatus, question.TriageBy = status, by
+	return true, nil
+}
+
+// ChangeQuestionIsClosed change Question "IsClosed" and "ClosedAt", closing again keeps the first time
 func ChangeQuestionIsClosed(closed bool, question *Question, db *gorm.DB) error {
+	switch {
+	case !closed:
+		question.ClosedAt = nil
+	case question.ClosedAt == nil:
+		now := time.Now()
+		question.ClosedAt = &now
+	}
 	question.IsClosed = closed
 	err := db.Save(question).Error
 	return l.Err(err)
 }
+
+// AddOutboxMessage adds the message to the outbox, it is sent after the given time
+func AddOutboxMessage(chatId int, method, payload string, questionId int, next time.Time, db *gorm.DB) error {
+	message := OutboxMessage{ChatID: chatId, Method: method, Payload: payload, QuestionID: questionId, NextAttempt: next}
+	err := db.Create(&message).Error
+	return l.Err(err)
+}
+
+// HasOutboxMessages reports whether the chat has messages waiting for delivery
+func HasOutboxMessages(chatId int, db *gorm.DB) bool {
+	var count int64
+	db.Model(&OutboxMessage{}).Where("chat_id = ? AND is_dead = ?", chatId, false).Count(&count)
+	return count > 0
+}
+
+// GetDueOutboxMessages returns the oldest waiting message of every chat if its time has come
+func GetDueOutboxMessages(now time.Time, db *gorm.DB) []OutboxMessage {
+	messages := []OutboxMessage{}
+	err := db.Where("is_dead = ?", false).Order("id asc").Find(&messages).Error
+	if err != nil {
+		return nil
+	}
+	seen := map[int]bool{}
+	due := []OutboxMessage{}
+	for _, message := range messages {
+		if seen[message.ChatID] {
+			continue
+		}
+		seen[message.ChatID] = true
+		if !message.NextAttempt.After(now) {
+			due = append(due, message)
+		}
+	}
+	return due
+}
+
+// ChangeOutboxMessageAttempt records the failed attempt and the time of the next one
+func ChangeOutboxMessageAttempt(errText string, next time.Time, message *OutboxMessage, db *gorm.DB) error {
+	message.Attempts++
+	message.Error = errText
+	message.NextAttempt = next
+	err := db.Save(message).Error
+	return l.Err(err)
+}
+
+// ChangeOutboxMessageIsDead marks the message as undeliverable
+func ChangeOutboxMessageIsDead(errText string, message *OutboxMessage, db *gorm.DB) error {
+	message.Attempts++
+	message.Error = errText
+	message.IsDead = true
+	err := db.Save(message).Error
+	return l.Err(err)
+}
+
+// RemoveOutboxMessage removes the delivered message
+func RemoveOutboxMessage(message *OutboxMessage, db *gorm.DB) error {
+	err := db.Unscoped().Delete(message).Error
+	return l.Err(err)
+}
+
+// OutboxStats is the number of waiting and dead messages
+type OutboxStats struct {
+	Pending int64
+	Dead    int64
+}
+
+// GetOutboxStats returns OutboxStats
+func GetOutboxStats(db *gorm.DB) OutboxStats {
+	stats := OutboxStats{}
+	db.Model(&OutboxMessage{}).Where("is_dead = ?", false).Count(&stats.Pending)
+	db.Model(&OutboxMessage{}).Where("is_dead = ?", true).Count(&stats.Dead)
+	return stats
+}
+
+// GetDeadOutboxMessages returns the last dead messages
+func GetDeadOutboxMessages(limit int, db *gorm.DB) []OutboxMessage {
+	messages := []OutboxMessage{}
+	err := db.Where("is_dead = ?", true).Order("id desc").Limit(limit).Find(&messages).Error
+	if err != nil || len(messages) == 0 {
+		return nil
+	}
+	return messages
+}
+
+// AddQuietMessage holds the message until the release time
+//
+// A collapsing message replaces the held collapsing message of the same chat and Question, it keeps its place in the order
+func AddQuietMessage(chatId int, method, payload string, questionId int, collapse bool, release time.Time, db *gorm.DB) error {
+	message := QuietMessage{}
+	if collapse && questionId != 0 {
+		db.Where("chat_id = ? AND question_id = ? AND collapse = ?", chatId, questionId, true).First(&message)
+	}
+	message.ChatID = chatId
+	message.Method = method
+	message.Payload = payload
+	message.QuestionID = questionId
+	message.Collapse = collapse
+	message.ReleaseAt = release
+	err := db.Save(&message).Error
+	return l.Err(err)
+}
+
+// GetDueQuietMessages returns the held messages whose release time has come, oldest first
+func GetDueQuietMessages(now time.Time, db *gorm.DB) []QuietMessage {
+	messages := []QuietMessage{}
+	err := db.Where("release_at <= ?", now).Order("id asc").Find(&messages).Error
+	if err != nil || len(messages) == 0 {
+		return nil
+	}
+	return messages
+}
+
+// CountQuietMessages returns the number of held messages
+func CountQuietMessages(db *gorm.DB) int64 {
+	var count int64
+	db.Model(&QuietMessage{}).Count(&count)
+	return count
+}
+
+// RemoveQuietMessage removes the released message
+func RemoveQuietMessage(message *QuietMessage, db *gorm.DB) error {
+	err := db.Unscoped().Delete(message).Error
+	return l.Err(err)
+}
+
+// GetChatCapability returns the ChatCapability of the chat, nil if it is not recorded
+func GetChatCapability(chatId int, db *gorm.DB) *ChatCapability {
+	capability := ChatCapability{}
+	err := db.Where("chat_id = ?", chatId).First(&capability).Error
+	if err != nil {
+		return nil
+	}
+	return &capability
+}
+
+// SetChatCapability records the type of the chat and whether it has topics, returns the previous record or nil
+func SetChatCapability(chatId int, chatType string, isForum bool, checkedAt time.Time, db *gorm.DB) (*ChatCapability, error) {
+	capability := ChatCapability{}
+	var previous *ChatCapability
+	if db.Where("chat_id = ?", chatId).First(&capability).Error == nil {
+		old := capability
+		previous = &old
+	}
+	capability.ChatID = chatId
+	capability.Type = chatType
+	capability.IsForum = isForum
+	capability.CheckedAt = checkedAt
+	err := db.Save(&capability).Error
+	return previous, l.Err(err)
+}
+
+// ChangeChatMigratedTo records the supergroup the basic group was migrated to
+func ChangeChatMigratedTo(chatId, migratedTo int, db *gorm.DB) error {
+	capability := ChatCapability{}
+	db.Where("chat_id = ?", chatId).First(&capability)
+	capability.ChatID = chatId
+	capability.MigratedTo = migratedTo
+	err := db.Save(&capability).Error
+	return l.Err(err)
+}
+
+// GetUserTopic returns the topic of the User in the chat, nil if there is none
+func GetUserTopic(chatId, userId int, db *gorm.DB) *UserTopic {
+	topic := UserTopic{}
+	err := db.Where("chat_id = ? AND user_id = ?", chatId, userId).First(&topic).Error
+	if err != nil {
+		return nil
+	}
+	return &topic
+}
+
+// GetUserTopicByThread returns the topic of the chat by its thread, nil if it isn't a topic of a User
+func GetUserTopicByThread(chatId, threadId int, db *gorm.DB) *UserTopic {
+	topic := UserTopic{}
+	err := db.Where("chat_id = ? AND thread_id = ?", chatId, threadId).First(&topic).Error
+	if err != nil {
+		return nil
+	}
+	return &topic
+}
+
+// AddUserTopic creates the topic of the User in the chat
+func AddUserTopic(chatId, userId, threadId int, db *gorm.DB) (*UserTopic, error) {
+	topic := UserTopic{ChatID: chatId, UserID: userId, ThreadID: threadId}
+	err := db.Save(&topic).Error
+	return &topic, l.Err(err)
+}
+
+// RemoveUserTopic removes the topic, e.g. deleted in the chat
+func RemoveUserTopic(topic *UserTopic, db *gorm.DB) error {
+	err := db.Unscoped().Delete(topic).Error
+	return l.Err(err)
+}
+
+// RemoveUserTopics removes the topics of the chat
+func RemoveUserTopics(chatId int, db *gorm.DB) error {
+	err := db.Unscoped().Where("chat_id = ?", chatId).Delete(&UserTopic{}).Error
+	return l.Err(err)
+}
+
+// SetGroup adds the Group or updates its title
+func SetGroup(chatId int, title string, db *gorm.DB) error {
+	group := Group{}
+	db.Where("chat_id = ?", chatId).First(&group)
+	group.ChatID = chatId
+	group.Title = title
+	err := db.Save(&group).Error
+	return l.Err(err)
+}
+
+// RemoveGroup removes the Group
+func RemoveGroup(chatId int, db *gorm.DB) error {
+	err := db.Unscoped().Where("chat_id = ?", chatId).Delete(&Group{}).Error
+	return l.Err(err)
+}
+
+// AddDonation records the Donation
+func AddDonation(currency string, amount int, chargeId string, db *gorm.DB) error {
+	donation := Donation{Currency: currency, Amount: amount, ChargeID: chargeId}
+	err := db.Save(&donation).Error
+	return l.Err(err)
+}
+
+// DonationTotal is the number and the sum of Donations in the currency
+type DonationTotal struct {
+	Currency string
+	Count    int64
+	Amount   int64
+}
+
+// GetDonationTotals returns DonationTotal by currency
+func GetDonationTotals(db *gorm.DB) []DonationTotal {
+	totals := []DonationTotal{}
+	err := db.Model(&Donation{}).Select("currency, COUNT(*) AS count, SUM(amount) AS amount").Group("currency").Order("currency asc").Scan(&totals).Error
+	if err != nil || len(totals) == 0 {
+		return nil
+	}
+	return totals
+}
+
+// AddQuestionTags adds tags to Question, tags it already has are kept once
+func AddQuestionTags(tags []string, question *Question, db *gorm.DB) error {
+	for _, name := range tags {
+		tag := QuestionTag{}
+		db.Where("question_id = ? AND name = ?", question.ID, name).First(&tag)
+		tag.QuestionID = int(question.ID)
+		tag.Name = name
+		if err := db.Save(&tag).Error; err != nil {
+			return l.Err(err)
+		}
+	}
+	return nil
+}
+
+// RemoveQuestionTags removes tags of Question, all of them if tags is empty
+func RemoveQuestionTags(tags []string, question *Question, db *gorm.DB) error {
+	query := db.Where("question_id = ?", question.ID)
+	if len(tags) > 0 {
+		query = query.Where("name IN ?", tags)
+	}
+	return l.Err(query.Delete(&QuestionTag{}).Error)
+}
+
+// GetQuestionTags returns the tags of Question in alphabetical order
+func GetQuestionTags(question *Question, db *gorm.DB) []string {
+	var tags []string
+	err := db.Model(&QuestionTag{}).Where("question_id = ?", question.ID).Order("name asc").Pluck("name", &tags).Error
+	if err != nil || len(tags) == 0 {
+		return nil
+	}
+	return tags
+}
+
+// SearchQuestions returns at most limit Questions whose header, correspondence or tags contain any of the terms, newest first
+//
+// Terms match the text as substrings and tags exactly
+func SearchQuestions(terms []string, limit int, db *gorm.DB) []Question {
+	if len(terms) == 0 {
+		return nil
+	}
+	match := db.Where("1 = 0")
+	for _, term := range terms {
+		like := "%" + likeEscaper.Replace(term) + "%"
+		match = match.Or("header LIKE ? ESCAPE '\\'", like).
+			Or("id IN (?)", db.Model(&QuestionCorrespondence{}).Select("question_id").Where("text LIKE ? ESCAPE '\\'", like)).
+			Or("id IN (?)", db.Model(&QuestionTag{}).Select("question_id").Where("name = ?", term))
+	}
+	questions := []Question{}
+	err := db.Preload("User").Where(match).Order("id desc").Limit(limit).Find(&questions).Error
+	if err != nil || len(questions) == 0 {
+		return nil
+	}
+	return questions
+}
+
+// likeEscaper escapes the wildcards of LIKE patterns
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// SetRolloutCohort records whether the feature applied to Question
+func SetRolloutCohort(feature string, enabled bool, question *Question, db *gorm.DB) error {
+	cohort := RolloutCohort{}
+	db.Where("question_id = ? AND feature = ?", question.ID, feature).First(&cohort)
+	cohort.QuestionID = int(question.ID)
+	cohort.Feature = feature
+	cohort.Enabled = enabled
+	return l.Err(db.Save(&cohort).Error)
+}
+
+// CohortStats is the outcome of the Questions in a rollout cohort
+type CohortStats struct {
+	Enabled   bool
+	Questions int64
+	Answered  int64
+	Closed    int64
+	Surveyed  int64
+	Score     float64 // average survey score of the answered surveys
+}
+
+// GetCohortStats returns the outcome of the Questions with and without the feature
+func GetCohortStats(feature string, db *gorm.DB) []CohortStats {
+	stats := []CohortStats{}
+	err := db.Model(&RolloutCohort{}).
+		Select("rollout_cohorts.enabled, COUNT(*) AS questions, "+
+			"SUM(CASE WHEN questions.have_answer THEN 1 ELSE 0 END) AS answered, "+
+			"SUM(CASE WHEN questions.is_closed THEN 1 ELSE 0 END) AS closed, "+
+			"SUM(CASE WHEN questions.survey_score > 0 THEN 1 ELSE 0 END) AS surveyed, "+
+			"COALESCE(AVG(NULLIF(questions.survey_score, 0)), 0) AS score").
+		Joins("JOIN questions ON questions.id = rollout_cohorts.question_id").
+		Where("rollout_cohorts.feature = ?", feature).
+		Group("rollout_cohorts.enabled").Order("rollout_cohorts.enabled desc").Scan(&stats).Error
+	if err != nil || len(stats) == 0 {
+		return nil
+	}
+	return stats
+}
+
+// AddEscalation creates Escalation of Question to the team
+func AddEscalation(team string, question *Question, db *gorm.DB) (*Escalation, error) {
+	escalation := Escalation{QuestionID: int(question.ID), Team: team}
+	err := db.Create(&escalation).Error
+	return &escalation, l.Err(err)
+}
+
+// GetOpenEscalation returns the open Escalation of Question, nil if there is none
+func GetOpenEscalation(question *Question, db *gorm.DB) *Escalation {
+	escalation := Escalation{}
+	err := db.Where("question_id = ? AND is_closed = ?", question.ID, false).First(&escalation).Error
+	if err != nil {
+		return nil
+	}
+	return &escalation
+}
+
+// GetEscalation returns the open Escalation by ID and team, nil if there is none
+func GetEscalation(id uint, team string, db *gorm.DB) *Escalation {
+	escalation := Escalation{}
+	err := db.Where("id = ? AND team = ? AND is_closed = ?", id, team, false).First(&escalation).Error
+	if err != nil {
+		return nil
+	}
+	return &escalation
+}
+
+// CloseEscalation marks Escalation closed
+func CloseEscalation(escalation *Escalation, db *gorm.DB) error {
+	escalation.IsClosed = true
+	return l.Err(db.Model(escalation).Update("is_closed", true).Error)
+}
+
+// AddPartnerCorrespondence adds the reply of a partner team to Question, it has no User
+func AddPartnerCorrespondence(question *Question, text string, db *gorm.DB) error {
+	corr := QuestionCorrespondence{
+		QuestionID: int(question.ID),
+		IsEmployee: true,
+		Text:       text,
+	}
+	return l.Err(db.Omit("User").Create(&corr).Error)
+}
+
+// ChangeUserSource change User "Source"
+func ChangeUserSource(source string, user *User, db *gorm.DB) error {
+	user.Source = source
+	err := db.Model(user).Update("source", source).Error
+	return l.Err(err)
+}
+
+// SetGroupSource records the source of the Group, the first one is kept
+func SetGroupSource(chatId int, title, source string, db *gorm.DB) error {
+	group := Group{}
+	db.Where("chat_id = ?", chatId).First(&group)
+	if group.Source != "" {
+		return nil
+	}
+	group.ChatID = chatId
+	group.Title = title
+	group.Source = source
+	err := db.Save(&group).Error
+	return l.Err(err)
+}
+
+// SourceCount is the number of Users or Groups from the acquisition source
+type SourceCount struct {
+	Source string
+	Count  int64
+}
+
+// GetUserSources returns the number of Users by source, most first
+func GetUserSources(db *gorm.DB) []SourceCount {
+	return getSources(db.Model(&User{}))
+}
+
+// GetGroupSources returns the number of Groups by source, most first
+func GetGroupSources(db *gorm.DB) []SourceCount {
+	return getSources(db.Model(&Group{}))
+}
+
+// getSources counts the rows of the model by source
+func getSources(model *gorm.DB) []SourceCount {
+	sources := []SourceCount{}
+	err := model.Select("source, COUNT(*) AS count").Where("source <> ''").Group("source").Order("count desc, source asc").Scan(&sources).Error
+	if err != nil || len(sources) == 0 {
+		return nil
+	}
+	return sources
+}
+
+// AddQualityReview puts the closed Question in the review queue, a Question is queued once
+func AddQualityReview(question *Question, db *gorm.DB) error {
+	review := QualityReview{QuestionID: int(question.ID), AnswererID: question.AnswererID}
+	err := db.Where("question_id = ?", question.ID).FirstOrCreate(&review).Error
+	return l.Err(err)
+}
+
+// GetNextQualityReview returns the first unreviewed QualityReview after the ID, nil if there is none
+//
+// Questions the reviewer answered are skipped
+func GetNextQualityReview(afterId uint, reviewerId int, db *gorm.DB) *QualityReview {
+	review := QualityReview{}
+	err := db.Where("id > ? AND verdict = ? AND answerer_id <> ?", afterId, "", reviewerId).Order("id asc").First(&review).Error
+	if err != nil {
+		return nil
+	}
+	return &review
+}
+
+// CountQualityReviews returns the number of unreviewed QualityReviews
+func CountQualityReviews(db *gorm.DB) int64 {
+	var count int64
+	db.Model(&QualityReview{}).Where("verdict = ?", "").Count(&count)
+	return count
+}
+
+// SetQualityVerdict records the verdict of the reviewer, false if QualityReview is already reviewed
+func SetQualityVerdict(id uint, verdict string, reviewerId int, db *gorm.DB) (bool, error) {
+	now := time.Now()
+	result := db.Model(&QualityReview{}).Where("id = ? AND verdict = ?", id, "").
+		Updates(map[string]interface{}{"verdict": verdict, "reviewer_id": reviewerId, "reviewed_at": &now})
+	return result.RowsAffected == 1, l.Err(result.Error)
+}
+
+// GetLastQualityReview returns the last QualityReview by the reviewer, nil if there is none
+func GetLastQualityReview(reviewerId int, db *gorm.DB) *QualityReview {
+	review := QualityReview{}
+	err := db.Where("reviewer_id = ? AND verdict <> ?", reviewerId, "").Order("reviewed_at desc").First(&review).Error
+	if err != nil {
+		return nil
+	}
+	return &review
+}
+
+// ChangeQualityComment change QualityReview "Comment"
+func ChangeQualityComment(comment string, review *QualityReview, db *gorm.DB) error {
+	review.Comment = comment
+	err := db.Model(review).Update("comment", comment).Error
+	return l.Err(err)
+}
+
+// QualityStats is the review outcome of the answers of an employee
+type QualityStats struct {
+	AnswererID int
+	Reviewed   int64
+	Approved   int64
+	Comments   int64
+}
+
+// GetQualityStats returns the review outcome by answering employee, most reviewed first
+func GetQualityStats(db *gorm.DB) []QualityStats {
+	stats := []QualityStats{}
+	err := db.Model(&QualityReview{}).
+		Select("answerer_id, COUNT(*) AS reviewed, "+
+			"SUM(CASE WHEN verdict = ? THEN 1 ELSE 0 END) AS approved, "+
+			"SUM(CASE WHEN comment <> '' THEN 1 ELSE 0 END) AS comments", VerdictApproved).
+		Where("verdict <> ?", "").Group("answerer_id").Order("reviewed desc, answerer_id asc").Scan(&stats).Error
+	if err != nil || len(stats) == 0 {
+		return nil
+	}
+	return stats
+}
+
+// GetUserById returns User by ID, nil if there is none
+func GetUserById(id int, db *gorm.DB) *User {
+	user := User{}
+	err := db.First(&user, id).Error
+	if err != nil {
+		return nil
+	}
+	return &user
+}
+
+// GetUserQuestions returns the last Questions of the User, the newest first
+//
+// Questions closed before closedAfter are skipped, open ones are always returned.
+// Questions closed before "ClosedAt" was stored use the time of their last change
+func GetUserQuestions(user *User, closedAfter time.Time, limit int, db *gorm.DB) []Question {
+	questions := []Question{}
+	err := db.Where("user_id = ? AND (is_closed = ? OR COALESCE(closed_at, updated_at) >= ?)", user.ID, false, closedAfter).
+		Order("id desc").Limit(limit).Find(&questions).Error
+	if err != nil || len(questions) == 0 {
+		return nil
+	}
+	return questions
+}
+
+// GetUserQuestionByNumber returns Question by ticket number if it belongs to the User
+func GetUserQuestionByNumber(number int, user *User, db *gorm.DB) *Question {
+	question := Question{}
+	err := db.Where("number = ? AND user_id = ?", number, user.ID).First(&question).Error
+	if err != nil || question.ID == 0 {
+		return nil
+	}
+	return &question
+}
+
+// GetLastEmployeeReply returns the last Correspondence of an employee in the Question, nil if there is none
+func GetLastEmployeeReply(question *Question, db *gorm.DB) *QuestionCorrespondence {
+	corr := QuestionCorrespondence{}
+	err := db.Where("question_id = ? AND (is_employee = ? OR user_id IN (?))", question.ID, true,
+		db.Model(&User{}).Select("id").Where("is_employee = ?", true)).Order("id desc").First(&corr).Error
+	if err != nil || corr.ID == 0 {
+		return nil
+	}
+	return &corr
+}
+
+// AddSharedItem stores the contact, location or venue of the Question
+func AddSharedItem(item *SharedItem, question *Question, db *gorm.DB) error {
+	item.QuestionID = int(question.ID)
+	return l.Err(db.Create(item).Error)
+}
+
+// GetImportedMessage returns the imported message of the chat, nil if it is not imported
+func GetImportedMessage(chatId, messageId int, db *gorm.DB) *ImportedMessage {
+	message := ImportedMessage{}
+	err := db.Where("chat_id = ? AND message_id = ?", chatId, messageId).First(&message).Error
+	if err != nil || message.ID == 0 {
+		return nil
+	}
+	return &message
+}
+
+// AddImportedUser returns the User of the chat, the sender of an imported message is created if there is none
+func AddImportedUser(chatId int, firstName string, state int, db *gorm.DB) (*User, error) {
+	if user := GetUserByChatID(chatId, db); user != nil {
+		return user, nil
+	}
+	user := User{ChatID: chatId, FirstName: firstName, State: state, Source: "import"}
+	err := db.Create(&user).Error
+	return &user, l.Err(err)
+}
+
+// AddImportedMessage saves the imported message into a Question, returns false if the message of the chat is already imported
+//
+// A message which doesn't reply to an imported one starts a closed Question of the sender (nil for a deleted account),
+// a reply is added to the correspondence of the replied Question, as an answer if another user sent it.
+// The Question and the correspondence get the date of the message
+func AddImportedMessage(message *ImportedMessage, sender *User, db *gorm.DB) (bool, error) {
+	if GetImportedMessage(message.ChatID, message.MessageID, db) != nil {
+		return false, nil
+	}
+	senderId := 0
+	if sender != nil {
+		senderId = int(sender.ID)
+	}
+	text := message.Text
+	if text == "" {
+		text = "[" + path.Base(message.Media) + "]"
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		question := Question{}
+		if message.ReplyTo != 0 {
+			if replied := GetImportedMessage(message.ChatID, message.ReplyTo, tx); replied != nil {
+				tx.First(&question, replied.QuestionID)
+			}
+		}
+		if question.ID == 0 {
+			question = Question{Header: text, UserID: senderId, IsClosed: true, ClosedAt: &message.Date}
+			question.CreatedAt, question.UpdatedAt = message.Date, message.Date
+			if err := tx.Create(&question).Error; err != nil {
+				return err
+			}
+			if err := assignNumber(&question, tx); err != nil {
+				return err
+			}
+		} else {
+			corr := QuestionCorrespondence{QuestionID: int(question.ID), UserID: senderId, IsEmployee: senderId != question.UserID, Text: text}
+			corr.CreatedAt, corr.UpdatedAt = message.Date, message.Date
+			if err := tx.Create(&corr).Error; err != nil {
+				return err
+			}
+			changes := map[string]interface{}{"updated_at": message.Date, "closed_at": message.Date}
+			if corr.IsEmployee {
+				changes["have_answer"] = true
+				if question.AnswererID == 0 {
+					changes["answerer_id"] = senderId
+				}
+			}
+			if err := tx.Model(&question).Updates(changes).Error; err != nil {
+				return err
+			}
+		}
+		message.QuestionID = int(question.ID)
+		return tx.Create(message).Error
+	})
+	return err == nil, l.Err(err)
+}
+
+// GetFirstSharedItem returns the first contact, location or venue of the Question, nil if there is none
+func GetFirstSharedItem(question *Question, db *gorm.DB) *SharedItem {
+	item := SharedItem{}
+	err := db.Where("question_id = ?", question.ID).Order("id asc").First(&item).Error
+	if err != nil || item.ID == 0 {
+		return nil
+	}
+	return &item
+}
+
+// AddTemplate creates the Template, a Template with the name must not exist
+func AddTemplate(name, text string, author *User, db *gorm.DB) error {
+	return l.Err(db.Create(&Template{Name: name, Text: text, AuthorID: int(author.ID)}).Error)
+}
+
+// GetTemplate returns the Template by name, nil if there is none
+func GetTemplate(name string, db *gorm.DB) *Template {
+	template := Template{}
+	err := db.Where("name = ?", name).First(&template).Error
+	if err != nil || template.ID == 0 {
+		return nil
+	}
+	return &template
+}
+
+// GetTemplates returns all Templates by name
+func GetTemplates(db *gorm.DB) []Template {
+	templates := []Template{}
+	err := db.Order("name asc").Find(&templates).Error
+	if err != nil || len(templates) == 0 {
+		return nil
+	}
+	return templates
+}
+
+// RemoveTemplate deletes the Template, the name can be used again
+func RemoveTemplate(template *Template, db *gorm.DB) error {
+	return l.Err(db.Unscoped().Delete(template).Error)
+}
@@ -0,0 +1,177 @@
+package database
+
+import (
+	"strconv"
+	l "telegram-bot-feedback/internal/pkg/logger"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SnapshotVersion is the version of the Snapshot format, RestoreSnapshot refuses newer ones
+const SnapshotVersion = 1
+
+// Snapshot is the state needed to bring the bot back after the store is lost
+//
+// It holds the runtime settings, employees, bans and the index of open Questions, not the message content
+type Snapshot struct {
+	Version   int                `json:"version"`
+	CreatedAt time.Time          `json:"created_at"`
+	Settings  []SnapshotSetting  `json:"settings"`
+	Users     []SnapshotUser     `json:"users"`
+	Questions []SnapshotQuestion `json:"questions"`
+	// LastNumber is the last ticket number, closed Questions are not in the Snapshot but their numbers are not given again
+	LastNumber int `json:"last_number,omitempty"`
+}
+
+// SnapshotSetting is a Setting in the Snapshot
+type SnapshotSetting struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// SnapshotUser is an employee, a banned User or the User of an open Question
+type SnapshotUser struct {
+	ChatID     int        `json:"chat_id"`
+	IsEmployee bool       `json:"is_employee,omitempty"`
+	IsReceiver bool       `json:"is_receiver,omitempty"`
+	Role       string     `json:"role,omitempty"`
+	IsBanned   bool       `json:"is_banned,omitempty"`
+	BanReason  string     `json:"ban_reason,omitempty"`
+	BannedAt   *time.Time `json:"banned_at,omitempty"`
+}
+
+// SnapshotQuestion is an open Question without its text
+type SnapshotQuestion struct {
+	ID             uint      `json:"id"`
+	CreatedAt      time.Time `json:"created_at"`
+	UserChatID     int       `json:"user_chat_id"`
+	AnswererChatID int       `json:"answerer_chat_id,omitempty"`
+	HaveAnswer     bool      `json:"have_answer,omitempty"`
+	TicketID       string    `json:"ticket_id,omitempty"`
+	CategoryID     int       `json:"category_id,omitempty"`
+	Number         int       `json:"number,omitempty"`
+}
+
+// TakeSnapshot returns the Snapshot of the store
+func TakeSnapshot(db *gorm.DB) (*Snapshot, error) {
+	snapshot := Snapshot{Version: SnapshotVersion, CreatedAt: time.Now().UTC()}
+	settings := []Setting{}
+	err := db.Where("key <> ? AND value <> ?", BusySetting, "").Order("key asc").Find(&settings).Error
+	if err != nil {
+		return nil, l.Err(err)
+	}
+	for _, s := range settings {
+		snapshot.Settings = append(snapshot.Settings, SnapshotSetting{Key: s.Key, Value: s.Value})
+	}
+	err = db.Raw("SELECT "+nextNumber+" - 1", LastNumberSetting).Scan(&snapshot.LastNumber).Error
+	if err != nil {
+		return nil, l.Err(err)
+	}
+	questions := []Question{}
+	err = db.Preload("User").Preload("Answerer").Where("is_closed = ?", false).Order("id asc").Find(&questions).Error
+	if err != nil {
+		return nil, l.Err(err)
+	}
+	users := []User{}
+	err = db.Where("is_employee = ? OR is_banned = ? OR id IN (?)", true, true,
+		db.Model(&Question{}).Select("user_id").Where("is_closed = ?", false)).Order("id asc").Find(&users).Error
+	if err != nil {
+		return nil, l.Err(err)
+	}
+	for _, u := range users {
+		snapshot.Users = append(snapshot.Users, SnapshotUser{
+			ChatID:     u.ChatID,
+			IsEmployee: u.IsEmployee,
+			IsReceiver: u.IsReceiver,
+			Role:       u.Role,
+			IsBanned:   u.IsBanned,
+			BanReason:  u.BanReason,
+			BannedAt:   u.BannedAt,
+		})
+	}
+	for _, q := range questions {
+		question := SnapshotQuestion{
+			ID:         q.ID,
+			CreatedAt:  q.CreatedAt,
+			UserChatID: q.User.ChatID,
+			HaveAnswer: q.HaveAnswer,
+			TicketID:   q.TicketID,
+			CategoryID: q.CategoryID,
+			Number:     q.Number,
+		}
+		if q.AnswererID != 0 {
+			question.AnswererChatID = q.Answerer.ChatID
+		}
+		snapshot.Questions = append(snapshot.Questions, question)
+	}
+	return &snapshot, nil
+}
+
+// RestoreSnapshot fills the empty store from the Snapshot
+//
+// Questions keep their IDs and ticket numbers, so references stay valid. New ticket numbers continue
+// after the last one of the Snapshot. Snapshots without ticket numbers use the ID, as the numbers were then
+func RestoreSnapshot(snapshot *Snapshot, db *gorm.DB) error {
+	if snapshot.Version > SnapshotVersion {
+		return l.NewError("Unsupported snapshot version " + strconv.Itoa(snapshot.Version) + ", update the bot")
+	}
+	var rows int64
+	db.Model(&User{}).Count(&rows)
+	if rows > 0 {
+		return l.NewError("The store is not empty, restore into a fresh store")
+	}
+	return l.Err(db.Transaction(func(tx *gorm.DB) error {
+		for _, s := range snapshot.Settings {
+			if s.Key == LastNumberSetting {
+				continue
+			}
+			if err := tx.Create(&Setting{Key: s.Key, Value: s.Value}).Error; err != nil {
+				return err
+			}
+		}
+		if snapshot.LastNumber > 0 {
+			if err := tx.Create(&Setting{Key: LastNumberSetting, Value: strconv.Itoa(snapshot.LastNumber)}).Error; err != nil {
+				return err
+			}
+		}
+		ids := map[int]int{}
+		for _, u := range snapshot.Users {
+			user := User{
+				ChatID:     u.ChatID,
+				IsEmployee: u.IsEmployee,
+				IsReceiver: u.IsReceiver,
+				Role:       u.Role,
+				IsBanned:   u.IsBanned,
+				BanReason:  u.BanReason,
+				BannedAt:   u.BannedAt,
+			}
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+			ids[u.ChatID] = int(user.ID)
+		}
+		for _, q := range snapshot.Questions {
+			if ids[q.UserChatID] == 0 {
+				return l.NewError("User " + strconv.Itoa(q.UserChatID) + " of question #" + strconv.Itoa(int(q.ID)) + " is missing in the snapshot")
+			}
+			question := Question{
+				UserID:     ids[q.UserChatID],
+				AnswererID: ids[q.AnswererChatID],
+				HaveAnswer: q.HaveAnswer,
+				TicketID:   q.TicketID,
+				CategoryID: q.CategoryID,
+				Number:     q.Number,
+			}
+			if question.Number == 0 {
+				question.Number = int(q.ID)
+			}
+			question.ID = q.ID
+			question.CreatedAt = q.CreatedAt
+			if err := tx.Omit("User", "Answerer").Create(&question).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+}
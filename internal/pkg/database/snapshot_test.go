@@ -0,0 +1,135 @@
+package database_test
+
+import (
+	"encoding/json"
+	"telegram-bot-feedback/internal/pkg/database"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// memoryStore returns a fresh in-memory store
+func memoryStore(t *testing.T) *gorm.DB {
+	db, err := database.InitMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return closeOnCleanup(t, db)
+}
+
+// snapshotStore fills the store with an employee, a banned user, an open and a closed Question
+func snapshotStore(t *testing.T, db *gorm.DB) *database.Question {
+	t.Helper()
+	if err := database.AddEmployeeByID(db, 2); err != nil {
+		t.Fatal(err)
+	}
+	employee := database.GetUserByChatID(2, db)
+	if err := database.ChangeUserRole("operator", employee, db); err != nil {
+		t.Fatal(err)
+	}
+	banned, _ := database.AddUser(3, "spammer", 0, db)
+	if err := database.ChangeUserIsBanned(true, "spam", banned, db); err != nil {
+		t.Fatal(err)
+	}
+	user, _ := database.AddUser(5, "user5", 0, db)
+	closed, _ := database.AddQuestion("old", 1, user, db)
+	if err := database.ChangeQuestionIsClosed(true, closed, db); err != nil {
+		t.Fatal(err)
+	}
+	open, _ := database.AddQuestion("the app crashes", 2, user, db)
+	if err := database.ChangeQuestionAnswerer(int(employee.ID), open, db); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.ChangeQuestionTicketID("T-7", open, db); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.AddUser(6, "quiet", 0, db); err != nil {
+		t.Fatal(err)
+	}
+	for key, value := range map[string]string{"greeting": "Hi", database.BusySetting: "1", "empty": ""} {
+		if err := database.SetSetting(key, value, db); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return open
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	db := memoryStore(t)
+	open := snapshotStore(t, db)
+	snapshot, err := database.TakeSnapshot(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshot.Version != database.SnapshotVersion || len(snapshot.Settings) != 1 || snapshot.Settings[0].Key != "greeting" {
+		t.Fatalf("snapshot = %+v, want the version and the greeting setting only", snapshot)
+	}
+	if len(snapshot.Users) != 3 || len(snapshot.Questions) != 1 {
+		t.Fatalf("users = %+v, questions = %+v, want the employee, the banned user and the user of the open question", snapshot.Users, snapshot.Questions)
+	}
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := &database.Snapshot{}
+	if err := json.Unmarshal(data, decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := memoryStore(t)
+	if err := database.RestoreSnapshot(decoded, restored); err != nil {
+		t.Fatal(err)
+	}
+	question := database.GetQuestionById(int(open.ID), restored)
+	if question == nil || question.User.ChatID != 5 || question.Answerer.ChatID != 2 || question.TicketID != "T-7" || question.IsClosed {
+		t.Fatalf("question = %+v", question)
+	}
+	if question.Header != "" {
+		t.Fatalf("header = %q, the message content is not in the snapshot", question.Header)
+	}
+	if employee := database.GetUserByChatID(2, restored); employee == nil || !employee.IsEmployee || employee.Role != "operator" {
+		t.Fatalf("employee = %+v", employee)
+	}
+	if banned := database.GetUserByChatID(3, restored); banned == nil || !banned.IsBanned || banned.BanReason != "spam" || banned.BannedAt == nil {
+		t.Fatalf("banned = %+v", banned)
+	}
+	if database.GetUserByChatID(6, restored) != nil {
+		t.Fatal("a user without open questions is in the snapshot")
+	}
+	if got := database.GetSetting("greeting", restored); got != "Hi" {
+		t.Fatalf("greeting = %q", got)
+	}
+	user := database.GetUserByChatID(5, restored)
+	next, err := database.AddQuestion("next", 3, user, restored)
+	if err != nil || next.ID <= open.ID {
+		t.Fatalf("next question = %+v, %v, want a number after the restored ones", next, err)
+	}
+}
+
+func TestRestoreSnapshotRefuses(t *testing.T) {
+	db := memoryStore(t)
+	snapshotStore(t, db)
+	snapshot, err := database.TakeSnapshot(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.RestoreSnapshot(snapshot, db); err == nil || err.Error() != "The store is not empty, restore into a fresh store" {
+		t.Fatalf("restore into a used store err = %v", err)
+	}
+
+	newer := *snapshot
+	newer.Version = database.SnapshotVersion + 1
+	fresh := memoryStore(t)
+	if err := database.RestoreSnapshot(&newer, fresh); err == nil || err.Error() != "Unsupported snapshot version 2, update the bot" {
+		t.Fatalf("restore of a newer version err = %v", err)
+	}
+
+	broken := *snapshot
+	broken.Users = broken.Users[:1]
+	if err := database.RestoreSnapshot(&broken, fresh); err == nil {
+		t.Fatal("a question without its user is restored")
+	}
+	if database.GetUserByChatID(2, fresh) != nil {
+		t.Fatal("a failed restore leaves users behind")
+	}
+}
@@ -8,13 +8,37 @@ import (
 
 // Init initializes the SQLite database
 func Init(path string) (*gorm.DB, error) {
+	return open(path, 0)
+}
+
+// InitMemory initializes the in-memory SQLite database, the data is lost on restart
+func InitMemory() (*gorm.DB, error) {
+	// Every connection to ":memory:" is a separate database, so only one is kept open
+	return open(":memory:", 1)
+}
+
+// open opens the database with at most maxConns connections (0 is unlimited) and migrates tables
+func open(path string, maxConns int) (*gorm.DB, error) {
 	db, err := gorm.Open(sqlite.Open(path), &gorm.Config{
 		Logger: logger.Default.LogMode(logger.Silent),
 	})
 	if err != nil {
 		return nil, err
 	}
-	err = db.AutoMigrate(User{}, Review{}, Question{}, QuestionCorrespondence{})
+	if maxConns > 0 {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return nil, err
+		}
+		sqlDB.SetMaxOpenConns(maxConns)
+		sqlDB.SetMaxIdleConns(maxConns)
+	}
+	err = db.AutoMigrate(tables...)
+	if err != nil {
+		return nil, err
+	}
+	// Questions from before ticket numbers were stored keep their ID as the number users know
+	err = db.Exec("UPDATE questions SET number = id WHERE number IS NULL OR number = 0").Error
 	if err != nil {
 		return nil, err
 	}
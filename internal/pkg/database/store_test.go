@@ -0,0 +1,142 @@
+package database_test
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"sort"
+	"strings"
+	"telegram-bot-feedback/internal/pkg/database"
+	"telegram-bot-feedback/internal/pkg/database/storetest"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// closeOnCleanup closes the database with the test
+func closeOnCleanup(t *testing.T, db *gorm.DB) *gorm.DB {
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	return db
+}
+
+func TestSQLiteMemoryStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) *gorm.DB {
+		db, err := database.InitMemory()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return closeOnCleanup(t, db)
+	})
+}
+
+func TestSQLiteStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) *gorm.DB {
+		db, err := database.Init(filepath.Join(t.TempDir(), "database.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return closeOnCleanup(t, db)
+	})
+}
+
+func TestInitNumbersLegacyQuestions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "database.db")
+	db, err := database.Init(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := database.AddUser(1, "user1", 0, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, header := range []string{"first", "second"} {
+		if _, err := database.AddQuestion(header, 5, user, db); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The store of a version without ticket numbers
+	if err := db.Exec("UPDATE questions SET number = 0").Error; err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.Close()
+
+	db, err = database.Init(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	closeOnCleanup(t, db)
+	for id := 1; id <= 2; id++ {
+		if question := database.GetQuestionById(id, db); question.Number != id {
+			t.Fatalf("question %d got ticket %d, want its ID", id, question.Number)
+		}
+	}
+	if next, err := database.AddQuestion("third", 5, user, db); err != nil || next.Number != 3 {
+		t.Fatalf("next ticket = %d, %v", next.Number, err)
+	}
+}
+
+// TestConformanceIsComplete checks that every database function has a conformance case
+func TestConformanceIsComplete(t *testing.T) {
+	files, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	functions := map[string]bool{}
+	fset := token.NewFileSet()
+	for _, name := range files {
+		if strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		file, err := parser.ParseFile(fset, name, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, decl := range file.Decls {
+			if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv == nil && fn.Name.IsExported() && takesDB(fn) {
+				functions[fn.Name.Name] = true
+			}
+		}
+	}
+	covered := storetest.Covered()
+	var missing, unknown []string
+	for name := range functions {
+		if !covered[name] {
+			missing = append(missing, name)
+		}
+	}
+	for name := range covered {
+		if !functions[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(missing)
+	sort.Strings(unknown)
+	if len(missing) > 0 {
+		t.Errorf("functions without a conformance case: %s", strings.Join(missing, ", "))
+	}
+	if len(unknown) > 0 {
+		t.Errorf("conformance cases of unknown functions: %s", strings.Join(unknown, ", "))
+	}
+}
+
+// takesDB reports whether the function has a *gorm.DB parameter
+func takesDB(fn *ast.FuncDecl) bool {
+	for _, field := range fn.Type.Params.List {
+		star, ok := field.Type.(*ast.StarExpr)
+		if !ok {
+			continue
+		}
+		if sel, ok := star.X.(*ast.SelectorExpr); ok && sel.Sel.Name == "DB" {
+			if pkg, ok := sel.X.(*ast.Ident); ok && pkg.Name == "gorm" {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,215 @@
+package storetest
+
+import (
+	"telegram-bot-feedback/internal/pkg/database"
+	"testing"
+	"time"
+)
+
+// TestMessageLinks checks links of employee chat messages to Questions
+func TestMessageLinks(t *testing.T, open Factory) {
+	db := open(t)
+	user := addUser(t, 1, db)
+	question := database.GetQuestionById(int(addQuestion(t, "help", user, db).ID), db)
+	if database.GetMessageLink(2, 100, db) != nil || database.GetQuestionMessageLink(2, question, db) != nil {
+		t.Fatal("an empty store has message links")
+	}
+	check(t, database.AddMessageLink(2, 0, 100, question, db))
+	check(t, database.AddMessageLink(2, 0, 101, question, db))
+	check(t, database.AddMessageLink(-100500, 77, 5, question, db))
+
+	link := database.GetMessageLink(2, 101, db)
+	if link == nil || link.QuestionID != int(question.ID) || link.UserChatID != 1 || link.IsPinned {
+		t.Fatalf("link = %+v", link)
+	}
+	if first := database.GetQuestionMessageLink(2, question, db); first == nil || first.MessageID != 100 {
+		t.Fatalf("first link = %+v, want message 100", first)
+	}
+	if topic := database.GetMessageLink(-100500, 5, db); topic == nil || topic.ThreadID != 77 {
+		t.Fatalf("topic link = %+v", topic)
+	}
+	// The new Question is linked before it is read back
+	check(t, database.AddMessageLink(2, 0, 102, addQuestion(t, "new", user, db), db))
+	if fresh := database.GetMessageLink(2, 102, db); fresh == nil || fresh.UserChatID != 1 {
+		t.Fatalf("link of the new question = %+v", fresh)
+	}
+	if database.GetMessageLink(3, 100, db) != nil {
+		t.Fatal("a link of another chat is returned")
+	}
+	check(t, database.ChangeMessageLinkPinned(true, link, db))
+	if !database.GetMessageLink(2, 101, db).IsPinned {
+		t.Fatal("the pin is not stored")
+	}
+}
+
+// TestLinks checks tracked links
+func TestLinks(t *testing.T, open Factory) {
+	db := open(t)
+	if database.GetLinkByCode("abc", db) != nil || database.GetLinkStats(db) != nil {
+		t.Fatal("an empty store has links")
+	}
+	check(t, database.AddLink("a", "https://example.com", 1, "answer", db))
+	check(t, database.AddLink("b", "https://example.com", 2, "answer", db))
+	check(t, database.AddLink("c", "https://docs.example.com", 3, "template", db))
+	if database.AddLink("a", "https://other.example.com", 4, "answer", db) == nil {
+		t.Fatal("a duplicate code is accepted")
+	}
+	docs := database.GetLinkByCode("c", db)
+	if docs == nil || docs.Target != "https://docs.example.com" || docs.QuestionID != 3 {
+		t.Fatalf("link = %+v", docs)
+	}
+	for i := 0; i < 3; i++ {
+		check(t, database.AddLinkClick(docs, db))
+	}
+	check(t, database.AddLinkClick(database.GetLinkByCode("a", db), db))
+	stats := database.GetLinkStats(db)
+	want := []database.LinkStats{
+		{Target: "https://docs.example.com", Source: "template", Links: 1, Clicks: 3},
+		{Target: "https://example.com", Source: "answer", Links: 2, Clicks: 1},
+	}
+	if len(stats) != 2 || stats[0] != want[0] || stats[1] != want[1] {
+		t.Fatalf("stats = %+v, want %+v", stats, want)
+	}
+}
+
+// TestOutbox checks the delivery queue
+func TestOutbox(t *testing.T, open Factory) {
+	db := open(t)
+	now := time.Now()
+	if database.HasOutboxMessages(1, db) || len(database.GetDueOutboxMessages(now, db)) != 0 || database.GetDeadOutboxMessages(10, db) != nil {
+		t.Fatal("an empty store has outbox messages")
+	}
+	if stats := database.GetOutboxStats(db); stats != (database.OutboxStats{}) {
+		t.Fatalf("stats of an empty store = %+v", stats)
+	}
+	check(t, database.AddOutboxMessage(1, "sendMessage", `{"text":"first"}`, 5, now.Add(-time.Minute), db))
+	check(t, database.AddOutboxMessage(1, "sendMessage", `{"text":"second"}`, 5, now.Add(-time.Minute), db))
+	check(t, database.AddOutboxMessage(2, "copyMessage", `{}`, 6, now.Add(time.Minute), db))
+	if !database.HasOutboxMessages(1, db) || database.HasOutboxMessages(3, db) {
+		t.Fatal("chats with waiting messages")
+	}
+
+	// Only the oldest message of a chat is due, the order of a chat is kept
+	due := database.GetDueOutboxMessages(now, db)
+	if len(due) != 1 || due[0].Payload != `{"text":"first"}` {
+		t.Fatalf("due = %+v, want the first message of chat 1", due)
+	}
+	first := due[0]
+	check(t, database.ChangeOutboxMessageAttempt("timeout", now.Add(time.Hour), &first, db))
+	if len(database.GetDueOutboxMessages(now, db)) != 0 {
+		t.Fatal("a message waits behind the retried one")
+	}
+	check(t, database.ChangeOutboxMessageIsDead("forbidden", &first, db))
+	due = database.GetDueOutboxMessages(now, db)
+	if len(due) != 1 || due[0].Payload != `{"text":"second"}` {
+		t.Fatalf("due = %+v, want the second message after the first is dead", due)
+	}
+	check(t, database.RemoveOutboxMessage(&due[0], db))
+	if database.HasOutboxMessages(1, db) {
+		t.Fatal("chat 1 has waiting messages")
+	}
+
+	if stats := database.GetOutboxStats(db); stats != (database.OutboxStats{Pending: 1, Dead: 1}) {
+		t.Fatalf("stats = %+v", stats)
+	}
+	dead := database.GetDeadOutboxMessages(10, db)
+	if len(dead) != 1 || dead[0].Attempts != 2 || dead[0].Error != "forbidden" || !dead[0].IsDead {
+		t.Fatalf("dead = %+v", dead)
+	}
+	if due := database.GetDueOutboxMessages(now.Add(2*time.Minute), db); len(due) != 1 || due[0].ChatID != 2 {
+		t.Fatalf("due later = %+v", due)
+	}
+}
+
+// TestQuietMessages checks messages held for quiet hours
+func TestQuietMessages(t *testing.T, open Factory) {
+	db := open(t)
+	now := time.Now()
+	if database.GetDueQuietMessages(now, db) != nil || database.CountQuietMessages(db) != 0 {
+		t.Fatal("an empty store has held messages")
+	}
+	check(t, database.AddQuietMessage(1, "sendMessage", "status 1", 5, true, now.Add(-time.Minute), db))
+	check(t, database.AddQuietMessage(1, "sendMessage", "answer", 5, false, now.Add(-time.Minute), db))
+	check(t, database.AddQuietMessage(1, "sendMessage", "status 2", 5, true, now.Add(-time.Minute), db))
+	check(t, database.AddQuietMessage(2, "sendMessage", "later", 6, true, now.Add(time.Hour), db))
+	if got := database.CountQuietMessages(db); got != 3 {
+		t.Fatalf("held = %d, want 3, the status replaces the previous one", got)
+	}
+	due := database.GetDueQuietMessages(now, db)
+	if len(due) != 2 || due[0].Payload != "status 2" || due[1].Payload != "answer" {
+		t.Fatalf("due = %+v, want the replaced status in its place", due)
+	}
+	check(t, database.RemoveQuietMessage(&due[0], db))
+	if got := database.CountQuietMessages(db); got != 2 {
+		t.Fatalf("held = %d after the release", got)
+	}
+}
+
+// TestChatCapabilities checks the recorded type of chats
+func TestChatCapabilities(t *testing.T, open Factory) {
+	db := open(t)
+	if database.GetChatCapability(-123, db) != nil {
+		t.Fatal("an empty store has chats")
+	}
+	checked := time.Now().Add(-time.Minute).Truncate(time.Second)
+	previous, err := database.SetChatCapability(-123, "group", false, checked, db)
+	check(t, err)
+	if previous != nil {
+		t.Fatalf("previous = %+v for the first record", previous)
+	}
+	previous, err = database.SetChatCapability(-123, "supergroup", true, checked.Add(time.Minute), db)
+	check(t, err)
+	if previous == nil || previous.Type != "group" || previous.IsForum {
+		t.Fatalf("previous = %+v, want the group", previous)
+	}
+	capability := database.GetChatCapability(-123, db)
+	if capability == nil || capability.Type != "supergroup" || !capability.IsForum || !capability.CheckedAt.Equal(checked.Add(time.Minute)) {
+		t.Fatalf("capability = %+v", capability)
+	}
+
+	check(t, database.ChangeChatMigratedTo(-123, -100123, db))
+	check(t, database.ChangeChatMigratedTo(-5, -1005, db))
+	if migrated := database.GetChatCapability(-123, db); migrated.MigratedTo != -100123 || migrated.Type != "supergroup" {
+		t.Fatalf("migrated = %+v, the type is kept", migrated)
+	}
+	if unknown := database.GetChatCapability(-5, db); unknown == nil || unknown.MigratedTo != -1005 {
+		t.Fatalf("migration of an unrecorded chat = %+v", unknown)
+	}
+}
+
+// TestUserTopics checks forum topics of Users
+func TestUserTopics(t *testing.T, open Factory) {
+	db := open(t)
+	if database.GetUserTopic(-100, 1, db) != nil || database.GetUserTopicByThread(-100, 7, db) != nil {
+		t.Fatal("an empty store has topics")
+	}
+	topic, err := database.AddUserTopic(-100, 1, 7, db)
+	check(t, err)
+	_, err = database.AddUserTopic(-100, 2, 8, db)
+	check(t, err)
+	_, err = database.AddUserTopic(-200, 1, 7, db)
+	check(t, err)
+	if _, err := database.AddUserTopic(-100, 1, 9, db); err == nil {
+		t.Fatal("a second topic of the user in the chat is accepted")
+	}
+	if got := database.GetUserTopic(-100, 1, db); got == nil || got.ThreadID != 7 {
+		t.Fatalf("topic = %+v", got)
+	}
+	if got := database.GetUserTopicByThread(-100, 8, db); got == nil || got.UserID != 2 {
+		t.Fatalf("topic by thread = %+v", got)
+	}
+	check(t, database.RemoveUserTopic(topic, db))
+	if database.GetUserTopic(-100, 1, db) != nil {
+		t.Fatal("the removed topic is left")
+	}
+	if _, err := database.AddUserTopic(-100, 1, 9, db); err != nil {
+		t.Fatalf("a new topic after the removed one: %v", err)
+	}
+	check(t, database.RemoveUserTopics(-100, db))
+	if database.GetUserTopic(-100, 1, db) != nil || database.GetUserTopic(-100, 2, db) != nil {
+		t.Fatal("topics of the chat are left")
+	}
+	if database.GetUserTopic(-200, 1, db) == nil {
+		t.Fatal("topics of another chat are removed")
+	}
+}
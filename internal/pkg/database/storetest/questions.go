@@ -0,0 +1,468 @@
+package storetest
+
+import (
+	"strings"
+	"sync"
+	"telegram-bot-feedback/internal/pkg/database"
+	"testing"
+	"time"
+)
+
+// TestQuestions checks the life of a Question
+func TestQuestions(t *testing.T, open Factory) {
+	db := open(t)
+	user, employee := addUser(t, 1, db), addEmployee(t, 2, db)
+	if database.GetQuestionById(1, db) != nil || database.GetOpenQuestionByUser(user, db) != nil ||
+		database.GetOpenQuestionByAnswerer(employee, db) != nil || database.GetNewQuestionById(1, db) != nil ||
+		database.GetNewQuestions(db) != nil || database.GetNewQuestionsBefore(time.Now(), db) != nil ||
+		database.GetQuestionsInRange(time.Now().Add(time.Hour), time.Now().Add(-time.Hour), db) != nil ||
+		database.GetUserQuestionByNumber(1, user, db) != nil {
+		t.Fatal("an empty store has questions")
+	}
+
+	check(t, database.ChangeUserCategory(4, user, db))
+	first := addQuestion(t, "first", user, db)
+	second := addQuestion(t, "second", addUser(t, 3, db), db)
+	if first.ID == 0 || second.ID <= first.ID {
+		t.Fatalf("question IDs %d, %d, want increasing", first.ID, second.ID)
+	}
+	if first.Number == 0 || second.Number != first.Number+1 {
+		t.Fatalf("ticket numbers %d, %d, want consecutive", first.Number, second.Number)
+	}
+	stored := database.GetQuestionById(int(first.ID), db)
+	if stored == nil || stored.Header != "first" || stored.User.ChatID != 1 || stored.CategoryID != 4 || stored.IsClosed {
+		t.Fatalf("stored question = %+v", stored)
+	}
+	if open := database.GetOpenQuestionByUser(user, db); open == nil || open.ID != first.ID {
+		t.Fatalf("open question of the user = %+v", open)
+	}
+	if !sameIDs(database.GetNewQuestions(db), first.ID, second.ID) {
+		t.Fatalf("new questions = %v", questionIDs(database.GetNewQuestions(db)))
+	}
+	if !sameIDs(database.GetNewQuestionsBefore(time.Now().Add(time.Minute), db), first.ID, second.ID) ||
+		database.GetNewQuestionsBefore(time.Now().Add(-time.Minute), db) != nil {
+		t.Fatal("new questions before the date")
+	}
+	if !sameIDs(database.GetQuestionsInRange(time.Now().Add(time.Hour), time.Now().Add(-time.Hour), db), first.ID, second.ID) {
+		t.Fatal("questions in the range")
+	}
+
+	check(t, database.ChangeQuestionAnswerer(int(employee.ID), first, db))
+	if database.GetNewQuestionById(int(first.ID), db) != nil || !sameIDs(database.GetNewQuestions(db), second.ID) {
+		t.Fatal("a taken question is new")
+	}
+	if taken := database.GetOpenQuestionByAnswerer(employee, db); taken == nil || taken.ID != first.ID || taken.Answerer.ChatID != 2 {
+		t.Fatalf("question of the answerer = %+v", taken)
+	}
+	check(t, database.ChangeQuestionHaveAnswer(true, second, db))
+	if database.GetNewQuestionById(int(second.ID), db) != nil {
+		t.Fatal("an answered question is new")
+	}
+	check(t, database.ChangeQuestionHaveAnswer(false, second, db))
+	if database.GetNewQuestionById(int(second.ID), db) == nil {
+		t.Fatal("a question waiting for an answer again is not new")
+	}
+	check(t, database.ChangeQuestionTicketID("T-1", first, db))
+	check(t, database.ChangeQuestionIsClosed(true, first, db))
+	if database.GetOpenQuestionByUser(user, db) != nil || database.GetOpenQuestionByAnswerer(employee, db) != nil {
+		t.Fatal("a closed question is open")
+	}
+	if stored := database.GetQuestionById(int(first.ID), db); !stored.IsClosed || stored.TicketID != "T-1" {
+		t.Fatalf("closed question = %+v", stored)
+	}
+
+	if own := database.GetUserQuestionByNumber(first.Number, user, db); own == nil || own.ID != first.ID {
+		t.Fatal("the question of the user is not found")
+	}
+	if database.GetUserQuestionByNumber(second.Number, user, db) != nil {
+		t.Fatal("the question of another user is returned")
+	}
+
+	// Ticket numbers are never given twice, even when new Questions are asked at once
+	const askers = 8
+	var wg sync.WaitGroup
+	numbers := make(chan int, askers)
+	for i := 0; i < askers; i++ {
+		asker := addUser(t, 10+i, db)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			question, err := database.AddQuestion("at once", 5, asker, db)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			numbers <- question.Number
+		}()
+	}
+	wg.Wait()
+	close(numbers)
+	seen := map[int]bool{first.Number: true, second.Number: true}
+	for number := range numbers {
+		if number == 0 || seen[number] {
+			t.Fatalf("ticket number %d is given twice", number)
+		}
+		seen[number] = true
+	}
+}
+
+// TestUserQuestions checks the history of a User and its retention by the close time
+func TestUserQuestions(t *testing.T, open Factory) {
+	db := open(t)
+	user := addUser(t, 1, db)
+	if database.GetUserQuestions(user, time.Time{}, 10, db) != nil {
+		t.Fatal("a user without questions has history")
+	}
+	closed := addQuestion(t, "closed", user, db)
+	check(t, database.ChangeQuestionIsClosed(true, closed, db))
+	open1 := addQuestion(t, "open", user, db)
+	addQuestion(t, "other", addUser(t, 2, db), db)
+
+	if got := database.GetUserQuestions(user, time.Now().Add(-time.Hour), 10, db); !sameIDs(got, open1.ID, closed.ID) {
+		t.Fatalf("history = %v, want the newest first", questionIDs(got))
+	}
+	if got := database.GetUserQuestions(user, time.Now().Add(time.Hour), 10, db); !sameIDs(got, open1.ID) {
+		t.Fatalf("history = %v, closed questions out of the retention are skipped, open ones are kept", questionIDs(got))
+	}
+	if got := database.GetUserQuestions(user, time.Now().Add(-time.Hour), 1, db); !sameIDs(got, open1.ID) {
+		t.Fatalf("history = %v, want the limit", questionIDs(got))
+	}
+
+	// The retention counts from the close time, not from the creation
+	old := time.Now().AddDate(0, 0, -40)
+	check(t, db.Model(&database.Question{}).Where("id IN ?", []uint{closed.ID, open1.ID}).UpdateColumn("created_at", old).Error)
+	if got := database.GetUserQuestions(user, time.Now().AddDate(0, 0, -30), 10, db); !sameIDs(got, open1.ID, closed.ID) {
+		t.Fatalf("history = %v, a long question closed today is kept", questionIDs(got))
+	}
+	check(t, db.Model(closed).UpdateColumn("closed_at", old.Add(time.Hour)).Error)
+	if got := database.GetUserQuestions(user, time.Now().AddDate(0, 0, -30), 10, db); !sameIDs(got, open1.ID) {
+		t.Fatalf("history = %v, a question closed 40 days ago is skipped", questionIDs(got))
+	}
+	if database.GetUserQuestionByNumber(closed.Number, user, db) == nil {
+		t.Fatal("a question out of the retention is not found by ID")
+	}
+
+	// Reopening clears the close time and closing again keeps the first one
+	check(t, database.ChangeQuestionIsClosed(false, closed, db))
+	if closed.ClosedAt != nil {
+		t.Fatalf("reopened question is closed at %v", closed.ClosedAt)
+	}
+	check(t, database.ChangeQuestionIsClosed(true, closed, db))
+	first := *closed.ClosedAt
+	check(t, database.ChangeQuestionIsClosed(true, closed, db))
+	if stored := database.GetQuestionById(int(closed.ID), db); stored.ClosedAt == nil || !stored.ClosedAt.Equal(first) {
+		t.Fatalf("closed at %v, want %v", stored.ClosedAt, first)
+	}
+
+	// Questions closed before the close time was stored use their last change
+	check(t, db.Model(closed).UpdateColumns(map[string]interface{}{"closed_at": nil, "updated_at": old}).Error)
+	if got := database.GetUserQuestions(user, time.Now().AddDate(0, 0, -30), 10, db); !sameIDs(got, open1.ID) {
+		t.Fatalf("history = %v, want the last change as the close time", questionIDs(got))
+	}
+}
+
+// TestAwaitingReply checks Questions waiting for the reply of the answerer
+func TestAwaitingReply(t *testing.T, open Factory) {
+	db := open(t)
+	if database.GetQuestionsAwaitingReplyBefore(time.Now(), db) != nil {
+		t.Fatal("an empty store has questions awaiting a reply")
+	}
+	employee := addEmployee(t, 2, db)
+	taken, untaken := addQuestion(t, "taken", addUser(t, 1, db), db), addQuestion(t, "untaken", addUser(t, 3, db), db)
+	check(t, database.ChangeQuestionAnswerer(int(employee.ID), taken, db))
+	since := time.Now().Add(-time.Hour)
+	check(t, database.ChangeQuestionAwaitingReplySince(&since, taken, db))
+	check(t, database.ChangeQuestionAwaitingReplySince(&since, untaken, db))
+
+	waiting := database.GetQuestionsAwaitingReplyBefore(time.Now().Add(-time.Minute), db)
+	if !sameIDs(waiting, taken.ID) || waiting[0].User.ChatID != 1 || waiting[0].Answerer.ChatID != 2 {
+		t.Fatalf("waiting = %+v, want the taken question with its users", waiting)
+	}
+	if database.GetQuestionsAwaitingReplyBefore(time.Now().Add(-2*time.Hour), db) != nil {
+		t.Fatal("a question waiting since later is returned")
+	}
+	check(t, database.ChangeQuestionAwaitingReplySince(nil, taken, db))
+	if database.GetQuestionsAwaitingReplyBefore(time.Now(), db) != nil {
+		t.Fatal("a question is waiting after it is cleared")
+	}
+
+	check(t, database.ChangeQuestionAwaitingReplySince(&since, taken, db))
+	released := database.GetQuestionsAwaitingReplyBefore(time.Now(), db)[0]
+	check(t, database.ChangeQuestionAnswerer(0, &released, db))
+	if stored := database.GetQuestionById(int(taken.ID), db); stored.AnswererID != 0 {
+		t.Fatalf("answerer = %d after releasing a question with its answerer loaded", stored.AnswererID)
+	}
+}
+
+// TestCorrespondence checks the messages of a Question
+func TestCorrespondence(t *testing.T, open Factory) {
+	db := open(t)
+	user, employee := addUser(t, 1, db), addEmployee(t, 2, db)
+	corr, err := database.AddCorrespondence(user, 10, "nothing open", db)
+	check(t, err)
+	if corr != nil {
+		t.Fatal("correspondence without an open question is stored")
+	}
+	question := addQuestion(t, "help", user, db)
+	if database.GetCorrespondenceByQuestion(question, db) != nil || database.GetLastEmployeeReply(question, db) != nil {
+		t.Fatal("a new question has correspondence")
+	}
+
+	_, err = database.AddCorrespondence(user, 10, "hello", db)
+	check(t, err)
+	check(t, database.ChangeQuestionAnswerer(int(employee.ID), question, db))
+	_, err = database.AddCorrespondence(employee, 11, "hi", db)
+	check(t, err)
+	_, err = database.AddCorrespondenceToQuestion(question, user, 12, "more", db)
+	check(t, err)
+	check(t, database.AppendCorrespondenceText(int(question.ID), 12, " text", db))
+	check(t, database.AppendCorrespondenceText(int(question.ID), 99, " lost", db))
+
+	all := database.GetCorrespondenceByQuestion(question, db)
+	if len(all) != 3 || all[0].Text != "hello" || all[1].Text != "hi" || all[2].Text != "more text" || all[1].User.ChatID != 2 {
+		t.Fatalf("correspondence = %+v", all)
+	}
+	if reply := database.GetLastEmployeeReply(question, db); reply == nil || reply.Text != "hi" {
+		t.Fatalf("last employee reply = %+v", reply)
+	}
+	check(t, database.AddPartnerCorrespondence(question, "partner", db))
+	if reply := database.GetLastEmployeeReply(question, db); reply == nil || reply.Text != "partner" || reply.UserID != 0 {
+		t.Fatalf("last employee reply = %+v, want the partner reply without a user", reply)
+	}
+	if got := len(database.GetCorrespondenceByQuestion(question, db)); got != 4 {
+		t.Fatalf("correspondence = %d messages, want 4", got)
+	}
+}
+
+// TestDialog checks the dialog with a User
+func TestDialog(t *testing.T, open Factory) {
+	db := open(t)
+	if database.ListDialog(1, database.DialogOptions{}, db) != nil {
+		t.Fatal("a user without questions has a dialog")
+	}
+	user, employee := addUser(t, 1, db), addEmployee(t, 2, db)
+	question, err := database.AddQuestion("help", 10, user, db)
+	check(t, err)
+	// The first message is the header, its correspondence is not repeated
+	_, err = database.AddCorrespondenceToQuestion(question, user, 10, "help", db)
+	check(t, err)
+	_, err = database.AddCorrespondenceToQuestion(question, employee, 11, "answer", db)
+	check(t, err)
+	_, err = database.AddCorrespondenceToQuestion(question, user, 12, "thanks", db)
+	check(t, err)
+
+	dialog := database.ListDialog(int(user.ID), database.DialogOptions{}, db)
+	if len(dialog) != 3 || dialog[0].Text != "help" || dialog[1].Text != "answer" || !dialog[1].FromEmployee || dialog[2].Text != "thanks" {
+		t.Fatalf("dialog = %+v", dialog)
+	}
+	if last := database.ListDialog(int(user.ID), database.DialogOptions{Limit: 1}, db); len(last) != 1 || last[0].Text != "thanks" {
+		t.Fatalf("the last message = %+v", last)
+	}
+	if len(database.ListDialog(int(user.ID), database.DialogOptions{To: dialog[0].Time}, db)) != 0 {
+		t.Fatal("messages before the first one")
+	}
+	if later := database.ListDialog(int(user.ID), database.DialogOptions{From: dialog[1].Time}, db); len(later) != 2 {
+		t.Fatalf("messages from the answer = %+v", later)
+	}
+}
+
+// TestQuestionFields checks custom fields
+func TestQuestionFields(t *testing.T, open Factory) {
+	db := open(t)
+	question := addQuestion(t, "help", addUser(t, 1, db), db)
+	if database.GetQuestionFields(question, db) != nil || database.GetQuestionsByField("os", "android", db) != nil {
+		t.Fatal("a new question has fields")
+	}
+	check(t, database.SetQuestionField(question, "os", "ios", 0, db))
+	check(t, database.SetQuestionField(question, "os", "android", 0, db))
+	check(t, database.SetQuestionField(question, "order", "12.5", 12.5, db))
+	fields := database.GetQuestionFields(question, db)
+	if len(fields) != 2 || fields[0].Value != "android" || fields[1].Number != 12.5 {
+		t.Fatalf("fields = %+v, a field is set once", fields)
+	}
+	if !sameIDs(database.GetQuestionsByField("os", "android", db), question.ID) || database.GetQuestionsByField("os", "ios", db) != nil {
+		t.Fatal("questions by field")
+	}
+}
+
+// TestSurveys checks satisfaction surveys
+func TestSurveys(t *testing.T, open Factory) {
+	db := open(t)
+	if database.GetQuestionBySurvey("poll", db) != nil {
+		t.Fatal("an empty store has surveys")
+	}
+	if stats := database.GetSurveyStats(time.Time{}, db); stats != (database.SurveyStats{}) {
+		t.Fatalf("stats of an empty store = %+v", stats)
+	}
+	user := addUser(t, 1, db)
+	first, second := addQuestion(t, "first", user, db), addQuestion(t, "second", user, db)
+	check(t, database.ChangeQuestionSurvey("poll1", first, db))
+	check(t, database.ChangeQuestionSurvey("poll2", second, db))
+	check(t, db.Delete(first).Error)
+	// The user can answer the survey of a deleted question
+	found := database.GetQuestionBySurvey("poll1", db)
+	if found == nil || found.ID != first.ID {
+		t.Fatalf("question of the survey = %+v", found)
+	}
+	check(t, database.ChangeQuestionSurveyScore(4, found, db))
+	stats := database.GetSurveyStats(time.Now().Add(-time.Hour), db)
+	if stats.Sent != 2 || stats.Answered != 1 || stats.Average != 4 {
+		t.Fatalf("stats = %+v", stats)
+	}
+	if stats := database.GetSurveyStats(time.Now().Add(time.Hour), db); stats.Sent != 0 {
+		t.Fatalf("stats after the date = %+v", stats)
+	}
+}
+
+// TestTriage checks that concurrent triage changes from the same status have one winner
+func TestTriage(t *testing.T, open Factory) {
+	db := open(t)
+	question := addQuestion(t, "help", addUser(t, 1, db), db)
+	const presses = 8
+	var wg sync.WaitGroup
+	won := make(chan int, presses)
+	for i := 1; i <= presses; i++ {
+		wg.Add(1)
+		go func(by int) {
+			defer wg.Done()
+			copy := *question
+			ok, err := database.ChangeQuestionTriage("status"+string(rune('0'+by)), "", by, &copy, db)
+			if err != nil {
+				t.Error(err)
+			}
+			if ok {
+				won <- by
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(won)
+	var winners []int
+	for by := range won {
+		winners = append(winners, by)
+	}
+	if len(winners) != 1 {
+		t.Fatalf("winners = %v, want one", winners)
+	}
+	stored := database.GetQuestionById(int(question.ID), db)
+	if stored.TriageBy != winners[0] || stored.TriageStatus != "status"+string(rune('0'+winners[0])) {
+		t.Fatalf("stored triage = %q by %d, want the winner %d", stored.TriageStatus, stored.TriageBy, winners[0])
+	}
+	ok, err := database.ChangeQuestionTriage("done", "", 9, question, db)
+	check(t, err)
+	if ok {
+		t.Fatal("a change from a stale status is accepted")
+	}
+	ok, err = database.ChangeQuestionTriage("done", stored.TriageStatus, 9, question, db)
+	check(t, err)
+	if !ok || question.TriageStatus != "done" {
+		t.Fatalf("a change from the current status is refused: %+v", question)
+	}
+}
+
+// TestTags checks tags and the search
+func TestTags(t *testing.T, open Factory) {
+	db := open(t)
+	if database.SearchQuestions([]string{"x"}, 10, db) != nil || database.SearchQuestions(nil, 10, db) != nil {
+		t.Fatal("an empty store has search results")
+	}
+	user := addUser(t, 1, db)
+	billing := addQuestion(t, "charged twice", user, db)
+	percent := addQuestion(t, "100% off_code", user, db)
+	answered := addQuestion(t, "login", user, db)
+	_, err := database.AddCorrespondenceToQuestion(answered, user, 5, "refund please", db)
+	check(t, err)
+	if database.GetQuestionTags(billing, db) != nil {
+		t.Fatal("a new question has tags")
+	}
+
+	check(t, database.AddQuestionTags([]string{"billing", "urgent"}, billing, db))
+	check(t, database.AddQuestionTags([]string{"billing", "android"}, billing, db))
+	if tags := database.GetQuestionTags(billing, db); strings.Join(tags, ",") != "android,billing,urgent" {
+		t.Fatalf("tags = %v, want sorted and once", tags)
+	}
+	check(t, database.RemoveQuestionTags([]string{"urgent"}, billing, db))
+	if tags := database.GetQuestionTags(billing, db); strings.Join(tags, ",") != "android,billing" {
+		t.Fatalf("tags = %v", tags)
+	}
+
+	if got := database.SearchQuestions([]string{"billing", "refund"}, 10, db); !sameIDs(got, answered.ID, billing.ID) || got[0].User.ChatID != 1 {
+		t.Fatalf("search = %v, want the newest first with users", questionIDs(got))
+	}
+	if got := database.SearchQuestions([]string{"bill"}, 10, db); got != nil {
+		t.Fatalf("search = %v, tags match exactly", questionIDs(got))
+	}
+	if got := database.SearchQuestions([]string{"0%"}, 10, db); !sameIDs(got, percent.ID) {
+		t.Fatalf("search = %v, wildcards are literal", questionIDs(got))
+	}
+	if got := database.SearchQuestions([]string{"f_c"}, 10, db); !sameIDs(got, percent.ID) {
+		t.Fatalf("search = %v", questionIDs(got))
+	}
+	if got := database.SearchQuestions([]string{"_"}, 10, db); !sameIDs(got, percent.ID) {
+		t.Fatalf("search = %v, \"_\" matches only itself", questionIDs(got))
+	}
+	if got := database.SearchQuestions([]string{"o"}, 1, db); !sameIDs(got, answered.ID) {
+		t.Fatalf("search = %v, want the limit", questionIDs(got))
+	}
+	check(t, database.RemoveQuestionTags(nil, billing, db))
+	if database.GetQuestionTags(billing, db) != nil {
+		t.Fatal("tags are left after removing all")
+	}
+}
+
+// TestLargeText checks that long texts are stored unchanged
+func TestLargeText(t *testing.T, open Factory) {
+	db := open(t)
+	user := addUser(t, 1, db)
+	text := strings.Repeat("Привет, 世界 👋 ", 1<<16)
+	question := addQuestion(t, text, user, db)
+	check(t, database.AppendQuestionHeader(int(question.ID), text, db))
+	if stored := database.GetQuestionById(int(question.ID), db); stored.Header != text+text {
+		t.Fatalf("header of %d bytes is stored as %d bytes", 2*len(text), len(stored.Header))
+	}
+	_, err := database.AddCorrespondenceToQuestion(question, user, 5, text, db)
+	check(t, err)
+	check(t, database.AppendCorrespondenceText(int(question.ID), 5, "!", db))
+	if corr := database.GetCorrespondenceByQuestion(question, db); len(corr) != 1 || corr[0].Text != text+"!" {
+		t.Fatal("long correspondence is changed")
+	}
+	check(t, database.SetSetting("large", text, db))
+	if database.GetSetting("large", db) != text {
+		t.Fatal("long setting is changed")
+	}
+}
+
+// TestEngineSemantics checks the behaviour which comes from the storage engine rather than from the Go code:
+// ordering by number regardless of the dates, the fallback of a missing close time and a rejected unique key
+func TestEngineSemantics(t *testing.T, open Factory) {
+	db := open(t)
+	user := addUser(t, 1, db)
+	first := addQuestion(t, "first", user, db)
+	second := addQuestion(t, "second", addUser(t, 2, db), db)
+	// The dates go backwards, the order follows the numbers
+	check(t, db.Model(first).UpdateColumn("created_at", time.Now().Add(time.Hour)).Error)
+	if got := database.GetNewQuestions(db); !sameIDs(got, first.ID, second.ID) {
+		t.Fatalf("new questions = %v, want the oldest number first", questionIDs(got))
+	}
+
+	// A NULL close time falls back to the last change, not to the zero time or to the creation
+	check(t, database.ChangeQuestionIsClosed(true, first, db))
+	check(t, db.Model(first).UpdateColumns(map[string]interface{}{"closed_at": nil, "updated_at": time.Now()}).Error)
+	if got := database.GetUserQuestions(user, time.Now().Add(-time.Hour), 10, db); !sameIDs(got, first.ID) {
+		t.Fatalf("history = %v, a question changed now is in the retention", questionIDs(got))
+	}
+	check(t, db.Model(first).UpdateColumn("updated_at", time.Now().AddDate(0, 0, -2)).Error)
+	if got := database.GetUserQuestions(user, time.Now().Add(-time.Hour), 10, db); got != nil {
+		t.Fatalf("history = %v, a question changed 2 days ago is out of the retention", questionIDs(got))
+	}
+
+	// A rejected duplicate keeps the stored row and leaves the store usable
+	check(t, database.AddLink("dup", "https://example.com", int(first.ID), "answer", db))
+	if database.AddLink("dup", "https://other.example.com", int(second.ID), "answer", db) == nil {
+		t.Fatal("a duplicate code is accepted")
+	}
+	if link := database.GetLinkByCode("dup", db); link == nil || link.Target != "https://example.com" || link.QuestionID != int(first.ID) {
+		t.Fatalf("link = %+v, the duplicate changed the stored one", link)
+	}
+	check(t, database.AddLink("next", "https://example.com", int(second.ID), "answer", db))
+}
@@ -0,0 +1,476 @@
+package storetest
+
+import (
+	"sync"
+	"telegram-bot-feedback/internal/pkg/database"
+	"testing"
+	"time"
+)
+
+// TestAliases checks command aliases of employees
+func TestAliases(t *testing.T, open Factory) {
+	db := open(t)
+	employee, other := addEmployee(t, 2, db), addEmployee(t, 3, db)
+	if database.GetAlias(employee, "r", db) != nil || database.GetAliases(employee, db) != nil {
+		t.Fatal("an empty store has aliases")
+	}
+	check(t, database.SetAlias(employee, "r", "/resolve", db))
+	check(t, database.SetAlias(employee, "r", "/reply", db))
+	check(t, database.SetAlias(employee, "b", "/ban", db))
+	check(t, database.SetAlias(other, "r", "/resolve", db))
+	if alias := database.GetAlias(employee, "r", db); alias == nil || alias.Command != "/reply" {
+		t.Fatalf("alias = %+v, want the second command", alias)
+	}
+	aliases := database.GetAliases(employee, db)
+	if len(aliases) != 2 || aliases[0].Name != "b" || aliases[1].Name != "r" {
+		t.Fatalf("aliases = %+v, want two by name", aliases)
+	}
+	check(t, database.RemoveAlias(employee, "r", db))
+	check(t, database.RemoveAlias(employee, "missing", db))
+	if database.GetAlias(employee, "r", db) != nil || database.GetAlias(other, "r", db) == nil {
+		t.Fatal("an alias is removed for another employee")
+	}
+}
+
+// TestCategories checks feedback categories
+func TestCategories(t *testing.T, open Factory) {
+	db := open(t)
+	if database.GetCategories(db) != nil || database.GetCategoryByID(1, db) != nil || database.GetCategoryByName("Billing", db) != nil {
+		t.Fatal("an empty store has categories")
+	}
+	billing, err := database.SetCategory("💳", "Billing", db)
+	check(t, err)
+	bugs, err := database.SetCategory("🐞", "Bugs", db)
+	check(t, err)
+	again, err := database.SetCategory("💰", "Billing", db)
+	check(t, err)
+	if again.ID != billing.ID || again.Emoji != "💰" {
+		t.Fatalf("the second SetCategory = %+v, want the emoji updated", again)
+	}
+	categories := database.GetCategories(db)
+	if len(categories) != 2 || categories[0].Name != "Billing" || categories[1].Name != "Bugs" {
+		t.Fatalf("categories = %+v, want the order of creation", categories)
+	}
+	check(t, database.ChangeCategoryName("Errors", bugs, db))
+	if database.GetCategoryByName("Bugs", db) != nil || database.GetCategoryByName("Errors", db).ID != bugs.ID {
+		t.Fatal("the category is not renamed")
+	}
+
+	user := addUser(t, 1, db)
+	check(t, database.ChangeUserCategory(int(bugs.ID), user, db))
+	question := addQuestion(t, "crash", user, db)
+	check(t, database.RemoveCategory(bugs, billing, db))
+	if database.GetCategoryByID(int(bugs.ID), db) != nil {
+		t.Fatal("the removed category is left")
+	}
+	if stored := database.GetQuestionById(int(question.ID), db); stored.CategoryID != int(billing.ID) {
+		t.Fatalf("question category = %d, want the replacement", stored.CategoryID)
+	}
+	if stored := database.GetUserByChatID(1, db); stored.CategoryID != int(billing.ID) {
+		t.Fatalf("user category = %d, want the replacement", stored.CategoryID)
+	}
+}
+
+// TestSettings checks the key-value state
+func TestSettings(t *testing.T, open Factory) {
+	db := open(t)
+	if database.GetSetting("offset", db) != "" {
+		t.Fatal("an empty store has settings")
+	}
+	check(t, database.SetSetting("offset", "10", db))
+	check(t, database.SetSetting("offset", "11", db))
+	check(t, database.SetSetting("empty", "", db))
+	if got := database.GetSetting("offset", db); got != "11" {
+		t.Fatalf("setting = %q, want the last value", got)
+	}
+	var rows int64
+	db.Model(&database.Setting{}).Where("key = ?", "offset").Count(&rows)
+	if rows != 1 {
+		t.Fatalf("setting rows = %d, want 1", rows)
+	}
+	if got := database.GetSetting("empty", db); got != "" {
+		t.Fatalf("empty setting = %q", got)
+	}
+}
+
+// TestGroups checks groups and acquisition sources
+func TestGroups(t *testing.T, open Factory) {
+	db := open(t)
+	if database.GetGroupSources(db) != nil || database.GetUserSources(db) != nil {
+		t.Fatal("an empty store has sources")
+	}
+	check(t, database.SetGroup(-1, "Team", db))
+	check(t, database.SetGroup(-1, "Renamed", db))
+	check(t, database.SetGroupSource(-2, "Fans", "promo", db))
+	check(t, database.SetGroupSource(-2, "Fans", "other", db))
+	check(t, database.SetGroupSource(-1, "Renamed", "promo", db))
+	if counts := database.GetCounts(db); counts.Groups != 2 {
+		t.Fatalf("groups = %d, a group is added once", counts.Groups)
+	}
+	if sources := database.GetGroupSources(db); len(sources) != 1 || sources[0] != (database.SourceCount{Source: "promo", Count: 2}) {
+		t.Fatalf("group sources = %+v, the first source is kept", sources)
+	}
+	check(t, database.RemoveGroup(-1, db))
+	check(t, database.RemoveGroup(-1, db))
+	if counts := database.GetCounts(db); counts.Groups != 1 {
+		t.Fatalf("groups = %d after the removal", counts.Groups)
+	}
+
+	for chatId, source := range map[int]string{1: "ads", 2: "ads", 3: "blog", 4: ""} {
+		check(t, database.ChangeUserSource(source, addUser(t, chatId, db), db))
+	}
+	sources := database.GetUserSources(db)
+	want := []database.SourceCount{{Source: "ads", Count: 2}, {Source: "blog", Count: 1}}
+	if len(sources) != 2 || sources[0] != want[0] || sources[1] != want[1] {
+		t.Fatalf("user sources = %+v, want %+v", sources, want)
+	}
+}
+
+// TestDonations checks donation totals
+func TestDonations(t *testing.T, open Factory) {
+	db := open(t)
+	if database.GetDonationTotals(db) != nil {
+		t.Fatal("an empty store has donations")
+	}
+	check(t, database.AddDonation("XTR", 50, "c1", db))
+	check(t, database.AddDonation("XTR", 25, "c2", db))
+	check(t, database.AddDonation("EUR", 500, "c3", db))
+	totals := database.GetDonationTotals(db)
+	want := []database.DonationTotal{{Currency: "EUR", Count: 1, Amount: 500}, {Currency: "XTR", Count: 2, Amount: 75}}
+	if len(totals) != 2 || totals[0] != want[0] || totals[1] != want[1] {
+		t.Fatalf("totals = %+v, want %+v", totals, want)
+	}
+}
+
+// TestRollout checks rollout cohorts
+func TestRollout(t *testing.T, open Factory) {
+	db := open(t)
+	if database.GetCohortStats("survey", db) != nil {
+		t.Fatal("an empty store has cohorts")
+	}
+	user := addUser(t, 1, db)
+	with, without, other := addQuestion(t, "a", user, db), addQuestion(t, "b", user, db), addQuestion(t, "c", user, db)
+	check(t, database.SetRolloutCohort("survey", false, with, db))
+	check(t, database.SetRolloutCohort("survey", true, with, db))
+	check(t, database.SetRolloutCohort("survey", false, without, db))
+	check(t, database.SetRolloutCohort("duplicates", true, other, db))
+	check(t, database.ChangeQuestionHaveAnswer(true, with, db))
+	check(t, database.ChangeQuestionIsClosed(true, with, db))
+	check(t, database.ChangeQuestionSurveyScore(5, with, db))
+
+	stats := database.GetCohortStats("survey", db)
+	if len(stats) != 2 {
+		t.Fatalf("stats = %+v, want both cohorts", stats)
+	}
+	if stats[0] != (database.CohortStats{Enabled: true, Questions: 1, Answered: 1, Closed: 1, Surveyed: 1, Score: 5}) {
+		t.Fatalf("enabled cohort = %+v, a question is in one cohort", stats[0])
+	}
+	if stats[1] != (database.CohortStats{Enabled: false, Questions: 1}) {
+		t.Fatalf("disabled cohort = %+v", stats[1])
+	}
+}
+
+// TestEscalations checks Questions handed to partner teams
+func TestEscalations(t *testing.T, open Factory) {
+	db := open(t)
+	question := addQuestion(t, "help", addUser(t, 1, db), db)
+	if database.GetOpenEscalation(question, db) != nil || database.GetEscalation(1, "legal", db) != nil {
+		t.Fatal("an empty store has escalations")
+	}
+	escalation, err := database.AddEscalation("legal", question, db)
+	check(t, err)
+	if open := database.GetOpenEscalation(question, db); open == nil || open.ID != escalation.ID {
+		t.Fatalf("open escalation = %+v", open)
+	}
+	if database.GetEscalation(escalation.ID, "billing", db) != nil {
+		t.Fatal("the escalation is found for another team")
+	}
+	check(t, database.CloseEscalation(escalation, db))
+	if database.GetOpenEscalation(question, db) != nil || database.GetEscalation(escalation.ID, "legal", db) != nil {
+		t.Fatal("a closed escalation is open")
+	}
+}
+
+// TestQualityReviews checks the review queue
+func TestQualityReviews(t *testing.T, open Factory) {
+	db := open(t)
+	if database.GetNextQualityReview(0, 2, db) != nil || database.CountQualityReviews(db) != 0 ||
+		database.GetLastQualityReview(2, db) != nil || database.GetQualityStats(db) != nil {
+		t.Fatal("an empty store has reviews")
+	}
+	user, first, second := addUser(t, 1, db), addEmployee(t, 2, db), addEmployee(t, 3, db)
+	own := addQuestion(t, "a", user, db)
+	check(t, database.ChangeQuestionAnswerer(int(first.ID), own, db))
+	others := addQuestion(t, "b", user, db)
+	check(t, database.ChangeQuestionAnswerer(int(second.ID), others, db))
+	check(t, database.AddQualityReview(own, db))
+	check(t, database.AddQualityReview(own, db))
+	check(t, database.AddQualityReview(others, db))
+	if got := database.CountQualityReviews(db); got != 2 {
+		t.Fatalf("queue = %d, a question is queued once", got)
+	}
+
+	// The reviewer doesn't get their own answers
+	next := database.GetNextQualityReview(0, int(first.ID), db)
+	if next == nil || next.QuestionID != int(others.ID) {
+		t.Fatalf("next = %+v, want the answer of another employee", next)
+	}
+	ok, err := database.SetQualityVerdict(next.ID, database.VerdictApproved, int(first.ID), db)
+	check(t, err)
+	if !ok {
+		t.Fatal("the verdict is refused")
+	}
+	ok, err = database.SetQualityVerdict(next.ID, database.VerdictNeedsWork, int(second.ID), db)
+	check(t, err)
+	if ok {
+		t.Fatal("the second verdict is accepted")
+	}
+	if database.GetNextQualityReview(0, int(first.ID), db) != nil || database.CountQualityReviews(db) != 1 {
+		t.Fatal("a reviewed question is in the queue")
+	}
+	last := database.GetLastQualityReview(int(first.ID), db)
+	if last == nil || last.ID != next.ID || last.Verdict != database.VerdictApproved || last.ReviewedAt == nil {
+		t.Fatalf("last = %+v", last)
+	}
+	check(t, database.ChangeQualityComment("clear answer", last, db))
+	stats := database.GetQualityStats(db)
+	if len(stats) != 1 || stats[0] != (database.QualityStats{AnswererID: int(second.ID), Reviewed: 1, Approved: 1, Comments: 1}) {
+		t.Fatalf("stats = %+v", stats)
+	}
+}
+
+// TestConcurrentVerdicts checks that concurrent verdicts of a review have one winner
+func TestConcurrentVerdicts(t *testing.T, open Factory) {
+	db := open(t)
+	question := addQuestion(t, "help", addUser(t, 1, db), db)
+	check(t, database.AddQualityReview(question, db))
+	review := database.GetNextQualityReview(0, -1, db)
+	const reviewers = 8
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var winners []int
+	for i := 1; i <= reviewers; i++ {
+		wg.Add(1)
+		go func(reviewer int) {
+			defer wg.Done()
+			ok, err := database.SetQualityVerdict(review.ID, database.VerdictApproved, reviewer, db)
+			if err != nil {
+				t.Error(err)
+			}
+			if ok {
+				mu.Lock()
+				winners = append(winners, reviewer)
+				mu.Unlock()
+			}
+		}(100 + i)
+	}
+	wg.Wait()
+	if len(winners) != 1 {
+		t.Fatalf("winners = %v, want one", winners)
+	}
+	if last := database.GetLastQualityReview(winners[0], db); last == nil || last.ID != review.ID {
+		t.Fatalf("the review of the winner = %+v", last)
+	}
+}
+
+// TestSharedItems checks contacts, locations and venues of Questions
+func TestSharedItems(t *testing.T, open Factory) {
+	db := open(t)
+	question := addQuestion(t, "help", addUser(t, 1, db), db)
+	if database.GetFirstSharedItem(question, db) != nil {
+		t.Fatal("a new question has shared items")
+	}
+	check(t, database.AddSharedItem(&database.SharedItem{Kind: database.ShareLocation, Latitude: 52.5, Longitude: 13.4, IsLive: true}, question, db))
+	check(t, database.AddSharedItem(&database.SharedItem{Kind: database.ShareContact, PhoneNumber: "+100"}, question, db))
+	item := database.GetFirstSharedItem(question, db)
+	if item == nil || item.Kind != database.ShareLocation || item.Latitude != 52.5 || !item.IsLive || item.QuestionID != int(question.ID) {
+		t.Fatalf("first item = %+v", item)
+	}
+}
+
+// TestImportedMessages checks that imported messages are stored once as Questions and answers
+func TestImportedMessages(t *testing.T, open Factory) {
+	db := open(t)
+	asker, err := database.AddImportedUser(11, "Ann", 0, db)
+	check(t, err)
+	same, err := database.AddImportedUser(11, "Other", 0, db)
+	check(t, err)
+	if same.ID != asker.ID || same.FirstName != "Ann" || same.Source != "import" {
+		t.Fatalf("user = %+v, want the first one", same)
+	}
+	employee := addEmployee(t, 12, db)
+	date := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	message := database.ImportedMessage{ChatID: 5, MessageID: 1, SenderID: "user11", Date: date, Text: "hi"}
+	added, err := database.AddImportedMessage(&message, asker, db)
+	check(t, err)
+	if !added || message.QuestionID == 0 {
+		t.Fatalf("the first import is skipped: %+v", message)
+	}
+	question := database.GetQuestionById(message.QuestionID, db)
+	if question.Header != "hi" || question.UserID != int(asker.ID) || !question.IsClosed || question.HaveAnswer || !question.CreatedAt.Equal(date) {
+		t.Fatalf("question = %+v", question)
+	}
+	duplicate := message
+	duplicate.ID, duplicate.QuestionID = 0, 0
+	added, err = database.AddImportedMessage(&duplicate, asker, db)
+	check(t, err)
+	if added {
+		t.Fatal("the message is imported twice")
+	}
+
+	answer := database.ImportedMessage{ChatID: 5, MessageID: 2, ReplyTo: 1, Date: date.Add(time.Hour), Media: "photos/photo_1.jpg"}
+	added, err = database.AddImportedMessage(&answer, employee, db)
+	check(t, err)
+	if !added || answer.QuestionID != message.QuestionID {
+		t.Fatalf("the reply is not added to the question: %+v", answer)
+	}
+	question = database.GetQuestionById(message.QuestionID, db)
+	if !question.HaveAnswer || question.AnswererID != int(employee.ID) || !question.UpdatedAt.Equal(answer.Date) {
+		t.Fatalf("answered question = %+v", question)
+	}
+	corr := database.GetCorrespondenceByQuestion(question, db)
+	if len(corr) != 1 || !corr[0].IsEmployee || corr[0].Text != "[photo_1.jpg]" || !corr[0].CreatedAt.Equal(answer.Date) {
+		t.Fatalf("correspondence = %+v", corr)
+	}
+	if stored := database.GetImportedMessage(5, 2, db); stored == nil || stored.QuestionID != message.QuestionID {
+		t.Fatalf("stored = %+v", stored)
+	}
+
+	// A reply to a message which is not imported and a message of another chat start new Questions
+	orphan := database.ImportedMessage{ChatID: 5, MessageID: 3, ReplyTo: 99, Date: date, Text: "lost"}
+	added, err = database.AddImportedMessage(&orphan, nil, db)
+	check(t, err)
+	other := database.ImportedMessage{ChatID: 6, MessageID: 1, Date: date, Text: "hi"}
+	_, err = database.AddImportedMessage(&other, asker, db)
+	check(t, err)
+	if !added || orphan.QuestionID == message.QuestionID || other.QuestionID == message.QuestionID || other.QuestionID == 0 {
+		t.Fatalf("orphan = %+v, other = %+v", orphan, other)
+	}
+	if database.GetImportedMessage(7, 1, db) != nil {
+		t.Fatal("found a message which is not imported")
+	}
+}
+
+// TestTemplates checks canned replies
+func TestTemplates(t *testing.T, open Factory) {
+	db := open(t)
+	author := addEmployee(t, 2, db)
+	if database.GetTemplate("hi", db) != nil || database.GetTemplates(db) != nil {
+		t.Fatal("an empty store has templates")
+	}
+	check(t, database.AddTemplate("thanks", "Thank you, {{user}}", author, db))
+	check(t, database.AddTemplate("hi", "Hello", author, db))
+	if database.AddTemplate("hi", "Hello again", author, db) == nil {
+		t.Fatal("a duplicate name is accepted")
+	}
+	templates := database.GetTemplates(db)
+	if len(templates) != 2 || templates[0].Name != "hi" || templates[1].Text != "Thank you, {{user}}" || templates[0].AuthorID != int(author.ID) {
+		t.Fatalf("templates = %+v, want two by name", templates)
+	}
+	check(t, database.RemoveTemplate(database.GetTemplate("hi", db), db))
+	if database.GetTemplate("hi", db) != nil {
+		t.Fatal("the removed template is left")
+	}
+	check(t, database.AddTemplate("hi", "Hello again", author, db))
+	if got := database.GetTemplate("hi", db); got == nil || got.Text != "Hello again" {
+		t.Fatalf("template = %+v, the name is free after the removal", got)
+	}
+}
+
+// TestSnapshots checks that a Snapshot restores the state into a new store
+func TestSnapshots(t *testing.T, open Factory) {
+	db := open(t)
+	empty, err := database.TakeSnapshot(db)
+	check(t, err)
+	if len(empty.Settings) != 0 || len(empty.Users) != 0 || len(empty.Questions) != 0 {
+		t.Fatalf("snapshot of an empty store = %+v", empty)
+	}
+	check(t, database.SetSetting("rollout", "on", db))
+	check(t, database.SetSetting(database.BusySetting, "export", db))
+	employee := addEmployee(t, 2, db)
+	check(t, database.ChangeUserIsReceiver(true, employee, db))
+	check(t, database.ChangeUserIsBanned(true, "spam", addUser(t, 3, db), db))
+	user := addUser(t, 1, db)
+	check(t, database.ChangeQuestionIsClosed(true, addQuestion(t, "closed", user, db), db))
+	open1 := addQuestion(t, "open", user, db)
+	check(t, database.ChangeQuestionAnswerer(int(employee.ID), open1, db))
+	check(t, database.ChangeQuestionTicketID("T-7", open1, db))
+	// The last ticket is closed, so it is not in the snapshot
+	last := addQuestion(t, "closed last", user, db)
+	check(t, database.ChangeQuestionIsClosed(true, last, db))
+
+	snapshot, err := database.TakeSnapshot(db)
+	check(t, err)
+	if len(snapshot.Settings) != 1 || len(snapshot.Users) != 3 || len(snapshot.Questions) != 1 {
+		t.Fatalf("snapshot = %+v, want the setting, 3 users and the open question", snapshot)
+	}
+	if err := database.RestoreSnapshot(snapshot, db); err == nil {
+		t.Fatal("a snapshot is restored into a store with data")
+	}
+
+	restored := open(t)
+	newer := *snapshot
+	newer.Version = database.SnapshotVersion + 1
+	if err := database.RestoreSnapshot(&newer, restored); err == nil {
+		t.Fatal("a newer snapshot version is accepted")
+	}
+	check(t, database.RestoreSnapshot(snapshot, restored))
+	question := database.GetQuestionById(int(open1.ID), restored)
+	if question == nil || question.User.ChatID != 1 || question.Answerer.ChatID != 2 || question.TicketID != "T-7" || question.Number != open1.Number {
+		t.Fatalf("restored question = %+v, want the same number and users", question)
+	}
+	if database.GetSetting("rollout", restored) != "on" || database.GetSetting(database.BusySetting, restored) != "" {
+		t.Fatal("restored settings")
+	}
+	if banned := database.GetBannedUsers(restored); len(banned) != 1 || banned[0].BanReason != "spam" {
+		t.Fatalf("restored bans = %+v", banned)
+	}
+	next := addQuestion(t, "next", database.GetUserByChatID(1, restored), restored)
+	if next.ID <= open1.ID {
+		t.Fatalf("a new question got ID %d, want after %d", next.ID, open1.ID)
+	}
+	if next.Number <= last.Number {
+		t.Fatalf("a new question got ticket %d, the closed ticket %d is given again", next.Number, last.Number)
+	}
+	again, err := database.TakeSnapshot(restored)
+	check(t, err)
+	if again.LastNumber != next.Number || len(again.Settings) != 2 {
+		t.Fatalf("snapshot of the restored store = %+v, want the last number %d", again, next.Number)
+	}
+
+	// Snapshots from before ticket numbers were stored use the question ID
+	legacy := *snapshot
+	legacy.LastNumber = 0
+	legacy.Questions = append([]database.SnapshotQuestion(nil), snapshot.Questions...)
+	legacy.Questions[0].Number = 0
+	old := open(t)
+	check(t, database.RestoreSnapshot(&legacy, old))
+	if question := database.GetQuestionById(int(open1.ID), old); question == nil || question.Number != int(open1.ID) {
+		t.Fatalf("question of a legacy snapshot = %+v, want the ID as the ticket number", question)
+	}
+}
+
+// TestMaintenance checks the size and the vacuum of the store
+func TestMaintenance(t *testing.T, open Factory) {
+	db := open(t)
+	user := addUser(t, 1, db)
+	check(t, db.Delete(user).Error)
+	counts := database.GetTableCounts(db)
+	rows := map[string]int64{}
+	for _, count := range counts {
+		rows[count.Table] = count.Rows
+	}
+	if len(rows) != len(counts) || rows["users"] != 1 || rows["questions"] != 0 {
+		t.Fatalf("table counts = %+v, deleted rows are counted", counts)
+	}
+	before, err := database.Size(db)
+	check(t, err)
+	if before <= 0 {
+		t.Fatalf("size = %d", before)
+	}
+	check(t, database.Vacuum(db))
+	check(t, database.Vacuum(db))
+	if _, err := database.Size(db); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,142 @@
+// Package storetest is the conformance suite of the database functions
+//
+// Every storage backend runs it from its test package with a Factory of empty databases, so the backends can't drift
+// apart in ordering, empty results, unique keys or compare-and-set semantics. A new database function needs a Case,
+// the database package checks that every function is covered.
+package storetest
+
+import (
+	"sort"
+	"strconv"
+	"telegram-bot-feedback/internal/pkg/database"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// Factory returns a new empty database of the backend
+type Factory func(t *testing.T) *gorm.DB
+
+// Case is a conformance test and the database functions it covers
+type Case struct {
+	Test  func(t *testing.T, open Factory)
+	Funcs []string
+}
+
+// Cases are the conformance cases by name
+var Cases = map[string]Case{
+	"Employees":          {TestEmployees, []string{"AddEmployeeByID", "AddEmployeeByNickname", "RemoveEmployeeByID", "RemoveEmployeeByNickname", "GetEmployees", "GetReceivers", "GetEmployeesByChatIDs", "ChangeUserIsReceiver"}},
+	"Users":              {TestUsers, []string{"AddUser", "GetUserByChatID", "GetUserById", "ChangeUserState", "ChangeUserIsBlocked", "ChangeUserIsDeactivated", "ChangeUserCategory", "ChangeUserRole", "ChangeUserProfile", "ChangeUserQuietHours", "ChangeUserTimezone", "ChangeUserReceipts", "GetCounts"}},
+	"Bans":               {TestBans, []string{"ChangeUserIsBanned", "ChangeUserBanNotified", "GetBannedUsers"}},
+	"Segments":           {TestSegments, []string{"GetBroadcastUsers", "GetBroadcastUsersInSegment", "AddUserToSegment", "RemoveUserFromSegment", "GetSegments"}},
+	"Reviews":            {TestReviews, []string{"GetEmptyReview", "ChangeTextReviewByUser", "GetReviewsInRange", "GetCountReviewsByRating"}},
+	"Questions":          {TestQuestions, []string{"AddQuestion", "GetQuestionById", "GetOpenQuestionByUser", "GetOpenQuestionByAnswerer", "GetNewQuestionById", "GetNewQuestions", "GetNewQuestionsBefore", "GetQuestionsInRange", "ChangeQuestionHaveAnswer", "ChangeQuestionAnswerer", "ChangeQuestionIsClosed", "ChangeQuestionTicketID", "GetUserQuestionByNumber"}},
+	"UserQuestions":      {TestUserQuestions, []string{"GetUserQuestions"}},
+	"AwaitingReply":      {TestAwaitingReply, []string{"ChangeQuestionAwaitingReplySince", "GetQuestionsAwaitingReplyBefore"}},
+	"Correspondence":     {TestCorrespondence, []string{"AddCorrespondence", "AddCorrespondenceToQuestion", "GetCorrespondenceByQuestion", "AppendCorrespondenceText", "AddPartnerCorrespondence", "GetLastEmployeeReply"}},
+	"Dialog":             {TestDialog, []string{"ListDialog"}},
+	"QuestionFields":     {TestQuestionFields, []string{"SetQuestionField", "GetQuestionFields", "GetQuestionsByField"}},
+	"MessageLinks":       {TestMessageLinks, []string{"AddMessageLink", "GetMessageLink", "GetQuestionMessageLink", "ChangeMessageLinkPinned"}},
+	"Links":              {TestLinks, []string{"AddLink", "GetLinkByCode", "AddLinkClick", "GetLinkStats"}},
+	"Aliases":            {TestAliases, []string{"SetAlias", "GetAlias", "GetAliases", "RemoveAlias"}},
+	"Categories":         {TestCategories, []string{"SetCategory", "GetCategories", "GetCategoryByID", "GetCategoryByName", "ChangeCategoryName", "RemoveCategory"}},
+	"Settings":           {TestSettings, []string{"SetSetting", "GetSetting"}},
+	"Surveys":            {TestSurveys, []string{"ChangeQuestionSurvey", "ChangeQuestionSurveyScore", "GetQuestionBySurvey", "GetSurveyStats"}},
+	"Triage":             {TestTriage, []string{"ChangeQuestionTriage"}},
+	"Outbox":             {TestOutbox, []string{"AddOutboxMessage", "HasOutboxMessages", "GetDueOutboxMessages", "ChangeOutboxMessageAttempt", "ChangeOutboxMessageIsDead", "RemoveOutboxMessage", "GetOutboxStats", "GetDeadOutboxMessages"}},
+	"QuietMessages":      {TestQuietMessages, []string{"AddQuietMessage", "GetDueQuietMessages", "CountQuietMessages", "RemoveQuietMessage"}},
+	"ChatCapabilities":   {TestChatCapabilities, []string{"GetChatCapability", "SetChatCapability", "ChangeChatMigratedTo"}},
+	"UserTopics":         {TestUserTopics, []string{"GetUserTopic", "GetUserTopicByThread", "AddUserTopic", "RemoveUserTopic", "RemoveUserTopics"}},
+	"Groups":             {TestGroups, []string{"SetGroup", "RemoveGroup", "SetGroupSource", "GetGroupSources", "ChangeUserSource", "GetUserSources"}},
+	"Donations":          {TestDonations, []string{"AddDonation", "GetDonationTotals"}},
+	"Tags":               {TestTags, []string{"AddQuestionTags", "RemoveQuestionTags", "GetQuestionTags", "SearchQuestions"}},
+	"Rollout":            {TestRollout, []string{"SetRolloutCohort", "GetCohortStats"}},
+	"Escalations":        {TestEscalations, []string{"AddEscalation", "GetOpenEscalation", "GetEscalation", "CloseEscalation"}},
+	"QualityReviews":     {TestQualityReviews, []string{"AddQualityReview", "GetNextQualityReview", "CountQualityReviews", "SetQualityVerdict", "GetLastQualityReview", "ChangeQualityComment", "GetQualityStats"}},
+	"SharedItems":        {TestSharedItems, []string{"AddSharedItem", "GetFirstSharedItem"}},
+	"ImportedMessages":   {TestImportedMessages, []string{"AddImportedMessage", "GetImportedMessage", "AddImportedUser"}},
+	"Templates":          {TestTemplates, []string{"AddTemplate", "GetTemplate", "GetTemplates", "RemoveTemplate"}},
+	"Snapshots":          {TestSnapshots, []string{"TakeSnapshot", "RestoreSnapshot"}},
+	"Maintenance":        {TestMaintenance, []string{"Vacuum", "Size", "GetTableCounts"}},
+	"LargeText":          {TestLargeText, []string{"AppendQuestionHeader"}},
+	"ConcurrentVerdicts": {TestConcurrentVerdicts, []string{"SetQualityVerdict"}},
+	"EngineSemantics":    {TestEngineSemantics, []string{"GetNewQuestions", "GetUserQuestions", "AddLink", "GetLinkByCode"}},
+}
+
+// Run runs every Case on the backend
+func Run(t *testing.T, open Factory) {
+	names := make([]string, 0, len(Cases))
+	for name := range Cases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		test := Cases[name].Test
+		t.Run(name, func(t *testing.T) { test(t, open) })
+	}
+}
+
+// Covered returns the database functions covered by the Cases
+func Covered() map[string]bool {
+	covered := map[string]bool{}
+	for _, c := range Cases {
+		for _, name := range c.Funcs {
+			covered[name] = true
+		}
+	}
+	return covered
+}
+
+// check fails the test on the error
+func check(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// addUser creates the User with the chat ID and the nickname "user<chat ID>"
+func addUser(t *testing.T, chatId int, db *gorm.DB) *database.User {
+	t.Helper()
+	user, err := database.AddUser(chatId, "user"+strconv.Itoa(chatId), 0, db)
+	check(t, err)
+	return user
+}
+
+// addEmployee creates the employee with the chat ID
+func addEmployee(t *testing.T, chatId int, db *gorm.DB) *database.User {
+	t.Helper()
+	check(t, database.AddEmployeeByID(db, chatId))
+	return database.GetUserByChatID(chatId, db)
+}
+
+// addQuestion creates the Question of the User
+func addQuestion(t *testing.T, header string, user *database.User, db *gorm.DB) *database.Question {
+	t.Helper()
+	question, err := database.AddQuestion(header, 0, user, db)
+	check(t, err)
+	return question
+}
+
+// questionIDs returns the IDs of the Questions
+func questionIDs(questions []database.Question) []uint {
+	var ids []uint
+	for _, q := range questions {
+		ids = append(ids, q.ID)
+	}
+	return ids
+}
+
+// sameIDs reports whether the Questions have the IDs in the order
+func sameIDs(questions []database.Question, ids ...uint) bool {
+	got := questionIDs(questions)
+	if len(got) != len(ids) {
+		return false
+	}
+	for i := range got {
+		if got[i] != ids[i] {
+			return false
+		}
+	}
+	return true
+}
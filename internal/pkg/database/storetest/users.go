@@ -0,0 +1,207 @@
+package storetest
+
+import (
+	"telegram-bot-feedback/internal/pkg/database"
+	"testing"
+	"time"
+)
+
+// TestEmployees checks adding and removing employees and choosing the free ones
+func TestEmployees(t *testing.T, open Factory) {
+	db := open(t)
+	if database.GetEmployees(db) != nil || database.GetReceivers(db) != nil {
+		t.Fatal("an empty store has employees")
+	}
+	if database.GetEmployeesByChatIDs(nil, db) != nil {
+		t.Fatal("employees of no chats")
+	}
+
+	check(t, database.AddEmployeeByID(db, 2))
+	check(t, database.AddEmployeeByID(db, 2))
+	check(t, database.AddEmployeeByNickname(db, "boss"))
+	if got := len(database.GetEmployees(db)); got != 2 {
+		t.Fatalf("employees = %d, want 2, the same ID is added once", got)
+	}
+	// The employee added by nickname gets the chat on /start
+	boss, err := database.AddUser(3, "boss", 0, db)
+	check(t, err)
+	if !boss.IsEmployee || len(database.GetEmployees(db)) != 2 {
+		t.Fatalf("the user with the nickname is not the added employee: %+v", boss)
+	}
+
+	employee := database.GetUserByChatID(2, db)
+	check(t, database.ChangeUserIsReceiver(true, employee, db))
+	if receivers := database.GetReceivers(db); len(receivers) != 1 || receivers[0].ChatID != 2 {
+		t.Fatalf("receivers = %+v, want chat 2", receivers)
+	}
+	if employees := database.GetEmployeesByChatIDs([]int{2, 3, 4}, db); len(employees) != 2 {
+		t.Fatalf("employees = %+v, want chats 2 and 3", employees)
+	}
+
+	// A receiver answering a Question is busy, the employees by chats are returned anyway
+	question := addQuestion(t, "help", addUser(t, 1, db), db)
+	check(t, database.ChangeQuestionAnswerer(int(employee.ID), question, db))
+	if database.GetReceivers(db) != nil {
+		t.Fatal("a busy employee receives questions")
+	}
+	if employees := database.GetEmployeesByChatIDs([]int{2, 3}, db); len(employees) != 2 {
+		t.Fatalf("employees = %+v, want chats 2 and 3", employees)
+	}
+
+	check(t, database.RemoveEmployeeByID(db, 2))
+	check(t, database.RemoveEmployeeByNickname(db, "boss"))
+	if database.GetEmployees(db) != nil {
+		t.Fatal("removed employees are left")
+	}
+	if database.GetUserByChatID(2, db) == nil {
+		t.Fatal("the removed employee is deleted, want a user")
+	}
+}
+
+// TestUsers checks creating Users and changing their fields
+func TestUsers(t *testing.T, open Factory) {
+	db := open(t)
+	if database.GetUserByChatID(1, db) != nil || database.GetUserById(1, db) != nil {
+		t.Fatal("an empty store has a user")
+	}
+	if counts := database.GetCounts(db); counts != (database.Counts{}) {
+		t.Fatalf("counts of an empty store = %+v", counts)
+	}
+
+	user, err := database.AddUser(1, "user1", 3, db)
+	check(t, err)
+	again, err := database.AddUser(1, "renamed", 4, db)
+	check(t, err)
+	if again.ID != user.ID || again.Nickname != "renamed" || again.State != 4 {
+		t.Fatalf("the second AddUser = %+v, want the same user updated", again)
+	}
+
+	check(t, database.ChangeUserState(5, user, db))
+	check(t, database.ChangeUserCategory(7, user, db))
+	check(t, database.ChangeUserRole("support", user, db))
+	check(t, database.ChangeUserProfile("nick", "First", "Last", "de", user, db))
+	check(t, database.ChangeUserQuietHours("22:00-07:00", user, db))
+	check(t, database.ChangeUserTimezone("Europe/Berlin", user, db))
+	check(t, database.ChangeUserReceipts("read", user, db))
+	stored := database.GetUserById(int(user.ID), db)
+	if stored == nil || stored.ChatID != 1 || stored.State != 5 || stored.CategoryID != 7 || stored.Role != "support" ||
+		stored.Nickname != "nick" || stored.FirstName != "First" || stored.LastName != "Last" || stored.LanguageCode != "de" ||
+		stored.ProfileAt == nil || stored.QuietHours != "22:00-07:00" || stored.Timezone != "Europe/Berlin" || stored.Receipts != "read" {
+		t.Fatalf("stored user = %+v", stored)
+	}
+
+	addUser(t, 2, db)
+	addEmployee(t, 3, db)
+	check(t, database.ChangeUserIsBlocked(true, user, db))
+	if counts := database.GetCounts(db); counts.Users != 2 || counts.Blocked != 1 || counts.Deactivated != 0 {
+		t.Fatalf("counts = %+v, want 2 users and 1 blocked", counts)
+	}
+	check(t, database.ChangeUserIsDeactivated(user, db))
+	if counts := database.GetCounts(db); counts.Blocked != 0 || counts.Deactivated != 1 {
+		t.Fatalf("counts = %+v, a deactivated user is not blocked", counts)
+	}
+	check(t, database.ChangeUserIsBlocked(false, user, db))
+	if stored := database.GetUserByChatID(1, db); stored.IsBlocked || !stored.IsDeactivated {
+		t.Fatalf("stored user = %+v, deactivation is never cleared", stored)
+	}
+}
+
+// TestBans checks banning Users
+func TestBans(t *testing.T, open Factory) {
+	db := open(t)
+	if database.GetBannedUsers(db) != nil {
+		t.Fatal("an empty store has banned users")
+	}
+	first, second := addUser(t, 1, db), addUser(t, 2, db)
+	check(t, database.ChangeUserIsBanned(true, "spam", second, db))
+	check(t, database.ChangeUserIsBanned(true, "abuse", first, db))
+	banned := database.GetBannedUsers(db)
+	if len(banned) != 2 || banned[0].ChatID != 2 || banned[1].ChatID != 1 {
+		t.Fatalf("banned = %+v, want the order of bans", banned)
+	}
+	if banned[0].BanReason != "spam" || banned[0].BannedAt == nil || banned[0].BanNotified {
+		t.Fatalf("banned user = %+v", banned[0])
+	}
+	check(t, database.ChangeUserBanNotified(true, second, db))
+	if !database.GetUserByChatID(2, db).BanNotified {
+		t.Fatal("ban notification is not stored")
+	}
+	check(t, database.ChangeUserIsBanned(false, "", second, db))
+	stored := database.GetUserByChatID(2, db)
+	if stored.IsBanned || stored.BannedAt != nil || stored.BanReason != "" || stored.BanNotified {
+		t.Fatalf("unbanned user = %+v", stored)
+	}
+	if banned := database.GetBannedUsers(db); len(banned) != 1 || banned[0].ChatID != 1 {
+		t.Fatalf("banned = %+v, want chat 1", banned)
+	}
+}
+
+// TestSegments checks broadcast recipients and segments
+func TestSegments(t *testing.T, open Factory) {
+	db := open(t)
+	if database.GetBroadcastUsers(db) != nil || database.GetBroadcastUsersInSegment("beta", db) != nil || database.GetSegments(db) != nil {
+		t.Fatal("an empty store has broadcast users or segments")
+	}
+	users := []*database.User{addUser(t, 1, db), addUser(t, 2, db), addUser(t, 3, db), addUser(t, 4, db)}
+	addEmployee(t, 5, db)
+	check(t, database.ChangeUserIsBlocked(true, users[2], db))
+	check(t, database.ChangeUserIsDeactivated(users[3], db))
+	if got := database.GetBroadcastUsers(db); len(got) != 2 || got[0].ChatID != 1 || got[1].ChatID != 2 {
+		t.Fatalf("broadcast users = %+v, want chats 1 and 2 in order", got)
+	}
+
+	for _, user := range users {
+		check(t, database.AddUserToSegment("beta", user, db))
+	}
+	check(t, database.AddUserToSegment("beta", users[1], db))
+	check(t, database.AddUserToSegment("alpha", users[0], db))
+	segments := database.GetSegments(db)
+	if len(segments) != 2 || segments[0] != (database.SegmentCount{Name: "alpha", Users: 1}) || segments[1] != (database.SegmentCount{Name: "beta", Users: 4}) {
+		t.Fatalf("segments = %+v, a user is added to a segment once", segments)
+	}
+	if got := database.GetBroadcastUsersInSegment("beta", db); len(got) != 2 {
+		t.Fatalf("beta broadcast users = %+v, blocked and deactivated users are skipped", got)
+	}
+	check(t, database.RemoveUserFromSegment("beta", users[0], db))
+	if got := database.GetBroadcastUsersInSegment("beta", db); len(got) != 1 || got[0].ChatID != 2 {
+		t.Fatalf("beta broadcast users = %+v, want chat 2", got)
+	}
+	if database.GetBroadcastUsersInSegment("missing", db) != nil {
+		t.Fatal("an unknown segment has users")
+	}
+}
+
+// TestReviews checks Reviews of Users
+func TestReviews(t *testing.T, open Factory) {
+	db := open(t)
+	user := addUser(t, 1, db)
+	if database.GetEmptyReview(user, db) != nil || database.GetReviewsInRange(time.Now().Add(time.Hour), time.Now().Add(-time.Hour), db) != nil {
+		t.Fatal("an empty store has reviews")
+	}
+	if counts := database.GetCountReviewsByRating(db); counts != [5]int64{} {
+		t.Fatalf("ratings of an empty store = %v", counts)
+	}
+	check(t, database.ChangeTextReviewByUser("no review", user, db))
+
+	check(t, db.Create(&database.Review{User: *user, Rating: 5}).Error)
+	check(t, db.Create(&database.Review{User: *user, Rating: 5, Text: "great"}).Error)
+	check(t, db.Create(&database.Review{User: *user, Rating: 2, Text: "slow"}).Error)
+	review := database.GetEmptyReview(user, db)
+	if review == nil || review.Rating != 5 || review.User.ChatID != 1 {
+		t.Fatalf("empty review = %+v", review)
+	}
+	check(t, database.ChangeTextReviewByUser("fast", user, db))
+	if database.GetEmptyReview(user, db) != nil {
+		t.Fatal("the review text is not stored")
+	}
+	if counts := database.GetCountReviewsByRating(db); counts != [5]int64{0, 1, 0, 0, 2} {
+		t.Fatalf("ratings = %v", counts)
+	}
+	reviews := database.GetReviewsInRange(time.Now().Add(time.Hour), time.Now().Add(-time.Hour), db)
+	if len(reviews) != 3 || reviews[0].Text != "fast" || reviews[0].User.ChatID != 1 {
+		t.Fatalf("reviews = %+v, want 3 in order with users", reviews)
+	}
+	if database.GetReviewsInRange(time.Now().Add(-time.Hour), time.Now().Add(-2*time.Hour), db) != nil {
+		t.Fatal("reviews out of the range")
+	}
+}
@@ -1,19 +1,37 @@
 package database
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 )
 
 // User table
 type User struct {
 	gorm.Model
-	ChatID     int
-	State      int
-	Nickname   string
-	IsEmployee bool       `gorm:"default:false"`
-	IsReceiver bool       `gorm:"default:false"`
-	Review     []Review   `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
-	Question   []Question `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
+	ChatID        int
+	State         int
+	Nickname      string
+	IsEmployee    bool `gorm:"default:false"`
+	IsReceiver    bool `gorm:"default:false"`
+	IsBlocked     bool `gorm:"default:false"`
+	IsDeactivated bool `gorm:"default:false"`
+	IsBanned      bool `gorm:"default:false"`
+	BanReason     string
+	BannedAt      *time.Time
+	BanNotified   bool `gorm:"default:false"`
+	LanguageCode  string
+	FirstName     string
+	LastName      string
+	ProfileAt     *time.Time
+	Receipts      string
+	Role          string
+	CategoryID    int
+	Source        string     // acquisition source from the /start payload of the first contact
+	QuietHours    string     // "HH:MM-HH:MM", "off" or "" for "quiet_hours"
+	Timezone      string     // IANA name or "UTC+3", "" for "timezone"
+	Review        []Review   `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
+	Question      []Question `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
 }
 
 // Review table
@@ -29,6 +47,7 @@ type Review struct {
 type Question struct {
 	gorm.Model
 	Header                 string
+	MessageID              int
 	UserID                 int
 	User                   User `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
 	AnswererID             int
@@ -36,6 +55,40 @@ type Question struct {
 	QuestionCorrespondence []QuestionCorrespondence `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
 	HaveAnswer             bool                     `gorm:"default:false"`
 	IsClosed               bool                     `gorm:"default:false"`
+	TicketID               string
+	SurveyPollID           string `gorm:"index"`
+	SurveySentAt           *time.Time
+	SurveyScore            int
+	AwaitingReplySince     *time.Time `gorm:"index"`
+	CategoryID             int
+	TriageStatus           string     // status of the last emoji button
+	TriageBy               int        // ID of the User who pressed it
+	ClosedAt               *time.Time // nil for open Questions and Questions closed before it was stored
+	Number                 int        `gorm:"index"` // ticket number users see, assigned by the bot unlike TicketID of the ticket system
+}
+
+// QuestionField table
+//
+// Value of the custom field, Number is filled for number fields
+type QuestionField struct {
+	gorm.Model
+	QuestionID int
+	Name       string
+	Value      string
+	Number     float64
+}
+
+// MessageLink table
+//
+// Links the message sent by the bot to an employee chat with the Question
+type MessageLink struct {
+	gorm.Model
+	ChatID     int `gorm:"index:idx_message_link"`
+	MessageID  int `gorm:"index:idx_message_link"`
+	ThreadID   int
+	QuestionID int
+	UserChatID int
+	IsPinned   bool // pinned with the button of the message
 }
 
 // QuestionCorrespondence table
@@ -46,4 +99,229 @@ type QuestionCorrespondence struct {
 	UserID     int
 	User       User `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
 	IsEmployee bool
+	Text       string
+}
+
+// Link table
+//
+// Tracked link sent to a user
+type Link struct {
+	gorm.Model
+	Code       string `gorm:"uniqueIndex"`
+	Target     string
+	QuestionID int
+	Source     string
+}
+
+// LinkClick table
+type LinkClick struct {
+	gorm.Model
+	LinkID int
+}
+
+// Setting table
+//
+// Key-value state of the bot
+type Setting struct {
+	gorm.Model
+	Key   string `gorm:"uniqueIndex"`
+	Value string
+}
+
+// Alias table
+//
+// Personal command alias of an employee
+type Alias struct {
+	gorm.Model
+	UserID  int `gorm:"index"`
+	Name    string
+	Command string
+}
+
+// OutboxMessage table
+//
+// Message to a user waiting for delivery after a transient failure
+type OutboxMessage struct {
+	gorm.Model
+	ChatID      int `gorm:"index"`
+	Method      string
+	Payload     string
+	QuestionID  int
+	Attempts    int
+	NextAttempt time.Time
+	IsDead      bool `gorm:"default:false"`
+	Error       string
+}
+
+// QuietMessage table
+//
+// Notification to a user held until the quiet hours of the user end
+type QuietMessage struct {
+	gorm.Model
+	ChatID     int `gorm:"index"`
+	Method     string
+	Payload    string
+	QuestionID int
+	Collapse   bool // replaced by the next collapsing message of the Question
+	ReleaseAt  time.Time
+}
+
+// Group table
+//
+// Group chat the bot is a member of
+type Group struct {
+	gorm.Model
+	ChatID int `gorm:"uniqueIndex"`
+	Title  string
+	Source string // acquisition source from the startgroup payload
+}
+
+// Segment table
+//
+// Membership of a User in a named broadcast segment
+type Segment struct {
+	gorm.Model
+	UserID int `gorm:"index"`
+	Name   string
+}
+
+// Category table
+//
+// Feedback category chosen by the user before asking a question
+type Category struct {
+	gorm.Model
+	Emoji string
+	Name  string `gorm:"index"`
+}
+
+// Donation table
+//
+// Payment of a user tip, it is not linked to the User or conversations
+type Donation struct {
+	gorm.Model
+	Currency string
+	Amount   int
+	ChargeID string
+}
+
+// QuestionTag table
+//
+// Tag an employee put on the Question for /find
+type QuestionTag struct {
+	gorm.Model
+	QuestionID int `gorm:"index"`
+	Name       string
+}
+
+// RolloutCohort table
+//
+// Whether a feature under rollout applied to the Question
+type RolloutCohort struct {
+	gorm.Model
+	QuestionID int `gorm:"index"`
+	Feature    string
+	Enabled    bool
+}
+
+// Escalation table
+//
+// Question handed to the feedback bot of a partner team, its ID is the reference the partner replies to
+type Escalation struct {
+	gorm.Model
+	QuestionID int `gorm:"index"`
+	Team       string
+	IsClosed   bool `gorm:"default:false"`
+}
+
+// Verdicts of QualityReview
+const (
+	VerdictApproved  = "approved"
+	VerdictNeedsWork = "needs_work"
+)
+
+// QualityReview table
+//
+// Closed Question sampled for the owners' quality review, Verdict is empty until it is reviewed
+type QualityReview struct {
+	gorm.Model
+	QuestionID int `gorm:"uniqueIndex"`
+	AnswererID int `gorm:"index"`
+	ReviewerID int
+	Verdict    string `gorm:"index"`
+	Comment    string
+	ReviewedAt *time.Time
+}
+
+// Shared item kinds
+const (
+	ShareContact  = "contact"
+	ShareLocation = "location"
+	ShareVenue    = "venue"
+)
+
+// SharedItem table
+//
+// Contact, location or venue a user sent in a Question, a live location is stored as its first position
+type SharedItem struct {
+	gorm.Model
+	QuestionID    int `gorm:"index"`
+	MessageID     int
+	Kind          string
+	PhoneNumber   string
+	FirstName     string
+	LastName      string
+	ContactUserID int
+	Latitude      float64
+	Longitude     float64
+	Title         string
+	Address       string
+	IsLive        bool `gorm:"default:false"`
+}
+
+// ImportedMessage table
+//
+// Message of the feedback chat from before the bot, imported from a Telegram Desktop export
+type ImportedMessage struct {
+	gorm.Model
+	ChatID     int    `gorm:"uniqueIndex:idx_imported_message"`
+	MessageID  int    `gorm:"uniqueIndex:idx_imported_message"`
+	SenderID   string // "user123" from the export, "" for deleted accounts
+	SenderName string
+	Date       time.Time
+	Text       string
+	Media      string // path of the photo or file in the export, "" for text
+	ReplyTo    int    // MessageID of the replied message, 0 if it is not a reply
+	QuestionID int    // Question the message is stored in
+}
+
+// Template table
+//
+// Canned reply of the team, the text may have {{user}} and {{ticket}} placeholders
+type Template struct {
+	gorm.Model
+	Name     string `gorm:"uniqueIndex"`
+	Text     string
+	AuthorID int
+}
+
+// ChatCapability table
+//
+// Type of the admin chat and whether it has topics, MigratedTo is the supergroup a basic group became
+type ChatCapability struct {
+	gorm.Model
+	ChatID     int `gorm:"uniqueIndex"`
+	Type       string
+	IsForum    bool `gorm:"default:false"`
+	MigratedTo int
+	CheckedAt  time.Time
+}
+
+// UserTopic table
+//
+// Forum topic of the User in the admin chat
+type UserTopic struct {
+	gorm.Model
+	ChatID   int `gorm:"uniqueIndex:idx_user_topic;index:idx_topic_thread"`
+	UserID   int `gorm:"uniqueIndex:idx_user_topic"`
+	ThreadID int `gorm:"index:idx_topic_thread"`
 }
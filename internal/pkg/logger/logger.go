@@ -1,10 +1,16 @@
 package logger
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gookit/slog"
@@ -31,42 +37,362 @@ func Err(err error) error {
 	if err == nil {
 		return nil
 	}
-	return fmt.Errorf(getCallerInfo() + " " + err.Error())
+	wrapped := fmt.Errorf("%s %w", getCallerInfo(), err)
+	var fields FieldsError
+	if errors.As(err, &fields) {
+		return FieldsError{err: wrapped, Fields: fields.Fields}
+	}
+	return wrapped
+}
+
+// FieldsError is an error with key/value fields written next to the message
+type FieldsError struct {
+	err    error
+	Fields map[string]interface{}
+}
+
+func (e FieldsError) Error() string {
+	return e.err.Error()
+}
+
+func (e FieldsError) Unwrap() error {
+	return e.err
+}
+
+// WithFields attaches key/value pairs to the error, a key without a value gets nil
+//
+// In the text format fields are written after the message, in JSON as keys of the object
+func WithFields(err error, keyvals ...interface{}) error {
+	if err == nil {
+		return nil
+	}
+	fields := map[string]interface{}{}
+	var existing FieldsError
+	if errors.As(err, &existing) {
+		for key, value := range existing.Fields {
+			fields[key] = value
+		}
+	}
+	for i := 0; i < len(keyvals); i += 2 {
+		var value interface{}
+		if i+1 < len(keyvals) {
+			value = keyvals[i+1]
+		}
+		fields[fmt.Sprint(keyvals[i])] = value
+	}
+	return FieldsError{err: err, Fields: fields}
+}
+
+// Level is the minimum level of written messages
+type Level int
+
+// Levels from the most to the least verbose
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// levelNames are the names of levels in the configuration
+var levelNames = map[string]Level{"debug": LevelDebug, "info": LevelInfo, "warn": LevelWarn, "error": LevelError}
+
+// Format is the format of written messages
+type Format int
+
+// Formats of messages
+const (
+	FormatText Format = iota // Template lines
+	FormatJSON               // one JSON object per line with timestamp, level, caller, message and fields
+)
+
+// formatNames are the names of formats in the configuration
+var formatNames = map[string]Format{"text": FormatText, "json": FormatJSON}
+
+// Config is the logger configuration
+type Config struct {
+	Level        Level     // minimum level of written messages
+	Output       io.Writer // writer of debug and info messages, nil for the console
+	MaxSizeBytes int64     // size of the error log file after which it is rotated, 0 disables rotation
+	MaxBackups   int       // number of rotated files to keep, 0 keeps all
+	Format       Format    // format of messages, text by default
+}
+
+// settings are the current Config
+var settings = struct {
+	mu sync.RWMutex
+	Config
+}{Config: Config{Level: LevelInfo}}
+
+// rotation serializes rotations of the error log file
+var rotation sync.Mutex
+
+// Configure replaces the logger configuration
+func Configure(conf Config) {
+	settings.mu.Lock()
+	defer settings.mu.Unlock()
+	settings.Config = conf
+}
+
+// SetLevel sets the minimum level, messages below it are dropped
+func SetLevel(level Level) {
+	settings.mu.Lock()
+	defer settings.mu.Unlock()
+	settings.Level = level
+}
+
+// ParseLevel returns the level by name: debug, info, warn or error
+func ParseLevel(name string) (Level, error) {
+	level, ok := levelNames[strings.ToLower(name)]
+	if !ok {
+		return LevelInfo, NewError("Unknown log level \"" + name + "\", use debug, info, warn or error")
+	}
+	return level, nil
+}
+
+// SetFormat sets the format of messages
+func SetFormat(format Format) {
+	settings.mu.Lock()
+	defer settings.mu.Unlock()
+	settings.Format = format
+}
+
+// ParseFormat returns the format by name: text or json
+func ParseFormat(name string) (Format, error) {
+	format, ok := formatNames[strings.ToLower(name)]
+	if !ok {
+		return FormatText, NewError("Unknown log format \"" + name + "\", use text or json")
+	}
+	return format, nil
+}
+
+// SetOutput sets the writer of debug and info messages, nil for the console
+//
+// Warnings and errors are written to the error log file
+func SetOutput(w io.Writer) {
+	settings.mu.Lock()
+	defer settings.mu.Unlock()
+	settings.Output = w
+}
+
+// enabled reports whether messages of the level are written
+func enabled(level Level) bool {
+	settings.mu.RLock()
+	defer settings.mu.RUnlock()
+	return level >= settings.Level
+}
+
+func Debug(err error) {
+	if !enabled(LevelDebug) {
+		return
+	}
+	l, sinkErr := setSettingsInfo()
+	write(l, sinkErr, slog.DebugLevel, getCallerInfo(), err)
 }
 
 func Info(err error) {
-	defer slog.MustClose()
-	l := setSettingsInfo()
-	l.Info(getCallerInfo(), err)
+	if !enabled(LevelInfo) {
+		return
+	}
+	l, sinkErr := setSettingsInfo()
+	write(l, sinkErr, slog.InfoLevel, getCallerInfo(), err)
+}
+
+func Warn(err error) {
+	if !enabled(LevelWarn) {
+		return
+	}
+	l, sinkErr := setSettingsError()
+	write(l, sinkErr, slog.WarnLevel, getCallerInfo(), err)
 }
 
 func Error(err error) {
-	defer slog.MustClose()
-	l := setSettingsError()
-	l.Error(getCallerInfo(), err)
+	remember(err)
+	if !enabled(LevelError) {
+		return
+	}
+	l, sinkErr := setSettingsError()
+	write(l, sinkErr, slog.ErrorLevel, getCallerInfo(), err)
 }
 
 func Fatal(err error) {
-	defer slog.MustClose()
-	l := setSettingsError()
-	l.Fatal(getCallerInfo(), err)
+	remember(err)
+	caller := getCallerInfo()
+	l, sinkErr := setSettingsError()
+	write(l, sinkErr, slog.ErrorLevel, caller, err)
+	os.Exit(1)
+}
+
+// lastError is the last message logged with Error or Fatal
+var lastError struct {
+	mu   sync.Mutex
+	text string
+	at   time.Time
 }
 
-func setSettingsError() *slog.Logger {
-	f := slog.NewTextFormatter(Template)
+// remember stores the error as the last one
+func remember(err error) {
+	if err == nil {
+		return
+	}
+	lastError.mu.Lock()
+	defer lastError.mu.Unlock()
+	lastError.text, lastError.at = err.Error(), time.Now()
+}
+
+// LastError returns the last message logged with Error or Fatal and its time, empty if there was none
+func LastError() (string, time.Time) {
+	lastError.mu.Lock()
+	defer lastError.mu.Unlock()
+	return lastError.text, lastError.at
+}
+
+// fallbackNoticeInterval limits notices about the failed sink
+const fallbackNoticeInterval = time.Minute
+
+// fallbackOutput receives messages when the log sink fails
+var fallbackOutput io.Writer = os.Stderr
+
+// fallbackNotice is when the last notice about the failed sink was written
+var fallbackNotice struct {
+	mu   sync.Mutex
+	last time.Time
+}
+
+// write logs the message and falls back to stderr when the sink fails
+//
+// Sink failures never panic, the message is written to stderr with the "[logger fallback]" prefix
+func write(l *slog.Logger, sinkErr error, level slog.Level, caller string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			fallback(fmt.Errorf("%v", r), level, caller, err)
+		}
+	}()
+	if sinkErr != nil {
+		fallback(sinkErr, level, caller, err)
+		return
+	}
+	var fields FieldsError
+	errors.As(err, &fields)
+	if currentFormat() == FormatJSON {
+		data := slog.M{"caller": strings.Trim(caller, "[]")}
+		for key, value := range fields.Fields {
+			data[key] = value
+		}
+		l.WithFields(data).Log(level, err)
+	} else {
+		l.WithData(fields.Fields).Log(level, caller, err)
+	}
+	if sinkErr = l.LastErr(); sinkErr != nil {
+		fallback(sinkErr, level, caller, err)
+	}
+	if sinkErr = l.Close(); sinkErr != nil {
+		fallback(sinkErr, level, caller, nil)
+	}
+}
+
+// fallback writes the message to fallbackOutput, the sink error is reported once per fallbackNoticeInterval
+func fallback(sinkErr error, level slog.Level, caller string, err error) {
+	fallbackNotice.mu.Lock()
+	defer fallbackNotice.mu.Unlock()
+	if time.Since(fallbackNotice.last) >= fallbackNoticeInterval {
+		fallbackNotice.last = time.Now()
+		fmt.Fprintln(fallbackOutput, "[logger fallback] log sink failed:", sinkErr)
+	}
+	if err != nil {
+		fmt.Fprintf(fallbackOutput, "[logger fallback] [%s] [%s] %s %v\n", time.Now().Format(time.DateTime), level.Name(), caller, err)
+	}
+}
+
+// currentFormat returns the configured Format
+func currentFormat() Format {
+	settings.mu.RLock()
+	defer settings.mu.RUnlock()
+	return settings.Format
+}
+
+// formatter returns the slog formatter of the configured Format
+func formatter() slog.Formatter {
+	if currentFormat() == FormatJSON {
+		return slog.NewJSONFormatter(func(f *slog.JSONFormatter) {
+			f.Fields = []string{slog.FieldKeyDatetime, slog.FieldKeyLevel, slog.FieldKeyMessage}
+			f.Aliases = slog.StringMap{slog.FieldKeyDatetime: "timestamp"}
+			f.TimeFormat = time.RFC3339Nano
+		})
+	}
+	return slog.NewTextFormatter(Template)
+}
+
+func setSettingsError() (*slog.Logger, error) {
+	f := formatter()
 	filename := time.Now().Format("01.01.2000") + "-errors"
-	h, _ := handler.NewFileHandler("errors\\"+filename+".log", handler.WithLogLevels(slog.DangerLevels))
+	rotate("errors\\" + filename + ".log")
+	h, err := handler.NewFileHandler("errors\\"+filename+".log", handler.WithLogLevels(slog.DangerLevels))
+	if err != nil {
+		return nil, err
+	}
 	h.SetFormatter(f)
 	l := slog.NewWithHandlers(h)
-	return l
+	return l, nil
 }
 
-func setSettingsInfo() *slog.Logger {
-	f := slog.NewTextFormatter(Template)
-	h := handler.NewConsoleHandler(slog.NormalLevels)
+func setSettingsInfo() (*slog.Logger, error) {
+	f := formatter()
+	settings.mu.RLock()
+	output := settings.Output
+	settings.mu.RUnlock()
+	var h slog.FormattableHandler = handler.NewConsoleHandler(slog.NormalLevels)
+	if output != nil {
+		h = handler.NewIOWriter(output, slog.NormalLevels)
+	}
 	h.SetFormatter(f)
 	l := slog.NewWithHandlers(h)
-	return l
+	return l, nil
+}
+
+// rotate renames the log file with a timestamp suffix when it exceeds MaxSizeBytes
+// and removes the oldest rotated files beyond MaxBackups
+//
+// Failures are reported to fallbackOutput, the message is still written to the current file
+func rotate(path string) {
+	settings.mu.RLock()
+	maxSize, maxBackups := settings.MaxSizeBytes, settings.MaxBackups
+	settings.mu.RUnlock()
+	if maxSize <= 0 {
+		return
+	}
+	rotation.Lock()
+	defer rotation.Unlock()
+	info, err := os.Stat(path)
+	if err != nil || info.Size() < maxSize {
+		return
+	}
+	base := strings.TrimSuffix(path, ".log")
+	if err := os.Rename(path, base+"-"+time.Now().Format("20060102-150405.000")+".log"); err != nil {
+		fmt.Fprintln(fallbackOutput, "[logger fallback] log rotation failed:", err)
+		return
+	}
+	if maxBackups <= 0 {
+		return
+	}
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		return
+	}
+	var backups []string
+	prefix := filepath.Base(base) + "-"
+	for _, entry := range entries {
+		if name := entry.Name(); strings.HasPrefix(name, prefix) && strings.HasSuffix(name, ".log") {
+			backups = append(backups, filepath.Join(filepath.Dir(path), name))
+		}
+	}
+	sort.Strings(backups)
+	for len(backups) > maxBackups {
+		if err := os.Remove(backups[0]); err != nil {
+			fmt.Fprintln(fallbackOutput, "[logger fallback] removing an old log failed:", err)
+		}
+		backups = backups[1:]
+	}
 }
 
 func getCallerInfo() string {
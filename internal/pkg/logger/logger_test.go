@@ -0,0 +1,278 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// failingWriter fails every write
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("permission denied")
+}
+
+// panickingWriter panics on every write
+type panickingWriter struct{}
+
+func (panickingWriter) Write(p []byte) (int, error) {
+	panic("broken sink")
+}
+
+// captureFallback redirects the fallback output to the buffer and resets the notice limit for the test
+func captureFallback(t *testing.T, sink io.Writer) *bytes.Buffer {
+	var buf bytes.Buffer
+	previous := fallbackOutput
+	fallbackOutput = &buf
+	fallbackNotice.last = time.Time{}
+	SetOutput(sink)
+	t.Cleanup(func() {
+		fallbackOutput = previous
+		fallbackNotice.last = time.Time{}
+		SetOutput(nil)
+	})
+	return &buf
+}
+
+func TestFailingSinkFallsBackToStderr(t *testing.T) {
+	buf := captureFallback(t, failingWriter{})
+	Info(NewError("first message"))
+	Info(NewError("second message"))
+	out := buf.String()
+	if !strings.Contains(out, "first message") || !strings.Contains(out, "second message") {
+		t.Fatalf("fallback output = %q", out)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		if !strings.HasPrefix(line, "[logger fallback] ") {
+			t.Fatalf("line without the prefix: %q", line)
+		}
+	}
+	if n := strings.Count(out, "log sink failed: "); n != 1 {
+		t.Fatalf("sink failure notices = %d, want 1 per interval:\n%s", n, out)
+	}
+	if !strings.Contains(out, "permission denied") {
+		t.Fatalf("the sink error is not reported:\n%s", out)
+	}
+}
+
+func TestPanickingSinkDoesNotPanic(t *testing.T) {
+	buf := captureFallback(t, panickingWriter{})
+	Info(NewError("still logged"))
+	out := buf.String()
+	if !strings.Contains(out, "broken sink") || !strings.Contains(out, "still logged") {
+		t.Fatalf("fallback output = %q", out)
+	}
+}
+
+func TestWorkingSinkDoesNotFallBack(t *testing.T) {
+	buf := captureFallback(t, nil)
+	var sink bytes.Buffer
+	SetOutput(&sink)
+	Info(NewError("written"))
+	if buf.Len() != 0 || !strings.Contains(sink.String(), "written") {
+		t.Fatalf("fallback = %q, sink = %q", buf.String(), sink.String())
+	}
+}
+
+// logDir runs the test in a temporary directory that receives the error log file
+func logDir(t *testing.T) string {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	return dir
+}
+
+// errorLog returns the contents of the error log files in the directory
+func errorLog(t *testing.T, dir string) string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.Write(data)
+	}
+	return b.String()
+}
+
+func TestLevelSuppressesLowerMessages(t *testing.T) {
+	dir := logDir(t)
+	captureFallback(t, nil)
+	var sink bytes.Buffer
+	SetOutput(&sink)
+	t.Cleanup(func() { SetLevel(LevelInfo) })
+
+	SetLevel(LevelWarn)
+	Debug(NewError("debug below"))
+	Info(NewError("info below"))
+	Warn(NewError("warn at"))
+	Error(NewError("error above"))
+	if sink.Len() != 0 {
+		t.Fatalf("messages below warn are written: %q", sink.String())
+	}
+	out := errorLog(t, dir)
+	if !strings.Contains(out, "warn at") || !strings.Contains(out, "error above") {
+		t.Fatalf("error log = %q, want the warning and the error", out)
+	}
+
+	SetLevel(LevelDebug)
+	Debug(NewError("debug at"))
+	Info(NewError("info above"))
+	if out := sink.String(); !strings.Contains(out, "debug at") || !strings.Contains(out, "info above") {
+		t.Fatalf("sink = %q, want debug and info messages", out)
+	}
+
+	SetLevel(LevelError)
+	Warn(NewError("warn below"))
+	Error(NewError("error at"))
+	if out := errorLog(t, dir); strings.Contains(out, "warn below") || !strings.Contains(out, "error at") {
+		t.Fatalf("error log = %q, want only the error", out)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for name, want := range map[string]Level{"debug": LevelDebug, "INFO": LevelInfo, "Warn": LevelWarn, "error": LevelError} {
+		if level, err := ParseLevel(name); err != nil || level != want {
+			t.Errorf("ParseLevel(%q) = %v, %v, want %v", name, level, err, want)
+		}
+	}
+	if level, err := ParseLevel("verbose"); err == nil || level != LevelInfo {
+		t.Errorf("ParseLevel(verbose) = %v, %v, want an error and info", level, err)
+	}
+}
+
+func TestErrorLogRotatesBySize(t *testing.T) {
+	dir := logDir(t)
+	captureFallback(t, nil)
+	Configure(Config{Level: LevelInfo, MaxSizeBytes: 200, MaxBackups: 2})
+	t.Cleanup(func() { Configure(Config{Level: LevelInfo}) })
+
+	for i := 0; i < 8; i++ {
+		Error(NewError(strings.Repeat("x", 150)))
+		time.Sleep(2 * time.Millisecond)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var active string
+	backups := 0
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), "-errors.log") {
+			active = entry.Name()
+		} else if strings.Contains(entry.Name(), "-errors-") {
+			backups++
+		}
+	}
+	if active == "" || backups != 2 {
+		t.Fatalf("files = %v, want the active file and 2 backups", entries)
+	}
+	info, err := os.Stat(filepath.Join(dir, active))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() >= 400 {
+		t.Fatalf("active file has %d bytes, want it truncated after the rotation", info.Size())
+	}
+}
+
+func TestRotateKeepsSmallFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	if err := os.WriteFile(path, []byte("short"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	Configure(Config{Level: LevelInfo, MaxSizeBytes: 100})
+	t.Cleanup(func() { Configure(Config{Level: LevelInfo}) })
+	rotate(path)
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Fatalf("files = %v, want the file kept", entries)
+	}
+
+	Configure(Config{Level: LevelInfo})
+	if err := os.WriteFile(path, []byte(strings.Repeat("x", 500)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	rotate(path)
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Fatalf("files = %v, rotation without MaxSizeBytes", entries)
+	}
+
+	Configure(Config{Level: LevelInfo, MaxSizeBytes: 100})
+	rotate(path)
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 || !strings.HasPrefix(entries[0].Name(), "app-") {
+		t.Fatalf("files = %v, want only the backup", entries)
+	}
+}
+
+func TestJSONFormatWritesObjects(t *testing.T) {
+	captureFallback(t, nil)
+	var sink bytes.Buffer
+	SetOutput(&sink)
+	SetFormat(FormatJSON)
+	t.Cleanup(func() { SetFormat(FormatText) })
+
+	Info(WithFields(NewError("question sent"), "question", 7, "chat", "admins", "dangling"))
+	Info(Err(WithFields(NewError("wrapped"), "update", 3)))
+	lines := strings.Split(strings.TrimSpace(sink.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("output = %q, want one line per call", sink.String())
+	}
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("line %q is not JSON: %v", lines[0], err)
+	}
+	for _, key := range []string{"timestamp", "level", "message", "caller"} {
+		if _, ok := entry[key]; !ok {
+			t.Errorf("entry %v has no %q", entry, key)
+		}
+	}
+	if entry["message"] != "question sent" || entry["question"] != float64(7) || entry["chat"] != "admins" || entry["dangling"] != nil {
+		t.Fatalf("entry = %v", entry)
+	}
+	if _, err := time.Parse(time.RFC3339Nano, fmt.Sprint(entry["timestamp"])); err != nil {
+		t.Fatalf("timestamp: %v", err)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &entry); err != nil || entry["update"] != float64(3) {
+		t.Fatalf("wrapped entry = %v, %v, want the fields kept through Err", entry, err)
+	}
+}
+
+func TestTextFormatWritesFieldsAfterMessage(t *testing.T) {
+	captureFallback(t, nil)
+	var sink bytes.Buffer
+	SetOutput(&sink)
+	Info(WithFields(NewError("question sent"), "question", 7))
+	out := sink.String()
+	if strings.HasPrefix(strings.TrimSpace(out), "{") || !strings.Contains(out, "question sent") || !strings.Contains(out, "question") || !strings.Contains(out, "7") {
+		t.Fatalf("text output = %q", out)
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	if format, err := ParseFormat("JSON"); err != nil || format != FormatJSON {
+		t.Fatalf("ParseFormat(JSON) = %v, %v", format, err)
+	}
+	if format, err := ParseFormat("xml"); err == nil || format != FormatText {
+		t.Fatalf("ParseFormat(xml) = %v, %v, want an error and text", format, err)
+	}
+}
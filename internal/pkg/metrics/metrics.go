@@ -0,0 +1,262 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Bot metrics
+var (
+	Updates         = NewCounter("feedback_updates_total", "Updates received by type", "type")
+	HandlerDuration = NewHistogram("feedback_handler_duration_seconds", "Update handling duration by type", []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}, "type")
+	APIRequests     = NewCounter("feedback_api_requests_total", "Bot API calls by method and status code", "method", "code")
+	APIUnavailable  = NewCounter("feedback_api_unavailable_total", "Non-JSON Bot API responses (Telegram maintenance) by method", "method")
+	Submissions     = NewCounter("feedback_submissions_total", "Feedback submissions by kind", "kind")
+	ProfileCache    = NewCounter("feedback_profile_cache_total", "User profile lookups by result: hit, miss or refresh with getChat", "result")
+	RateLimiter     = NewGauge("feedback_rate_limiter_active_users", "Users with messages in the rate limiter window")
+	UpdateQueue     = NewGauge("feedback_update_queue_depth", "Updates queued or being handled by the workers")
+	Takeovers       = NewCounter("feedback_takeovers_total", "Questions released from an unresponsive answerer by the answerer chat ID", "answerer")
+)
+
+// metric is written in the Prometheus text format
+type metric interface {
+	write(b *strings.Builder)
+}
+
+// registry holds all metrics in the order of creation
+var registry struct {
+	mu      sync.Mutex
+	metrics []metric
+}
+
+// register adds the metric to the registry
+func register(m metric) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	registry.metrics = append(registry.metrics, m)
+}
+
+// Handler returns the HTTP handler of the metrics in the Prometheus text format
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var b strings.Builder
+		registry.mu.Lock()
+		for _, m := range registry.metrics {
+			m.write(&b)
+		}
+		registry.mu.Unlock()
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.Write([]byte(b.String()))
+	})
+}
+
+// Counter is a monotonically increasing value by labels
+type Counter struct {
+	name   string
+	help   string
+	labels []string
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// NewCounter creates and registers Counter
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{name: name, help: help, labels: labels, values: map[string]float64{}}
+	register(c)
+	return c
+}
+
+// Inc increments the counter of the label values
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add adds v to the counter of the label values
+func (c *Counter) Add(v float64, values ...string) {
+	key := labelsText(c.labels, values)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[key] += v
+}
+
+// Value returns the counter of the label values
+func (c *Counter) Value(values ...string) float64 {
+	key := labelsText(c.labels, values)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[key]
+}
+
+// Total returns the sum of the counter over all label values
+func (c *Counter) Total() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var total float64
+	for _, v := range c.values {
+		total += v
+	}
+	return total
+}
+
+func (c *Counter) write(b *strings.Builder) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	header(b, c.name, c.help, "counter")
+	for _, key := range sortedKeys(c.values) {
+		fmt.Fprintf(b, "%s%s %s\n", c.name, key, formatFloat(c.values[key]))
+	}
+}
+
+// Gauge is a value read when the metrics are collected
+type Gauge struct {
+	name  string
+	help  string
+	mu    sync.Mutex
+	value func() float64
+}
+
+// NewGauge creates and registers Gauge, it is not written until Set is called
+func NewGauge(name, help string) *Gauge {
+	g := &Gauge{name: name, help: help}
+	register(g)
+	return g
+}
+
+// Set sets the function returning the gauge value
+func (g *Gauge) Set(value func() float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.value = value
+}
+
+func (g *Gauge) write(b *strings.Builder) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.value == nil {
+		return
+	}
+	header(b, g.name, g.help, "gauge")
+	fmt.Fprintf(b, "%s %s\n", g.name, formatFloat(g.value()))
+}
+
+// Histogram counts observations in buckets by labels
+type Histogram struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+	mu      sync.Mutex
+	series  map[string]*histogramSeries
+}
+
+// histogramSeries is the histogram of one set of label values
+type histogramSeries struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// NewHistogram creates and registers Histogram with upper bounds of buckets in ascending order
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{name: name, help: help, labels: labels, buckets: buckets, series: map[string]*histogramSeries{}}
+	register(h)
+	return h
+}
+
+// Observe adds the value to the histogram of the label values
+func (h *Histogram) Observe(v float64, values ...string) {
+	key := labelsText(h.labels, values)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	for i, bound := range h.buckets {
+		if v <= bound {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.sum += v
+}
+
+// Since observes the seconds elapsed from start
+func (h *Histogram) Since(start time.Time, values ...string) {
+	h.Observe(time.Since(start).Seconds(), values...)
+}
+
+func (h *Histogram) write(b *strings.Builder) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	header(b, h.name, h.help, "histogram")
+	keys := make([]string, 0, len(h.series))
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := h.series[key]
+		for i, bound := range h.buckets {
+			fmt.Fprintf(b, "%s_bucket%s %d\n", h.name, withLabel(key, "le", formatFloat(bound)), s.counts[i])
+		}
+		fmt.Fprintf(b, "%s_bucket%s %d\n", h.name, withLabel(key, "le", "+Inf"), s.count)
+		fmt.Fprintf(b, "%s_sum%s %s\n", h.name, key, formatFloat(s.sum))
+		fmt.Fprintf(b, "%s_count%s %d\n", h.name, key, s.count)
+	}
+}
+
+// header writes HELP and TYPE lines
+func header(b *strings.Builder, name, help, kind string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// labelsText returns the labels in the format {name="value",...}, missing values are empty
+func labelsText(labels, values []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(labels))
+	for i, label := range labels {
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+		pairs[i] = label + "=" + strconv.Quote(value)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// withLabel appends the label to the labels text
+func withLabel(labels, name, value string) string {
+	pair := name + "=" + strconv.Quote(value)
+	if labels == "" {
+		return "{" + pair + "}"
+	}
+	return strings.TrimSuffix(labels, "}") + "," + pair + "}"
+}
+
+// sortedKeys returns the map keys in ascending order
+func sortedKeys(values map[string]float64) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// formatFloat formats the value as Prometheus does
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// scrape returns the metrics the handler writes
+func scrape(t *testing.T) string {
+	server := httptest.NewServer(Handler())
+	t.Cleanup(server.Close)
+	resp, err := server.Client().Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Fatalf("content type = %q", resp.Header.Get("Content-Type"))
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+// assertLines fails the test if the scraped metrics lack any of the lines
+func assertLines(t *testing.T, text string, lines ...string) {
+	t.Helper()
+	for _, line := range lines {
+		if !strings.Contains(text, line+"\n") {
+			t.Fatalf("no %q in\n%s", line, text)
+		}
+	}
+}
+
+func TestCounterIsWrittenByLabels(t *testing.T) {
+	c := NewCounter("test_calls_total", "Calls by method and code", "method", "code")
+	c.Inc("sendMessage", "200")
+	c.Inc("sendMessage", "200")
+	c.Add(3, "getMe", "502")
+	if c.Value("sendMessage", "200") != 2 || c.Total() != 5 {
+		t.Fatalf("value = %v, total = %v", c.Value("sendMessage", "200"), c.Total())
+	}
+	assertLines(t, scrape(t),
+		"# HELP test_calls_total Calls by method and code",
+		"# TYPE test_calls_total counter",
+		`test_calls_total{method="getMe",code="502"} 3`,
+		`test_calls_total{method="sendMessage",code="200"} 2`,
+	)
+}
+
+func TestHistogramBucketsAreCumulative(t *testing.T) {
+	h := NewHistogram("test_duration_seconds", "Durations", []float64{0.1, 1}, "type")
+	h.Observe(0.05, "message")
+	h.Observe(0.5, "message")
+	h.Observe(2, "message")
+	assertLines(t, scrape(t),
+		"# TYPE test_duration_seconds histogram",
+		`test_duration_seconds_bucket{type="message",le="0.1"} 1`,
+		`test_duration_seconds_bucket{type="message",le="1"} 2`,
+		`test_duration_seconds_bucket{type="message",le="+Inf"} 3`,
+		`test_duration_seconds_sum{type="message"} 2.55`,
+		`test_duration_seconds_count{type="message"} 3`,
+	)
+}
+
+func TestGaugeIsWrittenOnceSet(t *testing.T) {
+	g := NewGauge("test_queue_depth", "Queued items")
+	if text := scrape(t); strings.Contains(text, "test_queue_depth") {
+		t.Fatalf("the unset gauge is written:\n%s", text)
+	}
+	depth := 4
+	g.Set(func() float64 { return float64(depth) })
+	assertLines(t, scrape(t), "# TYPE test_queue_depth gauge", "test_queue_depth 4")
+	depth = 1
+	assertLines(t, scrape(t), "test_queue_depth 1")
+}
@@ -0,0 +1,81 @@
+package vault
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"strconv"
+	l "telegram-bot-feedback/internal/pkg/logger"
+)
+
+// Vault file format: magic, format version, nonce and the AES-256-GCM ciphertext.
+// The magic and the version are authenticated with the ciphertext
+const (
+	magic = "FBVAULT"
+	// Version is the format version Seal writes, Open refuses newer ones
+	Version byte = 1
+	// KeySize is the length of the key in bytes, 64 hex characters in the configuration
+	KeySize = 32
+)
+
+// ParseKey decodes the hex key
+func ParseKey(key string) ([]byte, error) {
+	decoded, err := hex.DecodeString(key)
+	if err != nil || len(decoded) != KeySize {
+		return nil, l.NewError("The vault key must be " + strconv.Itoa(KeySize*2) + " hex characters, generate one with \"openssl rand -hex 32\"")
+	}
+	return decoded, nil
+}
+
+// Seal encrypts the data with the key
+func Seal(data, key []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	header := append([]byte(magic), Version)
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, l.Err(err)
+	}
+	sealed := make([]byte, 0, len(header)+len(nonce)+len(data)+gcm.Overhead())
+	sealed = append(append(sealed, header...), nonce...)
+	return gcm.Seal(sealed, nonce, data, header), nil
+}
+
+// Open decrypts the file sealed with the key
+func Open(file, key []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(file) < len(magic)+1+gcm.NonceSize() || !bytes.HasPrefix(file, []byte(magic)) {
+		return nil, l.NewError("Not a vault file")
+	}
+	header := file[:len(magic)+1]
+	if version := header[len(magic)]; version > Version {
+		return nil, l.NewError("Unsupported vault format version " + strconv.Itoa(int(version)) + ", update the bot")
+	}
+	nonce := file[len(header) : len(header)+gcm.NonceSize()]
+	data, err := gcm.Open(nil, nonce, file[len(header)+gcm.NonceSize():], header)
+	if err != nil {
+		return nil, l.NewError("Wrong vault key or damaged file")
+	}
+	return data, nil
+}
+
+// newGCM returns AES-256-GCM with the key
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, l.NewError("The vault key must be " + strconv.Itoa(KeySize) + " bytes")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, l.Err(err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	return gcm, l.Err(err)
+}
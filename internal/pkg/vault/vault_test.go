@@ -0,0 +1,74 @@
+package vault
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// testKey is the hex key of the tests
+const testKey = "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+
+func TestParseKey(t *testing.T) {
+	key, err := ParseKey(testKey)
+	if err != nil || len(key) != KeySize || key[31] != 0x1f {
+		t.Fatalf("ParseKey = %x, %v", key, err)
+	}
+	for _, bad := range []string{"", "00", testKey[:62], testKey + "00", strings.Replace(testKey, "00", "zz", 1)} {
+		if _, err := ParseKey(bad); err == nil || !strings.Contains(err.Error(), "64 hex characters") {
+			t.Errorf("ParseKey(%q) err = %v", bad, err)
+		}
+	}
+}
+
+func TestSealOpen(t *testing.T) {
+	key, _ := ParseKey(testKey)
+	data := []byte(`{"version":1}`)
+	sealed, err := Seal(data, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(sealed, []byte("FBVAULT\x01")) || bytes.Contains(sealed, data) {
+		t.Fatalf("sealed = %q", sealed)
+	}
+	again, _ := Seal(data, key)
+	if bytes.Equal(sealed, again) {
+		t.Fatal("the nonce is reused")
+	}
+	opened, err := Open(sealed, key)
+	if err != nil || !bytes.Equal(opened, data) {
+		t.Fatalf("Open = %q, %v", opened, err)
+	}
+	if _, err := Seal(data, key[:16]); err == nil {
+		t.Fatal("a short key is accepted")
+	}
+}
+
+func TestOpenRejects(t *testing.T) {
+	key, _ := ParseKey(testKey)
+	other := bytes.Repeat([]byte{7}, KeySize)
+	sealed, _ := Seal([]byte("snapshot"), key)
+	modify := func(i int, b byte) []byte {
+		file := append([]byte(nil), sealed...)
+		file[i] = b
+		return file
+	}
+	tests := []struct {
+		name string
+		file []byte
+		key  []byte
+		want string
+	}{
+		{"wrong key", sealed, other, "Wrong vault key or damaged file"},
+		{"damaged ciphertext", modify(len(sealed)-1, sealed[len(sealed)-1]^1), key, "Wrong vault key or damaged file"},
+		{"downgraded version", modify(len(magic), 0), key, "Wrong vault key or damaged file"},
+		{"newer version", modify(len(magic), Version+1), key, "Unsupported vault format version 2, update the bot"},
+		{"another file", []byte(strings.Repeat("x", 64)), key, "Not a vault file"},
+		{"truncated", sealed[:len(magic)+4], key, "Not a vault file"},
+	}
+	for _, tt := range tests {
+		if _, err := Open(tt.file, tt.key); err == nil || err.Error() != tt.want {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
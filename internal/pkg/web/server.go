@@ -0,0 +1,27 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	l "telegram-bot-feedback/internal/pkg/logger"
+	"time"
+)
+
+// Run starts the HTTP server and stops it when the context is done
+func Run(ctx context.Context, addr string, handler http.Handler) {
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+	err := server.ListenAndServe()
+	if err != nil && err != http.ErrServerClosed {
+		l.Error(l.Err(err))
+	}
+}
@@ -0,0 +1,38 @@
+package telegram
+
+import "testing"
+
+func TestGetChatAdministrators(t *testing.T) {
+	m := newMockServer(t)
+	m.respond("getChatAdministrators", `{"ok":true,"result":[
+		{"status":"creator","user":{"id":10,"is_bot":false,"first_name":"Owner"},"is_anonymous":false},
+		{"status":"administrator","user":{"id":11,"is_bot":false,"first_name":"Ann"},"can_be_edited":false,"can_delete_messages":true},
+		{"status":"administrator","user":{"id":12,"is_bot":true,"first_name":"Helper","username":"helper_bot"},"can_be_edited":true}
+	]}`)
+	members, err := m.client(t).GetChatAdministrators(-1001234567890)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 3 {
+		t.Fatalf("members = %+v", members)
+	}
+	if !members[0].IsCreator() || members[0].IsAdministrator() || members[0].User.ID != 10 {
+		t.Errorf("creator = %+v", members[0])
+	}
+	for _, admin := range members[1:] {
+		if admin.IsCreator() || !admin.IsAdministrator() {
+			t.Errorf("administrator = %+v", admin)
+		}
+	}
+	if !members[1].CanDeleteMessages || !members[2].User.IsBot {
+		t.Fatalf("members = %+v", members)
+	}
+	if body := string(m.calls("getChatAdministrators")[0].Body); body != `{"chat_id":-1001234567890}` {
+		t.Fatalf("body = %s", body)
+	}
+
+	m.respond("getChatAdministrators", `400 {"ok":false,"error_code":400,"description":"Bad Request: chat not found"}`)
+	if members, err := m.client(t).GetChatAdministrators(5); !IsChatNotFound(err) || members != nil {
+		t.Fatalf("GetChatAdministrators = %v, %v", members, err)
+	}
+}
@@ -2,14 +2,21 @@ package telegram
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math/rand"
 	"mime/multipart"
+	"net"
 	"net/http"
+	"os"
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"golang.org/x/exp/slog"
@@ -20,24 +27,67 @@ type HTTPClient interface {
 	Do(req *http.Request) (*http.Response, error)
 }
 
+// DefaultHTTPTimeout is the request timeout of the default HTTP client.
+//
+// Longer getUpdates long poll timeouts are shortened, see GetUpdatesWithContext.
+const DefaultHTTPTimeout = 2 * time.Minute
+
+// UpdatesTimeoutMargin is added to the long poll timeout to detect hung getUpdates requests.
+const UpdatesTimeoutMargin = 10 * time.Second
+
+// DefaultMaxRetries is the number of retries of transient failures of a new Client.
+const DefaultMaxRetries = 3
+
+// Retry delays of 5xx responses and network errors, the delay doubles with every attempt. Tests shorten them.
+var (
+	retryBaseDelay = 500 * time.Millisecond
+	retryMaxDelay  = 30 * time.Second
+)
+
+// UnavailableHook is called when a Bot API request got a non-JSON response, see UnavailableError.
+type UnavailableHook func(method string, err *UnavailableError)
+
+// ResponseHook is called after a Bot API request with the HTTP status code
+// (0 if the request failed) and the request duration.
+type ResponseHook func(method string, statusCode int, elapsed time.Duration)
+
 // Client allows you to interact with the Telegram Bot API.
 type Client struct {
-	Host            string     // Telegram Bot API Host
-	Token           string     // Telegram Bot API Token
-	Debug           bool       // If true, enable debug logging
-	Buffer          int        // Buffer size (default 100)
-	Self            User       // Bot info from method getMe
-	Client          HTTPClient //HTTP client
-	botEndpoint     string     // Endpoint format: https://api.telegram.org/bot<token>
-	fileEndpoint    string     // Endpoint format: https://api.telegram.org/file/bot<token>
+	Host            string          // Telegram Bot API Host
+	Token           string          // Telegram Bot API Token
+	Debug           bool            // If true, enable debug logging
+	Buffer          int             // Buffer size (default 100)
+	Self            User            // Bot info from method getMe
+	Client          HTTPClient      //HTTP client
+	OnResponse      ResponseHook    // Optional. Called after every Bot API request
+	OnUnavailable   UnavailableHook // Optional. Called after every non-JSON response, e.g. during Telegram maintenance
+	MaxRetries      int             // Retries of 5xx responses, 429 and network errors (default 3), 0 disables them
+	AllowedUpdates  []string        // Optional. Update types for getUpdates and setWebhook when the config doesn't list them, nil for all
+	localMode       bool            // If true, the Bot API server is local and files are read from disk
+	limiter         *RateLimiter    // Paces send methods, see WithRateLimit
+	botEndpoint     string          // Endpoint format: https://api.telegram.org/bot<token>
+	fileEndpoint    string          // Endpoint format: https://api.telegram.org/file/bot<token>
 	shutdownChannel chan interface{}
 }
 
+// Option configures a Client.
+type Option func(*Client)
+
+// WithLocalMode tells the Client that the Bot API server runs with --local.
+//
+// In local mode getFile returns absolute paths on the server machine,
+// such files are read directly from disk and have no 20 MB download limit.
+func WithLocalMode() Option {
+	return func(client *Client) {
+		client.localMode = true
+	}
+}
+
 // New creates a new Client instance.
 //
 // It requires a token, provided by @BotFather on Telegram.
-func New(token string) (*Client, error) {
-	return NewWithClient(token, BaseEndpoint, &http.Client{})
+func New(token string, opts ...Option) (*Client, error) {
+	return NewWithClient(token, BaseEndpoint, &http.Client{Timeout: DefaultHTTPTimeout}, opts...)
 }
 
 // NewWithHost creates a new Client instance
@@ -46,25 +96,40 @@ func New(token string) (*Client, error) {
 // Format: "https://api.telegram.org/"
 //
 // It requires a token, provided by @BotFather on Telegram and API endpoint.
-func NewWithHost(token, host string) (*Client, error) {
-	return NewWithClient(token, host, &http.Client{})
+func NewWithHost(token, host string, opts ...Option) (*Client, error) {
+	return NewWithClient(token, host, &http.Client{Timeout: DefaultHTTPTimeout}, opts...)
+}
+
+// NewClientWithHTTPClient creates a new Client instance
+// and allows you to pass a http.Client for proxies, timeouts or connection pooling.
+//
+// The http.Client is used for all requests, including file downloads.
+//
+// It requires a token, provided by @BotFather on Telegram.
+func NewClientWithHTTPClient(token string, httpClient *http.Client, opts ...Option) (*Client, error) {
+	return NewWithClient(token, BaseEndpoint, httpClient, opts...)
 }
 
 // NewWithClient creates a new Client instance
 // and allows you to pass a http.Client.
 //
 // It requires a token, provided by @BotFather on Telegram and API endpoint.
-func NewWithClient(token, host string, client HTTPClient) (*Client, error) {
+func NewWithClient(token, host string, client HTTPClient, opts ...Option) (*Client, error) {
 	bot := &Client{
 		Host:            host,
 		Token:           token,
 		Client:          client,
 		Buffer:          100,
+		MaxRetries:      DefaultMaxRetries,
 		botEndpoint:     strings.TrimSuffix(host, "/") + "/bot" + token,
 		fileEndpoint:    strings.TrimSuffix(host, "/") + "/file/bot" + token,
 		shutdownChannel: make(chan interface{}),
 	}
 
+	for _, opt := range opts {
+		opt(bot)
+	}
+
 	self, err := bot.GetMe()
 	if err != nil {
 		return nil, err
@@ -82,144 +147,218 @@ func (client *Client) UpdateEndpoints() {
 	client.fileEndpoint = strings.TrimSuffix(client.Host, "/") + "/file/bot" + client.Token
 }
 
+// Raw calls a Bot API method which has no typed config yet.
+//
+// Params are sent as a JSON object, nil params send an empty object. Values are
+// encoded with encoding/json, so nested objects such as reply_markup can be
+// passed as structs. File uploads are not supported, use file IDs or URLs.
+func (client *Client) Raw(method string, params map[string]interface{}) (*APIResponse, error) {
+	return client.RawWithContext(context.Background(), method, params)
+}
+
+// RawWithContext is Raw which cancels the HTTP request when ctx is done.
+func (client *Client) RawWithContext(ctx context.Context, method string, params map[string]interface{}) (*APIResponse, error) {
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+
+	return client.MakeRequestWithContext(ctx, method, params)
+}
+
 // MakeRequest creates a request to send data.
 // The transfer type is application/json, not suitable for file transfer. Accepts any struct with JSON tags.
 func (client *Client) MakeRequest(method string, data interface{}) (*APIResponse, error) {
+	return client.MakeRequestWithContext(context.Background(), method, data)
+}
+
+// MakeRequestWithContext is MakeRequest which cancels the HTTP request when ctx is done.
+func (client *Client) MakeRequestWithContext(ctx context.Context, method string, data interface{}) (*APIResponse, error) {
 	if client.Debug {
 		slog.Debug("Method: %s, data: %v\n", method, data)
 	}
 
-	url := client.botEndpoint + "/" + strings.TrimPrefix(method, "/")
-
 	values, err := json.Marshal(data)
 	if err != nil {
 		return nil, err
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(values))
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := client.Client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	var apiResp APIResponse
-	bytes, err := client.decodeAPIResponse(resp.Body, &apiResp)
-	if err != nil {
-		return &apiResp, err
-	}
-
-	if client.Debug {
-		slog.Debug("Method: %s, response: %s\n", method, string(bytes))
+	chatID := ""
+	if client.limiter != nil && isSendMethod(method) {
+		chatID = chatIDOf(values)
 	}
 
-	if !apiResp.Ok {
-		var parameters ResponseParameters
-
-		if apiResp.Parameters != nil {
-			parameters = *apiResp.Parameters
-		}
+	return client.doRequest(ctx, method, chatID, true, func() (io.Reader, string) {
+		return bytes.NewReader(values), "application/json"
+	})
+}
 
-		return &apiResp, &Error{
-			Code:               apiResp.ErrorCode,
-			Message:            apiResp.Description,
-			ResponseParameters: parameters,
-		}
+// observe calls OnResponse if it is set.
+func (client *Client) observe(method string, statusCode int, start time.Time) {
+	if client.OnResponse != nil {
+		client.OnResponse(method, statusCode, time.Since(start))
 	}
-
-	return &apiResp, nil
 }
 
 // MakeRequestWithFiles creates a request to send data.
 // The transfer type is multipart/form-data, suitable for file transfer. Accepts any struct with JSON tags.
 func (client *Client) MakeRequestWithFiles(method string, data interface{}, files []RequestFile) (*APIResponse, error) {
+	return client.MakeRequestWithFilesContext(context.Background(), method, data, files)
+}
+
+// MakeRequestWithFilesContext is MakeRequestWithFiles which cancels the HTTP request when ctx is done.
+//
+// Requests with a FileReader are not retried, the reader can't be read twice.
+func (client *Client) MakeRequestWithFilesContext(ctx context.Context, method string, data interface{}, files []RequestFile) (*APIResponse, error) {
 	values, err := structToMap(data)
 	if err != nil {
 		return nil, err
 	}
 
-	r, w := io.Pipe()
-	m := multipart.NewWriter(w)
-
-	go func() {
-		defer w.Close()
-		defer m.Close()
+	for _, val := range files {
+		delete(values, val.Name)
+	}
 
-		for _, val := range files {
-			delete(values, val.Name)
+	retryable := true
+	for _, file := range files {
+		if _, ok := file.Data.(FileReader); ok {
+			retryable = false
 		}
+	}
 
-		for field, value := range values {
-			if err := m.WriteField(field, value); err != nil {
-				w.CloseWithError(err)
-				return
-			}
-		}
+	if client.Debug {
+		slog.Debug("Method: %s, data: %v, with %d files\n", method, data, len(files))
+	}
 
-		for _, file := range files {
-			if file.Data.NeedsUpload() {
-				name, reader, err := file.Data.SendData()
-				if err != nil {
-					w.CloseWithError(err)
-					return
-				}
+	return client.doRequest(ctx, method, values["chat_id"], retryable, func() (io.Reader, string) {
+		r, w := io.Pipe()
+		m := multipart.NewWriter(w)
 
-				part, err := m.CreateFormFile(file.Name, name)
-				if err != nil {
-					w.CloseWithError(err)
-					return
-				}
+		go func() {
+			defer w.Close()
+			defer m.Close()
 
-				if _, err := io.Copy(part, reader); err != nil {
+			for field, value := range values {
+				if err := m.WriteField(field, value); err != nil {
 					w.CloseWithError(err)
 					return
 				}
+			}
 
-				if closer, ok := reader.(io.ReadCloser); ok {
-					if err = closer.Close(); err != nil {
+			for _, file := range files {
+				if file.Data.NeedsUpload() {
+					name, reader, err := file.Data.SendData()
+					if err != nil {
 						w.CloseWithError(err)
 						return
 					}
-				}
-			} else {
-				value, _, _ := file.Data.SendData()
 
-				if err := m.WriteField(file.Name, value); err != nil {
-					w.CloseWithError(err)
-					return
+					part, err := m.CreateFormFile(file.Name, name)
+					if err != nil {
+						w.CloseWithError(err)
+						return
+					}
+
+					if _, err := io.Copy(part, reader); err != nil {
+						w.CloseWithError(err)
+						return
+					}
+
+					if closer, ok := reader.(io.ReadCloser); ok {
+						if err = closer.Close(); err != nil {
+							w.CloseWithError(err)
+							return
+						}
+					}
+				} else {
+					value, _, _ := file.Data.SendData()
+
+					if err := m.WriteField(file.Name, value); err != nil {
+						w.CloseWithError(err)
+						return
+					}
 				}
 			}
+		}()
+
+		return r, m.FormDataContentType()
+	})
+}
+
+// doRequest sends the request built by newBody and retries transient failures.
+//
+// Every attempt is paced by the rate limiter. If retryable is true, 429 is retried after RetryAfter seconds
+// up to MaxRetries times. 5xx responses and network errors are retried after a jittered exponential backoff
+// only for idempotent methods: Telegram may have done the request before the failure, a repeated
+// sendMessage would deliver the message twice.
+func (client *Client) doRequest(ctx context.Context, method, chatID string, retryable bool, newBody func() (io.Reader, string)) (*APIResponse, error) {
+	for attempt := 0; ; attempt++ {
+		if err := client.pace(ctx, method, chatID); err != nil {
+			return nil, err
 		}
-	}()
 
-	if client.Debug {
-		slog.Debug("Method: %s, data: %v, with %d files\n", method, data, len(files))
+		apiResp, statusCode, err := client.roundTrip(ctx, method, newBody)
+		if err == nil || !retryable || attempt >= client.MaxRetries || ctx.Err() != nil {
+			return apiResp, err
+		}
+
+		delay, ok := retryDelay(attempt, statusCode, err)
+		if !ok || (!IsTooManyRequests(err) && !isIdempotentMethod(method)) {
+			return apiResp, err
+		}
+
+		if client.Debug {
+			slog.Debug("Method: %s, retrying in %v after: %v\n", method, delay, err)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return apiResp, err
+		case <-timer.C:
+		}
 	}
+}
 
+// roundTrip sends one request and decodes the response, statusCode is 0 if no response was received.
+func (client *Client) roundTrip(ctx context.Context, method string, newBody func() (io.Reader, string)) (*APIResponse, int, error) {
 	url := client.botEndpoint + "/" + strings.TrimPrefix(method, "/")
 
-	req, err := http.NewRequest("POST", url, r)
+	body, contentType := newBody()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, body)
 	if err != nil {
-		return nil, err
+		if closer, ok := body.(io.Closer); ok {
+			closer.Close()
+		}
+		return nil, 0, err
 	}
 
-	req.Header.Set("Content-Type", m.FormDataContentType())
+	req.Header.Set("Content-Type", contentType)
 
+	start := time.Now()
 	resp, err := client.Client.Do(req)
 	if err != nil {
-		return nil, err
+		if pipe, ok := body.(*io.PipeReader); ok {
+			pipe.CloseWithError(err)
+		}
+		client.observe(method, 0, start)
+		return nil, 0, err
 	}
 	defer resp.Body.Close()
+	client.observe(method, resp.StatusCode, start)
 
 	var apiResp APIResponse
 	bytes, err := client.decodeAPIResponse(resp.Body, &apiResp)
+	var unavailable *UnavailableError
+	if errors.As(err, &unavailable) {
+		unavailable.StatusCode, unavailable.ContentType = resp.StatusCode, resp.Header.Get("Content-Type")
+		if client.OnUnavailable != nil {
+			client.OnUnavailable(method, unavailable)
+		}
+	}
 	if err != nil {
-		return &apiResp, err
+		return &apiResp, resp.StatusCode, err
 	}
 
 	if client.Debug {
@@ -233,25 +372,79 @@ func (client *Client) MakeRequestWithFiles(method string, data interface{}, file
 			parameters = *apiResp.Parameters
 		}
 
-		return &apiResp, &Error{
+		return &apiResp, resp.StatusCode, &Error{
 			Code:               apiResp.ErrorCode,
 			Message:            apiResp.Description,
 			ResponseParameters: parameters,
 		}
 	}
 
-	return &apiResp, nil
+	return &apiResp, resp.StatusCode, nil
 }
 
-// decodeAPIResponse decode response and return slice of bytes if debug enabled.
-// If debug disabled, just decode http.Response.Body stream to APIResponse struct
-// for efficient memory usage
+// retryDelay returns how long to wait before the next attempt, false if the error is not transient.
+//
+// Other 4xx errors are never retried.
+func retryDelay(attempt, statusCode int, err error) (time.Duration, bool) {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		switch {
+		case apiErr.IsTooManyRequests():
+			return time.Duration(apiErr.RetryAfter) * time.Second, true
+		case apiErr.Code >= http.StatusInternalServerError:
+			return backoff(attempt), true
+		}
+		return 0, false
+	}
+
+	var unavailable *UnavailableError
+	if statusCode >= http.StatusInternalServerError || errors.As(err, &unavailable) {
+		return backoff(attempt), true
+	}
+
+	var netErr net.Error
+	if statusCode == 0 && errors.As(err, &netErr) {
+		return backoff(attempt), true
+	}
+
+	return 0, false
+}
+
+// isIdempotentMethod reports whether repeating the method can't duplicate its effect.
+//
+// Messages, copies and forwards would be delivered twice, created links, topics and sticker sets created twice.
+func isIdempotentMethod(method string) bool {
+	method = strings.TrimPrefix(method, "/")
+	if method == "sendChatAction" {
+		return true
+	}
+	return !isSendMethod(method) && !strings.HasPrefix(method, "create") && !strings.HasPrefix(method, "add") && method != "uploadStickerFile"
+}
+
+// backoff returns a random delay between half and the whole of retryBaseDelay doubled attempt times, at most retryMaxDelay.
+func backoff(attempt int) time.Duration {
+	delay := retryMaxDelay
+	if attempt < 16 && retryBaseDelay<<attempt < retryMaxDelay {
+		delay = retryBaseDelay << attempt
+	}
+
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// decodeAPIResponse reads the body and decodes it to APIResponse, the read bytes are returned for logging.
+//
+// A body that is not a JSON object (an HTML error page of a proxy or of Telegram maintenance)
+// returns UnavailableError instead of a JSON syntax error.
 func (client *Client) decodeAPIResponse(responseBody io.Reader, resp *APIResponse) ([]byte, error) {
 	data, err := io.ReadAll(responseBody)
 	if err != nil {
 		return nil, err
 	}
 
+	if trimmed := bytes.TrimSpace(data); len(trimmed) == 0 || trimmed[0] != '{' {
+		return data, &UnavailableError{}
+	}
+
 	err = json.Unmarshal(data, resp)
 	if err != nil {
 		return nil, err
@@ -260,55 +453,112 @@ func (client *Client) decodeAPIResponse(responseBody io.Reader, resp *APIRespons
 	return data, nil
 }
 
+// structToMap converts a config to form fields.
+//
+// Pointers are dereferenced, embedded structs (like BaseSend) are flattened
+// and empty fields tagged with omitempty are skipped.
 func structToMap(data interface{}) (map[string]string, error) {
 	result := make(map[string]string)
 
-	val := reflect.ValueOf(data)
+	val := reflect.Indirect(reflect.ValueOf(data))
 	if val.Kind() != reflect.Struct {
 		return nil, fmt.Errorf("expected a struct")
 	}
 
+	err := fillMap(val, result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// fillMap writes the fields of the struct as multipart form values.
+//
+// Structs, slices and maps (reply_markup, media, entities, caption_entities)
+// are JSON-serialized, files are skipped as they are written separately.
+func fillMap(val reflect.Value, result map[string]string) error {
 	requestFileDataType := reflect.TypeOf((*RequestFileData)(nil)).Elem()
+	stringerType := reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
 
 	typ := val.Type()
 	for i := 0; i < val.NumField(); i++ {
 		field := typ.Field(i)
 		value := val.Field(i)
 
+		if field.Anonymous && value.Kind() == reflect.Struct {
+			if err := fillMap(value, result); err != nil {
+				return err
+			}
+			continue
+		}
+
 		jsonTag := field.Tag.Get("json")
-		if jsonTag != "" && jsonTag != "-" {
-			jsonTag = strings.Split(jsonTag, ",")[0]
-			if value.Kind() == reflect.Struct {
-				if reflect.TypeOf(value).Implements(requestFileDataType) {
-					continue
-				}
-				nestedData, err := json.Marshal(value.Interface())
-				if err != nil {
-					return nil, err
-				}
-				result[jsonTag] = string(nestedData)
-			} else {
-				result[jsonTag] = fmt.Sprintf("%v", value.Interface())
+		if jsonTag == "" || jsonTag == "-" {
+			continue
+		}
+		tagParts := strings.Split(jsonTag, ",")
+		jsonTag = tagParts[0]
+		if value.IsZero() && len(tagParts) > 1 && tagParts[1] == "omitempty" {
+			continue
+		}
+
+		if value.Kind() == reflect.Interface {
+			if value.IsNil() {
+				continue
 			}
+			value = value.Elem()
+		}
+		if value.Kind() == reflect.Pointer && value.IsNil() {
+			continue
+		}
+		if value.Type().Implements(requestFileDataType) {
+			continue
+		}
+		if value.Kind() == reflect.Pointer && !value.IsNil() && value.Type().Implements(stringerType) {
+			result[jsonTag] = value.Interface().(fmt.Stringer).String()
+			continue
+		}
+
+		switch reflect.Indirect(value).Kind() {
+		case reflect.Struct, reflect.Slice, reflect.Array, reflect.Map:
+			nestedData, err := json.Marshal(value.Interface())
+			if err != nil {
+				return err
+			}
+			result[jsonTag] = string(nestedData)
+		default:
+			result[jsonTag] = fmt.Sprintf("%v", reflect.Indirect(value).Interface())
 		}
 	}
 
-	return result, nil
+	return nil
 }
 
 // Request sends a Config to Telegram, and returns the APIResponse.
 func (client *Client) Request(c Config) (*APIResponse, error) {
+	return client.RequestWithContext(context.Background(), c)
+}
+
+// RequestWithContext is Request which cancels the HTTP request when ctx is done.
+func (client *Client) RequestWithContext(ctx context.Context, c Config) (*APIResponse, error) {
+	if v, ok := c.(ConfigWithValidation); ok {
+		if err := v.validate(); err != nil {
+			return nil, err
+		}
+	}
+
 	if t, ok := c.(ConfigWithFiles); ok {
 		files := t.files()
 
 		// If we have files that need to be uploaded, we should delegate the
 		// request to UploadFile.
 		if hasFilesNeedingUpload(files) {
-			return client.MakeRequestWithFiles(t.method(), c, files)
+			return client.MakeRequestWithFilesContext(ctx, t.method(), c, files)
 		}
 	}
 
-	return client.MakeRequest(c.method(), c)
+	return client.MakeRequestWithContext(ctx, c.method(), c)
 }
 
 func hasFilesNeedingUpload(files []RequestFile) bool {
@@ -377,7 +627,23 @@ func EscapeText(parseMode string, text string) string {
 // Set Timeout to a large number to reduce requests, so you can get updates
 // instantly instead of having to wait between requests.
 func (client *Client) GetUpdates(config GetUpdatesConf) ([]Update, error) {
-	resp, err := client.Request(config)
+	return client.GetUpdatesWithContext(context.Background(), config)
+}
+
+// GetUpdatesWithContext is GetUpdates which cancels the long poll when ctx is done.
+//
+// The request deadline is config.Timeout plus UpdatesTimeoutMargin, so a hung connection
+// returns an error instead of blocking forever. If the HTTP client has a timeout,
+// config.Timeout is capped to end UpdatesTimeoutMargin before it.
+func (client *Client) GetUpdatesWithContext(ctx context.Context, config GetUpdatesConf) ([]Update, error) {
+	if config.AllowedUpdates == nil {
+		config.AllowedUpdates = client.AllowedUpdates
+	}
+	config.Timeout = client.pollTimeout(config.Timeout)
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(config.Timeout)*time.Second+UpdatesTimeoutMargin)
+	defer cancel()
+
+	resp, err := client.RequestWithContext(ctx, config)
 	if err != nil {
 		return nil, err
 	}
@@ -391,10 +657,26 @@ func (client *Client) GetUpdates(config GetUpdatesConf) ([]Update, error) {
 	return updates, nil
 }
 
+// pollTimeout returns the long poll timeout in seconds the HTTP client doesn't cut off.
+func (client *Client) pollTimeout(timeout int) int {
+	httpClient, ok := client.Client.(*http.Client)
+	if !ok || httpClient.Timeout <= 0 {
+		return timeout
+	}
+	max := int((httpClient.Timeout - UpdatesTimeoutMargin) / time.Second)
+	if max < 0 {
+		max = 0
+	}
+	if timeout > max {
+		return max
+	}
+	return timeout
+}
+
 // GetWebhookInfo allows you to fetch information about a webhook and if
 // one currently is set, along with pending update count and error messages.
 func (client *Client) GetWebhookInfo() (*WebhookInfo, error) {
-	resp, err := client.MakeRequest("getWebhookInfo", nil)
+	resp, err := client.Request(GetWebhookInfoConf{})
 	if err != nil {
 		return nil, err
 	}
@@ -445,6 +727,36 @@ func (client *Client) GetUpdatesChan(config GetUpdatesConf) UpdatesChannel {
 	return ch
 }
 
+// TypingInterval is how often StartTyping resends the typing action.
+// Telegram shows a chat action for 5 seconds. Tests shorten it.
+var TypingInterval = 4 * time.Second
+
+// StartTyping shows "typing…" in the chat until stop is called.
+//
+// The action is sent at once and then every TypingInterval, errors are ignored.
+// stop may be called more than once.
+func (client *Client) StartTyping(chatID int) (stop func()) {
+	done := make(chan struct{})
+	var once sync.Once
+
+	go func() {
+		ticker := time.NewTicker(TypingInterval)
+		defer ticker.Stop()
+		for {
+			client.Request(NewChatAction(chatID, ChatTyping))
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
+
 // StopReceivingUpdates stops the go routine which receives updates
 func (client *Client) StopReceivingUpdates() {
 	if client.Debug {
@@ -473,6 +785,72 @@ func (client *Client) ListenForWebhook(pattern string) UpdatesChannel {
 	return ch
 }
 
+// SetWebhook sets the webhook and uploads config.Certificate if it is set.
+func (client *Client) SetWebhook(config SetWebhookConf) (bool, error) {
+	if config.AllowedUpdates == nil {
+		config.AllowedUpdates = client.AllowedUpdates
+	}
+	return client.RequestOK(&config)
+}
+
+// ListenForWebhookTLS starts an HTTPS server for the webhook on addr
+// and sets the webhook to config.URL with the server certificate.
+//
+// If certFile and keyFile do not exist, a self-signed pair is generated for config.URL host.
+// Stop the returned server with Shutdown.
+func (client *Client) ListenForWebhookTLS(addr string, config SetWebhookConf, certFile, keyFile string) (UpdatesChannel, *http.Server, error) {
+	if config.URL == nil {
+		return nil, nil, fmt.Errorf("webhook URL is empty")
+	}
+
+	if _, err := os.Stat(certFile); errors.Is(err, os.ErrNotExist) {
+		certPEM, keyPEM, err := NewSelfSignedCert(config.URL.Hostname())
+		if err != nil {
+			return nil, nil, err
+		}
+		if err = os.WriteFile(certFile, certPEM, 0644); err != nil {
+			return nil, nil, err
+		}
+		if err = os.WriteFile(keyFile, keyPEM, 0600); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if _, err := tls.LoadX509KeyPair(certFile, keyFile); err != nil {
+		return nil, nil, err
+	}
+
+	ch := make(chan Update, client.Buffer)
+	mux := http.NewServeMux()
+	mux.HandleFunc(config.URL.Path, func(w http.ResponseWriter, r *http.Request) {
+		update, err := client.HandleUpdate(r)
+		if err != nil {
+			errMsg, _ := json.Marshal(map[string]string{"error": err.Error()})
+			w.WriteHeader(http.StatusBadRequest)
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write(errMsg)
+			return
+		}
+
+		ch <- *update
+	})
+
+	server := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		if err := server.ListenAndServeTLS(certFile, keyFile); err != nil && err != http.ErrServerClosed {
+			slog.Error("Webhook server", "error", err)
+		}
+	}()
+
+	config.Certificate = FilePath(certFile)
+	if _, err := client.SetWebhook(config); err != nil {
+		server.Close()
+		return nil, nil, err
+	}
+
+	return ch, server, nil
+}
+
 // ListenForWebhookRespReqFormat registers a http handler for a single incoming webhook.
 func (client *Client) ListenForWebhookRespReqFormat(w http.ResponseWriter, r *http.Request) UpdatesChannel {
 	ch := make(chan Update, client.Buffer)
@@ -525,7 +903,7 @@ func (client *Client) HandleUpdate(r *http.Request) (*Update, error) {
 // and so you may get this data from BotAPI.Self without the need for
 // another request.
 func (client *Client) GetMe() (*User, error) {
-	resp, err := client.MakeRequest("getMe", nil)
+	resp, err := client.Request(GetMeConf{})
 	if err != nil {
 		return nil, err
 	}
@@ -546,12 +924,7 @@ func (client *Client) GetMe() (*User, error) {
 // but will not be able to log in back to the cloud Bot API server for 10 minutes.
 // Returns True on success. Requires no parameters.
 func (client *Client) LogOut() (bool, error) {
-	_, err := client.MakeRequest("logOut", nil)
-	if err != nil {
-		return false, err
-	}
-
-	return true, nil
+	return client.RequestOK(LogOutConf{})
 }
 
 // Use this method to close the bot instance before moving it from one local server to another.
@@ -559,12 +932,7 @@ func (client *Client) LogOut() (bool, error) {
 // the bot isn't launched again after server restart. The method will return error 429 in the first 10 minutes
 // after the bot is launched. Returns True on success. Requires no parameters.
 func (client *Client) Close() (bool, error) {
-	_, err := client.MakeRequest("close", nil)
-	if err != nil {
-		return false, err
-	}
-
-	return true, nil
+	return client.RequestOK(CloseConf{})
 }
 
 // IsMessageToMe returns true if message directed to this bot.
@@ -578,7 +946,12 @@ func (client *Client) IsMessageToMe(message Message) bool {
 //
 // Use for all methods that return only Message on success.
 func (client *Client) Send(c Config) (*Message, error) {
-	resp, err := client.Request(c)
+	return client.SendWithContext(context.Background(), c)
+}
+
+// SendWithContext is Send which cancels the HTTP request when ctx is done.
+func (client *Client) SendWithContext(ctx context.Context, c Config) (*Message, error) {
+	resp, err := client.RequestWithContext(ctx, c)
 	if err != nil {
 		return nil, err
 	}
@@ -663,6 +1036,54 @@ func (client *Client) GetFile(c GetFileConf) (*File, error) {
 	return &file, nil
 }
 
+// GetFileDirectURL returns the download URL of the file with fileID.
+//
+// It calls GetFile, so the URL is valid for at least one hour.
+func (client *Client) GetFileDirectURL(fileID string) (string, error) {
+	file, err := client.GetFile(GetFileConf{FileID: fileID})
+	if err != nil {
+		return "", err
+	}
+
+	return file.Link(*client), nil
+}
+
+// DownloadFile returns the contents of a File received from GetFile.
+//
+// The request is made with the Client HTTP client.
+// In local mode files with an absolute path are read from disk.
+func (client *Client) DownloadFile(file *File) ([]byte, error) {
+	return client.DownloadFileWithContext(context.Background(), file)
+}
+
+// DownloadFileWithContext is DownloadFile which cancels the HTTP request when ctx is done.
+func (client *Client) DownloadFileWithContext(ctx context.Context, file *File) ([]byte, error) {
+	if file.FilePath == "" {
+		return nil, errors.New("file path is empty, use GetFile first")
+	}
+
+	if file.IsLocal(*client) {
+		return os.ReadFile(file.FilePath)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", file.Link(*client), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download file: %s", resp.Status)
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
 // ExportChatInviteLink returns the generated a new primary invite link for a chat.
 //
 // Requires ChatID.
@@ -731,8 +1152,8 @@ func (client *Client) GetChat(c GetChatConf) (*Chat, error) {
 //
 // If none have been appointed, only the creator will be returned.
 // Bots are not shown, even if they are an administrator.
-func (client *Client) GetChatAdministrators(c GetChatAdministratorsConf) ([]ChatMember, error) {
-	resp, err := client.Request(c)
+func (client *Client) GetChatAdministrators(chatID int) ([]ChatMember, error) {
+	resp, err := client.Request(GetChatAdministratorsConf{ChatID: chatID})
 	if err != nil {
 		return nil, err
 	}
@@ -869,20 +1290,16 @@ func (client *Client) GetMyShortDescription(c GetMyShortDescriptionConf) (*BotSh
 	return &description, nil
 }
 
-// GetChatMenuButton gets the current value of the bot's menu button in a private chat, or the default menu button.
-func (client *Client) GetChatMenuButton(c GetChatMenuButtonConf) (*MenuButton, error) {
-	resp, err := client.Request(c)
-	if err != nil {
-		return nil, err
-	}
-
+// GetChatMenuButton gets the current value of the bot's menu button in a private chat, 0 gets the default menu button.
+func (client *Client) GetChatMenuButton(chatID int) (MenuButton, error) {
 	var button MenuButton
-	err = json.Unmarshal(resp.Result, &button)
+	resp, err := client.Request(GetChatMenuButtonConf{ChatID: chatID})
 	if err != nil {
-		return nil, err
+		return button, err
 	}
 
-	return &button, nil
+	err = json.Unmarshal(resp.Result, &button)
+	return button, err
 }
 
 // GetMyDefaultAdministratorRights gets the current default administrator rights of the bot.
@@ -914,6 +1331,9 @@ func (client *Client) GetMyDefaultAdministratorRights(c GetMyDefaultAdministrato
 // Use for all EditMessage methods.
 func (client *Client) EditMessage(c Config) (*Message, bool, error) {
 	resp, err := client.Request(c)
+	if resp == nil {
+		return nil, false, err
+	}
 	if err != nil {
 		return nil, resp.Ok, err
 	}
@@ -1057,6 +1477,9 @@ func (client *Client) CreateInvoiceLink(c CreateInvoiceLinkConf) (string, error)
 // than the user's current score in the chat and force is False.
 func (client *Client) SetGameScore(c SetGameScoreConf) (*Message, bool, error) {
 	resp, err := client.Request(c)
+	if resp == nil {
+		return nil, false, err
+	}
 	if err != nil {
 		return nil, resp.Ok, err
 	}
@@ -0,0 +1,250 @@
+package telegram
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEditMessageValidationErrorDoesNotPanic(t *testing.T) {
+	client := newMockServer(t).client(t)
+	message, ok, err := client.EditMessage(NewEditMessageText(1, 2, ""))
+	if err == nil || message != nil || ok {
+		t.Fatalf("EditMessage = %v, %t, %v, want a validation error", message, ok, err)
+	}
+	_, ok, err = client.EditMessage(NewEditMessageText(1, 2, strings.Repeat("a", MaxMessageLength+1)))
+	if err == nil || ok {
+		t.Fatalf("EditMessage of a long text = %t, %v, want an error", ok, err)
+	}
+}
+
+func TestSetGameScoreRequestErrorDoesNotPanic(t *testing.T) {
+	m := newMockServer(t)
+	client := m.client(t)
+	client.MaxRetries = 0
+	m.Close()
+	_, ok, err := client.SetGameScore(SetGameScoreConf{UserID: 1, Score: 10, ChatID: 1, MessageID: 2})
+	if err == nil || ok {
+		t.Fatalf("SetGameScore = %t, %v, want an error", ok, err)
+	}
+}
+
+func TestGetWebhookInfoDecodesErrors(t *testing.T) {
+	m := newMockServer(t)
+	m.respond("getWebhookInfo", `{"ok":true,"result":{"url":"https://example.com/hook","has_custom_certificate":true,"pending_update_count":4,`+
+		`"ip_address":"1.2.3.4","last_error_date":1700000000,"last_error_message":"Wrong response from the webhook: 502 Bad Gateway",`+
+		`"last_synchronization_error_date":1700000100,"max_connections":40,"allowed_updates":["message","callback_query"]}}`)
+	info, err := m.client(t).GetWebhookInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.IsSet() || !info.HasCustomCertificate || info.PendingUpdateCount != 4 || info.IPAddress != "1.2.3.4" || info.MaxConnections != 40 {
+		t.Fatalf("info = %+v", info)
+	}
+	if info.LastErrorDate != 1700000000 || info.LastErrorMessage != "Wrong response from the webhook: 502 Bad Gateway" || info.LastSynchronizationErrorDate != 1700000100 {
+		t.Fatalf("error fields = %+v", info)
+	}
+	if len(info.AllowedUpdates) != 2 || info.AllowedUpdates[1] != "callback_query" {
+		t.Fatalf("allowed updates = %v", info.AllowedUpdates)
+	}
+	if len(m.calls("getWebhookInfo")) != 1 {
+		t.Fatal("getWebhookInfo is not called")
+	}
+}
+
+func TestLogOutAndClose(t *testing.T) {
+	m := newMockServer(t)
+	client := m.client(t)
+	if ok, err := client.LogOut(); err != nil || !ok {
+		t.Fatalf("LogOut = %t, %v", ok, err)
+	}
+	if ok, err := client.Close(); err != nil || !ok {
+		t.Fatalf("Close = %t, %v", ok, err)
+	}
+	if len(m.calls("logOut")) != 1 || len(m.calls("close")) != 1 {
+		t.Fatalf("requests = %+v", m.requests)
+	}
+
+	client.MaxRetries = 0
+	m.respond("close", `429 {"ok":false,"error_code":429,"description":"Too Many Requests: retry after 600","parameters":{"retry_after":600}}`)
+	m.respond("logOut", `{"ok":false,"error_code":400,"description":"Bad Request: logged out"}`)
+	if ok, err := client.Close(); err == nil || ok || !IsTooManyRequests(err) {
+		t.Fatalf("Close = %t, %v, want the 429 error", ok, err)
+	}
+	if ok, err := client.LogOut(); err == nil || ok {
+		t.Fatalf("LogOut = %t, %v, want the error", ok, err)
+	}
+}
+
+func TestGetMeSetsSelf(t *testing.T) {
+	m := newMockServer(t)
+	client := m.client(t)
+	if client.Self.ID != 1 || client.Self.UserName != "test_bot" || !client.Self.IsBot {
+		t.Fatalf("Self = %+v", client.Self)
+	}
+	m.respond("getMe", `{"ok":true,"result":{"id":2,"is_bot":true,"first_name":"Renamed","username":"renamed_bot","can_join_groups":true}}`)
+	me, err := client.GetMe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if me.ID != 2 || me.FirstName != "Renamed" || me.UserName != "renamed_bot" || !me.CanJoinGroups {
+		t.Fatalf("GetMe = %+v", me)
+	}
+}
+
+func TestGetMeError(t *testing.T) {
+	m := newMockServer(t)
+	client := m.client(t)
+	m.respond("getMe", `{"ok":false,"error_code":401,"description":"Unauthorized"}`)
+	if me, err := client.GetMe(); err == nil || me != nil {
+		t.Fatalf("GetMe = %+v, %v", me, err)
+	}
+}
+
+func TestOnResponseReportsMethodAndStatus(t *testing.T) {
+	m := newMockServer(t)
+	client := m.client(t)
+	client.MaxRetries = 0
+	type response struct {
+		method string
+		code   int
+	}
+	var responses []response
+	client.OnResponse = func(method string, statusCode int, elapsed time.Duration) {
+		responses = append(responses, response{method, statusCode})
+	}
+	m.respond("sendMessage", mockMessage, `400 {"ok":false,"error_code":400,"description":"Bad Request: chat not found"}`)
+	m.respond("sendDocument", mockMessage)
+	if _, err := client.Send(NewMessage(1, "hello")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Send(NewMessage(1, "hello")); err == nil {
+		t.Fatal("the second message is sent, want the error")
+	}
+	if _, err := client.Send(NewDocument(1, FileBytes{Name: "report.csv", Bytes: []byte("id\n")})); err != nil {
+		t.Fatal(err)
+	}
+	m.Close()
+	if _, err := client.Send(NewMessage(1, "hello")); err == nil {
+		t.Fatal("the message is sent to the closed server, want the error")
+	}
+	want := []response{{"sendMessage", 200}, {"sendMessage", 400}, {"sendDocument", 200}, {"sendMessage", 0}}
+	if len(responses) != len(want) {
+		t.Fatalf("responses = %v, want %v", responses, want)
+	}
+	for i := range want {
+		if responses[i] != want[i] {
+			t.Fatalf("responses = %v, want %v", responses, want)
+		}
+	}
+}
+
+func TestRawCallsTheMethod(t *testing.T) {
+	m := newMockServer(t)
+	client := m.client(t)
+	resp, err := client.Raw("getMe", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var me User
+	if err := json.Unmarshal(resp.Result, &me); err != nil || !me.IsBot || me.UserName != "test_bot" {
+		t.Fatalf("getMe = %+v, %v", me, err)
+	}
+	if calls := m.calls("getMe"); len(calls) < 2 || string(calls[len(calls)-1].Body) != "{}" {
+		t.Fatalf("getMe requests = %+v", calls)
+	}
+
+	m.respond("getBusinessConnection", `{"ok":true,"result":{"id":"b1","user_chat_id":5}}`)
+	markup := NewInlineKeyboardMarkup(NewInlineKeyboardRow(NewInlineKeyboardButtonData("ok", "ok")))
+	resp, err = client.Raw("getBusinessConnection", map[string]interface{}{"business_connection_id": "b1", "reply_markup": markup})
+	if err != nil || !strings.Contains(string(resp.Result), `"user_chat_id":5`) {
+		t.Fatalf("getBusinessConnection = %v, %v", resp, err)
+	}
+	var body struct {
+		ID     string               `json:"business_connection_id"`
+		Markup InlineKeyboardMarkup `json:"reply_markup"`
+	}
+	if err := json.Unmarshal(m.calls("getBusinessConnection")[0].Body, &body); err != nil || body.ID != "b1" || len(body.Markup.InlineKeyboard) != 1 {
+		t.Fatalf("body = %s, %v", m.calls("getBusinessConnection")[0].Body, err)
+	}
+
+	client.MaxRetries = 0
+	m.respond("sendPaidMedia", `{"ok":false,"error_code":400,"description":"Bad Request: chat not found"}`)
+	if _, err := client.Raw("sendPaidMedia", map[string]interface{}{"chat_id": 1}); !IsChatNotFound(err) {
+		t.Fatalf("err = %v, want the API error", err)
+	}
+}
+
+func TestClientAllowedUpdates(t *testing.T) {
+	m := newMockServer(t)
+	client := m.client(t)
+	m.respond("getUpdates", `{"ok":true,"result":[]}`)
+	link, _ := url.Parse("https://example.com/hook")
+
+	if _, err := client.GetUpdates(NewUpdate(0)); err != nil {
+		t.Fatal(err)
+	}
+	client.AllowedUpdates = []string{UpdateTypeMessage, UpdateTypeCallbackQuery}
+	if _, err := client.GetUpdates(NewUpdate(0)); err != nil {
+		t.Fatal(err)
+	}
+	explicit := NewUpdate(0)
+	explicit.AllowedUpdates = []string{UpdateTypeEditedMessage}
+	if _, err := client.GetUpdates(explicit); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.SetWebhook(SetWebhookConf{URL: link}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.SetWebhook(SetWebhookConf{URL: link, AllowedUpdates: []string{UpdateTypeMessage}}); err != nil {
+		t.Fatal(err)
+	}
+
+	polls, hooks := m.calls("getUpdates"), m.calls("setWebhook")
+	tests := []struct {
+		body []byte
+		want string
+	}{
+		{polls[0].Body, ""},
+		{polls[1].Body, `"allowed_updates":["message","callback_query"]`},
+		{polls[2].Body, `"allowed_updates":["edited_message"]`},
+		{hooks[0].Body, `"allowed_updates":["message","callback_query"]`},
+		{hooks[1].Body, `"allowed_updates":["message"]}`},
+	}
+	for i, tt := range tests {
+		body := string(tt.body)
+		if tt.want == "" && strings.Contains(body, "allowed_updates") || !strings.Contains(body, tt.want) {
+			t.Errorf("request %d = %s, want %s", i, body, tt.want)
+		}
+	}
+}
+
+func TestUpdateType(t *testing.T) {
+	message := &Message{MessageID: 1}
+	tests := []struct {
+		update  Update
+		typ     string
+		message *Message
+	}{
+		{Update{Message: message}, UpdateTypeMessage, message},
+		{Update{EditedMessage: message}, UpdateTypeEditedMessage, message},
+		{Update{ChannelPost: message}, UpdateTypeChannelPost, message},
+		{Update{EditedChannelPost: message}, UpdateTypeEditedChannelPost, message},
+		{Update{CallbackQuery: &CallbackQuery{}}, UpdateTypeCallbackQuery, nil},
+		{Update{PreCheckoutQuery: &PreCheckoutQuery{}}, UpdateTypePreCheckoutQuery, nil},
+		{Update{PollAnswer: &PollAnswer{}}, UpdateTypePollAnswer, nil},
+		{Update{MyChatMember: &ChatMemberUpdated{}}, UpdateTypeMyChatMember, nil},
+		{Update{ChatJoinRequest: &ChatJoinRequest{}}, UpdateTypeChatJoinRequest, nil},
+		{Update{UpdateID: 1}, "", nil},
+	}
+	for _, tt := range tests {
+		if got := tt.update.Type(); got != tt.typ {
+			t.Errorf("Type = %q, want %q", got, tt.typ)
+		}
+		if got := tt.update.EffectiveMessage(); got != tt.message {
+			t.Errorf("%s: EffectiveMessage = %v", tt.typ, got)
+		}
+	}
+}
@@ -2,10 +2,13 @@ package telegram
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/url"
 	"os"
+	"strings"
+	"time"
 )
 
 // Telegram constants
@@ -29,6 +32,15 @@ const (
 	ChatUploadVideoNote = "upload_video_note"
 )
 
+// Message limits. Text limits are in UTF-16 code units (see UTF16Len),
+// callback data limit is in bytes.
+const (
+	MaxMessageLength      = 4096
+	MaxCaptionLength      = 1024
+	MaxCallbackDataLength = 64
+	MaxInlineQueryResults = 50
+)
+
 // Constant values for ParseMode in MessageConfig
 const (
 	ModeMarkdown   = "Markdown"
@@ -47,6 +59,12 @@ type ConfigWithFiles interface {
 	files() []RequestFile
 }
 
+// ConfigWithValidation is any config type that is checked before it is sent.
+type ConfigWithValidation interface {
+	Config
+	validate() error
+}
+
 // RequestFile represents a file associated with a field name.
 type RequestFile struct {
 	// The file field name.
@@ -178,6 +196,32 @@ func (c SetWebhookConf) method() string {
 	return "setWebhook"
 }
 
+func (config *SetWebhookConf) files() []RequestFile {
+	if config.Certificate == nil {
+		return nil
+	}
+
+	return []RequestFile{{
+		Name: "certificate",
+		Data: config.Certificate,
+	}}
+}
+
+// MarshalJSON encodes URL as a string.
+func (c SetWebhookConf) MarshalJSON() ([]byte, error) {
+	type conf SetWebhookConf
+
+	var link string
+	if c.URL != nil {
+		link = c.URL.String()
+	}
+
+	return json.Marshal(struct {
+		URL string `json:"url"`
+		conf
+	}{link, conf(c)})
+}
+
 // DeleteWebhookConf contains fields for the deleteWebhook method. Returns True on success.
 type DeleteWebhookConf struct {
 	DropPendingUpdates bool `json:"drop_pending_updates,omitempty"` // Optional. Pass True to drop all pending updates.
@@ -187,6 +231,13 @@ func (c DeleteWebhookConf) method() string {
 	return "deleteWebhook"
 }
 
+// GetWebhookInfoConf contains fields for the getWebhookInfo method. On success, returns a WebhookInfo object.
+type GetWebhookInfoConf struct{}
+
+func (c GetWebhookInfoConf) method() string {
+	return "getWebhookInfo"
+}
+
 //
 //
 //
@@ -195,6 +246,27 @@ func (c DeleteWebhookConf) method() string {
 //
 //
 
+// GetMeConf contains fields for the getMe method. Returns basic information about the bot in form of a User object.
+type GetMeConf struct{}
+
+func (c GetMeConf) method() string {
+	return "getMe"
+}
+
+// LogOutConf contains fields for the logOut method. Returns True on success.
+type LogOutConf struct{}
+
+func (c LogOutConf) method() string {
+	return "logOut"
+}
+
+// CloseConf contains fields for the close method. Returns True on success.
+type CloseConf struct{}
+
+func (c CloseConf) method() string {
+	return "close"
+}
+
 // ForwardMessageConf contains fields for the forwardMessage method. On success, the sent Message is returned.
 type ForwardMessageConf struct {
 	ChatID              interface{} `json:"chat_id"`                        // Unique identifier for the target chat or username of the target channel
@@ -209,6 +281,12 @@ func (c ForwardMessageConf) method() string {
 	return "forwardMessage"
 }
 
+// WithThread returns the config sent to the forum topic.
+func (c ForwardMessageConf) WithThread(threadID int) ForwardMessageConf {
+	c.MessageThreadID = threadID
+	return c
+}
+
 type BaseSend struct {
 	ChatID                   interface{} `json:"chat_id"`                               // Unique identifier for the target chat or username of the target channel
 	MessageThreadID          int         `json:"message_thread_id,omitempty"`           // Optional. Unique identifier for the target message thread (topic) of the forum; for forum supergroups only
@@ -219,19 +297,44 @@ type BaseSend struct {
 	ReplyMarkup              interface{} `json:"reply_markup,omitempty"`                // Optional. Additional interface options
 }
 
+func (c BaseSend) validate() error {
+	return validateReplyMarkup(c.ReplyMarkup)
+}
+
 // SendMessageConf contains fields for the sendMessage method. On success, the sent Message is returned.
 type SendMessageConf struct {
-	BaseSend                              // Unique identifier for the target chat or username of the target channel
-	Text                  string          `json:"text"`                               // Text of the message to be sent
-	ParseMode             string          `json:"parse_mode,omitempty"`               // Optional. Mode for parsing entities in the message text
-	Entities              []MessageEntity `json:"entities,omitempty"`                 // Optional. Special entities that appear in the message text
-	DisableWebPagePreview bool            `json:"disable_web_page_preview,omitempty"` // Optional. Disables link previews for links in the message
+	BaseSend                                  // Unique identifier for the target chat or username of the target channel
+	Text                  string              `json:"text"`                               // Text of the message to be sent
+	ParseMode             string              `json:"parse_mode,omitempty"`               // Optional. Mode for parsing entities in the message text
+	Entities              []MessageEntity     `json:"entities,omitempty"`                 // Optional. Special entities that appear in the message text
+	DisableWebPagePreview bool                `json:"disable_web_page_preview,omitempty"` // Deprecated: use LinkPreviewOptions. Disables link previews for links in the message
+	LinkPreviewOptions    *LinkPreviewOptions `json:"link_preview_options,omitempty"`     // Optional. Link preview generation options for the message
 }
 
 func (c SendMessageConf) method() string {
 	return "sendMessage"
 }
 
+// DisableLinkPreview returns the config sent without link previews.
+func (c SendMessageConf) DisableLinkPreview() SendMessageConf {
+	c.LinkPreviewOptions = &LinkPreviewOptions{IsDisabled: true}
+	return c
+}
+
+// WithThread returns the config sent to the forum topic.
+func (c SendMessageConf) WithThread(threadID int) SendMessageConf {
+	c.MessageThreadID = threadID
+	return c
+}
+
+func (c SendMessageConf) validate() error {
+	if err := validateText(c.Text, c.ParseMode); err != nil {
+		return err
+	}
+
+	return c.BaseSend.validate()
+}
+
 // CopyMessageConf contains fields for the copyMessage method. Returns the MessageId of the sent message on success.
 type CopyMessageConf struct {
 	BaseSend                        // Unique identifier for the target chat or username of the target channel
@@ -246,6 +349,20 @@ func (c CopyMessageConf) method() string {
 	return "copyMessage"
 }
 
+// WithThread returns the config sent to the forum topic.
+func (c CopyMessageConf) WithThread(threadID int) CopyMessageConf {
+	c.MessageThreadID = threadID
+	return c
+}
+
+func (c CopyMessageConf) validate() error {
+	if err := validateCaption(c.Caption, c.ParseMode); err != nil {
+		return err
+	}
+
+	return c.BaseSend.validate()
+}
+
 // SendPhotoConf contains fields for the sendPhoto method. On success, the sent Message is returned.
 type SendPhotoConf struct {
 	BaseSend                        // Unique identifier for the target chat or username of the target channel
@@ -260,6 +377,20 @@ func (c SendPhotoConf) method() string {
 	return "sendPhoto"
 }
 
+// WithThread returns the config sent to the forum topic.
+func (c SendPhotoConf) WithThread(threadID int) SendPhotoConf {
+	c.MessageThreadID = threadID
+	return c
+}
+
+func (c SendPhotoConf) validate() error {
+	if err := validateCaption(c.Caption, c.ParseMode); err != nil {
+		return err
+	}
+
+	return c.BaseSend.validate()
+}
+
 func (config *SendPhotoConf) files() []RequestFile {
 	files := []RequestFile{{
 		Name: "photo",
@@ -286,6 +417,20 @@ func (c SendAudioConf) method() string {
 	return "sendAudio"
 }
 
+// WithThread returns the config sent to the forum topic.
+func (c SendAudioConf) WithThread(threadID int) SendAudioConf {
+	c.MessageThreadID = threadID
+	return c
+}
+
+func (c SendAudioConf) validate() error {
+	if err := validateCaption(c.Caption, c.ParseMode); err != nil {
+		return err
+	}
+
+	return c.BaseSend.validate()
+}
+
 func (config *SendAudioConf) files() []RequestFile {
 	files := []RequestFile{{
 		Name: "audio",
@@ -317,6 +462,20 @@ func (c SendDocumentConf) method() string {
 	return "sendDocument"
 }
 
+// WithThread returns the config sent to the forum topic.
+func (c SendDocumentConf) WithThread(threadID int) SendDocumentConf {
+	c.MessageThreadID = threadID
+	return c
+}
+
+func (c SendDocumentConf) validate() error {
+	if err := validateCaption(c.Caption, c.ParseMode); err != nil {
+		return err
+	}
+
+	return c.BaseSend.validate()
+}
+
 func (config *SendDocumentConf) files() []RequestFile {
 	files := []RequestFile{{
 		Name: "document",
@@ -352,6 +511,20 @@ func (c SendVideoConf) method() string {
 	return "sendVideo"
 }
 
+// WithThread returns the config sent to the forum topic.
+func (c SendVideoConf) WithThread(threadID int) SendVideoConf {
+	c.MessageThreadID = threadID
+	return c
+}
+
+func (c SendVideoConf) validate() error {
+	if err := validateCaption(c.Caption, c.ParseMode); err != nil {
+		return err
+	}
+
+	return c.BaseSend.validate()
+}
+
 func (config *SendVideoConf) files() []RequestFile {
 	files := []RequestFile{{
 		Name: "video",
@@ -386,6 +559,20 @@ func (c SendAnimationConf) method() string {
 	return "sendAnimation"
 }
 
+// WithThread returns the config sent to the forum topic.
+func (c SendAnimationConf) WithThread(threadID int) SendAnimationConf {
+	c.MessageThreadID = threadID
+	return c
+}
+
+func (c SendAnimationConf) validate() error {
+	if err := validateCaption(c.Caption, c.ParseMode); err != nil {
+		return err
+	}
+
+	return c.BaseSend.validate()
+}
+
 func (config *SendAnimationConf) files() []RequestFile {
 	files := []RequestFile{{
 		Name: "animation",
@@ -416,6 +603,20 @@ func (c SendVoiceConf) method() string {
 	return "sendVoice"
 }
 
+// WithThread returns the config sent to the forum topic.
+func (c SendVoiceConf) WithThread(threadID int) SendVoiceConf {
+	c.MessageThreadID = threadID
+	return c
+}
+
+func (c SendVoiceConf) validate() error {
+	if err := validateCaption(c.Caption, c.ParseMode); err != nil {
+		return err
+	}
+
+	return c.BaseSend.validate()
+}
+
 func (config *SendVoiceConf) files() []RequestFile {
 	files := []RequestFile{{
 		Name: "voice",
@@ -438,6 +639,12 @@ func (c SendVideoNoteConf) method() string {
 	return "sendVideoNote"
 }
 
+// WithThread returns the config sent to the forum topic.
+func (c SendVideoNoteConf) WithThread(threadID int) SendVideoNoteConf {
+	c.MessageThreadID = threadID
+	return c
+}
+
 func (config *SendVideoNoteConf) files() []RequestFile {
 	files := []RequestFile{{
 		Name: "video_note",
@@ -469,6 +676,12 @@ func (c SendMediaGroupConf) method() string {
 	return "sendMediaGroup"
 }
 
+// WithThread returns the config sent to the forum topic.
+func (c SendMediaGroupConf) WithThread(threadID int) SendMediaGroupConf {
+	c.MessageThreadID = threadID
+	return c
+}
+
 func (config *SendMediaGroupConf) Files() []RequestFile {
 	return prepareMediaGroup(config.Media)
 }
@@ -571,6 +784,12 @@ func (c SendLocationConf) method() string {
 	return "sendLocation"
 }
 
+// WithThread returns the config sent to the forum topic.
+func (c SendLocationConf) WithThread(threadID int) SendLocationConf {
+	c.MessageThreadID = threadID
+	return c
+}
+
 // SendVenueConf contains fields for the sendVenue method. On success, the sent Message is returned.
 type SendVenueConf struct {
 	BaseSend                // Unique identifier for the target chat or username of the target channel
@@ -588,6 +807,12 @@ func (c SendVenueConf) method() string {
 	return "sendVenue"
 }
 
+// WithThread returns the config sent to the forum topic.
+func (c SendVenueConf) WithThread(threadID int) SendVenueConf {
+	c.MessageThreadID = threadID
+	return c
+}
+
 // SendContactConf contains fields for the sendContact method. On success, the sent Message is returned.
 type SendContactConf struct {
 	BaseSend               // Unique identifier for the target chat or username of the target channel
@@ -602,12 +827,18 @@ func (c SendContactConf) method() string {
 	return "sendContact"
 }
 
+// WithThread returns the config sent to the forum topic.
+func (c SendContactConf) WithThread(threadID int) SendContactConf {
+	c.MessageThreadID = threadID
+	return c
+}
+
 // SendPollConf contains fields for the sendPoll method. On success, the sent Message is returned.
 type SendPollConf struct {
 	BaseSend                              // Unique identifier for the target chat or username of the target channel
 	Question              string          `json:"question"`                          // Poll question
 	Options               []string        `json:"options"`                           // A list of answer options
-	IsAnonymous           bool            `json:"is_anonymous,omitempty"`            // Optional. True, if the poll needs to be anonymous
+	IsAnonymous           bool            `json:"is_anonymous"`                      // Optional. True, if the poll needs to be anonymous
 	Type                  string          `json:"type,omitempty"`                    // Optional. Poll type, "quiz" or "regular"
 	AllowsMultipleAnswers bool            `json:"allows_multiple_answers,omitempty"` // Optional. True, if the poll allows multiple answers
 	CorrectOptionID       int             `json:"correct_option_id,omitempty"`       // Optional. 0-based identifier of the correct answer option
@@ -623,6 +854,12 @@ func (c SendPollConf) method() string {
 	return "sendPoll"
 }
 
+// WithThread returns the config sent to the forum topic.
+func (c SendPollConf) WithThread(threadID int) SendPollConf {
+	c.MessageThreadID = threadID
+	return c
+}
+
 // SendDiceConf contains fields for the sendDice method. On success, the sent Message is returned.
 type SendDiceConf struct {
 	BaseSend        // Unique identifier for the target chat or username of the target channel
@@ -633,6 +870,12 @@ func (c SendDiceConf) method() string {
 	return "sendDice"
 }
 
+// WithThread returns the config sent to the forum topic.
+func (c SendDiceConf) WithThread(threadID int) SendDiceConf {
+	c.MessageThreadID = threadID
+	return c
+}
+
 // SendChatActionConf contains fields for the sendChatAction method. Returns True on success.
 type SendChatActionConf struct {
 	ChatID          interface{} `json:"chat_id"`                     // Unique identifier for the target chat or username of the target channel
@@ -644,6 +887,24 @@ func (c SendChatActionConf) method() string {
 	return "sendChatAction"
 }
 
+// WithThread returns the config sent to the forum topic.
+func (c SendChatActionConf) WithThread(threadID int) SendChatActionConf {
+	c.MessageThreadID = threadID
+	return c
+}
+
+// SetMessageReactionConf contains fields for the setMessageReaction method. Returns True on success.
+type SetMessageReactionConf struct {
+	ChatID    interface{}    `json:"chat_id"`            // Unique identifier for the target chat or username of the target channel
+	MessageID int            `json:"message_id"`         // Identifier of the target message
+	Reaction  []ReactionType `json:"reaction,omitempty"` // Optional. New list of reaction types to set on the message. Omit to remove the reactions of the bot
+	IsBig     bool           `json:"is_big,omitempty"`   // Optional. Pass True to set the reaction with a big animation
+}
+
+func (c SetMessageReactionConf) method() string {
+	return "setMessageReaction"
+}
+
 // GetUserProfilePhotosConf contains fields for the getUserProfilePhotos method. Returns a UserProfilePhotos object.
 type GetUserProfilePhotosConf struct {
 	UserID int `json:"user_id"`          // Unique identifier of the target user
@@ -700,6 +961,24 @@ func (c RestrictChatMemberConf) method() string {
 	return "restrictChatMember"
 }
 
+// Until returns the config which lifts the restriction at the date, a zero date restricts forever.
+//
+// Telegram treats less than 30 seconds or more than 366 days from now as forever.
+func (c RestrictChatMemberConf) Until(date time.Time) RestrictChatMemberConf {
+	c.UntilDate = 0
+	if !date.IsZero() {
+		c.UntilDate = int(date.Unix())
+	}
+	return c
+}
+
+// WithIndependentPermissions returns the config which applies the media permissions as they are,
+// without deriving them from CanSendMessages and CanSendOtherMessages.
+func (c RestrictChatMemberConf) WithIndependentPermissions() RestrictChatMemberConf {
+	c.UseIndependentPerms = true
+	return c
+}
+
 // PromoteChatMemberConf contains fields for the promoteChatMember method. Returns True on success.
 type PromoteChatMemberConf struct {
 	ChatID              interface{} `json:"chat_id"`                          // Unique identifier for the target chat or username of the target channel (in the format @channelusername)
@@ -722,6 +1001,54 @@ func (c PromoteChatMemberConf) method() string {
 	return "promoteChatMember"
 }
 
+// Anonymous returns the config which hides the administrator in the chat.
+func (c PromoteChatMemberConf) Anonymous() PromoteChatMemberConf {
+	c.IsAnonymous = true
+	return c
+}
+
+// WithManageChat returns the config with the right to see the event log, statistics and members.
+func (c PromoteChatMemberConf) WithManageChat() PromoteChatMemberConf {
+	c.CanManageChat = true
+	return c
+}
+
+// WithDeleteMessages returns the config with the right to delete messages of other users.
+func (c PromoteChatMemberConf) WithDeleteMessages() PromoteChatMemberConf {
+	c.CanDeleteMessages = true
+	return c
+}
+
+// WithRestrictMembers returns the config with the right to restrict, ban and unban members.
+func (c PromoteChatMemberConf) WithRestrictMembers() PromoteChatMemberConf {
+	c.CanRestrictMembers = true
+	return c
+}
+
+// WithInviteUsers returns the config with the right to invite users.
+func (c PromoteChatMemberConf) WithInviteUsers() PromoteChatMemberConf {
+	c.CanInviteUsers = true
+	return c
+}
+
+// WithPinMessages returns the config with the right to pin messages.
+func (c PromoteChatMemberConf) WithPinMessages() PromoteChatMemberConf {
+	c.CanPinMessages = true
+	return c
+}
+
+// WithManageTopics returns the config with the right to manage forum topics.
+func (c PromoteChatMemberConf) WithManageTopics() PromoteChatMemberConf {
+	c.CanManageTopics = true
+	return c
+}
+
+// AsModerator returns the config with the rights of a support group moderator:
+// manage the chat, delete messages, restrict members and pin messages.
+func (c PromoteChatMemberConf) AsModerator() PromoteChatMemberConf {
+	return c.WithManageChat().WithDeleteMessages().WithRestrictMembers().WithPinMessages()
+}
+
 // SetChatAdministratorCustomTitleConf contains fields for the setChatAdministratorCustomTitle method. Returns True on success.
 type SetChatAdministratorCustomTitleConf struct {
 	ChatID      interface{} `json:"chat_id"`      // Unique identifier for the target chat or username of the target supergroup (in the format @supergroupusername)
@@ -1238,7 +1565,8 @@ type EditMessageTextConf struct {
 	Text                  string                `json:"text"`                               // New text of the message
 	ParseMode             string                `json:"parse_mode,omitempty"`               // Optional. Mode for parsing entities in the message text
 	Entities              []MessageEntity       `json:"entities,omitempty"`                 // Optional. List of special entities that appear in the message text
-	DisableWebPagePreview bool                  `json:"disable_web_page_preview,omitempty"` // Optional. Disables link previews for links in this message
+	DisableWebPagePreview bool                  `json:"disable_web_page_preview,omitempty"` // Deprecated: use LinkPreviewOptions. Disables link previews for links in this message
+	LinkPreviewOptions    *LinkPreviewOptions   `json:"link_preview_options,omitempty"`     // Optional. Link preview generation options for the message
 	ReplyMarkup           *InlineKeyboardMarkup `json:"reply_markup,omitempty"`             // Optional. Inline keyboard markup
 }
 
@@ -1246,6 +1574,20 @@ func (c EditMessageTextConf) method() string {
 	return "editMessageText"
 }
 
+// DisableLinkPreview returns the edit without link previews.
+func (c EditMessageTextConf) DisableLinkPreview() EditMessageTextConf {
+	c.LinkPreviewOptions = &LinkPreviewOptions{IsDisabled: true}
+	return c
+}
+
+func (c EditMessageTextConf) validate() error {
+	if err := validateText(c.Text, c.ParseMode); err != nil {
+		return err
+	}
+
+	return validateReplyMarkup(c.ReplyMarkup)
+}
+
 // EditMessageCaptionConf contains fields for the editMessageCaption method. On success, if the edited message is not an inline message, the edited Message is returned, otherwise True is returned.
 type EditMessageCaptionConf struct {
 	ChatID          interface{}           `json:"chat_id,omitempty"`           // Optional. Unique identifier for the target chat or username of the target channel
@@ -1261,6 +1603,14 @@ func (c EditMessageCaptionConf) method() string {
 	return "editMessageCaption"
 }
 
+func (c EditMessageCaptionConf) validate() error {
+	if err := validateCaption(c.Caption, c.ParseMode); err != nil {
+		return err
+	}
+
+	return validateReplyMarkup(c.ReplyMarkup)
+}
+
 // EditMessageMediaConf contains fields for the editMessageMedia method. On success, if the edited message is not an inline message, the edited Message is returned, otherwise True is returned.
 type EditMessageMediaConf struct {
 	ChatID          interface{}           `json:"chat_id,omitempty"`           // Optional. Unique identifier for the target chat or username of the target channel
@@ -1355,6 +1705,12 @@ func (c SendStickerConf) method() string {
 	return "sendSticker"
 }
 
+// WithThread returns the config sent to the forum topic.
+func (c SendStickerConf) WithThread(threadID int) SendStickerConf {
+	c.MessageThreadID = threadID
+	return c
+}
+
 func (config *SendStickerConf) files() []RequestFile {
 	files := []RequestFile{{
 		Name: "sticker",
@@ -1539,18 +1895,26 @@ func (c DeleteStickerSetConf) method() string {
 
 // AnswerInlineQueryConf contains fields for the answerInlineQuery method. On success, True is returned. No more than 50 results per query are allowed.
 type AnswerInlineQueryConf struct {
-	InlineQueryID string                    `json:"inline_query_id"` // Unique identifier for the answered query
-	Result        interface{}               `json:"result"`          // A JSON-serialized array of results for the inline query
-	CacheTime     int                       `json:"cache_time"`      // Optional. The maximum amount of time in seconds that the result of the inline query may be cached on the server. Defaults to 300.
-	IsPersonal    bool                      `json:"is_personal"`     // Optional. Pass True if results may be cached on the server side only for the user that sent the query. By default, results may be returned to any user who sends the same query.
-	NextOffset    string                    `json:"next_offset"`     // Optional. Pass the offset that a client should send in the next query with the same text to receive more results. Pass an empty string if there are no more results or if you don't support pagination. Offset length can't exceed 64 bytes.
-	Button        *InlineQueryResultsButton `json:"button"`          // Optional. A JSON-serialized object describing a button to be shown above inline query results
+	InlineQueryID string                    `json:"inline_query_id"`       // Unique identifier for the answered query
+	Results       []interface{}             `json:"results"`               // A JSON-serialized array of results for the inline query
+	CacheTime     int                       `json:"cache_time,omitempty"`  // Optional. The maximum amount of time in seconds that the result of the inline query may be cached on the server. Defaults to 300.
+	IsPersonal    bool                      `json:"is_personal,omitempty"` // Optional. Pass True if results may be cached on the server side only for the user that sent the query. By default, results may be returned to any user who sends the same query.
+	NextOffset    string                    `json:"next_offset,omitempty"` // Optional. Pass the offset that a client should send in the next query with the same text to receive more results. Pass an empty string if there are no more results or if you don't support pagination. Offset length can't exceed 64 bytes.
+	Button        *InlineQueryResultsButton `json:"button,omitempty"`      // Optional. A JSON-serialized object describing a button to be shown above inline query results
 }
 
 func (c AnswerInlineQueryConf) method() string {
 	return "answerInlineQuery"
 }
 
+func (c AnswerInlineQueryConf) validate() error {
+	if len(c.Results) > MaxInlineQueryResults {
+		return fmt.Errorf("too many inline query results: %d of %d", len(c.Results), MaxInlineQueryResults)
+	}
+
+	return nil
+}
+
 // AnswerWebAppQueryConf contains fields for the answerWebAppQuery method. On success, a SentWebAppMessage object is returned.
 type AnswerWebAppQueryConf struct {
 	WebAppQueryID string      `json:"web_app_query_id"` // Unique identifier for the query to be answered
@@ -1605,6 +1969,20 @@ func (c SendInvoiceConf) method() string {
 	return "sendInvoice"
 }
 
+// WithThread returns the config sent to the forum topic.
+func (c SendInvoiceConf) WithThread(threadID int) SendInvoiceConf {
+	c.MessageThreadID = threadID
+	return c
+}
+
+func (c SendInvoiceConf) validate() error {
+	if err := validateInvoice(c.Currency, c.Prices); err != nil {
+		return err
+	}
+
+	return validateReplyMarkup(c.ReplyMarkup)
+}
+
 // CreateInvoiceLinkConf contains fields for the createInvoiceLink method. Returns the created invoice link as String on success.
 type CreateInvoiceLinkConf struct {
 	Title                     string         `json:"title"`                                   // Product name, 1-32 characters
@@ -1633,6 +2011,10 @@ func (c CreateInvoiceLinkConf) method() string {
 	return "createInvoiceLink"
 }
 
+func (c CreateInvoiceLinkConf) validate() error {
+	return validateInvoice(c.Currency, c.Prices)
+}
+
 // AnswerShippingQueryConf contains fields for the answerShippingQuery method. On success, True is returned.
 type AnswerShippingQueryConf struct {
 	ShippingQueryID string           `json:"shipping_query_id"`          // Unique identifier for the query to be answered
@@ -1698,6 +2080,12 @@ func (c SendGameConf) method() string {
 	return "sendGame"
 }
 
+// WithThread returns the config sent to the forum topic.
+func (c SendGameConf) WithThread(threadID int) SendGameConf {
+	c.MessageThreadID = threadID
+	return c
+}
+
 // SetGameScoreConf contains fields for the setGameScore method. On success, if the message is not an inline message, the Message is returned, otherwise True is returned. Returns an error, if the new score is not greater than the user's current score in the chat and force is False.
 type SetGameScoreConf struct {
 	UserID             int    `json:"user_id"`                        // User identifier
@@ -1724,3 +2112,87 @@ type GetGameHighScoresConf struct {
 func (c GetGameHighScoresConf) method() string {
 	return "getGameHighScores"
 }
+
+//
+//
+//
+// Validation
+//
+//
+//
+
+// validateText checks that the message text is not empty or blank and its length.
+//
+// With a parse mode the markup counts in the text, so Telegram checks the length after parsing.
+func validateText(text, parseMode string) error {
+	if strings.TrimSpace(text) == "" {
+		return ErrEmptyText
+	}
+
+	if length := UTF16Len(text); parseMode == "" && length > MaxMessageLength {
+		return fmt.Errorf("message text is too long: %d of %d UTF-16 code units", length, MaxMessageLength)
+	}
+
+	return nil
+}
+
+// validateInvoice checks the currency code and the price breakdown.
+func validateInvoice(currency string, prices []LabeledPrice) error {
+	if len(currency) != 3 {
+		return fmt.Errorf("currency %q is not a three-letter ISO 4217 code", currency)
+	}
+
+	for _, r := range currency {
+		if r < 'A' || r > 'Z' {
+			return fmt.Errorf("currency %q is not a three-letter ISO 4217 code", currency)
+		}
+	}
+
+	if len(prices) == 0 {
+		return fmt.Errorf("invoice prices are empty, at least one LabeledPrice is required")
+	}
+
+	for _, price := range prices {
+		if price.Amount < 0 {
+			return fmt.Errorf("price %q has a negative amount: %d", price.Label, price.Amount)
+		}
+	}
+
+	return nil
+}
+
+// validateCaption checks the caption length, unless the caption has markup of the parse mode.
+func validateCaption(caption, parseMode string) error {
+	if length := UTF16Len(caption); parseMode == "" && length > MaxCaptionLength {
+		return fmt.Errorf("caption is too long: %d of %d UTF-16 code units", length, MaxCaptionLength)
+	}
+
+	return nil
+}
+
+// validateReplyMarkup checks callback data of inline keyboard buttons.
+func validateReplyMarkup(markup interface{}) error {
+	var keyboard [][]InlineKeyboardButton
+
+	switch m := markup.(type) {
+	case InlineKeyboardMarkup:
+		keyboard = m.InlineKeyboard
+	case *InlineKeyboardMarkup:
+		if m == nil {
+			return nil
+		}
+		keyboard = m.InlineKeyboard
+	default:
+		return nil
+	}
+
+	for _, row := range keyboard {
+		for _, button := range row {
+			if button.CallbackData != nil && len(*button.CallbackData) > MaxCallbackDataLength {
+				return fmt.Errorf("callback data of button %q is too long: %d of %d bytes", button.Text, len(*button.CallbackData), MaxCallbackDataLength)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,244 @@
+package telegram
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateTextLimitInUTF16(t *testing.T) {
+	emoji := "😀" // two UTF-16 code units
+	tests := []struct {
+		name    string
+		text    string
+		wantErr bool
+	}{
+		{"at limit", strings.Repeat("a", MaxMessageLength), false},
+		{"over limit", strings.Repeat("a", MaxMessageLength+1), true},
+		{"emoji at limit", strings.Repeat(emoji, MaxMessageLength/2), false},
+		{"emoji over limit", strings.Repeat(emoji, MaxMessageLength/2) + "a", true},
+		{"cyrillic fits", strings.Repeat("я", MaxMessageLength), false},
+	}
+	for _, tt := range tests {
+		err := NewMessage(1, tt.text).validate()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, wantErr %t", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestValidateTextSkipsLengthWithParseMode(t *testing.T) {
+	text := "<b>" + strings.Repeat("a", MaxMessageLength-2) + "</b>"
+	message := NewMessage(1, text)
+	if err := message.validate(); err == nil {
+		t.Fatal("plain text over the limit is accepted")
+	}
+	message.ParseMode = ModeHTML
+	if err := message.validate(); err != nil {
+		t.Fatalf("HTML text is rejected: %v", err)
+	}
+	edit := NewEditMessageText(1, 2, text)
+	edit.ParseMode = ModeHTML
+	if err := edit.validate(); err != nil {
+		t.Fatalf("HTML edit is rejected: %v", err)
+	}
+}
+
+func TestValidateCaption(t *testing.T) {
+	caption := strings.Repeat("😀", MaxCaptionLength/2)
+	photo := NewPhoto(1, FileID("id"))
+	photo.Caption = caption
+	if err := photo.validate(); err != nil {
+		t.Fatalf("caption at the limit is rejected: %v", err)
+	}
+	photo.Caption += "a"
+	if err := photo.validate(); err == nil {
+		t.Fatal("caption over the limit is accepted")
+	}
+	photo.Caption = "*" + strings.Repeat("a", MaxCaptionLength) + "*"
+	photo.ParseMode = ModeMarkdownV2
+	if err := photo.validate(); err != nil {
+		t.Fatalf("MarkdownV2 caption is rejected: %v", err)
+	}
+}
+
+func TestValidateCallbackData(t *testing.T) {
+	message := NewMessage(1, "text")
+	message.ReplyMarkup = NewInlineKeyboardMarkup(NewInlineKeyboardRow(NewInlineKeyboardButtonData("ok", strings.Repeat("x", MaxCallbackDataLength))))
+	if err := message.validate(); err != nil {
+		t.Fatalf("callback data at the limit is rejected: %v", err)
+	}
+	message.ReplyMarkup = NewInlineKeyboardMarkup(NewInlineKeyboardRow(NewInlineKeyboardButtonData("long", strings.Repeat("x", MaxCallbackDataLength+1))))
+	if err := message.validate(); err == nil {
+		t.Fatal("callback data over the limit is accepted")
+	}
+}
+
+func TestValidateEmptyText(t *testing.T) {
+	for _, text := range []string{"", " ", " \n\t"} {
+		if err := NewMessage(1, text).validate(); !errors.Is(err, ErrEmptyText) {
+			t.Errorf("message %q: err = %v, want ErrEmptyText", text, err)
+		}
+		if err := NewEditMessageText(1, 5, text).validate(); !errors.Is(err, ErrEmptyText) {
+			t.Errorf("edit %q: err = %v, want ErrEmptyText", text, err)
+		}
+	}
+	if err := NewMessage(1, ".").validate(); err != nil {
+		t.Fatalf("a short text is rejected: %v", err)
+	}
+}
+
+func TestEmptyTextIsNotSent(t *testing.T) {
+	m := newMockServer(t)
+	client := m.client(t)
+	if _, err := client.Send(NewMessage(1, "")); !errors.Is(err, ErrEmptyText) || err.Error() != "message text is empty" {
+		t.Fatalf("Send = %v, want ErrEmptyText", err)
+	}
+	if _, err := client.Request(NewEditMessageText(1, 5, "  ")); !errors.Is(err, ErrEmptyText) {
+		t.Fatalf("Request = %v, want ErrEmptyText", err)
+	}
+	if calls := len(m.calls("sendMessage")) + len(m.calls("editMessageText")); calls != 0 {
+		t.Fatalf("%d requests for empty text", calls)
+	}
+	m.respond("sendMessage", `{"ok":true,"result":{"message_id":9,"date":1,"chat":{"id":1,"type":"private"}}}`)
+	if _, err := client.Send(NewMessage(1, "hi")); err != nil || len(m.calls("sendMessage")) != 1 {
+		t.Fatalf("Send = %v after %d requests, want the text sent", err, len(m.calls("sendMessage")))
+	}
+}
+
+func TestValidateInvoice(t *testing.T) {
+	prices := []LabeledPrice{{Label: "Support", Amount: 500}, {Label: "Discount", Amount: 0}}
+	invoice := NewInvoice(1, "Support", "Priority support", "payload", "token", "", "USD", prices)
+	if invoice.ChatID != 1 || invoice.Currency != "USD" || len(invoice.Prices) != 2 {
+		t.Fatalf("invoice = %+v", invoice)
+	}
+	if err := invoice.validate(); err != nil {
+		t.Fatalf("the valid invoice is rejected: %v", err)
+	}
+
+	invoice.Prices = nil
+	if err := invoice.validate(); err == nil || !strings.Contains(err.Error(), "prices are empty") {
+		t.Fatalf("err = %v, want the empty prices error", err)
+	}
+	invoice.Prices = []LabeledPrice{{Label: "Refund", Amount: -1}}
+	if err := invoice.validate(); err == nil || !strings.Contains(err.Error(), `"Refund" has a negative amount`) {
+		t.Fatalf("err = %v, want the negative amount error", err)
+	}
+	for _, currency := range []string{"", "usd", "US", "USDT"} {
+		link := CreateInvoiceLinkConf{Title: "Support", Currency: currency, Prices: prices}
+		if err := link.validate(); err == nil || !strings.Contains(err.Error(), "ISO 4217") {
+			t.Fatalf("currency %q: err = %v", currency, err)
+		}
+	}
+}
+
+func TestInvalidInvoiceIsNotSent(t *testing.T) {
+	m := newMockServer(t)
+	invoice := NewInvoice(1, "Support", "Priority support", "payload", "token", "", "USD", nil)
+	if _, err := m.client(t).Send(invoice); err == nil {
+		t.Fatal("the invoice without prices is sent")
+	}
+	if len(m.calls("sendInvoice")) != 0 {
+		t.Fatal("sendInvoice is called")
+	}
+}
+
+func TestNewRestrict(t *testing.T) {
+	perms := ChatPermissions{CanSendMessages: true, CanSendPhotos: true}
+	mute := NewRestrict(-1001234567890, 42, ChatPermissions{})
+	if mute.ChatID != -1001234567890 || mute.UserID != 42 || mute.Permissions != (ChatPermissions{}) || mute.UntilDate != 0 || mute.UseIndependentPerms {
+		t.Fatalf("mute = %+v", mute)
+	}
+	until := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	config := NewRestrict(-1001234567890, 42, perms).Until(until).WithIndependentPermissions()
+	if config.UntilDate != int(until.Unix()) || !config.UseIndependentPerms || config.Permissions != perms {
+		t.Fatalf("config = %+v", config)
+	}
+	if forever := config.Until(time.Time{}); forever.UntilDate != 0 || config.UntilDate == 0 {
+		t.Fatalf("Until(zero) = %d, the original = %d", forever.UntilDate, config.UntilDate)
+	}
+
+	m := newMockServer(t)
+	if _, err := m.client(t).Request(config); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"chat_id":-1001234567890,"user_id":42,"permissions":{"can_send_messages":true,"can_send_photos":true},` +
+		`"use_independent_chat_permissions":true,"until_date":1893553445}`
+	if body := string(m.calls("restrictChatMember")[0].Body); body != want {
+		t.Fatalf("body = %s, want %s", body, want)
+	}
+}
+
+func TestNewPromote(t *testing.T) {
+	demote := NewPromote(-1001234567890, 42)
+	if demote != (PromoteChatMemberConf{ChatID: -1001234567890, UserID: 42}) {
+		t.Fatalf("demote = %+v", demote)
+	}
+	moderator := demote.AsModerator()
+	want := PromoteChatMemberConf{ChatID: -1001234567890, UserID: 42, CanManageChat: true, CanDeleteMessages: true, CanRestrictMembers: true, CanPinMessages: true}
+	if moderator != want {
+		t.Fatalf("moderator = %+v", moderator)
+	}
+	if demote.CanManageChat {
+		t.Fatal("a setter changes the original config")
+	}
+	full := demote.Anonymous().WithInviteUsers().WithManageTopics().WithDeleteMessages()
+	if !full.IsAnonymous || !full.CanInviteUsers || !full.CanManageTopics || !full.CanDeleteMessages || full.CanRestrictMembers || full.CanPinMessages {
+		t.Fatalf("rights = %+v", full)
+	}
+}
+
+func TestLinkPreviewOptions(t *testing.T) {
+	message := NewMessage(1, "see https://example.com")
+	message.LinkPreviewOptions = &LinkPreviewOptions{URL: "https://example.com/card", PreferSmallMedia: true, ShowAboveText: true}
+	data, err := json.Marshal(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `"link_preview_options":{"url":"https://example.com/card","prefer_small_media":true,"show_above_text":true}`
+	if !strings.Contains(string(data), want) || strings.Contains(string(data), "disable_web_page_preview") {
+		t.Fatalf("message = %s, want %s", data, want)
+	}
+	if data, _ := json.Marshal(NewMessage(1, "plain")); strings.Contains(string(data), "link_preview_options") {
+		t.Fatalf("message without options = %s", data)
+	}
+
+	plain := NewMessage(1, "see https://example.com")
+	for name, config := range map[string]interface{}{
+		"message": plain.DisableLinkPreview(),
+		"edit":    NewEditMessageText(1, 5, "see https://example.com").DisableLinkPreview(),
+	} {
+		data, err := json.Marshal(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(data), `"link_preview_options":{"is_disabled":true}`) {
+			t.Errorf("%s = %s, want the preview disabled", name, data)
+		}
+	}
+	if plain.LinkPreviewOptions != nil {
+		t.Fatal("DisableLinkPreview changes the original config")
+	}
+
+	var sent Message
+	if err := json.Unmarshal([]byte(`{"message_id":1,"text":"hi","link_preview_options":{"is_disabled":true}}`), &sent); err != nil {
+		t.Fatal(err)
+	}
+	if sent.LinkPreviewOptions == nil || !sent.LinkPreviewOptions.IsDisabled {
+		t.Fatalf("message options = %+v", sent.LinkPreviewOptions)
+	}
+}
+
+func TestDisabledLinkPreviewIsSent(t *testing.T) {
+	m := newMockServer(t)
+	m.respond("sendMessage", `{"ok":true,"result":{"message_id":9,"date":1,"chat":{"id":1,"type":"private"}}}`)
+	if _, err := m.client(t).Send(NewMessage(1, "see https://example.com").DisableLinkPreview()); err != nil {
+		t.Fatal(err)
+	}
+	calls := m.calls("sendMessage")
+	if len(calls) != 1 || !strings.Contains(string(calls[0].Body), `"link_preview_options":{"is_disabled":true}`) {
+		t.Fatalf("requests = %+v", calls)
+	}
+}
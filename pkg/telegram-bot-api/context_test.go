@@ -0,0 +1,165 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"testing"
+	"time"
+)
+
+// hangingServer answers getMe and hangs on other methods until the request is cancelled
+//
+// Every cancelled request is reported to the returned channel
+func hangingServer(t *testing.T) (*httptest.Server, chan string) {
+	cancelled := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The server notices the closed connection only after the body is read
+		io.Copy(io.Discard, r.Body)
+		method := path.Base(r.URL.Path)
+		if method == "getMe" {
+			w.Write([]byte(mockGetMe))
+			return
+		}
+		select {
+		case <-r.Context().Done():
+			cancelled <- method
+		case <-time.After(5 * time.Second):
+			w.Write([]byte(mockMessage))
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, cancelled
+}
+
+// waitCancelled fails the test if the server doesn't see the cancelled request of the method
+func waitCancelled(t *testing.T, cancelled chan string, method string) {
+	select {
+	case got := <-cancelled:
+		if got != method {
+			t.Fatalf("%s is cancelled, want %s", got, method)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("the %s request is not cancelled on the server", method)
+	}
+}
+
+func TestSendWithContextReturnsOnCancel(t *testing.T) {
+	server, cancelled := hangingServer(t)
+	client, err := NewWithHost("token", server.URL+"/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = client.SendWithContext(ctx, NewMessage(5, "hello"))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want the deadline error", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("returned after %v", elapsed)
+	}
+	waitCancelled(t, cancelled, "sendMessage")
+}
+
+func TestUploadWithContextReturnsOnCancel(t *testing.T) {
+	server, cancelled := hangingServer(t)
+	client, err := NewWithHost("token", server.URL+"/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	document := NewDocument(5, FileBytes{Name: "report.csv", Bytes: []byte("id,text\n1,hello\n")})
+	if _, err := client.SendWithContext(ctx, document); !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want the cancel error", err)
+	}
+	waitCancelled(t, cancelled, "sendDocument")
+}
+
+func TestCancelledRequestIsNotRetried(t *testing.T) {
+	fastRetries(t)
+	server, cancelled := hangingServer(t)
+	client, err := NewWithHost("token", server.URL+"/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.MaxRetries = 3
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := client.RequestWithContext(ctx, GetWebhookInfoConf{}); err == nil {
+		t.Fatal("no error")
+	}
+	waitCancelled(t, cancelled, "getWebhookInfo")
+	select {
+	case method := <-cancelled:
+		t.Fatalf("%s is retried after the context is done", method)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// deadlineClient records the deadline of the last request
+type deadlineClient struct {
+	HTTPClient
+	deadline time.Time
+}
+
+func (c *deadlineClient) Do(req *http.Request) (*http.Response, error) {
+	c.deadline, _ = req.Context().Deadline()
+	return c.HTTPClient.Do(req)
+}
+
+func TestGetUpdatesDeadlineFollowsTimeout(t *testing.T) {
+	m := newMockServer(t)
+	m.respond("getUpdates", `{"ok":true,"result":[]}`)
+	recorder := &deadlineClient{HTTPClient: http.DefaultClient}
+	client, err := NewWithClient("token", m.URL+"/", recorder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := NewUpdate(0)
+	config.Timeout = 30
+	start := time.Now()
+	if _, err := client.GetUpdates(config); err != nil {
+		t.Fatal(err)
+	}
+	want := start.Add(30*time.Second + UpdatesTimeoutMargin)
+	if recorder.deadline.Before(want) || recorder.deadline.After(want.Add(time.Second)) {
+		t.Fatalf("deadline in %v, want %v", recorder.deadline.Sub(start), want.Sub(start))
+	}
+}
+
+func TestGetUpdatesTimeoutEndsBeforeHTTPTimeout(t *testing.T) {
+	m := newMockServer(t)
+	m.respond("getUpdates", `{"ok":true,"result":[]}`)
+	client := m.client(t)
+	config := NewUpdate(0)
+	config.Timeout = 300
+	if _, err := client.GetUpdates(config); err != nil {
+		t.Fatal(err)
+	}
+	var params GetUpdatesConf
+	if err := json.Unmarshal(m.calls("getUpdates")[0].Body, &params); err != nil {
+		t.Fatal(err)
+	}
+	if want := int((DefaultHTTPTimeout - UpdatesTimeoutMargin) / time.Second); params.Timeout != want {
+		t.Fatalf("timeout = %d, want %d", params.Timeout, want)
+	}
+
+	// Clients without a timeout poll as long as asked
+	client.Client = &http.Client{}
+	if _, err := client.GetUpdates(config); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(m.calls("getUpdates")[1].Body, &params); err != nil {
+		t.Fatal(err)
+	}
+	if params.Timeout != 300 {
+		t.Fatalf("timeout = %d, want 300", params.Timeout)
+	}
+}
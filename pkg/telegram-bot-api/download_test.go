@@ -0,0 +1,136 @@
+package telegram
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fileServer is a Bot API server which serves files by path under /file/bottoken/
+type fileServer struct {
+	*httptest.Server
+	mu    sync.Mutex
+	paths []string
+}
+
+func newFileServer(t *testing.T) *fileServer {
+	s := &fileServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if path, ok := strings.CutPrefix(r.URL.Path, "/file/bottoken/"); ok {
+			s.mu.Lock()
+			s.paths = append(s.paths, path)
+			s.mu.Unlock()
+			w.Write([]byte("remote " + path))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(mockGetMe))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// downloads returns the file paths requested over HTTP
+func (s *fileServer) downloads() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.paths...)
+}
+
+func TestLocalModeReadsAbsolutePathsFromDisk(t *testing.T) {
+	s := newFileServer(t)
+	client, err := NewWithHost("token", s.URL+"/", WithLocalMode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The local server has no 20 MB download limit
+	content := bytes.Repeat([]byte("a"), 21<<20)
+	path := filepath.Join(t.TempDir(), "voice.ogg")
+	if err := os.WriteFile(path, content, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	file := &File{FileID: "f1", FilePath: path}
+	if !file.IsLocal(*client) || file.Link(*client) != path {
+		t.Fatalf("link = %q, want the path on disk", file.Link(*client))
+	}
+	data, err := client.DownloadFile(file)
+	if err != nil || !bytes.Equal(data, content) {
+		t.Fatalf("DownloadFile = %d bytes, %v", len(data), err)
+	}
+
+	// Relative paths are still downloaded over HTTP
+	relative := &File{FileID: "f2", FilePath: "voice/file_2.ogg"}
+	if relative.IsLocal(*client) {
+		t.Fatal("the relative path is local")
+	}
+	data, err = client.DownloadFile(relative)
+	if err != nil || string(data) != "remote voice/file_2.ogg" {
+		t.Fatalf("DownloadFile = %q, %v", data, err)
+	}
+	if downloads := s.downloads(); len(downloads) != 1 || downloads[0] != "voice/file_2.ogg" {
+		t.Fatalf("HTTP downloads = %v", downloads)
+	}
+}
+
+func TestRemoteModeDownloadsOverHTTP(t *testing.T) {
+	s := newFileServer(t)
+	client, err := NewWithHost("token", s.URL+"/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "voice.ogg")
+	if err := os.WriteFile(path, []byte("local"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	file := &File{FileID: "f1", FilePath: path}
+	if file.IsLocal(*client) {
+		t.Fatal("the file is local without the local mode")
+	}
+	if link := file.Link(*client); link != s.URL+"/file/bottoken/"+path {
+		t.Fatalf("link = %q", link)
+	}
+	data, err := client.DownloadFile(file)
+	if err != nil || string(data) == "local" || len(s.downloads()) != 1 {
+		t.Fatalf("DownloadFile = %q, %v, HTTP downloads = %v", data, err, s.downloads())
+	}
+}
+
+func TestDownloadWithoutPath(t *testing.T) {
+	client, err := NewWithHost("token", newFileServer(t).URL+"/", WithLocalMode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.DownloadFile(&File{FileID: "f1"}); err == nil {
+		t.Fatal("a file without the path is downloaded")
+	}
+}
+
+func TestGetFileDirectURL(t *testing.T) {
+	m := newMockServer(t)
+	client := m.client(t)
+	client.MaxRetries = 0
+	m.respond("getFile", `{"ok":true,"result":{"file_id":"voice","file_unique_id":"v","file_size":42,"file_path":"voice/file_1.oga"}}`)
+	link, err := client.GetFileDirectURL("voice")
+	if err != nil || link != m.URL+"/file/bottoken/voice/file_1.oga" {
+		t.Fatalf("GetFileDirectURL = %q, %v", link, err)
+	}
+	if body := string(m.calls("getFile")[0].Body); !strings.Contains(body, `"file_id":"voice"`) {
+		t.Fatalf("getFile request = %s", body)
+	}
+
+	m.respond("getFile", `{"ok":false,"error_code":400,"description":"Bad Request: invalid file_id"}`)
+	if link, err := client.GetFileDirectURL("gone"); err == nil || link != "" {
+		t.Fatalf("GetFileDirectURL of a missing file = %q, %v", link, err)
+	}
+
+	local := m.client(t, WithLocalMode())
+	m.respond("getFile", `{"ok":true,"result":{"file_id":"voice","file_unique_id":"v","file_path":"/var/lib/telegram-bot-api/voice/file_1.oga"}}`)
+	if link, err := local.GetFileDirectURL("voice"); err != nil || link != "/var/lib/telegram-bot-api/voice/file_1.oga" {
+		t.Fatalf("GetFileDirectURL in the local mode = %q, %v", link, err)
+	}
+}
@@ -0,0 +1,77 @@
+package telegram
+
+import (
+	"reflect"
+	"testing"
+)
+
+// entityMessage has a command, a mention, a text link and a URL after emoji
+func entityMessage() *Message {
+	return &Message{
+		Text: "👋 /start@jobs_bot hi @alice, see docs 🚀 https://example.com/ä",
+		Entities: []*MessageEntity{
+			{Type: "bot_command", Offset: 3, Length: 15},
+			{Type: "mention", Offset: 22, Length: 6},
+			{Type: "text_link", Offset: 34, Length: 4, URL: "https://docs.example.com"},
+			{Type: "url", Offset: 42, Length: 21},
+		},
+	}
+}
+
+func TestEntityText(t *testing.T) {
+	m := entityMessage()
+	want := []string{"/start@jobs_bot", "@alice", "docs", "https://example.com/ä"}
+	for i, e := range m.Entities {
+		if got := m.EntityText(e); got != want[i] {
+			t.Errorf("EntityText(%s) = %q, want %q", e.Type, got, want[i])
+		}
+	}
+	if got := m.EntityText(&MessageEntity{Type: "bold", Offset: 60, Length: 10}); got != "m/ä" {
+		t.Errorf("clipped entity = %q", got)
+	}
+	if got := m.EntityText(&MessageEntity{Type: "bold", Offset: 100, Length: 1}); got != "" {
+		t.Errorf("entity past the end = %q", got)
+	}
+	if got := m.EntityText(&MessageEntity{Type: "bold", Offset: 0, Length: 2}); got != "👋" {
+		t.Errorf("surrogate pair = %q", got)
+	}
+}
+
+func TestEntityHelpers(t *testing.T) {
+	m := entityMessage()
+	if got := m.URLs(); !reflect.DeepEqual(got, []string{"https://docs.example.com", "https://example.com/ä"}) {
+		t.Errorf("URLs = %q", got)
+	}
+	if got := m.Mentions(); !reflect.DeepEqual(got, []string{"@alice"}) {
+		t.Errorf("Mentions = %q", got)
+	}
+	if got := m.Commands(); !reflect.DeepEqual(got, []string{"/start@jobs_bot"}) {
+		t.Errorf("Commands = %q", got)
+	}
+	if got := (&Message{Text: "plain"}).URLs(); got != nil {
+		t.Errorf("URLs without entities = %q", got)
+	}
+}
+
+func TestCaptionEntities(t *testing.T) {
+	caption := &MessageEntity{Type: "mention", Offset: 3, Length: 4}
+	m := &Message{
+		Text:            "see https://a.example",
+		Entities:        []*MessageEntity{{Type: "url", Offset: 4, Length: 17}},
+		Caption:         "🎉 @bob",
+		CaptionEntities: []*MessageEntity{caption},
+	}
+	if got := m.EntityText(caption); got != "@bob" {
+		t.Fatalf("caption entity = %q", got)
+	}
+	if got := m.Mentions(); !reflect.DeepEqual(got, []string{"@bob"}) {
+		t.Fatalf("Mentions = %q", got)
+	}
+	if got := m.URLs(); !reflect.DeepEqual(got, []string{"https://a.example"}) {
+		t.Fatalf("URLs = %q", got)
+	}
+	photo := &Message{Caption: "@carol", CaptionEntities: []*MessageEntity{{Type: "mention", Offset: 0, Length: 6}}}
+	if got := photo.Mentions(); !reflect.DeepEqual(got, []string{"@carol"}) {
+		t.Fatalf("Mentions of a caption = %q", got)
+	}
+}
@@ -0,0 +1,111 @@
+package telegram
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestErrorPredicates(t *testing.T) {
+	tests := []struct {
+		err  Error
+		kind error
+	}{
+		{Error{Code: 403, Message: "Forbidden: bot was blocked by the user"}, ErrBlockedByUser},
+		{Error{Code: 403, Message: "Forbidden: user is deactivated"}, ErrUserDeactivated},
+		{Error{Code: 400, Message: "Bad Request: chat not found"}, ErrChatNotFound},
+		{Error{Code: 400, Message: "Bad Request: message to edit not found"}, ErrMessageNotFound},
+		{Error{Code: 400, Message: "Bad Request: message to copy not found"}, ErrMessageNotFound},
+		{Error{Code: 400, Message: "Bad Request: message is not modified: specified new message content and reply markup are exactly the same as a current content and reply markup of the message"}, ErrMessageNotModified},
+		{Error{Code: 429, Message: "Too Many Requests: retry after 5", ResponseParameters: ResponseParameters{RetryAfter: 5}}, ErrTooManyRequests},
+	}
+	kinds := []error{ErrBlockedByUser, ErrUserDeactivated, ErrChatNotFound, ErrMessageNotFound, ErrMessageNotModified, ErrTooManyRequests}
+	for _, test := range tests {
+		for _, kind := range kinds {
+			if got := errors.Is(&test.err, kind); got != (kind == test.kind) {
+				t.Errorf("%q is %q = %t", test.err.Message, kind, got)
+			}
+		}
+	}
+
+	blocked := Error{Code: 403, Message: "Forbidden: bot was blocked by the user"}
+	if !blocked.IsBlockedByUser() || blocked.IsUserDeactivated() || blocked.IsChatNotFound() || blocked.IsTooManyRequests() {
+		t.Fatal("the block is not recognized")
+	}
+	deleted := Error{Code: 400, Message: "Bad Request: message to delete not found"}
+	if !deleted.IsMessageToDeleteNotFound() || !deleted.IsMessageNotFound() || deleted.IsChatNotFound() {
+		t.Fatal("the deleted message is not recognized")
+	}
+	// The description alone is not enough, the code must match too
+	if (Error{Code: 400, Message: "bot was blocked by the user"}).IsBlockedByUser() {
+		t.Fatal("a bad request is a block")
+	}
+}
+
+func TestErrorHelpersUnwrap(t *testing.T) {
+	err := fmt.Errorf("broadcast: %w", &Error{Code: 429, Message: "Too Many Requests: retry after 7", ResponseParameters: ResponseParameters{RetryAfter: 7}})
+	if !IsTooManyRequests(err) || IsBlockedByUser(err) || IsChatNotFound(err) || IsMessageNotFound(err) {
+		t.Fatal("the wrapped flood error is not recognized")
+	}
+	if apiErr, ok := AsError(err); !ok || apiErr.Code != 429 {
+		t.Fatalf("AsError = %v, %t", apiErr, ok)
+	}
+	if wait, ok := RetryAfter(err); !ok || wait != 7*time.Second {
+		t.Fatalf("RetryAfter = %s, %t", wait, ok)
+	}
+	if _, ok := RetryAfter(errors.New("Too Many Requests")); ok {
+		t.Fatal("a plain error has RetryAfter")
+	}
+	if IsBlockedByUser(errors.New("Forbidden: bot was blocked by the user")) || IsUserDeactivated(nil) {
+		t.Fatal("errors without the API error are recognized")
+	}
+	if !IsUserDeactivated(fmt.Errorf("send: %w", &Error{Code: 403, Message: "Forbidden: user is deactivated"})) {
+		t.Fatal("the wrapped deleted account is not recognized")
+	}
+	if !IsMessageToDeleteNotFound(&Error{Code: 400, Message: "Bad Request: message to delete not found"}) ||
+		!IsMessageNotModified(&Error{Code: 400, Message: "Bad Request: message is not modified"}) {
+		t.Fatal("the message errors are not recognized")
+	}
+}
+
+func TestCapturedErrorPayloads(t *testing.T) {
+	m := newMockServer(t)
+	client := m.client(t)
+	client.MaxRetries = 0
+	tests := []struct {
+		config Config
+		body   string
+		kinds  []error
+	}{
+		{NewMessage(5, "hi"), `403 {"ok":false,"error_code":403,"description":"Forbidden: bot was blocked by the user"}`, []error{ErrBlockedByUser}},
+		{NewMessage(5, "hi"), `403 {"ok":false,"error_code":403,"description":"Forbidden: user is deactivated"}`, []error{ErrUserDeactivated}},
+		{NewMessage(5, "hi"), `403 {"ok":false,"error_code":403,"description":"Forbidden: bot can't initiate conversation with a user"}`, nil},
+		{NewMessage(-100, "hi"), `400 {"ok":false,"error_code":400,"description":"Bad Request: chat not found"}`, []error{ErrChatNotFound}},
+		{NewEditMessageText(5, 9, "hi"), `400 {"ok":false,"error_code":400,"description":"Bad Request: message to edit not found"}`, []error{ErrMessageNotFound}},
+		{NewEditMessageText(5, 9, "hi"), `400 {"ok":false,"error_code":400,"description":"Bad Request: message is not modified: specified new message content and reply markup are exactly the same as a current content and reply markup of the message"}`, []error{ErrMessageNotModified}},
+		{NewDeleteMessage(5, 9), `400 {"ok":false,"error_code":400,"description":"Bad Request: message to delete not found"}`, []error{ErrMessageNotFound, ErrMessageToDeleteNotFound}},
+		{NewMessage(5, "hi"), `429 {"ok":false,"error_code":429,"description":"Too Many Requests: retry after 35","parameters":{"retry_after":35}}`, []error{ErrTooManyRequests}},
+	}
+	kinds := []error{ErrBlockedByUser, ErrUserDeactivated, ErrChatNotFound, ErrMessageNotFound, ErrMessageToDeleteNotFound, ErrMessageNotModified, ErrTooManyRequests}
+	for _, tt := range tests {
+		m.respond(tt.config.method(), tt.body)
+		_, err := client.Request(tt.config)
+		if _, ok := AsError(err); !ok {
+			t.Fatalf("%s: err = %v (%T), want the API error", tt.body, err, err)
+		}
+		for _, kind := range kinds {
+			want := false
+			for _, k := range tt.kinds {
+				want = want || k == kind
+			}
+			if got := errors.Is(err, kind); got != want {
+				t.Errorf("%s: is %q = %t", tt.body, kind, got)
+			}
+		}
+	}
+	_, err := client.Request(NewMessage(5, "hi"))
+	if wait, ok := RetryAfter(fmt.Errorf("send: %w", err)); !ok || wait != 35*time.Second {
+		t.Fatalf("RetryAfter = %s, %t", wait, ok)
+	}
+}
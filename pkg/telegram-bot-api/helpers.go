@@ -2,15 +2,40 @@ package telegram
 
 import (
 	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
 	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/hex"
+	"encoding/pem"
 	"errors"
 	"fmt"
+	"math/big"
+	"net"
 	"net/url"
 	"sort"
 	"strings"
+	"time"
 )
 
+// UTF16Len returns the length of the string in UTF-16 code units.
+//
+// Telegram counts text limits in UTF-16 code units, so characters outside
+// the Basic Multilingual Plane (most emoji) count as two.
+func UTF16Len(s string) int {
+	length := 0
+	for _, r := range s {
+		if r >= 0x10000 {
+			length += 2
+		} else {
+			length++
+		}
+	}
+
+	return length
+}
+
 // NewMessage creates a new Message.
 //
 // chatID is where to send it, text is the message text.
@@ -25,6 +50,13 @@ func NewMessage(chatID int, text string) SendMessageConf {
 	}
 }
 
+// NewMessageToThread creates a new Message in the forum topic.
+//
+// threadID is the MessageThreadID of the topic.
+func NewMessageToThread(chatID, threadID int, text string) SendMessageConf {
+	return NewMessage(chatID, text).WithThread(threadID)
+}
+
 // NewMessageToChannel creates a new Message that is sent to a channel
 // by username.
 //
@@ -263,6 +295,22 @@ func NewChatAction(chatID int, action string) SendChatActionConf {
 	}
 }
 
+// NewSetMessageReaction sets emoji reactions of the bot on a message.
+//
+// chatID and messageID identify the message, no emoji removes the reactions.
+func NewSetMessageReaction(chatID, messageID int, emoji ...string) SetMessageReactionConf {
+	reactions := make([]ReactionType, 0, len(emoji))
+	for _, e := range emoji {
+		reactions = append(reactions, ReactionType{Type: "emoji", Emoji: e})
+	}
+
+	return SetMessageReactionConf{
+		ChatID:    chatID,
+		MessageID: messageID,
+		Reaction:  reactions,
+	}
+}
+
 // NewUserProfilePhotos gets user profile photos.
 //
 // userID is the ID of the user you wish to get profile photos from.
@@ -288,10 +336,9 @@ func NewUpdate(offset int) GetUpdatesConf {
 
 // NewWebhook creates a new webhook.
 //
-// link is the url parsable link you wish to get the updates.
+// link is the url parsable link you wish to get the updates, it must use HTTPS.
 func NewWebhook(link string) (SetWebhookConf, error) {
-	u, err := url.Parse(link)
-
+	u, err := parseWebhookURL(link)
 	if err != nil {
 		return SetWebhookConf{}, err
 	}
@@ -303,11 +350,11 @@ func NewWebhook(link string) (SetWebhookConf, error) {
 
 // NewWebhookWithCert creates a new webhook with a certificate.
 //
-// link is the url you wish to get webhooks,
+// link is the url you wish to get webhooks, it must use HTTPS,
 // file contains a string to a file, FileReader, or FileBytes.
+// The certificate is uploaded with the request, use it for self-signed certificates.
 func NewWebhookWithCert(link string, file RequestFileData) (SetWebhookConf, error) {
-	u, err := url.Parse(link)
-
+	u, err := parseWebhookURL(link)
 	if err != nil {
 		return SetWebhookConf{}, err
 	}
@@ -318,6 +365,59 @@ func NewWebhookWithCert(link string, file RequestFileData) (SetWebhookConf, erro
 	}, nil
 }
 
+// parseWebhookURL parses the webhook link, Telegram only sends updates to HTTPS URLs.
+func parseWebhookURL(link string) (*url.URL, error) {
+	u, err := url.Parse(link)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("webhook URL must be an absolute HTTPS URL: %q", link)
+	}
+
+	return u, nil
+}
+
+// NewSelfSignedCert creates a self-signed certificate and key for the webhook.
+//
+// host is the domain or IP address of the webhook. Both values are PEM encoded.
+func NewSelfSignedCert(host string) (certPEM, keyPEM []byte, err error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template := x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(10, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = []string{host}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	return certPEM, keyPEM, nil
+}
+
 // NewInlineQueryResultArticle creates a new inline query article.
 func NewInlineQueryResultArticle(id, title, messageText string) InlineQueryResultArticle {
 	return InlineQueryResultArticle{
@@ -422,26 +522,23 @@ func NewInlineQueryResultCachedMPEG4GIF(id, Mpeg4FileID string) InlineQueryResul
 }
 
 // NewInlineQueryResultPhoto creates a new inline query photo.
-func NewInlineQueryResultPhoto(id, url string) InlineQueryResultPhoto {
+// The thumbnail URL is required by Telegram.
+func NewInlineQueryResultPhoto(id, url, thumbURL string) InlineQueryResultPhoto {
 	return InlineQueryResultPhoto{
 		InlineQueryResultBase: InlineQueryResultBase{
 			Type: "photo",
 			ID:   id,
 		},
-		URL: url,
+		URL:          url,
+		ThumbnailURL: thumbURL,
 	}
 }
 
 // NewInlineQueryResultPhotoWithThumb creates a new inline query photo.
+//
+// Deprecated: use NewInlineQueryResultPhoto.
 func NewInlineQueryResultPhotoWithThumb(id, url, thumb string) InlineQueryResultPhoto {
-	return InlineQueryResultPhoto{
-		InlineQueryResultBase: InlineQueryResultBase{
-			Type: "photo",
-			ID:   id,
-		},
-		URL:          url,
-		ThumbnailURL: thumb,
-	}
+	return NewInlineQueryResultPhoto(id, url, thumb)
 }
 
 // NewInlineQueryResultCachedPhoto create a new inline query with cached photo.
@@ -588,6 +685,42 @@ func NewInlineQueryResultVenue(id, title, address string, latitude, longitude fl
 	}
 }
 
+// NewInlineQueryResultContact creates a new inline query contact.
+func NewInlineQueryResultContact(id, phoneNumber, firstName string) InlineQueryResultContact {
+	return InlineQueryResultContact{
+		InlineQueryResultBase: InlineQueryResultBase{
+			Type: "contact",
+			ID:   id,
+		},
+		PhoneNumber: phoneNumber,
+		FirstName:   firstName,
+	}
+}
+
+// NewInlineQueryResultGame creates a new inline query game.
+func NewInlineQueryResultGame(id, gameShortName string) InlineQueryResultGame {
+	return InlineQueryResultGame{
+		InlineQueryResultBase: InlineQueryResultBase{
+			Type: "game",
+			ID:   id,
+		},
+		GameShortName: gameShortName,
+	}
+}
+
+// NewAnswerInlineQuery creates a new answer to the inline query with the results.
+// Results are created by the NewInlineQueryResult* functions.
+func NewAnswerInlineQuery(queryID string, results ...interface{}) AnswerInlineQueryConf {
+	if results == nil {
+		results = []interface{}{}
+	}
+
+	return AnswerInlineQueryConf{
+		InlineQueryID: queryID,
+		Results:       results,
+	}
+}
+
 // NewEditMessageText allows you to edit the text of a message.
 func NewEditMessageText(chatID int, messageID int, text string) EditMessageTextConf {
 	return EditMessageTextConf{
@@ -697,6 +830,15 @@ func NewOneTimeReplyKeyboard(rows ...[]KeyboardButton) ReplyKeyboardMarkup {
 	return markup
 }
 
+// NewWebAppReplyKeyboard creates a regular keyboard with a button
+// launching the Web App below the rows.
+//
+// Web App keyboard buttons only work in private chats.
+func NewWebAppReplyKeyboard(text, url string, rows ...[]KeyboardButton) ReplyKeyboardMarkup {
+	button := NewKeyboardButtonWebApp(text, WebAppInfo{URL: url})
+	return NewReplyKeyboard(append(rows, NewKeyboardButtonRow(button))...)
+}
+
 // NewInlineKeyboardButtonData creates an inline keyboard button with text
 // and data for a callback.
 func NewInlineKeyboardButtonData(text, data string) InlineKeyboardButton {
@@ -962,12 +1104,88 @@ func NewDeleteMyCommandsWithScopeAndLanguage(scope BotCommandScope, languageCode
 	return DeleteMyCommandsConf{Scope: &scope, LanguageCode: languageCode}
 }
 
+// NewSetChatMenuButtonCommands allows you to show the list of bot commands as the menu button
+// of the private chat, 0 changes the default menu button.
+func NewSetChatMenuButtonCommands(chatID int) SetChatMenuButtonConf {
+	return SetChatMenuButtonConf{ChatID: chatID, MenuButton: &MenuButton{Type: "commands"}}
+}
+
+// NewSetChatMenuButtonWebApp allows you to launch a Web App from the menu button
+// of the private chat, 0 changes the default menu button.
+func NewSetChatMenuButtonWebApp(chatID int, text, url string) SetChatMenuButtonConf {
+	return SetChatMenuButtonConf{ChatID: chatID, MenuButton: &MenuButton{Type: "web_app", Text: text, WebApp: &WebAppInfo{URL: url}}}
+}
+
+// NewSetChatMenuButtonDefault allows you to reset the menu button of the private chat to the default one.
+func NewSetChatMenuButtonDefault(chatID int) SetChatMenuButtonConf {
+	return SetChatMenuButtonConf{ChatID: chatID, MenuButton: &MenuButton{Type: "default"}}
+}
+
+// NewRestrict restricts the user in the supergroup to the permissions.
+//
+// Empty permissions mute the user, use Until to lift the restriction at a date.
+func NewRestrict(chatID, userID int, perms ChatPermissions) RestrictChatMemberConf {
+	return RestrictChatMemberConf{ChatID: chatID, UserID: userID, Permissions: perms}
+}
+
+// RestrictedPermissions returns permissions which allow nothing, NewRestrict with them mutes the user.
+func RestrictedPermissions() ChatPermissions {
+	return ChatPermissions{}
+}
+
+// FullPermissions returns permissions which allow everything, NewRestrict with them lifts the restrictions.
+//
+// Rights the chat itself doesn't grant still don't apply to the user.
+func FullPermissions() ChatPermissions {
+	return ChatPermissions{
+		CanSendMessages:       true,
+		CanSendAudios:         true,
+		CanSendDocuments:      true,
+		CanSendPhotos:         true,
+		CanSendVideos:         true,
+		CanSendVideoNotes:     true,
+		CanSendVoiceNotes:     true,
+		CanSendPolls:          true,
+		CanSendOtherMessages:  true,
+		CanAddWebPagePreviews: true,
+		CanChangeInfo:         true,
+		CanInviteUsers:        true,
+		CanPinMessages:        true,
+		CanManageTopics:       true,
+	}
+}
+
+// NewPromote promotes the user to an administrator without rights, add them with the With setters.
+//
+// A promotion without rights demotes the administrator.
+func NewPromote(chatID, userID int) PromoteChatMemberConf {
+	return PromoteChatMemberConf{ChatID: chatID, UserID: userID}
+}
+
 // ValidateWebAppData validate data received via the Web App
 // https://core.telegram.org/bots/webapps#validating-data-received-via-the-web-app
 func ValidateWebAppData(token, telegramInitData string) (bool, error) {
+	_, err := parseWebAppData(token, telegramInitData)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// ValidateWebAppData checks the signature of the Web App init data with the bot token
+// and returns its fields only if the data was signed by Telegram.
+// https://core.telegram.org/bots/webapps#validating-data-received-via-the-web-app
+func (client *Client) ValidateWebAppData(initData string) (url.Values, error) {
+	return parseWebAppData(client.Token, initData)
+}
+
+// parseWebAppData parses the init data and compares its "hash" with the HMAC-SHA256
+// of the sorted "key=value" lines, the key is the HMAC-SHA256 of the token keyed with "WebAppData".
+func parseWebAppData(token, telegramInitData string) (url.Values, error) {
 	initData, err := url.ParseQuery(telegramInitData)
 	if err != nil {
-		return false, fmt.Errorf("error parsing data %w", err)
+		return nil, fmt.Errorf("error parsing data %w", err)
 	}
 
 	dataCheckString := make([]string, 0, len(initData))
@@ -988,11 +1206,10 @@ func ValidateWebAppData(token, telegramInitData string) (bool, error) {
 	hHash := hmac.New(sha256.New, secret.Sum(nil))
 	hHash.Write([]byte(strings.Join(dataCheckString, "\n")))
 
-	hash := hex.EncodeToString(hHash.Sum(nil))
-
-	if initData.Get("hash") != hash {
-		return false, errors.New("hash not equal")
+	hash, err := hex.DecodeString(initData.Get("hash"))
+	if err != nil || !hmac.Equal(hash, hHash.Sum(nil)) {
+		return nil, errors.New("hash not equal")
 	}
 
-	return true, nil
+	return initData, nil
 }
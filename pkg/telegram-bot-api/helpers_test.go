@@ -0,0 +1,98 @@
+package telegram
+
+import (
+	"encoding/json"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// randomText returns a string of random code points from all planes, surrogates excluded
+func randomText(r *rand.Rand, n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		var c rune
+		switch r.Intn(4) {
+		case 0:
+			c = rune(r.Intn(0x80))
+		case 1:
+			c = rune(0x80 + r.Intn(0xD800-0x80))
+		case 2:
+			c = rune(0xE000 + r.Intn(0x10000-0xE000))
+		default:
+			c = rune(0x10000 + r.Intn(0x110000-0x10000))
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+func TestUTF16LenMatchesEncoder(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		s := randomText(r, r.Intn(200))
+		if got, want := UTF16Len(s), len(utf16.Encode([]rune(s))); got != want {
+			t.Fatalf("UTF16Len(%q) = %d, want %d", s, got, want)
+		}
+	}
+}
+
+func TestUTF16LenInvalidUTF8(t *testing.T) {
+	s := "a\xffb"
+	if got, want := UTF16Len(s), len(utf16.Encode([]rune(s))); got != want {
+		t.Fatalf("UTF16Len(%q) = %d, want %d", s, got, want)
+	}
+}
+
+func TestNewWebAppReplyKeyboard(t *testing.T) {
+	markup := NewWebAppReplyKeyboard("Form", "https://forms.example.com", NewKeyboardButtonRow(NewKeyboardButton("Question")))
+	data, err := json.Marshal(markup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"keyboard":[[{"text":"Question"}],[{"text":"Form","web_app":{"url":"https://forms.example.com"}}]],`
+	if !strings.HasPrefix(string(data), want) || !strings.Contains(string(data), `"resize_keyboard":true`) {
+		t.Fatalf("keyboard = %s, want %s", data, want)
+	}
+	if only := NewWebAppReplyKeyboard("Form", "https://forms.example.com"); len(only.Keyboard) != 1 || only.Keyboard[0][0].WebApp == nil {
+		t.Fatalf("keyboard without rows = %+v", only.Keyboard)
+	}
+}
+
+func TestPermissionConstructors(t *testing.T) {
+	restricted, full := reflect.ValueOf(RestrictedPermissions()), reflect.ValueOf(FullPermissions())
+	for i := 0; i < full.NumField(); i++ {
+		name := full.Type().Field(i).Name
+		if full.Field(i).Kind() != reflect.Bool {
+			t.Fatalf("%s is not a bool, update the constructors", name)
+		}
+		if !full.Field(i).Bool() {
+			t.Errorf("FullPermissions().%s = false", name)
+		}
+		if restricted.Field(i).Bool() {
+			t.Errorf("RestrictedPermissions().%s = true", name)
+		}
+	}
+	if data, _ := json.Marshal(NewRestrict(-100, 42, RestrictedPermissions())); !strings.Contains(string(data), `"permissions":{}`) {
+		t.Fatalf("mute = %s", data)
+	}
+}
+
+func TestNewCallbackAlert(t *testing.T) {
+	m := newMockServer(t)
+	client := m.client(t)
+	for _, config := range []AnswerCallbackQueryConf{NewCallback("q1", "Saved"), NewCallbackWithAlert("q2", "Question already taken")} {
+		if _, err := client.Request(config); err != nil {
+			t.Fatal(err)
+		}
+	}
+	calls := m.calls("answerCallbackQuery")
+	if body := string(calls[0].Body); body != `{"callback_query_id":"q1","text":"Saved"}` {
+		t.Fatalf("callback = %s", body)
+	}
+	if body := string(calls[1].Body); body != `{"callback_query_id":"q2","text":"Question already taken","show_alert":true}` {
+		t.Fatalf("alert = %s", body)
+	}
+}
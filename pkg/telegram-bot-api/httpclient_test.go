@@ -0,0 +1,72 @@
+package telegram
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordingTransport answers Bot API requests without a network and records their URLs
+type recordingTransport struct {
+	mu   sync.Mutex
+	urls []string
+}
+
+func (rt *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt.mu.Lock()
+	rt.urls = append(rt.urls, req.URL.String())
+	rt.mu.Unlock()
+	body := `{"ok":true,"result":true}`
+	switch {
+	case strings.HasSuffix(req.URL.Path, "/getMe"):
+		body = mockGetMe
+	case strings.HasSuffix(req.URL.Path, "/getFile"):
+		body = `{"ok":true,"result":{"file_id":"f1","file_unique_id":"u1","file_path":"photos/file_1.jpg"}}`
+	case strings.HasPrefix(req.URL.Path, "/file/"):
+		body = "image"
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}, nil
+}
+
+func TestNewClientWithHTTPClientUsesIt(t *testing.T) {
+	transport := &recordingTransport{}
+	client, err := NewClientWithHTTPClient("token", &http.Client{Transport: transport})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.Self.UserName != "test_bot" {
+		t.Fatalf("Self = %+v", client.Self)
+	}
+	file, err := client.GetFile(GetFileConf{FileID: "f1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := client.DownloadFile(file)
+	if err != nil || string(data) != "image" {
+		t.Fatalf("DownloadFile = %q, %v", data, err)
+	}
+	want := []string{
+		"https://api.telegram.org/bottoken/getMe",
+		"https://api.telegram.org/bottoken/getFile",
+		"https://api.telegram.org/file/bottoken/photos/file_1.jpg",
+	}
+	if strings.Join(transport.urls, " ") != strings.Join(want, " ") {
+		t.Fatalf("requests = %v", transport.urls)
+	}
+}
+
+func TestDefaultClientHasTimeout(t *testing.T) {
+	m := newMockServer(t)
+	client := m.client(t)
+	httpClient, ok := client.Client.(*http.Client)
+	if !ok || httpClient.Timeout != DefaultHTTPTimeout {
+		t.Fatalf("client = %#v", client.Client)
+	}
+}
@@ -0,0 +1,93 @@
+package telegram
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestInlineQueryResultsHaveType(t *testing.T) {
+	tests := []struct {
+		result interface{}
+		want   string
+	}{
+		{NewInlineQueryResultArticle("1", "title", "text"), "article"},
+		{NewInlineQueryResultArticleHTML("1", "title", "<b>text</b>"), "article"},
+		{NewInlineQueryResultGIF("1", "https://example.com/a.gif"), "gif"},
+		{NewInlineQueryResultCachedGIF("1", "gif"), "gif"},
+		{NewInlineQueryResultMPEG4GIF("1", "https://example.com/a.mp4"), "mpeg4_gif"},
+		{NewInlineQueryResultCachedMPEG4GIF("1", "mp4"), "mpeg4_gif"},
+		{NewInlineQueryResultPhoto("1", "https://example.com/a.jpg", "https://example.com/thumb.jpg"), "photo"},
+		{NewInlineQueryResultCachedPhoto("1", "photo"), "photo"},
+		{NewInlineQueryResultVideo("1", "https://example.com/a.mp4"), "video"},
+		{NewInlineQueryResultCachedVideo("1", "video", "title"), "video"},
+		{NewInlineQueryResultCachedSticker("1", "sticker"), "sticker"},
+		{NewInlineQueryResultAudio("1", "https://example.com/a.mp3", "title"), "audio"},
+		{NewInlineQueryResultCachedAudio("1", "audio"), "audio"},
+		{NewInlineQueryResultVoice("1", "https://example.com/a.ogg", "title"), "voice"},
+		{NewInlineQueryResultCachedVoice("1", "voice", "title"), "voice"},
+		{NewInlineQueryResultDocument("1", "https://example.com/a.pdf", "title", "application/pdf"), "document"},
+		{NewInlineQueryResultCachedDocument("1", "document", "title"), "document"},
+		{NewInlineQueryResultLocation("1", "title", 55.75, 37.62), "location"},
+		{NewInlineQueryResultVenue("1", "title", "address", 55.75, 37.62), "venue"},
+		{NewInlineQueryResultContact("1", "+100", "Ann"), "contact"},
+		{NewInlineQueryResultGame("1", "game"), "game"},
+	}
+	for _, test := range tests {
+		data, err := json.Marshal(test.result)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var fields struct {
+			Type string `json:"type"`
+			ID   string `json:"id"`
+		}
+		if err := json.Unmarshal(data, &fields); err != nil {
+			t.Fatal(err)
+		}
+		if fields.Type != test.want || fields.ID != "1" {
+			t.Errorf("%T = %s, want type %q and id \"1\"", test.result, data, test.want)
+		}
+	}
+}
+
+func TestAnswerInlineQuerySendsResults(t *testing.T) {
+	m := newMockServer(t)
+	answer := NewAnswerInlineQuery("query", NewInlineQueryResultArticle("a", "Article", "text"), NewInlineQueryResultCachedPhoto("p", "photo"))
+	answer.CacheTime = 60
+	if _, err := m.client(t).Request(answer); err != nil {
+		t.Fatal(err)
+	}
+	calls := m.calls("answerInlineQuery")
+	if len(calls) != 1 {
+		t.Fatalf("answerInlineQuery calls = %d", len(calls))
+	}
+	var body struct {
+		InlineQueryID string `json:"inline_query_id"`
+		CacheTime     int    `json:"cache_time"`
+		Results       []struct {
+			Type string `json:"type"`
+			ID   string `json:"id"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(calls[0].Body, &body); err != nil {
+		t.Fatalf("body %s: %v", calls[0].Body, err)
+	}
+	if body.InlineQueryID != "query" || body.CacheTime != 60 || len(body.Results) != 2 ||
+		body.Results[0].Type != "article" || body.Results[0].ID != "a" || body.Results[1].Type != "photo" || body.Results[1].ID != "p" {
+		t.Fatalf("body = %s", calls[0].Body)
+	}
+}
+
+func TestAnswerInlineQueryLimitsResults(t *testing.T) {
+	m := newMockServer(t)
+	results := make([]interface{}, MaxInlineQueryResults+1)
+	for i := range results {
+		results[i] = NewInlineQueryResultCachedSticker("s", "sticker")
+	}
+	if _, err := m.client(t).Request(NewAnswerInlineQuery("query", results...)); err == nil {
+		t.Fatal("too many results are sent")
+	}
+	if len(m.calls("answerInlineQuery")) != 0 {
+		t.Fatal("answerInlineQuery is called with too many results")
+	}
+}
@@ -0,0 +1,58 @@
+package telegram
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestChatMenuButtonConstructors(t *testing.T) {
+	tests := []struct {
+		name string
+		conf SetChatMenuButtonConf
+		want string
+	}{
+		{"commands", NewSetChatMenuButtonCommands(5), `{"chat_id":5,"menu_button":{"type":"commands"}}`},
+		{"web app", NewSetChatMenuButtonWebApp(5, "Open", "https://example.com/app"), `{"chat_id":5,"menu_button":{"type":"web_app","text":"Open","web_app":{"url":"https://example.com/app"}}}`},
+		{"default for all chats", NewSetChatMenuButtonDefault(0), `{"menu_button":{"type":"default"}}`},
+	}
+	for _, tt := range tests {
+		m := newMockServer(t)
+		if _, err := m.client(t).Request(tt.conf); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if calls := m.calls("setChatMenuButton"); len(calls) != 1 || string(calls[0].Body) != tt.want {
+			t.Errorf("%s: requests = %+v, want the body %s", tt.name, calls, tt.want)
+		}
+	}
+}
+
+func TestGetChatMenuButton(t *testing.T) {
+	m := newMockServer(t)
+	m.respond("getChatMenuButton", `{"ok":true,"result":{"type":"web_app","text":"Open","web_app":{"url":"https://example.com/app"}}}`)
+	button, err := m.client(t).GetChatMenuButton(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := MenuButton{Type: "web_app", Text: "Open", WebApp: &WebAppInfo{URL: "https://example.com/app"}}
+	if !reflect.DeepEqual(button, want) {
+		t.Fatalf("button = %+v, want %+v", button, want)
+	}
+	if body := string(m.calls("getChatMenuButton")[0].Body); body != `{"chat_id":5}` {
+		t.Fatalf("body = %s", body)
+	}
+}
+
+func TestGetDefaultChatMenuButton(t *testing.T) {
+	m := newMockServer(t)
+	m.respond("getChatMenuButton", `{"ok":true,"result":{"type":"commands"}}`)
+	button, err := m.client(t).GetChatMenuButton(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if button.Type != "commands" || button.Text != "" || button.WebApp != nil {
+		t.Fatalf("button = %+v, want the commands button", button)
+	}
+	if body := string(m.calls("getChatMenuButton")[0].Body); body != `{}` {
+		t.Fatalf("body = %s, the default button is requested without a chat", body)
+	}
+}
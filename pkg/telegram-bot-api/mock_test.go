@@ -0,0 +1,117 @@
+package telegram
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// mockGetMe is the getMe response of the mock server
+const mockGetMe = `{"ok":true,"result":{"id":1,"is_bot":true,"first_name":"Test","username":"test_bot"}}`
+
+// mockMessage is the sendMessage response of the mock server
+const mockMessage = `{"ok":true,"result":{"message_id":7,"date":0,"chat":{"id":5,"type":"private"}}}`
+
+// mockRequest is a request the mock server received
+type mockRequest struct {
+	Method      string
+	ContentType string
+	Body        []byte
+}
+
+// part returns the multipart form part by name, ok is false if the request has none
+func (r mockRequest) part(name string) (string, bool) {
+	mediaType, params, err := mime.ParseMediaType(r.ContentType)
+	if err != nil || mediaType != "multipart/form-data" {
+		return "", false
+	}
+	reader := multipart.NewReader(bytes.NewReader(r.Body), params["boundary"])
+	for {
+		p, err := reader.NextPart()
+		if err != nil {
+			return "", false
+		}
+		if p.FormName() == name {
+			data, _ := io.ReadAll(p)
+			return string(data), true
+		}
+	}
+}
+
+// mockServer is a Bot API server answering methods with canned responses
+//
+// Methods without a response answer {"ok":true,"result":true}
+type mockServer struct {
+	*httptest.Server
+	mu        sync.Mutex
+	responses map[string][]string // queued responses by method, the last one repeats
+	requests  []mockRequest
+}
+
+// newMockServer starts the server, it is closed with the test
+func newMockServer(t *testing.T) *mockServer {
+	m := &mockServer{responses: map[string][]string{"getMe": {mockGetMe}}}
+	m.Server = httptest.NewServer(http.HandlerFunc(m.serve))
+	t.Cleanup(m.Close)
+	return m
+}
+
+// respond queues the responses of the method
+func (m *mockServer) respond(method string, bodies ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.responses[method] = bodies
+}
+
+// calls returns the requests of the method
+func (m *mockServer) calls(method string) []mockRequest {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var result []mockRequest
+	for _, r := range m.requests {
+		if r.Method == method {
+			result = append(result, r)
+		}
+	}
+	return result
+}
+
+// client returns a Client of the server
+func (m *mockServer) client(t *testing.T, opts ...Option) *Client {
+	client, err := NewWithHost("token", m.URL+"/", opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func (m *mockServer) serve(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	method := path.Base(r.URL.Path)
+	m.mu.Lock()
+	m.requests = append(m.requests, mockRequest{Method: method, ContentType: r.Header.Get("Content-Type"), Body: body})
+	response := `{"ok":true,"result":true}`
+	if queued := m.responses[method]; len(queued) > 0 {
+		response = queued[0]
+		if len(queued) > 1 {
+			m.responses[method] = queued[1:]
+		}
+	}
+	m.mu.Unlock()
+	if status, rest, found := strings.Cut(response, " "); found && len(status) == 3 && status[0] >= '1' && status[0] <= '5' {
+		// "502 <body>" answers with the status code
+		code := int(status[0]-'0')*100 + int(status[1]-'0')*10 + int(status[2]-'0')
+		w.WriteHeader(code)
+		w.Write([]byte(rest))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(response))
+}
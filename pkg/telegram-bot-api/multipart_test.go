@@ -0,0 +1,59 @@
+package telegram
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestUploadEncodesStructuredFieldsAsJSON(t *testing.T) {
+	m := newMockServer(t)
+	m.respond("sendPhoto", mockMessage)
+	photo := NewPhoto(1, FileBytes{Name: "screen.png", Bytes: []byte("png")})
+	photo.Caption = "broken screen"
+	photo.CaptionEntities = []MessageEntity{{Type: "bold", Offset: 0, Length: 6}}
+	photo.ReplyMarkup = NewInlineKeyboardMarkup(NewInlineKeyboardRow(NewInlineKeyboardButtonData("Take", "take:1")))
+	if _, err := m.client(t).Send(&photo); err != nil {
+		t.Fatal(err)
+	}
+	calls := m.calls("sendPhoto")
+	if len(calls) != 1 {
+		t.Fatalf("sendPhoto calls = %d", len(calls))
+	}
+	if file, ok := calls[0].part("photo"); !ok || file != "png" {
+		t.Fatalf("photo = %q, %t", file, ok)
+	}
+
+	field, ok := calls[0].part("reply_markup")
+	if !ok {
+		t.Fatal("the keyboard is dropped")
+	}
+	var markup InlineKeyboardMarkup
+	if err := json.Unmarshal([]byte(field), &markup); err != nil {
+		t.Fatalf("reply_markup %q is not JSON: %v", field, err)
+	}
+	if len(markup.InlineKeyboard) != 1 || len(markup.InlineKeyboard[0]) != 1 || markup.InlineKeyboard[0][0].Text != "Take" ||
+		markup.InlineKeyboard[0][0].CallbackData == nil || *markup.InlineKeyboard[0][0].CallbackData != "take:1" {
+		t.Fatalf("reply_markup = %s", field)
+	}
+
+	field, ok = calls[0].part("caption_entities")
+	var entities []MessageEntity
+	if !ok || json.Unmarshal([]byte(field), &entities) != nil || len(entities) != 1 || entities[0].Type != "bold" || entities[0].Length != 6 {
+		t.Fatalf("caption_entities = %q, %t", field, ok)
+	}
+	if caption, _ := calls[0].part("caption"); caption != "broken screen" {
+		t.Fatalf("caption = %q", caption)
+	}
+}
+
+func TestUploadWithoutKeyboardHasNoReplyMarkup(t *testing.T) {
+	m := newMockServer(t)
+	m.respond("sendPhoto", mockMessage)
+	photo := NewPhoto(1, FileBytes{Name: "screen.png", Bytes: []byte("png")})
+	if _, err := m.client(t).Send(&photo); err != nil {
+		t.Fatal(err)
+	}
+	if field, ok := m.calls("sendPhoto")[0].part("reply_markup"); ok {
+		t.Fatalf("reply_markup = %q, want none", field)
+	}
+}
@@ -0,0 +1,168 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Telegram limits for sending messages.
+const (
+	DefaultGlobalRate   = 30          // messages per second to all chats
+	DefaultChatInterval = time.Second // interval between messages to one chat
+)
+
+// Rate limiter settings.
+const (
+	// chatBurst is how many messages a chat gets at once, e.g. a reply and a menu, before pacing starts.
+	chatBurst = 3
+	// rateLimiterPrune is the number of chat buckets after which idle ones are removed.
+	rateLimiterPrune = 1000
+)
+
+// bucket is a token bucket stored as the theoretical time of the next free token.
+type bucket struct {
+	next time.Time
+}
+
+// reserve takes a token and returns how long to wait for it.
+//
+// Up to burst tokens are available at once, then one every interval.
+func (b *bucket) reserve(now time.Time, interval time.Duration, burst int) time.Duration {
+	if b.next.Before(now) {
+		b.next = now
+	}
+	wait := b.next.Sub(now) - time.Duration(burst-1)*interval
+	if wait < 0 {
+		wait = 0
+	}
+	b.next = b.next.Add(interval)
+	return wait
+}
+
+// release gives back the last token taken by reserve.
+func (b *bucket) release(interval time.Duration) {
+	b.next = b.next.Add(-interval)
+}
+
+// RateLimiter paces outgoing messages with a token bucket per chat and one for all chats.
+type RateLimiter struct {
+	mu             sync.Mutex
+	globalInterval time.Duration
+	globalBurst    int
+	chatInterval   time.Duration
+	global         bucket
+	chats          map[string]*bucket
+	now            func() time.Time
+}
+
+// NewRateLimiter returns a RateLimiter allowing globalRate messages per second
+// and one message per chatInterval to each chat after a short burst.
+func NewRateLimiter(globalRate int, chatInterval time.Duration) *RateLimiter {
+	if globalRate <= 0 {
+		globalRate = DefaultGlobalRate
+	}
+	return &RateLimiter{
+		globalInterval: time.Second / time.Duration(globalRate),
+		globalBurst:    globalRate,
+		chatInterval:   chatInterval,
+		chats:          map[string]*bucket{},
+		now:            time.Now,
+	}
+}
+
+// reserve takes the tokens of the chat and returns how long to wait for them.
+func (r *RateLimiter) reserve(chatID string) time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.now()
+	wait := r.global.reserve(now, r.globalInterval, r.globalBurst)
+	if chatID == "" || r.chatInterval <= 0 {
+		return wait
+	}
+	if len(r.chats) >= rateLimiterPrune {
+		for id, b := range r.chats {
+			if b.next.Before(now) {
+				delete(r.chats, id)
+			}
+		}
+	}
+	b, ok := r.chats[chatID]
+	if !ok {
+		b = &bucket{}
+		r.chats[chatID] = b
+	}
+	if chatWait := b.reserve(now, r.chatInterval, chatBurst); chatWait > wait {
+		wait = chatWait
+	}
+	return wait
+}
+
+// cancel gives back the tokens of a message which was not sent.
+func (r *RateLimiter) cancel(chatID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.global.release(r.globalInterval)
+	if b, ok := r.chats[chatID]; ok && r.chatInterval > 0 {
+		b.release(r.chatInterval)
+	}
+}
+
+// Wait blocks until a message may be sent to the chat, an empty chatID counts only for the global limit.
+//
+// If ctx is done first the tokens are given back, so a cancelled send doesn't delay the next ones.
+func (r *RateLimiter) Wait(ctx context.Context, chatID string) error {
+	wait := r.reserve(chatID)
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		r.cancel(chatID)
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// WithRateLimit makes the Client pace send methods: globalRate messages per second
+// and one message per chatInterval to each chat after a short burst.
+//
+// Use DefaultGlobalRate and DefaultChatInterval for the limits of Telegram.
+func WithRateLimit(globalRate int, chatInterval time.Duration) Option {
+	return func(client *Client) {
+		client.limiter = NewRateLimiter(globalRate, chatInterval)
+	}
+}
+
+// isSendMethod reports whether the method sends a message and counts toward the limits.
+func isSendMethod(method string) bool {
+	method = strings.TrimPrefix(method, "/")
+	if method == "sendChatAction" {
+		return false
+	}
+	return strings.HasPrefix(method, "send") || strings.HasPrefix(method, "copyMessage") || strings.HasPrefix(method, "forwardMessage")
+}
+
+// chatIDOf returns the chat_id of JSON params, empty if there is none.
+func chatIDOf(params []byte) string {
+	var target struct {
+		ChatID json.RawMessage `json:"chat_id"`
+	}
+	if json.Unmarshal(params, &target) != nil {
+		return ""
+	}
+	return strings.Trim(string(target.ChatID), `"`)
+}
+
+// pace waits for the rate limiter if the Client has one and the method sends a message.
+func (client *Client) pace(ctx context.Context, method, chatID string) error {
+	if client.limiter == nil || !isSendMethod(method) {
+		return nil
+	}
+	return client.limiter.Wait(ctx, chatID)
+}
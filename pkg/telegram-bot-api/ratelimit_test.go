@@ -0,0 +1,76 @@
+package telegram
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// fixedLimiter returns a RateLimiter whose clock stands still
+func fixedLimiter(globalRate int, chatInterval time.Duration) (*RateLimiter, time.Time) {
+	r := NewRateLimiter(globalRate, chatInterval)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	r.now = func() time.Time { return now }
+	return r, now
+}
+
+func TestRateLimiterSpacesMessagesToOneChat(t *testing.T) {
+	r, _ := fixedLimiter(1000, time.Second)
+	want := []time.Duration{0, 0, 0, time.Second, 2 * time.Second, 3 * time.Second}
+	for i, w := range want {
+		if got := r.reserve("5"); got != w {
+			t.Fatalf("message %d waits %v, want %v", i, got, w)
+		}
+	}
+	if got := r.reserve("6"); got != 0 {
+		t.Fatalf("another chat waits %v", got)
+	}
+}
+
+func TestRateLimiterGlobalRate(t *testing.T) {
+	r, _ := fixedLimiter(10, time.Second)
+	for i := 0; i < 10; i++ {
+		if got := r.reserve(""); got != 0 {
+			t.Fatalf("message %d of the burst waits %v", i, got)
+		}
+	}
+	if got := r.reserve(""); got != 100*time.Millisecond {
+		t.Fatalf("message after the burst waits %v, want 100ms", got)
+	}
+}
+
+func TestClientPacesMessages(t *testing.T) {
+	m := newMockServer(t)
+	m.respond("sendMessage", mockMessage)
+	client := m.client(t, WithRateLimit(1000, 30*time.Millisecond))
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		if _, err := client.Send(NewMessage(5, "hi")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The burst of 3 goes at once, then one message every 30ms
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Fatalf("6 messages took %v, want about 90ms", elapsed)
+	}
+}
+
+func TestRateLimiterCancelledWaitGivesTokensBack(t *testing.T) {
+	r, now := fixedLimiter(1000, time.Hour)
+	for i := 0; i < chatBurst; i++ {
+		r.reserve("5")
+	}
+	chatNext, globalNext := r.chats["5"].next, r.global.next
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := r.Wait(ctx, "5"); err != context.Canceled {
+		t.Fatalf("Wait = %v, want the context error", err)
+	}
+	if !r.chats["5"].next.Equal(chatNext) || !r.global.next.Equal(globalNext) {
+		t.Fatalf("next tokens at %v and %v, want %v and %v", r.chats["5"].next.Sub(now), r.global.next.Sub(now), chatNext.Sub(now), globalNext.Sub(now))
+	}
+	// The next message gets the slot of the cancelled one
+	if got := r.reserve("5"); got != time.Hour {
+		t.Fatalf("next message waits %v, want 1h", got)
+	}
+}
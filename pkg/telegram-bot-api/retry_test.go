@@ -0,0 +1,76 @@
+package telegram
+
+import (
+	"testing"
+	"time"
+)
+
+// fastRetries shortens the backoff for the test
+func fastRetries(t *testing.T) {
+	base, max := retryBaseDelay, retryMaxDelay
+	retryBaseDelay, retryMaxDelay = time.Millisecond, 5*time.Millisecond
+	t.Cleanup(func() { retryBaseDelay, retryMaxDelay = base, max })
+}
+
+func TestServerErrorsOfIdempotentMethodAreRetried(t *testing.T) {
+	fastRetries(t)
+	m := newMockServer(t)
+	m.respond("getChat", "502 <html>Bad Gateway</html>", `502 {"ok":false,"error_code":502,"description":"Bad Gateway"}`,
+		`{"ok":true,"result":{"id":5,"type":"private"}}`)
+	client := m.client(t)
+	if _, err := client.MakeRequest("getChat", map[string]int{"chat_id": 5}); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(m.calls("getChat")); got != 3 {
+		t.Fatalf("requests = %d, want two failures and the success", got)
+	}
+}
+
+func TestBadRequestIsNotRetried(t *testing.T) {
+	fastRetries(t)
+	m := newMockServer(t)
+	m.respond("getChat", `400 {"ok":false,"error_code":400,"description":"Bad Request: chat not found"}`, `{"ok":true,"result":true}`)
+	client := m.client(t)
+	if _, err := client.MakeRequest("getChat", map[string]int{"chat_id": 5}); err == nil {
+		t.Fatal("the error is lost")
+	}
+	if got := len(m.calls("getChat")); got != 1 {
+		t.Fatalf("requests = %d, 400 is not retried", got)
+	}
+}
+
+func TestServerErrorOfSendMessageIsNotRetried(t *testing.T) {
+	fastRetries(t)
+	m := newMockServer(t)
+	m.respond("sendMessage", `502 {"ok":false,"error_code":502,"description":"Bad Gateway"}`, mockMessage)
+	m.respond("copyMessage", "504 <html>Gateway Timeout</html>", `{"ok":true,"result":{"message_id":8}}`)
+	client := m.client(t)
+	if _, err := client.Send(NewMessage(5, "hi")); err == nil {
+		t.Fatal("the error is lost")
+	}
+	if _, err := client.CopyMessage(NewCopyMessage(5, 6, 7)); err == nil {
+		t.Fatal("the error of the copy is lost")
+	}
+	if got := len(m.calls("sendMessage")) + len(m.calls("copyMessage")); got != 2 {
+		t.Fatalf("requests = %d, the message could be delivered twice", got)
+	}
+}
+
+func TestTooManyRequestsOfSendMessageIsRetried(t *testing.T) {
+	m := newMockServer(t)
+	m.respond("sendMessage", `429 {"ok":false,"error_code":429,"description":"Too Many Requests: retry after 0","parameters":{"retry_after":0}}`, mockMessage)
+	client := m.client(t, WithRateLimit(1000, time.Hour))
+	if _, err := client.Send(NewMessage(5, "hi")); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(m.calls("sendMessage")); got != 2 {
+		t.Fatalf("requests = %d, want the retry after 429", got)
+	}
+	// Both attempts took a token of the chat: the next free one is two intervals away
+	client.limiter.mu.Lock()
+	next := client.limiter.chats["5"].next
+	client.limiter.mu.Unlock()
+	if wait := time.Until(next); wait < 90*time.Minute {
+		t.Fatalf("next token in %v, the retry is not paced", wait)
+	}
+}
@@ -0,0 +1,56 @@
+package telegram
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestThreadIDIsSent(t *testing.T) {
+	m := newMockServer(t)
+	m.respond("sendMessage", mockMessage)
+	m.respond("copyMessage", `{"ok":true,"result":{"message_id":3}}`)
+	m.respond("sendPhoto", mockMessage)
+	client := m.client(t)
+	if _, err := client.Send(NewMessageToThread(-100, 7, "hello")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Send(NewCopyMessage(-100, 1, 2).WithThread(8)); err != nil {
+		t.Fatal(err)
+	}
+	photo := NewPhoto(-100, FileBytes{Name: "screen.png", Bytes: []byte("png")}).WithThread(9)
+	if _, err := client.Send(&photo); err != nil {
+		t.Fatal(err)
+	}
+
+	for method, want := range map[string]float64{"sendMessage": 7, "copyMessage": 8} {
+		var body map[string]interface{}
+		if err := json.Unmarshal(m.calls(method)[0].Body, &body); err != nil {
+			t.Fatal(err)
+		}
+		if body["message_thread_id"] != want || body["chat_id"] != float64(-100) {
+			t.Fatalf("%s body = %v", method, body)
+		}
+	}
+	if thread, ok := m.calls("sendPhoto")[0].part("message_thread_id"); !ok || thread != "9" {
+		t.Fatalf("sendPhoto message_thread_id = %q, %t", thread, ok)
+	}
+}
+
+func TestWithoutThreadIDIsOmitted(t *testing.T) {
+	m := newMockServer(t)
+	m.respond("sendMessage", mockMessage)
+	message := NewMessage(-100, "hello")
+	if threaded := message.WithThread(7); threaded.MessageThreadID != 7 || message.MessageThreadID != 0 {
+		t.Fatal("WithThread changes the original config")
+	}
+	if _, err := m.client(t).Send(message); err != nil {
+		t.Fatal(err)
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(m.calls("sendMessage")[0].Body, &body); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := body["message_thread_id"]; ok {
+		t.Fatalf("body = %v", body)
+	}
+}
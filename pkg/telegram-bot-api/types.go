@@ -1,11 +1,17 @@
 package telegram
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
 	"net/url"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
+	"unicode/utf16"
 )
 
 // APIResponse is a response from the Telegram API with the result
@@ -30,6 +36,144 @@ func (e Error) Error() string {
 	return e.Message
 }
 
+// UnavailableError is returned when the Bot API answers with something other than JSON,
+// usually an HTML "502 Bad Gateway" page during Telegram maintenance. It is transient and retried.
+type UnavailableError struct {
+	StatusCode  int    // HTTP status code of the response
+	ContentType string // Content-Type of the response
+}
+
+// Error message string.
+func (e *UnavailableError) Error() string {
+	return "Telegram API unavailable: " + strconv.Itoa(e.StatusCode) + " " + http.StatusText(e.StatusCode)
+}
+
+// IsBlockedByUser reports whether the user has blocked the bot.
+func (e Error) IsBlockedByUser() bool {
+	return e.Code == http.StatusForbidden && strings.Contains(e.Message, "bot was blocked by the user")
+}
+
+// IsUserDeactivated reports whether the user has deleted the account.
+func (e Error) IsUserDeactivated() bool {
+	return e.Code == http.StatusForbidden && strings.Contains(e.Message, "user is deactivated")
+}
+
+// IsMessageNotFound reports whether the message to edit, delete, copy or forward does not exist.
+func (e Error) IsMessageNotFound() bool {
+	return e.Code == http.StatusBadRequest &&
+		(strings.Contains(e.Message, "message to ") && strings.HasSuffix(e.Message, " not found") ||
+			strings.Contains(e.Message, "message not found"))
+}
+
+// IsMessageNotModified reports whether the edit was refused because the new content equals the current one.
+func (e Error) IsMessageNotModified() bool {
+	return e.Code == http.StatusBadRequest && strings.Contains(e.Message, "message is not modified")
+}
+
+// IsChatNotFound reports whether the chat does not exist or the bot has no access to it.
+func (e Error) IsChatNotFound() bool {
+	return e.Code == http.StatusBadRequest && strings.Contains(e.Message, "chat not found")
+}
+
+// IsTooManyRequests reports whether the flood limit is exceeded, wait RetryAfter seconds before retrying.
+func (e Error) IsTooManyRequests() bool {
+	return e.Code == http.StatusTooManyRequests
+}
+
+// IsMessageToDeleteNotFound reports whether the message to delete was already deleted.
+func (e Error) IsMessageToDeleteNotFound() bool {
+	return e.Code == http.StatusBadRequest && strings.Contains(e.Message, "message to delete not found")
+}
+
+// Kinds of API errors, match them with errors.Is or the Is* functions below.
+var (
+	ErrBlockedByUser           = errors.New("bot was blocked by the user")
+	ErrUserDeactivated         = errors.New("user is deactivated")
+	ErrChatNotFound            = errors.New("chat not found")
+	ErrMessageNotFound         = errors.New("message not found")
+	ErrMessageToDeleteNotFound = errors.New("message to delete not found")
+	ErrMessageNotModified      = errors.New("message is not modified")
+	ErrTooManyRequests         = errors.New("too many requests")
+)
+
+// ErrEmptyText is returned without a request for a message or an edit without text,
+// which Telegram would reject with "message text is empty".
+var ErrEmptyText = errors.New("message text is empty")
+
+// Is reports whether the error is of the kind of target, one of the Err* values.
+func (e Error) Is(target error) bool {
+	switch target {
+	case ErrBlockedByUser:
+		return e.IsBlockedByUser()
+	case ErrUserDeactivated:
+		return e.IsUserDeactivated()
+	case ErrChatNotFound:
+		return e.IsChatNotFound()
+	case ErrMessageNotFound:
+		return e.IsMessageNotFound()
+	case ErrMessageToDeleteNotFound:
+		return e.IsMessageToDeleteNotFound()
+	case ErrMessageNotModified:
+		return e.IsMessageNotModified()
+	case ErrTooManyRequests:
+		return e.IsTooManyRequests()
+	}
+	return false
+}
+
+// AsError returns the API error in the chain of err.
+func AsError(err error) (*Error, bool) {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr, true
+	}
+	return nil, false
+}
+
+// IsBlockedByUser reports whether err is an API error because the user has blocked the bot.
+func IsBlockedByUser(err error) bool {
+	return errors.Is(err, ErrBlockedByUser)
+}
+
+// IsUserDeactivated reports whether err is an API error because the user has deleted the account.
+func IsUserDeactivated(err error) bool {
+	return errors.Is(err, ErrUserDeactivated)
+}
+
+// IsChatNotFound reports whether err is an API error because the chat does not exist.
+func IsChatNotFound(err error) bool {
+	return errors.Is(err, ErrChatNotFound)
+}
+
+// IsMessageNotFound reports whether err is an API error because the message does not exist.
+func IsMessageNotFound(err error) bool {
+	return errors.Is(err, ErrMessageNotFound)
+}
+
+// IsMessageToDeleteNotFound reports whether err is an API error because the message was already deleted.
+func IsMessageToDeleteNotFound(err error) bool {
+	return errors.Is(err, ErrMessageToDeleteNotFound)
+}
+
+// IsMessageNotModified reports whether err is an API error because the edit changes nothing.
+func IsMessageNotModified(err error) bool {
+	return errors.Is(err, ErrMessageNotModified)
+}
+
+// IsTooManyRequests reports whether err is an API flood limit error.
+func IsTooManyRequests(err error) bool {
+	return errors.Is(err, ErrTooManyRequests)
+}
+
+// RetryAfter returns how long Telegram asks to wait after the flood limit error, false for other errors.
+func RetryAfter(err error) (time.Duration, bool) {
+	apiErr, ok := AsError(err)
+	if !ok || !apiErr.IsTooManyRequests() {
+		return 0, false
+	}
+	return time.Duration(apiErr.RetryAfter) * time.Second, true
+}
+
 //
 //
 //
@@ -58,6 +202,74 @@ type Update struct {
 	ChatJoinRequest    *ChatJoinRequest    `json:"chat_join_request,omitempty"`    // Optional. Request to join the chat has been sent
 }
 
+// Update types, the values of allowed_updates in getUpdates and setWebhook
+const (
+	UpdateTypeMessage            = "message"
+	UpdateTypeEditedMessage      = "edited_message"
+	UpdateTypeChannelPost        = "channel_post"
+	UpdateTypeEditedChannelPost  = "edited_channel_post"
+	UpdateTypeInlineQuery        = "inline_query"
+	UpdateTypeChosenInlineResult = "chosen_inline_result"
+	UpdateTypeCallbackQuery      = "callback_query"
+	UpdateTypeShippingQuery      = "shipping_query"
+	UpdateTypePreCheckoutQuery   = "pre_checkout_query"
+	UpdateTypePoll               = "poll"
+	UpdateTypePollAnswer         = "poll_answer"
+	UpdateTypeMyChatMember       = "my_chat_member"
+	UpdateTypeChatMember         = "chat_member"
+	UpdateTypeChatJoinRequest    = "chat_join_request"
+)
+
+// Type returns the type of the update, "" if the update has no known field.
+func (u *Update) Type() string {
+	switch {
+	case u.Message != nil:
+		return UpdateTypeMessage
+	case u.EditedMessage != nil:
+		return UpdateTypeEditedMessage
+	case u.ChannelPost != nil:
+		return UpdateTypeChannelPost
+	case u.EditedChannelPost != nil:
+		return UpdateTypeEditedChannelPost
+	case u.InlineQuery != nil:
+		return UpdateTypeInlineQuery
+	case u.ChosenInlineResult != nil:
+		return UpdateTypeChosenInlineResult
+	case u.CallbackQuery != nil:
+		return UpdateTypeCallbackQuery
+	case u.ShippingQuery != nil:
+		return UpdateTypeShippingQuery
+	case u.PreCheckoutQuery != nil:
+		return UpdateTypePreCheckoutQuery
+	case u.Poll != nil:
+		return UpdateTypePoll
+	case u.PollAnswer != nil:
+		return UpdateTypePollAnswer
+	case u.MyChatMember != nil:
+		return UpdateTypeMyChatMember
+	case u.ChatMember != nil:
+		return UpdateTypeChatMember
+	case u.ChatJoinRequest != nil:
+		return UpdateTypeChatJoinRequest
+	default:
+		return ""
+	}
+}
+
+// EffectiveMessage returns the new or edited message or channel post of the update, nil if there is none.
+func (u *Update) EffectiveMessage() *Message {
+	switch {
+	case u.Message != nil:
+		return u.Message
+	case u.EditedMessage != nil:
+		return u.EditedMessage
+	case u.ChannelPost != nil:
+		return u.ChannelPost
+	default:
+		return u.EditedChannelPost
+	}
+}
+
 // SentFrom returns the user who sent an update. Can be nil, if Telegram did not provide information
 // about the user in the update object.
 func (u *Update) SentFrom() *User {
@@ -100,7 +312,7 @@ func (u *Update) FromChat() *Chat {
 		return u.ChannelPost.Chat
 	case u.EditedChannelPost != nil:
 		return u.EditedChannelPost.Chat
-	case u.CallbackQuery != nil:
+	case u.CallbackQuery != nil && u.CallbackQuery.Message != nil:
 		return u.CallbackQuery.Message.Chat
 	default:
 		return nil
@@ -117,6 +329,41 @@ func (ch UpdatesChannel) Clear() {
 	}
 }
 
+// Filter returns a channel of the updates for which pred returns true.
+//
+// A goroutine forwards the updates until ch is closed, then the returned channel is closed.
+// The returned channel has the buffer size of ch.
+func (ch UpdatesChannel) Filter(pred func(Update) bool) UpdatesChannel {
+	out := make(chan Update, cap(ch))
+	go func() {
+		defer close(out)
+		for update := range ch {
+			if pred(update) {
+				out <- update
+			}
+		}
+	}()
+	return out
+}
+
+// FilterByChatType returns a channel of the updates from chats of the types, e.g. "private".
+//
+// Updates without a chat, such as inline queries, are dropped.
+func (ch UpdatesChannel) FilterByChatType(types ...string) UpdatesChannel {
+	return ch.Filter(func(update Update) bool {
+		chat := update.FromChat()
+		if chat == nil {
+			return false
+		}
+		for _, t := range types {
+			if chat.Type == t {
+				return true
+			}
+		}
+		return false
+	})
+}
+
 // Describes the current status of a webhook.
 type WebhookInfo struct {
 	URL                          string   `json:"url"`                                       // Webhook URL
@@ -230,6 +477,15 @@ func (c Chat) IsChannel() bool {
 	return c.Type == "channel"
 }
 
+// Describes the options used for link preview generation.
+type LinkPreviewOptions struct {
+	IsDisabled       bool   `json:"is_disabled,omitempty"`        // Optional. True, if the link preview is disabled
+	URL              string `json:"url,omitempty"`                // Optional. URL to use for the link preview. If empty, then the first URL found in the message text will be used
+	PreferSmallMedia bool   `json:"prefer_small_media,omitempty"` // Optional. True, if the media in the link preview is supposed to be shrunk; ignored if the URL isn't explicitly specified or media size change isn't supported for the preview
+	PreferLargeMedia bool   `json:"prefer_large_media,omitempty"` // Optional. True, if the media in the link preview is supposed to be enlarged; ignored if the URL isn't explicitly specified or media size change isn't supported for the preview
+	ShowAboveText    bool   `json:"show_above_text,omitempty"`    // Optional. True, if the link preview must be shown above the message text; otherwise, the link preview will be shown below the message text
+}
+
 // This object represents a message.
 type Message struct {
 	MessageID                     int                            `json:"message_id"`                                  // Unique message identifier inside this chat
@@ -254,6 +510,7 @@ type Message struct {
 	AuthorSignature               string                         `json:"author_signature,omitempty"`                  // Optional. Signature of the post author for messages in channels, or the custom title of an anonymous group administrator
 	Text                          string                         `json:"text,omitempty"`                              // Optional. For text messages, the actual UTF-8 text of the message
 	Entities                      []*MessageEntity               `json:"entities,omitempty"`                          // Optional. For text messages, special entities like usernames, URLs, bot commands, etc. that appear in the text
+	LinkPreviewOptions            *LinkPreviewOptions            `json:"link_preview_options,omitempty"`              // Optional. For text messages, options used for link preview generation for the message, if it is a text message and link preview options were changed
 	Animation                     *Animation                     `json:"animation,omitempty"`                         // Optional. Message is an animation, information about the animation
 	Audio                         *Audio                         `json:"audio,omitempty"`                             // Optional. Message is an audio file, information about the file
 	Document                      *Document                      `json:"document,omitempty"`                          // Optional. Message is a general file, information about the file
@@ -310,6 +567,21 @@ func (m *Message) Time() time.Time {
 	return time.Unix(int64(m.Date), 0)
 }
 
+// IsForwarded returns true if the message was forwarded from another user or chat.
+func (m *Message) IsForwarded() bool {
+	return m.ForwardFrom != nil || m.ForwardFromChat != nil || m.ForwardSenderName != "" || m.ForwardDate != 0
+}
+
+// ForwardTime converts the original message's Unix timestamp into a Time.
+//
+// Returns the zero Time if the message is not forwarded.
+func (m *Message) ForwardTime() time.Time {
+	if m.ForwardDate == 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(m.ForwardDate), 0)
+}
+
 // IsCommand returns true if message starts with a "bot_command" entity.
 func (m *Message) IsCommand() bool {
 	if m.Entities == nil || len(m.Entities) == 0 {
@@ -374,6 +646,96 @@ func (m *Message) CommandArguments() string {
 	return m.Text[entity.Length+1:]
 }
 
+// StartPayload returns the deep link payload of a /start command and whether there is one.
+//
+// "/start ref123" yields "ref123", true; "/start" and other commands yield "", false.
+func (m *Message) StartPayload() (string, bool) {
+	if m.Command() != "start" {
+		return "", false
+	}
+	payload := strings.TrimSpace(m.CommandArguments())
+	return payload, payload != ""
+}
+
+// DecodeStartPayload decodes a base64url deep link payload, with or without padding.
+//
+// Deep links only allow A-Z, a-z, 0-9, _ and -, so binary or long values are sent base64url encoded.
+func DecodeStartPayload(payload string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(payload, "="))
+}
+
+// EntityText returns the part of the text or caption covered by the entity.
+// Offsets are counted in UTF-16 code units, out of range entities are clipped.
+//
+// Entities of the caption are sliced from the caption, all others from the text.
+func (m *Message) EntityText(e *MessageEntity) string {
+	text := m.Text
+	for _, entity := range m.CaptionEntities {
+		if entity == e {
+			text = m.Caption
+			break
+		}
+	}
+	if text == "" {
+		text = m.Caption
+	}
+	units := utf16.Encode([]rune(text))
+	start, end := e.Offset, e.Offset+e.Length
+	if start < 0 {
+		start = 0
+	}
+	if end > len(units) {
+		end = len(units)
+	}
+	if start >= end {
+		return ""
+	}
+	return string(utf16.Decode(units[start:end]))
+}
+
+// URLs returns the links of the message: the text of "url" entities and the targets of "text_link" entities.
+func (m *Message) URLs() []string {
+	var urls []string
+	for _, e := range m.allEntities() {
+		switch {
+		case e.IsURL():
+			urls = append(urls, m.EntityText(e))
+		case e.IsTextLink():
+			urls = append(urls, e.URL)
+		}
+	}
+	return urls
+}
+
+// Mentions returns the "@username" mentions of the message.
+func (m *Message) Mentions() []string {
+	var mentions []string
+	for _, e := range m.allEntities() {
+		if e.IsMention() {
+			mentions = append(mentions, m.EntityText(e))
+		}
+	}
+	return mentions
+}
+
+// Commands returns the bot commands of the message with the leading slash, e.g. "/start@jobs_bot".
+func (m *Message) Commands() []string {
+	var commands []string
+	for _, e := range m.allEntities() {
+		if e.IsCommand() {
+			commands = append(commands, m.EntityText(e))
+		}
+	}
+	return commands
+}
+
+// allEntities returns the entities of the text followed by the entities of the caption.
+func (m *Message) allEntities() []*MessageEntity {
+	entities := make([]*MessageEntity, 0, len(m.Entities)+len(m.CaptionEntities))
+	entities = append(entities, m.Entities...)
+	return append(entities, m.CaptionEntities...)
+}
+
 // This object represents a unique message identifier.
 type MessageId struct {
 	MessageID int `json:"message_id"` // Unique message identifier
@@ -390,6 +752,13 @@ type MessageEntity struct {
 	CustomEmojiID string `json:"custom_emoji_id,omitempty"` // Optional. Unique identifier of the custom emoji (for "custom_emoji" entities)
 }
 
+// This object describes the type of a reaction. Currently, it can be one of “emoji” or “custom_emoji”.
+type ReactionType struct {
+	Type          string `json:"type"`                      // Type of the reaction, “emoji” or “custom_emoji”
+	Emoji         string `json:"emoji,omitempty"`           // Reaction emoji (for “emoji” reactions)
+	CustomEmojiID string `json:"custom_emoji_id,omitempty"` // Custom emoji identifier (for “custom_emoji” reactions)
+}
+
 // ParseURL attempts to parse a URL contained within a MessageEntity.
 func (e MessageEntity) ParseURL() (*url.URL, error) {
 	if e.URL == "" {
@@ -706,10 +1075,19 @@ type File struct {
 // Link returns a full path to the download URL for a File.
 //
 // It requires the Bot token to create the link.
+// For local files (see IsLocal) the path on disk is returned.
 func (f *File) Link(client Client) string {
+	if f.IsLocal(client) {
+		return f.FilePath
+	}
 	return client.fileEndpoint + "/" + f.FilePath
 }
 
+// IsLocal reports whether the File is on the disk of a local Bot API server.
+func (f *File) IsLocal(client Client) bool {
+	return client.localMode && filepath.IsAbs(f.FilePath)
+}
+
 // Describes a Web App.
 type WebAppInfo struct {
 	URL string `json:"url"` // An HTTPS URL of a Web App to be opened with additional data as specified in Initializing Web Apps.
@@ -1453,10 +1831,11 @@ type InlineQueryResultCachedAudio struct {
 
 // This object represents the content of a message to be sent as a result of an inline query.
 type InputTextMessageContent struct {
-	MessageText           string          `json:"message_text"`                       // Text of the message to be sent, 1-4096 characters
-	ParseMode             string          `json:"parse_mode,omitempty"`               // Optional. Mode for parsing entities in the message text. See formatting options for more details.
-	Entities              []MessageEntity `json:"entities,omitempty"`                 // Optional. List of special entities that appear in message text, which can be specified instead of parse_mode
-	DisableWebPagePreview bool            `json:"disable_web_page_preview,omitempty"` // Optional. Disables link previews for links in the sent message
+	MessageText           string              `json:"message_text"`                       // Text of the message to be sent, 1-4096 characters
+	ParseMode             string              `json:"parse_mode,omitempty"`               // Optional. Mode for parsing entities in the message text. See formatting options for more details.
+	Entities              []MessageEntity     `json:"entities,omitempty"`                 // Optional. List of special entities that appear in message text, which can be specified instead of parse_mode
+	DisableWebPagePreview bool                `json:"disable_web_page_preview,omitempty"` // Deprecated: use LinkPreviewOptions. Disables link previews for links in the sent message
+	LinkPreviewOptions    *LinkPreviewOptions `json:"link_preview_options,omitempty"`     // Optional. Link preview generation options for the message
 }
 
 // This object represents the content of a message to be sent as a result of an inline query.
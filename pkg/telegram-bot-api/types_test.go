@@ -0,0 +1,182 @@
+package telegram
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestForwardedMessages(t *testing.T) {
+	tests := []struct {
+		name      string
+		json      string
+		forwarded bool
+		date      int64
+	}{
+		{"from user", `{"message_id":1,"date":1700000100,"chat":{"id":5,"type":"private"},"text":"hi",
+			"forward_from":{"id":7,"is_bot":false,"first_name":"Ann"},"forward_date":1700000000}`, true, 1700000000},
+		{"from channel", `{"message_id":2,"date":1700000100,"chat":{"id":5,"type":"private"},"text":"news",
+			"forward_from_chat":{"id":-1001,"type":"channel","title":"News"},"forward_from_message_id":40,"forward_date":1690000000}`, true, 1690000000},
+		{"from hidden user", `{"message_id":3,"date":1700000100,"chat":{"id":5,"type":"private"},"text":"hi",
+			"forward_sender_name":"Ann","forward_date":1700000050}`, true, 1700000050},
+		{"plain", `{"message_id":4,"date":1700000100,"chat":{"id":5,"type":"private"},"text":"hi"}`, false, 0},
+	}
+	for _, tt := range tests {
+		var message Message
+		if err := json.Unmarshal([]byte(tt.json), &message); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if message.IsForwarded() != tt.forwarded {
+			t.Errorf("%s: IsForwarded = %t", tt.name, message.IsForwarded())
+		}
+		want := time.Time{}
+		if tt.date != 0 {
+			want = time.Unix(tt.date, 0)
+		}
+		if got := message.ForwardTime(); !got.Equal(want) || got.IsZero() != (tt.date == 0) {
+			t.Errorf("%s: ForwardTime = %s, want %s", tt.name, got, want)
+		}
+	}
+	if !(&Message{ForwardSenderName: "Ann"}).IsForwarded() || !(&Message{ForwardDate: 1}).IsForwarded() {
+		t.Fatal("a message with one forward field is not forwarded")
+	}
+}
+
+// commandText returns the message with the command entity at the start of the text
+func commandText(text string) *Message {
+	length := len(text)
+	if i := strings.IndexByte(text, ' '); i != -1 {
+		length = i
+	}
+	return &Message{Text: text, Entities: []*MessageEntity{{Type: "bot_command", Offset: 0, Length: length}}}
+}
+
+func TestStartPayload(t *testing.T) {
+	tests := []struct {
+		message *Message
+		payload string
+		ok      bool
+	}{
+		{commandText("/start"), "", false},
+		{commandText("/start ref123"), "ref123", true},
+		{commandText("/start@feedback_bot promo_site"), "promo_site", true},
+		{commandText("/start   "), "", false},
+		{commandText("/help ref123"), "", false},
+		{&Message{Text: "start ref123"}, "", false},
+	}
+	for _, tt := range tests {
+		payload, ok := tt.message.StartPayload()
+		if payload != tt.payload || ok != tt.ok {
+			t.Errorf("%q: StartPayload = %q, %t, want %q, %t", tt.message.Text, payload, ok, tt.payload, tt.ok)
+		}
+	}
+}
+
+func TestDecodeStartPayload(t *testing.T) {
+	value := []byte("topic=billing&ref=42?")
+	for _, payload := range []string{base64.RawURLEncoding.EncodeToString(value), base64.URLEncoding.EncodeToString(value)} {
+		decoded, err := DecodeStartPayload(payload)
+		if err != nil || string(decoded) != string(value) {
+			t.Errorf("DecodeStartPayload(%q) = %q, %v", payload, decoded, err)
+		}
+	}
+	if encoded := base64.RawURLEncoding.EncodeToString([]byte{0xfb, 0xff}); encoded != "-_8" {
+		t.Fatalf("encoded = %q", encoded)
+	}
+	if decoded, err := DecodeStartPayload("-_8"); err != nil || string(decoded) != "\xfb\xff" {
+		t.Errorf("url alphabet = %x, %v", decoded, err)
+	}
+	for _, bad := range []string{"+/8", "a", "ref 123"} {
+		if _, err := DecodeStartPayload(bad); err == nil {
+			t.Errorf("DecodeStartPayload(%q) is decoded", bad)
+		}
+	}
+}
+
+// mixedUpdates returns a source channel with updates from a private chat, a group, a channel and without a chat
+func mixedUpdates() UpdatesChannel {
+	private := &Chat{ID: 1, Type: "private"}
+	updates := []Update{
+		{UpdateID: 1, Message: &Message{MessageID: 1, Chat: private}},
+		{UpdateID: 2, Message: &Message{MessageID: 2, Chat: &Chat{ID: -10, Type: "supergroup"}}},
+		{UpdateID: 3, ChannelPost: &Message{MessageID: 3, Chat: &Chat{ID: -20, Type: "channel"}}},
+		{UpdateID: 4, InlineQuery: &InlineQuery{ID: "q"}},
+		{UpdateID: 5, CallbackQuery: &CallbackQuery{ID: "inline", InlineMessageID: "m"}},
+		{UpdateID: 6, CallbackQuery: &CallbackQuery{ID: "c", Message: &Message{MessageID: 6, Chat: private}}},
+		{UpdateID: 7, EditedMessage: &Message{MessageID: 1, Chat: &Chat{ID: -30, Type: "group"}}},
+	}
+	ch := make(chan Update, len(updates))
+	for _, update := range updates {
+		ch <- update
+	}
+	close(ch)
+	return ch
+}
+
+// updateIDs reads the channel until it is closed
+func updateIDs(t *testing.T, ch UpdatesChannel) []int {
+	t.Helper()
+	var ids []int
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case update, ok := <-ch:
+			if !ok {
+				return ids
+			}
+			ids = append(ids, update.UpdateID)
+		case <-timeout:
+			t.Fatalf("the channel is not closed, got %v", ids)
+		}
+	}
+}
+
+func TestUpdatesChannelFilter(t *testing.T) {
+	even := mixedUpdates().Filter(func(update Update) bool { return update.UpdateID%2 == 0 })
+	if cap(even) != 7 {
+		t.Errorf("cap = %d, want the buffer of the source", cap(even))
+	}
+	if ids := updateIDs(t, even); !reflect.DeepEqual(ids, []int{2, 4, 6}) {
+		t.Fatalf("even updates = %v", ids)
+	}
+	tests := []struct {
+		types []string
+		want  []int
+	}{
+		{[]string{"private"}, []int{1, 6}},
+		{[]string{"group", "supergroup"}, []int{2, 7}},
+		{[]string{"channel"}, []int{3}},
+		{nil, nil},
+	}
+	for _, tt := range tests {
+		if ids := updateIDs(t, mixedUpdates().FilterByChatType(tt.types...)); !reflect.DeepEqual(ids, tt.want) {
+			t.Errorf("FilterByChatType(%q) = %v, want %v", tt.types, ids, tt.want)
+		}
+	}
+	chained := mixedUpdates().FilterByChatType("private").Filter(func(update Update) bool { return update.Message != nil })
+	if ids := updateIDs(t, chained); !reflect.DeepEqual(ids, []int{1}) {
+		t.Fatalf("chained filters = %v", ids)
+	}
+}
+
+func TestUpdatesChannelFilterForwardsLive(t *testing.T) {
+	source := make(chan Update)
+	private := UpdatesChannel(source).FilterByChatType("private")
+	source <- Update{UpdateID: 1, Message: &Message{Chat: &Chat{Type: "group"}}}
+	source <- Update{UpdateID: 2, Message: &Message{Chat: &Chat{Type: "private"}}}
+	select {
+	case update := <-private:
+		if update.UpdateID != 2 {
+			t.Fatalf("update = %d, want the private one", update.UpdateID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the update is not forwarded")
+	}
+	close(source)
+	if ids := updateIDs(t, private); len(ids) != 0 {
+		t.Fatalf("updates after closing = %v", ids)
+	}
+}
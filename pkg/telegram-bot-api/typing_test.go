@@ -0,0 +1,34 @@
+package telegram
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStartTypingRepeatsUntilStopped(t *testing.T) {
+	interval := TypingInterval
+	TypingInterval = 20 * time.Millisecond
+	t.Cleanup(func() { TypingInterval = interval })
+	m := newMockServer(t)
+	client := m.client(t)
+
+	stop := client.StartTyping(5)
+	deadline := time.Now().Add(time.Second)
+	for len(m.calls("sendChatAction")) < 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	stop()
+	stop()
+	calls := m.calls("sendChatAction")
+	if len(calls) < 3 {
+		t.Fatalf("%d chat actions in a second", len(calls))
+	}
+	if string(calls[0].Body) != `{"chat_id":5,"action":"typing"}` {
+		t.Fatalf("request = %s", calls[0].Body)
+	}
+	time.Sleep(5 * TypingInterval)
+	// The action in flight when stop was called may still arrive
+	if after := len(m.calls("sendChatAction")); after > len(calls)+1 {
+		t.Fatalf("%d chat actions after stop", after-len(calls))
+	}
+}
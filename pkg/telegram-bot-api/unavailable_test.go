@@ -0,0 +1,93 @@
+package telegram
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// unavailableCalls records the calls of OnUnavailable
+type unavailableCalls struct {
+	mu      sync.Mutex
+	methods []string
+	errors  []*UnavailableError
+}
+
+func (u *unavailableCalls) hook(method string, err *UnavailableError) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.methods = append(u.methods, method)
+	u.errors = append(u.errors, err)
+}
+
+func TestHTMLResponseIsUnavailable(t *testing.T) {
+	m := newMockServer(t)
+	client := m.client(t)
+	client.MaxRetries = 0
+	var calls unavailableCalls
+	client.OnUnavailable = calls.hook
+
+	m.respond("getChat", "502 <html><body><h1>502 Bad Gateway</h1></body></html>")
+	_, err := client.Request(GetChatConf{ChatID: 5})
+	var unavailable *UnavailableError
+	if !errors.As(err, &unavailable) {
+		t.Fatalf("err = %v (%T), want UnavailableError", err, err)
+	}
+	if unavailable.StatusCode != 502 || !strings.HasPrefix(unavailable.ContentType, "text/html") {
+		t.Fatalf("unavailable = %+v", unavailable)
+	}
+	if msg := err.Error(); msg != "Telegram API unavailable: 502 Bad Gateway" || strings.Contains(msg, "invalid character") {
+		t.Fatalf("message = %q", msg)
+	}
+	if len(calls.methods) != 1 || calls.methods[0] != "getChat" || calls.errors[0] != unavailable {
+		t.Fatalf("OnUnavailable calls = %v", calls.methods)
+	}
+
+	for _, body := range []string{"200 <html>maintenance</html>", "503 ", "504 upstream timed out"} {
+		m.respond("getChat", body)
+		if _, err := client.Request(GetChatConf{ChatID: 5}); !errors.As(err, &unavailable) {
+			t.Errorf("%q: err = %v, want UnavailableError", body, err)
+		}
+	}
+}
+
+func TestJSONServerErrorIsNotUnavailable(t *testing.T) {
+	m := newMockServer(t)
+	client := m.client(t)
+	client.MaxRetries = 0
+	var calls unavailableCalls
+	client.OnUnavailable = calls.hook
+	m.respond("getChat", `500 {"ok":false,"error_code":500,"description":"Internal Server Error"}`)
+	_, err := client.Request(GetChatConf{ChatID: 5})
+	var unavailable *UnavailableError
+	var apiErr *Error
+	if errors.As(err, &unavailable) || !errors.As(err, &apiErr) || apiErr.Code != 500 {
+		t.Fatalf("err = %v (%T), want the API error", err, err)
+	}
+	if len(calls.methods) != 0 {
+		t.Fatalf("OnUnavailable calls = %v", calls.methods)
+	}
+}
+
+func TestUnavailableIsRetried(t *testing.T) {
+	fastRetries(t)
+	m := newMockServer(t)
+	client := m.client(t)
+	var calls unavailableCalls
+	client.OnUnavailable = calls.hook
+	m.respond("getChat", "502 <html>Bad Gateway</html>", "200 <html>maintenance</html>", `{"ok":true,"result":{"id":5,"type":"private"}}`)
+	chat, err := client.GetChat(GetChatConf{ChatID: 5})
+	if err != nil || chat.ID != 5 {
+		t.Fatalf("GetChat = %v, %v, want the chat after the maintenance", chat, err)
+	}
+	if len(m.calls("getChat")) != 3 || len(calls.methods) != 2 {
+		t.Fatalf("%d requests, %d unavailable, want 3 and 2", len(m.calls("getChat")), len(calls.methods))
+	}
+
+	m.respond("sendMessage", "502 <html>Bad Gateway</html>", `{"ok":true,"result":{"message_id":9,"date":1,"chat":{"id":5,"type":"private"}}}`)
+	var unavailable *UnavailableError
+	if _, err := client.Send(NewMessage(5, "hi")); !errors.As(err, &unavailable) || len(m.calls("sendMessage")) != 1 {
+		t.Fatalf("Send = %v after %d requests, want one request that may have been delivered", err, len(m.calls("sendMessage")))
+	}
+}
@@ -0,0 +1,57 @@
+package telegram
+
+import (
+	"strings"
+	"testing"
+)
+
+// signedInitData is Web App init data signed with the token "123456:TEST-token"
+const signedInitData = "auth_date=1700000000&query_id=AAHdF6IQAAAAAN0XohDhrOrc" +
+	"&user=%7B%22id%22%3A279058397%2C%22first_name%22%3A%22Vlad%22%2C%22language_code%22%3A%22en%22%7D" +
+	"&hash=bf5d02872ff4e3ab578e75e0ba833e50cb757f7cc9bb6320ecca5741706b2d36"
+
+// webAppClient returns the Client with the token of signedInitData
+func webAppClient(t *testing.T) *Client {
+	m := newMockServer(t)
+	client, err := NewWithHost("123456:TEST-token", m.URL+"/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestValidateWebAppDataReturnsFields(t *testing.T) {
+	fields, err := webAppClient(t).ValidateWebAppData(signedInitData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fields.Get("query_id") != "AAHdF6IQAAAAAN0XohDhrOrc" || fields.Get("auth_date") != "1700000000" {
+		t.Fatalf("fields = %v", fields)
+	}
+	if user := fields.Get("user"); user != `{"id":279058397,"first_name":"Vlad","language_code":"en"}` {
+		t.Fatalf("user = %q", user)
+	}
+	if ok, err := ValidateWebAppData("123456:TEST-token", signedInitData); !ok || err != nil {
+		t.Fatalf("ValidateWebAppData = %t, %v", ok, err)
+	}
+}
+
+func TestValidateWebAppDataRejectsForgery(t *testing.T) {
+	client := webAppClient(t)
+	tests := map[string]string{
+		"tampered user": strings.Replace(signedInitData, "279058397", "279058398", 1),
+		"added field":   signedInitData + "&start_param=admin",
+		"another hash":  strings.Replace(signedInitData, "bf5d", "bf5e", 1),
+		"no hash":       signedInitData[:strings.Index(signedInitData, "&hash=")],
+		"invalid hash":  strings.Replace(signedInitData, "bf5d", "zz5d", 1),
+		"invalid query": "%zz",
+	}
+	for name, data := range tests {
+		if fields, err := client.ValidateWebAppData(data); err == nil || fields != nil {
+			t.Errorf("%s: fields = %v, err = %v, want an error", name, fields, err)
+		}
+	}
+	if ok, err := ValidateWebAppData("654321:other-token", signedInitData); ok || err == nil {
+		t.Fatalf("data signed with another token: %t, %v", ok, err)
+	}
+}
@@ -0,0 +1,154 @@
+package telegram
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestListenForWebhookTLSUploadsTheCertificate(t *testing.T) {
+	m := newMockServer(t)
+	m.respond("getWebhookInfo", `{"ok":true,"result":{"url":"https://127.0.0.1:8443/hook","has_custom_certificate":true,"pending_update_count":0}}`)
+	client := m.client(t)
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	link, _ := url.Parse("https://127.0.0.1:8443/hook")
+	_, server, err := client.ListenForWebhookTLS("127.0.0.1:0", SetWebhookConf{URL: link}, certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Shutdown(context.Background())
+	cert, err := os.ReadFile(certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := m.calls("setWebhook")
+	if len(calls) != 1 {
+		t.Fatalf("setWebhook calls = %d", len(calls))
+	}
+	if uploaded, ok := calls[0].part("certificate"); !ok || uploaded != string(cert) {
+		t.Fatalf("certificate part = %q, %t", uploaded, ok)
+	}
+	if value, ok := calls[0].part("url"); !ok || value != link.String() {
+		t.Fatalf("url part = %q, %t", value, ok)
+	}
+	info, err := client.GetWebhookInfo()
+	if err != nil || !info.HasCustomCertificate {
+		t.Fatalf("info = %+v, %v", info, err)
+	}
+}
+
+func TestListenForWebhookTLSKeepsTheExistingPair(t *testing.T) {
+	m := newMockServer(t)
+	dir := t.TempDir()
+	certPEM, keyPEM, err := NewSelfSignedCert("example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, certPEM, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	link, _ := url.Parse("https://example.com/hook")
+	_, server, err := m.client(t).ListenForWebhookTLS("127.0.0.1:0", SetWebhookConf{URL: link}, certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Shutdown(context.Background())
+	if uploaded, _ := m.calls("setWebhook")[0].part("certificate"); uploaded != string(certPEM) {
+		t.Fatal("the existing certificate is not uploaded")
+	}
+}
+
+func TestSetWebhookWithoutCertificateIsJSON(t *testing.T) {
+	m := newMockServer(t)
+	link, _ := url.Parse("https://example.com/hook")
+	if _, err := m.client(t).SetWebhook(SetWebhookConf{URL: link}); err != nil {
+		t.Fatal(err)
+	}
+	call := m.calls("setWebhook")[0]
+	if _, ok := call.part("certificate"); ok || string(call.Body) != `{"url":"https://example.com/hook"}` {
+		t.Fatalf("request = %s %s", call.ContentType, call.Body)
+	}
+}
+
+func TestNewWebhook(t *testing.T) {
+	tests := []struct {
+		link string
+		ok   bool
+	}{
+		{"https://example.com/hook?token=1", true},
+		{"https://127.0.0.1:8443/hook", true},
+		{"http://example.com/hook", false},
+		{"HTTP://example.com/hook", false},
+		{"example.com/hook", false},
+		{"https:///hook", false},
+		{"https://exa mple.com/hook", false},
+	}
+	for _, tt := range tests {
+		config, err := NewWebhook(tt.link)
+		if tt.ok && (err != nil || config.URL.String() != tt.link) {
+			t.Errorf("NewWebhook(%q) = %v, %v", tt.link, config.URL, err)
+		}
+		if !tt.ok && (err == nil || config.URL != nil) {
+			t.Errorf("NewWebhook(%q) = %v, want an error", tt.link, config.URL)
+		}
+		if _, certErr := NewWebhookWithCert(tt.link, FileBytes{Name: "cert.pem", Bytes: []byte("cert")}); (certErr == nil) != tt.ok {
+			t.Errorf("NewWebhookWithCert(%q) err = %v", tt.link, certErr)
+		}
+	}
+}
+
+func TestNewWebhookWithCertUploadsTheFile(t *testing.T) {
+	m := newMockServer(t)
+	certFile := filepath.Join(t.TempDir(), "cert.pem")
+	if err := os.WriteFile(certFile, []byte("-----BEGIN CERTIFICATE-----"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config, err := NewWebhookWithCert("https://example.com/hook", FilePath(certFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.client(t).Request(&config); err != nil {
+		t.Fatal(err)
+	}
+	call := m.calls("setWebhook")[0]
+	if uploaded, ok := call.part("certificate"); !ok || uploaded != "-----BEGIN CERTIFICATE-----" {
+		t.Fatalf("certificate part = %q, %t", uploaded, ok)
+	}
+	if link, _ := call.part("url"); link != "https://example.com/hook" {
+		t.Fatalf("url part = %q", link)
+	}
+}
+
+func TestSetWebhookUploadsFileBytesCertificate(t *testing.T) {
+	m := newMockServer(t)
+	link, _ := url.Parse("https://example.com/hook")
+	cert := FileBytes{Name: "cert.pem", Bytes: []byte("-----BEGIN CERTIFICATE-----\nMIIB\n")}
+	config := SetWebhookConf{URL: link, Certificate: cert, MaxConnections: 10}
+	if files := config.files(); len(files) != 1 || files[0].Name != "certificate" {
+		t.Fatalf("files = %+v", files)
+	}
+	if _, err := m.client(t).SetWebhook(config); err != nil {
+		t.Fatal(err)
+	}
+	call := m.calls("setWebhook")[0]
+	if !strings.HasPrefix(call.ContentType, "multipart/form-data") {
+		t.Fatalf("content type = %q", call.ContentType)
+	}
+	if uploaded, ok := call.part("certificate"); !ok || uploaded != string(cert.Bytes) {
+		t.Fatalf("certificate part = %q, %t", uploaded, ok)
+	}
+	if value, _ := call.part("max_connections"); value != "10" {
+		t.Fatalf("max_connections part = %q", value)
+	}
+	if files := (&SetWebhookConf{URL: link}).files(); files != nil {
+		t.Fatalf("files without a certificate = %+v", files)
+	}
+}